@@ -2,32 +2,60 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
 	"time"
 
 	_ "github.com/Mousa96/chatting-service/docs" // Import swagger docs
+	adminHandler "github.com/Mousa96/chatting-service/internal/admin/handler"
+	adminRepository "github.com/Mousa96/chatting-service/internal/admin/repository"
+	adminService "github.com/Mousa96/chatting-service/internal/admin/service"
 	authHandler "github.com/Mousa96/chatting-service/internal/auth/handler"
 	authRepository "github.com/Mousa96/chatting-service/internal/auth/repository"
 	authService "github.com/Mousa96/chatting-service/internal/auth/service"
+	contactHandler "github.com/Mousa96/chatting-service/internal/contact/handler"
+	contactRepository "github.com/Mousa96/chatting-service/internal/contact/repository"
+	contactService "github.com/Mousa96/chatting-service/internal/contact/service"
+	"github.com/Mousa96/chatting-service/internal/config"
 	"github.com/Mousa96/chatting-service/internal/db"
+	"github.com/Mousa96/chatting-service/internal/message/filter"
+	"github.com/Mousa96/chatting-service/internal/message/linkpreview"
+	mediaHandler "github.com/Mousa96/chatting-service/internal/media/handler"
+	"github.com/Mousa96/chatting-service/internal/media/imaging"
+	"github.com/Mousa96/chatting-service/internal/media/preview"
+	mediaRepository "github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/media/scan"
+	mediaService "github.com/Mousa96/chatting-service/internal/media/service"
 	msgHandler "github.com/Mousa96/chatting-service/internal/message/handler"
+	msgModels "github.com/Mousa96/chatting-service/internal/message/models"
 	msgRepo "github.com/Mousa96/chatting-service/internal/message/repository"
 	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	moderationHandler "github.com/Mousa96/chatting-service/internal/moderation/handler"
+	moderationRepository "github.com/Mousa96/chatting-service/internal/moderation/repository"
+	moderationService "github.com/Mousa96/chatting-service/internal/moderation/service"
 	"github.com/Mousa96/chatting-service/internal/router"
 	"github.com/Mousa96/chatting-service/internal/storage"
+	uploadHandler "github.com/Mousa96/chatting-service/internal/upload/handler"
+	uploadRepository "github.com/Mousa96/chatting-service/internal/upload/repository"
+	uploadService "github.com/Mousa96/chatting-service/internal/upload/service"
 	userHandler "github.com/Mousa96/chatting-service/internal/user/handler"
+	userModels "github.com/Mousa96/chatting-service/internal/user/models"
 	userRepository "github.com/Mousa96/chatting-service/internal/user/repository"
 	userService "github.com/Mousa96/chatting-service/internal/user/service"
 
 	wsHandler "github.com/Mousa96/chatting-service/internal/websocket/handler"
 	wsService "github.com/Mousa96/chatting-service/internal/websocket/service"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	//chatHandler "github.com/Mousa96/chatting-service/internal/chat/models"
 )
 
 func main() {
+	cfg := config.Load()
+
 	// Database configuration
 	dbConfig := &db.Config{
 		Host:     "db",
@@ -59,33 +87,190 @@ func main() {
 	// Initialize repositories
 	authRepo := authRepository.NewUserRepository(database)
 	userRepo := userRepository.NewPostgresRepository(database)
+	contactRepo := contactRepository.NewContactRepository(database)
+	moderationRepo := moderationRepository.NewModerationRepository(database)
+	mediaRepo := mediaRepository.NewMediaRepository(database)
 	
-	// Initialize storage
-	fileStorage := storage.NewLocalStorage("/app/uploads", "/uploads")
+	// Initialize storage. With S3, clients may also upload straight to the bucket.
+	var fileStorage storage.Storage
+	var uploadOpts []uploadService.Option
+	switch cfg.Storage.Backend {
+	case "s3":
+		if cfg.Storage.S3Bucket == "" {
+			log.Fatal("S3_BUCKET is required when STORAGE_BACKEND=s3")
+		}
+		s3Client := storage.NewS3Client(storage.S3Config{
+			Region:          cfg.Storage.S3Region,
+			Endpoint:        cfg.Storage.S3Endpoint,
+			AccessKeyID:     cfg.Storage.S3AccessKeyID,
+			SecretAccessKey: cfg.Storage.S3SecretAccessKey,
+			SessionToken:    cfg.Storage.S3SessionToken,
+			PathStyle:       cfg.Storage.S3PathStyle,
+		})
+		s3Storage := storage.NewS3Storage(s3Client, cfg.Storage.S3Bucket, "/api/media",
+			storage.WithPresignClient(s3.NewPresignClient(s3Client)),
+			storage.WithPartSize(cfg.Storage.S3PartSize),
+		)
+		fileStorage = s3Storage
+		uploadOpts = append(uploadOpts,
+			uploadService.WithDirectUploads(s3Storage, cfg.Uploads.DirectURLTTL, cfg.Uploads.DirectTypes))
+	default:
+		fileStorage = storage.NewLocalStorage(cfg.Storage.LocalPath, "/api/media")
+	}
 	
 	// Initialize JWT key
 	jwtKey := []byte("your-secret-key") // In production, use environment variable
+	mediaSigningKey := jwtKey
+	if cfg.Media.SigningKey != "" {
+		mediaSigningKey = []byte(cfg.Media.SigningKey)
+	}
 	
+	// Poster frames and waveforms need ffmpeg; without it videos and audio are stored
+	// without previews
+	var previewOpts []preview.Option
+	if cfg.Media.FFmpegPath != "off" {
+		if path, err := exec.LookPath(cfg.Media.FFmpegPath); err == nil {
+			previewOpts = append(previewOpts,
+				preview.WithFrameExtractor(preview.NewFFmpegFrames(path)),
+				preview.WithAudioDecoder(preview.NewFFmpegAudio(path)))
+		} else {
+			log.Printf("ffmpeg not found (%v); video poster frames and audio waveforms are disabled", err)
+		}
+	}
+	previewGenerator := preview.NewGenerator(fileStorage, cfg.Media.ThumbnailSizes, previewOpts...)
+
+	storageLimits := userModels.StorageLimits{
+		DefaultQuota: cfg.Storage.DefaultQuota,
+		GlobalQuota:  cfg.Storage.GlobalQuota,
+	}
+	storageQuota := userService.NewStorageQuota(userRepo, storageLimits)
+	blobStore := storage.NewBlobStore(fileStorage, mediaRepo)
+
 	// Initialize services
 	authSvc := authService.NewAuthService(authRepo, jwtKey)
-	userSvc := userService.NewUserService(userRepo)
-	messageSvc := msgService.NewMessageService(msgRepo.NewMessageRepository(database), fileStorage)
-	wsSvc := wsService.NewWebSocketService(messageSvc, jwtKey)
+	accounts := userService.NewAccountChecker(userRepo)
+	messageOpts := []msgService.Option{
+		msgService.WithAccounts(accounts),
+		msgService.WithDeliveryPolicy(contactService.NewDeliveryPolicy(contactRepo)),
+		msgService.WithFilter(
+			filter.NewMaxLengthFilter(cfg.Filters.MaxMessageLength),
+			filter.NewBannedWordFilter(cfg.Filters.BannedWords, msgService.FilterAction(cfg.Filters.BannedWordAction)),
+			filter.NewLinkBlocklistFilter(cfg.Filters.BlockedLinkDomains),
+			filter.NewRepeatFilter(cfg.Filters.RepeatLimit, cfg.Filters.RepeatWindow),
+		),
+		msgService.WithFlagRecorder(moderationService.NewFlagRecorder(moderationRepo)),
+		msgService.WithAttachmentStore(mediaRepo),
+		msgService.WithPreviews(previewGenerator),
+		msgService.WithStorageQuota(storageQuota),
+		msgService.WithBlobStore(blobStore),
+		msgService.WithMediaPolicy(msgService.NewMediaPolicy(cfg.Media.AttachmentTypes)),
+		msgService.WithMentionResolver(userService.NewMentionResolver(userRepo)),
+	}
+	if cfg.Media.ClamdAddress != "" {
+		clamd := scan.NewClamd(cfg.Media.ClamdAddress,
+			scan.WithTimeout(cfg.Media.ClamdTimeout),
+			scan.WithSuspiciousPrefixes(cfg.Media.SuspiciousSignatures),
+		)
+		// Uploads are refused rather than stored unscanned while clamd is unreachable
+		if err := clamd.Ping(); err != nil {
+			log.Printf("Warning: clamd at %s is not responding: %v", cfg.Media.ClamdAddress, err)
+		}
+		messageOpts = append(messageOpts, msgService.WithScanner(clamd, mediaRepo))
+	}
+	if cfg.Media.SanitizeImages {
+		messageOpts = append(messageOpts, msgService.WithImageSanitizer(
+			imaging.NewSanitizer(cfg.Media.MaxImageDimension, cfg.Media.JPEGQuality)))
+	}
+	if cfg.LinkPreviews.Enabled {
+		messageOpts = append(messageOpts, msgService.WithLinkPreviews())
+	}
+	messageRepo := msgRepo.NewMessageRepository(database)
+	messageSvc := msgService.NewMessageService(messageRepo, fileStorage, messageOpts...)
+	wsSvc := wsService.NewWebSocketService(messageSvc, jwtKey,
+		wsService.WithRelationships(contactService.NewRelationships(contactRepo)),
+		wsService.WithAccountChecker(accounts),
+	)
+	messageSvc.SetNotifier(wsSvc)
+	if cfg.LinkPreviews.Enabled {
+		fetcherOpts := []linkpreview.Option{
+			linkpreview.WithTimeout(cfg.LinkPreviews.Timeout),
+			linkpreview.WithMaxBytes(cfg.LinkPreviews.MaxBytes),
+		}
+		if cfg.LinkPreviews.AllowPrivate {
+			fetcherOpts = append(fetcherOpts, linkpreview.WithPrivateNetworks())
+		}
+		linkPreviewWorker := msgService.NewLinkPreviewWorker(messageRepo, linkpreview.NewFetcher(fetcherOpts...), wsSvc,
+			msgService.WithLinkPreviewCacheTTL(cfg.LinkPreviews.CacheTTL),
+		)
+		go linkPreviewWorker.Run(context.Background(), cfg.LinkPreviews.Interval)
+	}
+	scheduler := msgService.NewScheduler(messageRepo, messageSvc, wsSvc,
+		msgService.WithSenderAccounts(accounts),
+	)
+	go scheduler.Run(context.Background(), cfg.Scheduler.Interval)
+	userSvc := userService.NewUserService(userRepo,
+		userService.WithStorage(fileStorage),
+		userService.WithNotifier(wsSvc),
+		userService.WithPresence(wsSvc),
+		userService.WithStorageLimits(storageLimits),
+	)
+	mediaCollector := mediaService.NewCollector(mediaRepo, fileStorage, cfg.Media.GCGracePeriod,
+		mediaService.WithBlobReleaser(blobStore),
+		mediaService.WithQuotaReleaser(storageQuota),
+		mediaService.WithDryRun(cfg.Media.GCDryRun),
+	)
+	go mediaCollector.Run(context.Background(), cfg.Media.GCInterval)
+	reaper := msgService.NewReaper(messageRepo, mediaCollector, wsSvc, msgModels.RetentionPolicy{
+		MaxAge:         cfg.Retention.MaxAge,
+		ExternalMaxAge: cfg.Retention.ExternalMaxAge,
+	})
+	go reaper.Run(context.Background(), cfg.Retention.Interval)
+	adminOpts := []adminService.Option{adminService.WithMediaCollector(mediaCollector)}
+	if cfg.Media.ClamdAddress != "" {
+		adminOpts = append(adminOpts, adminService.WithQuarantine(mediaService.NewQuarantine(mediaRepo, fileStorage)))
+	}
+	adminSvc := adminService.NewAdminService(adminRepository.NewStatsRepository(database), userSvc, wsSvc, adminOpts...)
+	contactSvc := contactService.NewContactService(contactRepo,
+		contactService.WithNotifier(wsSvc),
+		contactService.WithPresence(wsSvc),
+	)
+	mediaSvc := mediaService.NewMediaService(mediaRepo, fileStorage, mediaSigningKey, cfg.Media.URLTTL)
+	chunkStorage, ok := fileStorage.(uploadService.ChunkStorage)
+	if !ok {
+		log.Fatal("Storage backend does not support resumable uploads")
+	}
+	uploadSvc := uploadService.NewUploadService(uploadRepository.NewUploadRepository(database), chunkStorage,
+		messageSvc, cfg.Uploads.MaxSize, cfg.Uploads.Expiry, uploadOpts...)
+	go uploadSvc.Run(context.Background(), cfg.Uploads.PurgeInterval)
+	moderationSvc := moderationService.NewModerationService(moderationRepo, userSvc,
+		moderationService.WithRealtime(wsSvc),
+	)
 	
 	// Initialize handlers
 	authHdlr := authHandler.NewAuthHandler(authSvc)
 	userHdlr := userHandler.NewUserHandler(userSvc)
 	messageHdlr := msgHandler.NewMessageHandler(messageSvc)
 	wsHdlr := wsHandler.NewWebSocketHandler(wsSvc)
+	adminHdlr := adminHandler.NewAdminHandler(adminSvc)
+	contactHdlr := contactHandler.NewContactHandler(contactSvc)
+	moderationHdlr := moderationHandler.NewModerationHandler(moderationSvc)
+	mediaHdlr := mediaHandler.NewMediaHandler(mediaSvc)
+	uploadHdlr := uploadHandler.NewUploadHandler(uploadSvc)
 
 	
 	// Configure router
 	routerConfig := router.Config{
-		AuthHandler:      authHdlr,
-		MessageHandler:   messageHdlr,
-		UserHandler:      userHdlr,
-		WebSocketHandler: wsHdlr,
-		JWTKey:           jwtKey,
+		AuthHandler:       authHdlr,
+		MessageHandler:    messageHdlr,
+		UserHandler:       userHdlr,
+		WebSocketHandler:  wsHdlr,
+		AdminHandler:      adminHdlr,
+		ContactHandler:    contactHdlr,
+		ModerationHandler: moderationHdlr,
+		MediaHandler:      mediaHdlr,
+		UploadHandler:     uploadHdlr,
+		JWTKey:            jwtKey,
+		Accounts:          accounts,
 	}
 	
 	// Create server with timeouts
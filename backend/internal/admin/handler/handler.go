@@ -0,0 +1,484 @@
+// Package handler implements the HTTP handlers for administration operations
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/Mousa96/chatting-service/internal/admin/models"
+	"github.com/Mousa96/chatting-service/internal/admin/service"
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
+	mediaRepository "github.com/Mousa96/chatting-service/internal/media/repository"
+	mediaService "github.com/Mousa96/chatting-service/internal/media/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+	userRepository "github.com/Mousa96/chatting-service/internal/user/repository"
+	userService "github.com/Mousa96/chatting-service/internal/user/service"
+)
+
+// AdminHandler provides the implementation of the Handler interface
+type AdminHandler struct {
+	adminService service.Service
+}
+
+// NewAdminHandler creates a new AdminHandler instance
+func NewAdminHandler(adminService service.Service) Handler {
+	return &AdminHandler{adminService: adminService}
+}
+
+// ListUsers godoc
+// @Summary List all users
+// @Description Retrieve every user account including role and suspension state
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string][]object "Users"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /admin/users [get]
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.adminService.ListUsers()
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"users": users,
+	})
+}
+
+// SuspendUser godoc
+// @Summary Suspend or reinstate a user
+// @Description Suspend a user account, which blocks login and closes their WebSocket connection, or reinstate it
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.SuspendUserRequest true "Suspension request"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "User not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /admin/users/suspend [post]
+func (h *AdminHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SuspendUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.adminService.SuspendUser(adminID, req.UserID, req.Suspended); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description Permanently delete a user account and the messages they sent or received
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.UserActionRequest true "User to delete"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "User not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /admin/users/delete [post]
+func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UserActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.adminService.DeleteUser(adminID, req.UserID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// SetUserRole godoc
+// @Summary Change a user's role
+// @Description Grant a user the user, moderator or admin role. Takes effect at once, including for tokens already issued
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.SetRoleRequest true "Role change request"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "User not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /admin/users/role [post]
+func (h *AdminHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.adminService.SetUserRole(adminID, req.UserID, authModels.Role(req.Role)); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// SetUserExternal godoc
+// @Summary Mark a user as external
+// @Description Mark a user as external, such as a contractor, or internal again. Messages an external user sends or receives are deleted once older than the external retention period
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.SetExternalRequest true "External flag change request"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "User not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /admin/users/external [post]
+func (h *AdminHandler) SetUserExternal(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetExternalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.adminService.SetUserExternal(adminID, req.UserID, req.External); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// SetStorageQuota godoc
+// @Summary Set a user's storage quota
+// @Description Give a user a storage quota of their own in bytes, or send a null quota to return them to the default. Files already stored are kept when the quota is lowered
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.SetStorageQuotaRequest true "Quota change request"
+// @Success 200 {object} map[string]interface{} "The user's storage usage under the new quota"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "User not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /admin/users/storage-quota [post]
+func (h *AdminHandler) SetStorageQuota(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetStorageQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	usage, err := h.adminService.SetStorageQuota(adminID, req.UserID, req.QuotaBytes)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// CollectMedia godoc
+// @Summary Collect orphaned media
+// @Description Remove uploads never sent in a message, shared files no attachment uses and stored files nothing refers to, once they are older than the grace period. A dry run only reports what would be removed
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.CollectMediaRequest true "Collection request"
+// @Success 200 {object} map[string]interface{} "The removed files"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 409 {string} string "A collection is already running"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Garbage collection is not enabled"
+// @Security Bearer
+// @Router /admin/media/gc [post]
+func (h *AdminHandler) CollectMedia(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CollectMediaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.adminService.CollectMedia(adminID, req.DryRun)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// ListQuarantinedFiles godoc
+// @Summary List quarantined files
+// @Description Retrieve a page of uploads the malware scanner found suspicious, newest first. Pass next_before from the previous page as before to continue; an empty page marks the end.
+// @Tags admin
+// @Produce json
+// @Param before query int false "Only return files with a lower ID"
+// @Param limit query int false "Page size, default 50, maximum 100"
+// @Success 200 {object} map[string]interface{} "Files and next_before"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 503 {string} string "Malware scanning is not enabled"
+// @Security Bearer
+// @Router /admin/quarantine [get]
+func (h *AdminHandler) ListQuarantinedFiles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	before, err := intParam(query.Get("before"))
+	if err != nil {
+		http.Error(w, "invalid before parameter", http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(query.Get("limit"))
+	if err != nil {
+		http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	files, err := h.adminService.ListQuarantinedFiles(before, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{"files": files}
+	if len(files) > 0 {
+		response["next_before"] = files[len(files)-1].ID
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// DownloadQuarantinedFile godoc
+// @Summary Download a quarantined file
+// @Description Download a suspicious upload for review. It is always sent as an attachment and never rendered.
+// @Tags admin
+// @Produce octet-stream
+// @Param id query int true "Quarantined file ID"
+// @Success 200 {file} file "The file content"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Quarantined file not found"
+// @Failure 503 {string} string "Malware scanning is not enabled"
+// @Security Bearer
+// @Router /admin/quarantine/file [get]
+func (h *AdminHandler) DownloadQuarantinedFile(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := intParam(r.URL.Query().Get("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	file, content, err := h.adminService.OpenQuarantinedFile(adminID, id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	defer content.Close()
+
+	// The file is suspected malware, so browsers must save rather than display it
+	filename := file.Filename
+	if filename == "" {
+		filename = path.Base(file.Key)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("Failed to send quarantined file %d: %v", id, err)
+	}
+}
+
+// DeleteQuarantinedFile godoc
+// @Summary Delete a quarantined file
+// @Description Permanently remove a reviewed quarantined file
+// @Tags admin
+// @Accept json
+// @Param request body models.QuarantineActionRequest true "File to delete"
+// @Success 204 "File deleted"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Quarantined file not found"
+// @Failure 503 {string} string "Malware scanning is not enabled"
+// @Security Bearer
+// @Router /admin/quarantine/delete [post]
+func (h *AdminHandler) DeleteQuarantinedFile(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.QuarantineActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.adminService.DeleteQuarantinedFile(adminID, req.ID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisconnectUser godoc
+// @Summary Disconnect a user
+// @Description Close the user's active WebSocket connection
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.UserActionRequest true "User to disconnect"
+// @Success 200 {object} map[string]bool "Whether a connection was closed"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Security Bearer
+// @Router /admin/users/disconnect [post]
+func (h *AdminHandler) DisconnectUser(w http.ResponseWriter, r *http.Request) {
+	var req models.UserActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	disconnected := h.adminService.DisconnectUser(req.UserID)
+	writeJSON(w, http.StatusOK, map[string]bool{"disconnected": disconnected})
+}
+
+// GetStats godoc
+// @Summary Get system statistics
+// @Description Retrieve user, message and connection counts
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.SystemStats "System statistics"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /admin/stats [get]
+func (h *AdminHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.adminService.GetStats()
+	if err != nil {
+		log.Printf("Error getting stats: %v", err)
+		http.Error(w, "failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// writeServiceError maps service errors to HTTP status codes
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSelfAction), errors.Is(err, service.ErrInvalidRole),
+		errors.Is(err, userService.ErrInvalidQuota):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, mediaService.ErrCollectionRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrMediaCollectionDisabled), errors.Is(err, service.ErrQuarantineDisabled),
+		errors.Is(err, mediaService.ErrUnsupportedStorage):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, mediaRepository.ErrQuarantinedFileNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, userRepository.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Printf("Admin operation failed: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// intParam parses an optional non-negative integer query parameter, zero when absent
+func intParam(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, errors.New("invalid integer")
+	}
+	return value, nil
+}
+
+// writeJSON sends a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
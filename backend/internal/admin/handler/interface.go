@@ -0,0 +1,32 @@
+// Package handler provides HTTP handlers for administration operations
+package handler
+
+import "net/http"
+
+// Handler defines the administration handling interface
+type Handler interface {
+	// ListUsers returns every user account
+	ListUsers(w http.ResponseWriter, r *http.Request)
+	// SuspendUser suspends or reinstates a user account
+	SuspendUser(w http.ResponseWriter, r *http.Request)
+	// DeleteUser permanently removes a user account
+	DeleteUser(w http.ResponseWriter, r *http.Request)
+	// SetUserRole changes the role of a user
+	SetUserRole(w http.ResponseWriter, r *http.Request)
+	// SetUserExternal marks a user as external or internal
+	SetUserExternal(w http.ResponseWriter, r *http.Request)
+	// SetStorageQuota overrides a user's storage quota
+	SetStorageQuota(w http.ResponseWriter, r *http.Request)
+	// CollectMedia removes orphaned media or reports what would be removed
+	CollectMedia(w http.ResponseWriter, r *http.Request)
+	// ListQuarantinedFiles returns a page of uploads held by the malware scanner
+	ListQuarantinedFiles(w http.ResponseWriter, r *http.Request)
+	// DownloadQuarantinedFile sends the content of a quarantined file
+	DownloadQuarantinedFile(w http.ResponseWriter, r *http.Request)
+	// DeleteQuarantinedFile removes a reviewed quarantined file
+	DeleteQuarantinedFile(w http.ResponseWriter, r *http.Request)
+	// DisconnectUser closes a user's WebSocket connection
+	DisconnectUser(w http.ResponseWriter, r *http.Request)
+	// GetStats returns system statistics
+	GetStats(w http.ResponseWriter, r *http.Request)
+}
@@ -0,0 +1,57 @@
+// Package models provides the data structures for administration functionality
+package models
+
+import "time"
+
+// SystemStats summarizes the state of the service for administrators
+type SystemStats struct {
+	TotalUsers      int       `json:"total_users"`
+	SuspendedUsers  int       `json:"suspended_users"`
+	AdminUsers      int       `json:"admin_users"`
+	TotalMessages   int       `json:"total_messages"`
+	MessagesLast24h int       `json:"messages_last_24h"`
+	ConnectedUsers  int       `json:"connected_users"`
+	StorageUsed     int64     `json:"storage_used_bytes"`
+	GeneratedAt     time.Time `json:"generated_at"`
+}
+
+// SuspendUserRequest represents the request body for suspending or reinstating a user
+type SuspendUserRequest struct {
+	UserID    int  `json:"user_id" validate:"required"`
+	Suspended bool `json:"suspended"`
+}
+
+// SetRoleRequest represents the request body for changing a user's role
+type SetRoleRequest struct {
+	UserID int    `json:"user_id" validate:"required"`
+	Role   string `json:"role" validate:"required"`
+}
+
+// SetExternalRequest represents the request body for marking a user as external
+type SetExternalRequest struct {
+	UserID   int  `json:"user_id" validate:"required"`
+	External bool `json:"external"`
+}
+
+// UserActionRequest represents a request body that targets a single user
+type UserActionRequest struct {
+	UserID int `json:"user_id" validate:"required"`
+}
+
+// SetStorageQuotaRequest represents the request body for changing a user's storage quota
+type SetStorageQuotaRequest struct {
+	UserID int `json:"user_id" validate:"required"`
+	// QuotaBytes is the new quota, or null to return the user to the default quota
+	QuotaBytes *int64 `json:"quota_bytes"`
+}
+
+// CollectMediaRequest represents the request body for running media garbage collection
+type CollectMediaRequest struct {
+	// DryRun reports what would be removed without deleting anything
+	DryRun bool `json:"dry_run"`
+}
+
+// QuarantineActionRequest represents a request body that targets a quarantined file
+type QuarantineActionRequest struct {
+	ID int `json:"id" validate:"required"`
+}
@@ -0,0 +1,10 @@
+// Package repository provides data access interfaces and implementations for administration
+package repository
+
+import "github.com/Mousa96/chatting-service/internal/admin/models"
+
+// Repository defines the data access operations needed by administrators
+type Repository interface {
+	// GetStats aggregates user and message counts across the system
+	GetStats() (*models.SystemStats, error)
+}
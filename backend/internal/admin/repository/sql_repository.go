@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/admin/models"
+)
+
+// SQLStatsRepository provides a PostgreSQL implementation of Repository
+type SQLStatsRepository struct {
+	db *sql.DB
+}
+
+// NewStatsRepository creates a new SQLStatsRepository instance
+func NewStatsRepository(db *sql.DB) Repository {
+	return &SQLStatsRepository{db: db}
+}
+
+func (r *SQLStatsRepository) GetStats() (*models.SystemStats, error) {
+	const query = `
+        SELECT
+            (SELECT COUNT(*) FROM users),
+            (SELECT COUNT(*) FROM users WHERE suspended_at IS NOT NULL),
+            (SELECT COUNT(*) FROM users WHERE role = 'admin'),
+            (SELECT COUNT(*) FROM messages),
+            (SELECT COUNT(*) FROM messages WHERE created_at > NOW() - INTERVAL '24 hours'),
+            (SELECT COALESCE(SUM(storage_used), 0) FROM users)`
+
+	stats := &models.SystemStats{GeneratedAt: time.Now()}
+	err := r.db.QueryRow(query).Scan(
+		&stats.TotalUsers,
+		&stats.SuspendedUsers,
+		&stats.AdminUsers,
+		&stats.TotalMessages,
+		&stats.MessagesLast24h,
+		&stats.StorageUsed,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+	return stats, nil
+}
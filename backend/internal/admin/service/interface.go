@@ -0,0 +1,58 @@
+// Package service provides the business logic for administration operations
+package service
+
+import (
+	"io"
+
+	"github.com/Mousa96/chatting-service/internal/admin/models"
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	userModels "github.com/Mousa96/chatting-service/internal/user/models"
+)
+
+// Service defines the administration operations interface
+type Service interface {
+	// ListUsers returns every user account, including suspended ones
+	ListUsers() ([]userModels.User, error)
+	// SuspendUser suspends or reinstates a user and drops their live connection
+	SuspendUser(adminID, userID int, suspended bool) error
+	// DeleteUser permanently removes a user and drops their live connection
+	DeleteUser(adminID, userID int) error
+	// SetUserRole changes the role granted to a user
+	SetUserRole(adminID, userID int, role authModels.Role) error
+	// SetUserExternal marks a user as external, so their conversations are kept for the
+	// external retention period
+	SetUserExternal(adminID, userID int, external bool) error
+	// SetStorageQuota gives a user their own storage quota, or restores the default when quota is nil
+	SetStorageQuota(adminID, userID int, quota *int64) (*userModels.StorageUsage, error)
+	// CollectMedia removes orphaned media now, or only reports what would be removed in a dry run
+	CollectMedia(adminID int, dryRun bool) (*mediaModels.CollectionReport, error)
+	// ListQuarantinedFiles returns a page of uploads held for review, newest first
+	ListQuarantinedFiles(beforeID, limit int) ([]mediaModels.QuarantinedFile, error)
+	// OpenQuarantinedFile returns a quarantined file and its content, which the caller must close
+	OpenQuarantinedFile(adminID, id int) (*mediaModels.QuarantinedFile, io.ReadCloser, error)
+	// DeleteQuarantinedFile removes a quarantined file once it has been reviewed
+	DeleteQuarantinedFile(adminID, id int) error
+	// DisconnectUser closes the user's WebSocket connection and reports whether one existed
+	DisconnectUser(userID int) bool
+	// GetStats returns system wide statistics
+	GetStats() (*models.SystemStats, error)
+}
+
+// ConnectionManager is implemented by the WebSocket service to manage live connections
+type ConnectionManager interface {
+	DisconnectUser(userID int) bool
+	ConnectedUserCount() int
+}
+
+// MediaCollector is implemented by the media garbage collector
+type MediaCollector interface {
+	Collect(dryRun bool) (*mediaModels.CollectionReport, error)
+}
+
+// QuarantineReviewer is implemented by the store of uploads held by the malware scanner
+type QuarantineReviewer interface {
+	List(beforeID, limit int) ([]mediaModels.QuarantinedFile, error)
+	Open(id int) (*mediaModels.QuarantinedFile, io.ReadCloser, error)
+	Delete(id int) (*mediaModels.QuarantinedFile, error)
+}
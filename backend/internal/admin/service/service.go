@@ -0,0 +1,211 @@
+// Package service implements the administration business logic
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/Mousa96/chatting-service/internal/admin/models"
+	"github.com/Mousa96/chatting-service/internal/admin/repository"
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	userModels "github.com/Mousa96/chatting-service/internal/user/models"
+	userService "github.com/Mousa96/chatting-service/internal/user/service"
+)
+
+var (
+	// ErrSelfAction is returned when an administrator targets their own account
+	ErrSelfAction = errors.New("cannot perform this action on your own account")
+	// ErrInvalidRole is returned when an unknown role is requested
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrMediaCollectionDisabled is returned when no media garbage collector is configured
+	ErrMediaCollectionDisabled = errors.New("media garbage collection is not enabled")
+	// ErrQuarantineDisabled is returned when uploads are not scanned for malware
+	ErrQuarantineDisabled = errors.New("malware scanning is not enabled")
+)
+
+// AdminService provides the implementation of the Service interface
+type AdminService struct {
+	statsRepo   repository.Repository
+	userService userService.Service
+	connections ConnectionManager
+	collector   MediaCollector
+	quarantine  QuarantineReviewer
+}
+
+// Option configures optional AdminService dependencies
+type Option func(*AdminService)
+
+// WithMediaCollector lets administrators run media garbage collection on demand
+func WithMediaCollector(collector MediaCollector) Option {
+	return func(s *AdminService) {
+		s.collector = collector
+	}
+}
+
+// WithQuarantine lets administrators review uploads the malware scanner set aside
+func WithQuarantine(quarantine QuarantineReviewer) Option {
+	return func(s *AdminService) {
+		s.quarantine = quarantine
+	}
+}
+
+// NewAdminService creates a new AdminService instance
+func NewAdminService(statsRepo repository.Repository, userService userService.Service, connections ConnectionManager, opts ...Option) Service {
+	s := &AdminService{
+		statsRepo:   statsRepo,
+		userService: userService,
+		connections: connections,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *AdminService) ListUsers() ([]userModels.User, error) {
+	users, err := s.userService.GetAllUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	if users == nil {
+		users = []userModels.User{}
+	}
+	return users, nil
+}
+
+func (s *AdminService) SuspendUser(adminID, userID int, suspended bool) error {
+	if adminID == userID {
+		return ErrSelfAction
+	}
+
+	if err := s.userService.SuspendUser(userID, suspended); err != nil {
+		return fmt.Errorf("failed to update suspension: %w", err)
+	}
+	log.Printf("Admin %d set suspended=%t for user %d", adminID, suspended, userID)
+
+	if suspended {
+		s.DisconnectUser(userID)
+	}
+	return nil
+}
+
+func (s *AdminService) DeleteUser(adminID, userID int) error {
+	if adminID == userID {
+		return ErrSelfAction
+	}
+
+	s.DisconnectUser(userID)
+	if err := s.userService.DeleteUser(userID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	log.Printf("Admin %d deleted user %d", adminID, userID)
+	return nil
+}
+
+// SetUserRole changes a user's role. The new permissions apply to the user's existing
+// tokens too, from their next request or WebSocket connection.
+func (s *AdminService) SetUserRole(adminID, userID int, role authModels.Role) error {
+	if !role.IsValid() {
+		return fmt.Errorf("%w: %s", ErrInvalidRole, role)
+	}
+	if adminID == userID {
+		return ErrSelfAction
+	}
+
+	if err := s.userService.SetUserRole(userID, string(role)); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	log.Printf("Admin %d set role %s for user %d", adminID, role, userID)
+	return nil
+}
+
+func (s *AdminService) SetUserExternal(adminID, userID int, external bool) error {
+	if err := s.userService.SetUserExternal(userID, external); err != nil {
+		return fmt.Errorf("failed to update external flag: %w", err)
+	}
+	log.Printf("Admin %d set external=%t for user %d", adminID, external, userID)
+	return nil
+}
+
+func (s *AdminService) SetStorageQuota(adminID, userID int, quota *int64) (*userModels.StorageUsage, error) {
+	usage, err := s.userService.SetStorageQuota(userID, quota)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update storage quota: %w", err)
+	}
+	if quota == nil {
+		log.Printf("Admin %d restored the default storage quota for user %d", adminID, userID)
+	} else {
+		log.Printf("Admin %d set a storage quota of %d bytes for user %d", adminID, *quota, userID)
+	}
+	return usage, nil
+}
+
+func (s *AdminService) CollectMedia(adminID int, dryRun bool) (*mediaModels.CollectionReport, error) {
+	if s.collector == nil {
+		return nil, ErrMediaCollectionDisabled
+	}
+	report, err := s.collector.Collect(dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect media: %w", err)
+	}
+	if dryRun {
+		log.Printf("Admin %d ran a media garbage collection dry run: %d files (%d bytes) would be removed",
+			adminID, len(report.Removed), report.RemovedBytes)
+	} else {
+		log.Printf("Admin %d ran media garbage collection: %d files (%d bytes) removed",
+			adminID, len(report.Removed), report.RemovedBytes)
+	}
+	return report, nil
+}
+
+func (s *AdminService) ListQuarantinedFiles(beforeID, limit int) ([]mediaModels.QuarantinedFile, error) {
+	if s.quarantine == nil {
+		return nil, ErrQuarantineDisabled
+	}
+	return s.quarantine.List(beforeID, limit)
+}
+
+func (s *AdminService) OpenQuarantinedFile(adminID, id int) (*mediaModels.QuarantinedFile, io.ReadCloser, error) {
+	if s.quarantine == nil {
+		return nil, nil, ErrQuarantineDisabled
+	}
+	file, content, err := s.quarantine.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Admin %d downloaded quarantined file %d (%s)", adminID, id, file.Signature)
+	return file, content, nil
+}
+
+func (s *AdminService) DeleteQuarantinedFile(adminID, id int) error {
+	if s.quarantine == nil {
+		return ErrQuarantineDisabled
+	}
+	file, err := s.quarantine.Delete(id)
+	if err != nil {
+		return err
+	}
+	log.Printf("Admin %d deleted quarantined file %d (%s) uploaded by user %d", adminID, id, file.Signature, file.OwnerID)
+	return nil
+}
+
+func (s *AdminService) DisconnectUser(userID int) bool {
+	if s.connections == nil {
+		return false
+	}
+	return s.connections.DisconnectUser(userID)
+}
+
+func (s *AdminService) GetStats() (*models.SystemStats, error) {
+	stats, err := s.statsRepo.GetStats()
+	if err != nil {
+		return nil, err
+	}
+	if s.connections != nil {
+		stats.ConnectedUsers = s.connections.ConnectedUserCount()
+	}
+	return stats, nil
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Mousa96/chatting-service/internal/admin/models"
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
+	userModels "github.com/Mousa96/chatting-service/internal/user/models"
+	userRepository "github.com/Mousa96/chatting-service/internal/user/repository"
+	userService "github.com/Mousa96/chatting-service/internal/user/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUserService implements the user operations used by the admin service.
+// The embedded interface is nil, so any other method panics if called.
+type fakeUserService struct {
+	userService.Service
+	users map[int]*userModels.User
+}
+
+func newFakeUserService(ids ...int) *fakeUserService {
+	s := &fakeUserService{users: make(map[int]*userModels.User)}
+	for _, id := range ids {
+		s.users[id] = &userModels.User{ID: id, Username: fmt.Sprintf("user%d", id), Role: string(authModels.RoleUser)}
+	}
+	return s
+}
+
+func (s *fakeUserService) GetAllUsers() ([]userModels.User, error) {
+	var users []userModels.User
+	for _, u := range s.users {
+		users = append(users, *u)
+	}
+	return users, nil
+}
+
+func (s *fakeUserService) SuspendUser(userID int, suspended bool) error {
+	u, ok := s.users[userID]
+	if !ok {
+		return userRepository.ErrUserNotFound
+	}
+	u.Suspended = suspended
+	return nil
+}
+
+func (s *fakeUserService) SetUserExternal(userID int, external bool) error {
+	u, ok := s.users[userID]
+	if !ok {
+		return userRepository.ErrUserNotFound
+	}
+	u.External = external
+	return nil
+}
+
+func (s *fakeUserService) SetUserRole(userID int, role string) error {
+	u, ok := s.users[userID]
+	if !ok {
+		return userRepository.ErrUserNotFound
+	}
+	u.Role = role
+	return nil
+}
+
+func (s *fakeUserService) DeleteUser(userID int) error {
+	if _, ok := s.users[userID]; !ok {
+		return userRepository.ErrUserNotFound
+	}
+	delete(s.users, userID)
+	return nil
+}
+
+type fakeConnections struct {
+	online       map[int]bool
+	disconnected []int
+}
+
+func (c *fakeConnections) DisconnectUser(userID int) bool {
+	if !c.online[userID] {
+		return false
+	}
+	delete(c.online, userID)
+	c.disconnected = append(c.disconnected, userID)
+	return true
+}
+
+func (c *fakeConnections) ConnectedUserCount() int {
+	return len(c.online)
+}
+
+type fakeStatsRepo struct{}
+
+func (r *fakeStatsRepo) GetStats() (*models.SystemStats, error) {
+	return &models.SystemStats{TotalUsers: 3, TotalMessages: 10}, nil
+}
+
+func TestSuspendUser(t *testing.T) {
+	users := newFakeUserService(1, 2)
+	connections := &fakeConnections{online: map[int]bool{2: true}}
+	adminService := NewAdminService(&fakeStatsRepo{}, users, connections)
+
+	tests := []struct {
+		name        string
+		adminID     int
+		userID      int
+		suspended   bool
+		expectedErr error
+	}{
+		{name: "Suspend user", adminID: 1, userID: 2, suspended: true},
+		{name: "Reinstate user", adminID: 1, userID: 2, suspended: false},
+		{name: "Suspend self", adminID: 1, userID: 1, suspended: true, expectedErr: ErrSelfAction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := adminService.SuspendUser(tt.adminID, tt.userID, tt.suspended)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.suspended, users.users[tt.userID].Suspended)
+		})
+	}
+
+	assert.Equal(t, []int{2}, connections.disconnected)
+
+	err := adminService.SuspendUser(1, 99, true)
+	assert.ErrorIs(t, err, userRepository.ErrUserNotFound)
+}
+
+func TestDeleteUser(t *testing.T) {
+	users := newFakeUserService(1, 2)
+	connections := &fakeConnections{online: map[int]bool{2: true}}
+	adminService := NewAdminService(&fakeStatsRepo{}, users, connections)
+
+	assert.ErrorIs(t, adminService.DeleteUser(1, 1), ErrSelfAction)
+
+	require.NoError(t, adminService.DeleteUser(1, 2))
+	assert.NotContains(t, users.users, 2)
+	assert.Equal(t, []int{2}, connections.disconnected)
+}
+
+func TestSetUserRole(t *testing.T) {
+	users := newFakeUserService(1, 2)
+	adminService := NewAdminService(&fakeStatsRepo{}, users, nil)
+
+	require.NoError(t, adminService.SetUserRole(1, 2, authModels.RoleModerator))
+	assert.Equal(t, string(authModels.RoleModerator), users.users[2].Role)
+
+	assert.ErrorIs(t, adminService.SetUserRole(1, 2, "superuser"), ErrInvalidRole)
+	assert.ErrorIs(t, adminService.SetUserRole(1, 1, authModels.RoleUser), ErrSelfAction)
+}
+
+func TestGetStats(t *testing.T) {
+	connections := &fakeConnections{online: map[int]bool{1: true, 2: true}}
+	adminService := NewAdminService(&fakeStatsRepo{}, newFakeUserService(1, 2), connections)
+
+	stats, err := adminService.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.TotalUsers)
+	assert.Equal(t, 10, stats.TotalMessages)
+	assert.Equal(t, 2, stats.ConnectedUsers)
+}
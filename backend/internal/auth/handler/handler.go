@@ -3,6 +3,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/Mousa96/chatting-service/internal/auth/models"
@@ -63,6 +64,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} models.AuthResponse "Login successful"
 // @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Invalid credentials"
+// @Failure 403 {string} string "Account suspended"
 // @Failure 500 {string} string "Internal server error"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -73,6 +75,10 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp, err := h.authService.Login(&req)
+	if errors.Is(err, service.ErrAccountSuspended) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -0,0 +1,64 @@
+package models
+
+// Role identifies the set of permissions granted to a user
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission names a single privileged action that can be required by middleware
+type Permission string
+
+const (
+	PermissionBroadcastMessages Permission = "messages:broadcast"
+	PermissionManageUsers       Permission = "users:manage"
+	PermissionViewStats         Permission = "stats:view"
+	PermissionModerate          Permission = "reports:moderate"
+)
+
+// rolePermissions maps each role to the permissions it grants. Regular users send
+// direct messages only; broadcasting to arbitrary users is reserved for staff.
+var rolePermissions = map[Role][]Permission{
+	RoleUser: {},
+	RoleModerator: {
+		PermissionBroadcastMessages,
+		PermissionModerate,
+	},
+	RoleAdmin: {
+		PermissionBroadcastMessages,
+		PermissionManageUsers,
+		PermissionViewStats,
+		PermissionModerate,
+	},
+}
+
+// IsValid checks if the role is one of the known roles
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Permissions returns the permissions granted to the role.
+// Unknown roles fall back to the permissions of a regular user.
+func (r Role) Permissions() []Permission {
+	perms, ok := rolePermissions[r]
+	if !ok {
+		perms = rolePermissions[RoleUser]
+	}
+	result := make([]Permission, len(perms))
+	copy(result, perms)
+	return result
+}
+
+// HasPermission checks if the role grants the given permission
+func (r Role) HasPermission(permission Permission) bool {
+	for _, p := range r.Permissions() {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -5,11 +5,18 @@ import "time"
 type Username string
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Role         Role       `json:"role"`
+	SuspendedAt  *time.Time `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// IsSuspended reports whether the account has been suspended by an administrator
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
 }
 
 type CreateUserRequest struct {
@@ -18,20 +18,20 @@ func (r *SQLUserRepository) Create(user *models.User) error {
 	query := `
         INSERT INTO users (username, password_hash)
         VALUES ($1, $2)
-        RETURNING id, created_at, updated_at`
+        RETURNING id, role, created_at, updated_at`
 
 	return r.db.QueryRow(query, user.Username, user.PasswordHash).
-		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		Scan(&user.ID, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 }
 
 func (r *SQLUserRepository) GetByUsername(username string) (*models.User, error) {
 	user := &models.User{}
 	query := `
-        SELECT id, username, password_hash, created_at, updated_at
+        SELECT id, username, password_hash, role, suspended_at, created_at, updated_at
         FROM users WHERE username = $1`
 
 	err := r.db.QueryRow(query, username).
-		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.SuspendedAt, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
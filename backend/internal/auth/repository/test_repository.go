@@ -33,6 +33,9 @@ func (r *TestUserRepository) Create(user *models.User) error {
 	}
 
 	user.ID = r.nextID
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 	r.users[username] = user
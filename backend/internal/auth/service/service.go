@@ -11,6 +11,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrAccountSuspended is returned when a suspended user tries to log in
+var ErrAccountSuspended = errors.New("account suspended")
+
 // AuthService provides the implementation of the Service interface
 type AuthService struct {
 	userRepo repository.Repository
@@ -61,6 +64,10 @@ func (s *AuthService) Login(req *models.LoginRequest) (*models.AuthResponse, err
 		return nil, errors.New("invalid credentials")
 	}
 
+	if user.IsSuspended() {
+		return nil, ErrAccountSuspended
+	}
+
 	token, err := s.generateToken(user)
 	if err != nil {
 		return nil, err
@@ -73,10 +80,17 @@ func (s *AuthService) Login(req *models.LoginRequest) (*models.AuthResponse, err
 }
 
 func (s *AuthService) generateToken(user *models.User) (string, error) {
+	role := user.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
+		"user_id":     user.ID,
+		"username":    user.Username,
+		"role":        role,
+		"permissions": role.Permissions(),
+		"exp":         time.Now().Add(time.Hour * 24).Unix(),
 	})
 
 	return token.SignedString(s.jwtKey)
@@ -2,6 +2,7 @@ package service
 
 import (
 	"testing"
+	"time"
 
 	"github.com/Mousa96/chatting-service/internal/auth/models"
 	"github.com/Mousa96/chatting-service/internal/auth/repository"
@@ -117,3 +118,28 @@ func TestLogin(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginSuspendedUser(t *testing.T) {
+	repo := repository.NewTestUserRepository()
+	authService := NewAuthService(repo, []byte("test-key"))
+
+	_, err := authService.Register(&models.CreateUserRequest{
+		Username: "suspended",
+		Password: "testpass123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to register test user: %v", err)
+	}
+
+	user, err := repo.GetByUsername("suspended")
+	assert.NoError(t, err)
+	suspendedAt := time.Now()
+	user.SuspendedAt = &suspendedAt
+
+	response, err := authService.Login(&models.LoginRequest{
+		Username: "suspended",
+		Password: "testpass123",
+	})
+	assert.ErrorIs(t, err, ErrAccountSuspended)
+	assert.Nil(t, response)
+}
@@ -0,0 +1,366 @@
+// Package config loads runtime settings from environment variables
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings read at startup
+type Config struct {
+	Filters      FilterConfig
+	Media        MediaConfig
+	Uploads      UploadConfig
+	Storage      StorageConfig
+	LinkPreviews LinkPreviewConfig
+	Scheduler    SchedulerConfig
+	Retention    RetentionConfig
+}
+
+// FilterConfig configures the content filters applied to outgoing messages
+type FilterConfig struct {
+	// BannedWords is matched as whole words, ignoring case (BANNED_WORDS, comma separated)
+	BannedWords []string
+	// BannedWordAction is redact, reject or flag (BANNED_WORD_ACTION)
+	BannedWordAction string
+	// BlockedLinkDomains rejects links to these domains and their subdomains (BLOCKED_LINK_DOMAINS)
+	BlockedLinkDomains []string
+	// MaxMessageLength is the longest message allowed, in characters (MAX_MESSAGE_LENGTH)
+	MaxMessageLength int
+	// RepeatLimit is how many identical messages a user may send per RepeatWindow (REPEAT_MESSAGE_LIMIT)
+	RepeatLimit int
+	// RepeatWindow is the period over which repeats are counted (REPEAT_MESSAGE_WINDOW, e.g. "1m")
+	RepeatWindow time.Duration
+}
+
+// MediaConfig configures access to uploaded media
+type MediaConfig struct {
+	// SigningKey authenticates signed media URLs (MEDIA_SIGNING_KEY); empty means use the JWT key
+	SigningKey string
+	// URLTTL is how long signed media URLs stay valid (MEDIA_URL_TTL, e.g. "15m")
+	URLTTL time.Duration
+	// ThumbnailSizes are the longer sides of generated thumbnails in pixels (THUMBNAIL_SIZES, comma separated)
+	ThumbnailSizes []int
+	// FFmpegPath locates ffmpeg for video poster frames (FFMPEG_PATH); "off" disables them
+	FFmpegPath string
+	// SanitizeImages re-encodes uploaded images to strip metadata (SANITIZE_IMAGES, default true)
+	SanitizeImages bool
+	// MaxImageDimension bounds the longer side of sanitized images in pixels (MAX_IMAGE_DIMENSION)
+	MaxImageDimension int
+	// JPEGQuality is used when re-encoding JPEG uploads (IMAGE_JPEG_QUALITY, 1-100)
+	JPEGQuality int
+	// GCInterval is how often orphaned media is collected (MEDIA_GC_INTERVAL, e.g. "1h")
+	GCInterval time.Duration
+	// GCGracePeriod is how long a file must have been unreferenced before it is
+	// collected (MEDIA_GC_GRACE_PERIOD, e.g. "24h")
+	GCGracePeriod time.Duration
+	// GCDryRun only logs what scheduled collections would remove (MEDIA_GC_DRY_RUN)
+	GCDryRun bool
+	// ClamdAddress is the host:port of the ClamAV daemon uploads are scanned with
+	// (CLAMD_ADDRESS); empty disables scanning
+	ClamdAddress string
+	// ClamdTimeout bounds each exchange with clamd (CLAMD_TIMEOUT, e.g. "30s")
+	ClamdTimeout time.Duration
+	// SuspiciousSignatures are the signature prefixes quarantined for review instead of
+	// refused (CLAMD_SUSPICIOUS_PREFIXES, comma separated)
+	SuspiciousSignatures []string
+	// AttachmentTypes maps the content types that may be uploaded to the largest size
+	// allowed for them in bytes, 0 leaving them to the upload limit (ATTACHMENT_TYPES,
+	// comma separated "type" or "type=bytes" entries; "audio/*" covers a whole family)
+	AttachmentTypes map[string]int64
+}
+
+// UploadConfig configures resumable uploads
+type UploadConfig struct {
+	// MaxSize is the largest file accepted through resumable uploads, in bytes (UPLOAD_MAX_SIZE)
+	MaxSize int64
+	// Expiry is how long an unfinished upload is kept after its last chunk (UPLOAD_EXPIRY, e.g. "24h")
+	Expiry time.Duration
+	// PurgeInterval is how often expired uploads are removed (UPLOAD_PURGE_INTERVAL)
+	PurgeInterval time.Duration
+	// DirectURLTTL is how long presigned direct upload URLs stay valid (DIRECT_UPLOAD_URL_TTL)
+	DirectURLTTL time.Duration
+	// DirectTypes are the content types clients may upload straight to S3 (DIRECT_UPLOAD_TYPES, comma separated)
+	DirectTypes []string
+}
+
+// LinkPreviewConfig configures the preview cards fetched for links in messages
+type LinkPreviewConfig struct {
+	// Enabled turns link previews on (LINK_PREVIEWS, default true)
+	Enabled bool
+	// Interval is how often queued previews are looked for (LINK_PREVIEW_INTERVAL, e.g. "1s")
+	Interval time.Duration
+	// Timeout bounds each page fetch, redirects included (LINK_PREVIEW_TIMEOUT)
+	Timeout time.Duration
+	// MaxBytes is how much of a page is read looking for its metadata (LINK_PREVIEW_MAX_BYTES)
+	MaxBytes int64
+	// CacheTTL is how long a fetched preview is reused (LINK_PREVIEW_CACHE_TTL, e.g. "24h")
+	CacheTTL time.Duration
+	// AllowPrivate lets links to loopback and private addresses be fetched, for local
+	// development only (LINK_PREVIEW_ALLOW_PRIVATE)
+	AllowPrivate bool
+}
+
+// SchedulerConfig configures the sending of scheduled messages
+type SchedulerConfig struct {
+	// Interval is how often due messages are looked for (SCHEDULER_INTERVAL, e.g. "1s")
+	Interval time.Duration
+}
+
+// RetentionConfig configures how long messages are kept
+type RetentionConfig struct {
+	// MaxAge deletes every message once it is this old; zero keeps messages until their
+	// conversation's timer expires them (MESSAGE_RETENTION, e.g. "8760h")
+	MaxAge time.Duration
+	// ExternalMaxAge deletes messages sent or received by external users once they are this
+	// old (EXTERNAL_MESSAGE_RETENTION, default "720h")
+	ExternalMaxAge time.Duration
+	// Interval is how often expired messages are looked for (MESSAGE_REAPER_INTERVAL, e.g. "1m")
+	Interval time.Duration
+}
+
+// StorageConfig selects where uploaded files are kept
+type StorageConfig struct {
+	// Backend is local or s3 (STORAGE_BACKEND)
+	Backend string
+	// LocalPath is the directory the local backend writes to (STORAGE_LOCAL_PATH)
+	LocalPath string
+	// S3Bucket is the bucket the s3 backend writes to (S3_BUCKET)
+	S3Bucket string
+	// S3Region is the bucket's region (S3_REGION, falling back to AWS_REGION)
+	S3Region string
+	// S3Endpoint points at an S3-compatible service such as MinIO instead of AWS (S3_ENDPOINT)
+	S3Endpoint string
+	// S3PathStyle addresses the bucket as a path, which most S3-compatible services need (S3_PATH_STYLE)
+	S3PathStyle bool
+	// S3AccessKeyID and S3SecretAccessKey authenticate with S3 (S3_ACCESS_KEY_ID and
+	// S3_SECRET_ACCESS_KEY, falling back to AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	// S3SessionToken is set for temporary credentials (AWS_SESSION_TOKEN)
+	S3SessionToken string
+	// S3PartSize is the size of multipart upload parts in bytes (S3_PART_SIZE)
+	S3PartSize int64
+	// DefaultQuota is how many bytes each user may store unless an administrator sets
+	// their own quota (STORAGE_QUOTA_DEFAULT); 0 means no limit
+	DefaultQuota int64
+	// GlobalQuota is how many bytes all users together may store (STORAGE_QUOTA_GLOBAL); 0 means no limit
+	GlobalQuota int64
+}
+
+// Load reads the configuration from the environment, falling back to defaults
+func Load() *Config {
+	return &Config{
+		Filters: FilterConfig{
+			BannedWords:        getList("BANNED_WORDS"),
+			BannedWordAction:   getChoice("BANNED_WORD_ACTION", "redact", "reject", "flag"),
+			BlockedLinkDomains: getList("BLOCKED_LINK_DOMAINS"),
+			MaxMessageLength:   getInt("MAX_MESSAGE_LENGTH", 4000),
+			RepeatLimit:        getInt("REPEAT_MESSAGE_LIMIT", 3),
+			RepeatWindow:       getDuration("REPEAT_MESSAGE_WINDOW", time.Minute),
+		},
+		Media: MediaConfig{
+			SigningKey:        os.Getenv("MEDIA_SIGNING_KEY"),
+			URLTTL:            getDuration("MEDIA_URL_TTL", 15*time.Minute),
+			ThumbnailSizes:    getIntList("THUMBNAIL_SIZES", []int{160, 320, 640}),
+			FFmpegPath:        getString("FFMPEG_PATH", "ffmpeg"),
+			SanitizeImages:    getBool("SANITIZE_IMAGES", true),
+			MaxImageDimension: getInt("MAX_IMAGE_DIMENSION", 4096),
+			JPEGQuality:       getIntInRange("IMAGE_JPEG_QUALITY", 90, 1, 100),
+			GCInterval:        getDuration("MEDIA_GC_INTERVAL", time.Hour),
+			GCGracePeriod:     getDuration("MEDIA_GC_GRACE_PERIOD", 24*time.Hour),
+			GCDryRun:          getBool("MEDIA_GC_DRY_RUN", false),
+			ClamdAddress:      os.Getenv("CLAMD_ADDRESS"),
+			ClamdTimeout:      getDuration("CLAMD_TIMEOUT", 30*time.Second),
+			SuspiciousSignatures: getListOr("CLAMD_SUSPICIOUS_PREFIXES",
+				[]string{"Heuristics.", "PUA."}),
+			AttachmentTypes: getSizeMap("ATTACHMENT_TYPES", map[string]int64{
+				"image/jpeg":      20 << 20,
+				"image/png":       20 << 20,
+				"image/gif":       20 << 20,
+				"image/webp":      20 << 20,
+				"video/mp4":       0,
+				"video/webm":      0,
+				"audio/ogg":       50 << 20,
+				"audio/webm":      50 << 20,
+				"audio/mpeg":      50 << 20,
+				"application/pdf": 50 << 20,
+				"application/zip": 100 << 20,
+				"text/plain":      10 << 20,
+			}),
+		},
+		Uploads: UploadConfig{
+			MaxSize:       int64(getInt("UPLOAD_MAX_SIZE", 512<<20)),
+			Expiry:        getDuration("UPLOAD_EXPIRY", 24*time.Hour),
+			PurgeInterval: getDuration("UPLOAD_PURGE_INTERVAL", 10*time.Minute),
+			DirectURLTTL:  getDuration("DIRECT_UPLOAD_URL_TTL", 15*time.Minute),
+			DirectTypes:   getListOr("DIRECT_UPLOAD_TYPES", []string{"video/mp4"}),
+		},
+		Storage: StorageConfig{
+			Backend:           getChoice("STORAGE_BACKEND", "local", "s3"),
+			LocalPath:         getString("STORAGE_LOCAL_PATH", "/app/uploads"),
+			S3Bucket:          os.Getenv("S3_BUCKET"),
+			S3Region:          getString("S3_REGION", getString("AWS_REGION", "us-east-1")),
+			S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+			S3PathStyle:       getBool("S3_PATH_STYLE", false),
+			S3AccessKeyID:     getString("S3_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID")),
+			S3SecretAccessKey: getString("S3_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+			S3SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			S3PartSize:        int64(getInt("S3_PART_SIZE", 8<<20)),
+			DefaultQuota:      int64(getInt("STORAGE_QUOTA_DEFAULT", 0)),
+			GlobalQuota:       int64(getInt("STORAGE_QUOTA_GLOBAL", 0)),
+		},
+		LinkPreviews: LinkPreviewConfig{
+			Enabled:      getBool("LINK_PREVIEWS", true),
+			Interval:     getDuration("LINK_PREVIEW_INTERVAL", time.Second),
+			Timeout:      getDuration("LINK_PREVIEW_TIMEOUT", 5*time.Second),
+			MaxBytes:     int64(getInt("LINK_PREVIEW_MAX_BYTES", 512<<10)),
+			CacheTTL:     getDuration("LINK_PREVIEW_CACHE_TTL", 24*time.Hour),
+			AllowPrivate: getBool("LINK_PREVIEW_ALLOW_PRIVATE", false),
+		},
+		Scheduler: SchedulerConfig{
+			Interval: getDuration("SCHEDULER_INTERVAL", time.Second),
+		},
+		Retention: RetentionConfig{
+			MaxAge:         getDuration("MESSAGE_RETENTION", 0),
+			ExternalMaxAge: getDuration("EXTERNAL_MESSAGE_RETENTION", 30*24*time.Hour),
+			Interval:       getDuration("MESSAGE_REAPER_INTERVAL", time.Minute),
+		},
+	}
+}
+
+// getChoice returns the variable if it is one of the allowed values, otherwise fallback
+func getChoice(key, fallback string, allowed ...string) string {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	if raw == "" || raw == fallback {
+		return fallback
+	}
+	for _, value := range allowed {
+		if raw == value {
+			return value
+		}
+	}
+	log.Printf("Ignoring invalid %s=%q, using %s", key, raw, fallback)
+	return fallback
+}
+
+// getList splits a comma separated variable, dropping empty entries
+func getList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getListOr is getList with a default for when the variable is unset or empty
+func getListOr(key string, fallback []string) []string {
+	if values := getList(key); len(values) > 0 {
+		return values
+	}
+	return fallback
+}
+
+// getSizeMap parses a comma separated list of "name" or "name=bytes" entries, where a
+// missing size is 0
+func getSizeMap(key string, fallback map[string]int64) map[string]int64 {
+	raw := getList(key)
+	if len(raw) == 0 {
+		return fallback
+	}
+	values := make(map[string]int64, len(raw))
+	for _, item := range raw {
+		name, size, hasSize := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		var value int64
+		if hasSize {
+			parsed, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+			if err != nil || parsed < 0 {
+				log.Printf("Ignoring invalid %s=%q, using the defaults", key, os.Getenv(key))
+				return fallback
+			}
+			value = parsed
+		}
+		values[name] = value
+	}
+	return values
+}
+
+func getString(key, fallback string) string {
+	if raw := strings.TrimSpace(os.Getenv(key)); raw != "" {
+		return raw
+	}
+	return fallback
+}
+
+// getIntList parses a comma separated list of positive integers
+func getIntList(key string, fallback []int) []int {
+	raw := getList(key)
+	if len(raw) == 0 {
+		return fallback
+	}
+	values := make([]int, 0, len(raw))
+	for _, item := range raw {
+		value, err := strconv.Atoi(item)
+		if err != nil || value <= 0 {
+			log.Printf("Ignoring invalid %s=%q, using %v", key, os.Getenv(key), fallback)
+			return fallback
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func getBool(key string, fallback bool) bool {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q, using %t", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+// getIntInRange reads an integer that must lie between min and max inclusive
+func getIntInRange(key string, fallback, min, max int) int {
+	value := getInt(key, fallback)
+	if value < min || value > max {
+		log.Printf("Ignoring invalid %s=%d, using %d", key, value, fallback)
+		return fallback
+	}
+	return value
+}
+
+func getInt(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %d", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %s", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
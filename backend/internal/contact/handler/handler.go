@@ -0,0 +1,457 @@
+// Package handler implements the HTTP handlers for contact operations
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Mousa96/chatting-service/internal/contact/models"
+	"github.com/Mousa96/chatting-service/internal/contact/service"
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+)
+
+// ContactHandler provides the implementation of the Handler interface
+type ContactHandler struct {
+	contactService service.Service
+}
+
+// NewContactHandler creates a new ContactHandler instance
+func NewContactHandler(contactService service.Service) Handler {
+	return &ContactHandler{contactService: contactService}
+}
+
+// ListContacts godoc
+// @Summary List contacts
+// @Description Retrieve the current user's contacts ordered by username
+// @Tags contacts
+// @Produce json
+// @Success 200 {object} map[string][]models.Contact "Contacts"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts [get]
+func (h *ContactHandler) ListContacts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	contacts, err := h.contactService.ListContacts(userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"contacts": contacts,
+	})
+}
+
+// RemoveContact godoc
+// @Summary Remove a contact
+// @Description Remove a user from the current user's contacts. The removal applies to both users.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.RemoveContactRequest true "Contact to remove"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Not a contact"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts/remove [post]
+func (h *ContactHandler) RemoveContact(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.RemoveContactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.contactService.RemoveContact(userID, req.UserID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
+
+// ListRequests godoc
+// @Summary List contact requests
+// @Description Retrieve the open contact requests received and sent by the current user
+// @Tags contacts
+// @Produce json
+// @Success 200 {object} models.RequestList "Open requests"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts/requests [get]
+func (h *ContactHandler) ListRequests(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	requests, err := h.contactService.ListRequests(userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, requests)
+}
+
+// SendRequest godoc
+// @Summary Send a contact request
+// @Description Ask another user to become a contact. If that user already sent a request to the current user, it is accepted instead.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.SendRequestRequest true "User to add"
+// @Success 201 {object} models.ContactRequest "Created or accepted request"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "One of the users has blocked the other"
+// @Failure 404 {string} string "User not found"
+// @Failure 409 {string} string "Already contacts or request pending"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts/requests [post]
+func (h *ContactHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SendRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	request, err := h.contactService.SendRequest(userID, req.UserID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, request)
+}
+
+// AcceptRequest godoc
+// @Summary Accept a contact request
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.RequestActionRequest true "Request to accept"
+// @Success 200 {object} models.ContactRequest "Accepted request"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Request not found"
+// @Failure 409 {string} string "Request no longer pending"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts/requests/accept [post]
+func (h *ContactHandler) AcceptRequest(w http.ResponseWriter, r *http.Request) {
+	h.handleRequestAction(w, r, h.contactService.AcceptRequest)
+}
+
+// DeclineRequest godoc
+// @Summary Decline a contact request
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.RequestActionRequest true "Request to decline"
+// @Success 200 {object} models.ContactRequest "Declined request"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Request not found"
+// @Failure 409 {string} string "Request no longer pending"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts/requests/decline [post]
+func (h *ContactHandler) DeclineRequest(w http.ResponseWriter, r *http.Request) {
+	h.handleRequestAction(w, r, h.contactService.DeclineRequest)
+}
+
+// CancelRequest godoc
+// @Summary Cancel a contact request
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.RequestActionRequest true "Request to cancel"
+// @Success 200 {object} models.ContactRequest "Cancelled request"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Request not found"
+// @Failure 409 {string} string "Request no longer pending"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts/requests/cancel [post]
+func (h *ContactHandler) CancelRequest(w http.ResponseWriter, r *http.Request) {
+	h.handleRequestAction(w, r, h.contactService.CancelRequest)
+}
+
+// GetPrivacySettings godoc
+// @Summary Get privacy settings
+// @Tags contacts
+// @Produce json
+// @Success 200 {object} models.PrivacySettings "Privacy settings"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts/settings [get]
+func (h *ContactHandler) GetPrivacySettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := h.contactService.GetPrivacySettings(userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// UpdatePrivacySettings godoc
+// @Summary Update privacy settings
+// @Description Set contacts_only to reject direct and broadcast messages from users who are not contacts
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param settings body models.PrivacySettings true "Privacy settings"
+// @Success 200 {object} models.PrivacySettings "Updated settings"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /contacts/settings [put]
+func (h *ContactHandler) UpdatePrivacySettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var settings models.PrivacySettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.contactService.UpdatePrivacySettings(userID, &settings)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// ListBlocked godoc
+// @Summary List blocked users
+// @Tags contacts
+// @Produce json
+// @Success 200 {object} map[string][]models.UserEntry "Blocked users"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /blocks [get]
+func (h *ContactHandler) ListBlocked(w http.ResponseWriter, r *http.Request) {
+	h.handleUserList(w, r, "users", h.contactService.ListBlocked)
+}
+
+// BlockUser godoc
+// @Summary Block a user
+// @Description Refuse messages to and from a user, hide your presence from them, and remove them from your contacts. Past messages from them are hidden from your history.
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.UserActionRequest true "User to block"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "User not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /blocks [post]
+func (h *ContactHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, "blocked", h.contactService.BlockUser)
+}
+
+// UnblockUser godoc
+// @Summary Unblock a user
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.UserActionRequest true "User to unblock"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "User is not blocked"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /blocks/remove [post]
+func (h *ContactHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, "unblocked", h.contactService.UnblockUser)
+}
+
+// ListMuted godoc
+// @Summary List muted users
+// @Tags contacts
+// @Produce json
+// @Success 200 {object} map[string][]models.UserEntry "Muted users"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /mutes [get]
+func (h *ContactHandler) ListMuted(w http.ResponseWriter, r *http.Request) {
+	h.handleUserList(w, r, "users", h.contactService.ListMuted)
+}
+
+// MuteUser godoc
+// @Summary Mute a conversation
+// @Description Messages from the user are still delivered, but WebSocket messages carry "muted": true so clients don't notify
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.UserActionRequest true "User to mute"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "User not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /mutes [post]
+func (h *ContactHandler) MuteUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, "muted", h.contactService.MuteUser)
+}
+
+// UnmuteUser godoc
+// @Summary Unmute a conversation
+// @Tags contacts
+// @Accept json
+// @Produce json
+// @Param request body models.UserActionRequest true "User to unmute"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "User is not muted"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /mutes/remove [post]
+func (h *ContactHandler) UnmuteUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, "unmuted", h.contactService.UnmuteUser)
+}
+
+// handleUserList writes the list returned by list for the current user under key
+func (h *ContactHandler) handleUserList(w http.ResponseWriter, r *http.Request, key string, list func(userID int) ([]models.UserEntry, error)) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	users, err := list(userID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		key: users,
+	})
+}
+
+// handleUserAction decodes a target user ID and applies action to it on behalf of the current user
+func (h *ContactHandler) handleUserAction(w http.ResponseWriter, r *http.Request, status string, action func(userID, targetID int) error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UserActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := action(userID, req.UserID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+// handleRequestAction decodes a request ID and applies action to it on behalf of the current user
+func (h *ContactHandler) handleRequestAction(w http.ResponseWriter, r *http.Request, action func(userID, requestID int) (*models.ContactRequest, error)) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.RequestActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RequestID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	request, err := action(userID, req.RequestID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, request)
+}
+
+// writeServiceError maps contact service errors to HTTP status codes
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSelfRequest), errors.Is(err, service.ErrSelfTarget):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, msgService.ErrNotPermitted):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrRequestNotFound),
+		errors.Is(err, service.ErrNotContacts),
+		errors.Is(err, service.ErrNotBlocked),
+		errors.Is(err, service.ErrNotMuted):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrAlreadyContacts),
+		errors.Is(err, service.ErrRequestExists),
+		errors.Is(err, service.ErrRequestClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Contact operation failed: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON sends a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
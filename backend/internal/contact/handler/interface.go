@@ -0,0 +1,38 @@
+// Package handler provides HTTP handlers for contact operations
+package handler
+
+import "net/http"
+
+// Handler defines the contact handling interface
+type Handler interface {
+	// ListContacts returns the current user's contacts
+	ListContacts(w http.ResponseWriter, r *http.Request)
+	// RemoveContact removes a user from the current user's contacts
+	RemoveContact(w http.ResponseWriter, r *http.Request)
+	// ListRequests returns the current user's open contact requests
+	ListRequests(w http.ResponseWriter, r *http.Request)
+	// SendRequest sends a contact request
+	SendRequest(w http.ResponseWriter, r *http.Request)
+	// AcceptRequest accepts a received contact request
+	AcceptRequest(w http.ResponseWriter, r *http.Request)
+	// DeclineRequest declines a received contact request
+	DeclineRequest(w http.ResponseWriter, r *http.Request)
+	// CancelRequest withdraws a sent contact request
+	CancelRequest(w http.ResponseWriter, r *http.Request)
+	// GetPrivacySettings returns the current user's privacy settings
+	GetPrivacySettings(w http.ResponseWriter, r *http.Request)
+	// UpdatePrivacySettings replaces the current user's privacy settings
+	UpdatePrivacySettings(w http.ResponseWriter, r *http.Request)
+	// ListBlocked returns the users blocked by the current user
+	ListBlocked(w http.ResponseWriter, r *http.Request)
+	// BlockUser blocks a user
+	BlockUser(w http.ResponseWriter, r *http.Request)
+	// UnblockUser removes a block
+	UnblockUser(w http.ResponseWriter, r *http.Request)
+	// ListMuted returns the users muted by the current user
+	ListMuted(w http.ResponseWriter, r *http.Request)
+	// MuteUser mutes the conversation with a user
+	MuteUser(w http.ResponseWriter, r *http.Request)
+	// UnmuteUser removes a mute
+	UnmuteUser(w http.ResponseWriter, r *http.Request)
+}
@@ -0,0 +1,74 @@
+// Package models defines the data structures for contacts and contact requests
+package models
+
+import "time"
+
+// RequestStatus represents the state of a contact request
+type RequestStatus string
+
+const (
+	RequestPending   RequestStatus = "pending"
+	RequestAccepted  RequestStatus = "accepted"
+	RequestDeclined  RequestStatus = "declined"
+	RequestCancelled RequestStatus = "cancelled"
+)
+
+// ContactRequest is an invitation from one user to become contacts with another
+type ContactRequest struct {
+	ID          int           `json:"id"`
+	SenderID    int           `json:"sender_id"`
+	ReceiverID  int           `json:"receiver_id"`
+	Status      RequestStatus `json:"status"`
+	CreatedAt   time.Time     `json:"created_at"`
+	RespondedAt *time.Time    `json:"responded_at,omitempty"`
+}
+
+// Contact is a user in another user's contact list
+type Contact struct {
+	UserID      int       `json:"user_id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name,omitempty"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	Since       time.Time `json:"since"`
+}
+
+// UserEntry is a user on another user's block or mute list
+type UserEntry struct {
+	UserID      int       `json:"user_id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name,omitempty"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	Since       time.Time `json:"since"`
+}
+
+// RequestList holds a user's open contact requests
+type RequestList struct {
+	Incoming []ContactRequest `json:"incoming"`
+	Outgoing []ContactRequest `json:"outgoing"`
+}
+
+// PrivacySettings controls who may message a user
+type PrivacySettings struct {
+	// ContactsOnly rejects direct and broadcast messages from users who are not contacts
+	ContactsOnly bool `json:"contacts_only"`
+}
+
+// SendRequestRequest represents the request body for sending a contact request
+type SendRequestRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// RequestActionRequest represents the request body for accepting, declining or cancelling a request
+type RequestActionRequest struct {
+	RequestID int `json:"request_id"`
+}
+
+// RemoveContactRequest represents the request body for removing a contact
+type RemoveContactRequest struct {
+	UserID int `json:"user_id"`
+}
+
+// UserActionRequest represents the request body for blocking, unblocking, muting or unmuting a user
+type UserActionRequest struct {
+	UserID int `json:"user_id"`
+}
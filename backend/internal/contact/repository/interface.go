@@ -0,0 +1,66 @@
+// Package repository provides data access for contacts and contact requests
+package repository
+
+import (
+	"errors"
+
+	"github.com/Mousa96/chatting-service/internal/contact/models"
+)
+
+var (
+	// ErrNotFound is returned when a request or user does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a request is no longer pending or a pending request already exists
+	ErrConflict = errors.New("conflict")
+)
+
+// Repository defines the contact data access interface
+type Repository interface {
+	// UserExists reports whether a user with the given ID exists
+	UserExists(userID int) (bool, error)
+	// CreateRequest stores a new pending request from senderID to receiverID
+	CreateRequest(senderID, receiverID int) (*models.ContactRequest, error)
+	// GetRequest retrieves a request by its ID
+	GetRequest(requestID int) (*models.ContactRequest, error)
+	// GetPendingRequest returns the open request sent by senderID to receiverID, if any
+	GetPendingRequest(senderID, receiverID int) (*models.ContactRequest, error)
+	// ListPendingRequests returns the open requests received and sent by a user
+	ListPendingRequests(userID int) (*models.RequestList, error)
+	// AcceptRequest marks a pending request accepted and adds both users as contacts
+	AcceptRequest(requestID int) (*models.ContactRequest, error)
+	// CloseRequest marks a pending request declined or cancelled
+	CloseRequest(requestID int, status models.RequestStatus) (*models.ContactRequest, error)
+	// ListContacts returns a user's contacts ordered by username
+	ListContacts(userID int) ([]models.Contact, error)
+	// AreContacts reports whether two users are contacts
+	AreContacts(userID, otherID int) (bool, error)
+	// RemoveContact removes the contact relationship in both directions
+	RemoveContact(userID, contactID int) error
+	// GetPrivacySettings retrieves a user's privacy settings
+	GetPrivacySettings(userID int) (*models.PrivacySettings, error)
+	// UpdatePrivacySettings stores a user's privacy settings
+	UpdatePrivacySettings(userID int, settings *models.PrivacySettings) error
+
+	// BlockUser blocks blockedID for blockerID, ending any contact relationship
+	// and cancelling open requests between them
+	BlockUser(blockerID, blockedID int) error
+	// UnblockUser removes a block
+	UnblockUser(blockerID, blockedID int) error
+	// ListBlocked returns the users blocked by userID ordered by username
+	ListBlocked(userID int) ([]models.UserEntry, error)
+	// IsBlocked reports whether either user has blocked the other
+	IsBlocked(userID, otherID int) (bool, error)
+	// BlockedUserIDs returns the IDs of the users blocked by userID
+	BlockedUserIDs(userID int) ([]int, error)
+	// BlockerIDs returns the IDs of the users who have blocked userID
+	BlockerIDs(userID int) ([]int, error)
+
+	// MuteUser mutes the conversation with mutedID for userID
+	MuteUser(userID, mutedID int) error
+	// UnmuteUser removes a mute
+	UnmuteUser(userID, mutedID int) error
+	// ListMuted returns the users muted by userID ordered by username
+	ListMuted(userID int) ([]models.UserEntry, error)
+	// IsMuted reports whether userID has muted mutedID
+	IsMuted(userID, mutedID int) (bool, error)
+}
@@ -0,0 +1,399 @@
+// Package repository implements the contact repository interface
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Mousa96/chatting-service/internal/contact/models"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the PostgreSQL error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// requestColumns lists the columns read by scanRequest, in order
+const requestColumns = "id, sender_id, receiver_id, status, created_at, responded_at"
+
+// SQLContactRepository provides a PostgreSQL implementation of Repository
+type SQLContactRepository struct {
+	db *sql.DB
+}
+
+// NewContactRepository creates a new SQLContactRepository instance
+func NewContactRepository(db *sql.DB) Repository {
+	return &SQLContactRepository{db: db}
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRequest(row rowScanner) (*models.ContactRequest, error) {
+	var req models.ContactRequest
+	var respondedAt sql.NullTime
+	err := row.Scan(&req.ID, &req.SenderID, &req.ReceiverID, &req.Status, &req.CreatedAt, &respondedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if respondedAt.Valid {
+		req.RespondedAt = &respondedAt.Time
+	}
+	return &req, nil
+}
+
+func (r *SQLContactRepository) UserExists(userID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check user: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *SQLContactRepository) CreateRequest(senderID, receiverID int) (*models.ContactRequest, error) {
+	req, err := scanRequest(r.db.QueryRow(
+		"INSERT INTO contact_requests (sender_id, receiver_id) VALUES ($1, $2) RETURNING "+requestColumns,
+		senderID, receiverID,
+	))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create contact request: %w", err)
+	}
+	return req, nil
+}
+
+func (r *SQLContactRepository) GetRequest(requestID int) (*models.ContactRequest, error) {
+	return scanRequest(r.db.QueryRow("SELECT "+requestColumns+" FROM contact_requests WHERE id = $1", requestID))
+}
+
+func (r *SQLContactRepository) GetPendingRequest(senderID, receiverID int) (*models.ContactRequest, error) {
+	return scanRequest(r.db.QueryRow(
+		"SELECT "+requestColumns+" FROM contact_requests WHERE sender_id = $1 AND receiver_id = $2 AND status = 'pending'",
+		senderID, receiverID,
+	))
+}
+
+func (r *SQLContactRepository) ListPendingRequests(userID int) (*models.RequestList, error) {
+	rows, err := r.db.Query(
+		"SELECT "+requestColumns+` FROM contact_requests
+        WHERE (sender_id = $1 OR receiver_id = $1) AND status = 'pending'
+        ORDER BY created_at DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contact requests: %w", err)
+	}
+	defer rows.Close()
+
+	list := &models.RequestList{
+		Incoming: []models.ContactRequest{},
+		Outgoing: []models.ContactRequest{},
+	}
+	for rows.Next() {
+		req, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		if req.ReceiverID == userID {
+			list.Incoming = append(list.Incoming, *req)
+		} else {
+			list.Outgoing = append(list.Outgoing, *req)
+		}
+	}
+	return list, rows.Err()
+}
+
+func (r *SQLContactRepository) AcceptRequest(requestID int) (*models.ContactRequest, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	req, err := scanRequest(tx.QueryRow(
+		`UPDATE contact_requests SET status = 'accepted', responded_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND status = 'pending'
+        RETURNING `+requestColumns,
+		requestID,
+	))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept contact request: %w", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO contacts (user_id, contact_id) VALUES ($1, $2), ($2, $1)
+        ON CONFLICT DO NOTHING`,
+		req.SenderID, req.ReceiverID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add contacts: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return req, nil
+}
+
+func (r *SQLContactRepository) CloseRequest(requestID int, status models.RequestStatus) (*models.ContactRequest, error) {
+	req, err := scanRequest(r.db.QueryRow(
+		`UPDATE contact_requests SET status = $2, responded_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND status = 'pending'
+        RETURNING `+requestColumns,
+		requestID, status,
+	))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update contact request: %w", err)
+	}
+	return req, nil
+}
+
+func (r *SQLContactRepository) ListContacts(userID int) ([]models.Contact, error) {
+	rows, err := r.db.Query(
+		`SELECT u.id, u.username, COALESCE(u.display_name, ''), COALESCE(u.avatar_url, ''), c.created_at
+        FROM contacts c
+        JOIN users u ON u.id = c.contact_id
+        WHERE c.user_id = $1
+        ORDER BY lower(u.username), u.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contacts: %w", err)
+	}
+	defer rows.Close()
+
+	contacts := []models.Contact{}
+	for rows.Next() {
+		var c models.Contact
+		if err := rows.Scan(&c.UserID, &c.Username, &c.DisplayName, &c.AvatarURL, &c.Since); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts, rows.Err()
+}
+
+func (r *SQLContactRepository) AreContacts(userID, otherID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM contacts WHERE user_id = $1 AND contact_id = $2)",
+		userID, otherID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check contacts: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *SQLContactRepository) RemoveContact(userID, contactID int) error {
+	result, err := r.db.Exec(
+		`DELETE FROM contacts
+        WHERE (user_id = $1 AND contact_id = $2) OR (user_id = $2 AND contact_id = $1)`,
+		userID, contactID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove contact: %w", err)
+	}
+	return checkAffected(result)
+}
+
+func (r *SQLContactRepository) GetPrivacySettings(userID int) (*models.PrivacySettings, error) {
+	var settings models.PrivacySettings
+	err := r.db.QueryRow("SELECT contacts_only FROM users WHERE id = $1", userID).Scan(&settings.ContactsOnly)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get privacy settings: %w", err)
+	}
+	return &settings, nil
+}
+
+func (r *SQLContactRepository) UpdatePrivacySettings(userID int, settings *models.PrivacySettings) error {
+	result, err := r.db.Exec(
+		"UPDATE users SET contacts_only = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2",
+		settings.ContactsOnly, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+	return checkAffected(result)
+}
+
+func (r *SQLContactRepository) BlockUser(blockerID, blockedID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		blockerID, blockedID,
+	); err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		`DELETE FROM contacts
+        WHERE (user_id = $1 AND contact_id = $2) OR (user_id = $2 AND contact_id = $1)`,
+		blockerID, blockedID,
+	); err != nil {
+		return fmt.Errorf("failed to remove contact: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE contact_requests SET status = 'cancelled', responded_at = CURRENT_TIMESTAMP
+        WHERE status = 'pending'
+          AND ((sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1))`,
+		blockerID, blockedID,
+	); err != nil {
+		return fmt.Errorf("failed to cancel contact requests: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLContactRepository) UnblockUser(blockerID, blockedID int) error {
+	result, err := r.db.Exec("DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	return checkAffected(result)
+}
+
+func (r *SQLContactRepository) ListBlocked(userID int) ([]models.UserEntry, error) {
+	return r.listUsers("user_blocks", "blocker_id", "blocked_id", userID)
+}
+
+func (r *SQLContactRepository) IsBlocked(userID, otherID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM user_blocks
+        WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1))`,
+		userID, otherID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check blocks: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *SQLContactRepository) BlockedUserIDs(userID int) ([]int, error) {
+	return r.queryIDs("SELECT blocked_id FROM user_blocks WHERE blocker_id = $1", userID)
+}
+
+func (r *SQLContactRepository) BlockerIDs(userID int) ([]int, error) {
+	return r.queryIDs("SELECT blocker_id FROM user_blocks WHERE blocked_id = $1", userID)
+}
+
+func (r *SQLContactRepository) MuteUser(userID, mutedID int) error {
+	_, err := r.db.Exec(
+		"INSERT INTO user_mutes (user_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userID, mutedID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mute user: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLContactRepository) UnmuteUser(userID, mutedID int) error {
+	result, err := r.db.Exec("DELETE FROM user_mutes WHERE user_id = $1 AND muted_id = $2", userID, mutedID)
+	if err != nil {
+		return fmt.Errorf("failed to unmute user: %w", err)
+	}
+	return checkAffected(result)
+}
+
+func (r *SQLContactRepository) ListMuted(userID int) ([]models.UserEntry, error) {
+	return r.listUsers("user_mutes", "user_id", "muted_id", userID)
+}
+
+func (r *SQLContactRepository) IsMuted(userID, mutedID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM user_mutes WHERE user_id = $1 AND muted_id = $2)",
+		userID, mutedID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check mutes: %w", err)
+	}
+	return exists, nil
+}
+
+// listUsers returns the users referenced by targetColumn in rows of table owned by userID.
+// The table and column names are constants supplied by this package, never user input.
+func (r *SQLContactRepository) listUsers(table, ownerColumn, targetColumn string, userID int) ([]models.UserEntry, error) {
+	rows, err := r.db.Query(fmt.Sprintf(
+		`SELECT u.id, u.username, COALESCE(u.display_name, ''), COALESCE(u.avatar_url, ''), t.created_at
+        FROM %[1]s t
+        JOIN users u ON u.id = t.%[3]s
+        WHERE t.%[2]s = $1
+        ORDER BY lower(u.username), u.id`,
+		table, ownerColumn, targetColumn,
+	), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	entries := []models.UserEntry{}
+	for rows.Next() {
+		var e models.UserEntry
+		if err := rows.Scan(&e.UserID, &e.Username, &e.DisplayName, &e.AvatarURL, &e.Since); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// queryIDs runs a query returning a single integer column
+func (r *SQLContactRepository) queryIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user IDs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// checkAffected returns ErrNotFound when a statement matched no rows
+func checkAffected(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
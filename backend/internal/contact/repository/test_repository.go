@@ -0,0 +1,354 @@
+// Package repository provides test implementations of the Repository interface
+package repository
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/contact/models"
+)
+
+type contactPair struct {
+	userID, contactID int
+}
+
+// TestContactRepository provides an in-memory implementation of Repository for testing
+type TestContactRepository struct {
+	users    map[int]string
+	requests map[int]*models.ContactRequest
+	contacts map[contactPair]time.Time
+	privacy  map[int]models.PrivacySettings
+	blocks   map[contactPair]time.Time
+	mutes    map[contactPair]time.Time
+	mu       sync.RWMutex
+	nextID   int
+}
+
+// NewTestContactRepository creates a new instance of TestContactRepository
+func NewTestContactRepository() *TestContactRepository {
+	return &TestContactRepository{
+		users:    make(map[int]string),
+		requests: make(map[int]*models.ContactRequest),
+		contacts: make(map[contactPair]time.Time),
+		privacy:  make(map[int]models.PrivacySettings),
+		blocks:   make(map[contactPair]time.Time),
+		mutes:    make(map[contactPair]time.Time),
+		nextID:   1,
+	}
+}
+
+// AddUser registers a user so that requests to them can be created
+func (r *TestContactRepository) AddUser(userID int, username string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[userID] = username
+}
+
+func (r *TestContactRepository) UserExists(userID int) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.users[userID]
+	return ok, nil
+}
+
+func (r *TestContactRepository) CreateRequest(senderID, receiverID int) (*models.ContactRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, req := range r.requests {
+		if req.Status != models.RequestPending {
+			continue
+		}
+		if (req.SenderID == senderID && req.ReceiverID == receiverID) ||
+			(req.SenderID == receiverID && req.ReceiverID == senderID) {
+			return nil, ErrConflict
+		}
+	}
+
+	req := &models.ContactRequest{
+		ID:         r.nextID,
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Status:     models.RequestPending,
+		CreatedAt:  time.Now(),
+	}
+	r.requests[req.ID] = req
+	r.nextID++
+
+	result := *req
+	return &result, nil
+}
+
+func (r *TestContactRepository) GetRequest(requestID int) (*models.ContactRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	req, ok := r.requests[requestID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *req
+	return &result, nil
+}
+
+func (r *TestContactRepository) GetPendingRequest(senderID, receiverID int) (*models.ContactRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, req := range r.requests {
+		if req.SenderID == senderID && req.ReceiverID == receiverID && req.Status == models.RequestPending {
+			result := *req
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *TestContactRepository) ListPendingRequests(userID int) (*models.RequestList, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := &models.RequestList{
+		Incoming: []models.ContactRequest{},
+		Outgoing: []models.ContactRequest{},
+	}
+	for _, req := range r.requests {
+		if req.Status != models.RequestPending {
+			continue
+		}
+		if req.ReceiverID == userID {
+			list.Incoming = append(list.Incoming, *req)
+		} else if req.SenderID == userID {
+			list.Outgoing = append(list.Outgoing, *req)
+		}
+	}
+	byNewest := func(reqs []models.ContactRequest) {
+		sort.Slice(reqs, func(i, j int) bool { return reqs[i].ID > reqs[j].ID })
+	}
+	byNewest(list.Incoming)
+	byNewest(list.Outgoing)
+	return list, nil
+}
+
+func (r *TestContactRepository) AcceptRequest(requestID int) (*models.ContactRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, err := r.respond(requestID, models.RequestAccepted)
+	if err != nil {
+		return nil, err
+	}
+	r.contacts[contactPair{req.SenderID, req.ReceiverID}] = *req.RespondedAt
+	r.contacts[contactPair{req.ReceiverID, req.SenderID}] = *req.RespondedAt
+	return req, nil
+}
+
+func (r *TestContactRepository) CloseRequest(requestID int, status models.RequestStatus) (*models.ContactRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.respond(requestID, status)
+}
+
+// respond moves a pending request to status; the caller must hold the lock
+func (r *TestContactRepository) respond(requestID int, status models.RequestStatus) (*models.ContactRequest, error) {
+	req, ok := r.requests[requestID]
+	if !ok || req.Status != models.RequestPending {
+		return nil, ErrConflict
+	}
+	now := time.Now()
+	req.Status = status
+	req.RespondedAt = &now
+
+	result := *req
+	return &result, nil
+}
+
+func (r *TestContactRepository) ListContacts(userID int) ([]models.Contact, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	contacts := []models.Contact{}
+	for pair, since := range r.contacts {
+		if pair.userID == userID {
+			contacts = append(contacts, models.Contact{
+				UserID:   pair.contactID,
+				Username: r.users[pair.contactID],
+				Since:    since,
+			})
+		}
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return strings.ToLower(contacts[i].Username) < strings.ToLower(contacts[j].Username)
+	})
+	return contacts, nil
+}
+
+func (r *TestContactRepository) AreContacts(userID, otherID int) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.contacts[contactPair{userID, otherID}]
+	return ok, nil
+}
+
+func (r *TestContactRepository) RemoveContact(userID, contactID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.contacts[contactPair{userID, contactID}]; !ok {
+		return ErrNotFound
+	}
+	delete(r.contacts, contactPair{userID, contactID})
+	delete(r.contacts, contactPair{contactID, userID})
+	return nil
+}
+
+func (r *TestContactRepository) GetPrivacySettings(userID int) (*models.PrivacySettings, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.users[userID]; !ok {
+		return nil, ErrNotFound
+	}
+	settings := r.privacy[userID]
+	return &settings, nil
+}
+
+func (r *TestContactRepository) UpdatePrivacySettings(userID int, settings *models.PrivacySettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userID]; !ok {
+		return ErrNotFound
+	}
+	r.privacy[userID] = *settings
+	return nil
+}
+
+func (r *TestContactRepository) BlockUser(blockerID, blockedID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.blocks[contactPair{blockerID, blockedID}]; !ok {
+		r.blocks[contactPair{blockerID, blockedID}] = time.Now()
+	}
+	delete(r.contacts, contactPair{blockerID, blockedID})
+	delete(r.contacts, contactPair{blockedID, blockerID})
+	for _, req := range r.requests {
+		if req.Status == models.RequestPending &&
+			((req.SenderID == blockerID && req.ReceiverID == blockedID) ||
+				(req.SenderID == blockedID && req.ReceiverID == blockerID)) {
+			now := time.Now()
+			req.Status = models.RequestCancelled
+			req.RespondedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *TestContactRepository) UnblockUser(blockerID, blockedID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.blocks[contactPair{blockerID, blockedID}]; !ok {
+		return ErrNotFound
+	}
+	delete(r.blocks, contactPair{blockerID, blockedID})
+	return nil
+}
+
+func (r *TestContactRepository) ListBlocked(userID int) ([]models.UserEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.listUsers(r.blocks, userID), nil
+}
+
+func (r *TestContactRepository) IsBlocked(userID, otherID int) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, blocked := r.blocks[contactPair{userID, otherID}]
+	_, blockedBy := r.blocks[contactPair{otherID, userID}]
+	return blocked || blockedBy, nil
+}
+
+func (r *TestContactRepository) BlockedUserIDs(userID int) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []int
+	for pair := range r.blocks {
+		if pair.userID == userID {
+			ids = append(ids, pair.contactID)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (r *TestContactRepository) BlockerIDs(userID int) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []int
+	for pair := range r.blocks {
+		if pair.contactID == userID {
+			ids = append(ids, pair.userID)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (r *TestContactRepository) MuteUser(userID, mutedID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.mutes[contactPair{userID, mutedID}]; !ok {
+		r.mutes[contactPair{userID, mutedID}] = time.Now()
+	}
+	return nil
+}
+
+func (r *TestContactRepository) UnmuteUser(userID, mutedID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.mutes[contactPair{userID, mutedID}]; !ok {
+		return ErrNotFound
+	}
+	delete(r.mutes, contactPair{userID, mutedID})
+	return nil
+}
+
+func (r *TestContactRepository) ListMuted(userID int) ([]models.UserEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.listUsers(r.mutes, userID), nil
+}
+
+func (r *TestContactRepository) IsMuted(userID, mutedID int) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.mutes[contactPair{userID, mutedID}]
+	return ok, nil
+}
+
+// listUsers returns the targets of userID's entries in list; the caller must hold the lock
+func (r *TestContactRepository) listUsers(list map[contactPair]time.Time, userID int) []models.UserEntry {
+	entries := []models.UserEntry{}
+	for pair, since := range list {
+		if pair.userID == userID {
+			entries = append(entries, models.UserEntry{
+				UserID:   pair.contactID,
+				Username: r.users[pair.contactID],
+				Since:    since,
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Username) < strings.ToLower(entries[j].Username)
+	})
+	return entries
+}
@@ -0,0 +1,52 @@
+// Package service provides the business logic for contacts and contact requests
+package service
+
+import "github.com/Mousa96/chatting-service/internal/contact/models"
+
+// Service defines the contact operations interface
+type Service interface {
+	// SendRequest asks receiverID to become a contact of senderID. If receiverID already
+	// has an open request to senderID, that request is accepted instead.
+	SendRequest(senderID, receiverID int) (*models.ContactRequest, error)
+	// AcceptRequest accepts a request received by userID
+	AcceptRequest(userID, requestID int) (*models.ContactRequest, error)
+	// DeclineRequest declines a request received by userID
+	DeclineRequest(userID, requestID int) (*models.ContactRequest, error)
+	// CancelRequest withdraws a request sent by userID
+	CancelRequest(userID, requestID int) (*models.ContactRequest, error)
+	// ListRequests returns the open requests received and sent by userID
+	ListRequests(userID int) (*models.RequestList, error)
+	// ListContacts returns the contacts of userID
+	ListContacts(userID int) ([]models.Contact, error)
+	// RemoveContact ends the contact relationship between userID and contactID
+	RemoveContact(userID, contactID int) error
+	// GetPrivacySettings returns the privacy settings of userID
+	GetPrivacySettings(userID int) (*models.PrivacySettings, error)
+	// UpdatePrivacySettings replaces the privacy settings of userID
+	UpdatePrivacySettings(userID int, settings *models.PrivacySettings) (*models.PrivacySettings, error)
+
+	// BlockUser blocks targetID for userID. Messages between them are refused, the
+	// blocker's presence is hidden from targetID, and any contact relationship ends.
+	BlockUser(userID, targetID int) error
+	// UnblockUser removes a block
+	UnblockUser(userID, targetID int) error
+	// ListBlocked returns the users blocked by userID
+	ListBlocked(userID int) ([]models.UserEntry, error)
+	// MuteUser marks the conversation with targetID as muted for userID.
+	// Messages are still delivered but flagged so clients don't notify.
+	MuteUser(userID, targetID int) error
+	// UnmuteUser removes a mute
+	UnmuteUser(userID, targetID int) error
+	// ListMuted returns the users muted by userID
+	ListMuted(userID int) ([]models.UserEntry, error)
+}
+
+// Notifier pushes real-time events to a connected user
+type Notifier interface {
+	NotifyUser(userID int, eventType string, payload interface{}) bool
+}
+
+// Presence reports whether a user currently has an open WebSocket connection
+type Presence interface {
+	IsOnline(userID int) bool
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Mousa96/chatting-service/internal/contact/repository"
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+)
+
+var (
+	// ErrContactsOnly is returned when the recipient only accepts messages from contacts
+	ErrContactsOnly = fmt.Errorf("%w: recipient only accepts messages from contacts", msgService.ErrNotPermitted)
+	// ErrBlocked is returned when either user has blocked the other
+	ErrBlocked = fmt.Errorf("%w: messages between these users are blocked", msgService.ErrNotPermitted)
+)
+
+// DeliveryPolicy refuses messages between users when either has blocked the other,
+// and enforces the "only contacts can message me" privacy setting.
+// It only depends on the repository so it can be given to the message service
+// before the WebSocket service, which the contact service notifies through, exists.
+type DeliveryPolicy struct {
+	repo repository.Repository
+}
+
+// NewDeliveryPolicy creates a DeliveryPolicy backed by the contact repository
+func NewDeliveryPolicy(repo repository.Repository) *DeliveryPolicy {
+	return &DeliveryPolicy{repo: repo}
+}
+
+// CanMessage implements message service.DeliveryPolicy
+func (p *DeliveryPolicy) CanMessage(senderID, receiverID int) error {
+	blocked, err := p.repo.IsBlocked(senderID, receiverID)
+	if err != nil {
+		return fmt.Errorf("failed to check blocks: %w", err)
+	}
+	if blocked {
+		return ErrBlocked
+	}
+
+	settings, err := p.repo.GetPrivacySettings(receiverID)
+	if err != nil {
+		// Unknown recipients are left for the message store to reject
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to check recipient privacy: %w", err)
+	}
+	if !settings.ContactsOnly {
+		return nil
+	}
+
+	contacts, err := p.repo.AreContacts(receiverID, senderID)
+	if err != nil {
+		return fmt.Errorf("failed to check contacts: %w", err)
+	}
+	if !contacts {
+		return ErrContactsOnly
+	}
+	return nil
+}
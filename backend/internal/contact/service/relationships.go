@@ -0,0 +1,29 @@
+package service
+
+import "github.com/Mousa96/chatting-service/internal/contact/repository"
+
+// Relationships answers block and mute lookups for the WebSocket service, which uses
+// them to hide presence from blocked users and to flag messages in muted conversations
+type Relationships struct {
+	repo repository.Repository
+}
+
+// NewRelationships creates a Relationships backed by the contact repository
+func NewRelationships(repo repository.Repository) *Relationships {
+	return &Relationships{repo: repo}
+}
+
+// BlockedUserIDs returns the IDs of the users blocked by userID
+func (r *Relationships) BlockedUserIDs(userID int) ([]int, error) {
+	return r.repo.BlockedUserIDs(userID)
+}
+
+// BlockerIDs returns the IDs of the users who have blocked userID
+func (r *Relationships) BlockerIDs(userID int) ([]int, error) {
+	return r.repo.BlockerIDs(userID)
+}
+
+// IsMuted reports whether userID has muted mutedID
+func (r *Relationships) IsMuted(userID, mutedID int) (bool, error) {
+	return r.repo.IsMuted(userID, mutedID)
+}
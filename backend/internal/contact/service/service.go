@@ -0,0 +1,296 @@
+// Package service implements the contact business logic
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Mousa96/chatting-service/internal/contact/models"
+	"github.com/Mousa96/chatting-service/internal/contact/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+)
+
+var (
+	// ErrSelfRequest is returned when a user sends a contact request to themselves
+	ErrSelfRequest = errors.New("cannot send a contact request to yourself")
+	// ErrUserNotFound is returned when the other user does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrAlreadyContacts is returned when a request is sent to an existing contact
+	ErrAlreadyContacts = errors.New("already contacts")
+	// ErrRequestExists is returned when an open request between the two users already exists
+	ErrRequestExists = errors.New("a contact request is already pending")
+	// ErrRequestNotFound is returned when a request does not exist or belongs to someone else
+	ErrRequestNotFound = errors.New("contact request not found")
+	// ErrRequestClosed is returned when a request has already been answered or withdrawn
+	ErrRequestClosed = errors.New("contact request is no longer pending")
+	// ErrNotContacts is returned when removing a user who is not a contact
+	ErrNotContacts = errors.New("not a contact")
+	// ErrSelfTarget is returned when a user tries to block or mute themselves
+	ErrSelfTarget = errors.New("cannot block or mute yourself")
+	// ErrNotBlocked is returned when unblocking a user who is not blocked
+	ErrNotBlocked = errors.New("user is not blocked")
+	// ErrNotMuted is returned when unmuting a user who is not muted
+	ErrNotMuted = errors.New("user is not muted")
+)
+
+// ContactService provides the implementation of the Service interface
+type ContactService struct {
+	repo     repository.Repository
+	notifier Notifier
+	presence Presence
+}
+
+// Option configures optional ContactService dependencies
+type Option func(*ContactService)
+
+// WithNotifier sets the notifier used to push contact changes to connected clients
+func WithNotifier(notifier Notifier) Option {
+	return func(s *ContactService) {
+		s.notifier = notifier
+	}
+}
+
+// WithPresence sets the source of online status used to restore presence after an unblock
+func WithPresence(presence Presence) Option {
+	return func(s *ContactService) {
+		s.presence = presence
+	}
+}
+
+// NewContactService creates a new ContactService instance
+func NewContactService(repo repository.Repository, opts ...Option) Service {
+	s := &ContactService{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *ContactService) SendRequest(senderID, receiverID int) (*models.ContactRequest, error) {
+	if senderID == receiverID {
+		return nil, ErrSelfRequest
+	}
+
+	exists, err := s.repo.UserExists(receiverID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	blocked, err := s.repo.IsBlocked(senderID, receiverID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
+	contacts, err := s.repo.AreContacts(senderID, receiverID)
+	if err != nil {
+		return nil, err
+	}
+	if contacts {
+		return nil, ErrAlreadyContacts
+	}
+
+	// Both users want to connect, so treat the second request as an acceptance
+	reverse, err := s.repo.GetPendingRequest(receiverID, senderID)
+	if err == nil {
+		return s.AcceptRequest(senderID, reverse.ID)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	req, err := s.repo.CreateRequest(senderID, receiverID)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, ErrRequestExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(receiverID, wsModels.EventContactRequestReceived, req)
+	return req, nil
+}
+
+func (s *ContactService) AcceptRequest(userID, requestID int) (*models.ContactRequest, error) {
+	if _, err := s.ownRequest(requestID, func(req *models.ContactRequest) bool { return req.ReceiverID == userID }); err != nil {
+		return nil, err
+	}
+
+	req, err := s.repo.AcceptRequest(requestID)
+	if err != nil {
+		return nil, s.closeError(err)
+	}
+
+	s.notify(req.SenderID, wsModels.EventContactRequestAccepted, req)
+	return req, nil
+}
+
+func (s *ContactService) DeclineRequest(userID, requestID int) (*models.ContactRequest, error) {
+	if _, err := s.ownRequest(requestID, func(req *models.ContactRequest) bool { return req.ReceiverID == userID }); err != nil {
+		return nil, err
+	}
+
+	req, err := s.repo.CloseRequest(requestID, models.RequestDeclined)
+	if err != nil {
+		return nil, s.closeError(err)
+	}
+
+	s.notify(req.SenderID, wsModels.EventContactRequestDeclined, req)
+	return req, nil
+}
+
+func (s *ContactService) CancelRequest(userID, requestID int) (*models.ContactRequest, error) {
+	if _, err := s.ownRequest(requestID, func(req *models.ContactRequest) bool { return req.SenderID == userID }); err != nil {
+		return nil, err
+	}
+
+	req, err := s.repo.CloseRequest(requestID, models.RequestCancelled)
+	if err != nil {
+		return nil, s.closeError(err)
+	}
+
+	s.notify(req.ReceiverID, wsModels.EventContactRequestCancelled, req)
+	return req, nil
+}
+
+func (s *ContactService) ListRequests(userID int) (*models.RequestList, error) {
+	return s.repo.ListPendingRequests(userID)
+}
+
+func (s *ContactService) ListContacts(userID int) ([]models.Contact, error) {
+	return s.repo.ListContacts(userID)
+}
+
+func (s *ContactService) RemoveContact(userID, contactID int) error {
+	err := s.repo.RemoveContact(userID, contactID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrNotContacts
+	}
+	if err != nil {
+		return err
+	}
+
+	s.notify(contactID, wsModels.EventContactRemoved, wsModels.ContactRemovedEvent{UserID: userID})
+	return nil
+}
+
+func (s *ContactService) GetPrivacySettings(userID int) (*models.PrivacySettings, error) {
+	settings, err := s.repo.GetPrivacySettings(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return settings, err
+}
+
+func (s *ContactService) UpdatePrivacySettings(userID int, settings *models.PrivacySettings) (*models.PrivacySettings, error) {
+	err := s.repo.UpdatePrivacySettings(userID, settings)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *ContactService) BlockUser(userID, targetID int) error {
+	if err := s.checkTarget(userID, targetID); err != nil {
+		return err
+	}
+	if err := s.repo.BlockUser(userID, targetID); err != nil {
+		return err
+	}
+
+	// The blocked user should see the blocker go offline rather than notice the block
+	s.notify(targetID, wsModels.EventUserStatus, wsModels.UserStatusEvent{UserID: userID, Status: "offline"})
+	return nil
+}
+
+func (s *ContactService) UnblockUser(userID, targetID int) error {
+	err := s.repo.UnblockUser(userID, targetID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrNotBlocked
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.presence != nil && s.presence.IsOnline(userID) {
+		s.notify(targetID, wsModels.EventUserStatus, wsModels.UserStatusEvent{UserID: userID, Status: "online"})
+	}
+	return nil
+}
+
+func (s *ContactService) ListBlocked(userID int) ([]models.UserEntry, error) {
+	return s.repo.ListBlocked(userID)
+}
+
+func (s *ContactService) MuteUser(userID, targetID int) error {
+	if err := s.checkTarget(userID, targetID); err != nil {
+		return err
+	}
+	return s.repo.MuteUser(userID, targetID)
+}
+
+func (s *ContactService) UnmuteUser(userID, targetID int) error {
+	err := s.repo.UnmuteUser(userID, targetID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrNotMuted
+	}
+	return err
+}
+
+func (s *ContactService) ListMuted(userID int) ([]models.UserEntry, error) {
+	return s.repo.ListMuted(userID)
+}
+
+// checkTarget validates the target of a block or mute
+func (s *ContactService) checkTarget(userID, targetID int) error {
+	if userID == targetID {
+		return ErrSelfTarget
+	}
+	exists, err := s.repo.UserExists(targetID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ownRequest loads a request and checks that it belongs to the acting user.
+// Requests belonging to other users are reported as not found.
+func (s *ContactService) ownRequest(requestID int, owns func(*models.ContactRequest) bool) (*models.ContactRequest, error) {
+	req, err := s.repo.GetRequest(requestID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !owns(req)) {
+		return nil, ErrRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != models.RequestPending {
+		return nil, ErrRequestClosed
+	}
+	return req, nil
+}
+
+// closeError maps a failed state change to a service error
+func (s *ContactService) closeError(err error) error {
+	if errors.Is(err, repository.ErrConflict) {
+		return ErrRequestClosed
+	}
+	return fmt.Errorf("failed to update contact request: %w", err)
+}
+
+// notify pushes a contact event to userID if a notifier is configured
+func (s *ContactService) notify(userID int, eventType string, payload interface{}) {
+	if s.notifier != nil {
+		s.notifier.NotifyUser(userID, eventType, payload)
+	}
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Mousa96/chatting-service/internal/contact/models"
+	"github.com/Mousa96/chatting-service/internal/contact/repository"
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockNotifier struct {
+	mock.Mock
+}
+
+func (m *mockNotifier) NotifyUser(userID int, eventType string, payload interface{}) bool {
+	args := m.Called(userID, eventType, payload)
+	return args.Bool(0)
+}
+
+func newTestService(t *testing.T) (*repository.TestContactRepository, *mockNotifier, Service) {
+	repo := repository.NewTestContactRepository()
+	repo.AddUser(1, "alice")
+	repo.AddUser(2, "bob")
+	repo.AddUser(3, "carol")
+	notifier := new(mockNotifier)
+	notifier.On("NotifyUser", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	return repo, notifier, NewContactService(repo, WithNotifier(notifier))
+}
+
+func TestSendRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		senderID    int
+		receiverID  int
+		setup       func(s Service)
+		expectedErr error
+	}{
+		{
+			name:       "Valid request",
+			senderID:   1,
+			receiverID: 2,
+		},
+		{
+			name:        "Request to self",
+			senderID:    1,
+			receiverID:  1,
+			expectedErr: ErrSelfRequest,
+		},
+		{
+			name:        "Unknown user",
+			senderID:    1,
+			receiverID:  99,
+			expectedErr: ErrUserNotFound,
+		},
+		{
+			name:       "Duplicate request",
+			senderID:   1,
+			receiverID: 2,
+			setup: func(s Service) {
+				_, err := s.SendRequest(1, 2)
+				require.NoError(t, err)
+			},
+			expectedErr: ErrRequestExists,
+		},
+		{
+			name:       "Already contacts",
+			senderID:   1,
+			receiverID: 2,
+			setup: func(s Service) {
+				req, err := s.SendRequest(2, 1)
+				require.NoError(t, err)
+				_, err = s.AcceptRequest(1, req.ID)
+				require.NoError(t, err)
+			},
+			expectedErr: ErrAlreadyContacts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, notifier, contactService := newTestService(t)
+			if tt.setup != nil {
+				tt.setup(contactService)
+			}
+
+			req, err := contactService.SendRequest(tt.senderID, tt.receiverID)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Nil(t, req)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, models.RequestPending, req.Status)
+			notifier.AssertCalled(t, "NotifyUser", tt.receiverID, wsModels.EventContactRequestReceived, req)
+		})
+	}
+}
+
+func TestMutualRequestIsAccepted(t *testing.T) {
+	_, notifier, contactService := newTestService(t)
+
+	first, err := contactService.SendRequest(1, 2)
+	require.NoError(t, err)
+
+	second, err := contactService.SendRequest(2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, models.RequestAccepted, second.Status)
+	notifier.AssertCalled(t, "NotifyUser", 1, wsModels.EventContactRequestAccepted, second)
+
+	contacts, err := contactService.ListContacts(1)
+	require.NoError(t, err)
+	require.Len(t, contacts, 1)
+	assert.Equal(t, 2, contacts[0].UserID)
+}
+
+func TestRespondToRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		actorID        int
+		action         func(s Service, userID, requestID int) (*models.ContactRequest, error)
+		expectedStatus models.RequestStatus
+		expectedEvent  string
+		notifiedUserID int
+		expectedErr    error
+	}{
+		{
+			name:           "Receiver accepts",
+			actorID:        2,
+			action:         Service.AcceptRequest,
+			expectedStatus: models.RequestAccepted,
+			expectedEvent:  wsModels.EventContactRequestAccepted,
+			notifiedUserID: 1,
+		},
+		{
+			name:           "Receiver declines",
+			actorID:        2,
+			action:         Service.DeclineRequest,
+			expectedStatus: models.RequestDeclined,
+			expectedEvent:  wsModels.EventContactRequestDeclined,
+			notifiedUserID: 1,
+		},
+		{
+			name:           "Sender cancels",
+			actorID:        1,
+			action:         Service.CancelRequest,
+			expectedStatus: models.RequestCancelled,
+			expectedEvent:  wsModels.EventContactRequestCancelled,
+			notifiedUserID: 2,
+		},
+		{
+			name:        "Sender cannot accept own request",
+			actorID:     1,
+			action:      Service.AcceptRequest,
+			expectedErr: ErrRequestNotFound,
+		},
+		{
+			name:        "Third party cannot cancel",
+			actorID:     3,
+			action:      Service.CancelRequest,
+			expectedErr: ErrRequestNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, notifier, contactService := newTestService(t)
+			sent, err := contactService.SendRequest(1, 2)
+			require.NoError(t, err)
+
+			req, err := tt.action(contactService, tt.actorID, sent.ID)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, req.Status)
+			notifier.AssertCalled(t, "NotifyUser", tt.notifiedUserID, tt.expectedEvent, req)
+
+			// A request can only be answered once
+			_, err = tt.action(contactService, tt.actorID, sent.ID)
+			assert.ErrorIs(t, err, ErrRequestClosed)
+		})
+	}
+}
+
+func TestRemoveContact(t *testing.T) {
+	_, notifier, contactService := newTestService(t)
+
+	assert.ErrorIs(t, contactService.RemoveContact(1, 2), ErrNotContacts)
+
+	req, err := contactService.SendRequest(1, 2)
+	require.NoError(t, err)
+	_, err = contactService.AcceptRequest(2, req.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, contactService.RemoveContact(2, 1))
+	notifier.AssertCalled(t, "NotifyUser", 1, wsModels.EventContactRemoved, wsModels.ContactRemovedEvent{UserID: 2})
+
+	contacts, err := contactService.ListContacts(1)
+	require.NoError(t, err)
+	assert.Empty(t, contacts)
+}
+
+func TestDeliveryPolicy(t *testing.T) {
+	repo, _, contactService := newTestService(t)
+	policy := NewDeliveryPolicy(repo)
+
+	// Anyone may message a user who has not opted in
+	assert.NoError(t, policy.CanMessage(1, 2))
+
+	_, err := contactService.UpdatePrivacySettings(2, &models.PrivacySettings{ContactsOnly: true})
+	require.NoError(t, err)
+
+	err = policy.CanMessage(1, 2)
+	assert.ErrorIs(t, err, ErrContactsOnly)
+	assert.ErrorIs(t, err, msgService.ErrNotPermitted)
+
+	req, err := contactService.SendRequest(1, 2)
+	require.NoError(t, err)
+	_, err = contactService.AcceptRequest(2, req.ID)
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.CanMessage(1, 2))
+	// The setting only restricts who can message the user who enabled it
+	assert.NoError(t, policy.CanMessage(2, 3))
+}
+
+func TestBlockUser(t *testing.T) {
+	repo, notifier, contactService := newTestService(t)
+	policy := NewDeliveryPolicy(repo)
+
+	req, err := contactService.SendRequest(1, 2)
+	require.NoError(t, err)
+	_, err = contactService.AcceptRequest(2, req.ID)
+	require.NoError(t, err)
+	pending, err := contactService.SendRequest(1, 3)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, contactService.BlockUser(1, 1), ErrSelfTarget)
+	assert.ErrorIs(t, contactService.BlockUser(1, 99), ErrUserNotFound)
+
+	require.NoError(t, contactService.BlockUser(2, 1))
+	require.NoError(t, contactService.BlockUser(3, 1))
+	notifier.AssertCalled(t, "NotifyUser", 1, wsModels.EventUserStatus, wsModels.UserStatusEvent{UserID: 2, Status: "offline"})
+
+	// Blocking ends the contact relationship and closes open requests
+	contacts, err := contactService.ListContacts(1)
+	require.NoError(t, err)
+	assert.Empty(t, contacts)
+	closed, err := repo.GetRequest(pending.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RequestCancelled, closed.Status)
+
+	// Messages are refused in both directions
+	assert.ErrorIs(t, policy.CanMessage(1, 2), ErrBlocked)
+	assert.ErrorIs(t, policy.CanMessage(2, 1), msgService.ErrNotPermitted)
+
+	_, err = contactService.SendRequest(1, 2)
+	assert.ErrorIs(t, err, ErrBlocked)
+
+	blocked, err := contactService.ListBlocked(2)
+	require.NoError(t, err)
+	require.Len(t, blocked, 1)
+	assert.Equal(t, 1, blocked[0].UserID)
+
+	require.NoError(t, contactService.UnblockUser(2, 1))
+	assert.ErrorIs(t, contactService.UnblockUser(2, 1), ErrNotBlocked)
+	assert.NoError(t, policy.CanMessage(1, 2))
+}
+
+func TestUnblockRestoresPresence(t *testing.T) {
+	repo := repository.NewTestContactRepository()
+	repo.AddUser(1, "alice")
+	repo.AddUser(2, "bob")
+	notifier := new(mockNotifier)
+	notifier.On("NotifyUser", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	contactService := NewContactService(repo, WithNotifier(notifier), WithPresence(onlineUsers{2: true}))
+
+	require.NoError(t, contactService.BlockUser(2, 1))
+	require.NoError(t, contactService.UnblockUser(2, 1))
+	notifier.AssertCalled(t, "NotifyUser", 1, wsModels.EventUserStatus, wsModels.UserStatusEvent{UserID: 2, Status: "online"})
+}
+
+func TestMuteUser(t *testing.T) {
+	repo, _, contactService := newTestService(t)
+	relationships := NewRelationships(repo)
+
+	assert.ErrorIs(t, contactService.MuteUser(1, 1), ErrSelfTarget)
+	require.NoError(t, contactService.MuteUser(1, 2))
+	// Muting twice is not an error
+	require.NoError(t, contactService.MuteUser(1, 2))
+
+	muted, err := relationships.IsMuted(1, 2)
+	require.NoError(t, err)
+	assert.True(t, muted)
+	muted, err = relationships.IsMuted(2, 1)
+	require.NoError(t, err)
+	assert.False(t, muted)
+
+	// Muting doesn't affect delivery
+	assert.NoError(t, NewDeliveryPolicy(repo).CanMessage(2, 1))
+
+	list, err := contactService.ListMuted(1)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "bob", list[0].Username)
+
+	require.NoError(t, contactService.UnmuteUser(1, 2))
+	assert.ErrorIs(t, contactService.UnmuteUser(1, 2), ErrNotMuted)
+}
+
+type onlineUsers map[int]bool
+
+func (o onlineUsers) IsOnline(userID int) bool {
+	return o[userID]
+}
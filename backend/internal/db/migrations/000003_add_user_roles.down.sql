@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_role;
+
+ALTER TABLE users
+DROP COLUMN suspended_at,
+DROP COLUMN role;
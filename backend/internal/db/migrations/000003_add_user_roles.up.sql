@@ -0,0 +1,5 @@
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+ADD COLUMN suspended_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_users_role ON users(role);
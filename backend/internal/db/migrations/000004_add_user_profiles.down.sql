@@ -0,0 +1,5 @@
+ALTER TABLE users
+DROP COLUMN time_zone,
+DROP COLUMN bio,
+DROP COLUMN avatar_url,
+DROP COLUMN display_name;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+ADD COLUMN display_name VARCHAR(100),
+ADD COLUMN avatar_url TEXT,
+ADD COLUMN bio TEXT,
+ADD COLUMN time_zone VARCHAR(64);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_lower_username_id;
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
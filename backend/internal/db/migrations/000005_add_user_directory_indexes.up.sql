@@ -0,0 +1,8 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Trigram indexes serve both prefix (ILIKE 'term%') and fuzzy (%) directory searches
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING gin (display_name gin_trgm_ops);
+
+-- Keyset pagination of the unfiltered directory
+CREATE INDEX IF NOT EXISTS idx_users_lower_username_id ON users (lower(username), id);
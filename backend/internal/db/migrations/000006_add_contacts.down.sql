@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN contacts_only;
+DROP TABLE IF EXISTS contacts;
+DROP TABLE IF EXISTS contact_requests;
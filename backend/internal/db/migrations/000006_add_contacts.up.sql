@@ -0,0 +1,26 @@
+CREATE TABLE contact_requests (
+    id SERIAL PRIMARY KEY,
+    sender_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    receiver_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE,
+    CHECK (sender_id <> receiver_id)
+);
+
+-- At most one open request between any two users, in either direction
+CREATE UNIQUE INDEX idx_contact_requests_pending_pair
+    ON contact_requests (LEAST(sender_id, receiver_id), GREATEST(sender_id, receiver_id))
+    WHERE status = 'pending';
+CREATE INDEX idx_contact_requests_receiver ON contact_requests (receiver_id) WHERE status = 'pending';
+CREATE INDEX idx_contact_requests_sender ON contact_requests (sender_id) WHERE status = 'pending';
+
+-- Contacts are stored in both directions so lookups only need user_id
+CREATE TABLE contacts (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, contact_id)
+);
+
+ALTER TABLE users ADD COLUMN contacts_only BOOLEAN NOT NULL DEFAULT FALSE;
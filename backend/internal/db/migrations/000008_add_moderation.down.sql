@@ -0,0 +1,3 @@
+ALTER TABLE messages DROP COLUMN hidden_at;
+DROP TABLE IF EXISTS moderation_actions;
+DROP TABLE IF EXISTS reports;
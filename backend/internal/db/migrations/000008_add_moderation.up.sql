@@ -0,0 +1,35 @@
+-- Message and user IDs are kept without foreign keys so reports and the audit trail
+-- survive deletion of the reported content; the snapshot preserves what was reported.
+CREATE TABLE reports (
+    id SERIAL PRIMARY KEY,
+    reporter_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    target_type VARCHAR(20) NOT NULL,
+    message_id INTEGER,
+    reported_user_id INTEGER NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    comment TEXT,
+    snapshot JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolved_by INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_reports_status_id ON reports (status, id DESC);
+CREATE INDEX idx_reports_reported_user ON reports (reported_user_id);
+
+CREATE TABLE moderation_actions (
+    id SERIAL PRIMARY KEY,
+    moderator_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(32) NOT NULL,
+    report_id INTEGER REFERENCES reports(id) ON DELETE SET NULL,
+    target_user_id INTEGER,
+    message_id INTEGER,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_moderation_actions_report ON moderation_actions (report_id);
+CREATE INDEX idx_moderation_actions_target_user ON moderation_actions (target_user_id);
+
+ALTER TABLE messages ADD COLUMN hidden_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_messages_media_url;
+
+UPDATE users SET avatar_url = '/uploads/' || substr(avatar_url, length('/api/media/') + 1)
+WHERE avatar_url LIKE '/api/media/%';
+
+UPDATE messages SET media_url = '/uploads/' || substr(media_url, length('/api/media/') + 1)
+WHERE media_url LIKE '/api/media/%';
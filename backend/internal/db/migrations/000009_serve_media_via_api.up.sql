@@ -0,0 +1,8 @@
+-- Media moved from the public /uploads/ file server to the access-controlled /api/media/ handler
+UPDATE messages SET media_url = '/api/media/' || substr(media_url, length('/uploads/') + 1)
+WHERE media_url LIKE '/uploads/%';
+
+UPDATE users SET avatar_url = '/api/media/' || substr(avatar_url, length('/uploads/') + 1)
+WHERE avatar_url LIKE '/uploads/%';
+
+CREATE INDEX idx_messages_media_url ON messages (media_url) WHERE media_url IS NOT NULL AND media_url <> '';
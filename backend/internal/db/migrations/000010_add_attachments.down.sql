@@ -0,0 +1,12 @@
+-- Only the first attachment of each message can be kept as its media URL
+UPDATE messages m SET media_url = '/api/media/' || a.storage_key
+FROM (
+    SELECT DISTINCT ON (ma.message_id) ma.message_id, att.storage_key
+    FROM message_attachments ma
+    JOIN attachments att ON att.id = ma.attachment_id
+    ORDER BY ma.message_id, ma.position
+) a
+WHERE m.id = a.message_id;
+
+DROP TABLE IF EXISTS message_attachments;
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,55 @@
+-- Uploaded files get their own metadata rows; messages reference them through
+-- message_attachments so a message can carry several files
+CREATE TABLE attachments (
+    id SERIAL PRIMARY KEY,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    sha256 CHAR(64),
+    original_filename VARCHAR(255) NOT NULL DEFAULT '',
+    width INTEGER,
+    height INTEGER,
+    duration_ms INTEGER,
+    uploaded_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_attachments_owner ON attachments (owner_id);
+
+CREATE TABLE message_attachments (
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    attachment_id INTEGER NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (message_id, attachment_id)
+);
+
+CREATE INDEX idx_message_attachments_attachment ON message_attachments (attachment_id);
+
+-- Files uploaded before this migration only exist as message media URLs. Their size and
+-- checksum are unknown, and the content type is guessed from the extension.
+INSERT INTO attachments (owner_id, storage_key, content_type, uploaded_at)
+SELECT DISTINCT ON (key) sender_id, key,
+    CASE lower(substring(key FROM '\.([^./]+)$'))
+        WHEN 'jpg' THEN 'image/jpeg'
+        WHEN 'jpeg' THEN 'image/jpeg'
+        WHEN 'png' THEN 'image/png'
+        WHEN 'gif' THEN 'image/gif'
+        WHEN 'mp4' THEN 'video/mp4'
+        ELSE 'application/octet-stream'
+    END,
+    created_at
+FROM (
+    SELECT substr(media_url, length('/api/media/') + 1) AS key, sender_id, created_at, id
+    FROM messages
+    WHERE media_url LIKE '/api/media/%' AND sender_id IS NOT NULL
+) legacy
+ORDER BY key, id;
+
+INSERT INTO message_attachments (message_id, attachment_id)
+SELECT m.id, a.id
+FROM messages m
+JOIN attachments a ON a.storage_key = substr(m.media_url, length('/api/media/') + 1)
+WHERE m.media_url LIKE '/api/media/%';
+
+UPDATE messages SET media_url = ''
+WHERE id IN (SELECT message_id FROM message_attachments);
@@ -0,0 +1,3 @@
+ALTER TABLE attachments
+    DROP COLUMN IF EXISTS variants,
+    DROP COLUMN IF EXISTS blurhash;
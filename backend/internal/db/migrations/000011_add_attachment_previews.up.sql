@@ -0,0 +1,5 @@
+-- Thumbnails and poster frames are stored next to the original file; their metadata
+-- is only ever read with the attachment, so it is kept inline
+ALTER TABLE attachments
+    ADD COLUMN blurhash VARCHAR(64),
+    ADD COLUMN variants JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,18 @@
+-- Resumable uploads in progress. Chunks are written to storage under storage_key as they
+-- arrive; storage_state holds what the backend needs to continue, such as the S3
+-- multipart upload ID and the ETags of the parts sent so far.
+CREATE TABLE uploads (
+    id CHAR(32) PRIMARY KEY,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    storage_state TEXT NOT NULL DEFAULT '',
+    assembled BOOLEAN NOT NULL DEFAULT FALSE,
+    attachment_id INTEGER REFERENCES attachments(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_uploads_expires_at ON uploads (expires_at);
@@ -0,0 +1,16 @@
+-- Slots for files clients upload straight to storage with a presigned URL. The file
+-- lands at storage_key and is only turned into an attachment once the server has
+-- checked its size and type.
+CREATE TABLE direct_uploads (
+    id CHAR(32) PRIMARY KEY,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    attachment_id INTEGER REFERENCES attachments(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_direct_uploads_expires_at ON direct_uploads (expires_at);
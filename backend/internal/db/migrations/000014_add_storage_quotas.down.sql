@@ -0,0 +1,3 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS storage_quota,
+    DROP COLUMN IF EXISTS storage_used;
@@ -0,0 +1,11 @@
+-- Media storage used by each user, kept up to date as files are stored and removed so
+-- quotas can be checked without summing attachments. storage_quota overrides the
+-- configured default quota for a single user.
+ALTER TABLE users
+    ADD COLUMN storage_used BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN storage_quota BIGINT CHECK (storage_quota >= 0);
+
+UPDATE users u
+SET storage_used = a.total
+FROM (SELECT owner_id, SUM(size) AS total FROM attachments GROUP BY owner_id) a
+WHERE a.owner_id = u.id;
@@ -0,0 +1,5 @@
+-- Fails while attachments still share a blob's key
+DROP INDEX IF EXISTS idx_attachments_storage_key;
+ALTER TABLE attachments ADD CONSTRAINT attachments_storage_key_key UNIQUE (storage_key);
+DROP INDEX IF EXISTS idx_attachments_sha256;
+DROP TABLE IF EXISTS media_blobs;
@@ -0,0 +1,26 @@
+-- Uploaded files are stored once per distinct content. Attachments whose storage_key
+-- names a blob share its file, and ref_count counts them so the file is deleted with
+-- the last one. owner_id is the user charged for the blob's storage.
+CREATE TABLE media_blobs (
+    sha256 CHAR(64) PRIMARY KEY,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ref_count INTEGER NOT NULL DEFAULT 1 CHECK (ref_count >= 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_attachments_sha256 ON attachments (sha256);
+
+-- Attachments sharing a blob share its storage key
+ALTER TABLE attachments DROP CONSTRAINT attachments_storage_key_key;
+CREATE INDEX idx_attachments_storage_key ON attachments (storage_key);
+
+-- Existing uploads with a checksum become blobs that later uploads of the same content
+-- can share. Where several files already hold the same content the oldest is used.
+INSERT INTO media_blobs (sha256, storage_key, content_type, size, owner_id, ref_count)
+SELECT DISTINCT ON (sha256) sha256, storage_key, content_type, size, owner_id, 1
+FROM attachments
+WHERE sha256 IS NOT NULL
+ORDER BY sha256, uploaded_at, id;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_attachments_uploaded_at;
+ALTER TABLE media_blobs DROP COLUMN IF EXISTS acquired_at;
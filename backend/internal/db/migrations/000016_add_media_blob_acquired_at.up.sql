@@ -0,0 +1,5 @@
+-- When each blob last gained a reference. Garbage collection leaves recently acquired
+-- blobs alone, since the attachment that references one may not be saved yet.
+ALTER TABLE media_blobs ADD COLUMN acquired_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_attachments_uploaded_at ON attachments (uploaded_at);
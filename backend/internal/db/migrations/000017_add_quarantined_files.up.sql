@@ -0,0 +1,14 @@
+-- Uploads a malware scanner found suspicious. The files are kept under the quarantine/
+-- storage prefix until an administrator reviews them.
+CREATE TABLE quarantined_files (
+    id SERIAL PRIMARY KEY,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    original_filename VARCHAR(255) NOT NULL DEFAULT '',
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    signature VARCHAR(255) NOT NULL,
+    quarantined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_quarantined_files_quarantined_at ON quarantined_files (quarantined_at);
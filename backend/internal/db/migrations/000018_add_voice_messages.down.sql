@@ -0,0 +1,3 @@
+UPDATE messages SET status = 'read' WHERE status = 'played';
+ALTER TABLE messages DROP COLUMN IF EXISTS kind;
+ALTER TABLE attachments DROP COLUMN IF EXISTS waveform;
@@ -0,0 +1,6 @@
+-- Voice notes are messages of their own kind carrying one audio attachment, drawn from
+-- the waveform peaks computed when the audio was uploaded. Played is a message status
+-- after read, so it needs no column of its own.
+ALTER TABLE messages ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'text';
+
+ALTER TABLE attachments ADD COLUMN waveform JSONB;
@@ -0,0 +1,19 @@
+-- Link previews are fetched in the background. A job is queued for each message with a
+-- link; workers claim jobs for a lease so several servers never fetch the same one, and
+-- a job whose worker died is claimed again once its lease runs out.
+ALTER TABLE messages ADD COLUMN link_preview JSONB;
+
+CREATE TABLE link_preview_jobs (
+    message_id INTEGER PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    claimed_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Fetched previews by URL. A NULL preview records a page that had none or could not be
+-- fetched, so it is not fetched again for every message linking to it.
+CREATE TABLE link_previews (
+    url TEXT PRIMARY KEY,
+    preview JSONB,
+    fetched_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
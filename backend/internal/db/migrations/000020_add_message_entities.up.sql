@@ -0,0 +1,4 @@
+-- Entities format message content parsed from Markdown and mark the users it mentions.
+-- Each row has a single receiver, so whether they were mentioned is kept on the row.
+ALTER TABLE messages ADD COLUMN entities JSONB;
+ALTER TABLE messages ADD COLUMN mentioned BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS scheduled_message_id;
+DROP TABLE IF EXISTS scheduled_message_attachments;
+DROP TABLE IF EXISTS scheduled_messages;
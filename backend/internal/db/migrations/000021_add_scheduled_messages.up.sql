@@ -0,0 +1,34 @@
+-- Messages waiting for their send time. Workers claim due messages for a lease so several
+-- servers never send the same one, and a message whose worker died is claimed again once
+-- its lease runs out. A sent message is deleted and lives on as a message row.
+CREATE TABLE scheduled_messages (
+    id SERIAL PRIMARY KEY,
+    sender_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    receiver_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL DEFAULT 'text',
+    content TEXT NOT NULL DEFAULT '',
+    media_url TEXT NOT NULL DEFAULT '',
+    send_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    error TEXT NOT NULL DEFAULT '',
+    claimed_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_scheduled_messages_due ON scheduled_messages (send_at) WHERE status = 'pending';
+CREATE INDEX idx_scheduled_messages_sender ON scheduled_messages (sender_id, send_at);
+
+-- Attachments of scheduled messages are kept from the unattached media collector
+CREATE TABLE scheduled_message_attachments (
+    scheduled_message_id INTEGER NOT NULL REFERENCES scheduled_messages(id) ON DELETE CASCADE,
+    attachment_id INTEGER NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (scheduled_message_id, attachment_id)
+);
+
+CREATE INDEX idx_scheduled_message_attachments_attachment ON scheduled_message_attachments (attachment_id);
+
+-- The scheduled message a message was sent from. It is unique, so a scheduled message
+-- whose claim ran out while it was being sent cannot be sent twice.
+ALTER TABLE messages ADD COLUMN scheduled_message_id INTEGER UNIQUE;
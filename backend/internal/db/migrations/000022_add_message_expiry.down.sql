@@ -0,0 +1,6 @@
+ALTER TABLE users DROP COLUMN IF EXISTS external;
+DROP INDEX IF EXISTS idx_messages_created_at;
+DROP INDEX IF EXISTS idx_messages_expires_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS expire_after;
+ALTER TABLE messages DROP COLUMN IF EXISTS expires_at;
+DROP TABLE IF EXISTS conversation_timers;
@@ -0,0 +1,24 @@
+-- Disappearing messages. A conversation timer makes the messages sent while it is set
+-- expire a fixed time after they are sent or after the receiver reads them. Messages
+-- keep what their timer was when sent: expires_at is set at once for timers counted
+-- from sending, and from expire_after when the message is read for the others.
+CREATE TABLE conversation_timers (
+    user_a INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_b INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seconds INTEGER NOT NULL CHECK (seconds > 0),
+    mode VARCHAR(16) NOT NULL,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_a, user_b),
+    CHECK (user_a < user_b)
+);
+
+ALTER TABLE messages ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE messages ADD COLUMN expire_after INTEGER;
+
+CREATE INDEX idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL;
+-- The retention policy removes messages by age
+CREATE INDEX idx_messages_created_at ON messages (created_at);
+
+-- External users, such as contractors, have their conversations kept for a shorter time
+ALTER TABLE users ADD COLUMN external BOOLEAN NOT NULL DEFAULT FALSE;
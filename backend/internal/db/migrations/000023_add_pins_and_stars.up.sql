@@ -0,0 +1,22 @@
+-- Pinned messages are shared by both participants of a conversation, which is stored as
+-- its lowest and highest user ID so the pins of a conversation can be counted and listed
+CREATE TABLE pinned_messages (
+    message_id INTEGER PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    user_a INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_b INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    pinned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    pinned_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (user_a <= user_b)
+);
+
+CREATE INDEX idx_pinned_messages_conversation ON pinned_messages (user_a, user_b, pinned_at);
+
+-- Starred messages are private bookmarks
+CREATE TABLE starred_messages (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    starred_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, message_id)
+);
+
+CREATE INDEX idx_starred_messages_user ON starred_messages (user_id, starred_at);
@@ -0,0 +1,56 @@
+package integration
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/Mousa96/chatting-service/internal/user/models"
+	userRepository "github.com/Mousa96/chatting-service/internal/user/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserDirectorySearch(t *testing.T) {
+	repo := userRepository.NewPostgresRepository(testDB)
+
+	viewerID, err := strconv.Atoi(setupTestUserAndGetID("directory_viewer", "password123"))
+	require.NoError(t, err)
+	aliceID, err := strconv.Atoi(setupTestUserAndGetID("directory_alice", "password123"))
+	require.NoError(t, err)
+	bobID, err := strconv.Atoi(setupTestUserAndGetID("directory_bob", "password123"))
+	require.NoError(t, err)
+	carolID, err := strconv.Atoi(setupTestUserAndGetID("directory_carol", "password123"))
+	require.NoError(t, err)
+	require.NoError(t, repo.SetUserExternal(bobID, true))
+	require.NoError(t, repo.SetUserSuspended(carolID, true))
+
+	page, err := repo.SearchUsers(models.DirectoryQuery{Query: "directory_", ViewerID: viewerID, Limit: 10})
+	require.NoError(t, err)
+
+	found := make(map[int]models.User)
+	for _, user := range page.Users {
+		found[user.ID] = user
+	}
+	require.Contains(t, found, aliceID)
+	require.Contains(t, found, bobID)
+	assert.NotContains(t, found, viewerID, "the viewer is left out")
+	assert.NotContains(t, found, carolID, "suspended users are left out")
+	assert.Equal(t, "directory_alice", found[aliceID].Username)
+	assert.False(t, found[aliceID].External)
+	assert.True(t, found[bobID].External)
+	assert.Empty(t, page.NextCursor)
+
+	t.Run("pages", func(t *testing.T) {
+		first, err := repo.SearchUsers(models.DirectoryQuery{Query: "directory_", ViewerID: viewerID, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, first.Users, 1)
+		require.NotEmpty(t, first.NextCursor)
+
+		after, err := models.DecodeDirectoryCursor(first.NextCursor)
+		require.NoError(t, err)
+		second, err := repo.SearchUsers(models.DirectoryQuery{Query: "directory_", ViewerID: viewerID, After: after, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, second.Users, 1)
+		assert.NotEqual(t, first.Users[0].ID, second.Users[0].ID)
+	})
+}
@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"mime/multipart"
 
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
 	msgModels "github.com/Mousa96/chatting-service/internal/message/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -89,35 +93,48 @@ func TestMediaUpload(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
-	var response struct {
-		URL string `json:"url"`
-	}
-	err = json.NewDecoder(rr.Body).Decode(&response)
+	var attachment mediaModels.Attachment
+	err = json.NewDecoder(rr.Body).Decode(&attachment)
 	assert.NoError(t, err)
-	assert.Contains(t, response.URL, "uploads/")
+	assert.True(t, strings.HasPrefix(attachment.URL, mediaModels.URLPrefix), attachment.URL)
+	assert.Equal(t, "image/jpeg", attachment.ContentType)
 }
 
 func TestBroadcastMessage(t *testing.T) {
-	// Setup sender and get token
+	// Setup sender and receivers
 	senderToken := setupTestUser("broadcaster", "pass123")
+	var receiverIDs []int
+	for _, username := range []string{"broadcast_rcv1", "broadcast_rcv2", "broadcast_rcv3"} {
+		id, err := strconv.Atoi(setupTestUserAndGetID(username, "pass123"))
+		require.NoError(t, err)
+		receiverIDs = append(receiverIDs, id)
+	}
 
 	// Create broadcast request
 	req := msgModels.BroadcastMessageRequest{
-		ReceiverIDs: []int{2, 3, 4},
+		ReceiverIDs: receiverIDs,
 		Content:     "Hello everyone!",
 	}
 
 	body, err := json.Marshal(req)
 	require.NoError(t, err)
 
-	// Make request
-	httpReq := httptest.NewRequest(http.MethodPost, "/api/messages/broadcast", bytes.NewBuffer(body))
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", senderToken))
+	broadcast := func() *httptest.ResponseRecorder {
+		httpReq := httptest.NewRequest(http.MethodPost, "/api/messages/broadcast", bytes.NewBuffer(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", senderToken))
+		rr := httptest.NewRecorder()
+		testServer.ServeHTTP(rr, httpReq)
+		return rr
+	}
 
-	rr := httptest.NewRecorder()
-	testServer.ServeHTTP(rr, httpReq)
+	// Regular users may not broadcast
+	assert.Equal(t, http.StatusForbidden, broadcast().Code)
 
+	// Moderators may, with the token they already hold
+	_, err = testDB.Exec("UPDATE users SET role = $1 WHERE username = $2", authModels.RoleModerator, "broadcaster")
+	require.NoError(t, err)
+	rr := broadcast()
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	// Verify response
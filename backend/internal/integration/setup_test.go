@@ -7,16 +7,24 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	authHandler "github.com/Mousa96/chatting-service/internal/auth/handler"
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
 	authRepo "github.com/Mousa96/chatting-service/internal/auth/repository"
 	authService "github.com/Mousa96/chatting-service/internal/auth/service"
 	"github.com/Mousa96/chatting-service/internal/db"
+	mediaHandler "github.com/Mousa96/chatting-service/internal/media/handler"
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	mediaRepository "github.com/Mousa96/chatting-service/internal/media/repository"
+	mediaService "github.com/Mousa96/chatting-service/internal/media/service"
 	msgHandler "github.com/Mousa96/chatting-service/internal/message/handler"
 	msgRepo "github.com/Mousa96/chatting-service/internal/message/repository"
 	msgService "github.com/Mousa96/chatting-service/internal/message/service"
 	"github.com/Mousa96/chatting-service/internal/middleware"
 	"github.com/Mousa96/chatting-service/internal/storage"
+	userRepository "github.com/Mousa96/chatting-service/internal/user/repository"
+	userService "github.com/Mousa96/chatting-service/internal/user/service"
 )
 
 var (
@@ -91,10 +99,10 @@ func setupTestServer(db *sql.DB) *http.ServeMux {
 	// Initialize repositories
 	userRepo := authRepo.NewUserRepository(db)
 	messageRepo := msgRepo.NewMessageRepository(db)
+	mediaRepo := mediaRepository.NewMediaRepository(db)
 
 	// Create a test-specific storage path
 	testUploadsDir := "/app/uploads"
-	testPublicPath := "/uploads"
 	
 	// Ensure the directory exists
 	if err := os.MkdirAll(testUploadsDir, 0755); err != nil {
@@ -102,18 +110,22 @@ func setupTestServer(db *sql.DB) *http.ServeMux {
 	}
 	
 	// Initialize storage with test directory
-	fileStorage := storage.NewLocalStorage(testUploadsDir, testPublicPath)
+	fileStorage := storage.NewLocalStorage(testUploadsDir, "/api/media")
 
 	// Initialize services with the same JWT key
 	authSvc := authService.NewAuthService(userRepo, testJWTKey)
-	messageSvc := msgService.NewMessageService(messageRepo, fileStorage)
+	messageSvc := msgService.NewMessageService(messageRepo, fileStorage, msgService.WithAttachmentStore(mediaRepo))
+	mediaSvc := mediaService.NewMediaService(mediaRepo, fileStorage, testJWTKey, time.Minute)
 
 	// Initialize handlers
 	authHdlr := authHandler.NewAuthHandler(authSvc)
 	messageHdlr := msgHandler.NewMessageHandler(messageSvc)
+	mediaHdlr := mediaHandler.NewMediaHandler(mediaSvc)
 
-	// Auth middleware with same JWT key
-	authMiddleware := middleware.AuthMiddleware(testJWTKey)
+	// Auth middleware with same JWT key, checking accounts as in production
+	accounts := userService.NewAccountChecker(userRepository.NewPostgresRepository(db))
+	authMiddleware := middleware.AuthMiddleware(testJWTKey, middleware.WithAccountChecker(accounts))
+	requireBroadcast := middleware.RequirePermission(authModels.PermissionBroadcastMessages)
 
 	// Register routes with exact paths
 	mux.HandleFunc("/api/auth/register", authHdlr.Register)
@@ -121,9 +133,10 @@ func setupTestServer(db *sql.DB) *http.ServeMux {
 	mux.Handle("/api/messages", authMiddleware(http.HandlerFunc(messageHdlr.SendMessage)))
 	mux.Handle("/api/messages/conversation", authMiddleware(http.HandlerFunc(messageHdlr.GetConversation)))
 	mux.Handle("/api/messages/upload", authMiddleware(http.HandlerFunc(messageHdlr.UploadMedia)))
-	mux.Handle("/api/messages/broadcast", authMiddleware(http.HandlerFunc(messageHdlr.BroadcastMessage)))
+	mux.Handle("/api/messages/broadcast", authMiddleware(requireBroadcast(http.HandlerFunc(messageHdlr.BroadcastMessage))))
 	mux.Handle("/api/messages/history", authMiddleware(http.HandlerFunc(messageHdlr.GetMessageHistory)))
 	mux.Handle("/api/messages/status", authMiddleware(http.HandlerFunc(messageHdlr.UpdateMessageStatus)))
+	mux.Handle(mediaModels.URLPrefix, authMiddleware(http.HandlerFunc(mediaHdlr.ServeMedia)))
 
 	return mux
 }
@@ -6,10 +6,10 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
-	"os"
-	"path/filepath"
+	"strings"
 	"testing"
 
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -73,40 +73,56 @@ func TestFileUpload(t *testing.T) {
 			assert.Equal(t, tt.expectedCode, rr.Code)
 
 			if tt.expectedCode == http.StatusOK {
-				var response struct {
-					URL string `json:"url"`
-				}
-				err = json.NewDecoder(rr.Body).Decode(&response)
+				var attachment mediaModels.Attachment
+				err = json.NewDecoder(rr.Body).Decode(&attachment)
 				require.NoError(t, err)
-				assert.Contains(t, response.URL, "uploads/")
+				assert.NotZero(t, attachment.ID)
+				assert.True(t, strings.HasPrefix(attachment.URL, mediaModels.URLPrefix), attachment.URL)
+				assert.Equal(t, "image/jpeg", attachment.ContentType)
 			}
 		})
 	}
 }
 
 func TestFileServing(t *testing.T) {
-	// Create test uploads directory if it doesn't exist
-	uploadDir := "/app/uploads" // Match the directory used in Docker
-	err := os.MkdirAll(uploadDir, 0755)
+	ownerToken := setupTestUser("serveowner", "pass123")
+	otherToken := setupTestUser("servestranger", "pass123")
+	content := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 0x4A, 0x46}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "photo.jpg")
 	require.NoError(t, err)
-	defer os.RemoveAll(uploadDir) // Clean up after test
-	
-	// Create a test file
-	testContent := []byte("test content")
-	filename := "test_serve.txt"
-	uploadPath := filepath.Join(uploadDir, filename)
-	
-	err = os.WriteFile(uploadPath, testContent, 0644)
+	_, err = part.Write(content)
 	require.NoError(t, err)
+	require.NoError(t, writer.Close())
 
-	// Test file serving
-	req := httptest.NewRequest(http.MethodGet, "/uploads/"+filename, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/messages/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
 	rr := httptest.NewRecorder()
-	
-	// Create new file server handler
-	fs := http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadDir)))
-	fs.ServeHTTP(rr, req)
+	testServer.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var attachment mediaModels.Attachment
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&attachment))
+	require.True(t, strings.HasPrefix(attachment.URL, mediaModels.URLPrefix))
+
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, attachment.URL, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		testServer.ServeHTTP(rr, req)
+		return rr
+	}
 
+	rr = serve(ownerToken)
 	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Equal(t, testContent, rr.Body.Bytes())
-} 
\ No newline at end of file
+	assert.Equal(t, content, rr.Body.Bytes())
+	assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
+
+	assert.Equal(t, http.StatusForbidden, serve(otherToken).Code, "uploads are private until sent")
+	assert.Equal(t, http.StatusUnauthorized, serve("").Code)
+}
@@ -0,0 +1,214 @@
+// Package handler implements the HTTP handlers for serving uploaded media
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+)
+
+// downloadTimeout replaces the server's write timeout for file downloads, which may
+// stream far more than the server's timeouts allow for, such as long videos
+const downloadTimeout = 10 * time.Minute
+
+// MediaHandler provides the implementation of the Handler interface
+type MediaHandler struct {
+	mediaService service.Service
+}
+
+// NewMediaHandler creates a new MediaHandler instance
+func NewMediaHandler(mediaService service.Service) Handler {
+	return &MediaHandler{mediaService: mediaService}
+}
+
+// ServeMedia godoc
+// @Summary Download media
+// @Description Download an uploaded file. Only the uploader and participants of a conversation containing the file may read it; avatars are public.
+// @Tags media
+// @Produce octet-stream
+// @Param key path string true "Media key"
+// @Param download query string false "1 to save the file instead of displaying it"
+// @Param Range header string false "Byte range to return, e.g. bytes=0-1023"
+// @Success 200 {file} file "File contents"
+// @Success 206 {file} file "The requested range"
+// @Success 304 {string} string "Not modified since the given ETag or date"
+// @Failure 400 {string} string "Invalid media key"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Not found"
+// @Security Bearer
+// @Router /media/{key} [get]
+func (h *MediaHandler) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	key := keyFromPath(r)
+	if err := h.mediaService.Authorize(userID, key); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	h.deliver(w, r, userID, key)
+}
+
+// ServeAnonymousMedia godoc
+// @Summary Download media through a signed URL
+// @Description Download an uploaded file without an Authorization header, using a URL from /media/sign. Avatars need no signature.
+// @Tags media
+// @Produce octet-stream
+// @Param key path string true "Media key"
+// @Param user query int false "User the URL was signed for"
+// @Param expires query int false "Expiry as a Unix timestamp"
+// @Param signature query string false "URL signature"
+// @Param download query string false "1 to save the file instead of displaying it"
+// @Param Range header string false "Byte range to return, e.g. bytes=0-1023"
+// @Success 200 {file} file "File contents"
+// @Success 206 {file} file "The requested range"
+// @Success 304 {string} string "Not modified since the given ETag or date"
+// @Failure 400 {string} string "Invalid media key"
+// @Failure 401 {string} string "Missing, invalid or expired signature"
+// @Failure 404 {string} string "Not found"
+// @Router /media/{key} [get]
+func (h *MediaHandler) ServeAnonymousMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := keyFromPath(r)
+	var userID int
+	if !models.IsPublic(key) {
+		query := r.URL.Query()
+		signedFor, err := h.mediaService.VerifySignature(key, query.Get("user"), query.Get("expires"), query.Get("signature"))
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		userID = signedFor
+	}
+
+	h.deliver(w, r, userID, key)
+}
+
+// SignURL godoc
+// @Summary Get a signed media URL
+// @Description Issue an expiring URL for a file the current user may read, for use in img and video tags
+// @Tags media
+// @Produce json
+// @Param url query string true "Media URL as stored in the message"
+// @Success 200 {object} models.SignedURL "Signed URL"
+// @Failure 400 {string} string "Invalid media URL"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /media/sign [get]
+func (h *MediaHandler) SignURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	key, ok := models.KeyFromURL(r.URL.Query().Get("url"))
+	if !ok {
+		http.Error(w, "invalid media URL", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mediaService.Authorize(userID, key); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	signed, err := h.mediaService.SignURL(userID, key)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, signed)
+}
+
+// deliver streams a file, answering Range and conditional requests. Images, video and
+// audio are shown inline unless download=1 is given; other files, such as PDFs, are
+// always downloaded so browsers never render them on the service's origin. Files
+// carry the name userID uploaded or received them with.
+func (h *MediaHandler) deliver(w http.ResponseWriter, r *http.Request, userID int, key string) {
+	file, err := h.mediaService.Open(userID, key)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	defer file.Content.Close()
+
+	disposition := "inline"
+	if r.URL.Query().Get("download") == "1" || models.KindOf(file.ContentType) == models.KindFile {
+		disposition = "attachment"
+	}
+	if file.Filename != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": file.Filename})
+	}
+
+	w.Header().Set("Cache-Control", "private")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", disposition)
+	if file.ETag != "" {
+		w.Header().Set("ETag", file.ETag)
+	}
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(downloadTimeout))
+	http.ServeContent(w, r, "", file.ModTime, file.Content)
+}
+
+// keyFromPath extracts the media key from a request path
+func keyFromPath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, models.URLPrefix)
+}
+
+// writeServiceError maps service errors to HTTP responses
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidKey):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidSignature):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, service.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Printf("Media operation failed: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON sends a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
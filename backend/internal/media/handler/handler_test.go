@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/media/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/Mousa96/chatting-service/internal/storage/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const video = "0123456789abcdefghij"
+
+func TestServeMedia(t *testing.T) {
+	server := s3test.NewServer("media")
+	t.Cleanup(server.Close)
+
+	backends := map[string]storage.Storage{
+		"local": storage.NewLocalStorage(t.TempDir(), models.URLPrefix),
+		"s3":    storage.NewS3Storage(server.Client(), "media", models.URLPrefix),
+	}
+	for name, files := range backends {
+		t.Run(name, func(t *testing.T) {
+			_, err := files.Upload("1_clip.mp4", strings.NewReader(video), "video/mp4")
+			require.NoError(t, err)
+			repo := repository.NewTestMediaRepository()
+			require.NoError(t, repo.CreateAttachment(&models.Attachment{
+				OwnerID: 1, Key: "1_clip.mp4", ContentType: "video/mp4", Filename: "holiday video.mp4",
+			}))
+			handler := NewMediaHandler(service.NewMediaService(repo, files, []byte("secret"), time.Minute))
+
+			serve := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, target, nil)
+				for name, value := range headers {
+					req.Header.Set(name, value)
+				}
+				req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+				rec := httptest.NewRecorder()
+				handler.ServeMedia(rec, req)
+				return rec
+			}
+
+			rec := serve(http.MethodGet, "/api/media/1_clip.mp4", nil)
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, video, rec.Body.String())
+			assert.Equal(t, "video/mp4", rec.Header().Get("Content-Type"))
+			assert.Equal(t, `inline; filename="holiday video.mp4"`, rec.Header().Get("Content-Disposition"))
+			assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+			assert.NotEmpty(t, rec.Header().Get("Last-Modified"))
+			etag := rec.Header().Get("ETag")
+			require.NotEmpty(t, etag)
+
+			t.Run("range", func(t *testing.T) {
+				rec := serve(http.MethodGet, "/api/media/1_clip.mp4", map[string]string{"Range": "bytes=5-9"})
+				require.Equal(t, http.StatusPartialContent, rec.Code)
+				assert.Equal(t, "56789", rec.Body.String())
+				assert.Equal(t, "bytes 5-9/20", rec.Header().Get("Content-Range"))
+
+				rec = serve(http.MethodGet, "/api/media/1_clip.mp4", map[string]string{"Range": "bytes=-3"})
+				require.Equal(t, http.StatusPartialContent, rec.Code)
+				assert.Equal(t, "hij", rec.Body.String())
+
+				rec = serve(http.MethodGet, "/api/media/1_clip.mp4", map[string]string{"Range": "bytes=30-"})
+				assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+			})
+
+			t.Run("conditional", func(t *testing.T) {
+				rec := serve(http.MethodGet, "/api/media/1_clip.mp4", map[string]string{"If-None-Match": etag})
+				assert.Equal(t, http.StatusNotModified, rec.Code)
+				assert.Empty(t, rec.Body.String())
+
+				// A changed file is sent whole instead of the requested range
+				rec = serve(http.MethodGet, "/api/media/1_clip.mp4", map[string]string{"Range": "bytes=0-1", "If-Range": `"stale"`})
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, video, rec.Body.String())
+			})
+
+			t.Run("head", func(t *testing.T) {
+				rec := serve(http.MethodHead, "/api/media/1_clip.mp4", nil)
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "20", rec.Header().Get("Content-Length"))
+				assert.Empty(t, rec.Body.String())
+			})
+
+			t.Run("download", func(t *testing.T) {
+				rec := serve(http.MethodGet, "/api/media/1_clip.mp4?download=1", nil)
+				assert.Equal(t, `attachment; filename="holiday video.mp4"`, rec.Header().Get("Content-Disposition"))
+			})
+
+			t.Run("documents are downloaded", func(t *testing.T) {
+				_, err := files.Upload("1_notes.pdf", strings.NewReader("%PDF-1.7"), "application/pdf")
+				require.NoError(t, err)
+				require.NoError(t, repo.CreateAttachment(&models.Attachment{
+					OwnerID: 1, Key: "1_notes.pdf", ContentType: "application/pdf", Filename: "notes.pdf",
+				}))
+				rec := serve(http.MethodGet, "/api/media/1_notes.pdf", nil)
+				require.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+				assert.Equal(t, `attachment; filename=notes.pdf`, rec.Header().Get("Content-Disposition"))
+			})
+
+			t.Run("missing", func(t *testing.T) {
+				rec := serve(http.MethodGet, "/api/media/1_gone.mp4", nil)
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			})
+		})
+	}
+}
+
+func TestSignedURLCarriesSignersFilename(t *testing.T) {
+	files := storage.NewLocalStorage(t.TempDir(), models.URLPrefix)
+	_, err := files.Upload("blobs/abc.pdf", strings.NewReader("%PDF-1.7"), "application/pdf")
+	require.NoError(t, err)
+	repo := repository.NewTestMediaRepository()
+	// Two users uploaded the same document, which is stored once
+	require.NoError(t, repo.CreateAttachment(&models.Attachment{
+		OwnerID: 1, Key: "blobs/abc.pdf", ContentType: "application/pdf", Filename: "contract.pdf",
+	}))
+	require.NoError(t, repo.CreateAttachment(&models.Attachment{
+		OwnerID: 2, Key: "blobs/abc.pdf", ContentType: "application/pdf", Filename: "payslip.pdf",
+	}))
+	handler := NewMediaHandler(service.NewMediaService(repo, files, []byte("secret"), time.Minute))
+
+	download := func(userID int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/media/sign?url=/api/media/blobs/abc.pdf", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+		rec := httptest.NewRecorder()
+		handler.SignURL(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var signed models.SignedURL
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&signed))
+
+		rec = httptest.NewRecorder()
+		handler.ServeAnonymousMedia(rec, httptest.NewRequest(http.MethodGet, signed.URL, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec
+	}
+
+	assert.Equal(t, "attachment; filename=contract.pdf", download(1).Header().Get("Content-Disposition"))
+	assert.Equal(t, "attachment; filename=payslip.pdf", download(2).Header().Get("Content-Disposition"))
+}
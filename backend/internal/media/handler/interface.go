@@ -0,0 +1,14 @@
+// Package handler provides HTTP handlers for serving uploaded media
+package handler
+
+import "net/http"
+
+// Handler defines the media handling interface
+type Handler interface {
+	// ServeMedia serves a file to an authenticated user allowed to read it
+	ServeMedia(w http.ResponseWriter, r *http.Request)
+	// ServeAnonymousMedia serves a public file or a file requested through a signed URL
+	ServeAnonymousMedia(w http.ResponseWriter, r *http.Request)
+	// SignURL issues an expiring URL for a file the current user may read
+	SignURL(w http.ResponseWriter, r *http.Request)
+}
@@ -0,0 +1,105 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// maxSourcePixels refuses images whose decoded size would exhaust memory
+const maxSourcePixels = 50_000_000
+
+var (
+	// ErrUndecodable is returned for files that claim to be images but cannot be decoded
+	ErrUndecodable = errors.New("image could not be decoded")
+	// ErrTooLarge is returned for images that are too large to process
+	ErrTooLarge = errors.New("image dimensions are too large")
+)
+
+// Sanitizer re-encodes uploaded images so that no metadata such as GPS coordinates or
+// camera details survives, applying the EXIF orientation and a size limit on the way
+type Sanitizer struct {
+	maxDimension int
+	jpegQuality  int
+}
+
+// NewSanitizer creates a Sanitizer that scales images down so neither side exceeds
+// maxDimension and writes JPEGs at jpegQuality
+func NewSanitizer(maxDimension, jpegQuality int) *Sanitizer {
+	return &Sanitizer{maxDimension: maxDimension, jpegQuality: jpegQuality}
+}
+
+// Sanitize returns a clean copy of a JPEG, PNG or GIF image in the same format. Other
+// content types are returned unchanged with ok set to false. GIFs keep their frames and
+// are refused when larger than the limit, since animations cannot be scaled here.
+func (s *Sanitizer) Sanitize(content io.Reader, contentType string) (clean []byte, ok bool, err error) {
+	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/gif" {
+		return nil, false, nil
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, ErrUndecodable
+	}
+	if config.Width*config.Height > maxSourcePixels {
+		return nil, false, ErrTooLarge
+	}
+
+	var out bytes.Buffer
+	switch contentType {
+	case "image/gif":
+		err = s.sanitizeGIF(data, &out)
+	case "image/jpeg":
+		err = s.sanitizeStill(data, JPEGOrientation(data), &out, func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: s.jpegQuality})
+		})
+	case "image/png":
+		err = s.sanitizeStill(data, 1, &out, png.Encode)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return out.Bytes(), true, nil
+}
+
+// sanitizeStill decodes a single-frame image, orients and bounds it, and re-encodes it
+func (s *Sanitizer) sanitizeStill(data []byte, orientation int, out io.Writer, encode func(io.Writer, image.Image) error) error {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ErrUndecodable
+	}
+	rgba := Orient(ToRGBA(img), orientation)
+	w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	if tw, th := Fit(w, h, s.maxDimension); tw != w || th != h {
+		rgba = Downscale(rgba, tw, th)
+	}
+	if err := encode(out, rgba); err != nil {
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	return nil
+}
+
+// sanitizeGIF rewrites a GIF from its decoded frames, dropping comments and application
+// extensions other than the loop count
+func (s *Sanitizer) sanitizeGIF(data []byte, out io.Writer) error {
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return ErrUndecodable
+	}
+	if animation.Config.Width > s.maxDimension || animation.Config.Height > s.maxDimension {
+		return ErrTooLarge
+	}
+	if err := gif.EncodeAll(out, animation); err != nil {
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+	return nil
+}
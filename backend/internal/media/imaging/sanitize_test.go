@@ -0,0 +1,182 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exifSegment builds an APP1 segment holding a little-endian IFD with the given
+// orientation and a camera model string that must not survive sanitizing
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	// Orientation, SHORT, count 1
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientationTag)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)
+	// Model, ASCII, stored after the IFD
+	model := "SecretCam\x00"
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0110)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	tiff = binary.LittleEndian.AppendUint32(tiff, uint32(len(model)))
+	tiff = binary.LittleEndian.AppendUint32(tiff, uint32(8+2+2*12+4))
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	tiff = append(tiff, model...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// jpegWithExif encodes img and inserts an EXIF segment after the start-of-image marker
+func jpegWithExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, exifSegment(orientation)...)
+	return append(out, data[2:]...)
+}
+
+// leftRed is a landscape image whose left half is red and right half is blue
+func leftRed(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{B: 255, A: 255}
+			if x < w/2 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	img := leftRed(8, 4)
+	assert.Equal(t, 6, JPEGOrientation(jpegWithExif(t, img, 6)))
+	assert.Equal(t, 1, JPEGOrientation(jpegWithExif(t, img, 42)), "out of range values are ignored")
+
+	var plain bytes.Buffer
+	require.NoError(t, jpeg.Encode(&plain, img, nil))
+	assert.Equal(t, 1, JPEGOrientation(plain.Bytes()))
+	assert.Equal(t, 1, JPEGOrientation([]byte("not a jpeg")))
+
+	truncated := jpegWithExif(t, img, 6)[:20]
+	assert.Equal(t, 1, JPEGOrientation(truncated))
+}
+
+func TestOrient(t *testing.T) {
+	img := leftRed(4, 2)
+	red := color.RGBA{R: 255, A: 255}
+
+	tests := []struct {
+		orientation int
+		w, h        int
+		// redX, redY is a pixel that must be red after orienting
+		redX, redY int
+	}{
+		{orientation: 1, w: 4, h: 2, redX: 0, redY: 0},
+		{orientation: 2, w: 4, h: 2, redX: 3, redY: 0},
+		{orientation: 3, w: 4, h: 2, redX: 3, redY: 1},
+		{orientation: 4, w: 4, h: 2, redX: 0, redY: 1},
+		{orientation: 5, w: 2, h: 4, redX: 0, redY: 0},
+		{orientation: 6, w: 2, h: 4, redX: 1, redY: 0},
+		{orientation: 7, w: 2, h: 4, redX: 1, redY: 3},
+		{orientation: 8, w: 2, h: 4, redX: 0, redY: 3},
+	}
+	for _, tt := range tests {
+		out := Orient(img, tt.orientation)
+		assert.Equal(t, tt.w, out.Bounds().Dx(), "orientation %d", tt.orientation)
+		assert.Equal(t, tt.h, out.Bounds().Dy(), "orientation %d", tt.orientation)
+		assert.Equal(t, red, out.RGBAAt(tt.redX, tt.redY), "orientation %d", tt.orientation)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	sanitizer := NewSanitizer(100, 90)
+
+	t.Run("jpeg loses exif and is rotated", func(t *testing.T) {
+		data := jpegWithExif(t, leftRed(40, 20), 6)
+		require.Contains(t, string(data), "SecretCam")
+
+		clean, ok, err := sanitizer.Sanitize(bytes.NewReader(data), "image/jpeg")
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.NotContains(t, string(clean), "SecretCam")
+		assert.NotContains(t, string(clean), "Exif")
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(clean))
+		require.NoError(t, err)
+		assert.Equal(t, 20, config.Width)
+		assert.Equal(t, 40, config.Height)
+	})
+
+	t.Run("large png is scaled down", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, leftRed(400, 200)))
+
+		clean, ok, err := sanitizer.Sanitize(&buf, "image/png")
+		require.NoError(t, err)
+		require.True(t, ok)
+		config, err := png.DecodeConfig(bytes.NewReader(clean))
+		require.NoError(t, err)
+		assert.Equal(t, 100, config.Width)
+		assert.Equal(t, 50, config.Height)
+	})
+
+	t.Run("gif keeps its frames", func(t *testing.T) {
+		palette := color.Palette{color.Black, color.White}
+		animation := &gif.GIF{
+			Image: []*image.Paletted{
+				image.NewPaletted(image.Rect(0, 0, 10, 10), palette),
+				image.NewPaletted(image.Rect(0, 0, 10, 10), palette),
+			},
+			Delay: []int{10, 10},
+		}
+		var buf bytes.Buffer
+		require.NoError(t, gif.EncodeAll(&buf, animation))
+
+		clean, ok, err := sanitizer.Sanitize(&buf, "image/gif")
+		require.NoError(t, err)
+		require.True(t, ok)
+		decoded, err := gif.DecodeAll(bytes.NewReader(clean))
+		require.NoError(t, err)
+		assert.Len(t, decoded.Image, 2)
+	})
+
+	t.Run("oversized gif is refused", func(t *testing.T) {
+		var buf bytes.Buffer
+		frame := image.NewPaletted(image.Rect(0, 0, 200, 10), color.Palette{color.Black})
+		require.NoError(t, gif.Encode(&buf, frame, nil))
+		_, _, err := sanitizer.Sanitize(&buf, "image/gif")
+		assert.ErrorIs(t, err, ErrTooLarge)
+	})
+
+	t.Run("undecodable image", func(t *testing.T) {
+		_, _, err := sanitizer.Sanitize(strings.NewReader("\xff\xd8\xffgarbage"), "image/jpeg")
+		assert.ErrorIs(t, err, ErrUndecodable)
+	})
+
+	t.Run("other types are left alone", func(t *testing.T) {
+		clean, ok, err := sanitizer.Sanitize(strings.NewReader("%PDF-1.4"), "application/pdf")
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Nil(t, clean)
+	})
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Variants are stored as JPEG next to the original, e.g. "1_ab12.png~thumb_320.jpg"
+const (
+	variantSeparator = "~"
+	variantExt       = ".jpg"
+)
+
+// Kind tells clients how to render an attachment
+type Kind string
+
+const (
+	KindImage Kind = "image"
+	KindVideo Kind = "video"
+	KindAudio Kind = "audio"
+	// KindFile attachments cannot be previewed and are shown by name and size
+	KindFile Kind = "file"
+)
+
+// KindOf returns the kind of attachment files of contentType are rendered as
+func KindOf(contentType string) Kind {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return KindImage
+	case strings.HasPrefix(contentType, "video/"):
+		return KindVideo
+	case strings.HasPrefix(contentType, "audio/"):
+		return KindAudio
+	}
+	return KindFile
+}
+
+// Attachment describes an uploaded file. Messages reference attachments by ID.
+type Attachment struct {
+	ID      int `json:"id"`
+	OwnerID int `json:"owner_id"`
+	// Key is the storage key; clients use URL instead
+	Key         string `json:"-"`
+	URL         string `json:"url"`
+	Kind        Kind   `json:"kind"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// SHA256 is the hex checksum of the content, empty for files uploaded before it was recorded
+	SHA256   string `json:"sha256,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	// Width and Height are set for images and videos, in pixels
+	Width  *int `json:"width,omitempty"`
+	Height *int `json:"height,omitempty"`
+	// DurationMs is set for audio and video
+	DurationMs *int `json:"duration_ms,omitempty"`
+	// Waveform holds peaks from 0 to 100 for drawing audio, evenly spaced over its length
+	Waveform []int `json:"waveform,omitempty"`
+	// Blurhash is a compact placeholder to show while the file or a thumbnail loads
+	Blurhash   string    `json:"blurhash,omitempty"`
+	Variants   []Variant `json:"variants,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// Variant is a derived rendition of an attachment, such as a thumbnail or a video's
+// poster frame
+type Variant struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+}
+
+// Previews holds the placeholder and variants generated for an upload
+type Previews struct {
+	Blurhash string
+	Variants []Variant
+	// Waveform holds the peaks of an audio file, from 0 to 100
+	Waveform []int
+	// DurationMs is the length of audio measured while decoding it, for containers
+	// that do not record it
+	DurationMs *int
+}
+
+// VariantKey returns the storage key of a variant of the file stored under key.
+// Variant keys extend the original key so access checks can map them back with BaseKey.
+func VariantKey(key, name string) string {
+	return key + variantSeparator + name + variantExt
+}
+
+// BaseKey returns the key of the original file for a variant key, or key itself
+func BaseKey(key string) string {
+	if !strings.HasSuffix(key, variantExt) {
+		return key
+	}
+	trimmed := strings.TrimSuffix(key, variantExt)
+	i := strings.LastIndex(trimmed, variantSeparator)
+	if i <= 0 {
+		return key
+	}
+	return trimmed[:i]
+}
@@ -0,0 +1,38 @@
+package models
+
+// Reasons a file was collected
+const (
+	// ReasonUnattached is an upload that was never sent in a message, or whose
+	// messages were all deleted
+	ReasonUnattached = "unattached"
+	// ReasonUnreferencedBlob is a shared file no attachment uses any more
+	ReasonUnreferencedBlob = "unreferenced_blob"
+	// ReasonUntracked is a stored file nothing in the database refers to
+	ReasonUntracked = "untracked"
+)
+
+// CollectedFile is a file removed by garbage collection, or that would be in a dry run
+type CollectedFile struct {
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+	// AttachmentID is set for unattached uploads
+	AttachmentID int `json:"attachment_id,omitempty"`
+}
+
+// CollectionReport describes a garbage collection run
+type CollectionReport struct {
+	// DryRun is set when nothing was deleted and Removed lists what would have been
+	DryRun  bool            `json:"dry_run"`
+	Removed []CollectedFile `json:"removed"`
+	// RemovedBytes is the total size of the removed files
+	RemovedBytes int64 `json:"removed_bytes"`
+	// Failed counts files that could not be removed; they are tried again on the next run
+	Failed int `json:"failed"`
+}
+
+// Add records a removed file
+func (r *CollectionReport) Add(file CollectedFile) {
+	r.Removed = append(r.Removed, file)
+	r.RemovedBytes += file.Size
+}
@@ -0,0 +1,80 @@
+// Package models defines the data structures for serving uploaded media
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLPrefix is the path under which uploaded media is served. Stored media URLs are
+// URLPrefix followed by the storage key.
+const URLPrefix = "/api/media/"
+
+// publicPrefix holds files anyone may read, such as avatars shown in the user directory
+const publicPrefix = "avatars/"
+
+// SignedURL is an expiring URL that can be fetched without an Authorization header
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewKey returns an unguessable storage key for a file uploaded by userID.
+// The extension, if any, must include its leading dot.
+func NewKey(userID int, ext string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate media key: %w", err)
+	}
+	return fmt.Sprintf("%d_%s%s", userID, hex.EncodeToString(buf), strings.ToLower(ext)), nil
+}
+
+// URLForKey returns the URL under which a storage key is served
+func URLForKey(key string) string {
+	return URLPrefix + key
+}
+
+// KeyFromURL extracts the storage key from a media URL and reports whether the URL
+// refers to media served by this application
+func KeyFromURL(url string) (string, bool) {
+	if !strings.HasPrefix(url, URLPrefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(url, URLPrefix)
+	return key, ValidKey(key)
+}
+
+// ValidKey rejects empty keys and keys that could escape the storage root
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// OwnerID returns the ID of the user who uploaded the file stored under key
+func OwnerID(key string) (int, bool) {
+	prefix, _, found := strings.Cut(key, "_")
+	if !found || strings.Contains(prefix, "/") {
+		return 0, false
+	}
+	id, err := strconv.Atoi(prefix)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// IsPublic reports whether the file stored under key may be read by anyone
+func IsPublic(key string) bool {
+	return strings.HasPrefix(key, publicPrefix)
+}
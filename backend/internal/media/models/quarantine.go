@@ -0,0 +1,28 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// QuarantinePrefix holds uploads a malware scanner found suspicious, which only
+// administrators can read
+const QuarantinePrefix = "quarantine/"
+
+// IsQuarantined reports whether the file stored under key is held for review
+func IsQuarantined(key string) bool {
+	return strings.HasPrefix(key, QuarantinePrefix)
+}
+
+// QuarantinedFile is a suspicious upload held for an administrator to review
+type QuarantinedFile struct {
+	ID          int    `json:"id"`
+	OwnerID     int    `json:"owner_id"`
+	Key         string `json:"key"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// Signature is what the scanner matched
+	Signature     string    `json:"signature"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
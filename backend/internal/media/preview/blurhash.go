@@ -0,0 +1,108 @@
+package preview
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// Blurhash component counts; 4x3 suits the landscape photos most chats carry
+const (
+	blurhashX = 4
+	blurhashY = 3
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// encodeBlurhash computes the blurhash (https://blurha.sh) of img. Callers pass a small
+// thumbnail since the cost grows with the pixel count.
+func encodeBlurhash(img *image.RGBA) string {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	factors := make([][3]float64, 0, blurhashX*blurhashY)
+	for j := 0; j < blurhashY; j++ {
+		for i := 0; i < blurhashX; i++ {
+			factors = append(factors, basisFactor(img, w, h, i, j))
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((blurhashX-1)+(blurhashY-1)*9, 1))
+
+	maximum := 1.0
+	if len(factors) > 1 {
+		actual := 0.0
+		for _, factor := range factors[1:] {
+			for _, c := range factor {
+				actual = math.Max(actual, math.Abs(c))
+			}
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		hash.WriteString(encode83(quantised, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, ac := range factors[1:] {
+		hash.WriteString(encode83(encodeAC(ac, maximum), 2))
+	}
+	return hash.String()
+}
+
+// basisFactor projects the image onto the cosine basis function (i, j)
+func basisFactor(img *image.RGBA, w, h, i, j int) [3]float64 {
+	var r, g, b float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			basis := math.Cos(math.Pi*float64(i*x)/float64(w)) * math.Cos(math.Pi*float64(j*y)/float64(h))
+			p := img.Pix[y*img.Stride+x*4:]
+			r += basis * sRGBToLinear(p[0])
+			g += basis * sRGBToLinear(p[1])
+			b += basis * sRGBToLinear(p[2])
+		}
+	}
+	normalisation := 2.0
+	if i == 0 && j == 0 {
+		normalisation = 1
+	}
+	scale := normalisation / float64(w*h)
+	return [3]float64{r * scale, g * scale, b * scale}
+}
+
+func encodeAC(value [3]float64, maximum float64) int {
+	quant := func(v float64) int {
+		return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+	}
+	return quant(value[0])*19*19 + quant(value[1])*19 + quant(value[2])
+}
+
+func encode83(value, length int) string {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = base83Chars[value%83]
+		value /= 83
+	}
+	return string(out)
+}
+
+func sRGBToLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	c := math.Max(0, math.Min(1, v))
+	if c <= 0.0031308 {
+		return int(c*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(c, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
@@ -0,0 +1,66 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// frameTimeout bounds how long ffmpeg may spend extracting a poster frame
+const frameTimeout = 15 * time.Second
+
+// FrameExtractor reads a still frame from a video
+type FrameExtractor interface {
+	PosterFrame(video io.Reader) (image.Image, error)
+}
+
+// FFmpegFrames extracts poster frames by running ffmpeg
+type FFmpegFrames struct {
+	path string
+}
+
+// NewFFmpegFrames returns a FrameExtractor using the ffmpeg binary at path
+func NewFFmpegFrames(path string) *FFmpegFrames {
+	return &FFmpegFrames{path: path}
+}
+
+// PosterFrame returns the first frame of a video. The video is written to a temporary
+// file because MP4 files often keep their index at the end, which ffmpeg cannot seek to
+// on a pipe.
+func (f *FFmpegFrames) PosterFrame(video io.Reader) (image.Image, error) {
+	tmp, err := os.CreateTemp("", "poster-*.mp4")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, video); err != nil {
+		return nil, fmt.Errorf("failed to buffer video: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), frameTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.path,
+		"-hide_banner", "-loglevel", "error",
+		"-i", tmp.Name(),
+		"-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "pipe:1")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	frame, err := png.Decode(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode poster frame: %w", err)
+	}
+	return frame, nil
+}
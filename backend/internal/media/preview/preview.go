@@ -0,0 +1,165 @@
+// Package preview generates thumbnails, poster frames and blurhash placeholders for uploads
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	// Register the decoders used by image.Decode
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/Mousa96/chatting-service/internal/media/imaging"
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/storage"
+)
+
+const (
+	// jpegQuality is used for thumbnails and poster frames
+	jpegQuality = 80
+	// blurhashSize is the longer side of the image the blurhash is computed from
+	blurhashSize = 32
+	// posterName names the full-size poster frame variant of a video
+	posterName = "poster"
+)
+
+// Generator creates preview variants and stores them next to the original upload
+type Generator struct {
+	storage storage.Storage
+	sizes   []int
+	frames  FrameExtractor
+	audio   AudioDecoder
+}
+
+// Option configures optional Generator dependencies
+type Option func(*Generator)
+
+// WithFrameExtractor enables poster frames and thumbnails for MP4 videos
+func WithFrameExtractor(frames FrameExtractor) Option {
+	return func(g *Generator) {
+		g.frames = frames
+	}
+}
+
+// NewGenerator creates a Generator producing thumbnails whose longer side is each of sizes
+func NewGenerator(storage storage.Storage, sizes []int, opts ...Option) *Generator {
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+	g := &Generator{storage: storage, sizes: sorted}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// decodable lists the image types with a registered decoder
+var decodable = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Generate creates previews for the file stored under key. Audio gets a waveform
+// instead of images, and other files without a visual representation yield nil
+// previews. Thumbnails are only made for sizes smaller than
+// the source, so small images are shown as they are.
+func (g *Generator) Generate(key, contentType string, content io.Reader) (*models.Previews, error) {
+	var source image.Image
+	var previews models.Previews
+
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		// Formats without a decoder, such as WebP, are shown by browsers as they are
+		if !decodable[contentType] {
+			return nil, nil
+		}
+		img, _, err := image.Decode(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		source = img
+	case contentType == "video/mp4" && g.frames != nil:
+		frame, err := g.frames.PosterFrame(content)
+		if err != nil {
+			return nil, err
+		}
+		source = frame
+	case strings.HasPrefix(contentType, "audio/") && g.audio != nil:
+		return g.generateWaveform(content)
+	default:
+		return nil, nil
+	}
+
+	flat := imaging.Flatten(source)
+	w, h := flat.Bounds().Dx(), flat.Bounds().Dy()
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("image has no pixels")
+	}
+
+	if !strings.HasPrefix(contentType, "image/") {
+		variant, err := g.store(key, posterName, flat)
+		if err != nil {
+			return nil, err
+		}
+		previews.Variants = append(previews.Variants, *variant)
+	}
+
+	for _, size := range g.sizes {
+		if size >= w && size >= h {
+			break
+		}
+		tw, th := imaging.Fit(w, h, size)
+		variant, err := g.store(key, "thumb_"+strconv.Itoa(size), imaging.Downscale(flat, tw, th))
+		if err != nil {
+			g.Remove(previews.Variants)
+			return nil, err
+		}
+		previews.Variants = append(previews.Variants, *variant)
+	}
+
+	bw, bh := imaging.Fit(w, h, blurhashSize)
+	previews.Blurhash = encodeBlurhash(imaging.Downscale(flat, bw, bh))
+	return &previews, nil
+}
+
+// store encodes img as JPEG and uploads it as the named variant of key
+func (g *Generator) store(key, name string, img *image.RGBA) (*models.Variant, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	size := int64(buf.Len())
+
+	variantKey := models.VariantKey(key, name)
+	if _, err := g.storage.Upload(variantKey, &buf, "image/jpeg"); err != nil {
+		return nil, fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	return &models.Variant{
+		Name:        name,
+		URL:         models.URLForKey(variantKey),
+		ContentType: "image/jpeg",
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Size:        size,
+	}, nil
+}
+
+// Remove deletes stored variants, e.g. when their attachment could not be saved
+func (g *Generator) Remove(variants []models.Variant) {
+	for _, variant := range variants {
+		key, ok := models.KeyFromURL(variant.URL)
+		if !ok {
+			continue
+		}
+		if err := g.storage.Delete(key); err != nil {
+			log.Printf("Failed to delete preview %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStorage keeps uploaded files in memory
+type memoryStorage struct {
+	files   map[string][]byte
+	failOn  string
+	deleted []string
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{files: make(map[string][]byte)}
+}
+
+func (s *memoryStorage) Upload(filename string, content io.Reader, contentType string) (string, error) {
+	if s.failOn != "" && strings.Contains(filename, s.failOn) {
+		return "", errors.New("disk full")
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", err
+	}
+	s.files[filename] = data
+	return "/api/media/" + filename, nil
+}
+
+func (s *memoryStorage) Delete(filename string) error {
+	delete(s.files, filename)
+	s.deleted = append(s.deleted, filename)
+	return nil
+}
+
+// stubFrames returns a fixed poster frame
+type stubFrames struct {
+	frame image.Image
+	err   error
+}
+
+func (f stubFrames) PosterFrame(video io.Reader) (image.Image, error) {
+	return f.frame, f.err
+}
+
+func encodePNG(t *testing.T, img image.Image) *bytes.Reader {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return bytes.NewReader(buf.Bytes())
+}
+
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestGenerateImageThumbnails(t *testing.T) {
+	store := newMemoryStorage()
+	generator := NewGenerator(store, []int{640, 160, 320, 2000})
+
+	previews, err := generator.Generate("1_abc.png", "image/png", encodePNG(t, solid(1000, 500, color.RGBA{R: 200, A: 255})))
+	require.NoError(t, err)
+	require.NotNil(t, previews)
+
+	require.Len(t, previews.Variants, 3)
+	for i, want := range []struct {
+		name string
+		w, h int
+	}{{"thumb_160", 160, 80}, {"thumb_320", 320, 160}, {"thumb_640", 640, 320}} {
+		variant := previews.Variants[i]
+		assert.Equal(t, want.name, variant.Name)
+		assert.Equal(t, want.w, variant.Width)
+		assert.Equal(t, want.h, variant.Height)
+		assert.Equal(t, "image/jpeg", variant.ContentType)
+		assert.Equal(t, "/api/media/1_abc.png~"+want.name+".jpg", variant.URL)
+
+		stored := store.files[models.VariantKey("1_abc.png", want.name)]
+		assert.Equal(t, int64(len(stored)), variant.Size)
+		config, err := jpeg.DecodeConfig(bytes.NewReader(stored))
+		require.NoError(t, err)
+		assert.Equal(t, want.w, config.Width)
+	}
+	assert.Len(t, previews.Blurhash, 28)
+}
+
+func TestGenerateSmallImage(t *testing.T) {
+	store := newMemoryStorage()
+	previews, err := NewGenerator(store, []int{160}).Generate("1_abc.png", "image/png", encodePNG(t, solid(100, 60, color.White)))
+	require.NoError(t, err)
+	assert.Empty(t, previews.Variants)
+	assert.NotEmpty(t, previews.Blurhash)
+	assert.Empty(t, store.files)
+}
+
+func TestGenerateVideoPoster(t *testing.T) {
+	store := newMemoryStorage()
+	generator := NewGenerator(store, []int{160}, WithFrameExtractor(stubFrames{frame: solid(320, 240, color.Black)}))
+
+	previews, err := generator.Generate("1_abc.mp4", "video/mp4", bytes.NewReader([]byte("video")))
+	require.NoError(t, err)
+	require.Len(t, previews.Variants, 2)
+	assert.Equal(t, "poster", previews.Variants[0].Name)
+	assert.Equal(t, 320, previews.Variants[0].Width)
+	assert.Equal(t, "thumb_160", previews.Variants[1].Name)
+	assert.Equal(t, 120, previews.Variants[1].Height)
+
+	_, err = NewGenerator(store, []int{160}, WithFrameExtractor(stubFrames{err: errors.New("no video stream")})).
+		Generate("1_abc.mp4", "video/mp4", bytes.NewReader(nil))
+	assert.Error(t, err)
+}
+
+func TestGenerateWithoutPreviews(t *testing.T) {
+	generator := NewGenerator(newMemoryStorage(), []int{160})
+
+	previews, err := generator.Generate("1_abc.mp4", "video/mp4", bytes.NewReader([]byte("video")))
+	assert.NoError(t, err)
+	assert.Nil(t, previews)
+
+	previews, err = generator.Generate("1_abc.pdf", "application/pdf", bytes.NewReader([]byte("%PDF")))
+	assert.NoError(t, err)
+	assert.Nil(t, previews)
+
+	previews, err = generator.Generate("1_abc.webp", "image/webp", bytes.NewReader([]byte("RIFF\x24\x00\x00\x00WEBPVP8 ")))
+	assert.NoError(t, err)
+	assert.Nil(t, previews)
+
+	_, err = generator.Generate("1_abc.png", "image/png", bytes.NewReader([]byte("not a png")))
+	assert.Error(t, err)
+}
+
+func TestGenerateCleansUpOnFailure(t *testing.T) {
+	store := newMemoryStorage()
+	store.failOn = "thumb_320"
+	_, err := NewGenerator(store, []int{160, 320}).Generate("1_abc.png", "image/png", encodePNG(t, solid(800, 800, color.White)))
+	require.Error(t, err)
+	assert.Equal(t, []string{models.VariantKey("1_abc.png", "thumb_160")}, store.deleted)
+	assert.Empty(t, store.files)
+}
+
+func TestBlurhashSolidColour(t *testing.T) {
+	hash := encodeBlurhash(solid(8, 6, color.RGBA{R: 255, G: 128, B: 0, A: 255}))
+	require.Len(t, hash, 28)
+	// Size flag for 4x3 components, then the AC maximum, then the average colour
+	assert.Equal(t, byte('L'), hash[0])
+	dc := 0
+	for _, c := range hash[2:6] {
+		dc = dc*83 + strings.IndexRune(base83Chars, c)
+	}
+	assert.Equal(t, 255<<16|128<<8|0, dc)
+}
+
+// stubAudio decodes to fixed samples, written a few bytes at a time like a pipe would
+type stubAudio struct {
+	samples []int16
+	err     error
+}
+
+func (a stubAudio) Decode(audio io.Reader, rate int, pcm io.Writer) error {
+	if a.err != nil {
+		return a.err
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, a.samples); err != nil {
+		return err
+	}
+	for data := buf.Bytes(); len(data) > 0; {
+		n := 333
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := pcm.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func TestGenerateWaveform(t *testing.T) {
+	// Two seconds of silence followed by two seconds getting louder
+	samples := make([]int16, 4*waveformRate)
+	for i := 2 * waveformRate; i < len(samples); i++ {
+		amplitude := int16((i - 2*waveformRate) / 2)
+		if i%2 == 0 {
+			amplitude = -amplitude
+		}
+		samples[i] = amplitude
+	}
+	store := newMemoryStorage()
+	generator := NewGenerator(store, []int{160}, WithAudioDecoder(stubAudio{samples: samples}))
+
+	previews, err := generator.Generate("1_abc.ogg", "audio/ogg", bytes.NewReader([]byte("OggS")))
+	require.NoError(t, err)
+	require.NotNil(t, previews)
+	require.NotNil(t, previews.DurationMs)
+	assert.Equal(t, 4000, *previews.DurationMs)
+	require.Len(t, previews.Waveform, WaveformBars)
+	assert.Zero(t, previews.Waveform[0])
+	assert.Zero(t, previews.Waveform[WaveformBars/2-1])
+	assert.Equal(t, WaveformMax, previews.Waveform[WaveformBars-1])
+	assert.Less(t, previews.Waveform[WaveformBars/2+1], previews.Waveform[WaveformBars-2])
+	assert.Empty(t, previews.Variants)
+	assert.Empty(t, store.files)
+
+	// Short clips get one bar per measured window
+	generator = NewGenerator(store, nil, WithAudioDecoder(stubAudio{samples: []int16{100, -200, 50}}))
+	previews, err = generator.Generate("1_abc.webm", "audio/webm", bytes.NewReader(nil))
+	require.NoError(t, err)
+	assert.Equal(t, []int{WaveformMax}, previews.Waveform)
+
+	generator = NewGenerator(store, nil, WithAudioDecoder(stubAudio{err: errors.New("invalid data")}))
+	_, err = generator.Generate("1_abc.ogg", "audio/ogg", bytes.NewReader(nil))
+	assert.Error(t, err)
+
+	// Without a decoder audio has no previews
+	previews, err = NewGenerator(store, nil).Generate("1_abc.ogg", "audio/ogg", bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Nil(t, previews)
+}
@@ -0,0 +1,160 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+)
+
+const (
+	// audioTimeout bounds how long ffmpeg may spend decoding audio for a waveform
+	audioTimeout = 30 * time.Second
+	// waveformRate is the sample rate audio is decoded at; peaks need no more detail
+	waveformRate = 8000
+	// waveformWindow is how many samples each measured peak covers, 10ms at waveformRate
+	waveformWindow = waveformRate / 100
+	// WaveformBars is how many peaks a waveform has
+	WaveformBars = 64
+	// WaveformMax is the value of the loudest peak in a waveform
+	WaveformMax = 100
+)
+
+// AudioDecoder decodes audio files to raw samples
+type AudioDecoder interface {
+	// Decode writes audio to pcm as mono signed 16-bit little-endian samples at rate
+	Decode(audio io.Reader, rate int, pcm io.Writer) error
+}
+
+// WithAudioDecoder enables waveforms and durations for audio uploads
+func WithAudioDecoder(decoder AudioDecoder) Option {
+	return func(g *Generator) {
+		g.audio = decoder
+	}
+}
+
+// FFmpegAudio decodes audio by running ffmpeg
+type FFmpegAudio struct {
+	path string
+}
+
+// NewFFmpegAudio returns an AudioDecoder using the ffmpeg binary at path
+func NewFFmpegAudio(path string) *FFmpegAudio {
+	return &FFmpegAudio{path: path}
+}
+
+// Decode streams audio through ffmpeg. Ogg and WebM can be read from a pipe, so unlike
+// poster frames no temporary file is needed.
+func (f *FFmpegAudio) Decode(audio io.Reader, rate int, pcm io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), audioTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.path,
+		"-hide_banner", "-loglevel", "error",
+		"-i", "pipe:0",
+		"-vn", "-ac", "1", "-ar", fmt.Sprint(rate), "-f", "s16le", "pipe:1")
+	cmd.Stdin = audio
+	cmd.Stdout = pcm
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// envelope records the loudest sample of each window of decoded audio as it is written,
+// so long recordings are never held in memory
+type envelope struct {
+	peaks   []int
+	current int
+	count   int
+	samples int64
+	// odd holds the first byte of a sample split across writes
+	odd    []byte
+	window int
+}
+
+func (e *envelope) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(e.odd) > 0 {
+		p = append(e.odd, p...)
+		e.odd = nil
+	}
+	for ; len(p) >= 2; p = p[2:] {
+		sample := int(int16(binary.LittleEndian.Uint16(p)))
+		if sample < 0 {
+			sample = -sample
+		}
+		if sample > e.current {
+			e.current = sample
+		}
+		e.samples++
+		if e.count++; e.count == e.window {
+			e.flush()
+		}
+	}
+	if len(p) == 1 {
+		e.odd = []byte{p[0]}
+	}
+	return n, nil
+}
+
+// flush ends the current window
+func (e *envelope) flush() {
+	if e.count == 0 {
+		return
+	}
+	e.peaks = append(e.peaks, e.current)
+	e.current = 0
+	e.count = 0
+}
+
+// waveform reduces peaks to bars values scaled so the loudest is WaveformMax
+func waveform(peaks []int, bars int) []int {
+	if len(peaks) == 0 {
+		return nil
+	}
+	if len(peaks) < bars {
+		bars = len(peaks)
+	}
+	out := make([]int, bars)
+	loudest := 0
+	for i := range out {
+		start, end := i*len(peaks)/bars, (i+1)*len(peaks)/bars
+		for _, peak := range peaks[start:end] {
+			if peak > out[i] {
+				out[i] = peak
+			}
+		}
+		if out[i] > loudest {
+			loudest = out[i]
+		}
+	}
+	if loudest == 0 {
+		return out
+	}
+	for i := range out {
+		out[i] = (out[i]*WaveformMax + loudest/2) / loudest
+	}
+	return out
+}
+
+// generateWaveform decodes audio and returns its waveform and length
+func (g *Generator) generateWaveform(content io.Reader) (*models.Previews, error) {
+	env := &envelope{window: waveformWindow}
+	if err := g.audio.Decode(content, waveformRate, env); err != nil {
+		return nil, err
+	}
+	env.flush()
+	if env.samples == 0 {
+		return nil, fmt.Errorf("audio has no samples")
+	}
+	durationMs := int(env.samples * 1000 / waveformRate)
+	return &models.Previews{Waveform: waveform(env.peaks, WaveformBars), DurationMs: &durationMs}, nil
+}
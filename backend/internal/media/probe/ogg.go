@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	// oggHead is how much of the start of an Ogg file is read for the codec header
+	oggHead = 4 << 10
+	// oggTail is how far from the end the last page, whose granule position gives the
+	// length, is looked for. Ogg pages are at most 64 KiB.
+	oggTail = 64 << 10
+	// opusRate is the rate Opus granule positions count at, whatever the input rate was
+	opusRate = 48000
+)
+
+// probeOgg reads the duration of an Opus or Vorbis stream from the granule position,
+// a sample count, of its last page
+func probeOgg(r io.ReadSeeker) (Info, error) {
+	head, err := readAt(r, 0, oggHead)
+	if err != nil {
+		return Info{}, err
+	}
+	if len(head) < 27 || !bytes.HasPrefix(head, []byte("OggS")) || 27+int(head[26]) > len(head) {
+		return Info{}, errMalformed
+	}
+	packet := head[27+int(head[26]):]
+
+	var rate, preSkip uint64
+	switch {
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 12:
+		rate = opusRate
+		preSkip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		rate = uint64(binary.LittleEndian.Uint32(packet[12:16]))
+	default:
+		return Info{}, errMalformed
+	}
+	if rate == 0 {
+		return Info{}, errMalformed
+	}
+
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Info{}, err
+	}
+	start := end - oggTail
+	if start < 0 {
+		start = 0
+	}
+	tail, err := readAt(r, start, int(end-start))
+	if err != nil {
+		return Info{}, err
+	}
+
+	// Pages that end no packet carry a granule position of -1, so the last page that
+	// does is used
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if i+14 > len(tail) {
+			continue
+		}
+		granule := binary.LittleEndian.Uint64(tail[i+6 : i+14])
+		if granule == ^uint64(0) {
+			continue
+		}
+		if granule < preSkip {
+			return Info{}, errMalformed
+		}
+		return Info{DurationMs: intPtr(int((granule - preSkip) * 1000 / rate))}, nil
+	}
+	return Info{}, errMalformed
+}
+
+// readAt reads up to n bytes from offset, returning fewer at the end of the file
+func readAt(r io.ReadSeeker, offset int64, n int) ([]byte, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return buf[:read], nil
+}
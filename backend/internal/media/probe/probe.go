@@ -0,0 +1,189 @@
+// Package probe reads dimensions and durations from uploaded media files
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"strings"
+
+	// Register the decoders used by image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Info holds the metadata that could be read from a file. Fields are nil when unknown.
+type Info struct {
+	Width      *int
+	Height     *int
+	DurationMs *int
+}
+
+// Probe inspects content of the given type. Files that cannot be parsed yield an empty Info,
+// so metadata stays best effort and never blocks an upload.
+func Probe(content io.ReadSeeker, contentType string) Info {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		config, _, err := image.DecodeConfig(content)
+		if err != nil {
+			return Info{}
+		}
+		return Info{Width: intPtr(config.Width), Height: intPtr(config.Height)}
+	case contentType == "video/mp4":
+		info, err := probeMP4(content)
+		if err != nil {
+			return Info{}
+		}
+		return info
+	case contentType == "audio/ogg":
+		info, err := probeOgg(content)
+		if err != nil {
+			return Info{}
+		}
+		return info
+	case contentType == "audio/webm" || contentType == "video/webm":
+		info, err := probeWebM(content)
+		if err != nil {
+			return Info{}
+		}
+		return info
+	}
+	return Info{}
+}
+
+// errMalformed is returned for MP4 files whose box structure cannot be followed
+var errMalformed = errors.New("malformed mp4")
+
+// probeMP4 reads the movie duration from the mvhd box and the first visual track's
+// dimensions from its tkhd box
+func probeMP4(r io.ReadSeeker) (Info, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	err = walkBoxes(r, 0, end, func(boxType string, payload int64) (bool, error) {
+		switch boxType {
+		case "moov", "trak":
+			return true, nil
+		case "mvhd":
+			return false, readMovieHeader(r, payload, &info)
+		case "tkhd":
+			if info.Width == nil {
+				return false, readTrackHeader(r, payload, &info)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// walkBoxes visits the boxes between offsets start and end. visit receives each box's
+// type and payload offset and reports whether to descend into it.
+func walkBoxes(r io.ReadSeeker, start, end int64, visit func(boxType string, payload int64) (bool, error)) error {
+	var header [16]byte
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return errMalformed
+		}
+
+		descend, err := visit(boxType, offset+headerSize)
+		if err != nil {
+			return err
+		}
+		if descend {
+			if err := walkBoxes(r, offset+headerSize, offset+size, visit); err != nil {
+				return err
+			}
+		}
+		offset += size
+	}
+	return nil
+}
+
+func readMovieHeader(r io.ReadSeeker, payload int64, info *Info) error {
+	if _, err := r.Seek(payload, io.SeekStart); err != nil {
+		return err
+	}
+	var buf [32]byte
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return err
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 {
+		if _, err := io.ReadFull(r, buf[:28]); err != nil {
+			return err
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[16:20]))
+		duration = binary.BigEndian.Uint64(buf[20:28])
+	} else {
+		if _, err := io.ReadFull(r, buf[:16]); err != nil {
+			return err
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[8:12]))
+		duration = uint64(binary.BigEndian.Uint32(buf[12:16]))
+	}
+	if timescale == 0 {
+		return errMalformed
+	}
+	info.DurationMs = intPtr(int(duration * 1000 / timescale))
+	return nil
+}
+
+func readTrackHeader(r io.ReadSeeker, payload int64, info *Info) error {
+	if _, err := r.Seek(payload, io.SeekStart); err != nil {
+		return err
+	}
+	var version [1]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return err
+	}
+	// Skip flags, times, track ID and duration, then reserved, layer, group, volume and matrix
+	skip := int64(3 + 20 + 8 + 8 + 36)
+	if version[0] == 1 {
+		skip = 3 + 32 + 8 + 8 + 36
+	}
+	if _, err := r.Seek(skip, io.SeekCurrent); err != nil {
+		return err
+	}
+	var dims [8]byte
+	if _, err := io.ReadFull(r, dims[:]); err != nil {
+		return err
+	}
+	// Dimensions are 16.16 fixed point; audio tracks report zero
+	width := int(binary.BigEndian.Uint32(dims[:4]) >> 16)
+	height := int(binary.BigEndian.Uint32(dims[4:]) >> 16)
+	if width > 0 && height > 0 {
+		info.Width = intPtr(width)
+		info.Height = intPtr(height)
+	}
+	return nil
+}
+
+func intPtr(v int) *int {
+	return &v
+}
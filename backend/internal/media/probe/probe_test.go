@@ -0,0 +1,140 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// box encodes an MP4 box with the given type and payload
+func box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(out, uint32(8+len(body)))
+	copy(out[4:], boxType)
+	return append(out, body...)
+}
+
+func movieHeader(timescale, duration uint32) []byte {
+	payload := make([]byte, 20)
+	binary.BigEndian.PutUint32(payload[12:], timescale)
+	binary.BigEndian.PutUint32(payload[16:], duration)
+	return box("mvhd", payload)
+}
+
+func trackHeader(width, height uint32) []byte {
+	payload := make([]byte, 84)
+	binary.BigEndian.PutUint32(payload[76:], width<<16)
+	binary.BigEndian.PutUint32(payload[80:], height<<16)
+	return box("tkhd", payload)
+}
+
+func TestProbeImage(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30))))
+
+	info := Probe(bytes.NewReader(buf.Bytes()), "image/png")
+	require.NotNil(t, info.Width)
+	require.NotNil(t, info.Height)
+	assert.Equal(t, 40, *info.Width)
+	assert.Equal(t, 30, *info.Height)
+	assert.Nil(t, info.DurationMs)
+}
+
+func TestProbeMP4(t *testing.T) {
+	file := bytes.Join([][]byte{
+		box("ftyp", []byte("isom")),
+		box("moov",
+			movieHeader(1000, 2500),
+			box("trak", trackHeader(0, 0)),
+			box("trak", trackHeader(640, 360)),
+		),
+	}, nil)
+
+	info := Probe(bytes.NewReader(file), "video/mp4")
+	require.NotNil(t, info.DurationMs)
+	require.NotNil(t, info.Width)
+	assert.Equal(t, 2500, *info.DurationMs)
+	assert.Equal(t, 640, *info.Width)
+	assert.Equal(t, 360, *info.Height)
+}
+
+func TestProbeMalformed(t *testing.T) {
+	assert.Equal(t, Info{}, Probe(bytes.NewReader([]byte("not an image")), "image/png"))
+
+	truncated := box("moov", movieHeader(1000, 2500))[:20]
+	assert.Equal(t, Info{}, Probe(bytes.NewReader(truncated), "video/mp4"))
+	assert.Equal(t, Info{}, Probe(bytes.NewReader([]byte("data")), "application/pdf"))
+	assert.Equal(t, Info{}, Probe(bytes.NewReader([]byte("OggS\x00")), "audio/ogg"))
+	assert.Equal(t, Info{}, Probe(bytes.NewReader([]byte("\x1A\x45\xDF")), "audio/webm"))
+}
+
+// oggPage encodes an Ogg page holding a single packet
+func oggPage(granule uint64, packet []byte) []byte {
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint64(header[6:], granule)
+	header[26] = 1
+	return append(append(header, byte(len(packet))), packet...)
+}
+
+func TestProbeOgg(t *testing.T) {
+	opusHead := []byte("OpusHead\x01\x01\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+	file := bytes.Join([][]byte{
+		oggPage(0, opusHead),
+		oggPage(0, []byte("OpusTags")),
+		oggPage(48000+312, []byte("audio")),
+		oggPage(3*48000+312, []byte("audio")),
+		// A page ending no packet does not count
+		oggPage(^uint64(0), []byte("continued")),
+	}, nil)
+
+	info := Probe(bytes.NewReader(file), "audio/ogg")
+	require.NotNil(t, info.DurationMs)
+	assert.Equal(t, 3000, *info.DurationMs)
+
+	vorbisHead := make([]byte, 30)
+	copy(vorbisHead, "\x01vorbis")
+	binary.LittleEndian.PutUint32(vorbisHead[12:], 44100)
+	info = Probe(bytes.NewReader(append(oggPage(0, vorbisHead), oggPage(22050, []byte("audio"))...)), "audio/ogg")
+	require.NotNil(t, info.DurationMs)
+	assert.Equal(t, 500, *info.DurationMs)
+}
+
+// element encodes an EBML element whose ID and size fit the forms used here
+func element(id []byte, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	size[0] = 0x01
+	return append(append(append([]byte{}, id...), size...), body...)
+}
+
+func TestProbeWebM(t *testing.T) {
+	header := element([]byte{0x1A, 0x45, 0xDF, 0xA3}, element([]byte{0x42, 0x82}, []byte("webm")))
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(2750))
+	info := element([]byte{0x15, 0x49, 0xA9, 0x66},
+		element([]byte{0x2A, 0xD7, 0xB1}, []byte{0x0F, 0x42, 0x40}),
+		element([]byte{0x44, 0x89}, duration),
+	)
+	// Segments recorded live have an unknown size
+	segment := append([]byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		append(element([]byte{0x11, 0x4D, 0x9B, 0x74}), info...)...)
+	cluster := element([]byte{0x1F, 0x43, 0xB6, 0x75}, []byte("frames"))
+
+	probed := Probe(bytes.NewReader(bytes.Join([][]byte{header, segment, cluster}, nil)), "audio/webm")
+	require.NotNil(t, probed.DurationMs)
+	assert.Equal(t, 2750, *probed.DurationMs)
+
+	// MediaRecorder writes no duration
+	noDuration := element([]byte{0x15, 0x49, 0xA9, 0x66}, element([]byte{0x2A, 0xD7, 0xB1}, []byte{0x0F, 0x42, 0x40}))
+	segment = append([]byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, noDuration...)
+	assert.Nil(t, Probe(bytes.NewReader(bytes.Join([][]byte{header, segment, cluster}, nil)), "audio/webm").DurationMs)
+}
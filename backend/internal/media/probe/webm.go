@@ -0,0 +1,151 @@
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// webmHead is how much of the start of a WebM file is searched for the segment info,
+// which muxers write before the first cluster
+const webmHead = 64 << 10
+
+// EBML element IDs, with their length marker bits kept as the format writes them
+const (
+	segmentID       = 0x18538067
+	segmentInfoID   = 0x1549A966
+	clusterID       = 0x1F43B675
+	timecodeScaleID = 0x2AD7B1
+	durationID      = 0x4489
+)
+
+// defaultTimecodeScale is the nanoseconds per timecode unit when a file does not say
+const defaultTimecodeScale = 1000000
+
+// probeWebM reads the duration recorded in a WebM file's segment info. Browsers
+// recording with MediaRecorder often write none, which leaves the duration unknown.
+func probeWebM(r io.ReadSeeker) (Info, error) {
+	head, err := readAt(r, 0, webmHead)
+	if err != nil {
+		return Info{}, err
+	}
+
+	var info Info
+	found := false
+	err = walkElements(head, 0, len(head), func(id uint64, data []byte) bool {
+		switch id {
+		case segmentID:
+			return true
+		case segmentInfoID:
+			found = true
+			if ms, ok := segmentDuration(data); ok {
+				info.DurationMs = intPtr(ms)
+			}
+		}
+		return false
+	}, func(id uint64) bool {
+		// Nothing after the first cluster describes the file
+		return id == clusterID || found
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	if !found {
+		return Info{}, errMalformed
+	}
+	return info, nil
+}
+
+// segmentDuration returns the length in milliseconds recorded in segment info
+func segmentDuration(info []byte) (int, bool) {
+	scale := uint64(defaultTimecodeScale)
+	var duration float64
+	hasDuration := false
+	walkElements(info, 0, len(info), func(id uint64, data []byte) bool {
+		switch id {
+		case timecodeScaleID:
+			if value := ebmlUint(data); value > 0 {
+				scale = value
+			}
+		case durationID:
+			switch len(data) {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+				hasDuration = true
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(data))
+				hasDuration = true
+			}
+		}
+		return false
+	}, nil)
+	if !hasDuration || duration <= 0 || math.IsNaN(duration) || math.IsInf(duration, 0) {
+		return 0, false
+	}
+	return int(duration * float64(scale) / 1e6), true
+}
+
+// walkElements visits the EBML elements between start and end. visit receives each
+// element's ID and data, which runs to end for elements of unknown size, and reports
+// whether to descend into it. stop, when set, ends the walk before an element.
+func walkElements(buf []byte, start, end int, visit func(id uint64, data []byte) bool, stop func(id uint64) bool) error {
+	for offset := start; offset < end; {
+		id, idLen, ok := readVint(buf[offset:end], true)
+		if !ok {
+			return errMalformed
+		}
+		if stop != nil && stop(id) {
+			return nil
+		}
+		size, sizeLen, ok := readVint(buf[offset+idLen:end], false)
+		if !ok {
+			return errMalformed
+		}
+		dataStart := offset + idLen + sizeLen
+		dataEnd := end
+		// A size of all ones means unknown, as for segments being recorded live
+		if size != 1<<(7*uint(sizeLen))-1 && uint64(end-dataStart) >= size {
+			dataEnd = dataStart + int(size)
+		}
+
+		if visit(id, buf[dataStart:dataEnd]) {
+			if err := walkElements(buf, dataStart, dataEnd, visit, stop); err != nil {
+				return err
+			}
+		}
+		offset = dataEnd
+	}
+	return nil
+}
+
+// readVint decodes an EBML variable length integer, keeping the length marker for
+// element IDs and dropping it for sizes
+func readVint(buf []byte, keepMarker bool) (uint64, int, bool) {
+	if len(buf) == 0 || buf[0] == 0 {
+		return 0, 0, false
+	}
+	length := 1
+	for mask := byte(0x80); buf[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > len(buf) {
+		return 0, 0, false
+	}
+	value := uint64(buf[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> uint(length))
+	}
+	for _, b := range buf[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	return value, length, true
+}
+
+// ebmlUint decodes a big-endian unsigned integer element of up to eight bytes
+func ebmlUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
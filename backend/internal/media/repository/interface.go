@@ -0,0 +1,80 @@
+// Package repository provides data access for uploaded media
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/storage"
+)
+
+var (
+	// ErrNotFound is returned when an attachment does not exist
+	ErrNotFound = errors.New("attachment not found")
+	// ErrQuarantinedFileNotFound is returned when a quarantined file does not exist
+	ErrQuarantinedFileNotFound = errors.New("quarantined file not found")
+)
+
+// Repository defines the media data access interface
+type Repository interface {
+	// IsParticipant reports whether userID sent or received a visible message carrying
+	// the file stored under key
+	IsParticipant(userID int, key string) (bool, error)
+
+	// HasAttachment reports whether userID uploaded an attachment stored under key, which
+	// is how access to shared blobs is checked since their keys name no owner
+	HasAttachment(userID int, key string) (bool, error)
+
+	// CreateAttachment stores attachment metadata and sets its ID and upload time
+	CreateAttachment(attachment *models.Attachment) error
+
+	// GetAttachment retrieves an attachment by ID
+	GetAttachment(id int) (*models.Attachment, error)
+
+	// GetAttachments retrieves the attachments with the given IDs; unknown IDs are skipped
+	GetAttachments(ids []int) ([]models.Attachment, error)
+
+	// GetAttachmentByKey retrieves the most recent attachment stored under key
+	GetAttachmentByKey(key string) (*models.Attachment, error)
+
+	// GetAttachmentForUser retrieves the attachment stored under key that userID uploaded,
+	// or else the most recent one a visible message userID sent or received carries
+	GetAttachmentForUser(userID int, key string) (*models.Attachment, error)
+
+	// Blob references are counted alongside the attachments that hold them
+	storage.BlobIndex
+
+	// ListUnattachedAttachments returns up to limit attachments uploaded before cutoff
+	// that no message or scheduled message carries, oldest first
+	ListUnattachedAttachments(cutoff time.Time, limit int) ([]models.Attachment, error)
+
+	// DeleteUnattachedAttachment deletes an attachment unless a message or scheduled
+	// message carries it by now, reporting whether it was deleted
+	DeleteUnattachedAttachment(id int) (bool, error)
+
+	// ListUnreferencedBlobs returns up to limit blobs last acquired before cutoff that no
+	// attachment uses, which happens when attachments are deleted along with their owner
+	ListUnreferencedBlobs(cutoff time.Time, limit int) ([]storage.Blob, error)
+
+	// DeleteUnreferencedBlob forgets a blob unless an attachment uses it or it was acquired
+	// after cutoff, reporting whether it was deleted
+	DeleteUnreferencedBlob(hash string, cutoff time.Time) (bool, error)
+
+	// UnknownKeys returns the keys that no attachment, blob, upload, avatar, message or
+	// quarantined file refers to
+	UnknownKeys(keys []string) ([]string, error)
+
+	// CreateQuarantinedFile records a file held for review and sets its ID and time
+	CreateQuarantinedFile(file *models.QuarantinedFile) error
+
+	// ListQuarantinedFiles returns up to limit quarantined files, newest first, continuing
+	// from beforeID when it is not zero
+	ListQuarantinedFiles(beforeID, limit int) ([]models.QuarantinedFile, error)
+
+	// GetQuarantinedFile retrieves a quarantined file by ID
+	GetQuarantinedFile(id int) (*models.QuarantinedFile, error)
+
+	// DeleteQuarantinedFile forgets a quarantined file and returns it so its file can be deleted
+	DeleteQuarantinedFile(id int) (*models.QuarantinedFile, error)
+}
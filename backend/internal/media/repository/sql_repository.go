@@ -0,0 +1,434 @@
+// Package repository implements the media repository interface
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/lib/pq"
+)
+
+// AttachmentColumns lists the attachments columns read by ScanAttachment, qualified by
+// the alias a so it can be used in joins
+const AttachmentColumns = `a.id, a.owner_id, a.storage_key, a.content_type, a.size, COALESCE(a.sha256, ''),
+        a.original_filename, a.width, a.height, a.duration_ms, COALESCE(a.blurhash, ''), a.variants, a.waveform,
+        a.uploaded_at`
+
+// SQLMediaRepository provides a PostgreSQL implementation of Repository
+type SQLMediaRepository struct {
+	db *sql.DB
+}
+
+// NewMediaRepository creates a new SQLMediaRepository instance
+func NewMediaRepository(db *sql.DB) Repository {
+	return &SQLMediaRepository{db: db}
+}
+
+// ScanAttachment reads an attachment selected with AttachmentColumns, followed by any
+// extra destinations
+func ScanAttachment(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*models.Attachment, error) {
+	var attachment models.Attachment
+	var width, height, duration sql.NullInt64
+	var variants, waveform []byte
+	dest := append([]interface{}{
+		&attachment.ID, &attachment.OwnerID, &attachment.Key, &attachment.ContentType, &attachment.Size,
+		&attachment.SHA256, &attachment.Filename, &width, &height, &duration, &attachment.Blurhash,
+		&variants, &waveform, &attachment.UploadedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(variants, &attachment.Variants); err != nil {
+		return nil, fmt.Errorf("failed to decode attachment variants: %w", err)
+	}
+	if waveform != nil {
+		if err := json.Unmarshal(waveform, &attachment.Waveform); err != nil {
+			return nil, fmt.Errorf("failed to decode attachment waveform: %w", err)
+		}
+	}
+	attachment.URL = models.URLForKey(attachment.Key)
+	attachment.Kind = models.KindOf(attachment.ContentType)
+	attachment.Width = nullIntPtr(width)
+	attachment.Height = nullIntPtr(height)
+	attachment.DurationMs = nullIntPtr(duration)
+	return &attachment, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+func (r *SQLMediaRepository) IsParticipant(userID int, key string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		`SELECT EXISTS(
+            SELECT 1 FROM attachments a
+            JOIN message_attachments ma ON ma.attachment_id = a.id
+            JOIN messages m ON m.id = ma.message_id
+            WHERE a.storage_key = $2 AND (m.sender_id = $1 OR m.receiver_id = $1) AND m.hidden_at IS NULL)`,
+		userID, key,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check media access: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *SQLMediaRepository) HasAttachment(userID int, key string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM attachments WHERE owner_id = $1 AND storage_key = $2)`,
+		userID, key,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check media ownership: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *SQLMediaRepository) CreateAttachment(attachment *models.Attachment) error {
+	variants, err := json.Marshal(attachment.Variants)
+	if err != nil {
+		return fmt.Errorf("failed to encode attachment variants: %w", err)
+	}
+	if attachment.Variants == nil {
+		variants = []byte("[]")
+	}
+	var waveform interface{}
+	if attachment.Waveform != nil {
+		encoded, err := json.Marshal(attachment.Waveform)
+		if err != nil {
+			return fmt.Errorf("failed to encode attachment waveform: %w", err)
+		}
+		waveform = encoded
+	}
+	err = r.db.QueryRow(
+		`INSERT INTO attachments (owner_id, storage_key, content_type, size, sha256, original_filename,
+            width, height, duration_ms, blurhash, variants, waveform)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+        RETURNING id, uploaded_at`,
+		attachment.OwnerID, attachment.Key, attachment.ContentType, attachment.Size, nullString(attachment.SHA256),
+		attachment.Filename, attachment.Width, attachment.Height, attachment.DurationMs,
+		nullString(attachment.Blurhash), variants, waveform,
+	).Scan(&attachment.ID, &attachment.UploadedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	attachment.URL = models.URLForKey(attachment.Key)
+	attachment.Kind = models.KindOf(attachment.ContentType)
+	return nil
+}
+
+func (r *SQLMediaRepository) GetAttachment(id int) (*models.Attachment, error) {
+	attachment, err := ScanAttachment(r.db.QueryRow(
+		`SELECT `+AttachmentColumns+` FROM attachments a WHERE a.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return attachment, nil
+}
+
+func (r *SQLMediaRepository) GetAttachments(ids []int) ([]models.Attachment, error) {
+	rows, err := r.db.Query(
+		`SELECT `+AttachmentColumns+` FROM attachments a WHERE a.id = ANY($1) ORDER BY a.id`,
+		pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		attachment, err := ScanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, *attachment)
+	}
+	return attachments, rows.Err()
+}
+
+func (r *SQLMediaRepository) GetAttachmentByKey(key string) (*models.Attachment, error) {
+	attachment, err := ScanAttachment(r.db.QueryRow(
+		`SELECT `+AttachmentColumns+` FROM attachments a WHERE a.storage_key = $1
+        ORDER BY a.uploaded_at DESC, a.id DESC LIMIT 1`, key))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return attachment, nil
+}
+
+func (r *SQLMediaRepository) GetAttachmentForUser(userID int, key string) (*models.Attachment, error) {
+	attachment, err := ScanAttachment(r.db.QueryRow(
+		`SELECT `+AttachmentColumns+` FROM attachments a
+        WHERE a.storage_key = $2 AND (a.owner_id = $1 OR EXISTS(
+            SELECT 1 FROM message_attachments ma
+            JOIN messages m ON m.id = ma.message_id
+            WHERE ma.attachment_id = a.id AND (m.sender_id = $1 OR m.receiver_id = $1) AND m.hidden_at IS NULL))
+        ORDER BY a.owner_id = $1 DESC, a.uploaded_at DESC, a.id DESC LIMIT 1`, userID, key))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return attachment, nil
+}
+
+// blobColumns lists the media_blobs columns read by scanBlob, in order
+const blobColumns = `sha256, storage_key, content_type, size, COALESCE(owner_id, 0)`
+
+func scanBlob(row interface{ Scan(...interface{}) error }) (*storage.Blob, error) {
+	var blob storage.Blob
+	if err := row.Scan(&blob.Hash, &blob.Key, &blob.ContentType, &blob.Size, &blob.OwnerID); err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *SQLMediaRepository) AcquireBlob(hash string) (*storage.Blob, bool, error) {
+	blob, err := scanBlob(r.db.QueryRow(
+		`UPDATE media_blobs SET ref_count = ref_count + 1, acquired_at = CURRENT_TIMESTAMP
+        WHERE sha256 = $1 RETURNING `+blobColumns, hash))
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire blob: %w", err)
+	}
+	return blob, true, nil
+}
+
+func (r *SQLMediaRepository) RegisterBlob(blob *storage.Blob) (*storage.Blob, error) {
+	var ownerID interface{}
+	if blob.OwnerID > 0 {
+		ownerID = blob.OwnerID
+	}
+	registered, err := scanBlob(r.db.QueryRow(
+		`INSERT INTO media_blobs (sha256, storage_key, content_type, size, owner_id)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (sha256) DO UPDATE SET ref_count = media_blobs.ref_count + 1, acquired_at = CURRENT_TIMESTAMP
+        RETURNING `+blobColumns,
+		blob.Hash, blob.Key, blob.ContentType, blob.Size, ownerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to register blob: %w", err)
+	}
+	return registered, nil
+}
+
+// ReleaseBlob decrements the reference count and deletes the row once it reaches zero.
+// The delete only matches a row nobody acquired in the meantime, so a blob that gains a
+// reference between the two statements is kept.
+func (r *SQLMediaRepository) ReleaseBlob(hash string) (*storage.Blob, bool, error) {
+	_, err := r.db.Exec(
+		`UPDATE media_blobs SET ref_count = GREATEST(ref_count - 1, 0) WHERE sha256 = $1`, hash)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to release blob: %w", err)
+	}
+	blob, err := scanBlob(r.db.QueryRow(
+		`DELETE FROM media_blobs WHERE sha256 = $1 AND ref_count = 0 RETURNING `+blobColumns, hash))
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return blob, true, nil
+}
+
+func (r *SQLMediaRepository) ListUnattachedAttachments(cutoff time.Time, limit int) ([]models.Attachment, error) {
+	rows, err := r.db.Query(
+		`SELECT `+AttachmentColumns+` FROM attachments a
+        WHERE a.uploaded_at < $1
+            AND NOT EXISTS (SELECT 1 FROM message_attachments ma WHERE ma.attachment_id = a.id)
+            AND NOT EXISTS (SELECT 1 FROM scheduled_message_attachments sa WHERE sa.attachment_id = a.id)
+        ORDER BY a.uploaded_at, a.id
+        LIMIT $2`, cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unattached attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		attachment, err := ScanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, *attachment)
+	}
+	return attachments, rows.Err()
+}
+
+func (r *SQLMediaRepository) DeleteUnattachedAttachment(id int) (bool, error) {
+	result, err := r.db.Exec(
+		`DELETE FROM attachments a WHERE a.id = $1
+            AND NOT EXISTS (SELECT 1 FROM message_attachments ma WHERE ma.attachment_id = a.id)
+            AND NOT EXISTS (SELECT 1 FROM scheduled_message_attachments sa WHERE sa.attachment_id = a.id)`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+func (r *SQLMediaRepository) ListUnreferencedBlobs(cutoff time.Time, limit int) ([]storage.Blob, error) {
+	rows, err := r.db.Query(
+		`SELECT `+blobColumns+` FROM media_blobs b
+        WHERE b.acquired_at < $1
+            AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.storage_key = b.storage_key)
+        ORDER BY b.acquired_at
+        LIMIT $2`, cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unreferenced blobs: %w", err)
+	}
+	defer rows.Close()
+
+	var blobs []storage.Blob
+	for rows.Next() {
+		blob, err := scanBlob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan blob: %w", err)
+		}
+		blobs = append(blobs, *blob)
+	}
+	return blobs, rows.Err()
+}
+
+func (r *SQLMediaRepository) DeleteUnreferencedBlob(hash string, cutoff time.Time) (bool, error) {
+	result, err := r.db.Exec(
+		`DELETE FROM media_blobs b WHERE b.sha256 = $1 AND b.acquired_at < $2
+            AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.storage_key = b.storage_key)`, hash, cutoff)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+func (r *SQLMediaRepository) UnknownKeys(keys []string) ([]string, error) {
+	rows, err := r.db.Query(
+		`SELECT k FROM unnest($1::text[]) AS k
+        WHERE NOT EXISTS (SELECT 1 FROM attachments WHERE storage_key = k)
+            AND NOT EXISTS (SELECT 1 FROM media_blobs WHERE storage_key = k)
+            AND NOT EXISTS (SELECT 1 FROM uploads WHERE storage_key = k)
+            AND NOT EXISTS (SELECT 1 FROM direct_uploads WHERE storage_key = k)
+            AND NOT EXISTS (SELECT 1 FROM users WHERE avatar_url = $2 || k)
+            AND NOT EXISTS (SELECT 1 FROM messages WHERE media_url = $2 || k)
+            AND NOT EXISTS (SELECT 1 FROM quarantined_files WHERE storage_key = k)`,
+		pq.Array(keys), models.URLPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up storage keys: %w", err)
+	}
+	defer rows.Close()
+
+	var unknown []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan storage key: %w", err)
+		}
+		unknown = append(unknown, key)
+	}
+	return unknown, rows.Err()
+}
+
+// quarantineColumns lists the quarantined_files columns read by scanQuarantinedFile, in order
+const quarantineColumns = `id, owner_id, storage_key, original_filename, content_type, size, signature, quarantined_at`
+
+func scanQuarantinedFile(row interface{ Scan(...interface{}) error }) (*models.QuarantinedFile, error) {
+	var file models.QuarantinedFile
+	err := row.Scan(&file.ID, &file.OwnerID, &file.Key, &file.Filename, &file.ContentType, &file.Size,
+		&file.Signature, &file.QuarantinedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (r *SQLMediaRepository) CreateQuarantinedFile(file *models.QuarantinedFile) error {
+	err := r.db.QueryRow(
+		`INSERT INTO quarantined_files (owner_id, storage_key, original_filename, content_type, size, signature)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, quarantined_at`,
+		file.OwnerID, file.Key, file.Filename, file.ContentType, file.Size, file.Signature,
+	).Scan(&file.ID, &file.QuarantinedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record quarantined file: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLMediaRepository) ListQuarantinedFiles(beforeID, limit int) ([]models.QuarantinedFile, error) {
+	rows, err := r.db.Query(
+		`SELECT `+quarantineColumns+` FROM quarantined_files
+        WHERE $1 = 0 OR id < $1
+        ORDER BY id DESC
+        LIMIT $2`, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined files: %w", err)
+	}
+	defer rows.Close()
+
+	files := []models.QuarantinedFile{}
+	for rows.Next() {
+		file, err := scanQuarantinedFile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined file: %w", err)
+		}
+		files = append(files, *file)
+	}
+	return files, rows.Err()
+}
+
+func (r *SQLMediaRepository) GetQuarantinedFile(id int) (*models.QuarantinedFile, error) {
+	file, err := scanQuarantinedFile(r.db.QueryRow(
+		`SELECT `+quarantineColumns+` FROM quarantined_files WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrQuarantinedFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quarantined file: %w", err)
+	}
+	return file, nil
+}
+
+func (r *SQLMediaRepository) DeleteQuarantinedFile(id int) (*models.QuarantinedFile, error) {
+	file, err := scanQuarantinedFile(r.db.QueryRow(
+		`DELETE FROM quarantined_files WHERE id = $1 RETURNING `+quarantineColumns, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrQuarantinedFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete quarantined file: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,364 @@
+// Package repository provides test implementations of the Repository interface
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/storage"
+)
+
+type testBlob struct {
+	storage.Blob
+	refs       int
+	acquiredAt time.Time
+}
+
+type mediaMessage struct {
+	senderID, receiverID int
+	key                  string
+	attachmentID         int
+}
+
+// TestMediaRepository provides an in-memory implementation of Repository for testing
+type TestMediaRepository struct {
+	messages    []mediaMessage
+	attachments map[int]models.Attachment
+	blobs       map[string]*testBlob
+	storedKeys  map[string]bool
+	quarantine  map[int]models.QuarantinedFile
+	nextID      int
+	mu          sync.RWMutex
+}
+
+// NewTestMediaRepository creates a new instance of TestMediaRepository
+func NewTestMediaRepository() *TestMediaRepository {
+	return &TestMediaRepository{
+		attachments: make(map[int]models.Attachment),
+		blobs:       make(map[string]*testBlob),
+		storedKeys:  make(map[string]bool),
+		quarantine:  make(map[int]models.QuarantinedFile),
+		nextID:      1,
+	}
+}
+
+// AddStoredKey records a file referenced outside attachments, such as an avatar or an
+// upload in progress
+func (r *TestMediaRepository) AddStoredKey(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.storedKeys[key] = true
+}
+
+// AddMessage records a message carrying the file stored under key between two users
+func (r *TestMediaRepository) AddMessage(senderID, receiverID int, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, mediaMessage{senderID: senderID, receiverID: receiverID, key: key})
+}
+
+// AddAttachmentMessage records a message carrying an attachment between two users
+func (r *TestMediaRepository) AddAttachmentMessage(senderID, receiverID, attachmentID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, mediaMessage{
+		senderID:     senderID,
+		receiverID:   receiverID,
+		key:          r.attachments[attachmentID].Key,
+		attachmentID: attachmentID,
+	})
+}
+
+func (r *TestMediaRepository) IsParticipant(userID int, key string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, msg := range r.messages {
+		if msg.key == key && (msg.senderID == userID || msg.receiverID == userID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *TestMediaRepository) HasAttachment(userID int, key string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, attachment := range r.attachments {
+		if attachment.Key == key && attachment.OwnerID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *TestMediaRepository) CreateAttachment(attachment *models.Attachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attachment.ID = r.nextID
+	r.nextID++
+	attachment.URL = models.URLForKey(attachment.Key)
+	attachment.Kind = models.KindOf(attachment.ContentType)
+	attachment.UploadedAt = time.Now()
+	r.attachments[attachment.ID] = *attachment
+	return nil
+}
+
+func (r *TestMediaRepository) GetAttachment(id int) (*models.Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	attachment, ok := r.attachments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &attachment, nil
+}
+
+func (r *TestMediaRepository) GetAttachments(ids []int) ([]models.Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var attachments []models.Attachment
+	for _, id := range ids {
+		if attachment, ok := r.attachments[id]; ok {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return attachments, nil
+}
+
+func (r *TestMediaRepository) GetAttachmentByKey(key string) (*models.Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var latest *models.Attachment
+	for _, attachment := range r.attachments {
+		if attachment.Key == key && (latest == nil || attachment.ID > latest.ID) {
+			a := attachment
+			latest = &a
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *TestMediaRepository) GetAttachmentForUser(userID int, key string) (*models.Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var latest *models.Attachment
+	for _, attachment := range r.attachments {
+		if attachment.Key == key && attachment.OwnerID == userID && (latest == nil || attachment.ID > latest.ID) {
+			a := attachment
+			latest = &a
+		}
+	}
+	if latest != nil {
+		return latest, nil
+	}
+	for _, msg := range r.messages {
+		if msg.attachmentID == 0 || msg.key != key || (msg.senderID != userID && msg.receiverID != userID) {
+			continue
+		}
+		if attachment, ok := r.attachments[msg.attachmentID]; ok && (latest == nil || attachment.ID > latest.ID) {
+			latest = &attachment
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *TestMediaRepository) AcquireBlob(hash string) (*storage.Blob, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blob, ok := r.blobs[hash]
+	if !ok {
+		return nil, false, nil
+	}
+	blob.refs++
+	blob.acquiredAt = time.Now()
+	b := blob.Blob
+	return &b, true, nil
+}
+
+func (r *TestMediaRepository) RegisterBlob(blob *storage.Blob) (*storage.Blob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.blobs[blob.Hash]
+	if !ok {
+		existing = &testBlob{Blob: *blob}
+		r.blobs[blob.Hash] = existing
+	}
+	existing.refs++
+	existing.acquiredAt = time.Now()
+	b := existing.Blob
+	return &b, nil
+}
+
+func (r *TestMediaRepository) ReleaseBlob(hash string) (*storage.Blob, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blob, ok := r.blobs[hash]
+	if !ok {
+		return nil, false, nil
+	}
+	blob.refs--
+	if blob.refs > 0 {
+		return nil, false, nil
+	}
+	delete(r.blobs, hash)
+	b := blob.Blob
+	return &b, true, nil
+}
+
+// BlobRefs returns the number of references to the blob with hash
+func (r *TestMediaRepository) BlobRefs(hash string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if blob, ok := r.blobs[hash]; ok {
+		return blob.refs
+	}
+	return 0
+}
+
+// attached reports whether a message carries the file stored under key
+func (r *TestMediaRepository) attached(key string) bool {
+	for _, msg := range r.messages {
+		if msg.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *TestMediaRepository) ListUnattachedAttachments(cutoff time.Time, limit int) ([]models.Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var attachments []models.Attachment
+	for _, attachment := range r.attachments {
+		if attachment.UploadedAt.Before(cutoff) && !r.attached(attachment.Key) {
+			attachments = append(attachments, attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	if len(attachments) > limit {
+		attachments = attachments[:limit]
+	}
+	return attachments, nil
+}
+
+func (r *TestMediaRepository) DeleteUnattachedAttachment(id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attachment, ok := r.attachments[id]
+	if !ok || r.attached(attachment.Key) {
+		return false, nil
+	}
+	delete(r.attachments, id)
+	return true, nil
+}
+
+// keyInUse reports whether an attachment is stored under key
+func (r *TestMediaRepository) keyInUse(key string) bool {
+	for _, attachment := range r.attachments {
+		if attachment.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *TestMediaRepository) ListUnreferencedBlobs(cutoff time.Time, limit int) ([]storage.Blob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var blobs []storage.Blob
+	for _, blob := range r.blobs {
+		if blob.acquiredAt.Before(cutoff) && !r.keyInUse(blob.Key) {
+			blobs = append(blobs, blob.Blob)
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Hash < blobs[j].Hash })
+	if len(blobs) > limit {
+		blobs = blobs[:limit]
+	}
+	return blobs, nil
+}
+
+func (r *TestMediaRepository) DeleteUnreferencedBlob(hash string, cutoff time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blob, ok := r.blobs[hash]
+	if !ok || !blob.acquiredAt.Before(cutoff) || r.keyInUse(blob.Key) {
+		return false, nil
+	}
+	delete(r.blobs, hash)
+	return true, nil
+}
+
+func (r *TestMediaRepository) UnknownKeys(keys []string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var unknown []string
+	for _, key := range keys {
+		known := r.storedKeys[key] || r.attached(key) || r.keyInUse(key)
+		for _, blob := range r.blobs {
+			known = known || blob.Key == key
+		}
+		for _, file := range r.quarantine {
+			known = known || file.Key == key
+		}
+		if !known {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown, nil
+}
+
+func (r *TestMediaRepository) CreateQuarantinedFile(file *models.QuarantinedFile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file.ID = r.nextID
+	r.nextID++
+	file.QuarantinedAt = time.Now()
+	r.quarantine[file.ID] = *file
+	return nil
+}
+
+func (r *TestMediaRepository) ListQuarantinedFiles(beforeID, limit int) ([]models.QuarantinedFile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	files := []models.QuarantinedFile{}
+	for id, file := range r.quarantine {
+		if beforeID == 0 || id < beforeID {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ID > files[j].ID })
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
+}
+
+func (r *TestMediaRepository) GetQuarantinedFile(id int) (*models.QuarantinedFile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	file, ok := r.quarantine[id]
+	if !ok {
+		return nil, ErrQuarantinedFileNotFound
+	}
+	return &file, nil
+}
+
+func (r *TestMediaRepository) DeleteQuarantinedFile(id int) (*models.QuarantinedFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.quarantine[id]
+	if !ok {
+		return nil, ErrQuarantinedFileNotFound
+	}
+	delete(r.quarantine, id)
+	return &file, nil
+}
@@ -0,0 +1,173 @@
+package scan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultTimeout bounds each exchange with clamd, including waiting for the verdict
+	defaultTimeout = 30 * time.Second
+	// chunkSize is how much of a file is sent to clamd per INSTREAM chunk
+	chunkSize = 64 << 10
+)
+
+// DefaultSuspiciousPrefixes are the signature families reported as suspicious rather
+// than infected: ClamAV's heuristic detections and potentially unwanted programs
+var DefaultSuspiciousPrefixes = []string{"Heuristics.", "PUA."}
+
+// ErrScanner is returned when clamd reports an error instead of a verdict, such as a
+// file larger than its StreamMaxLength
+var ErrScanner = errors.New("clamd error")
+
+// Clamd scans files with a ClamAV daemon over TCP using the INSTREAM command
+type Clamd struct {
+	address    string
+	timeout    time.Duration
+	suspicious []string
+}
+
+// ClamdOption configures a Clamd scanner
+type ClamdOption func(*Clamd)
+
+// WithTimeout bounds each exchange with clamd, including waiting for the verdict once a
+// file has been sent
+func WithTimeout(timeout time.Duration) ClamdOption {
+	return func(c *Clamd) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// WithSuspiciousPrefixes sets the signature prefixes reported as suspicious instead of
+// infected
+func WithSuspiciousPrefixes(prefixes []string) ClamdOption {
+	return func(c *Clamd) {
+		c.suspicious = prefixes
+	}
+}
+
+// NewClamd creates a scanner using the clamd listening on address, e.g. "clamav:3310"
+func NewClamd(address string, opts ...ClamdOption) *Clamd {
+	c := &Clamd{
+		address:    address,
+		timeout:    defaultTimeout,
+		suspicious: DefaultSuspiciousPrefixes,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Ping checks that clamd is reachable
+func (c *Clamd) Ping() error {
+	reply, err := c.command("zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: unexpected reply to PING: %q", ErrScanner, reply)
+	}
+	return nil
+}
+
+// Scan streams content to clamd and returns its verdict
+func (c *Clamd) Scan(content io.Reader) (*Result, error) {
+	reply, err := c.command("zINSTREAM\x00", content)
+	if err != nil {
+		return nil, err
+	}
+	return c.parse(reply)
+}
+
+// command sends a null-terminated command, followed by content as INSTREAM chunks when
+// it is not nil, and returns clamd's reply
+func (c *Clamd) command(command string, content io.Reader) (string, error) {
+	conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := io.WriteString(conn, command); err != nil {
+		return "", fmt.Errorf("failed to send command to clamd: %w", err)
+	}
+	if content != nil {
+		if err := c.stream(conn, content); err != nil {
+			// clamd closes the connection when it refuses a stream, so its reply may say why
+			if reply, readErr := readReply(conn); readErr == nil && reply != "" {
+				return "", fmt.Errorf("%w: %s", ErrScanner, reply)
+			}
+			return "", err
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	reply, err := readReply(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return reply, nil
+}
+
+// stream sends content as length-prefixed chunks ending with an empty one
+func (c *Clamd) stream(conn net.Conn, content io.Reader) error {
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(content, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			conn.SetDeadline(time.Now().Add(c.timeout))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("failed to send file to clamd: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("failed to send file to clamd: %w", err)
+	}
+	return nil
+}
+
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// parse reads an INSTREAM reply: "stream: OK", "stream: <signature> FOUND" or an error
+// ending in "ERROR"
+func (c *Clamd) parse(reply string) (*Result, error) {
+	status := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case status == "OK":
+		return &Result{Verdict: Clean}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		signature := strings.TrimSuffix(status, " FOUND")
+		for _, prefix := range c.suspicious {
+			if strings.HasPrefix(signature, prefix) {
+				return &Result{Verdict: Suspicious, Signature: signature}, nil
+			}
+		}
+		return &Result{Verdict: Infected, Signature: signature}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrScanner, reply)
+	}
+}
@@ -0,0 +1,171 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClamd speaks enough of the clamd protocol to answer PING and INSTREAM. Streams
+// containing a key of signatures are reported as that signature, and streams longer
+// than maxLength are refused as clamd does.
+type fakeClamd struct {
+	listener   net.Listener
+	signatures map[string]string
+	maxLength  int
+	received   chan []byte
+}
+
+func newFakeClamd(t *testing.T, signatures map[string]string) *fakeClamd {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	d := &fakeClamd{listener: listener, signatures: signatures, maxLength: 1 << 20, received: make(chan []byte, 10)}
+	t.Cleanup(func() { listener.Close() })
+	go d.serve()
+	return d
+}
+
+func (d *fakeClamd) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch command {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM\x00":
+		var data []byte
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if len(data)+int(size) > d.maxLength {
+				conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				return
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk...)
+		}
+		d.received <- data
+		for pattern, signature := range d.signatures {
+			if bytes.Contains(data, []byte(pattern)) {
+				conn.Write([]byte("stream: " + signature + " FOUND\x00"))
+				return
+			}
+		}
+		conn.Write([]byte("stream: OK\x00"))
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func TestClamd(t *testing.T) {
+	daemon := newFakeClamd(t, map[string]string{
+		"virus":    "Win.Test.Virus-1",
+		"phishing": "Heuristics.Phishing.Email.SpoofedDomain",
+		"adware":   "PUA.Win.Adware.Test",
+	})
+	clamd := NewClamd(daemon.listener.Addr().String(), WithTimeout(time.Second))
+
+	require.NoError(t, clamd.Ping())
+
+	tests := []struct {
+		name      string
+		content   string
+		verdict   Verdict
+		signature string
+	}{
+		{"clean", "hello world", Clean, ""},
+		{"infected", "this is a virus", Infected, "Win.Test.Virus-1"},
+		{"heuristic", "phishing page", Suspicious, "Heuristics.Phishing.Email.SpoofedDomain"},
+		{"potentially unwanted", "adware bundle", Suspicious, "PUA.Win.Adware.Test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := clamd.Scan(strings.NewReader(tt.content))
+			require.NoError(t, err)
+			assert.Equal(t, tt.verdict, result.Verdict)
+			assert.Equal(t, tt.signature, result.Signature)
+			assert.Equal(t, tt.content, string(<-daemon.received))
+		})
+	}
+
+	t.Run("large file is sent in chunks", func(t *testing.T) {
+		content := bytes.Repeat([]byte("a"), 3*chunkSize+17)
+		result, err := clamd.Scan(bytes.NewReader(content))
+		require.NoError(t, err)
+		assert.Equal(t, Clean, result.Verdict)
+		assert.Equal(t, content, <-daemon.received)
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		daemon.maxLength = 10
+		defer func() { daemon.maxLength = 1 << 20 }()
+		_, err := clamd.Scan(bytes.NewReader(bytes.Repeat([]byte("a"), 4*chunkSize)))
+		assert.ErrorIs(t, err, ErrScanner)
+	})
+
+	t.Run("custom suspicious prefixes", func(t *testing.T) {
+		strict := NewClamd(daemon.listener.Addr().String(), WithSuspiciousPrefixes(nil))
+		result, err := strict.Scan(strings.NewReader("adware"))
+		require.NoError(t, err)
+		assert.Equal(t, Infected, result.Verdict)
+		<-daemon.received
+	})
+}
+
+func TestClamdUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	clamd := NewClamd(address, WithTimeout(time.Second))
+	assert.Error(t, clamd.Ping())
+	_, err = clamd.Scan(strings.NewReader("hello"))
+	assert.Error(t, err)
+}
+
+func TestFake(t *testing.T) {
+	fake := NewFake().Add("virus", Infected, "Test.Virus")
+
+	result, err := fake.Scan(strings.NewReader("clean"))
+	require.NoError(t, err)
+	assert.Equal(t, Clean, result.Verdict)
+
+	result, err = fake.Scan(strings.NewReader("a virus"))
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Verdict: Infected, Signature: "Test.Virus"}, result)
+	assert.Equal(t, 2, fake.Scanned())
+
+	fake.Fail(io.ErrUnexpectedEOF)
+	_, err = fake.Scan(strings.NewReader("clean"))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
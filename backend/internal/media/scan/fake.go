@@ -0,0 +1,75 @@
+package scan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Fake is a scanner for tests that looks for fixed byte patterns instead of real
+// signatures, so tests need no malware samples or clamd
+type Fake struct {
+	mu       sync.Mutex
+	patterns []fakePattern
+	err      error
+	scanned  int
+}
+
+type fakePattern struct {
+	pattern []byte
+	result  Result
+}
+
+// NewFake creates a Fake that finds every file clean until patterns are added
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// Add reports files containing pattern with verdict and signature
+func (f *Fake) Add(pattern string, verdict Verdict, signature string) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.patterns = append(f.patterns, fakePattern{
+		pattern: []byte(pattern),
+		result:  Result{Verdict: verdict, Signature: signature},
+	})
+	return f
+}
+
+// Fail makes every scan return err, as when the scanner is unreachable. A nil err
+// restores scanning.
+func (f *Fake) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Scanned returns how many files have been scanned
+func (f *Fake) Scanned() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scanned
+}
+
+// Scan reads the whole of content and returns the result of the first pattern it contains
+func (f *Fake) Scan(content io.Reader) (*Result, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.scanned++
+	for _, p := range f.patterns {
+		if bytes.Contains(data, p.pattern) {
+			result := p.result
+			return &result, nil
+		}
+	}
+	return &Result{Verdict: Clean}, nil
+}
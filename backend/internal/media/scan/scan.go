@@ -0,0 +1,22 @@
+// Package scan checks uploaded files for malware
+package scan
+
+// Verdict is what a scan concluded about a file
+type Verdict string
+
+const (
+	// Clean files matched no signature
+	Clean Verdict = "clean"
+	// Suspicious files matched a heuristic or potentially unwanted program signature,
+	// which has false positives, so they are held for review rather than refused outright
+	Suspicious Verdict = "suspicious"
+	// Infected files matched a malware signature
+	Infected Verdict = "infected"
+)
+
+// Result is the outcome of scanning a file
+type Result struct {
+	Verdict Verdict
+	// Signature names what the file matched, empty for clean files
+	Signature string
+}
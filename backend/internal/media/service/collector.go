@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/storage"
+)
+
+// collectBatchSize bounds how many attachments and blobs a collection removes, and how
+// many listed files are looked up in the database at once
+const collectBatchSize = 500
+
+// ErrCollectionRunning is returned when a collection is started while another is running
+var ErrCollectionRunning = errors.New("media garbage collection is already running")
+
+// BlobReleaser drops references to shared blobs, deleting the file with the last one
+type BlobReleaser interface {
+	Release(hash string) (*storage.Blob, error)
+}
+
+// QuotaReleaser gives users back the storage their removed files used
+type QuotaReleaser interface {
+	Release(userID int, size int64) error
+}
+
+// Collector removes stored media nothing refers to: uploads that were never sent in a
+// message, shared blobs left without attachments and files the database has no record
+// of. Only files older than the grace period are touched, so an upload is not removed
+// before its message has had a chance to be sent.
+type Collector struct {
+	repo    repository.Repository
+	storage storage.Storage
+	grace   time.Duration
+	blobs   BlobReleaser
+	quota   QuotaReleaser
+	dryRun  bool
+	now     func() time.Time
+	running sync.Mutex
+}
+
+// CollectorOption configures optional Collector dependencies
+type CollectorOption func(*Collector)
+
+// WithBlobReleaser releases the blobs of removed attachments instead of leaving them to
+// be collected once no attachment uses them
+func WithBlobReleaser(blobs BlobReleaser) CollectorOption {
+	return func(c *Collector) {
+		c.blobs = blobs
+	}
+}
+
+// WithQuotaReleaser credits removed files back to the storage quota of their owners
+func WithQuotaReleaser(quota QuotaReleaser) CollectorOption {
+	return func(c *Collector) {
+		c.quota = quota
+	}
+}
+
+// WithDryRun makes the collections started by Run only report what they would remove
+func WithDryRun(dryRun bool) CollectorOption {
+	return func(c *Collector) {
+		c.dryRun = dryRun
+	}
+}
+
+// NewCollector creates a Collector removing files from storage that have been
+// unreferenced for longer than grace
+func NewCollector(repo repository.Repository, storage storage.Storage, grace time.Duration, opts ...CollectorOption) *Collector {
+	c := &Collector{
+		repo:    repo,
+		storage: storage,
+		grace:   grace,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Collect removes orphaned media and reports what was removed. In a dry run nothing is
+// deleted and the report lists what would have been. Storage that cannot be listed is
+// not searched for files missing from the database. If an error stops the collection,
+// the report covers what was removed before it.
+func (c *Collector) Collect(dryRun bool) (*models.CollectionReport, error) {
+	if !c.running.TryLock() {
+		return nil, ErrCollectionRunning
+	}
+	defer c.running.Unlock()
+
+	cutoff := c.now().Add(-c.grace)
+	report := &models.CollectionReport{DryRun: dryRun, Removed: []models.CollectedFile{}}
+	if err := c.collectAttachments(report, cutoff); err != nil {
+		return report, err
+	}
+	if err := c.collectBlobs(report, cutoff); err != nil {
+		return report, err
+	}
+	if err := c.collectUntracked(report, cutoff); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// Run collects orphaned media every interval until ctx is cancelled
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.Collect(c.dryRun)
+			if errors.Is(err, ErrCollectionRunning) {
+				continue
+			}
+			if report != nil {
+				logReport(report)
+			}
+			if err != nil {
+				log.Printf("Failed to collect orphaned media: %v", err)
+			}
+		}
+	}
+}
+
+func logReport(report *models.CollectionReport) {
+	if len(report.Removed) == 0 {
+		return
+	}
+	if report.DryRun {
+		for _, file := range report.Removed {
+			log.Printf("Media garbage collection would remove %s (%s, %d bytes)", file.Key, file.Reason, file.Size)
+		}
+		log.Printf("Media garbage collection would remove %d files (%d bytes)", len(report.Removed), report.RemovedBytes)
+		return
+	}
+	log.Printf("Removed %d orphaned media files (%d bytes)", len(report.Removed), report.RemovedBytes)
+}
+
+// collectAttachments removes attachments no message carries, along with their files
+func (c *Collector) collectAttachments(report *models.CollectionReport, cutoff time.Time) error {
+	attachments, err := c.repo.ListUnattachedAttachments(cutoff, collectBatchSize)
+	if err != nil {
+		return err
+	}
+	for i := range attachments {
+		attachment := &attachments[i]
+		file := models.CollectedFile{
+			Key:          attachment.Key,
+			Size:         attachment.Size,
+			Reason:       models.ReasonUnattached,
+			AttachmentID: attachment.ID,
+		}
+		if report.DryRun {
+			report.Add(file)
+			continue
+		}
+
+		deleted, err := c.repo.DeleteUnattachedAttachment(attachment.ID)
+		if err != nil {
+			log.Printf("Failed to delete attachment %d: %v", attachment.ID, err)
+			report.Failed++
+			continue
+		}
+		if !deleted {
+			// Sent in a message since it was listed
+			continue
+		}
+		c.removeAttachmentFiles(attachment)
+		report.Add(file)
+	}
+	return nil
+}
+
+// RemoveAttachments deletes the given attachments and their files straight away, without
+// waiting for the grace period, for files that must not outlive the messages that carried
+// them. Attachments a message or scheduled message still carries are kept.
+func (c *Collector) RemoveAttachments(ids []int) error {
+	attachments, err := c.repo.GetAttachments(ids)
+	if err != nil {
+		return err
+	}
+	for i := range attachments {
+		attachment := &attachments[i]
+		deleted, err := c.repo.DeleteUnattachedAttachment(attachment.ID)
+		if err != nil {
+			log.Printf("Failed to delete attachment %d: %v", attachment.ID, err)
+			continue
+		}
+		if deleted {
+			c.removeAttachmentFiles(attachment)
+		}
+	}
+	return nil
+}
+
+// removeAttachmentFiles deletes a removed attachment's file and variants, unless they
+// belong to a blob other attachments still use. Files that cannot be deleted are left
+// for collectUntracked to find on a later run.
+func (c *Collector) removeAttachmentFiles(attachment *models.Attachment) {
+	ownerID, size := attachment.OwnerID, attachment.Size
+	if strings.HasPrefix(attachment.Key, storage.BlobPrefix) {
+		if c.blobs == nil || attachment.SHA256 == "" {
+			// collectBlobs removes the blob once no attachment uses it
+			return
+		}
+		blob, err := c.blobs.Release(attachment.SHA256)
+		if err != nil {
+			log.Printf("Failed to release blob %s: %v", attachment.Key, err)
+		}
+		if blob == nil {
+			return
+		}
+		// The blob's uploader was charged for it
+		ownerID, size = blob.OwnerID, blob.Size
+	} else {
+		c.delete(attachment.Key)
+	}
+
+	for _, variant := range attachment.Variants {
+		c.delete(models.VariantKey(attachment.Key, variant.Name))
+	}
+	c.releaseQuota(ownerID, size)
+}
+
+// collectBlobs removes blobs no attachment uses. Their counted references were held by
+// attachments deleted without releasing them, such as those of deleted users.
+func (c *Collector) collectBlobs(report *models.CollectionReport, cutoff time.Time) error {
+	blobs, err := c.repo.ListUnreferencedBlobs(cutoff, collectBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		file := models.CollectedFile{Key: blob.Key, Size: blob.Size, Reason: models.ReasonUnreferencedBlob}
+		if report.DryRun {
+			report.Add(file)
+			continue
+		}
+
+		deleted, err := c.repo.DeleteUnreferencedBlob(blob.Hash, cutoff)
+		if err != nil {
+			log.Printf("Failed to delete blob %s: %v", blob.Key, err)
+			report.Failed++
+			continue
+		}
+		if !deleted {
+			// Acquired by a new upload since it was listed
+			continue
+		}
+		// Variants are named by the attachments that are gone, so collectUntracked finds them
+		c.delete(blob.Key)
+		c.releaseQuota(blob.OwnerID, blob.Size)
+		report.Add(file)
+	}
+	return nil
+}
+
+// collectUntracked removes stored files nothing in the database refers to, such as
+// replaced avatars and files left behind when deleting them failed
+func (c *Collector) collectUntracked(report *models.CollectionReport, cutoff time.Time) error {
+	lister, ok := c.storage.(storage.Lister)
+	if !ok {
+		return nil
+	}
+
+	var batch []storage.StoredObject
+	err := lister.List("", func(obj storage.StoredObject) error {
+		if !obj.ModTime.Before(cutoff) || !models.ValidKey(obj.Key) {
+			return nil
+		}
+		batch = append(batch, obj)
+		if len(batch) < collectBatchSize {
+			return nil
+		}
+		err := c.removeUntracked(report, batch)
+		batch = batch[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return c.removeUntracked(report, batch)
+}
+
+// removeUntracked removes the files in batch whose original, for variants, is unknown
+func (c *Collector) removeUntracked(report *models.CollectionReport, batch []storage.StoredObject) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(batch))
+	seen := make(map[string]bool, len(batch))
+	for _, obj := range batch {
+		if key := models.BaseKey(obj.Key); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	unknown, err := c.repo.UnknownKeys(keys)
+	if err != nil {
+		return err
+	}
+	untracked := make(map[string]bool, len(unknown))
+	for _, key := range unknown {
+		untracked[key] = true
+	}
+
+	for _, obj := range batch {
+		if !untracked[models.BaseKey(obj.Key)] {
+			continue
+		}
+		if !report.DryRun {
+			if err := c.storage.Delete(obj.Key); err != nil {
+				log.Printf("Failed to delete untracked file %s: %v", obj.Key, err)
+				report.Failed++
+				continue
+			}
+		}
+		report.Add(models.CollectedFile{Key: obj.Key, Size: obj.Size, Reason: models.ReasonUntracked})
+	}
+	return nil
+}
+
+func (c *Collector) delete(key string) {
+	if err := c.storage.Delete(key); err != nil {
+		log.Printf("Failed to delete %s: %v", key, err)
+	}
+}
+
+func (c *Collector) releaseQuota(userID int, size int64) {
+	if c.quota == nil || userID <= 0 || size <= 0 {
+		return
+	}
+	if err := c.quota.Release(userID, size); err != nil {
+		log.Printf("Failed to release %d bytes of storage for user %d: %v", size, userID, err)
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// quotaLedger records the storage given back to each user
+type quotaLedger map[int]int64
+
+func (q quotaLedger) Release(userID int, size int64) error {
+	q[userID] += size
+	return nil
+}
+
+func removedKeys(report *models.CollectionReport) map[string]string {
+	keys := make(map[string]string)
+	for _, file := range report.Removed {
+		keys[file.Key] = file.Reason
+	}
+	return keys
+}
+
+func TestCollector(t *testing.T) {
+	dir := t.TempDir()
+	files := storage.NewLocalStorage(dir, "/api/media")
+	repo := repository.NewTestMediaRepository()
+	blobs := storage.NewBlobStore(files, repo)
+	quota := quotaLedger{}
+
+	store := func(key, content string) {
+		_, err := files.Upload(key, strings.NewReader(content), "image/jpeg")
+		require.NoError(t, err)
+	}
+	exists := func(key string) bool {
+		_, err := os.Stat(filepath.Join(dir, key))
+		return err == nil
+	}
+
+	// A sent upload and its thumbnail stay
+	store("1_sent.jpg", "sent")
+	store("1_sent.jpg~thumb_160.jpg", "thumb")
+	require.NoError(t, repo.CreateAttachment(&models.Attachment{OwnerID: 1, Key: "1_sent.jpg", Size: 4,
+		Variants: []models.Variant{{Name: "thumb_160"}}}))
+	repo.AddMessage(1, 2, "1_sent.jpg")
+
+	// An upload that was never sent goes with its thumbnail
+	store("1_unsent.jpg", "unsent")
+	store("1_unsent.jpg~thumb_160.jpg", "thumb")
+	unsent := &models.Attachment{OwnerID: 1, Key: "1_unsent.jpg", Size: 6, Variants: []models.Variant{{Name: "thumb_160"}}}
+	require.NoError(t, repo.CreateAttachment(unsent))
+
+	// An unsent upload of a shared blob releases it, charging the blob's uploader
+	blob, _, err := blobs.Store("aaa", strings.NewReader("shared"), 6, "image/jpeg", ".jpg", 3)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateAttachment(&models.Attachment{OwnerID: 2, Key: blob.Key, SHA256: "aaa", Size: 6}))
+
+	// A blob whose attachments were deleted without releasing it
+	orphan, _, err := blobs.Store("bbb", strings.NewReader("orphaned"), 8, "image/jpeg", ".jpg", 4)
+	require.NoError(t, err)
+
+	// Avatars are kept while a profile uses them
+	store("avatars/1_new.png", "new")
+	repo.AddStoredKey("avatars/1_new.png")
+	store("avatars/1_old.png", "old")
+
+	// Files younger than the grace period are kept whatever refers to them
+	store("2_fresh.jpg", "fresh")
+	later := time.Now().Add(2 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "2_fresh.jpg"), later, later))
+
+	collector := NewCollector(repo, files, 30*time.Minute, WithBlobReleaser(blobs), WithQuotaReleaser(quota))
+	collector.now = func() time.Time { return time.Now().Add(time.Hour) }
+	expected := map[string]string{
+		"1_unsent.jpg":      models.ReasonUnattached,
+		blob.Key:            models.ReasonUnattached,
+		orphan.Key:          models.ReasonUnreferencedBlob,
+		"avatars/1_old.png": models.ReasonUntracked,
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		report, err := collector.Collect(true)
+		require.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, expected, removedKeys(report))
+		assert.Equal(t, int64(6+6+8+3), report.RemovedBytes)
+
+		for key := range expected {
+			assert.True(t, exists(key), key)
+		}
+		_, err = repo.GetAttachment(unsent.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, quota)
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		report, err := collector.Collect(false)
+		require.NoError(t, err)
+		assert.False(t, report.DryRun)
+		assert.Equal(t, expected, removedKeys(report))
+		assert.Zero(t, report.Failed)
+
+		for key := range expected {
+			assert.False(t, exists(key), key)
+		}
+		assert.False(t, exists("1_unsent.jpg~thumb_160.jpg"))
+		for _, key := range []string{"1_sent.jpg", "1_sent.jpg~thumb_160.jpg", "avatars/1_new.png", "2_fresh.jpg"} {
+			assert.True(t, exists(key), key)
+		}
+
+		_, err = repo.GetAttachment(unsent.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.Zero(t, repo.BlobRefs("aaa"))
+		assert.Zero(t, repo.BlobRefs("bbb"))
+		assert.Equal(t, quotaLedger{1: 6, 3: 6, 4: 8}, quota)
+	})
+
+	t.Run("nothing left", func(t *testing.T) {
+		report, err := collector.Collect(false)
+		require.NoError(t, err)
+		assert.Empty(t, report.Removed)
+	})
+
+	t.Run("one run at a time", func(t *testing.T) {
+		collector.running.Lock()
+		defer collector.running.Unlock()
+		_, err := collector.Collect(true)
+		assert.ErrorIs(t, err, ErrCollectionRunning)
+	})
+}
+
+func TestCollectorKeepsBlobsBeingAcquired(t *testing.T) {
+	dir := t.TempDir()
+	files := storage.NewLocalStorage(dir, "/api/media")
+	repo := repository.NewTestMediaRepository()
+	blobs := storage.NewBlobStore(files, repo)
+	quota := quotaLedger{}
+
+	// An upload that was never sent holds a blob...
+	blob, _, err := blobs.Store("ccc", strings.NewReader("shared"), 6, "image/jpeg", ".jpg", 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateAttachment(&models.Attachment{OwnerID: 1, Key: blob.Key, SHA256: "ccc", Size: 6}))
+	time.Sleep(50 * time.Millisecond)
+
+	// ...that a new upload of the same content has acquired but not saved its attachment for
+	_, _, err = blobs.Acquire("ccc")
+	require.NoError(t, err)
+
+	collector := NewCollector(repo, files, 20*time.Millisecond, WithBlobReleaser(blobs), WithQuotaReleaser(quota))
+	report, err := collector.Collect(false)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{blob.Key: models.ReasonUnattached}, removedKeys(report))
+	assert.Equal(t, 1, repo.BlobRefs("ccc"))
+	_, err = os.Stat(filepath.Join(dir, blob.Key))
+	assert.NoError(t, err)
+	assert.Empty(t, quota)
+}
+
+func TestRemoveAttachments(t *testing.T) {
+	dir := t.TempDir()
+	files := storage.NewLocalStorage(dir, "/api/media")
+	repo := repository.NewTestMediaRepository()
+	quota := quotaLedger{}
+	collector := NewCollector(repo, files, time.Hour, WithQuotaReleaser(quota))
+
+	store := func(key string) *models.Attachment {
+		_, err := files.Upload(key, strings.NewReader("data"), "image/jpeg")
+		require.NoError(t, err)
+		attachment := &models.Attachment{OwnerID: 1, Key: key, Size: 4}
+		require.NoError(t, repo.CreateAttachment(attachment))
+		return attachment
+	}
+	exists := func(key string) bool {
+		_, err := os.Stat(filepath.Join(dir, key))
+		return err == nil
+	}
+
+	// Removed at once, without waiting for the grace period
+	expired := store("1_expired.jpg")
+	// Still carried by another copy of a broadcast
+	shared := store("1_shared.jpg")
+	repo.AddMessage(1, 3, "1_shared.jpg")
+
+	require.NoError(t, collector.RemoveAttachments([]int{expired.ID, shared.ID, 999}))
+
+	assert.False(t, exists("1_expired.jpg"))
+	_, err := repo.GetAttachment(expired.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.True(t, exists("1_shared.jpg"))
+	_, err = repo.GetAttachment(shared.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, quotaLedger{1: 4}, quota)
+}
@@ -0,0 +1,39 @@
+// Package service provides the business logic for serving uploaded media
+package service
+
+import (
+	"io"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+)
+
+// Service defines the media access operations interface
+type Service interface {
+	// Authorize returns nil when userID may read the file stored under key: public files,
+	// the user's own uploads, and media from conversations the user takes part in
+	Authorize(userID int, key string) error
+	// SignURL returns an expiring URL for key that needs no Authorization header, on
+	// behalf of userID
+	SignURL(userID int, key string) (*models.SignedURL, error)
+	// VerifySignature checks the expiry and signature of a signed media URL and returns
+	// the user it was signed for
+	VerifySignature(key, user, expires, signature string) (int, error)
+	// Open returns the file stored under key for streaming to userID, who is zero when
+	// unknown, such as for avatars
+	Open(userID int, key string) (*File, error)
+}
+
+// File is a stored file opened for download
+type File struct {
+	Key string
+	// Filename is the name the file was uploaded with, empty when it is unknown, such as
+	// for thumbnails
+	Filename    string
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+	ETag        string
+	// Content reads the file from any offset and must be closed
+	Content io.ReadSeekCloser
+}
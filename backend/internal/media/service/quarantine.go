@@ -0,0 +1,69 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/storage"
+)
+
+const (
+	defaultQuarantinePageSize = 50
+	maxQuarantinePageSize     = 100
+)
+
+// Quarantine lets administrators review the uploads a malware scanner set aside
+type Quarantine struct {
+	repo    repository.Repository
+	storage storage.Storage
+}
+
+// NewQuarantine creates a Quarantine reading files held in storage
+func NewQuarantine(repo repository.Repository, storage storage.Storage) *Quarantine {
+	return &Quarantine{repo: repo, storage: storage}
+}
+
+// List returns up to limit quarantined files, newest first, continuing from beforeID
+// when it is not zero
+func (q *Quarantine) List(beforeID, limit int) ([]models.QuarantinedFile, error) {
+	if limit <= 0 {
+		limit = defaultQuarantinePageSize
+	}
+	if limit > maxQuarantinePageSize {
+		limit = maxQuarantinePageSize
+	}
+	return q.repo.ListQuarantinedFiles(beforeID, limit)
+}
+
+// Open returns a quarantined file and its content, which the caller must close
+func (q *Quarantine) Open(id int) (*models.QuarantinedFile, io.ReadCloser, error) {
+	opener, ok := q.storage.(storage.Reader)
+	if !ok {
+		return nil, nil, ErrUnsupportedStorage
+	}
+	file, err := q.repo.GetQuarantinedFile(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := opener.Open(file.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open quarantined file: %w", err)
+	}
+	return file, content, nil
+}
+
+// Delete removes a quarantined file once it has been reviewed
+func (q *Quarantine) Delete(id int) (*models.QuarantinedFile, error) {
+	file, err := q.repo.DeleteQuarantinedFile(id)
+	if err != nil {
+		return nil, err
+	}
+	// An undeleted file is no longer recorded, so garbage collection removes it later
+	if err := q.storage.Delete(file.Key); err != nil {
+		log.Printf("Failed to delete quarantined file %s: %v", file.Key, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	files := storage.NewLocalStorage(dir, "/api/media")
+	repo := repository.NewTestMediaRepository()
+	quarantine := NewQuarantine(repo, files)
+
+	var held []*models.QuarantinedFile
+	for i, content := range []string{"first", "second", "third"} {
+		key := models.QuarantinePrefix + "1_" + strings.Repeat(string(rune('a'+i)), 32) + ".png"
+		_, err := files.Upload(key, strings.NewReader(content), "image/png")
+		require.NoError(t, err)
+		file := &models.QuarantinedFile{OwnerID: 1, Key: key, ContentType: "image/png", Size: int64(len(content)),
+			Signature: "PUA.Win.Adware.Test"}
+		require.NoError(t, repo.CreateQuarantinedFile(file))
+		held = append(held, file)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		page, err := quarantine.List(0, 2)
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, held[2].ID, page[0].ID)
+		assert.Equal(t, held[1].ID, page[1].ID)
+
+		page, err = quarantine.List(page[1].ID, 2)
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, held[0].ID, page[0].ID)
+	})
+
+	t.Run("open", func(t *testing.T) {
+		file, content, err := quarantine.Open(held[1].ID)
+		require.NoError(t, err)
+		defer content.Close()
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(data))
+		assert.Equal(t, held[1].Key, file.Key)
+
+		_, _, err = quarantine.Open(999)
+		assert.ErrorIs(t, err, repository.ErrQuarantinedFileNotFound)
+
+		_, _, err = NewQuarantine(repo, plainStorage{}).Open(held[1].ID)
+		assert.ErrorIs(t, err, ErrUnsupportedStorage)
+	})
+
+	t.Run("garbage collection keeps quarantined files", func(t *testing.T) {
+		collector := NewCollector(repo, files, time.Minute)
+		collector.now = func() time.Time { return time.Now().Add(time.Hour) }
+		report, err := collector.Collect(false)
+		require.NoError(t, err)
+		assert.Empty(t, report.Removed)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		file, err := quarantine.Delete(held[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, held[0].Key, file.Key)
+		_, err = os.Stat(filepath.Join(dir, held[0].Key))
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = quarantine.Delete(held[0].ID)
+		assert.ErrorIs(t, err, repository.ErrQuarantinedFileNotFound)
+	})
+}
@@ -0,0 +1,199 @@
+// Package service implements the media access business logic
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/storage"
+)
+
+var (
+	// ErrInvalidKey is returned for keys that do not name a stored file
+	ErrInvalidKey = errors.New("invalid media key")
+	// ErrForbidden is returned when a user may not read a file
+	ErrForbidden = errors.New("not allowed to access this media")
+	// ErrInvalidSignature is returned when a signed URL is malformed, tampered with or expired
+	ErrInvalidSignature = errors.New("invalid or expired media signature")
+	// ErrUnsupportedStorage is returned when the storage backend cannot serve files
+	ErrUnsupportedStorage = errors.New("storage backend cannot serve media")
+	// ErrNotFound is returned when no file is stored under a key
+	ErrNotFound = errors.New("media not found")
+)
+
+// MediaService provides the implementation of the Service interface
+type MediaService struct {
+	repo       repository.Repository
+	storage    storage.Storage
+	signingKey []byte
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+// NewMediaService creates a new MediaService instance. Signed URLs are valid for ttl
+// and authenticated with signingKey.
+func NewMediaService(repo repository.Repository, storage storage.Storage, signingKey []byte, ttl time.Duration) Service {
+	return &MediaService{
+		repo:       repo,
+		storage:    storage,
+		signingKey: signingKey,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+}
+
+func (s *MediaService) Authorize(userID int, key string) error {
+	if !models.ValidKey(key) {
+		return ErrInvalidKey
+	}
+	if models.IsPublic(key) {
+		return nil
+	}
+	if models.IsQuarantined(key) {
+		return ErrForbidden
+	}
+	// Thumbnails and poster frames are readable by whoever may read the original
+	key = models.BaseKey(key)
+	if ownerID, ok := models.OwnerID(key); ok {
+		if ownerID == userID {
+			return nil
+		}
+	} else {
+		// Blobs are shared by everyone who uploaded the same content
+		owner, err := s.repo.HasAttachment(userID, key)
+		if err != nil {
+			return err
+		}
+		if owner {
+			return nil
+		}
+	}
+
+	participant, err := s.repo.IsParticipant(userID, key)
+	if err != nil {
+		return err
+	}
+	if !participant {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// SignURL prefers a presigned URL from the storage backend so the file is fetched
+// from it directly, and otherwise signs a URL served by this application. The URL
+// names userID so downloads through it carry the filename userID knows the file by.
+func (s *MediaService) SignURL(userID int, key string) (*models.SignedURL, error) {
+	if !models.ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	expiresAt := s.now().Add(s.ttl).Truncate(time.Second)
+
+	if presigner, ok := s.storage.(storage.Presigner); ok {
+		signed, err := presigner.PresignGet(key, s.ttl)
+		if err != nil {
+			return nil, err
+		}
+		return &models.SignedURL{URL: signed, ExpiresAt: expiresAt}, nil
+	}
+
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	user := strconv.Itoa(userID)
+	query := url.Values{}
+	query.Set("user", user)
+	query.Set("expires", expires)
+	query.Set("signature", s.signature(key, user, expires))
+	return &models.SignedURL{
+		URL:       models.URLForKey(key) + "?" + query.Encode(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (s *MediaService) VerifySignature(key, user, expires, signature string) (int, error) {
+	if !models.ValidKey(key) {
+		return 0, ErrInvalidKey
+	}
+	userID, err := strconv.Atoi(user)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || s.now().Unix() > expiresAt {
+		return 0, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(key, user, expires))) {
+		return 0, ErrInvalidSignature
+	}
+	return userID, nil
+}
+
+func (s *MediaService) Open(userID int, key string) (*File, error) {
+	if !models.ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	reader, ok := s.storage.(storage.Reader)
+	if !ok {
+		return nil, ErrUnsupportedStorage
+	}
+
+	info, err := reader.Stat(key)
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open media: %w", err)
+	}
+	file := &File{
+		Key:         key,
+		ContentType: info.ContentType,
+		Size:        info.Size,
+		ModTime:     info.ModTime,
+		ETag:        info.ETag,
+	}
+
+	// Uploads are served with the name and type they were recorded with. Thumbnails
+	// and files such as avatars have no attachment.
+	if models.BaseKey(key) == key {
+		attachment, err := s.repo.GetAttachmentByKey(key)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("failed to open media: %w", err)
+		}
+		if attachment != nil {
+			file.ContentType = attachment.ContentType
+			if _, owned := models.OwnerID(key); owned {
+				file.Filename = attachment.Filename
+			} else if userID != 0 {
+				// Shared blobs were also uploaded under other users' names, which are not
+				// given away: only the name userID uploaded the file or received it with is
+				visible, err := s.repo.GetAttachmentForUser(userID, key)
+				if err != nil && !errors.Is(err, repository.ErrNotFound) {
+					return nil, fmt.Errorf("failed to open media: %w", err)
+				}
+				if visible != nil {
+					file.Filename = visible.Filename
+				}
+			}
+		}
+	}
+	if file.ContentType == "" {
+		file.ContentType = "application/octet-stream"
+	}
+
+	file.Content = storage.NewSeeker(reader, key, info.Size)
+	return file, nil
+}
+
+// signature computes the hex HMAC-SHA256 of a key, the user it is signed for and its
+// expiry time
+func (s *MediaService) signature(key, user, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + user + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainStorage can neither serve local files nor presign URLs
+type plainStorage struct{}
+
+func (plainStorage) Upload(filename string, content io.Reader, contentType string) (string, error) {
+	return "/api/media/" + filename, nil
+}
+
+func (plainStorage) Delete(filename string) error { return nil }
+
+// presignStorage issues its own download URLs
+type presignStorage struct {
+	plainStorage
+	err error
+	ttl time.Duration
+}
+
+func (s *presignStorage) PresignGet(filename string, ttl time.Duration) (string, error) {
+	s.ttl = ttl
+	if s.err != nil {
+		return "", s.err
+	}
+	return "https://bucket.example/" + filename + "?X-Amz-Signature=abc", nil
+}
+
+func TestAuthorize(t *testing.T) {
+	repo := repository.NewTestMediaRepository()
+	repo.AddMessage(1, 2, "1_shared.jpg")
+	// Users 1 and 4 uploaded the same file, which is stored once
+	for _, owner := range []int{1, 4} {
+		require.NoError(t, repo.CreateAttachment(&models.Attachment{OwnerID: owner, Key: "blobs/abc.png", ContentType: "image/png"}))
+	}
+	svc := NewMediaService(repo, plainStorage{}, []byte("secret"), time.Minute)
+
+	tests := []struct {
+		name    string
+		userID  int
+		key     string
+		wantErr error
+	}{
+		{name: "owner", userID: 1, key: "1_private.jpg"},
+		{name: "recipient", userID: 2, key: "1_shared.jpg"},
+		{name: "public avatar", userID: 3, key: "avatars/1_1.png"},
+		{name: "recipient reads thumbnail", userID: 2, key: "1_shared.jpg~thumb_320.jpg"},
+		{name: "stranger", userID: 3, key: "1_shared.jpg", wantErr: ErrForbidden},
+		{name: "stranger reads thumbnail", userID: 3, key: "1_shared.jpg~thumb_320.jpg", wantErr: ErrForbidden},
+		{name: "other user's upload", userID: 2, key: "1_private.jpg", wantErr: ErrForbidden},
+		{name: "blob uploader", userID: 4, key: "blobs/abc.png"},
+		{name: "blob uploader reads thumbnail", userID: 1, key: "blobs/abc.png~thumb_160.jpg"},
+		{name: "blob stranger", userID: 3, key: "blobs/abc.png", wantErr: ErrForbidden},
+		{name: "quarantined upload", userID: 1, key: "quarantine/1_bad.png", wantErr: ErrForbidden},
+		{name: "traversal", userID: 1, key: "../1_private.jpg", wantErr: ErrInvalidKey},
+		{name: "empty", userID: 1, key: "", wantErr: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.Authorize(tt.userID, tt.key)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSignURLAndVerify(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewMediaService(repository.NewTestMediaRepository(), plainStorage{}, []byte("secret"), 15*time.Minute).(*MediaService)
+	svc.now = func() time.Time { return now }
+
+	signed, err := svc.SignURL(7, "1_abc.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(15*time.Minute), signed.ExpiresAt)
+	require.True(t, strings.HasPrefix(signed.URL, "/api/media/1_abc.jpg?"))
+
+	parsed, err := url.Parse(signed.URL)
+	require.NoError(t, err)
+	user := parsed.Query().Get("user")
+	expires := parsed.Query().Get("expires")
+	signature := parsed.Query().Get("signature")
+
+	t.Run("valid", func(t *testing.T) {
+		userID, err := svc.VerifySignature("1_abc.jpg", user, expires, signature)
+		assert.NoError(t, err)
+		assert.Equal(t, 7, userID)
+	})
+
+	t.Run("different key", func(t *testing.T) {
+		_, err := svc.VerifySignature("1_other.jpg", user, expires, signature)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("different user", func(t *testing.T) {
+		_, err := svc.VerifySignature("1_abc.jpg", "8", expires, signature)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+		_, err = svc.VerifySignature("1_abc.jpg", "", expires, signature)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("extended expiry", func(t *testing.T) {
+		later := strconv.FormatInt(now.Add(time.Hour).Unix(), 10)
+		_, err := svc.VerifySignature("1_abc.jpg", user, later, signature)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+		_, err = svc.VerifySignature("1_abc.jpg", user, "never", signature)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		svc.now = func() time.Time { return now.Add(16 * time.Minute) }
+		defer func() { svc.now = func() time.Time { return now } }()
+		_, err := svc.VerifySignature("1_abc.jpg", user, expires, signature)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("wrong signing key", func(t *testing.T) {
+		other := NewMediaService(repository.NewTestMediaRepository(), plainStorage{}, []byte("other"), 15*time.Minute).(*MediaService)
+		other.now = svc.now
+		_, err := other.VerifySignature("1_abc.jpg", user, expires, signature)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := svc.SignURL(7, "../etc/passwd")
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+}
+
+func TestSignURLPrefersPresigner(t *testing.T) {
+	store := &presignStorage{}
+	svc := NewMediaService(repository.NewTestMediaRepository(), store, []byte("secret"), 10*time.Minute)
+
+	signed, err := svc.SignURL(1, "1_abc.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "https://bucket.example/1_abc.jpg?X-Amz-Signature=abc", signed.URL)
+	assert.Equal(t, 10*time.Minute, store.ttl)
+
+	store.err = errors.New("boom")
+	_, err = svc.SignURL(1, "1_abc.jpg")
+	assert.Error(t, err)
+}
+
+func TestOpen(t *testing.T) {
+	files := storage.NewLocalStorage(t.TempDir(), "/api/media")
+	repo := repository.NewTestMediaRepository()
+	for key, content := range map[string]string{
+		"1_clip.mp4":                "video",
+		"1_clip.mp4~poster_640.jpg": "poster",
+		"blobs/abc.png":             "shared",
+		"avatars/1_1.png":           "avatar",
+	} {
+		_, err := files.Upload(key, strings.NewReader(content), "")
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.CreateAttachment(&models.Attachment{OwnerID: 1, Key: "1_clip.mp4", ContentType: "video/mp4", Filename: "holiday.mp4"}))
+	secret := &models.Attachment{OwnerID: 2, Key: "blobs/abc.png", ContentType: "image/png", Filename: "secret plans.png"}
+	require.NoError(t, repo.CreateAttachment(secret))
+	svc := NewMediaService(repo, files, []byte("secret"), time.Minute)
+
+	t.Run("upload", func(t *testing.T) {
+		file, err := svc.Open(1, "1_clip.mp4")
+		require.NoError(t, err)
+		defer file.Content.Close()
+		assert.Equal(t, "holiday.mp4", file.Filename)
+		assert.Equal(t, "video/mp4", file.ContentType)
+		assert.Equal(t, int64(5), file.Size)
+		assert.NotEmpty(t, file.ETag)
+		assert.False(t, file.ModTime.IsZero())
+		data, err := io.ReadAll(file.Content)
+		require.NoError(t, err)
+		assert.Equal(t, "video", string(data))
+	})
+
+	t.Run("variant", func(t *testing.T) {
+		file, err := svc.Open(1, "1_clip.mp4~poster_640.jpg")
+		require.NoError(t, err)
+		defer file.Content.Close()
+		assert.Empty(t, file.Filename)
+		assert.Equal(t, "image/jpeg", file.ContentType)
+	})
+
+	t.Run("shared blob keeps uploader names private", func(t *testing.T) {
+		file, err := svc.Open(1, "blobs/abc.png")
+		require.NoError(t, err)
+		defer file.Content.Close()
+		assert.Empty(t, file.Filename)
+		assert.Equal(t, "image/png", file.ContentType)
+	})
+
+	t.Run("deduplicated upload", func(t *testing.T) {
+		// User 3 uploads the same content as user 2, which is stored once, and sends it to user 4
+		own := &models.Attachment{OwnerID: 3, Key: "blobs/abc.png", ContentType: "image/png", Filename: "diagram.png"}
+		require.NoError(t, repo.CreateAttachment(own))
+		repo.AddAttachmentMessage(3, 4, own.ID)
+		repo.AddAttachmentMessage(2, 5, secret.ID)
+
+		for userID, filename := range map[int]string{2: "secret plans.png", 3: "diagram.png", 4: "diagram.png", 5: "secret plans.png", 6: ""} {
+			file, err := svc.Open(userID, "blobs/abc.png")
+			require.NoError(t, err)
+			file.Content.Close()
+			assert.Equal(t, filename, file.Filename, "user %d", userID)
+		}
+
+		file, err := svc.Open(0, "blobs/abc.png")
+		require.NoError(t, err)
+		defer file.Content.Close()
+		assert.Empty(t, file.Filename, "anonymous requests get no uploader's name")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := svc.Open(1, "1_gone.mp4")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("unsupported storage", func(t *testing.T) {
+		svc := NewMediaService(repo, plainStorage{}, []byte("secret"), time.Minute)
+		_, err := svc.Open(1, "1_clip.mp4")
+		assert.ErrorIs(t, err, ErrUnsupportedStorage)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := svc.Open(1, "a/../../b")
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+}
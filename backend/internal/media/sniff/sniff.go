@@ -0,0 +1,128 @@
+// Package sniff detects the type of uploaded files from their content
+package sniff
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+)
+
+// Length is how much of the start of a file Detect looks at
+const Length = 512
+
+// signature recognises a file type from the start of a file, returning "" when it does not
+type signature func(head []byte) string
+
+// signatures are tried in order before falling back to http.DetectContentType, which
+// does not tell audio from video in Ogg and WebM files
+var signatures = []signature{
+	pdf,
+	zip,
+	ogg,
+	matroska,
+	webp,
+}
+
+// Detect returns the media type of a file starting with head, without parameters such
+// as the charset of text files. Files of no known type are application/octet-stream.
+func Detect(head []byte) string {
+	if len(head) > Length {
+		head = head[:Length]
+	}
+	for _, detect := range signatures {
+		if contentType := detect(head); contentType != "" {
+			return contentType
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+func pdf(head []byte) string {
+	if bytes.HasPrefix(bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF")), []byte("%PDF-")) {
+		return "application/pdf"
+	}
+	return ""
+}
+
+// zip matches local file headers as well as empty and spanned archives
+func zip(head []byte) string {
+	for _, magic := range []string{"PK\x03\x04", "PK\x05\x06", "PK\x07\x08"} {
+		if bytes.HasPrefix(head, []byte(magic)) {
+			return "application/zip"
+		}
+	}
+	return ""
+}
+
+// ogg tells the codec from the first packet, which starts right after the 27 byte page
+// header and its segment table
+func ogg(head []byte) string {
+	if !bytes.HasPrefix(head, []byte("OggS\x00")) || len(head) < 27 {
+		return ""
+	}
+	packet := 27 + int(head[26])
+	if packet > len(head) {
+		return "application/ogg"
+	}
+	first := head[packet:]
+	switch {
+	case bytes.HasPrefix(first, []byte("OpusHead")),
+		bytes.HasPrefix(first, []byte("\x01vorbis")),
+		bytes.HasPrefix(first, []byte("\x7FFLAC")),
+		bytes.HasPrefix(first, []byte("Speex   ")):
+		return "audio/ogg"
+	case bytes.HasPrefix(first, []byte("\x80theora")):
+		return "video/ogg"
+	}
+	return "application/ogg"
+}
+
+// matroska reads the DocType of the EBML header. WebM files whose tracks, which
+// recorders write near the start, hold only audio codecs are audio/webm.
+func matroska(head []byte) string {
+	if !bytes.HasPrefix(head, []byte("\x1A\x45\xDF\xA3")) {
+		return ""
+	}
+	docType := ebmlString(head, []byte("\x42\x82"))
+	switch docType {
+	case "webm":
+		hasAudio := bytes.Contains(head, []byte("A_OPUS")) || bytes.Contains(head, []byte("A_VORBIS"))
+		if hasAudio && !bytes.Contains(head, []byte("V_")) {
+			return "audio/webm"
+		}
+		return "video/webm"
+	case "matroska":
+		return "video/x-matroska"
+	}
+	return ""
+}
+
+// ebmlString returns the value of the first string element with the given ID, whose
+// size must fit the one byte form that headers use
+func ebmlString(head, id []byte) string {
+	i := bytes.Index(head, id)
+	if i < 0 || i+len(id) >= len(head) {
+		return ""
+	}
+	sizeByte := head[i+len(id)]
+	if sizeByte&0x80 == 0 {
+		return ""
+	}
+	start := i + len(id) + 1
+	end := start + int(sizeByte&0x7F)
+	if end > len(head) {
+		return ""
+	}
+	return string(bytes.TrimRight(head[start:end], "\x00"))
+}
+
+func webp(head []byte) string {
+	if len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WEBP")) {
+		return "image/webp"
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package sniff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// oggPage builds the start of an Ogg stream whose first packet begins with packet
+func oggPage(packet string) string {
+	return "OggS\x00\x02" + strings.Repeat("\x00", 20) + "\x01\x13" + packet
+}
+
+// webmHeader builds an EBML header with docType followed by the given track codecs
+func webmHeader(docType string, codecs ...string) string {
+	header := "\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82" + string([]byte{byte(0x80 | len(docType))}) + docType
+	header += "\x18\x53\x80\x67\x01\xFF\xFF\xFF\xFF\xFF\xFF\xFF"
+	for _, codec := range codecs {
+		header += "\x86" + string([]byte{byte(0x80 | len(codec))}) + codec
+	}
+	return header
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"pdf", "%PDF-1.7\n%\xE2\xE3\xCF\xD3\n1 0 obj", "application/pdf"},
+		{"pdf with byte order mark", "\xEF\xBB\xBF%PDF-1.4", "application/pdf"},
+		{"zip", "PK\x03\x04\x14\x00\x00\x00\x08\x00", "application/zip"},
+		{"empty zip", "PK\x05\x06" + strings.Repeat("\x00", 18), "application/zip"},
+		{"ogg opus", oggPage("OpusHead\x01\x02"), "audio/ogg"},
+		{"ogg vorbis", oggPage("\x01vorbis\x00\x00"), "audio/ogg"},
+		{"ogg theora", oggPage("\x80theora\x03"), "video/ogg"},
+		{"ogg unknown codec", oggPage("something"), "application/ogg"},
+		{"webm video", webmHeader("webm", "V_VP9", "A_OPUS"), "video/webm"},
+		{"webm audio", webmHeader("webm", "A_OPUS"), "audio/webm"},
+		{"matroska", webmHeader("matroska", "V_MPEG4/ISO/AVC"), "video/x-matroska"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", "image/webp"},
+		{"png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"mp4", "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom", "video/mp4"},
+		{"text drops charset", "2024-01-01 12:00:00 INFO started", "text/plain"},
+		{"html", "<!DOCTYPE html><html>", "text/html"},
+		{"binary", "\x00\x01\x02\x03\x04", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Detect([]byte(tt.head)))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Package filter provides the built-in content filters for outgoing messages
+package filter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Mousa96/chatting-service/internal/message/service"
+)
+
+// BannedWordFilter matches whole words from a configurable list, ignoring case
+type BannedWordFilter struct {
+	pattern *regexp.Regexp
+	action  service.FilterAction
+}
+
+// NewBannedWordFilter creates a filter for the given words. Matches are redacted with
+// asterisks when action is FilterRedact; otherwise the message is rejected or flagged.
+// An empty word list allows every message.
+func NewBannedWordFilter(words []string, action service.FilterAction) *BannedWordFilter {
+	var quoted []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+
+	f := &BannedWordFilter{action: action}
+	if len(quoted) > 0 {
+		f.pattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return f
+}
+
+func (f *BannedWordFilter) Name() string {
+	return "banned_words"
+}
+
+func (f *BannedWordFilter) Check(msg *service.OutgoingMessage) (service.FilterResult, error) {
+	if f.pattern == nil || !f.pattern.MatchString(msg.Content) {
+		return service.FilterResult{Action: service.FilterAllow}, nil
+	}
+
+	switch f.action {
+	case service.FilterRedact:
+		redacted := f.pattern.ReplaceAllStringFunc(msg.Content, func(word string) string {
+			return strings.Repeat("*", len([]rune(word)))
+		})
+		return service.FilterResult{Action: service.FilterRedact, Content: redacted}, nil
+	case service.FilterFlag:
+		return service.FilterResult{Action: service.FilterFlag, Reason: "message contains a banned word"}, nil
+	default:
+		return service.FilterResult{Action: service.FilterReject, Reason: "message contains a banned word"}, nil
+	}
+}
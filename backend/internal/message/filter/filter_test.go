@@ -0,0 +1,117 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func check(t *testing.T, f service.MessageFilter, senderID int, content string) service.FilterResult {
+	t.Helper()
+	result, err := f.Check(&service.OutgoingMessage{SenderID: senderID, ReceiverIDs: []int{2}, Content: content})
+	require.NoError(t, err)
+	return result
+}
+
+func TestBannedWordFilter(t *testing.T) {
+	tests := []struct {
+		name            string
+		action          service.FilterAction
+		content         string
+		expectedAction  service.FilterAction
+		expectedContent string
+	}{
+		{
+			name:           "Clean message",
+			action:         service.FilterReject,
+			content:        "hello there",
+			expectedAction: service.FilterAllow,
+		},
+		{
+			name:           "Banned word inside another word",
+			action:         service.FilterReject,
+			content:        "a classic darnell",
+			expectedAction: service.FilterAllow,
+		},
+		{
+			name:           "Reject",
+			action:         service.FilterReject,
+			content:        "well DARN it",
+			expectedAction: service.FilterReject,
+		},
+		{
+			name:            "Redact",
+			action:          service.FilterRedact,
+			content:         "darn, heck and darn",
+			expectedAction:  service.FilterRedact,
+			expectedContent: "****, **** and ****",
+		},
+		{
+			name:           "Flag",
+			action:         service.FilterFlag,
+			content:        "heck",
+			expectedAction: service.FilterFlag,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewBannedWordFilter([]string{"darn", " heck "}, tt.action)
+			result := check(t, f, 1, tt.content)
+			assert.Equal(t, tt.expectedAction, result.Action)
+			if tt.expectedContent != "" {
+				assert.Equal(t, tt.expectedContent, result.Content)
+			}
+		})
+	}
+}
+
+func TestLinkBlocklistFilter(t *testing.T) {
+	f := NewLinkBlocklistFilter([]string{"bad.example", "Spam.TEST"})
+
+	tests := []struct {
+		content        string
+		expectedAction service.FilterAction
+	}{
+		{"see https://good.example/page", service.FilterAllow},
+		{"see https://bad.example/page", service.FilterReject},
+		{"visit www.bad.example now", service.FilterReject},
+		{"cheap stuff at spam.test", service.FilterReject},
+		{"notbad.example is fine", service.FilterAllow},
+		{"no links here.", service.FilterAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			assert.Equal(t, tt.expectedAction, check(t, f, 1, tt.content).Action)
+		})
+	}
+}
+
+func TestMaxLengthFilter(t *testing.T) {
+	f := NewMaxLengthFilter(5)
+
+	assert.Equal(t, service.FilterAllow, check(t, f, 1, "héllo").Action)
+	assert.Equal(t, service.FilterReject, check(t, f, 1, "hello!").Action)
+}
+
+func TestRepeatFilter(t *testing.T) {
+	now := time.Now()
+	f := NewRepeatFilter(2, time.Minute)
+	f.now = func() time.Time { return now }
+
+	assert.Equal(t, service.FilterAllow, check(t, f, 1, "buy now").Action)
+	assert.Equal(t, service.FilterAllow, check(t, f, 1, "Buy   NOW").Action)
+	assert.Equal(t, service.FilterReject, check(t, f, 1, "buy now").Action)
+
+	// Other text and other senders are counted separately
+	assert.Equal(t, service.FilterAllow, check(t, f, 1, "something else").Action)
+	assert.Equal(t, service.FilterAllow, check(t, f, 2, "buy now").Action)
+
+	// Once the window has passed the text is allowed again
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, service.FilterAllow, check(t, f, 1, "buy now").Action)
+}
@@ -0,0 +1,32 @@
+package filter
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/Mousa96/chatting-service/internal/message/service"
+)
+
+// MaxLengthFilter rejects messages longer than a number of characters
+type MaxLengthFilter struct {
+	max int
+}
+
+// NewMaxLengthFilter creates a filter allowing at most max characters
+func NewMaxLengthFilter(max int) *MaxLengthFilter {
+	return &MaxLengthFilter{max: max}
+}
+
+func (f *MaxLengthFilter) Name() string {
+	return "max_length"
+}
+
+func (f *MaxLengthFilter) Check(msg *service.OutgoingMessage) (service.FilterResult, error) {
+	if utf8.RuneCountInString(msg.Content) > f.max {
+		return service.FilterResult{
+			Action: service.FilterReject,
+			Reason: fmt.Sprintf("message is longer than %d characters", f.max),
+		}, nil
+	}
+	return service.FilterResult{Action: service.FilterAllow}, nil
+}
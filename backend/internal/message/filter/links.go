@@ -0,0 +1,64 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Mousa96/chatting-service/internal/message/service"
+)
+
+// hostPattern finds host names in message text, with or without a scheme
+var hostPattern = regexp.MustCompile(`(?i)(?:[a-z][a-z0-9+.-]*://)?((?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,63})\b`)
+
+// LinkBlocklistFilter rejects messages linking to blocked domains or their subdomains
+type LinkBlocklistFilter struct {
+	domains map[string]bool
+}
+
+// NewLinkBlocklistFilter creates a filter for the given domains, e.g. "example.com".
+// An empty list allows every message.
+func NewLinkBlocklistFilter(domains []string) *LinkBlocklistFilter {
+	f := &LinkBlocklistFilter{domains: make(map[string]bool)}
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			f.domains[domain] = true
+		}
+	}
+	return f
+}
+
+func (f *LinkBlocklistFilter) Name() string {
+	return "link_blocklist"
+}
+
+func (f *LinkBlocklistFilter) Check(msg *service.OutgoingMessage) (service.FilterResult, error) {
+	if len(f.domains) == 0 {
+		return service.FilterResult{Action: service.FilterAllow}, nil
+	}
+
+	for _, match := range hostPattern.FindAllStringSubmatch(msg.Content, -1) {
+		if domain, blocked := f.blocked(strings.ToLower(match[1])); blocked {
+			return service.FilterResult{
+				Action: service.FilterReject,
+				Reason: fmt.Sprintf("links to %s are not allowed", domain),
+			}, nil
+		}
+	}
+	return service.FilterResult{Action: service.FilterAllow}, nil
+}
+
+// blocked checks host and each of its parent domains against the blocklist
+func (f *LinkBlocklistFilter) blocked(host string) (string, bool) {
+	for {
+		if f.domains[host] {
+			return host, true
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			return "", false
+		}
+		host = host[dot+1:]
+	}
+}
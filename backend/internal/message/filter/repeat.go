@@ -0,0 +1,91 @@
+package filter
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/service"
+)
+
+// RepeatFilter rejects a sender's message when they already sent the same text
+// limit times within the window. History is kept in memory per process.
+type RepeatFilter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	history   map[int][]sentText
+	lastSweep time.Time
+}
+
+type sentText struct {
+	text string
+	at   time.Time
+}
+
+// NewRepeatFilter creates a filter allowing limit identical messages per window
+func NewRepeatFilter(limit int, window time.Duration) *RepeatFilter {
+	return &RepeatFilter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		history: make(map[int][]sentText),
+	}
+}
+
+func (f *RepeatFilter) Name() string {
+	return "repeated_message"
+}
+
+func (f *RepeatFilter) Check(msg *service.OutgoingMessage) (service.FilterResult, error) {
+	text := strings.ToLower(strings.Join(strings.Fields(msg.Content), " "))
+	if text == "" {
+		return service.FilterResult{Action: service.FilterAllow}, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	cutoff := now.Add(-f.window)
+	f.sweep(now, cutoff)
+
+	// Drop expired entries while counting repeats of this text
+	recent := f.history[msg.SenderID][:0]
+	repeats := 0
+	for _, sent := range f.history[msg.SenderID] {
+		if sent.at.Before(cutoff) {
+			continue
+		}
+		recent = append(recent, sent)
+		if sent.text == text {
+			repeats++
+		}
+	}
+
+	if repeats >= f.limit {
+		f.history[msg.SenderID] = recent
+		return service.FilterResult{
+			Action: service.FilterReject,
+			Reason: "you are sending the same message too often",
+		}, nil
+	}
+
+	f.history[msg.SenderID] = append(recent, sentText{text: text, at: now})
+	return service.FilterResult{Action: service.FilterAllow}, nil
+}
+
+// sweep forgets senders with no messages inside the window, at most once per window
+func (f *RepeatFilter) sweep(now, cutoff time.Time) {
+	if now.Sub(f.lastSweep) < f.window {
+		return
+	}
+	f.lastSweep = now
+	for senderID, sent := range f.history {
+		if len(sent) == 0 || sent[len(sent)-1].at.Before(cutoff) {
+			delete(f.history, senderID)
+		}
+	}
+}
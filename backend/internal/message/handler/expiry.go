@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+)
+
+// GetConversationTimer godoc
+// @Summary Get a conversation's disappearing message timer
+// @Description Get the timer that makes messages in the conversation with another user disappear. timer is null when the conversation has none.
+// @Tags messages
+// @Produce json
+// @Param user_id query int true "Other user's ID"
+// @Success 200 {object} object{timer=models.ConversationTimer} "Conversation timer"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/conversation/timer [get]
+func (h *MessageHandler) GetConversationTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	otherUserID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || otherUserID <= 0 {
+		http.Error(w, "invalid user_id", http.StatusBadRequest)
+		return
+	}
+
+	timer, err := h.messageService.GetConversationTimer(userID, otherUserID)
+	if err != nil {
+		log.Printf("Failed to get conversation timer: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"timer": timer})
+}
+
+// SetConversationTimer godoc
+// @Summary Set a conversation's disappearing message timer
+// @Description Make messages sent in the conversation with another user from now on disappear a number of seconds after they are sent (after_send) or read (after_read). Either participant may change the timer; zero seconds turns it off.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param timer body models.SetConversationTimerRequest true "Timer"
+// @Success 200 {object} object{timer=models.ConversationTimer} "Conversation timer"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "The other user does not accept messages from the caller"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/conversation/timer [put]
+func (h *MessageHandler) SetConversationTimer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetConversationTimerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	timer, err := h.messageService.SetConversationTimer(userID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTimer) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrNotPermitted) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		log.Printf("Failed to set conversation timer: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"timer": timer})
+}
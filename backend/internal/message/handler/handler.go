@@ -3,6 +3,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -30,14 +31,17 @@ func NewMessageHandler(messageService service.Service) Handler {
 
 // SendMessage godoc
 // @Summary Send a message
-// @Description Send a message to another user
+// @Description Send a message to another user. With send_at the message is scheduled to be sent then instead, and the scheduled message is returned with status 202.
 // @Tags messages
 // @Accept json
 // @Produce json
 // @Param message body models.CreateMessageRequest true "Message details"
 // @Success 200 {object} models.Message "Message sent successfully"
+// @Success 202 {object} models.ScheduledMessage "Message scheduled"
 // @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Recipient does not accept messages from the sender"
+// @Failure 422 {object} models.RejectionResponse "Rejected by a content filter"
 // @Failure 500 {string} string "Internal server error"
 // @Security Bearer
 // @Router /messages [post]
@@ -54,9 +58,24 @@ func (h *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.SendAt != nil {
+		h.scheduleMessage(w, userID, &req)
+		return
+	}
 
 	msg, err := h.messageService.SendMessage(userID, &req)
 	if err != nil {
+		if writeRejection(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrNotPermitted) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidMedia) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -130,15 +149,17 @@ func (h *MessageHandler) GetConversation(w http.ResponseWriter, r *http.Request)
 
 // UploadMedia godoc
 // @Summary Upload media file
-// @Description Upload a media file for messages
+// @Description Upload a file for messages. Allowed types and their size limits are configured with ATTACHMENT_TYPES.
 // @Tags messages
 // @Accept multipart/form-data
 // @Produce json
 // @Param file formData file true "Media file to upload"
-// @Success 200 {object} map[string]string "File upload response with URL"
-// @Failure 400 {string} string "Bad request"
+// @Success 200 {object} map[string]interface{} "Uploaded attachment; send its id in attachment_ids"
+// @Failure 400 {string} string "Bad request, or the file was refused by the malware scan"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 413 {string} string "File is over the storage quota or the size allowed for its type"
 // @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "The file could not be scanned"
 // @Security Bearer
 // @Router /messages/upload [post]
 func (h *MessageHandler) UploadMedia(w http.ResponseWriter, r *http.Request) {
@@ -164,35 +185,24 @@ func (h *MessageHandler) UploadMedia(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Read a few bytes to detect content type
-	buffer := make([]byte, 512)
-	n, err := file.Read(buffer)
-	if err != nil {
-		log.Printf("Failed to read file buffer: %v", err)
-		http.Error(w, "failed to read file", http.StatusBadRequest)
+	// Upload file
+	attachment, err := h.messageService.UploadMedia(userID, header)
+	if errors.Is(err, service.ErrMediaTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
 		return
 	}
-	
-	// Reset file pointer
-	_, err = file.Seek(0, 0)
-	if err != nil {
-		log.Printf("Failed to reset file pointer: %v", err)
-		http.Error(w, "failed to process file", http.StatusInternalServerError)
+	if errors.Is(err, service.ErrInvalidMedia) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	
-	// Detect content type
-	contentType := http.DetectContentType(buffer[:n])
-	log.Printf("Detected content type: %s", contentType)
-	
-	if !isAllowedFileType(contentType) {
-		log.Printf("File type not allowed: %s", contentType)
-		http.Error(w, "file type not allowed", http.StatusBadRequest)
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, service.ErrScanFailed) {
+		http.Error(w, "file could not be scanned, try again later", http.StatusServiceUnavailable)
 		return
 	}
-
-	// Upload file
-	url, err := h.messageService.UploadMedia(userID, header)
 	if err != nil {
 		log.Printf("Failed to upload file: %v", err)
 		http.Error(w, "failed to upload file", http.StatusInternalServerError)
@@ -200,19 +210,7 @@ func (h *MessageHandler) UploadMedia(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"url": url,
-	})
-}
-
-func isAllowedFileType(contentType string) bool {
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/png":  true,
-		"image/gif":  true,
-		"video/mp4":  true,
-	}
-	return allowedTypes[contentType]
+	json.NewEncoder(w).Encode(attachment)
 }
 
 // BroadcastMessage godoc
@@ -225,6 +223,8 @@ func isAllowedFileType(contentType string) bool {
 // @Success 200 {object} map[string][]models.Message "Broadcasted messages"
 // @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "A recipient does not accept messages from the sender"
+// @Failure 422 {object} models.RejectionResponse "Rejected by a content filter"
 // @Failure 429 {string} string "Rate limit exceeded"
 // @Failure 500 {string} string "Internal server error"
 // @Security Bearer
@@ -247,6 +247,13 @@ func (h *MessageHandler) BroadcastMessage(w http.ResponseWriter, r *http.Request
 	// Send broadcast message
 	messages, err := h.messageService.BroadcastMessage(userID, &req)
 	if err != nil {
+		if writeRejection(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrNotPermitted) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -329,7 +336,7 @@ func (h *MessageHandler) GetMessageHistory(w http.ResponseWriter, r *http.Reques
 
 // UpdateMessageStatus godoc
 // @Summary Update message status
-// @Description Update a message's delivery status (read, delivered, etc.)
+// @Description Update a message's delivery status (delivered, read, or played for voice messages)
 // @Tags messages
 // @Accept json
 // @Produce json
@@ -384,6 +391,10 @@ func (h *MessageHandler) UpdateMessageStatus(w http.ResponseWriter, r *http.Requ
 	if err := h.messageService.UpdateMessageStatus(req.MessageID, status, userID); err != nil {
 		log.Printf("Error updating message status: %v, userID: %d, messageID: %d", err, userID, req.MessageID)
 		
+		if errors.Is(err, service.ErrInvalidStatus) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if strings.Contains(err.Error(), "not authorized") {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
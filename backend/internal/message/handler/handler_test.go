@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -14,7 +15,9 @@ import (
 	"errors"
 	"time"
 
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
 	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/service"
 	"github.com/Mousa96/chatting-service/internal/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -39,9 +42,38 @@ func (m *mockService) GetConversation(userID, otherUserID int) ([]models.Message
 	return m.mockMessages, nil
 }
 
-func (m *mockService) UploadMedia(userID int, file *multipart.FileHeader) (string, error) {
+func (m *mockService) UploadMedia(userID int, file *multipart.FileHeader) (*mediaModels.Attachment, error) {
 	args := m.Called(userID, file)
-	return args.String(0), args.Error(1)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*mediaModels.Attachment), args.Error(1)
+}
+
+func (m *mockService) ImportMedia(userID int, filename string, content io.ReadSeeker, size int64) (*mediaModels.Attachment, error) {
+	args := m.Called(userID, filename, content, size)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*mediaModels.Attachment), args.Error(1)
+}
+
+func (m *mockService) AdoptMedia(userID int, key, filename, contentType string, size int64) (*mediaModels.Attachment, error) {
+	args := m.Called(userID, key, filename, contentType, size)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*mediaModels.Attachment), args.Error(1)
+}
+
+func (m *mockService) CheckQuota(userID int, size int64) error {
+	args := m.Called(userID, size)
+	return args.Error(0)
+}
+
+func (m *mockService) CheckMedia(contentType string, size int64) error {
+	args := m.Called(contentType, size)
+	return args.Error(0)
 }
 
 func (m *mockService) BroadcastMessage(senderID int, req *models.BroadcastMessageRequest) ([]*models.Message, error) {
@@ -80,6 +112,83 @@ func (m *mockService) GetMessageHistoryPaginated(userID, page, pageSize int) ([]
 	return args.Get(0).([]models.Message), args.Get(1).(*models.Pagination), args.Error(2)
 }
 
+func (m *mockService) ScheduleMessage(senderID int, req *models.CreateMessageRequest) (*models.ScheduledMessage, error) {
+	args := m.Called(senderID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ScheduledMessage), args.Error(1)
+}
+
+func (m *mockService) ListScheduledMessages(senderID, page, pageSize int) ([]models.ScheduledMessage, *models.Pagination, error) {
+	args := m.Called(senderID, page, pageSize)
+	return args.Get(0).([]models.ScheduledMessage), args.Get(1).(*models.Pagination), args.Error(2)
+}
+
+func (m *mockService) UpdateScheduledMessage(senderID int, req *models.UpdateScheduledMessageRequest) (*models.ScheduledMessage, error) {
+	args := m.Called(senderID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ScheduledMessage), args.Error(1)
+}
+
+func (m *mockService) CancelScheduledMessage(senderID, scheduledID int) error {
+	args := m.Called(senderID, scheduledID)
+	return args.Error(0)
+}
+
+func (m *mockService) GetConversationTimer(userID, otherUserID int) (*models.ConversationTimer, error) {
+	args := m.Called(userID, otherUserID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ConversationTimer), args.Error(1)
+}
+
+func (m *mockService) SetConversationTimer(userID int, req *models.SetConversationTimerRequest) (*models.ConversationTimer, error) {
+	args := m.Called(userID, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ConversationTimer), args.Error(1)
+}
+
+func (m *mockService) PinMessage(userID, messageID int) (*models.Pin, error) {
+	args := m.Called(userID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Pin), args.Error(1)
+}
+
+func (m *mockService) UnpinMessage(userID, messageID int) error {
+	args := m.Called(userID, messageID)
+	return args.Error(0)
+}
+
+func (m *mockService) ListPinnedMessages(userID, otherUserID, page, pageSize int) ([]models.PinnedMessage, *models.Pagination, error) {
+	args := m.Called(userID, otherUserID, page, pageSize)
+	return args.Get(0).([]models.PinnedMessage), args.Get(1).(*models.Pagination), args.Error(2)
+}
+
+func (m *mockService) StarMessage(userID, messageID int) error {
+	args := m.Called(userID, messageID)
+	return args.Error(0)
+}
+
+func (m *mockService) UnstarMessage(userID, messageID int) error {
+	args := m.Called(userID, messageID)
+	return args.Error(0)
+}
+
+func (m *mockService) ListStarredMessages(userID, page, pageSize int) ([]models.StarredMessage, *models.Pagination, error) {
+	args := m.Called(userID, page, pageSize)
+	return args.Get(0).([]models.StarredMessage), args.Get(1).(*models.Pagination), args.Error(2)
+}
+
+func (m *mockService) SetNotifier(notifier service.Notifier) {}
+
 func TestSendMessage(t *testing.T) {
 	tests := []struct {
 		name string
@@ -143,6 +252,82 @@ func TestSendMessage(t *testing.T) {
 	}
 }
 
+func TestSendMessageRejected(t *testing.T) {
+	mockService := new(mockService)
+	handler := NewMessageHandler(mockService)
+
+	body := models.CreateMessageRequest{ReceiverID: 2, Content: "buy now"}
+	mockService.On("SendMessage", 1, &body).Return((*models.Message)(nil),
+		fmt.Errorf("wrapped: %w", &service.RejectionError{Filter: "repeated_message", Reason: "too often"}))
+
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewBuffer(payload))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+	rr := httptest.NewRecorder()
+
+	handler.SendMessage(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	var response models.RejectionResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, models.RejectionResponse{
+		Code:    models.RejectionCode,
+		Filter:  "repeated_message",
+		Message: "too often",
+	}, response)
+}
+
+func TestScheduleMessage(t *testing.T) {
+	mockService := new(mockService)
+	handler := NewMessageHandler(mockService)
+
+	sendAt := time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC)
+	scheduled := &models.ScheduledMessage{ID: 7, SenderID: 1, ReceiverID: 2, Content: "later", SendAt: sendAt, Status: models.ScheduledPending}
+	mockService.On("ScheduleMessage", 1, mock.MatchedBy(func(req *models.CreateMessageRequest) bool {
+		return req.SendAt != nil && req.SendAt.Equal(sendAt)
+	})).Return(scheduled, nil)
+
+	payload, _ := json.Marshal(models.CreateMessageRequest{ReceiverID: 2, Content: "later", SendAt: &sendAt})
+	req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewBuffer(payload))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+	rr := httptest.NewRecorder()
+
+	handler.SendMessage(rr, req)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	var response models.ScheduledMessage
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, 7, response.ID)
+	mockService.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything)
+}
+
+func TestCancelScheduledMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"cancelled", nil, http.StatusNoContent},
+		{"not found", service.ErrScheduledNotFound, http.StatusNotFound},
+		{"being sent", service.ErrScheduledSending, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mockService)
+			handler := NewMessageHandler(mockService)
+			mockService.On("CancelScheduledMessage", 1, 7).Return(tt.err)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/messages/scheduled/cancel", bytes.NewBufferString(`{"id":7}`))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+			rr := httptest.NewRecorder()
+
+			handler.CancelScheduledMessage(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+}
+
 func TestGetConversation(t *testing.T) {
 	mockService := new(mockService)
 	handler := NewMessageHandler(mockService)
@@ -206,6 +391,7 @@ func TestUploadMedia(t *testing.T) {
 		fileContent  []byte
 		filename     string
 		contentType  string
+		serviceErr   error
 		expectedCode int
 	}{
 		{
@@ -215,11 +401,36 @@ func TestUploadMedia(t *testing.T) {
 			contentType:  "image/jpeg",
 			expectedCode: http.StatusOK,
 		},
+		{
+			name:         "Undecodable image",
+			fileContent:  []byte{0xFF, 0xD8, 0xFF, 0xE0},
+			filename:     "broken.jpg",
+			contentType:  "image/jpeg",
+			serviceErr:   fmt.Errorf("%w: image could not be decoded", service.ErrInvalidMedia),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Over quota",
+			fileContent:  []byte{0xFF, 0xD8, 0xFF, 0xE0},
+			filename:     "big.jpg",
+			contentType:  "image/jpeg",
+			serviceErr:   fmt.Errorf("%w: file is 4 bytes but only 0 of your 10 byte quota is available", service.ErrQuotaExceeded),
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "Too large for its type",
+			fileContent:  []byte("%PDF-1.7"),
+			filename:     "manual.pdf",
+			contentType:  "application/pdf",
+			serviceErr:   fmt.Errorf("%w: application/pdf files may be at most 4 bytes", service.ErrMediaTooLarge),
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
 		{
 			name:         "Invalid file type",
 			fileContent:  []byte("text content"),
 			filename:     "test.txt",
 			contentType:  "text/plain",
+			serviceErr:   fmt.Errorf("%w: file type text/plain is not allowed", service.ErrInvalidMedia),
 			expectedCode: http.StatusBadRequest,
 		},
 		{
@@ -227,6 +438,7 @@ func TestUploadMedia(t *testing.T) {
 			fileContent:  []byte{},
 			filename:     "empty.jpg",
 			contentType:  "image/jpeg",
+			serviceErr:   fmt.Errorf("%w: file is empty", service.ErrInvalidMedia),
 			expectedCode: http.StatusBadRequest,
 		},
 	}
@@ -252,9 +464,12 @@ func TestUploadMedia(t *testing.T) {
 			ctx := context.WithValue(req.Context(), middleware.UserIDKey, 1)
 			req = req.WithContext(ctx)
 
-			if tt.expectedCode == http.StatusOK {
+			if tt.serviceErr != nil {
 				mockService.On("UploadMedia", 1, mock.AnythingOfType("*multipart.FileHeader")).
-					Return("https://example.com/"+tt.filename, nil)
+					Return(nil, tt.serviceErr)
+			} else if tt.expectedCode == http.StatusOK {
+				mockService.On("UploadMedia", 1, mock.AnythingOfType("*multipart.FileHeader")).
+					Return(&mediaModels.Attachment{ID: 7, URL: "/api/media/1_abc.jpg", ContentType: tt.contentType, Filename: tt.filename}, nil)
 			}
 
 			rr := httptest.NewRecorder()
@@ -263,12 +478,12 @@ func TestUploadMedia(t *testing.T) {
 			assert.Equal(t, tt.expectedCode, rr.Code)
 
 			if tt.expectedCode == http.StatusOK {
-				var response struct {
-					URL string `json:"url"`
-				}
+				var response mediaModels.Attachment
 				err := json.NewDecoder(rr.Body).Decode(&response)
 				assert.NoError(t, err)
-				assert.Contains(t, response.URL, tt.filename)
+				assert.Equal(t, 7, response.ID)
+				assert.Equal(t, "/api/media/1_abc.jpg", response.URL)
+				assert.Equal(t, tt.filename, response.Filename)
 			}
 		})
 	}
@@ -420,3 +635,36 @@ func TestGetMessageHistory(t *testing.T) {
 		mockService.AssertExpectations(t)
 	})
 }
+
+func TestPinMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		pin    *models.Pin
+		err    error
+		status int
+	}{
+		{"pinned", `{"message_id":7}`, &models.Pin{MessageID: 7, PinnedBy: 1}, nil, http.StatusOK},
+		{"not found", `{"message_id":7}`, nil, service.ErrMessageNotFound, http.StatusNotFound},
+		{"limit reached", `{"message_id":7}`, nil, service.ErrPinLimit, http.StatusConflict},
+		{"missing message", `{}`, nil, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mockService)
+			handler := NewMessageHandler(mockService)
+			if tt.pin != nil || tt.err != nil {
+				mockService.On("PinMessage", 1, 7).Return(tt.pin, tt.err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/messages/pinned", bytes.NewBufferString(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+			rr := httptest.NewRecorder()
+
+			handler.PinMessage(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -17,4 +17,26 @@ type Handler interface {
 	GetMessageHistory(w http.ResponseWriter, r *http.Request)
 	// UpdateMessageStatus handles the message status update request
 	UpdateMessageStatus(w http.ResponseWriter, r *http.Request)
+	// ListScheduledMessages lists the current user's scheduled messages
+	ListScheduledMessages(w http.ResponseWriter, r *http.Request)
+	// UpdateScheduledMessage handles editing a scheduled message
+	UpdateScheduledMessage(w http.ResponseWriter, r *http.Request)
+	// CancelScheduledMessage handles cancelling a scheduled message
+	CancelScheduledMessage(w http.ResponseWriter, r *http.Request)
+	// GetConversationTimer retrieves a conversation's disappearing message timer
+	GetConversationTimer(w http.ResponseWriter, r *http.Request)
+	// SetConversationTimer handles setting or clearing a conversation's disappearing message timer
+	SetConversationTimer(w http.ResponseWriter, r *http.Request)
+	// PinMessage handles pinning a message in its conversation
+	PinMessage(w http.ResponseWriter, r *http.Request)
+	// UnpinMessage handles unpinning a message
+	UnpinMessage(w http.ResponseWriter, r *http.Request)
+	// ListPinnedMessages lists the messages pinned in a conversation
+	ListPinnedMessages(w http.ResponseWriter, r *http.Request)
+	// StarMessage handles bookmarking a message
+	StarMessage(w http.ResponseWriter, r *http.Request)
+	// UnstarMessage handles removing a bookmark
+	UnstarMessage(w http.ResponseWriter, r *http.Request)
+	// ListStarredMessages lists the current user's starred messages
+	ListStarredMessages(w http.ResponseWriter, r *http.Request)
 }
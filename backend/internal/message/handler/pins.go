@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+)
+
+// writePinError sends the response for an error from a pin or star operation
+func writePinError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrMessageNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrPinLimit):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Pin operation failed: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// decodeMessageAction reads the message a pin or star request is about
+func decodeMessageAction(w http.ResponseWriter, r *http.Request) (int, bool) {
+	var req models.MessageActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return 0, false
+	}
+	if req.MessageID <= 0 {
+		http.Error(w, "invalid message_id", http.StatusBadRequest)
+		return 0, false
+	}
+	return req.MessageID, true
+}
+
+// PinMessage godoc
+// @Summary Pin a message
+// @Description Pin a message in its conversation. Pins are visible to both participants, who receive a message_pinned event. A conversation can have at most 5 pinned messages.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param message body models.MessageActionRequest true "Message to pin"
+// @Success 200 {object} models.Pin "Pin"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Message not found"
+// @Failure 409 {string} string "Pinned message limit reached"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/pinned [post]
+func (h *MessageHandler) PinMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	messageID, ok := decodeMessageAction(w, r)
+	if !ok {
+		return
+	}
+
+	pin, err := h.messageService.PinMessage(userID, messageID)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, pin)
+}
+
+// UnpinMessage godoc
+// @Summary Unpin a message
+// @Description Unpin a message in its conversation. Either participant may unpin any pinned message; both receive a message_unpinned event.
+// @Tags messages
+// @Accept json
+// @Param message body models.MessageActionRequest true "Message to unpin"
+// @Success 204 "Unpinned"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Message not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/pinned/remove [post]
+func (h *MessageHandler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	messageID, ok := decodeMessageAction(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.messageService.UnpinMessage(userID, messageID); err != nil {
+		writePinError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPinnedMessages godoc
+// @Summary List pinned messages
+// @Description List the messages pinned in the conversation with another user, most recently pinned first
+// @Tags messages
+// @Produce json
+// @Param user_id query int true "Other user's ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Items per page (default: 10, max: 100)"
+// @Success 200 {object} object{pinned_messages=[]models.PinnedMessage,pagination=models.Pagination} "Pinned messages"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/pinned [get]
+func (h *MessageHandler) ListPinnedMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	otherUserID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || otherUserID <= 0 {
+		http.Error(w, "invalid user_id", http.StatusBadRequest)
+		return
+	}
+	page, pageSize, err := GetPaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pinned, pagination, err := h.messageService.ListPinnedMessages(userID, otherUserID, page, pageSize)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+	if pinned == nil {
+		pinned = []models.PinnedMessage{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"pinned_messages": pinned,
+		"pagination":      pagination,
+	})
+}
+
+// StarMessage godoc
+// @Summary Star a message
+// @Description Bookmark a message. Stars are private; the other participant is not told.
+// @Tags messages
+// @Accept json
+// @Param message body models.MessageActionRequest true "Message to star"
+// @Success 204 "Starred"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Message not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/starred [post]
+func (h *MessageHandler) StarMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	messageID, ok := decodeMessageAction(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.messageService.StarMessage(userID, messageID); err != nil {
+		writePinError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnstarMessage godoc
+// @Summary Unstar a message
+// @Description Remove the bookmark of a message
+// @Tags messages
+// @Accept json
+// @Param message body models.MessageActionRequest true "Message to unstar"
+// @Success 204 "Unstarred"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/starred/remove [post]
+func (h *MessageHandler) UnstarMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	messageID, ok := decodeMessageAction(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.messageService.UnstarMessage(userID, messageID); err != nil {
+		writePinError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListStarredMessages godoc
+// @Summary List starred messages
+// @Description List the messages the current user starred across all conversations, most recently starred first
+// @Tags messages
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Items per page (default: 10, max: 100)"
+// @Success 200 {object} object{starred_messages=[]models.StarredMessage,pagination=models.Pagination} "Starred messages"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/starred [get]
+func (h *MessageHandler) ListStarredMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	page, pageSize, err := GetPaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	starred, pagination, err := h.messageService.ListStarredMessages(userID, page, pageSize)
+	if err != nil {
+		writePinError(w, err)
+		return
+	}
+	if starred == nil {
+		starred = []models.StarredMessage{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"starred_messages": starred,
+		"pagination":       pagination,
+	})
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+)
+
+// writeScheduleError sends the response for an error from a scheduled message operation
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSchedule), errors.Is(err, service.ErrInvalidMedia):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrNotPermitted):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrScheduledNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrScheduledSending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Scheduled message operation failed: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// scheduleMessage handles a SendMessage request with send_at set
+func (h *MessageHandler) scheduleMessage(w http.ResponseWriter, userID int, req *models.CreateMessageRequest) {
+	scheduled, err := h.messageService.ScheduleMessage(userID, req)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusAccepted, scheduled)
+}
+
+// ListScheduledMessages godoc
+// @Summary List scheduled messages
+// @Description List the messages the current user has scheduled and not yet sent, soonest first. Messages that could not be sent when due are included with status "failed".
+// @Tags messages
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Items per page (default: 10, max: 100)"
+// @Success 200 {object} object{scheduled_messages=[]models.ScheduledMessage,pagination=models.Pagination} "Scheduled messages"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/scheduled [get]
+func (h *MessageHandler) ListScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	page, pageSize, err := GetPaginationParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scheduled, pagination, err := h.messageService.ListScheduledMessages(userID, page, pageSize)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	if scheduled == nil {
+		scheduled = []models.ScheduledMessage{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"scheduled_messages": scheduled,
+		"pagination":         pagination,
+	})
+}
+
+// UpdateScheduledMessage godoc
+// @Summary Edit a scheduled message
+// @Description Replace the content and send time of a scheduled message. Editing a message that failed to send schedules it again.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param message body models.UpdateScheduledMessageRequest true "New content and send time"
+// @Success 200 {object} models.ScheduledMessage "Updated scheduled message"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Scheduled message not found"
+// @Failure 409 {string} string "Message is being sent"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/scheduled [put]
+func (h *MessageHandler) UpdateScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateScheduledMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ID <= 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	scheduled, err := h.messageService.UpdateScheduledMessage(userID, &req)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, scheduled)
+}
+
+// CancelScheduledMessage godoc
+// @Summary Cancel a scheduled message
+// @Description Delete a scheduled message before it is sent
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param message body models.CancelScheduledMessageRequest true "Scheduled message to cancel"
+// @Success 204 "Cancelled"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Scheduled message not found"
+// @Failure 409 {string} string "Message is being sent"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /messages/scheduled/cancel [post]
+func (h *MessageHandler) CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CancelScheduledMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ID <= 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.messageService.CancelScheduledMessage(userID, req.ID); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
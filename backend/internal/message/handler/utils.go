@@ -5,6 +5,9 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/service"
 )
 
 // GetPaginationParams extracts and validates pagination parameters from request
@@ -39,3 +42,19 @@ func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 	}
 }
+
+// writeRejection sends a structured 422 response when err is a content filter rejection
+// and reports whether it did
+func writeRejection(w http.ResponseWriter, err error) bool {
+	var rejection *service.RejectionError
+	if !errors.As(err, &rejection) {
+		return false
+	}
+
+	WriteJSON(w, http.StatusUnprocessableEntity, models.RejectionResponse{
+		Code:    models.RejectionCode,
+		Filter:  rejection.Filter,
+		Message: rejection.Reason,
+	})
+	return true
+}
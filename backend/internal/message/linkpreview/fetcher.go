@@ -0,0 +1,315 @@
+// Package linkpreview fetches the OpenGraph and Twitter card metadata of linked pages
+// for the preview cards shown under messages
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"golang.org/x/net/html"
+)
+
+const (
+	// defaultTimeout bounds a whole fetch, redirects and body included
+	defaultTimeout = 5 * time.Second
+	// defaultMaxBytes is how much of a page is read looking for its metadata
+	defaultMaxBytes = 512 << 10
+	// maxRedirects is how many redirects are followed before giving up
+	maxRedirects = 5
+	// maxTitle and maxDescription bound the text kept from a page, in characters
+	maxTitle       = 300
+	maxDescription = 1000
+)
+
+var (
+	// ErrForbiddenAddress is returned when a link resolves to an address on the server's
+	// own network, such as loopback, private or link-local addresses
+	ErrForbiddenAddress = errors.New("address is not allowed")
+	// ErrUnsupported is returned for links that are not http or https, and for responses
+	// that are not HTML pages
+	ErrUnsupported = errors.New("link cannot be previewed")
+)
+
+// forbiddenPrefixes are the ranges refused besides those netip classifies as loopback,
+// private, link-local, multicast or unspecified
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Fetcher downloads pages and reads their preview metadata. Every connection, including
+// those made for redirects, is checked after DNS resolution, so a host name cannot be
+// pointed at an internal address to reach services behind the server.
+type Fetcher struct {
+	client       *http.Client
+	maxBytes     int64
+	allowPrivate bool
+}
+
+// Option configures a Fetcher
+type Option func(*Fetcher)
+
+// WithTimeout bounds how long a fetch may take
+func WithTimeout(timeout time.Duration) Option {
+	return func(f *Fetcher) {
+		f.client.Timeout = timeout
+	}
+}
+
+// WithMaxBytes sets how much of a page is read looking for its metadata
+func WithMaxBytes(n int64) Option {
+	return func(f *Fetcher) {
+		f.maxBytes = n
+	}
+}
+
+// WithPrivateNetworks allows links to loopback and private addresses, for development
+// and tests against local servers
+func WithPrivateNetworks() Option {
+	return func(f *Fetcher) {
+		f.allowPrivate = true
+	}
+}
+
+// NewFetcher creates a Fetcher
+func NewFetcher(opts ...Option) *Fetcher {
+	f := &Fetcher{maxBytes: defaultMaxBytes}
+	dialer := &net.Dialer{Timeout: defaultTimeout, Control: f.checkDial}
+	f.client = &http.Client{
+		Timeout: defaultTimeout,
+		Transport: &http.Transport{
+			// Proxies would make the address check meaningless
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   defaultTimeout,
+			ResponseHeaderTimeout: defaultTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return checkScheme(req.URL)
+		},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// checkDial refuses connections to forbidden addresses. It runs with the resolved
+// address of every connection attempt.
+func (f *Fetcher) checkDial(network, address string, _ syscall.RawConn) error {
+	if f.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if forbidden(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+	return nil
+}
+
+func forbidden(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: %s links are not fetched", ErrUnsupported, u.Scheme)
+	}
+	return nil
+}
+
+// Fetch downloads the page at rawURL and returns its preview, or nil when the page has
+// no title or description to show
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", "chatting-service link preview")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%w: %s is not a page", ErrUnsupported, mediaType)
+	}
+
+	meta, err := readMetadata(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return nil, err
+	}
+	// Relative image URLs are resolved against the page the redirects ended on
+	return meta.preview(rawURL, resp.Request.URL), nil
+}
+
+// metadata is what a page's head says about it
+type metadata struct {
+	properties map[string]string
+	title      string
+}
+
+// readMetadata collects the meta tags and title of a page's head, stopping at the body
+func readMetadata(r io.Reader) (*metadata, error) {
+	meta := &metadata{properties: make(map[string]string)}
+	tokens := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			// A page cut short by the size limit still has what was read
+			if err := tokens.Err(); err != io.EOF {
+				return nil, err
+			}
+			return meta, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokens.Token()
+			switch token.Data {
+			case "body":
+				return meta, nil
+			case "title":
+				inTitle = meta.title == ""
+			case "meta":
+				meta.addMeta(token.Attr)
+			}
+		case html.TextToken:
+			if inTitle {
+				meta.title += string(tokens.Text())
+			}
+		case html.EndTagToken:
+			switch tokens.Token().Data {
+			case "head":
+				return meta, nil
+			case "title":
+				inTitle = false
+			}
+		}
+	}
+}
+
+// addMeta records an OpenGraph property or named meta tag, keeping the first of each
+func (m *metadata) addMeta(attrs []html.Attribute) {
+	var key, content string
+	for _, attr := range attrs {
+		switch strings.ToLower(attr.Key) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(attr.Val))
+			}
+		case "content":
+			content = attr.Val
+		}
+	}
+	if key == "" {
+		return
+	}
+	if _, ok := m.properties[key]; !ok {
+		m.properties[key] = content
+	}
+}
+
+// first returns the first of keys the page has a value for
+func (m *metadata) first(keys ...string) string {
+	for _, key := range keys {
+		if value := clean(m.properties[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (m *metadata) preview(linkURL string, pageURL *url.URL) *models.LinkPreview {
+	preview := &models.LinkPreview{
+		URL:         linkURL,
+		Title:       truncate(m.first("og:title", "twitter:title"), maxTitle),
+		Description: truncate(m.first("og:description", "twitter:description", "description"), maxDescription),
+		SiteName:    truncate(m.first("og:site_name"), maxTitle),
+	}
+	if preview.Title == "" {
+		preview.Title = truncate(clean(m.title), maxTitle)
+	}
+	if preview.Title == "" && preview.Description == "" {
+		return nil
+	}
+	if image := m.first("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"); image != "" {
+		if resolved, err := pageURL.Parse(image); err == nil && checkScheme(resolved) == nil {
+			preview.ImageURL = resolved.String()
+		}
+	}
+	return preview
+}
+
+// clean makes page text safe to show: valid UTF-8 without control characters, with runs
+// of whitespace collapsed
+func clean(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
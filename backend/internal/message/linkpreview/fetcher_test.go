@@ -0,0 +1,150 @@
+package linkpreview
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, contentType, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	fetcher := NewFetcher(WithPrivateNetworks())
+
+	t.Run("opengraph", func(t *testing.T) {
+		server := serve(t, "text/html; charset=utf-8", `<!doctype html><html><head>
+			<title>Fallback</title>
+			<meta property="og:title" content="Release &amp; notes">
+			<meta property="og:description" content="  What is
+				new  ">
+			<meta property="og:image" content="/cover.png">
+			<meta property="og:site_name" content="Example">
+			</head><body><meta property="og:title" content="ignored"></body></html>`)
+
+		preview, err := fetcher.Fetch(context.Background(), server.URL+"/post")
+		require.NoError(t, err)
+		require.NotNil(t, preview)
+		assert.Equal(t, server.URL+"/post", preview.URL)
+		assert.Equal(t, "Release & notes", preview.Title)
+		assert.Equal(t, "What is new", preview.Description)
+		assert.Equal(t, server.URL+"/cover.png", preview.ImageURL)
+		assert.Equal(t, "Example", preview.SiteName)
+	})
+
+	t.Run("twitter card and title fallbacks", func(t *testing.T) {
+		server := serve(t, "text/html", `<html><head><title>Page title</title>
+			<meta name="twitter:description" content="Card text">
+			<meta name="twitter:image" content="javascript:alert(1)">`)
+
+		preview, err := fetcher.Fetch(context.Background(), server.URL)
+		require.NoError(t, err)
+		require.NotNil(t, preview)
+		assert.Equal(t, "Page title", preview.Title)
+		assert.Equal(t, "Card text", preview.Description)
+		assert.Empty(t, preview.ImageURL)
+	})
+
+	t.Run("page without metadata", func(t *testing.T) {
+		server := serve(t, "text/html", `<html><body><p>Hello</p></body></html>`)
+		preview, err := fetcher.Fetch(context.Background(), server.URL)
+		require.NoError(t, err)
+		assert.Nil(t, preview)
+	})
+
+	t.Run("long text is truncated", func(t *testing.T) {
+		server := serve(t, "text/html", `<title>`+strings.Repeat("é", 500)+`</title>`)
+		preview, err := fetcher.Fetch(context.Background(), server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, maxTitle, len([]rune(preview.Title)))
+	})
+
+	t.Run("only the start of a page is read", func(t *testing.T) {
+		padding := "<!--" + strings.Repeat("x", 2048) + "-->"
+		server := serve(t, "text/html", padding+`<title>Too far</title>`)
+		preview, err := NewFetcher(WithPrivateNetworks(), WithMaxBytes(1024)).Fetch(context.Background(), server.URL)
+		require.NoError(t, err)
+		assert.Nil(t, preview)
+	})
+
+	t.Run("not a page", func(t *testing.T) {
+		server := serve(t, "image/png", "\x89PNG")
+		_, err := fetcher.Fetch(context.Background(), server.URL)
+		assert.ErrorIs(t, err, ErrUnsupported)
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+		_, err := fetcher.Fetch(context.Background(), server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("other schemes", func(t *testing.T) {
+		_, err := fetcher.Fetch(context.Background(), "file:///etc/passwd")
+		assert.ErrorIs(t, err, ErrUnsupported)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+		_, err := NewFetcher(WithPrivateNetworks(), WithTimeout(50*time.Millisecond)).Fetch(context.Background(), server.URL)
+		assert.Error(t, err)
+	})
+}
+
+func TestFetchRefusesInternalAddresses(t *testing.T) {
+	server := serve(t, "text/html", `<title>Internal</title>`)
+	fetcher := NewFetcher()
+
+	_, err := fetcher.Fetch(context.Background(), server.URL)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+
+	// Host names are checked once resolved
+	_, err = fetcher.Fetch(context.Background(), strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+}
+
+func TestFetchRedirects(t *testing.T) {
+	server := serve(t, "text/html", `<title>Moved here</title>`)
+	fetcher := NewFetcher(WithPrivateNetworks())
+
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirect.Close()
+	preview, err := fetcher.Fetch(context.Background(), redirect.URL)
+	require.NoError(t, err)
+	assert.Equal(t, redirect.URL, preview.URL)
+	assert.Equal(t, "Moved here", preview.Title)
+
+	toFile := httptest.NewServer(http.RedirectHandler("file:///etc/passwd", http.StatusFound))
+	defer toFile.Close()
+	_, err = fetcher.Fetch(context.Background(), toFile.URL)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestForbidden(t *testing.T) {
+	for _, addr := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1",
+		"0.0.0.0", "::1", "fd00::1", "fe80::1", "::ffff:127.0.0.1", "224.0.0.1",
+	} {
+		assert.True(t, forbidden(netip.MustParseAddr(addr)), addr)
+	}
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1::248"} {
+		assert.False(t, forbidden(netip.MustParseAddr(addr)), addr)
+	}
+}
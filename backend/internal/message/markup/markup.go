@@ -0,0 +1,358 @@
+// Package markup parses the Markdown subset messages are written in into plain text and
+// the entities that format it: **bold**, *italic* or _italic_, `code`, ```code blocks```,
+// links and @mentions. Backslashes escape markers that should be shown as written.
+package markup
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+)
+
+const (
+	// maxEntities bounds the entities kept for a message; formatting past it is dropped
+	maxEntities = 100
+	// maxMentions bounds the distinct users a message can mention; later names are text
+	maxMentions = 20
+	// maxDepth bounds how deeply bold and italic nest; deeper markers are text
+	maxDepth = 4
+)
+
+var (
+	// linkPattern matches an http or https link at the start of the text
+	linkPattern = regexp.MustCompile(`(?i)^https?://[^\s<>"]+`)
+	// usernamePattern matches the characters a mention can name, at the start of the text
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+`)
+	// languagePattern matches the language named on the opening line of a code block
+	languagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{0,20}$`)
+)
+
+// Document is a message with its markup parsed
+type Document struct {
+	// Text is the message with markup removed, as stored and shown
+	Text  string
+	spans []span
+}
+
+// span is an entity being parsed, with the username of mentions until they are resolved
+type span struct {
+	entity   models.Entity
+	username string
+}
+
+// Parse reads content as markup. Invalid UTF-8 and control characters other than line
+// breaks and tabs are removed first.
+func Parse(content string) *Document {
+	p := &parser{}
+	p.parse(clean(content), 0)
+	return &Document{Text: p.out.String(), spans: p.spans}
+}
+
+// Usernames returns the distinct usernames mentioned, in the order they first appear
+func (d *Document) Usernames() []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, s := range d.spans {
+		if s.username != "" && !seen[s.username] {
+			seen[s.username] = true
+			usernames = append(usernames, s.username)
+		}
+	}
+	return usernames
+}
+
+// ResolveMentions gives each mention the ID ids holds for its username and returns the
+// IDs of the users mentioned. Mentions of names missing from ids are left as text.
+func (d *Document) ResolveMentions(ids map[string]int) []int {
+	var mentioned []int
+	seen := make(map[int]bool)
+	for i := range d.spans {
+		s := &d.spans[i]
+		if s.username == "" {
+			continue
+		}
+		s.entity.UserID = ids[s.username]
+		if id := s.entity.UserID; id != 0 && !seen[id] {
+			seen[id] = true
+			mentioned = append(mentioned, id)
+		}
+	}
+	return mentioned
+}
+
+// Entities returns the entities formatting Text, by offset with enclosing entities first
+func (d *Document) Entities() []models.Entity {
+	var entities []models.Entity
+	for _, s := range d.spans {
+		if s.entity.Length == 0 || (s.entity.Type == models.EntityMention && s.entity.UserID == 0) {
+			continue
+		}
+		entities = append(entities, s.entity)
+	}
+	sort.SliceStable(entities, func(i, j int) bool {
+		if entities[i].Offset != entities[j].Offset {
+			return entities[i].Offset < entities[j].Offset
+		}
+		return entities[i].Length > entities[j].Length
+	})
+	if len(entities) > maxEntities {
+		entities = entities[:maxEntities]
+	}
+	return entities
+}
+
+// clean makes content valid UTF-8 without control characters other than \n and \t
+func clean(content string) string {
+	content = strings.ToValidUTF8(content, "")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, content)
+}
+
+// parser writes the text of a document while recording its entities
+type parser struct {
+	out strings.Builder
+	// pos is the length of out in UTF-16 code units
+	pos       int
+	spans     []span
+	usernames map[string]bool
+}
+
+func (p *parser) write(s string) {
+	p.out.WriteString(s)
+	for _, r := range s {
+		// Characters outside the Basic Multilingual Plane take a surrogate pair
+		if r >= 0x10000 {
+			p.pos += 2
+		} else {
+			p.pos++
+		}
+	}
+}
+
+// open starts an entity at the current position, returning its index for close
+func (p *parser) open(entityType models.EntityType) int {
+	p.spans = append(p.spans, span{entity: models.Entity{Type: entityType, Offset: p.pos}})
+	return len(p.spans) - 1
+}
+
+// close ends the entity at index i at the current position
+func (p *parser) close(i int) {
+	p.spans[i].entity.Length = p.pos - p.spans[i].entity.Offset
+}
+
+// level is the text at one depth of nested emphasis
+type level struct {
+	src   string
+	depth int
+	// unclosed records, for each marker, the earliest offset a search for its closing
+	// marker failed from, so runs of unclosed markers are not searched again and again
+	unclosed map[string]int
+}
+
+// parse writes src, which is nested in depth levels of bold and italic
+func (p *parser) parse(src string, depth int) {
+	l := &level{src: src, depth: depth, unclosed: make(map[string]int)}
+	for i := 0; i < len(src); {
+		if n := p.markup(l, i); n > 0 {
+			i += n
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(src[i:])
+		p.write(src[i : i+size])
+		i += size
+	}
+}
+
+// markup writes the markup starting at offset i of l, returning how many bytes it read,
+// or 0 when there is none
+func (p *parser) markup(l *level, i int) int {
+	src := l.src
+	switch src[i] {
+	case '\\':
+		if i+1 < len(src) && strings.IndexByte("\\*_`", src[i+1]) >= 0 {
+			p.write(src[i+1 : i+2])
+			return 2
+		}
+	case '`':
+		if strings.HasPrefix(src[i:], "```") {
+			if n := p.codeBlock(l, i); n > 0 {
+				return n
+			}
+		}
+		return p.code(l, i)
+	case '@':
+		return p.mention(src, i)
+	case 'h', 'H':
+		return p.link(src, i)
+	case '*':
+		if strings.HasPrefix(src[i:], "**") {
+			return p.emphasis(l, i, "**", models.EntityBold)
+		}
+		return p.emphasis(l, i, "*", models.EntityItalic)
+	case '_':
+		return p.emphasis(l, i, "_", models.EntityItalic)
+	}
+	return 0
+}
+
+// find returns the offset of the first closing marker at or after from that closes
+// accepts, or -1 when there is none
+func (l *level) find(marker string, from int, closes func(k int) bool) int {
+	if failed, ok := l.unclosed[marker]; ok && from >= failed {
+		return -1
+	}
+	for j := from; j <= len(l.src); {
+		k := strings.Index(l.src[j:], marker)
+		if k < 0 {
+			break
+		}
+		if k += j; closes(k) {
+			return k
+		}
+		j = k + 1
+	}
+	if failed, ok := l.unclosed[marker]; !ok || from < failed {
+		l.unclosed[marker] = from
+	}
+	return -1
+}
+
+// codeBlock writes a ```fenced``` code block. A first line holding a single word names
+// the block's language.
+func (p *parser) codeBlock(l *level, i int) int {
+	end := l.find("```", i+3, func(int) bool { return true })
+	if end < 0 {
+		return 0
+	}
+	body, language := l.src[i+3:end], ""
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 && languagePattern.MatchString(body[:nl]) {
+		body, language = body[nl+1:], body[:nl]
+	}
+	body = strings.TrimSuffix(body, "\n")
+	if body == "" {
+		// A block holding one word is that word, not an empty block in its language
+		body, language = language, ""
+	}
+	if body == "" {
+		return 0
+	}
+	s := p.open(models.EntityPre)
+	p.spans[s].entity.Language = language
+	p.write(body)
+	p.close(s)
+	return end + 3 - i
+}
+
+// code writes `inline code`
+func (p *parser) code(l *level, i int) int {
+	end := l.find("`", i+1, func(int) bool { return true })
+	if end <= i+1 {
+		return 0
+	}
+	s := p.open(models.EntityCode)
+	p.write(l.src[i+1 : end])
+	p.close(s)
+	return end + 1 - i
+}
+
+// mention writes an @username. Addresses like name@example.com are not mentions.
+func (p *parser) mention(src string, i int) int {
+	if isWord(before(src, i)) {
+		return 0
+	}
+	username := strings.TrimRight(usernamePattern.FindString(src[i+1:]), ".-")
+	if n := len(username); n < 3 || n > 50 {
+		return 0
+	}
+	if p.usernames == nil {
+		p.usernames = make(map[string]bool)
+	}
+	if !p.usernames[username] && len(p.usernames) == maxMentions {
+		return 0
+	}
+	p.usernames[username] = true
+	s := p.open(models.EntityMention)
+	p.spans[s].username = username
+	p.write("@" + username)
+	p.close(s)
+	return 1 + len(username)
+}
+
+// link writes an http or https link, without punctuation that ends the sentence or the
+// formatting it appears in
+func (p *parser) link(src string, i int) int {
+	if isWord(before(src, i)) {
+		return 0
+	}
+	link := strings.TrimRight(linkPattern.FindString(src[i:]), ".,;:!?')]}*_`")
+	if !strings.Contains(link, "://") || strings.HasSuffix(link, "://") {
+		return 0
+	}
+	s := p.open(models.EntityURL)
+	p.write(link)
+	p.close(s)
+	return len(link)
+}
+
+// emphasis writes text between a pair of marker, parsing the markup inside it. Markers
+// must hug the text they enclose, so a lone asterisk or a run of them, such as a word a
+// filter redacted, is shown as written; underscores must also stand apart from words, so
+// snake_case stays as it is.
+func (p *parser) emphasis(l *level, i int, marker string, entityType models.EntityType) int {
+	src, c := l.src, rune(marker[0])
+	opens := before(src, i) != c && !isSpace(after(src, i+len(marker))) && after(src, i+len(marker)) != c
+	if c == '_' {
+		opens = opens && !isWord(before(src, i))
+	}
+	if !opens || l.depth == maxDepth {
+		return 0
+	}
+	end := l.find(marker, i+len(marker)+1, func(k int) bool {
+		closes := !isSpace(before(src, k)) && before(src, k) != c && after(src, k+len(marker)) != c
+		if c == '_' {
+			closes = closes && !isWord(after(src, k+len(marker)))
+		}
+		return closes
+	})
+	if end < 0 {
+		return 0
+	}
+	s := p.open(entityType)
+	p.parse(src[i+len(marker):end], l.depth+1)
+	p.close(s)
+	return end + len(marker) - i
+}
+
+// before returns the character before offset i of src, or 0 at its start
+func before(src string, i int) rune {
+	r, _ := utf8.DecodeLastRuneInString(src[:i])
+	if r == utf8.RuneError {
+		return 0
+	}
+	return r
+}
+
+// after returns the character at offset i of src, or 0 at its end
+func after(src string, i int) rune {
+	r, _ := utf8.DecodeRuneInString(src[i:])
+	if r == utf8.RuneError {
+		return 0
+	}
+	return r
+}
+
+func isSpace(r rune) bool {
+	return r == 0 || unicode.IsSpace(r)
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
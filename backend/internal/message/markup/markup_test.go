@@ -0,0 +1,93 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func entity(entityType models.EntityType, offset, length int) models.Entity {
+	return models.Entity{Type: entityType, Offset: offset, Length: length}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		text     string
+		entities []models.Entity
+	}{
+		{"plain", "hello there", "hello there", nil},
+		{"bold", "a **big** deal", "a big deal", []models.Entity{entity(models.EntityBold, 2, 3)}},
+		{"italic", "*so* _very_", "so very", []models.Entity{
+			entity(models.EntityItalic, 0, 2), entity(models.EntityItalic, 3, 4),
+		}},
+		{"nested", "**bold _and italic_**", "bold and italic", []models.Entity{
+			entity(models.EntityBold, 0, 15), entity(models.EntityItalic, 5, 10),
+		}},
+		{"code", "run `go *test*` now", "run go *test* now", []models.Entity{entity(models.EntityCode, 4, 9)}},
+		{"code block", "```go\nfmt.Println(\"*hi*\")\n```", "fmt.Println(\"*hi*\")", []models.Entity{
+			{Type: models.EntityPre, Offset: 0, Length: 19, Language: "go"},
+		}},
+		{"code block without language", "```\nx := 1\n```", "x := 1", []models.Entity{entity(models.EntityPre, 0, 6)}},
+		{"link", "see https://example.com/a_b_c.", "see https://example.com/a_b_c.", []models.Entity{
+			entity(models.EntityURL, 4, 25),
+		}},
+		{"link in bold", "**https://example.com**", "https://example.com", []models.Entity{
+			entity(models.EntityBold, 0, 19), entity(models.EntityURL, 0, 19),
+		}},
+		{"offsets count UTF-16 units", "😀 **hi**", "😀 hi", []models.Entity{entity(models.EntityBold, 3, 2)}},
+		{"escaped markers", `\*not italic\* and \_this\_`, "*not italic* and _this_", nil},
+		{"unclosed markers", "2 * 3 = 6, **wait", "2 * 3 = 6, **wait", nil},
+		{"markers must hug text", "a * b * c and ** d **", "a * b * c and ** d **", nil},
+		{"snake_case", "call some_func_name now", "call some_func_name now", nil},
+		{"redacted words", "what the ***** is this ****", "what the ***** is this ****", nil},
+		{"redaction in bold", "**what the *****!**", "what the *****!", []models.Entity{entity(models.EntityBold, 0, 15)}},
+		{"control characters", "a\x00b\x1b[31m\tc\nd", "ab[31m\tc\nd", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := Parse(tt.content)
+			assert.Equal(t, tt.text, doc.Text)
+			assert.Equal(t, tt.entities, doc.Entities())
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	doc := Parse("hi @alice and @bob. mail carol@example.com, @alice again, @nobody and @al")
+	assert.Equal(t, []string{"alice", "bob", "nobody"}, doc.Usernames())
+
+	mentioned := doc.ResolveMentions(map[string]int{"alice": 1, "bob": 2})
+	assert.Equal(t, []int{1, 2}, mentioned)
+	assert.Equal(t, []models.Entity{
+		{Type: models.EntityMention, Offset: 3, Length: 6, UserID: 1},
+		{Type: models.EntityMention, Offset: 14, Length: 4, UserID: 2},
+		{Type: models.EntityMention, Offset: 44, Length: 6, UserID: 1},
+	}, doc.Entities())
+	assert.Equal(t, "@bob", models.EntityText(doc.Text, doc.Entities()[1]))
+}
+
+func TestLimits(t *testing.T) {
+	var names []string
+	for i := 0; i < maxMentions+5; i++ {
+		names = append(names, "@user"+strings.Repeat("x", i))
+	}
+	assert.Len(t, Parse(strings.Join(names, " ")).Usernames(), maxMentions)
+
+	assert.Len(t, Parse(strings.Repeat("`x` ", maxEntities*2)).Entities(), maxEntities)
+
+	// Emphasis nested too deeply is shown as written
+	p := &parser{}
+	p.parse("**x** _y_", maxDepth)
+	assert.Equal(t, "**x** _y_", p.out.String())
+	assert.Empty(t, p.spans)
+
+	// Unclosed markers are not searched for again from each one
+	start := time.Now()
+	Parse(strings.Repeat("*a _b `c ", 20000))
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -2,7 +2,10 @@ package models
 
 // BroadcastMessageRequest represents a request to send a message to multiple users
 type BroadcastMessageRequest struct {
-    ReceiverIDs []int  `json:"receiver_ids"`
-    Content     string `json:"content"`
-    MediaURL    string `json:"media_url,omitempty"`
+    ReceiverIDs   []int  `json:"receiver_ids"`
+    Content       string `json:"content"`
+    MediaURL      string `json:"media_url,omitempty"`
+    AttachmentIDs []int  `json:"attachment_ids,omitempty"`
+    // Kind defaults to text
+    Kind          MessageKind `json:"kind,omitempty"`
 } 
\ No newline at end of file
@@ -0,0 +1,40 @@
+package models
+
+import "unicode/utf16"
+
+// EntityType is the kind of formatting or reference an Entity marks
+type EntityType string
+
+const (
+	// EntityMention marks an @username that belongs to UserID
+	EntityMention EntityType = "mention"
+	// EntityURL marks an http or https link
+	EntityURL EntityType = "url"
+	// EntityCode marks inline code
+	EntityCode EntityType = "code"
+	// EntityPre marks a code block, in Language when the sender named one
+	EntityPre EntityType = "pre"
+	// EntityBold marks bold text
+	EntityBold EntityType = "bold"
+	// EntityItalic marks italic text
+	EntityItalic EntityType = "italic"
+)
+
+// Entity marks a span of a message's content. Offset and Length count UTF-16 code
+// units, as JavaScript strings do, so clients can slice content without converting it.
+type Entity struct {
+	Type     EntityType `json:"type"`
+	Offset   int        `json:"offset"`
+	Length   int        `json:"length"`
+	UserID   int        `json:"user_id,omitempty"`
+	Language string     `json:"language,omitempty"`
+}
+
+// EntityText returns the part of content that e marks
+func EntityText(content string, e Entity) string {
+	units := utf16.Encode([]rune(content))
+	if e.Offset < 0 || e.Length < 0 || e.Offset+e.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// TimerMode says what a conversation timer counts from
+type TimerMode string
+
+const (
+	// TimerAfterSend messages expire a fixed time after they are sent
+	TimerAfterSend TimerMode = "after_send"
+	// TimerAfterRead messages expire a fixed time after the receiver reads them; unread
+	// messages are kept
+	TimerAfterRead TimerMode = "after_read"
+)
+
+// IsValid checks if the mode is one of the known modes
+func (m TimerMode) IsValid() bool {
+	return m == TimerAfterSend || m == TimerAfterRead
+}
+
+// ConversationTimer makes the messages two users send each other disappear. It applies
+// to messages sent while it is set, from either participant.
+type ConversationTimer struct {
+	// UserID is the other participant, as seen by the user asking
+	UserID    int       `json:"user_id"`
+	Seconds   int       `json:"seconds"`
+	Mode      TimerMode `json:"mode"`
+	UpdatedBy int       `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Expiry returns how a message sent now under t expires: at a fixed time, or a number
+// of seconds after it is read
+func (t *ConversationTimer) Expiry(now time.Time) (*time.Time, int) {
+	if t.Mode == TimerAfterRead {
+		return nil, t.Seconds
+	}
+	expiresAt := now.Add(time.Duration(t.Seconds) * time.Second)
+	return &expiresAt, 0
+}
+
+// SetConversationTimerRequest sets or, with zero seconds, clears the timer of the
+// conversation with UserID
+type SetConversationTimerRequest struct {
+	UserID  int       `json:"user_id"`
+	Seconds int       `json:"seconds"`
+	Mode    TimerMode `json:"mode"`
+}
+
+// RetentionPolicy limits how long messages are kept, whatever their conversation's
+// timer. Zero durations keep messages indefinitely.
+type RetentionPolicy struct {
+	// MaxAge applies to every message
+	MaxAge time.Duration
+	// ExternalMaxAge applies to messages sent or received by external users
+	ExternalMaxAge time.Duration
+}
+
+// ExpiredMessage is a message that was deleted once it expired
+type ExpiredMessage struct {
+	ID            int
+	SenderID      int
+	ReceiverID    int
+	AttachmentIDs []int
+}
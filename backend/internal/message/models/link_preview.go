@@ -0,0 +1,19 @@
+package models
+
+// LinkPreview is the card shown for a link in a message, built from the OpenGraph or
+// Twitter card metadata of the linked page
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// LinkPreviewJob is a message waiting for the preview of a link it contains
+type LinkPreviewJob struct {
+	MessageID  int
+	SenderID   int
+	ReceiverID int
+	URL        string
+}
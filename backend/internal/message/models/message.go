@@ -1,7 +1,11 @@
 // Package models provides the data structures for messaging functionality
 package models
 
-import "time"
+import (
+	"time"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+)
 
 // MessageStatus represents the delivery status of a message
 type MessageStatus string
@@ -10,6 +14,18 @@ const (
 	StatusSent      MessageStatus = "sent"
 	StatusDelivered MessageStatus = "delivered"
 	StatusRead      MessageStatus = "read"
+	// StatusPlayed follows read for voice messages the recipient has listened to
+	StatusPlayed MessageStatus = "played"
+)
+
+// MessageKind tells clients how to present a message
+type MessageKind string
+
+const (
+	// KindText messages are text, optionally with attachments
+	KindText MessageKind = "text"
+	// KindVoice messages carry a single Ogg or WebM audio attachment and no text
+	KindVoice MessageKind = "voice"
 )
 
 // Message represents a chat message in the system
@@ -17,9 +33,24 @@ type Message struct {
 	ID         int           `json:"id"`
 	SenderID   int           `json:"sender_id"`
 	ReceiverID int          `json:"receiver_id,omitempty"`
+	Kind       MessageKind   `json:"kind"`
 	ReceiverIDs []int         `json:"receiver_ids,omitempty"`
 	Content    string       `json:"content"`
 	MediaURL   string       `json:"media_url,omitempty"`
+	Attachments []mediaModels.Attachment `json:"attachments,omitempty"`
+	// LinkPreview describes the first link in Content once it has been fetched
+	LinkPreview *LinkPreview `json:"link_preview,omitempty"`
+	// Entities format Content and mark the links and users in it
+	Entities   []Entity     `json:"entities,omitempty"`
+	// Mentioned is set when Content mentions the receiver
+	Mentioned  bool         `json:"mentioned,omitempty"`
+	// ScheduledID is the scheduled message this message was sent from
+	ScheduledID int         `json:"scheduled_id,omitempty"`
+	// ExpiresAt is when the message will be deleted under its conversation's timer
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+	// ExpireAfter is how many seconds after being read the message is deleted, for
+	// timers counted from reading; ExpiresAt is set once it is read
+	ExpireAfter int         `json:"expire_after,omitempty"`
 	Status     MessageStatus `json:"status"`
 	CreatedAt  time.Time    `json:"created_at"`
 	UpdatedAt  time.Time    `json:"updated_at,omitempty"`
@@ -27,15 +58,23 @@ type Message struct {
 
 // CreateMessageRequest represents the request body for creating a new message
 type CreateMessageRequest struct {
-	ReceiverID int    `json:"receiver_id" validate:"required"`
-	Content    string `json:"content" validate:"required"`
-	MediaURL   string `json:"media_url,omitempty"`
+	ReceiverID    int    `json:"receiver_id" validate:"required"`
+	Content       string `json:"content" validate:"required"`
+	// MediaURL links external media; uploaded files are referenced by AttachmentIDs
+	MediaURL      string `json:"media_url,omitempty"`
+	AttachmentIDs []int  `json:"attachment_ids,omitempty"`
+	// Kind defaults to text
+	Kind MessageKind `json:"kind,omitempty"`
+	// SendAt schedules the message to be sent later instead of now
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// ScheduledID is set by the scheduler when it sends a scheduled message
+	ScheduledID int `json:"-"`
 }
 
 // IsValid checks if the message status is valid
 func (s MessageStatus) IsValid() bool {
 	switch s {
-	case StatusSent, StatusDelivered, StatusRead:
+	case StatusSent, StatusDelivered, StatusRead, StatusPlayed:
 		return true
 	default:
 		return false
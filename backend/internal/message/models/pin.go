@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Pin records who pinned a message in its conversation, for both participants to see
+type Pin struct {
+	MessageID int       `json:"message_id"`
+	PinnedBy  int       `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+}
+
+// PinnedMessage is a message pinned in its conversation
+type PinnedMessage struct {
+	Message
+	PinnedBy int       `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// StarredMessage is a message the user bookmarked; stars are private to each user
+type StarredMessage struct {
+	Message
+	StarredAt time.Time `json:"starred_at"`
+}
+
+// MessageActionRequest identifies a message to pin, unpin, star or unstar
+type MessageActionRequest struct {
+	MessageID int `json:"message_id"`
+}
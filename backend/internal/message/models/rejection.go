@@ -0,0 +1,11 @@
+package models
+
+// RejectionCode is the error code reported when a content filter refuses a message
+const RejectionCode = "content_rejected"
+
+// RejectionResponse is the structured error returned when a content filter refuses a message
+type RejectionResponse struct {
+	Code    string `json:"code"`
+	Filter  string `json:"filter"`
+	Message string `json:"message"`
+}
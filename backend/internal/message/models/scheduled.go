@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// ScheduledStatus is the state of a scheduled message that has not been sent
+type ScheduledStatus string
+
+const (
+	// ScheduledPending messages are waiting for their send time
+	ScheduledPending ScheduledStatus = "pending"
+	// ScheduledFailed messages could not be sent when they came due; Error says why
+	ScheduledFailed ScheduledStatus = "failed"
+)
+
+// ScheduledMessage is a message waiting to be sent at SendAt. Once sent it is removed,
+// and the message it became carries its ID as ScheduledID.
+type ScheduledMessage struct {
+	ID            int             `json:"id"`
+	SenderID      int             `json:"sender_id"`
+	ReceiverID    int             `json:"receiver_id"`
+	Kind          MessageKind     `json:"kind"`
+	Content       string          `json:"content"`
+	MediaURL      string          `json:"media_url,omitempty"`
+	AttachmentIDs []int           `json:"attachment_ids,omitempty"`
+	SendAt        time.Time       `json:"send_at"`
+	Status        ScheduledStatus `json:"status"`
+	Error         string          `json:"error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// Request returns the request that sends m
+func (m *ScheduledMessage) Request() *CreateMessageRequest {
+	return &CreateMessageRequest{
+		ReceiverID:    m.ReceiverID,
+		Content:       m.Content,
+		MediaURL:      m.MediaURL,
+		AttachmentIDs: m.AttachmentIDs,
+		Kind:          m.Kind,
+		ScheduledID:   m.ID,
+	}
+}
+
+// UpdateScheduledMessageRequest replaces the content and send time of a scheduled
+// message. Editing a failed message schedules it again.
+type UpdateScheduledMessageRequest struct {
+	ID            int         `json:"id"`
+	Content       string      `json:"content"`
+	MediaURL      string      `json:"media_url,omitempty"`
+	AttachmentIDs []int       `json:"attachment_ids,omitempty"`
+	Kind          MessageKind `json:"kind,omitempty"`
+	SendAt        time.Time   `json:"send_at"`
+}
+
+// CancelScheduledMessageRequest identifies a scheduled message to cancel
+type CancelScheduledMessageRequest struct {
+	ID int `json:"id"`
+}
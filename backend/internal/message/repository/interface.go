@@ -2,18 +2,33 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"github.com/Mousa96/chatting-service/internal/message/models"
 )
 
+var (
+	// ErrNotFound is returned when a scheduled message does not exist, has been sent, or
+	// belongs to another sender
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a scheduled message is being sent, when creating a
+	// message for a scheduled message that was already sent, and when pinning a message in
+	// a conversation that has as many pins as it may
+	ErrConflict = errors.New("conflict")
+)
+
 // Repository defines the message repository operations
 type Repository interface {
-	// Create stores a new message
+	// Create stores a new message. A message with a ScheduledID also removes that
+	// scheduled message, or returns ErrConflict when it was already sent or cancelled.
 	Create(message *models.Message) error
 	
 	// GetMessagesByUser retrieves all messages involving a user
 	GetMessagesByUser(userID int) ([]models.Message, error)
 	
-	// GetConversation retrieves the conversation between two users
+	// GetConversation retrieves the conversation between two users as seen by userID1.
+	// Messages from users that userID1 has blocked are left out, as in the other history queries.
 	GetConversation(userID1, userID2 int) ([]models.Message, error)
 	
 	// GetConversationPaginated retrieves the conversation with pagination
@@ -25,9 +40,85 @@ type Repository interface {
 	// GetMessageHistoryPaginated retrieves messages with pagination
 	GetMessageHistoryPaginated(userID, page, pageSize int) ([]models.Message, *models.Pagination, error)
 	
-	// UpdateMessageStatus updates the status of a message
+	// UpdateMessageStatus updates the status of a message. Reading a message whose timer
+	// counts from reading starts it.
 	UpdateMessageStatus(messageID int, status models.MessageStatus) error
 	
 	// GetMessageByID retrieves a message by its ID
 	GetMessageByID(messageID int) (*models.Message, error)
+
+	// QueueLinkPreview records that the preview of url should be fetched for a message
+	QueueLinkPreview(messageID int, url string) error
+
+	// ClaimLinkPreviewJobs returns up to limit queued link previews that are not claimed,
+	// or whose claim has expired, and claims them for lease
+	ClaimLinkPreviewJobs(limit int, lease time.Duration) ([]models.LinkPreviewJob, error)
+
+	// CompleteLinkPreview sets a message's link preview, which may be nil, and removes its job
+	CompleteLinkPreview(messageID int, preview *models.LinkPreview) error
+
+	// GetCachedLinkPreview returns the preview of url fetched after since, reporting
+	// whether one was found. A found preview is nil when the page had none.
+	GetCachedLinkPreview(url string, since time.Time) (*models.LinkPreview, bool, error)
+
+	// CacheLinkPreview stores the preview of url, or nil when it has none
+	CacheLinkPreview(url string, preview *models.LinkPreview) error
+
+	// CreateScheduledMessage stores a message to be sent later
+	CreateScheduledMessage(msg *models.ScheduledMessage) error
+
+	// GetScheduledMessages returns senderID's scheduled messages, soonest first
+	GetScheduledMessages(senderID, page, pageSize int) ([]models.ScheduledMessage, *models.Pagination, error)
+
+	// UpdateScheduledMessage replaces the content and send time of one of the sender's
+	// scheduled messages and makes it pending again. It returns ErrNotFound when there is
+	// no such message and ErrConflict while it is being sent.
+	UpdateScheduledMessage(msg *models.ScheduledMessage) error
+
+	// DeleteScheduledMessage removes one of senderID's scheduled messages, returning the
+	// same errors as UpdateScheduledMessage
+	DeleteScheduledMessage(id, senderID int) error
+
+	// ClaimScheduledMessages returns up to limit pending messages that are due and not
+	// claimed, or whose claim has expired, and claims them for lease
+	ClaimScheduledMessages(limit int, lease time.Duration) ([]models.ScheduledMessage, error)
+
+	// FailScheduledMessage records why a claimed scheduled message could not be sent
+	FailScheduledMessage(id int, reason string) error
+
+	// GetConversationTimer returns the timer of the conversation between two users, or
+	// nil when it has none
+	GetConversationTimer(userID1, userID2 int) (*models.ConversationTimer, error)
+
+	// SetConversationTimer sets the timer of the conversation between userID and
+	// timer.UserID, or clears it when timer.Seconds is zero
+	SetConversationTimer(userID int, timer *models.ConversationTimer) error
+
+	// DeleteExpiredMessages deletes up to limit messages that expired under their timer
+	// or the retention policy and returns them, with the attachments they carried.
+	// Messages being deleted by another caller are skipped.
+	DeleteExpiredMessages(policy models.RetentionPolicy, limit int) ([]models.ExpiredMessage, error)
+
+	// PinMessage pins a message in its conversation, filling in pin.PinnedAt, and reports
+	// whether it was newly pinned; pin is set to the existing pin otherwise. It returns
+	// ErrNotFound for messages that do not exist and ErrConflict when the conversation
+	// already has limit pins.
+	PinMessage(pin *models.Pin, limit int) (bool, error)
+
+	// UnpinMessage unpins a message and reports whether it was pinned
+	UnpinMessage(messageID int) (bool, error)
+
+	// GetPinnedMessages retrieves the messages pinned in the conversation between two users
+	// as seen by userID1, most recently pinned first, with pagination
+	GetPinnedMessages(userID1, userID2, page, pageSize int) ([]models.PinnedMessage, *models.Pagination, error)
+
+	// StarMessage bookmarks a message for userID; starring it again changes nothing
+	StarMessage(userID, messageID int) error
+
+	// UnstarMessage removes userID's bookmark of a message, if any
+	UnstarMessage(userID, messageID int) error
+
+	// GetStarredMessages retrieves the messages userID starred across all conversations,
+	// most recently starred first, with pagination
+	GetStarredMessages(userID, page, pageSize int) ([]models.StarredMessage, *models.Pagination, error)
 }
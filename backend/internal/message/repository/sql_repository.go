@@ -3,13 +3,27 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
+	mediaRepository "github.com/Mousa96/chatting-service/internal/media/repository"
 	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/lib/pq"
 )
 
+// uniqueViolation is the PostgreSQL error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// visibleToViewer hides messages removed by a moderator, expired messages that have
+// not been deleted yet and messages sent by users that the viewer, always bound to $1,
+// has blocked
+const visibleToViewer = `messages.hidden_at IS NULL
+        AND (messages.expires_at IS NULL OR messages.expires_at > CURRENT_TIMESTAMP) AND NOT EXISTS (
+        SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = messages.sender_id)`
+
 // SQLMessageRepository provides a PostgreSQL implementation of Repository
 type SQLMessageRepository struct {
 	db *sql.DB
@@ -22,21 +36,99 @@ func NewMessageRepository(db *sql.DB) Repository {
 
 func (r *SQLMessageRepository) Create(msg *models.Message) error {
 	const query = `
-        INSERT INTO messages (sender_id, receiver_id, content, media_url, status, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        INSERT INTO messages (sender_id, receiver_id, kind, content, media_url, entities, mentioned, scheduled_message_id, expires_at, expire_after, status, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), $9, NULLIF($10, 0), $11, $12, $13)
         RETURNING id
     `
 
-	return r.db.QueryRow(query, msg.SenderID, msg.ReceiverID, msg.Content, msg.MediaURL, models.StatusSent, msg.CreatedAt, msg.UpdatedAt).
+	if msg.Kind == "" {
+		msg.Kind = models.KindText
+	}
+
+	entities, err := encodeEntities(msg.Entities)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(query, msg.SenderID, msg.ReceiverID, msg.Kind, msg.Content, msg.MediaURL, entities, msg.Mentioned, msg.ScheduledID, msg.ExpiresAt, msg.ExpireAfter, models.StatusSent, msg.CreatedAt, msg.UpdatedAt).
 		Scan(&msg.ID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: scheduled message %d was already sent", ErrConflict, msg.ScheduledID)
+	}
+	if err != nil {
+		return err
+	}
+	if msg.ScheduledID != 0 {
+		result, err := tx.Exec(`DELETE FROM scheduled_messages WHERE id = $1`, msg.ScheduledID)
+		if err != nil {
+			return fmt.Errorf("failed to remove scheduled message: %w", err)
+		}
+		if removed, err := result.RowsAffected(); err == nil && removed == 0 {
+			return fmt.Errorf("%w: scheduled message %d was cancelled", ErrConflict, msg.ScheduledID)
+		}
+	}
+
+	for position, attachment := range msg.Attachments {
+		if _, err := tx.Exec(
+			`INSERT INTO message_attachments (message_id, attachment_id, position) VALUES ($1, $2, $3)`,
+			msg.ID, attachment.ID, position,
+		); err != nil {
+			return fmt.Errorf("failed to attach file: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// loadAttachments fills in the attachments of the given messages in their original order
+func (r *SQLMessageRepository) loadAttachments(messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int, len(messages))
+	index := make(map[int]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+		index[msg.ID] = i
+	}
+
+	rows, err := r.db.Query(`
+        SELECT `+mediaRepository.AttachmentColumns+`, ma.message_id
+        FROM message_attachments ma
+        JOIN attachments a ON a.id = ma.attachment_id
+        WHERE ma.message_id = ANY($1)
+        ORDER BY ma.message_id, ma.position`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to load attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		attachment, err := mediaRepository.ScanAttachment(rows, &messageID)
+		if err != nil {
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		msg := &messages[index[messageID]]
+		msg.Attachments = append(msg.Attachments, *attachment)
+	}
+	return rows.Err()
 }
 
 func (r *SQLMessageRepository) GetConversation(userID1, userID2 int) ([]models.Message, error) {
 	query := `
-        SELECT id, sender_id, receiver_id, content, media_url, status, created_at
+        SELECT id, sender_id, receiver_id, kind, content, media_url, link_preview, entities, mentioned, COALESCE(scheduled_message_id, 0), expires_at, COALESCE(expire_after, 0), status, created_at
         FROM messages
-        WHERE (sender_id = $1 AND receiver_id = $2)
-           OR (sender_id = $2 AND receiver_id = $1)
+        WHERE ((sender_id = $1 AND receiver_id = $2)
+           OR (sender_id = $2 AND receiver_id = $1))
+          AND ` + visibleToViewer + `
         ORDER BY created_at ASC`
 
 	rows, err := r.db.Query(query, userID1, userID2)
@@ -52,8 +144,15 @@ func (r *SQLMessageRepository) GetConversation(userID1, userID2 int) ([]models.M
 			&msg.ID,
 			&msg.SenderID,
 			&msg.ReceiverID,
+			&msg.Kind,
 			&msg.Content,
 			&msg.MediaURL,
+			linkPreviewColumn{&msg.LinkPreview},
+			entitiesColumn{&msg.Entities},
+			&msg.Mentioned,
+			&msg.ScheduledID,
+			&msg.ExpiresAt,
+			&msg.ExpireAfter,
 			&msg.Status,
 			&msg.CreatedAt,
 		)
@@ -63,14 +162,18 @@ func (r *SQLMessageRepository) GetConversation(userID1, userID2 int) ([]models.M
 		messages = append(messages, msg)
 	}
 
+	if err := r.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+
 	return messages, nil
 }
 
 func (r *SQLMessageRepository) GetMessageHistory(userID int) ([]models.Message, error) {
     query := `
-        SELECT id, sender_id, receiver_id, content, media_url, status, created_at 
+        SELECT id, sender_id, receiver_id, kind, content, media_url, link_preview, entities, mentioned, COALESCE(scheduled_message_id, 0), expires_at, COALESCE(expire_after, 0), status, created_at 
         FROM messages 
-        WHERE sender_id = $1 OR receiver_id = $1 
+        WHERE (sender_id = $1 OR receiver_id = $1) AND ` + visibleToViewer + `
         ORDER BY created_at DESC`
 
     rows, err := r.db.Query(query, userID)
@@ -87,8 +190,15 @@ func (r *SQLMessageRepository) GetMessageHistory(userID int) ([]models.Message,
             &msg.ID,
             &msg.SenderID,
             &msg.ReceiverID,
+            &msg.Kind,
             &msg.Content,
             &msg.MediaURL,
+            linkPreviewColumn{&msg.LinkPreview},
+            entitiesColumn{&msg.Entities},
+            &msg.Mentioned,
+            &msg.ScheduledID,
+            &msg.ExpiresAt,
+            &msg.ExpireAfter,
             &msg.Status,
             &msg.CreatedAt,
         )
@@ -102,12 +212,16 @@ func (r *SQLMessageRepository) GetMessageHistory(userID int) ([]models.Message,
         messages = []models.Message{} // Return empty slice instead of nil
     }
 
+    if err := r.loadAttachments(messages); err != nil {
+        return nil, err
+    }
+
     return messages, nil
 }
 
 func (r *SQLMessageRepository) GetMessageByID(messageID int) (*models.Message, error) {
 	query := `
-		SELECT id, sender_id, receiver_id, content, media_url, status, created_at, updated_at
+		SELECT id, sender_id, receiver_id, kind, content, media_url, link_preview, entities, mentioned, COALESCE(scheduled_message_id, 0), expires_at, COALESCE(expire_after, 0), status, created_at, updated_at
 		FROM messages
 		WHERE id = $1`
 
@@ -116,8 +230,15 @@ func (r *SQLMessageRepository) GetMessageByID(messageID int) (*models.Message, e
 		&msg.ID,
 		&msg.SenderID,
 		&msg.ReceiverID,
+		&msg.Kind,
 		&msg.Content,
 		&msg.MediaURL,
+		linkPreviewColumn{&msg.LinkPreview},
+		entitiesColumn{&msg.Entities},
+		&msg.Mentioned,
+		&msg.ScheduledID,
+		&msg.ExpiresAt,
+		&msg.ExpireAfter,
 		&msg.Status,
 		&msg.CreatedAt,
 		&msg.UpdatedAt,
@@ -128,13 +249,19 @@ func (r *SQLMessageRepository) GetMessageByID(messageID int) (*models.Message, e
 	if err != nil {
 		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
-	return msg, nil
+	messages := []models.Message{*msg}
+	if err := r.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
 }
 
 func (r *SQLMessageRepository) UpdateMessageStatus(messageID int, status models.MessageStatus) error {
     query := `
         UPDATE messages 
-        SET status = $1, updated_at = CURRENT_TIMESTAMP 
+        SET status = $1, updated_at = CURRENT_TIMESTAMP,
+            expires_at = CASE WHEN $1 IN ('read', 'played') AND expires_at IS NULL AND expire_after IS NOT NULL
+                THEN CURRENT_TIMESTAMP + expire_after * INTERVAL '1 second' ELSE expires_at END
         WHERE id = $2`
 
     result, err := r.db.Exec(query, status, messageID)
@@ -172,7 +299,7 @@ func (r *SQLMessageRepository) GetMessageHistoryPaginated(userID, page, pageSize
 	
 	// First, get the total count for pagination
 	var totalItems int
-	countQuery := `SELECT COUNT(*) FROM messages WHERE sender_id = $1 OR receiver_id = $1`
+	countQuery := `SELECT COUNT(*) FROM messages WHERE (sender_id = $1 OR receiver_id = $1) AND ` + visibleToViewer
 	err := r.db.QueryRow(countQuery, userID).Scan(&totalItems)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to count messages: %w", err)
@@ -187,9 +314,9 @@ func (r *SQLMessageRepository) GetMessageHistoryPaginated(userID, page, pageSize
 	}
 	
 	// Query with pagination
-	query := `SELECT id, sender_id, receiver_id, content, media_url, status, created_at 
+	query := `SELECT id, sender_id, receiver_id, kind, content, media_url, link_preview, entities, mentioned, COALESCE(scheduled_message_id, 0), expires_at, COALESCE(expire_after, 0), status, created_at 
 		FROM messages 
-		WHERE sender_id = $1 OR receiver_id = $1
+		WHERE (sender_id = $1 OR receiver_id = $1) AND ` + visibleToViewer + `
 		ORDER BY created_at DESC
 		LIMIT $2 OFFSET $3`
 	
@@ -208,8 +335,15 @@ func (r *SQLMessageRepository) GetMessageHistoryPaginated(userID, page, pageSize
 			&msg.ID,
 			&msg.SenderID,
 			&msg.ReceiverID,
+			&msg.Kind,
 			&msg.Content,
 			&msg.MediaURL,
+			linkPreviewColumn{&msg.LinkPreview},
+			entitiesColumn{&msg.Entities},
+			&msg.Mentioned,
+			&msg.ScheduledID,
+			&msg.ExpiresAt,
+			&msg.ExpireAfter,
 			&msg.Status,
 			&createdAt,
 		)
@@ -226,6 +360,10 @@ func (r *SQLMessageRepository) GetMessageHistoryPaginated(userID, page, pageSize
 		return nil, nil, fmt.Errorf("error iterating message rows: %w", err)
 	}
 	
+	if err := r.loadAttachments(messages); err != nil {
+		return nil, nil, err
+	}
+	
 	return messages, pagination, nil
 }
 
@@ -248,7 +386,8 @@ func (r *SQLMessageRepository) GetConversationPaginated(userID1, userID2, page,
 	// First, get the total count for pagination
 	var totalItems int
 	countQuery := `SELECT COUNT(*) FROM messages 
-		WHERE (sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1)`
+		WHERE ((sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1))
+		  AND ` + visibleToViewer
 	err := r.db.QueryRow(countQuery, userID1, userID2).Scan(&totalItems)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to count messages: %w", err)
@@ -263,9 +402,10 @@ func (r *SQLMessageRepository) GetConversationPaginated(userID1, userID2, page,
 	}
 	
 	// Query with pagination
-	query := `SELECT id, sender_id, receiver_id, content, media_url, status, created_at 
+	query := `SELECT id, sender_id, receiver_id, kind, content, media_url, link_preview, entities, mentioned, COALESCE(scheduled_message_id, 0), expires_at, COALESCE(expire_after, 0), status, created_at 
 		FROM messages 
-		WHERE (sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1)
+		WHERE ((sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1))
+		  AND ` + visibleToViewer + `
 		ORDER BY created_at DESC
 		LIMIT $3 OFFSET $4`
 	
@@ -284,8 +424,15 @@ func (r *SQLMessageRepository) GetConversationPaginated(userID1, userID2, page,
 			&msg.ID,
 			&msg.SenderID,
 			&msg.ReceiverID,
+			&msg.Kind,
 			&msg.Content,
 			&msg.MediaURL,
+			linkPreviewColumn{&msg.LinkPreview},
+			entitiesColumn{&msg.Entities},
+			&msg.Mentioned,
+			&msg.ScheduledID,
+			&msg.ExpiresAt,
+			&msg.ExpireAfter,
 			&msg.Status,
 			&createdAt,
 		)
@@ -302,13 +449,17 @@ func (r *SQLMessageRepository) GetConversationPaginated(userID1, userID2, page,
 		return nil, nil, fmt.Errorf("error iterating message rows: %w", err)
 	}
 	
+	if err := r.loadAttachments(messages); err != nil {
+		return nil, nil, err
+	}
+	
 	return messages, pagination, nil
 }
 
 // GetMessagesByUser retrieves all messages involving a user
 func (r *SQLMessageRepository) GetMessagesByUser(userID int) ([]models.Message, error) {
 	query := `
-		SELECT id, sender_id, receiver_id, content, media_url, status, created_at
+		SELECT id, sender_id, receiver_id, kind, content, media_url, link_preview, entities, mentioned, COALESCE(scheduled_message_id, 0), expires_at, COALESCE(expire_after, 0), status, created_at
 		FROM messages
 		WHERE sender_id = $1 OR receiver_id = $1
 		ORDER BY created_at DESC`
@@ -328,8 +479,15 @@ func (r *SQLMessageRepository) GetMessagesByUser(userID int) ([]models.Message,
 			&msg.ID,
 			&msg.SenderID,
 			&msg.ReceiverID,
+			&msg.Kind,
 			&msg.Content,
 			&msg.MediaURL,
+			linkPreviewColumn{&msg.LinkPreview},
+			entitiesColumn{&msg.Entities},
+			&msg.Mentioned,
+			&msg.ScheduledID,
+			&msg.ExpiresAt,
+			&msg.ExpireAfter,
 			&msg.Status,
 			&createdAt,
 		)
@@ -346,5 +504,762 @@ func (r *SQLMessageRepository) GetMessagesByUser(userID int) ([]models.Message,
 		return nil, fmt.Errorf("error iterating message rows: %w", err)
 	}
 	
+	if err := r.loadAttachments(messages); err != nil {
+		return nil, err
+	}
+
 	return messages, nil
-}
\ No newline at end of file
+}
+
+// linkPreviewColumn scans the nullable link_preview column into a message
+type linkPreviewColumn struct {
+	preview **models.LinkPreview
+}
+
+func (c linkPreviewColumn) Scan(src interface{}) error {
+	return decodeLinkPreview(src, c.preview)
+}
+
+// entitiesColumn scans the nullable entities column into a message
+type entitiesColumn struct {
+	entities *[]models.Entity
+}
+
+func (c entitiesColumn) Scan(src interface{}) error {
+	*c.entities = nil
+	var data []byte
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return fmt.Errorf("unexpected entities type %T", src)
+	}
+	if err := json.Unmarshal(data, c.entities); err != nil {
+		return fmt.Errorf("failed to decode entities: %w", err)
+	}
+	return nil
+}
+
+// encodeEntities encodes entities for a JSONB column, none becoming NULL
+func encodeEntities(entities []models.Entity) (interface{}, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(entities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entities: %w", err)
+	}
+	return data, nil
+}
+
+// decodeLinkPreview decodes a JSONB preview, leaving dst nil for NULL
+func decodeLinkPreview(src interface{}, dst **models.LinkPreview) error {
+	*dst = nil
+	var data []byte
+	switch value := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return fmt.Errorf("unexpected link preview type %T", src)
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	preview := &models.LinkPreview{}
+	if err := json.Unmarshal(data, preview); err != nil {
+		return fmt.Errorf("failed to decode link preview: %w", err)
+	}
+	*dst = preview
+	return nil
+}
+
+// encodeLinkPreview encodes a preview for a JSONB column, nil becoming NULL
+func encodeLinkPreview(preview *models.LinkPreview) (interface{}, error) {
+	if preview == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(preview)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode link preview: %w", err)
+	}
+	return data, nil
+}
+
+func (r *SQLMessageRepository) QueueLinkPreview(messageID int, url string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO link_preview_jobs (message_id, url) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		messageID, url)
+	if err != nil {
+		return fmt.Errorf("failed to queue link preview: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLMessageRepository) ClaimLinkPreviewJobs(limit int, lease time.Duration) ([]models.LinkPreviewJob, error) {
+	// SKIP LOCKED lets every server claim at once without waiting on or taking each other's jobs
+	rows, err := r.db.Query(`
+        UPDATE link_preview_jobs j
+        SET claimed_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+        FROM messages m
+        WHERE m.id = j.message_id
+          AND j.message_id IN (
+            SELECT message_id FROM link_preview_jobs
+            WHERE claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP
+            ORDER BY message_id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED)
+        RETURNING j.message_id, m.sender_id, m.receiver_id, j.url`,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim link preview jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.LinkPreviewJob
+	for rows.Next() {
+		var job models.LinkPreviewJob
+		if err := rows.Scan(&job.MessageID, &job.SenderID, &job.ReceiverID, &job.URL); err != nil {
+			return nil, fmt.Errorf("failed to scan link preview job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (r *SQLMessageRepository) CompleteLinkPreview(messageID int, preview *models.LinkPreview) error {
+	encoded, err := encodeLinkPreview(preview)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE messages SET link_preview = $1 WHERE id = $2`, encoded, messageID); err != nil {
+		return fmt.Errorf("failed to set link preview: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM link_preview_jobs WHERE message_id = $1`, messageID); err != nil {
+		return fmt.Errorf("failed to remove link preview job: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (r *SQLMessageRepository) GetCachedLinkPreview(url string, since time.Time) (*models.LinkPreview, bool, error) {
+	var preview *models.LinkPreview
+	var data []byte
+	err := r.db.QueryRow(
+		`SELECT preview FROM link_previews WHERE url = $1 AND fetched_at > $2`, url, since).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get cached link preview: %w", err)
+	}
+	if err := decodeLinkPreview(data, &preview); err != nil {
+		return nil, false, err
+	}
+	return preview, true, nil
+}
+
+func (r *SQLMessageRepository) CacheLinkPreview(url string, preview *models.LinkPreview) error {
+	encoded, err := encodeLinkPreview(preview)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
+        INSERT INTO link_previews (url, preview, fetched_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+        ON CONFLICT (url) DO UPDATE SET preview = EXCLUDED.preview, fetched_at = EXCLUDED.fetched_at`,
+		url, encoded)
+	if err != nil {
+		return fmt.Errorf("failed to cache link preview: %w", err)
+	}
+	return nil
+}
+
+// scheduledColumns lists the columns read by scanScheduledMessage, in order
+const scheduledColumns = `id, sender_id, receiver_id, kind, content, media_url, send_at, status, error, created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanScheduledMessage reads a scheduled message selected with scheduledColumns
+func scanScheduledMessage(row rowScanner) (*models.ScheduledMessage, error) {
+	var msg models.ScheduledMessage
+	err := row.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Kind, &msg.Content, &msg.MediaURL,
+		&msg.SendAt, &msg.Status, &msg.Error, &msg.CreatedAt, &msg.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// loadScheduledAttachments fills in the attachment IDs of the given scheduled messages
+func (r *SQLMessageRepository) loadScheduledAttachments(messages []models.ScheduledMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int, len(messages))
+	index := make(map[int]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+		index[msg.ID] = i
+	}
+
+	rows, err := r.db.Query(`
+        SELECT scheduled_message_id, attachment_id FROM scheduled_message_attachments
+        WHERE scheduled_message_id = ANY($1)
+        ORDER BY scheduled_message_id, position`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to load scheduled attachments: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var scheduledID, attachmentID int
+		if err := rows.Scan(&scheduledID, &attachmentID); err != nil {
+			return err
+		}
+		msg := &messages[index[scheduledID]]
+		msg.AttachmentIDs = append(msg.AttachmentIDs, attachmentID)
+	}
+	return rows.Err()
+}
+
+// insertScheduledAttachments links a scheduled message's attachments in order
+func insertScheduledAttachments(tx *sql.Tx, msg *models.ScheduledMessage) error {
+	for position, attachmentID := range msg.AttachmentIDs {
+		if _, err := tx.Exec(
+			`INSERT INTO scheduled_message_attachments (scheduled_message_id, attachment_id, position) VALUES ($1, $2, $3)`,
+			msg.ID, attachmentID, position,
+		); err != nil {
+			return fmt.Errorf("failed to attach file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *SQLMessageRepository) CreateScheduledMessage(msg *models.ScheduledMessage) error {
+	if msg.Kind == "" {
+		msg.Kind = models.KindText
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+        INSERT INTO scheduled_messages (sender_id, receiver_id, kind, content, media_url, send_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, status, created_at, updated_at`,
+		msg.SenderID, msg.ReceiverID, msg.Kind, msg.Content, msg.MediaURL, msg.SendAt,
+	).Scan(&msg.ID, &msg.Status, &msg.CreatedAt, &msg.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to schedule message: %w", err)
+	}
+	if err := insertScheduledAttachments(tx, msg); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLMessageRepository) GetScheduledMessages(senderID, page, pageSize int) ([]models.ScheduledMessage, *models.Pagination, error) {
+	var totalItems int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM scheduled_messages WHERE sender_id = $1`, senderID).Scan(&totalItems); err != nil {
+		return nil, nil, fmt.Errorf("failed to count scheduled messages: %w", err)
+	}
+	pagination := models.NewPagination(page, pageSize, totalItems)
+
+	rows, err := r.db.Query(`SELECT `+scheduledColumns+` FROM scheduled_messages
+        WHERE sender_id = $1
+        ORDER BY send_at, id
+        LIMIT $2 OFFSET $3`, senderID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.ScheduledMessage{}
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan scheduled message: %w", err)
+		}
+		messages = append(messages, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err := r.loadScheduledAttachments(messages); err != nil {
+		return nil, nil, err
+	}
+	return messages, pagination, nil
+}
+
+// lockScheduledMessage locks one of senderID's scheduled messages for a change, making
+// sure it is not being sent
+func lockScheduledMessage(tx *sql.Tx, id, senderID int) error {
+	var claimed bool
+	err := tx.QueryRow(`
+        SELECT COALESCE(claimed_until > CURRENT_TIMESTAMP, FALSE) FROM scheduled_messages
+        WHERE id = $1 AND sender_id = $2
+        FOR UPDATE`, id, senderID).Scan(&claimed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock scheduled message: %w", err)
+	}
+	if claimed {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *SQLMessageRepository) UpdateScheduledMessage(msg *models.ScheduledMessage) error {
+	if msg.Kind == "" {
+		msg.Kind = models.KindText
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockScheduledMessage(tx, msg.ID, msg.SenderID); err != nil {
+		return err
+	}
+	err = tx.QueryRow(`
+        UPDATE scheduled_messages
+        SET kind = $1, content = $2, media_url = $3, send_at = $4,
+            status = 'pending', error = '', claimed_until = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $5
+        RETURNING receiver_id, status, error, created_at, updated_at`,
+		msg.Kind, msg.Content, msg.MediaURL, msg.SendAt, msg.ID,
+	).Scan(&msg.ReceiverID, &msg.Status, &msg.Error, &msg.CreatedAt, &msg.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update scheduled message: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM scheduled_message_attachments WHERE scheduled_message_id = $1`, msg.ID); err != nil {
+		return fmt.Errorf("failed to update scheduled attachments: %w", err)
+	}
+	if err := insertScheduledAttachments(tx, msg); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *SQLMessageRepository) DeleteScheduledMessage(id, senderID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockScheduledMessage(tx, id, senderID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM scheduled_messages WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to cancel scheduled message: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (r *SQLMessageRepository) ClaimScheduledMessages(limit int, lease time.Duration) ([]models.ScheduledMessage, error) {
+	// Due is judged by the database clock, so servers with skewed clocks agree on it
+	rows, err := r.db.Query(`
+        UPDATE scheduled_messages
+        SET claimed_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+        WHERE id IN (
+            SELECT id FROM scheduled_messages
+            WHERE status = 'pending' AND send_at <= CURRENT_TIMESTAMP
+              AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+            ORDER BY send_at, id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED)
+        RETURNING `+scheduledColumns,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.ScheduledMessage
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled message: %w", err)
+		}
+		messages = append(messages, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.loadScheduledAttachments(messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *SQLMessageRepository) FailScheduledMessage(id int, reason string) error {
+	_, err := r.db.Exec(`
+        UPDATE scheduled_messages
+        SET status = 'failed', error = $1, claimed_until = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $2`, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to record scheduled message failure: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLMessageRepository) GetConversationTimer(userID1, userID2 int) (*models.ConversationTimer, error) {
+	userA, userB := orderedPair(userID1, userID2)
+	timer := models.ConversationTimer{UserID: userID2}
+	var updatedBy sql.NullInt64
+	err := r.db.QueryRow(`
+        SELECT seconds, mode, updated_by, updated_at FROM conversation_timers
+        WHERE user_a = $1 AND user_b = $2`, userA, userB,
+	).Scan(&timer.Seconds, &timer.Mode, &updatedBy, &timer.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation timer: %w", err)
+	}
+	timer.UpdatedBy = int(updatedBy.Int64)
+	return &timer, nil
+}
+
+func (r *SQLMessageRepository) SetConversationTimer(userID int, timer *models.ConversationTimer) error {
+	userA, userB := orderedPair(userID, timer.UserID)
+	if timer.Seconds == 0 {
+		_, err := r.db.Exec(`DELETE FROM conversation_timers WHERE user_a = $1 AND user_b = $2`, userA, userB)
+		if err != nil {
+			return fmt.Errorf("failed to clear conversation timer: %w", err)
+		}
+		return nil
+	}
+
+	err := r.db.QueryRow(`
+        INSERT INTO conversation_timers (user_a, user_b, seconds, mode, updated_by)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (user_a, user_b) DO UPDATE
+        SET seconds = EXCLUDED.seconds, mode = EXCLUDED.mode,
+            updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP
+        RETURNING updated_at`,
+		userA, userB, timer.Seconds, timer.Mode, userID,
+	).Scan(&timer.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set conversation timer: %w", err)
+	}
+	timer.UpdatedBy = userID
+	return nil
+}
+
+// orderedPair returns two user IDs lowest first, as conversation_timers stores them
+func orderedPair(userID1, userID2 int) (int, int) {
+	if userID1 > userID2 {
+		return userID2, userID1
+	}
+	return userID1, userID2
+}
+
+func (r *SQLMessageRepository) DeleteExpiredMessages(policy models.RetentionPolicy, limit int) ([]models.ExpiredMessage, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Expiry is judged by the database clock, as it is when hiding expired messages
+	rows, err := tx.Query(`
+        SELECT m.id, m.sender_id, m.receiver_id FROM messages m
+        WHERE m.expires_at <= CURRENT_TIMESTAMP
+           OR ($2::bigint > 0 AND m.created_at < CURRENT_TIMESTAMP - $2::bigint * INTERVAL '1 millisecond')
+           OR ($3::bigint > 0 AND m.created_at < CURRENT_TIMESTAMP - $3::bigint * INTERVAL '1 millisecond'
+               AND EXISTS (SELECT 1 FROM users u WHERE u.id IN (m.sender_id, m.receiver_id) AND u.external))
+        ORDER BY m.id
+        LIMIT $1
+        FOR UPDATE OF m SKIP LOCKED`,
+		limit, policy.MaxAge.Milliseconds(), policy.ExternalMaxAge.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find expired messages: %w", err)
+	}
+	var expired []models.ExpiredMessage
+	for rows.Next() {
+		var msg models.ExpiredMessage
+		var senderID, receiverID sql.NullInt64
+		if err := rows.Scan(&msg.ID, &senderID, &receiverID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan expired message: %w", err)
+		}
+		msg.SenderID, msg.ReceiverID = int(senderID.Int64), int(receiverID.Int64)
+		expired = append(expired, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int, len(expired))
+	index := make(map[int]int, len(expired))
+	for i, msg := range expired {
+		ids[i] = msg.ID
+		index[msg.ID] = i
+	}
+	attachments, err := tx.Query(`
+        SELECT message_id, attachment_id FROM message_attachments
+        WHERE message_id = ANY($1)
+        ORDER BY message_id, position`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find attachments of expired messages: %w", err)
+	}
+	for attachments.Next() {
+		var messageID, attachmentID int
+		if err := attachments.Scan(&messageID, &attachmentID); err != nil {
+			attachments.Close()
+			return nil, err
+		}
+		msg := &expired[index[messageID]]
+		msg.AttachmentIDs = append(msg.AttachmentIDs, attachmentID)
+	}
+	attachments.Close()
+	if err := attachments.Err(); err != nil {
+		return nil, err
+	}
+
+	// Attachment links and link previews go with the messages through their foreign keys
+	if _, err := tx.Exec(`DELETE FROM messages WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("failed to delete expired messages: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// listedColumns lists the message columns read by scanListedMessage, in order, for
+// queries joining messages to another table
+const listedColumns = `messages.id, messages.sender_id, messages.receiver_id, messages.kind, messages.content,
+        messages.media_url, messages.link_preview, messages.entities, messages.mentioned,
+        COALESCE(messages.scheduled_message_id, 0), messages.expires_at, COALESCE(messages.expire_after, 0),
+        messages.status, messages.created_at`
+
+// scanListedMessage reads a message selected with listedColumns, followed by extra
+func scanListedMessage(row rowScanner, msg *models.Message, extra ...interface{}) error {
+	dest := []interface{}{
+		&msg.ID,
+		&msg.SenderID,
+		&msg.ReceiverID,
+		&msg.Kind,
+		&msg.Content,
+		&msg.MediaURL,
+		linkPreviewColumn{&msg.LinkPreview},
+		entitiesColumn{&msg.Entities},
+		&msg.Mentioned,
+		&msg.ScheduledID,
+		&msg.ExpiresAt,
+		&msg.ExpireAfter,
+		&msg.Status,
+		&msg.CreatedAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func (r *SQLMessageRepository) PinMessage(pin *models.Pin, limit int) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var senderID, receiverID sql.NullInt64
+	err = tx.QueryRow(`SELECT sender_id, receiver_id FROM messages WHERE id = $1`, pin.MessageID).Scan(&senderID, &receiverID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (!senderID.Valid || !receiverID.Valid)) {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find message: %w", err)
+	}
+	userA, userB := orderedPair(int(senderID.Int64), int(receiverID.Int64))
+
+	// Pins are counted under a lock on the conversation so that concurrent pins cannot
+	// go over the limit
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`, userA, userB); err != nil {
+		return false, fmt.Errorf("failed to lock conversation: %w", err)
+	}
+
+	err = tx.QueryRow(`SELECT COALESCE(pinned_by, 0), pinned_at FROM pinned_messages WHERE message_id = $1`,
+		pin.MessageID).Scan(&pin.PinnedBy, &pin.PinnedAt)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to check pin: %w", err)
+	}
+
+	var pinned int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM pinned_messages WHERE user_a = $1 AND user_b = $2`,
+		userA, userB).Scan(&pinned); err != nil {
+		return false, fmt.Errorf("failed to count pins: %w", err)
+	}
+	if pinned >= limit {
+		return false, fmt.Errorf("%w: conversation has %d pinned messages", ErrConflict, pinned)
+	}
+
+	err = tx.QueryRow(`
+        INSERT INTO pinned_messages (message_id, user_a, user_b, pinned_by)
+        VALUES ($1, $2, $3, $4)
+        RETURNING pinned_at`, pin.MessageID, userA, userB, pin.PinnedBy,
+	).Scan(&pin.PinnedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to pin message: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *SQLMessageRepository) UnpinMessage(messageID int) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM pinned_messages WHERE message_id = $1`, messageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unpin message: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *SQLMessageRepository) GetPinnedMessages(userID1, userID2, page, pageSize int) ([]models.PinnedMessage, *models.Pagination, error) {
+	userA, userB := orderedPair(userID1, userID2)
+
+	var totalItems int
+	err := r.db.QueryRow(`
+        SELECT COUNT(*) FROM pinned_messages p JOIN messages ON messages.id = p.message_id
+        WHERE p.user_a = $2 AND p.user_b = $3 AND `+visibleToViewer, userID1, userA, userB,
+	).Scan(&totalItems)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count pinned messages: %w", err)
+	}
+	pagination := models.NewPagination(page, pageSize, totalItems)
+
+	rows, err := r.db.Query(`
+        SELECT `+listedColumns+`, COALESCE(p.pinned_by, 0), p.pinned_at
+        FROM pinned_messages p JOIN messages ON messages.id = p.message_id
+        WHERE p.user_a = $2 AND p.user_b = $3 AND `+visibleToViewer+`
+        ORDER BY p.pinned_at DESC, p.message_id DESC
+        LIMIT $4 OFFSET $5`, userID1, userA, userB, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list pinned messages: %w", err)
+	}
+	defer rows.Close()
+
+	pinned := []models.PinnedMessage{}
+	for rows.Next() {
+		var msg models.PinnedMessage
+		if err := scanListedMessage(rows, &msg.Message, &msg.PinnedBy, &msg.PinnedAt); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan pinned message: %w", err)
+		}
+		pinned = append(pinned, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	messages := make([]models.Message, len(pinned))
+	for i := range pinned {
+		messages[i] = pinned[i].Message
+	}
+	if err := r.loadAttachments(messages); err != nil {
+		return nil, nil, err
+	}
+	for i := range pinned {
+		pinned[i].Message = messages[i]
+	}
+	return pinned, pagination, nil
+}
+
+func (r *SQLMessageRepository) StarMessage(userID, messageID int) error {
+	_, err := r.db.Exec(`
+        INSERT INTO starred_messages (user_id, message_id) VALUES ($1, $2)
+        ON CONFLICT (user_id, message_id) DO NOTHING`, userID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to star message: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLMessageRepository) UnstarMessage(userID, messageID int) error {
+	_, err := r.db.Exec(`DELETE FROM starred_messages WHERE user_id = $1 AND message_id = $2`, userID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to unstar message: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLMessageRepository) GetStarredMessages(userID, page, pageSize int) ([]models.StarredMessage, *models.Pagination, error) {
+	var totalItems int
+	err := r.db.QueryRow(`
+        SELECT COUNT(*) FROM starred_messages s JOIN messages ON messages.id = s.message_id
+        WHERE s.user_id = $1 AND `+visibleToViewer, userID,
+	).Scan(&totalItems)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count starred messages: %w", err)
+	}
+	pagination := models.NewPagination(page, pageSize, totalItems)
+
+	rows, err := r.db.Query(`
+        SELECT `+listedColumns+`, s.starred_at
+        FROM starred_messages s JOIN messages ON messages.id = s.message_id
+        WHERE s.user_id = $1 AND `+visibleToViewer+`
+        ORDER BY s.starred_at DESC, s.message_id DESC
+        LIMIT $2 OFFSET $3`, userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list starred messages: %w", err)
+	}
+	defer rows.Close()
+
+	starred := []models.StarredMessage{}
+	for rows.Next() {
+		var msg models.StarredMessage
+		if err := scanListedMessage(rows, &msg.Message, &msg.StarredAt); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan starred message: %w", err)
+		}
+		starred = append(starred, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	messages := make([]models.Message, len(starred))
+	for i := range starred {
+		messages[i] = starred[i].Message
+	}
+	if err := r.loadAttachments(messages); err != nil {
+		return nil, nil, err
+	}
+	for i := range starred {
+		starred[i].Message = messages[i]
+	}
+	return starred, pagination, nil
+}
@@ -3,6 +3,7 @@ package repository
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,25 +12,105 @@ import (
 
 // TestMessageRepository provides an in-memory implementation of Repository for testing
 type TestMessageRepository struct {
-	messages map[int]*models.Message
-	mu       sync.RWMutex
-	nextID   int
+	messages  map[int]*models.Message
+	blocks    map[[2]int]bool
+	linkJobs  map[int]*testLinkJob
+	linkCache map[string]testCachedPreview
+	scheduled map[int]*testScheduled
+	timers    map[[2]int]models.ConversationTimer
+	external  map[int]bool
+	pins      map[int]models.Pin
+	stars     map[[2]int]time.Time
+	mu        sync.RWMutex
+	nextID    int
+	now       func() time.Time
+}
+
+type testScheduled struct {
+	msg          models.ScheduledMessage
+	claimedUntil time.Time
+}
+
+type testLinkJob struct {
+	url          string
+	claimedUntil time.Time
+}
+
+type testCachedPreview struct {
+	preview   *models.LinkPreview
+	fetchedAt time.Time
 }
 
 // NewTestMessageRepository creates a new instance of TestMessageRepository
 func NewTestMessageRepository() *TestMessageRepository {
 	return &TestMessageRepository{
-		messages: make(map[int]*models.Message),
-		nextID:   1,
+		messages:  make(map[int]*models.Message),
+		blocks:    make(map[[2]int]bool),
+		linkJobs:  make(map[int]*testLinkJob),
+		linkCache: make(map[string]testCachedPreview),
+		scheduled: make(map[int]*testScheduled),
+		timers:    make(map[[2]int]models.ConversationTimer),
+		external:  make(map[int]bool),
+		pins:      make(map[int]models.Pin),
+		stars:     make(map[[2]int]time.Time),
+		nextID:    1,
+		now:       time.Now,
+	}
+}
+
+// SetClock replaces the clock used to time messages and decide which scheduled
+// messages are due, whether claims have expired and which messages have expired
+func (r *TestMessageRepository) SetClock(now func() time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now = now
+}
+
+// SetBlocked records that blockerID has blocked blockedID, which hides the
+// blocked user's messages from the blocker's history
+func (r *TestMessageRepository) SetBlocked(blockerID, blockedID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blocks[[2]int{blockerID, blockedID}] = true
+}
+
+// SetExternal marks userID as an external user, whose messages are kept for the
+// external retention period
+func (r *TestMessageRepository) SetExternal(userID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.external[userID] = true
+}
+
+// visibleTo reports whether viewerID should see msg; the caller must hold the lock
+func (r *TestMessageRepository) visibleTo(msg *models.Message, viewerID int) bool {
+	if msg.ExpiresAt != nil && !msg.ExpiresAt.After(r.now()) {
+		return false
 	}
+	return !r.blocks[[2]int{viewerID, msg.SenderID}]
 }
 
 func (r *TestMessageRepository) Create(msg *models.Message) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if msg.ScheduledID != 0 {
+		for _, existing := range r.messages {
+			if existing.ScheduledID == msg.ScheduledID {
+				return fmt.Errorf("%w: scheduled message %d was already sent", ErrConflict, msg.ScheduledID)
+			}
+		}
+		if _, ok := r.scheduled[msg.ScheduledID]; !ok {
+			return fmt.Errorf("%w: scheduled message %d was cancelled", ErrConflict, msg.ScheduledID)
+		}
+		delete(r.scheduled, msg.ScheduledID)
+	}
+
 	msg.ID = r.nextID
-	msg.CreatedAt = time.Now()
+	msg.CreatedAt = r.now()
+	if msg.Kind == "" {
+		msg.Kind = models.KindText
+	}
 	r.messages[msg.ID] = msg
 	r.nextID++
 
@@ -42,8 +123,8 @@ func (r *TestMessageRepository) GetConversation(userID1, userID2 int) ([]models.
 
 	var conversation []models.Message
 	for _, msg := range r.messages {
-		if (msg.SenderID == userID1 && msg.ReceiverID == userID2) ||
-			(msg.SenderID == userID2 && msg.ReceiverID == userID1) {
+		if ((msg.SenderID == userID1 && msg.ReceiverID == userID2) ||
+			(msg.SenderID == userID2 && msg.ReceiverID == userID1)) && r.visibleTo(msg, userID1) {
 			conversation = append(conversation, *msg)
 		}
 	}
@@ -52,9 +133,12 @@ func (r *TestMessageRepository) GetConversation(userID1, userID2 int) ([]models.
 }
 
 func (r *TestMessageRepository) GetMessageHistory(userID int) ([]models.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	var messages []models.Message
 	for _, msg := range r.messages {
-		if msg.SenderID == userID || msg.ReceiverID == userID {
+		if (msg.SenderID == userID || msg.ReceiverID == userID) && r.visibleTo(msg, userID) {
 			messages = append(messages, *msg)
 		}
 	}
@@ -77,7 +161,11 @@ func (r *TestMessageRepository) UpdateMessageStatus(messageID int, status models
 
 	if msg, exists := r.messages[messageID]; exists {
 		msg.Status = status
-		msg.UpdatedAt = time.Now()
+		msg.UpdatedAt = r.now()
+		if (status == models.StatusRead || status == models.StatusPlayed) && msg.ExpiresAt == nil && msg.ExpireAfter > 0 {
+			expiresAt := msg.UpdatedAt.Add(time.Duration(msg.ExpireAfter) * time.Second)
+			msg.ExpiresAt = &expiresAt
+		}
 		return nil
 	}
 	return fmt.Errorf("message not found")
@@ -91,8 +179,8 @@ func (r *TestMessageRepository) GetConversationPaginated(userID1, userID2, page,
 	// First get all messages in conversation
 	var conversation []models.Message
 	for _, msg := range r.messages {
-		if (msg.SenderID == userID1 && msg.ReceiverID == userID2) ||
-			(msg.SenderID == userID2 && msg.ReceiverID == userID1) {
+		if ((msg.SenderID == userID1 && msg.ReceiverID == userID2) ||
+			(msg.SenderID == userID2 && msg.ReceiverID == userID1)) && r.visibleTo(msg, userID1) {
 			conversation = append(conversation, *msg)
 		}
 	}
@@ -125,7 +213,7 @@ func (r *TestMessageRepository) GetMessageHistoryPaginated(userID, page, pageSiz
 	// First get all messages
 	var messages []models.Message
 	for _, msg := range r.messages {
-		if msg.SenderID == userID || msg.ReceiverID == userID {
+		if (msg.SenderID == userID || msg.ReceiverID == userID) && r.visibleTo(msg, userID) {
 			messages = append(messages, *msg)
 		}
 	}
@@ -163,3 +251,392 @@ func (r *TestMessageRepository) GetMessagesByUser(userID int) ([]models.Message,
 	}
 	return messages, nil
 }
+
+func (r *TestMessageRepository) QueueLinkPreview(messageID int, url string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.linkJobs[messageID]; !ok {
+		r.linkJobs[messageID] = &testLinkJob{url: url}
+	}
+	return nil
+}
+
+func (r *TestMessageRepository) ClaimLinkPreviewJobs(limit int, lease time.Duration) ([]models.LinkPreviewJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int, 0, len(r.linkJobs))
+	for id := range r.linkJobs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	now := time.Now()
+	var jobs []models.LinkPreviewJob
+	for _, id := range ids {
+		job := r.linkJobs[id]
+		if len(jobs) == limit || job.claimedUntil.After(now) {
+			continue
+		}
+		job.claimedUntil = now.Add(lease)
+		msg := r.messages[id]
+		jobs = append(jobs, models.LinkPreviewJob{
+			MessageID: id, SenderID: msg.SenderID, ReceiverID: msg.ReceiverID, URL: job.url,
+		})
+	}
+	return jobs, nil
+}
+
+// PendingLinkPreviews returns how many link preview jobs are queued, claimed or not
+func (r *TestMessageRepository) PendingLinkPreviews() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.linkJobs)
+}
+
+func (r *TestMessageRepository) CompleteLinkPreview(messageID int, preview *models.LinkPreview) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if msg, ok := r.messages[messageID]; ok {
+		msg.LinkPreview = preview
+	}
+	delete(r.linkJobs, messageID)
+	return nil
+}
+
+func (r *TestMessageRepository) GetCachedLinkPreview(url string, since time.Time) (*models.LinkPreview, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cached, ok := r.linkCache[url]
+	if !ok || !cached.fetchedAt.After(since) {
+		return nil, false, nil
+	}
+	return cached.preview, true, nil
+}
+
+func (r *TestMessageRepository) CacheLinkPreview(url string, preview *models.LinkPreview) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.linkCache[url] = testCachedPreview{preview: preview, fetchedAt: time.Now()}
+	return nil
+}
+
+func (r *TestMessageRepository) CreateScheduledMessage(msg *models.ScheduledMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg.ID = r.nextID
+	r.nextID++
+	if msg.Kind == "" {
+		msg.Kind = models.KindText
+	}
+	msg.Status = models.ScheduledPending
+	msg.CreatedAt = r.now()
+	msg.UpdatedAt = msg.CreatedAt
+	r.scheduled[msg.ID] = &testScheduled{msg: *msg}
+	return nil
+}
+
+func (r *TestMessageRepository) GetScheduledMessages(senderID, page, pageSize int) ([]models.ScheduledMessage, *models.Pagination, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := []models.ScheduledMessage{}
+	for _, scheduled := range r.scheduled {
+		if scheduled.msg.SenderID == senderID {
+			messages = append(messages, scheduled.msg)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].SendAt.Equal(messages[j].SendAt) {
+			return messages[i].SendAt.Before(messages[j].SendAt)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+
+	pagination := models.NewPagination(page, pageSize, len(messages))
+	start := (page - 1) * pageSize
+	if start > len(messages) {
+		start = len(messages)
+	}
+	end := start + pageSize
+	if end > len(messages) {
+		end = len(messages)
+	}
+	return messages[start:end], pagination, nil
+}
+
+// lockScheduled returns one of senderID's scheduled messages that is not being sent; the
+// caller must hold the lock
+func (r *TestMessageRepository) lockScheduled(id, senderID int) (*testScheduled, error) {
+	scheduled, ok := r.scheduled[id]
+	if !ok || scheduled.msg.SenderID != senderID {
+		return nil, ErrNotFound
+	}
+	if scheduled.claimedUntil.After(r.now()) {
+		return nil, ErrConflict
+	}
+	return scheduled, nil
+}
+
+func (r *TestMessageRepository) UpdateScheduledMessage(msg *models.ScheduledMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scheduled, err := r.lockScheduled(msg.ID, msg.SenderID)
+	if err != nil {
+		return err
+	}
+	if msg.Kind == "" {
+		msg.Kind = models.KindText
+	}
+	msg.ReceiverID = scheduled.msg.ReceiverID
+	msg.CreatedAt = scheduled.msg.CreatedAt
+	msg.UpdatedAt = r.now()
+	msg.Status = models.ScheduledPending
+	msg.Error = ""
+	scheduled.msg = *msg
+	scheduled.claimedUntil = time.Time{}
+	return nil
+}
+
+func (r *TestMessageRepository) DeleteScheduledMessage(id, senderID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.lockScheduled(id, senderID); err != nil {
+		return err
+	}
+	delete(r.scheduled, id)
+	return nil
+}
+
+func (r *TestMessageRepository) ClaimScheduledMessages(limit int, lease time.Duration) ([]models.ScheduledMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var due []*testScheduled
+	for _, scheduled := range r.scheduled {
+		if scheduled.msg.Status == models.ScheduledPending && !scheduled.msg.SendAt.After(now) && !scheduled.claimedUntil.After(now) {
+			due = append(due, scheduled)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].msg.SendAt.Equal(due[j].msg.SendAt) {
+			return due[i].msg.SendAt.Before(due[j].msg.SendAt)
+		}
+		return due[i].msg.ID < due[j].msg.ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	messages := make([]models.ScheduledMessage, 0, len(due))
+	for _, scheduled := range due {
+		scheduled.claimedUntil = now.Add(lease)
+		messages = append(messages, scheduled.msg)
+	}
+	return messages, nil
+}
+
+func (r *TestMessageRepository) FailScheduledMessage(id int, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if scheduled, ok := r.scheduled[id]; ok {
+		scheduled.msg.Status = models.ScheduledFailed
+		scheduled.msg.Error = reason
+		scheduled.claimedUntil = time.Time{}
+	}
+	return nil
+}
+
+// timerKey identifies the conversation between two users
+func timerKey(userID1, userID2 int) [2]int {
+	if userID1 > userID2 {
+		return [2]int{userID2, userID1}
+	}
+	return [2]int{userID1, userID2}
+}
+
+func (r *TestMessageRepository) GetConversationTimer(userID1, userID2 int) (*models.ConversationTimer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	timer, ok := r.timers[timerKey(userID1, userID2)]
+	if !ok {
+		return nil, nil
+	}
+	timer.UserID = userID2
+	return &timer, nil
+}
+
+func (r *TestMessageRepository) SetConversationTimer(userID int, timer *models.ConversationTimer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := timerKey(userID, timer.UserID)
+	if timer.Seconds == 0 {
+		delete(r.timers, key)
+		return nil
+	}
+	timer.UpdatedBy = userID
+	timer.UpdatedAt = r.now()
+	r.timers[key] = *timer
+	return nil
+}
+
+// expired reports whether msg has expired under its timer or policy; the caller must
+// hold the lock
+func (r *TestMessageRepository) expired(msg *models.Message, policy models.RetentionPolicy, now time.Time) bool {
+	if msg.ExpiresAt != nil && !msg.ExpiresAt.After(now) {
+		return true
+	}
+	if policy.MaxAge > 0 && msg.CreatedAt.Before(now.Add(-policy.MaxAge)) {
+		return true
+	}
+	external := r.external[msg.SenderID] || r.external[msg.ReceiverID]
+	return external && policy.ExternalMaxAge > 0 && msg.CreatedAt.Before(now.Add(-policy.ExternalMaxAge))
+}
+
+func (r *TestMessageRepository) DeleteExpiredMessages(policy models.RetentionPolicy, limit int) ([]models.ExpiredMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var ids []int
+	for id, msg := range r.messages {
+		if r.expired(msg, policy, now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	var expired []models.ExpiredMessage
+	for _, id := range ids {
+		msg := r.messages[id]
+		deleted := models.ExpiredMessage{ID: id, SenderID: msg.SenderID, ReceiverID: msg.ReceiverID}
+		for _, attachment := range msg.Attachments {
+			deleted.AttachmentIDs = append(deleted.AttachmentIDs, attachment.ID)
+		}
+		expired = append(expired, deleted)
+		delete(r.messages, id)
+		delete(r.linkJobs, id)
+		delete(r.pins, id)
+		for key := range r.stars {
+			if key[1] == id {
+				delete(r.stars, key)
+			}
+		}
+	}
+	return expired, nil
+}
+
+// pageOf returns the items on a page
+func pageOf[T any](items []T, page, pageSize int) []T {
+	start := (page - 1) * pageSize
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+func (r *TestMessageRepository) PinMessage(pin *models.Pin, limit int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.messages[pin.MessageID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if existing, ok := r.pins[pin.MessageID]; ok {
+		*pin = existing
+		return false, nil
+	}
+	key := timerKey(msg.SenderID, msg.ReceiverID)
+	pinned := 0
+	for id := range r.pins {
+		if other := r.messages[id]; other != nil && timerKey(other.SenderID, other.ReceiverID) == key {
+			pinned++
+		}
+	}
+	if pinned >= limit {
+		return false, fmt.Errorf("%w: conversation has %d pinned messages", ErrConflict, pinned)
+	}
+	pin.PinnedAt = r.now()
+	r.pins[pin.MessageID] = *pin
+	return true, nil
+}
+
+func (r *TestMessageRepository) UnpinMessage(messageID int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.pins[messageID]
+	delete(r.pins, messageID)
+	return ok, nil
+}
+
+func (r *TestMessageRepository) GetPinnedMessages(userID1, userID2, page, pageSize int) ([]models.PinnedMessage, *models.Pagination, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := timerKey(userID1, userID2)
+	pinned := []models.PinnedMessage{}
+	for id, pin := range r.pins {
+		msg := r.messages[id]
+		if msg == nil || timerKey(msg.SenderID, msg.ReceiverID) != key || !r.visibleTo(msg, userID1) {
+			continue
+		}
+		pinned = append(pinned, models.PinnedMessage{Message: *msg, PinnedBy: pin.PinnedBy, PinnedAt: pin.PinnedAt})
+	}
+	sort.Slice(pinned, func(i, j int) bool {
+		if !pinned[i].PinnedAt.Equal(pinned[j].PinnedAt) {
+			return pinned[i].PinnedAt.After(pinned[j].PinnedAt)
+		}
+		return pinned[i].ID > pinned[j].ID
+	})
+	return pageOf(pinned, page, pageSize), models.NewPagination(page, pageSize, len(pinned)), nil
+}
+
+func (r *TestMessageRepository) StarMessage(userID, messageID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := [2]int{userID, messageID}
+	if _, ok := r.stars[key]; !ok {
+		r.stars[key] = r.now()
+	}
+	return nil
+}
+
+func (r *TestMessageRepository) UnstarMessage(userID, messageID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.stars, [2]int{userID, messageID})
+	return nil
+}
+
+func (r *TestMessageRepository) GetStarredMessages(userID, page, pageSize int) ([]models.StarredMessage, *models.Pagination, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	starred := []models.StarredMessage{}
+	for key, starredAt := range r.stars {
+		msg := r.messages[key[1]]
+		if key[0] != userID || msg == nil || !r.visibleTo(msg, userID) {
+			continue
+		}
+		starred = append(starred, models.StarredMessage{Message: *msg, StarredAt: starredAt})
+	}
+	sort.Slice(starred, func(i, j int) bool {
+		if !starred[i].StarredAt.Equal(starred[j].StarredAt) {
+			return starred[i].StarredAt.After(starred[j].StarredAt)
+		}
+		return starred[i].ID > starred[j].ID
+	})
+	return pageOf(starred, page, pageSize), models.NewPagination(page, pageSize, len(starred)), nil
+}
@@ -0,0 +1,379 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/probe"
+	"github.com/Mousa96/chatting-service/internal/media/sniff"
+)
+
+// MaxAttachments is the most files a single message may carry
+const MaxAttachments = 10
+
+// maxFilenameLength bounds the original file name kept with an attachment
+const maxFilenameLength = 255
+
+// ErrUploadsDisabled is returned by UploadMedia when no attachment store is configured
+var ErrUploadsDisabled = errors.New("media uploads are not configured")
+
+// AttachmentStore keeps the metadata of uploaded files
+type AttachmentStore interface {
+	CreateAttachment(attachment *mediaModels.Attachment) error
+	GetAttachments(ids []int) ([]mediaModels.Attachment, error)
+	// GetAttachmentByKey returns the most recent attachment stored under key
+	GetAttachmentByKey(key string) (*mediaModels.Attachment, error)
+}
+
+// PreviewGenerator creates thumbnails and placeholders for uploaded files
+type PreviewGenerator interface {
+	// Generate stores previews for the file under key, returning nil if the type has none
+	Generate(key, contentType string, content io.Reader) (*mediaModels.Previews, error)
+	// Remove deletes previously generated variants
+	Remove(variants []mediaModels.Variant)
+}
+
+// ImageSanitizer rewrites uploaded images without metadata before they are stored
+type ImageSanitizer interface {
+	// Sanitize returns the cleaned image, or ok=false for content types it does not handle
+	Sanitize(content io.Reader, contentType string) (clean []byte, ok bool, err error)
+}
+
+// StorageQuota accounts for the bytes each user stores
+type StorageQuota interface {
+	// Check returns an error wrapping ErrQuotaExceeded when userID cannot store size more bytes
+	Check(userID int, size int64) error
+	// Reserve counts size bytes against userID's quota, failing like Check when they do not fit
+	Reserve(userID int, size int64) error
+	// Release gives back bytes reserved for a file that was not kept
+	Release(userID int, size int64) error
+}
+
+// WithStorageQuota limits how much each user may upload
+func WithStorageQuota(quota StorageQuota) Option {
+	return func(s *MessageService) {
+		s.quota = quota
+	}
+}
+
+// WithImageSanitizer strips metadata from uploaded images before they are stored
+func WithImageSanitizer(sanitizer ImageSanitizer) Option {
+	return func(s *MessageService) {
+		s.sanitizer = sanitizer
+	}
+}
+
+// WithPreviews generates thumbnails for uploaded images and videos
+func WithPreviews(generator PreviewGenerator) Option {
+	return func(s *MessageService) {
+		s.previews = generator
+	}
+}
+
+// WithAttachmentStore enables media uploads and attachments on messages
+func WithAttachmentStore(store AttachmentStore) Option {
+	return func(s *MessageService) {
+		s.attachments = store
+	}
+}
+
+// checkMediaURL keeps uploaded files out of media_url, since they must be attached by ID
+// so the service can check who uploaded them
+func checkMediaURL(mediaURL string) error {
+	if strings.HasPrefix(mediaURL, mediaModels.URLPrefix) {
+		return fmt.Errorf("%w: uploaded files must be sent as attachment_ids", ErrInvalidMedia)
+	}
+	return nil
+}
+
+// resolveAttachments loads the attachments for a message in the requested order, making
+// sure each one exists and was uploaded by the sender, since sending a file grants the
+// recipient access to it
+func (s *MessageService) resolveAttachments(senderID int, ids []int) ([]mediaModels.Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if len(ids) > MaxAttachments {
+		return nil, fmt.Errorf("%w: at most %d attachments per message", ErrInvalidMedia, MaxAttachments)
+	}
+	if s.attachments == nil {
+		return nil, fmt.Errorf("%w: attachments are not supported", ErrInvalidMedia)
+	}
+
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return nil, fmt.Errorf("%w: attachment %d is listed twice", ErrInvalidMedia, id)
+		}
+		seen[id] = true
+	}
+
+	found, err := s.attachments.GetAttachments(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load attachments: %w", err)
+	}
+	byID := make(map[int]mediaModels.Attachment, len(found))
+	for _, attachment := range found {
+		byID[attachment.ID] = attachment
+	}
+
+	attachments := make([]mediaModels.Attachment, 0, len(ids))
+	for _, id := range ids {
+		attachment, ok := byID[id]
+		if !ok || attachment.OwnerID != senderID {
+			return nil, fmt.Errorf("%w: attachment %d not found", ErrInvalidMedia, id)
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+func (s *MessageService) UploadMedia(userID int, file *multipart.FileHeader) (*mediaModels.Attachment, error) {
+	if s.attachments == nil {
+		return nil, ErrUploadsDisabled
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+	return s.ImportMedia(userID, file.Filename, src, file.Size)
+}
+
+func (s *MessageService) ImportMedia(userID int, filename string, src io.ReadSeeker, size int64) (*mediaModels.Attachment, error) {
+	if s.attachments == nil {
+		return nil, ErrUploadsDisabled
+	}
+
+	// The stored type comes from the content rather than the client's header
+	head := make([]byte, sniff.Length)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidMedia)
+	}
+	contentType := sniff.Detect(head[:n])
+	if err := s.mediaPolicy.Check(contentType, size); err != nil {
+		return nil, err
+	}
+
+	// Files are scanned as received, before sanitizing rewrites them
+	err = s.scanUpload(userID, filename, contentType, size, func() (io.ReadCloser, error) {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(src), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	content, size, err := s.sanitize(src, size, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	info := probe.Probe(content, contentType)
+	hash, err := hashContent(content)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &mediaModels.Attachment{
+		OwnerID:     userID,
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      hash,
+		Filename:    originalFilename(filename),
+		Width:       info.Width,
+		Height:      info.Height,
+		DurationMs:  info.DurationMs,
+	}
+	if s.blobs != nil {
+		return s.importBlob(attachment, content, filepath.Ext(filename))
+	}
+
+	// Random file names keep media URLs unguessable
+	key, err := mediaModels.NewKey(userID, filepath.Ext(filename))
+	if err != nil {
+		return nil, err
+	}
+	attachment.Key = key
+
+	// Sanitized images are charged for the size actually stored
+	if err := s.reserveStorage(userID, size); err != nil {
+		return nil, err
+	}
+	if _, err := s.storage.Upload(key, content, contentType); err != nil {
+		s.releaseStorage(userID, size)
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	previews := s.generatePreviews(key, contentType, content)
+	applyPreviews(attachment, previews)
+	if err := s.attachments.CreateAttachment(attachment); err != nil {
+		if deleteErr := s.storage.Delete(key); deleteErr != nil {
+			log.Printf("Failed to remove upload %s after error: %v", key, deleteErr)
+		}
+		if previews != nil {
+			s.previews.Remove(previews.Variants)
+		}
+		s.releaseStorage(userID, size)
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+	return attachment, nil
+}
+
+func (s *MessageService) AdoptMedia(userID int, key, filename, contentType string, size int64) (*mediaModels.Attachment, error) {
+	if s.attachments == nil {
+		return nil, ErrUploadsDisabled
+	}
+	if err := s.mediaPolicy.Check(contentType, size); err != nil {
+		return nil, err
+	}
+	// Media access checks take the owner from the key
+	if owner, ok := mediaModels.OwnerID(key); !ok || owner != userID || !mediaModels.ValidKey(key) {
+		return nil, fmt.Errorf("%w: file does not belong to user %d", ErrInvalidMedia, userID)
+	}
+	if err := s.scanStored(userID, key, filename, contentType, size); err != nil {
+		return nil, err
+	}
+
+	if err := s.reserveStorage(userID, size); err != nil {
+		return nil, err
+	}
+
+	// The file was never read here, so it has no checksum, dimensions or previews
+	attachment := &mediaModels.Attachment{
+		OwnerID:     userID,
+		Key:         key,
+		ContentType: contentType,
+		Size:        size,
+		Filename:    originalFilename(filename),
+	}
+	if err := s.attachments.CreateAttachment(attachment); err != nil {
+		s.releaseStorage(userID, size)
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+	return attachment, nil
+}
+
+func (s *MessageService) CheckQuota(userID int, size int64) error {
+	if s.quota == nil {
+		return nil
+	}
+	return s.quota.Check(userID, size)
+}
+
+// reserveStorage counts a file against its owner's quota before it is stored
+func (s *MessageService) reserveStorage(userID int, size int64) error {
+	if s.quota == nil {
+		return nil
+	}
+	return s.quota.Reserve(userID, size)
+}
+
+// releaseStorage gives back storage reserved for a file that was not kept. A failure
+// leaves the user charged for bytes they do not use, which is logged rather than
+// hiding the error that caused the release.
+func (s *MessageService) releaseStorage(userID int, size int64) {
+	if s.quota == nil {
+		return
+	}
+	if err := s.quota.Release(userID, size); err != nil {
+		log.Printf("Failed to release %d bytes of storage for user %d: %v", size, userID, err)
+	}
+}
+
+// sanitize runs the image sanitizer over an upload, returning the content to store and
+// its size. Images that cannot be decoded are refused.
+func (s *MessageService) sanitize(src io.ReadSeeker, size int64, contentType string) (io.ReadSeeker, int64, error) {
+	if s.sanitizer == nil {
+		return src, size, nil
+	}
+	clean, ok, err := s.sanitizer.Sanitize(src, contentType)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidMedia, err)
+	}
+	if !ok {
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, fmt.Errorf("failed to read file: %w", err)
+		}
+		return src, size, nil
+	}
+	return bytes.NewReader(clean), int64(len(clean)), nil
+}
+
+// generatePreviews creates thumbnails for an upload. Previews are an optimisation, so
+// failures are logged and the attachment is kept without them.
+func (s *MessageService) generatePreviews(key, contentType string, src io.ReadSeeker) *mediaModels.Previews {
+	if s.previews == nil {
+		return nil
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		log.Printf("Failed to rewind upload %s for previews: %v", key, err)
+		return nil
+	}
+	previews, err := s.previews.Generate(key, contentType, src)
+	if err != nil {
+		log.Printf("Failed to generate previews for %s: %v", key, err)
+		return nil
+	}
+	return previews
+}
+
+// applyPreviews records generated previews on their attachment. The duration measured
+// while decoding audio is only used when the container did not record one.
+func applyPreviews(attachment *mediaModels.Attachment, previews *mediaModels.Previews) {
+	if previews == nil {
+		return
+	}
+	attachment.Blurhash = previews.Blurhash
+	attachment.Variants = previews.Variants
+	attachment.Waveform = previews.Waveform
+	if attachment.DurationMs == nil {
+		attachment.DurationMs = previews.DurationMs
+	}
+}
+
+// hashContent returns the hex SHA-256 of all of content and rewinds it
+func hashContent(content io.ReadSeeker) (string, error) {
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// originalFilename strips any directories a client sent and bounds the name's length
+func originalFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = string(runes[:maxFilenameLength])
+	}
+	return name
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/storage"
+)
+
+// BlobStore keeps one copy of each distinct uploaded file, counting the attachments
+// that share it
+type BlobStore interface {
+	// Acquire adds a reference to the stored blob with hash, returning false if there is none
+	Acquire(hash string) (*storage.Blob, bool, error)
+	// Store writes a new blob with one reference. stored is false when the same content
+	// was stored concurrently and that blob was referenced instead.
+	Store(hash string, content io.Reader, size int64, contentType, ext string, ownerID int) (blob *storage.Blob, stored bool, err error)
+	// Release drops a reference, returning the blob if it was the last one and the file was deleted
+	Release(hash string) (*storage.Blob, error)
+}
+
+// WithBlobStore stores uploads once per distinct content, so a file uploaded again,
+// such as a forwarded image, shares the stored copy instead of taking more space
+func WithBlobStore(blobs BlobStore) Option {
+	return func(s *MessageService) {
+		s.blobs = blobs
+	}
+}
+
+// importBlob stores an upload as a shared blob. Content that is already stored is not
+// uploaded again, costs the uploader no quota and reuses the stored file's previews.
+func (s *MessageService) importBlob(attachment *mediaModels.Attachment, content io.ReadSeeker, ext string) (*mediaModels.Attachment, error) {
+	blob, found, err := s.blobs.Acquire(attachment.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := false
+	if !found {
+		// The uploader who stores a blob is charged for it
+		if err := s.reserveStorage(attachment.OwnerID, attachment.Size); err != nil {
+			return nil, err
+		}
+		blob, stored, err = s.blobs.Store(attachment.SHA256, content, attachment.Size, attachment.ContentType, ext, attachment.OwnerID)
+		if err != nil || !stored {
+			s.releaseStorage(attachment.OwnerID, attachment.Size)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload file: %w", err)
+		}
+	}
+	attachment.Key = blob.Key
+
+	if stored || !s.copyPreviews(attachment) {
+		applyPreviews(attachment, s.generatePreviews(blob.Key, attachment.ContentType, content))
+	}
+
+	if err := s.attachments.CreateAttachment(attachment); err != nil {
+		s.releaseBlob(attachment)
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+	return attachment, nil
+}
+
+// copyPreviews gives an attachment the placeholder, variants and waveform of another
+// attachment sharing its blob, reporting false if there is none to copy from
+func (s *MessageService) copyPreviews(attachment *mediaModels.Attachment) bool {
+	existing, err := s.attachments.GetAttachmentByKey(attachment.Key)
+	if err != nil {
+		// The blob may have been stored by an upload that has not saved its attachment yet
+		return false
+	}
+	attachment.Blurhash = existing.Blurhash
+	attachment.Variants = existing.Variants
+	attachment.Waveform = existing.Waveform
+	if attachment.DurationMs == nil {
+		attachment.DurationMs = existing.DurationMs
+	}
+	return true
+}
+
+// releaseBlob drops an attachment's reference to its blob. When that was the last one
+// the blob's variants go with it and its uploader gets the storage back.
+func (s *MessageService) releaseBlob(attachment *mediaModels.Attachment) {
+	blob, err := s.blobs.Release(attachment.SHA256)
+	if err != nil {
+		log.Printf("Failed to release blob %s: %v", attachment.Key, err)
+	}
+	if blob == nil {
+		return
+	}
+	if s.previews != nil && len(attachment.Variants) > 0 {
+		s.previews.Remove(attachment.Variants)
+	}
+	if blob.OwnerID > 0 {
+		s.releaseStorage(blob.OwnerID, blob.Size)
+	}
+}
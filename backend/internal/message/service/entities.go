@@ -0,0 +1,47 @@
+package service
+
+import (
+	"log"
+
+	"github.com/Mousa96/chatting-service/internal/message/markup"
+	"github.com/Mousa96/chatting-service/internal/message/models"
+)
+
+// MentionResolver looks up the users mentioned in messages
+type MentionResolver interface {
+	// ResolveUsernames maps each of usernames that belongs to a user to that user's ID
+	ResolveUsernames(usernames []string) (map[string]int, error)
+}
+
+// WithMentionResolver resolves @mentions to users. Without one mentions are plain text.
+func WithMentionResolver(resolver MentionResolver) Option {
+	return func(s *MessageService) {
+		s.mentions = resolver
+	}
+}
+
+// formattedContent is message content with its markup parsed
+type formattedContent struct {
+	text      string
+	entities  []models.Entity
+	mentioned map[int]bool
+}
+
+// formatContent parses the markup in content, once filters have seen it as it was
+// written. Mentions that cannot be resolved are left as text rather than refusing the
+// message.
+func (s *MessageService) formatContent(content string) formattedContent {
+	doc := markup.Parse(content)
+	formatted := formattedContent{text: doc.Text, mentioned: make(map[int]bool)}
+	if usernames := doc.Usernames(); len(usernames) > 0 && s.mentions != nil {
+		ids, err := s.mentions.ResolveUsernames(usernames)
+		if err != nil {
+			log.Printf("Failed to resolve mentions: %v", err)
+		}
+		for _, id := range doc.ResolveMentions(ids) {
+			formatted.mentioned[id] = true
+		}
+	}
+	formatted.entities = doc.Entities()
+	return formatted
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+)
+
+const (
+	// MinConversationTimer and MaxConversationTimer bound conversation timers
+	MinConversationTimer = 30 * time.Second
+	MaxConversationTimer = 365 * 24 * time.Hour
+	// reapBatch is how many expired messages a reaper deletes at once
+	reapBatch = 200
+)
+
+// ErrInvalidTimer is returned for conversation timers that are out of range, have an
+// unknown mode or name no other user
+var ErrInvalidTimer = errors.New("invalid conversation timer")
+
+// GetConversationTimer returns the timer of userID's conversation with otherUserID, or
+// nil when it has none
+func (s *MessageService) GetConversationTimer(userID, otherUserID int) (*models.ConversationTimer, error) {
+	return s.messageRepo.GetConversationTimer(userID, otherUserID)
+}
+
+// SetConversationTimer sets the timer of userID's conversation with req.UserID, or
+// clears it when req.Seconds is zero. Either participant may change it, and it applies
+// to messages sent from then on. Setting a timer is refused when userID may not message
+// the other user.
+func (s *MessageService) SetConversationTimer(userID int, req *models.SetConversationTimerRequest) (*models.ConversationTimer, error) {
+	if req.UserID <= 0 || req.UserID == userID {
+		return nil, fmt.Errorf("%w: user_id must name another user", ErrInvalidTimer)
+	}
+	timer := &models.ConversationTimer{UserID: req.UserID, Seconds: req.Seconds, Mode: req.Mode}
+	if req.Seconds != 0 {
+		if !req.Mode.IsValid() {
+			return nil, fmt.Errorf("%w: mode must be %s or %s", ErrInvalidTimer, models.TimerAfterSend, models.TimerAfterRead)
+		}
+		ttl := time.Duration(req.Seconds) * time.Second
+		if ttl < MinConversationTimer || ttl > MaxConversationTimer {
+			return nil, fmt.Errorf("%w: seconds must be between %d and %d", ErrInvalidTimer,
+				int(MinConversationTimer.Seconds()), int(MaxConversationTimer.Seconds()))
+		}
+		if s.accounts != nil {
+			exists, err := s.accounts.UserExists(req.UserID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check user: %w", err)
+			}
+			if !exists {
+				return nil, fmt.Errorf("%w: user_id must name another user", ErrInvalidTimer)
+			}
+		}
+		if err := s.checkDelivery(userID, req.UserID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.messageRepo.SetConversationTimer(userID, timer); err != nil {
+		return nil, err
+	}
+	if req.Seconds == 0 {
+		return nil, nil
+	}
+	return timer, nil
+}
+
+// applyTimer sets when msg expires under its conversation's timer, if it has one
+func applyTimer(msg *models.Message, timer *models.ConversationTimer) {
+	if timer == nil {
+		return
+	}
+	msg.ExpiresAt, msg.ExpireAfter = timer.Expiry(msg.CreatedAt)
+}
+
+// AttachmentRemover deletes attachments along with their stored files
+type AttachmentRemover interface {
+	// RemoveAttachments deletes the given attachments and their files, skipping those a
+	// message or scheduled message still carries
+	RemoveAttachments(ids []int) error
+}
+
+// Reaper permanently deletes messages once they expire under their conversation's timer
+// or the retention policy, removes the files attached to them and tells both
+// participants. Several reapers may run against the same database.
+type Reaper struct {
+	repo        repository.Repository
+	attachments AttachmentRemover
+	notifier    Notifier
+	policy      models.RetentionPolicy
+}
+
+// NewReaper creates a Reaper deleting messages that expire under their timers or policy
+func NewReaper(repo repository.Repository, attachments AttachmentRemover, notifier Notifier, policy models.RetentionPolicy) *Reaper {
+	return &Reaper{repo: repo, attachments: attachments, notifier: notifier, policy: policy}
+}
+
+// Run deletes expired messages every interval until ctx is cancelled
+func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				deleted, err := r.Process()
+				if err != nil {
+					log.Printf("Failed to delete expired messages: %v", err)
+				}
+				if err != nil || deleted < reapBatch || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Process deletes a batch of expired messages, returning how many it deleted
+func (r *Reaper) Process() (int, error) {
+	expired, err := r.repo.DeleteExpiredMessages(r.policy, reapBatch)
+	if err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	var attachmentIDs []int
+	for _, msg := range expired {
+		attachmentIDs = append(attachmentIDs, msg.AttachmentIDs...)
+	}
+	if len(attachmentIDs) > 0 && r.attachments != nil {
+		// Attachments left behind are unattached now, so the media collector removes them
+		if err := r.attachments.RemoveAttachments(attachmentIDs); err != nil {
+			log.Printf("Failed to remove attachments of expired messages: %v", err)
+		}
+	}
+
+	if r.notifier != nil {
+		for _, msg := range expired {
+			event := wsModels.MessageExpiredEvent{MessageID: msg.ID}
+			r.notifier.NotifyUser(msg.SenderID, wsModels.EventMessageExpired, event)
+			if msg.ReceiverID != msg.SenderID {
+				r.notifier.NotifyUser(msg.ReceiverID, wsModels.EventMessageExpired, event)
+			}
+		}
+	}
+	log.Printf("Deleted %d expired messages", len(expired))
+	return len(expired), nil
+}
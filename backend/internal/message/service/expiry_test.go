@@ -0,0 +1,217 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	mediaRepository "github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expiryNotifier records the message_expired events pushed to users
+type expiryNotifier struct {
+	expired map[int][]int
+}
+
+func (n *expiryNotifier) NotifyUser(userID int, eventType string, payload interface{}) bool {
+	if n.expired == nil {
+		n.expired = make(map[int][]int)
+	}
+	if eventType == wsModels.EventMessageExpired {
+		n.expired[userID] = append(n.expired[userID], payload.(wsModels.MessageExpiredEvent).MessageID)
+	}
+	return true
+}
+
+// recordingRemover records the attachments it is asked to remove
+type recordingRemover struct {
+	removed []int
+}
+
+func (r *recordingRemover) RemoveAttachments(ids []int) error {
+	r.removed = append(r.removed, ids...)
+	return nil
+}
+
+func TestSetConversationTimer(t *testing.T) {
+	messageService := NewMessageService(repository.NewTestMessageRepository(), new(mockStorage))
+
+	tests := []struct {
+		name string
+		req  models.SetConversationTimerRequest
+	}{
+		{"no other user", models.SetConversationTimerRequest{Seconds: 3600, Mode: models.TimerAfterSend}},
+		{"self", models.SetConversationTimerRequest{UserID: 1, Seconds: 3600, Mode: models.TimerAfterSend}},
+		{"unknown mode", models.SetConversationTimerRequest{UserID: 2, Seconds: 3600, Mode: "after_lunch"}},
+		{"too short", models.SetConversationTimerRequest{UserID: 2, Seconds: 1, Mode: models.TimerAfterSend}},
+		{"too long", models.SetConversationTimerRequest{UserID: 2, Seconds: int(MaxConversationTimer.Seconds()) + 1, Mode: models.TimerAfterRead}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := messageService.SetConversationTimer(1, &tt.req)
+			assert.ErrorIs(t, err, ErrInvalidTimer)
+		})
+	}
+
+	timer, err := messageService.SetConversationTimer(1, &models.SetConversationTimerRequest{UserID: 2, Seconds: 86400, Mode: models.TimerAfterRead})
+	require.NoError(t, err)
+	assert.Equal(t, 86400, timer.Seconds)
+
+	// Both participants see the same timer
+	timer, err = messageService.GetConversationTimer(2, 1)
+	require.NoError(t, err)
+	require.NotNil(t, timer)
+	assert.Equal(t, 1, timer.UserID)
+	assert.Equal(t, models.TimerAfterRead, timer.Mode)
+	assert.Equal(t, 1, timer.UpdatedBy)
+
+	timer, err = messageService.SetConversationTimer(2, &models.SetConversationTimerRequest{UserID: 1})
+	require.NoError(t, err)
+	assert.Nil(t, timer)
+	timer, err = messageService.GetConversationTimer(1, 2)
+	require.NoError(t, err)
+	assert.Nil(t, timer)
+}
+
+// knownUsers is an Accounts that knows the listed users and whether they are active
+type knownUsers map[int]bool
+
+func (k knownUsers) UserExists(userID int) (bool, error) {
+	_, ok := k[userID]
+	return ok, nil
+}
+
+func (k knownUsers) IsActive(userID int) (bool, error) {
+	return k[userID], nil
+}
+
+func TestSetConversationTimerChecksOtherUser(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage),
+		WithAccounts(knownUsers{1: true, 2: true, 3: true}), WithDeliveryPolicy(refuseReceivers{3}))
+
+	_, err := messageService.SetConversationTimer(1, &models.SetConversationTimerRequest{UserID: 99, Seconds: 3600, Mode: models.TimerAfterSend})
+	assert.ErrorIs(t, err, ErrInvalidTimer)
+
+	_, err = messageService.SetConversationTimer(1, &models.SetConversationTimerRequest{UserID: 3, Seconds: 3600, Mode: models.TimerAfterSend})
+	assert.ErrorIs(t, err, ErrNotPermitted)
+
+	for _, otherUserID := range []int{99, 3} {
+		timer, err := repo.GetConversationTimer(1, otherUserID)
+		require.NoError(t, err)
+		assert.Nil(t, timer, "no timer is stored for user %d", otherUserID)
+	}
+
+	_, err = messageService.SetConversationTimer(1, &models.SetConversationTimerRequest{UserID: 2, Seconds: 3600, Mode: models.TimerAfterSend})
+	assert.NoError(t, err)
+}
+
+func TestConversationTimers(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	now := time.Now()
+	repo.SetClock(func() time.Time { return now })
+	messageService := NewMessageService(repo, new(mockStorage))
+
+	before, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "before"})
+	require.NoError(t, err)
+	assert.Nil(t, before.ExpiresAt)
+
+	_, err = messageService.SetConversationTimer(2, &models.SetConversationTimerRequest{UserID: 1, Seconds: 3600, Mode: models.TimerAfterSend})
+	require.NoError(t, err)
+	sent, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "after send"})
+	require.NoError(t, err)
+	require.NotNil(t, sent.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *sent.ExpiresAt, time.Second)
+
+	_, err = messageService.SetConversationTimer(1, &models.SetConversationTimerRequest{UserID: 2, Seconds: 60, Mode: models.TimerAfterRead})
+	require.NoError(t, err)
+	read, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "after read"})
+	require.NoError(t, err)
+	assert.Nil(t, read.ExpiresAt, "unread messages are kept")
+	assert.Equal(t, 60, read.ExpireAfter)
+
+	// Timers of other conversations are not applied
+	broadcast, err := messageService.BroadcastMessage(1, &models.BroadcastMessageRequest{ReceiverIDs: []int{2, 3}, Content: "all"})
+	require.NoError(t, err)
+	require.Len(t, broadcast, 2)
+	assert.Equal(t, 60, broadcast[0].ExpireAfter)
+	assert.Zero(t, broadcast[1].ExpireAfter)
+
+	now = now.Add(10 * time.Minute)
+	require.NoError(t, messageService.UpdateMessageStatus(read.ID, models.StatusRead, 2))
+	stored, err := repo.GetMessageByID(read.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.ExpiresAt)
+	assert.Equal(t, now.Add(time.Minute), *stored.ExpiresAt)
+
+	// Expired messages are hidden until the reaper deletes them
+	now = now.Add(2 * time.Hour)
+	conversation, err := messageService.GetConversation(1, 2)
+	require.NoError(t, err)
+	var contents []string
+	for _, msg := range conversation {
+		contents = append(contents, msg.Content)
+	}
+	assert.ElementsMatch(t, []string{"before", "all"}, contents)
+}
+
+func TestReaper(t *testing.T) {
+	store := mediaRepository.NewTestMediaRepository()
+	photo := &mediaModels.Attachment{OwnerID: 1, Key: "1_a.jpg", ContentType: "image/jpeg"}
+	require.NoError(t, store.CreateAttachment(photo))
+
+	repo := repository.NewTestMessageRepository()
+	now := time.Now()
+	repo.SetClock(func() time.Time { return now })
+	messageService := NewMessageService(repo, new(mockStorage), WithAttachmentStore(store))
+
+	_, err := messageService.SetConversationTimer(1, &models.SetConversationTimerRequest{UserID: 2, Seconds: 3600, Mode: models.TimerAfterSend})
+	require.NoError(t, err)
+	timed, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, AttachmentIDs: []int{photo.ID}})
+	require.NoError(t, err)
+	internal, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 3, Content: "internal"})
+	require.NoError(t, err)
+	repo.SetExternal(4)
+	external, err := messageService.SendMessage(4, &models.CreateMessageRequest{ReceiverID: 1, Content: "from a contractor"})
+	require.NoError(t, err)
+
+	notifier := &expiryNotifier{}
+	remover := &recordingRemover{}
+	reaper := NewReaper(repo, remover, notifier, models.RetentionPolicy{ExternalMaxAge: 30 * 24 * time.Hour})
+
+	deleted, err := reaper.Process()
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	now = now.Add(2 * time.Hour)
+	deleted, err = reaper.Process()
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, []int{photo.ID}, remover.removed)
+	assert.Equal(t, []int{timed.ID}, notifier.expired[1])
+	assert.Equal(t, []int{timed.ID}, notifier.expired[2])
+	_, err = repo.GetMessageByID(timed.ID)
+	assert.Error(t, err)
+
+	// Conversations with external users are deleted after the external retention period,
+	// others are kept
+	now = now.Add(31 * 24 * time.Hour)
+	deleted, err = reaper.Process()
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, []int{external.ID}, notifier.expired[4])
+	_, err = repo.GetMessageByID(internal.ID)
+	assert.NoError(t, err)
+
+	// The global retention period applies to every conversation
+	reaper = NewReaper(repo, remover, notifier, models.RetentionPolicy{MaxAge: 7 * 24 * time.Hour})
+	deleted, err = reaper.Process()
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, []int{internal.ID}, notifier.expired[3])
+}
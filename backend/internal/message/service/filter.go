@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+)
+
+// ErrContentRejected is returned when a message filter refuses a message.
+// The returned error is a *RejectionError naming the filter and the reason.
+var ErrContentRejected = errors.New("message rejected by content filter")
+
+// RejectionError describes why a message filter refused a message
+type RejectionError struct {
+	// Filter is the name of the filter that rejected the message
+	Filter string
+	// Reason is a human readable explanation for the sender
+	Reason string
+}
+
+func (e *RejectionError) Error() string {
+	return e.Reason
+}
+
+// Unwrap lets callers match rejections with errors.Is(err, ErrContentRejected)
+func (e *RejectionError) Unwrap() error {
+	return ErrContentRejected
+}
+
+// FilterAction is the verdict of a message filter
+type FilterAction string
+
+const (
+	// FilterAllow lets the message through unchanged
+	FilterAllow FilterAction = "allow"
+	// FilterReject refuses the message
+	FilterReject FilterAction = "reject"
+	// FilterRedact replaces the message content and continues
+	FilterRedact FilterAction = "redact"
+	// FilterFlag lets the message through and reports it for review once stored
+	FilterFlag FilterAction = "flag"
+)
+
+// OutgoingMessage is a message as seen by filters, before it is stored
+type OutgoingMessage struct {
+	SenderID    int
+	ReceiverIDs []int
+	Content     string
+	MediaURL    string
+}
+
+// FilterResult is the outcome of running one filter on a message
+type FilterResult struct {
+	Action FilterAction
+	// Reason explains a rejection or flag
+	Reason string
+	// Content replaces the message content when Action is FilterRedact
+	Content string
+}
+
+// MessageFilter inspects outgoing messages before they are stored
+type MessageFilter interface {
+	// Name identifies the filter in rejections and review flags
+	Name() string
+	// Check returns the filter's verdict on a message
+	Check(msg *OutgoingMessage) (FilterResult, error)
+}
+
+// FlagRecorder queues stored messages that a filter flagged for review
+type FlagRecorder interface {
+	FlagMessage(msg *models.Message, filter, reason string) error
+}
+
+// WithFilter appends filters to the chain run before every direct and broadcast message.
+// Filters run in the order they are added; redactions are visible to later filters.
+func WithFilter(filters ...MessageFilter) Option {
+	return func(s *MessageService) {
+		s.filters = append(s.filters, filters...)
+	}
+}
+
+// WithFlagRecorder sets where messages flagged by a filter are reported
+func WithFlagRecorder(recorder FlagRecorder) Option {
+	return func(s *MessageService) {
+		s.flagRecorder = recorder
+	}
+}
+
+// filterFlag is a review flag raised by a filter
+type filterFlag struct {
+	filter string
+	reason string
+}
+
+// runFilters passes msg through the filter chain, applying redactions in place.
+// It stops at the first rejection and returns the flags raised along the way.
+func (s *MessageService) runFilters(msg *OutgoingMessage) ([]filterFlag, error) {
+	var flags []filterFlag
+	for _, filter := range s.filters {
+		result, err := filter.Check(msg)
+		if err != nil {
+			return nil, fmt.Errorf("content filter %s failed: %w", filter.Name(), err)
+		}
+
+		switch result.Action {
+		case FilterReject:
+			return nil, &RejectionError{Filter: filter.Name(), Reason: result.Reason}
+		case FilterRedact:
+			msg.Content = result.Content
+		case FilterFlag:
+			flags = append(flags, filterFlag{filter: filter.Name(), reason: result.Reason})
+		}
+	}
+	return flags, nil
+}
+
+// recordFlags reports a stored message for every flag raised by the filters.
+// Failures are logged rather than returned since the message has already been sent.
+func (s *MessageService) recordFlags(msg *models.Message, flags []filterFlag) {
+	if s.flagRecorder == nil {
+		return
+	}
+	for _, flag := range flags {
+		if err := s.flagRecorder.FlagMessage(msg, flag.filter, flag.reason); err != nil {
+			log.Printf("Failed to flag message %d for review: %v", msg.ID, err)
+		}
+	}
+}
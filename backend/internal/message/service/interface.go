@@ -2,8 +2,11 @@
 package service
 
 import (
+	"errors"
+	"io"
 	"mime/multipart"
 
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
 	"github.com/Mousa96/chatting-service/internal/message/models"
 )
 
@@ -15,8 +18,19 @@ type Service interface {
 	GetConversation(userID1, userID2 int) ([]models.Message, error)
 	// GetConversationPaginated retrieves conversation with pagination
 	GetConversationPaginated(userID1, userID2, page, pageSize int) ([]models.Message, *models.Pagination, error)
-	// UploadMedia handles media upload
-	UploadMedia(userID int, file *multipart.FileHeader) (string, error)
+	// UploadMedia stores an uploaded file and returns its attachment, which messages reference by ID
+	UploadMedia(userID int, file *multipart.FileHeader) (*mediaModels.Attachment, error)
+	// ImportMedia stores a file received by other means, such as a resumable upload, as an attachment
+	ImportMedia(userID int, filename string, content io.ReadSeeker, size int64) (*mediaModels.Attachment, error)
+	// AdoptMedia records a file that is already in storage under key, such as a verified
+	// direct upload, as an attachment without copying it
+	AdoptMedia(userID int, key, filename, contentType string, size int64) (*mediaModels.Attachment, error)
+	// CheckQuota returns an error wrapping ErrQuotaExceeded when userID cannot store a
+	// file of size bytes, so uploads that cannot be kept are refused before they start
+	CheckQuota(userID int, size int64) error
+	// CheckMedia returns an error wrapping ErrInvalidMedia when files of contentType and
+	// size bytes may not be uploaded, so direct uploads are refused before they start
+	CheckMedia(contentType string, size int64) error
 	// BroadcastMessage broadcasts a message to all users
 	BroadcastMessage(senderID int, req *models.BroadcastMessageRequest) ([]*models.Message, error)
 	// GetMessageHistory retrieves the message history for a user
@@ -27,4 +41,56 @@ type Service interface {
 	UpdateMessageStatus(messageID int, status models.MessageStatus, userID int) error
 	// GetMessageByID retrieves a message by its ID
 	GetMessageByID(messageID int) (*models.Message, error)
+	// ScheduleMessage stores a message to be sent to its receiver at req.SendAt
+	ScheduleMessage(senderID int, req *models.CreateMessageRequest) (*models.ScheduledMessage, error)
+	// ListScheduledMessages retrieves the messages a user has scheduled with pagination
+	ListScheduledMessages(senderID, page, pageSize int) ([]models.ScheduledMessage, *models.Pagination, error)
+	// UpdateScheduledMessage edits a scheduled message that has not been sent
+	UpdateScheduledMessage(senderID int, req *models.UpdateScheduledMessageRequest) (*models.ScheduledMessage, error)
+	// CancelScheduledMessage deletes a scheduled message that has not been sent
+	CancelScheduledMessage(senderID, scheduledID int) error
+	// GetConversationTimer retrieves the disappearing message timer of a conversation, or nil
+	GetConversationTimer(userID, otherUserID int) (*models.ConversationTimer, error)
+	// SetConversationTimer sets or clears the disappearing message timer of a conversation
+	SetConversationTimer(userID int, req *models.SetConversationTimerRequest) (*models.ConversationTimer, error)
+	// PinMessage pins a message in its conversation for both participants
+	PinMessage(userID, messageID int) (*models.Pin, error)
+	// UnpinMessage unpins a message in its conversation
+	UnpinMessage(userID, messageID int) error
+	// ListPinnedMessages retrieves the messages pinned in a conversation with pagination
+	ListPinnedMessages(userID, otherUserID, page, pageSize int) ([]models.PinnedMessage, *models.Pagination, error)
+	// StarMessage bookmarks a message for the user
+	StarMessage(userID, messageID int) error
+	// UnstarMessage removes the user's bookmark of a message
+	UnstarMessage(userID, messageID int) error
+	// ListStarredMessages retrieves the messages a user starred with pagination
+	ListStarredMessages(userID, page, pageSize int) ([]models.StarredMessage, *models.Pagination, error)
+	// SetNotifier sets the notifier used to push pin changes to connected clients
+	SetNotifier(notifier Notifier)
+}
+
+// ErrNotPermitted is returned when a delivery policy refuses a message.
+// Policies wrap it with the reason the recipient cannot be messaged.
+var ErrNotPermitted = errors.New("not permitted to message this user")
+
+// ErrInvalidMedia is returned when a message references attachments that do not exist,
+// were uploaded by someone else, or uploaded files by URL
+var ErrInvalidMedia = errors.New("invalid media")
+
+// ErrQuotaExceeded is returned when storing a file would take its owner or the service
+// past a storage quota. Quotas wrap it with the limit that was reached.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// DeliveryPolicy decides whether one user may send a message to another
+type DeliveryPolicy interface {
+	// CanMessage returns an error wrapping ErrNotPermitted when senderID may not message receiverID
+	CanMessage(senderID, receiverID int) error
+}
+
+// Accounts looks up the users messages are exchanged with
+type Accounts interface {
+	// UserExists reports whether userID names a user, suspended or not
+	UserExists(userID int) (bool, error)
+	// IsActive reports whether userID names a user that is neither suspended nor deleted
+	IsActive(userID int) (bool, error)
 }
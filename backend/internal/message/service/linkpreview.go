@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+)
+
+const (
+	// linkPreviewBatch is how many queued previews a worker claims at once
+	linkPreviewBatch = 20
+	// linkPreviewLease is how long a claimed preview is left to its worker before
+	// another may take it over; it outlasts any fetch
+	linkPreviewLease = time.Minute
+	// linkPreviewFetches is how many pages a worker fetches at the same time
+	linkPreviewFetches = 4
+	// defaultLinkPreviewTTL is how long fetched previews are reused
+	defaultLinkPreviewTTL = 24 * time.Hour
+)
+
+// firstLink returns the first link in msg, or "" when there is none. Links in code are
+// not entities, so they are not previewed.
+func firstLink(msg *models.Message) string {
+	for _, entity := range msg.Entities {
+		if entity.Type == models.EntityURL {
+			return models.EntityText(msg.Content, entity)
+		}
+	}
+	return ""
+}
+
+// WithLinkPreviews queues a preview for the first link in each message, to be fetched
+// by a LinkPreviewWorker
+func WithLinkPreviews() Option {
+	return func(s *MessageService) {
+		s.linkPreviews = true
+	}
+}
+
+// queueLinkPreview records that msg needs a preview of its first link. A message whose
+// preview cannot be queued is still sent, just without one.
+func (s *MessageService) queueLinkPreview(msg *models.Message) {
+	if !s.linkPreviews {
+		return
+	}
+	link := firstLink(msg)
+	if link == "" {
+		return
+	}
+	if err := s.messageRepo.QueueLinkPreview(msg.ID, link); err != nil {
+		log.Printf("Failed to queue link preview for message %d: %v", msg.ID, err)
+	}
+}
+
+// LinkFetcher reads the preview of a linked page
+type LinkFetcher interface {
+	// Fetch returns the preview of the page at url, or nil when it has none
+	Fetch(ctx context.Context, url string) (*models.LinkPreview, error)
+}
+
+// Notifier pushes events to a user's open connections
+type Notifier interface {
+	NotifyUser(userID int, eventType string, payload interface{}) bool
+}
+
+// LinkPreviewWorker fetches the previews queued for messages, stores them with the
+// message and tells both participants. Several workers, on one server or many, may run
+// against the same database; each queued preview is claimed by one of them.
+type LinkPreviewWorker struct {
+	repo     repository.Repository
+	fetcher  LinkFetcher
+	notifier Notifier
+	cacheTTL time.Duration
+	now      func() time.Time
+}
+
+// LinkPreviewOption configures a LinkPreviewWorker
+type LinkPreviewOption func(*LinkPreviewWorker)
+
+// WithLinkPreviewCacheTTL sets how long a fetched preview is reused for other messages
+// linking to the same page
+func WithLinkPreviewCacheTTL(ttl time.Duration) LinkPreviewOption {
+	return func(w *LinkPreviewWorker) {
+		w.cacheTTL = ttl
+	}
+}
+
+// NewLinkPreviewWorker creates a LinkPreviewWorker
+func NewLinkPreviewWorker(repo repository.Repository, fetcher LinkFetcher, notifier Notifier, opts ...LinkPreviewOption) *LinkPreviewWorker {
+	w := &LinkPreviewWorker{
+		repo:     repo,
+		fetcher:  fetcher,
+		notifier: notifier,
+		cacheTTL: defaultLinkPreviewTTL,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Run processes queued previews every interval until ctx is cancelled
+func (w *LinkPreviewWorker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep going while there is a backlog rather than waiting a tick per batch
+			for {
+				processed, err := w.Process(ctx)
+				if err != nil {
+					log.Printf("Failed to process link previews: %v", err)
+				}
+				if err != nil || processed < linkPreviewBatch || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Process claims a batch of queued previews and completes them, returning how many it
+// claimed. Pages linked from several messages in the batch are fetched once.
+func (w *LinkPreviewWorker) Process(ctx context.Context) (int, error) {
+	jobs, err := w.repo.ClaimLinkPreviewJobs(linkPreviewBatch, linkPreviewLease)
+	if err != nil {
+		return 0, err
+	}
+
+	byURL := make(map[string][]models.LinkPreviewJob)
+	for _, job := range jobs {
+		byURL[job.URL] = append(byURL[job.URL], job)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, linkPreviewFetches)
+	for url, jobs := range byURL {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(url string, jobs []models.LinkPreviewJob) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if preview, ok := w.preview(ctx, url); ok {
+				w.complete(jobs, preview)
+			}
+		}(url, jobs)
+	}
+	wg.Wait()
+	return len(jobs), nil
+}
+
+// preview returns the cached preview of url, fetching it when there is none. Pages that
+// fail to load are cached as having no preview so they are not fetched for every message.
+// It reports false when ctx was cancelled first, leaving the previews claimed until
+// their lease runs out and another worker takes them.
+func (w *LinkPreviewWorker) preview(ctx context.Context, url string) (*models.LinkPreview, bool) {
+	preview, found, err := w.repo.GetCachedLinkPreview(url, w.now().Add(-w.cacheTTL))
+	if err != nil {
+		log.Printf("Failed to read cached link preview of %s: %v", url, err)
+	}
+	if found {
+		return preview, true
+	}
+
+	preview, err = w.fetcher.Fetch(ctx, url)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		log.Printf("Failed to fetch link preview of %s: %v", url, err)
+		preview = nil
+	}
+	if err := w.repo.CacheLinkPreview(url, preview); err != nil {
+		log.Printf("Failed to cache link preview of %s: %v", url, err)
+	}
+	return preview, true
+}
+
+// complete stores preview with each message and pushes it to the participants
+func (w *LinkPreviewWorker) complete(jobs []models.LinkPreviewJob, preview *models.LinkPreview) {
+	for _, job := range jobs {
+		if err := w.repo.CompleteLinkPreview(job.MessageID, preview); err != nil {
+			log.Printf("Failed to store link preview of message %d: %v", job.MessageID, err)
+			continue
+		}
+		if preview == nil || w.notifier == nil {
+			continue
+		}
+		event := wsModels.MessageUpdatedEvent{MessageID: job.MessageID, LinkPreview: preview}
+		w.notifier.NotifyUser(job.SenderID, wsModels.EventMessageUpdated, event)
+		w.notifier.NotifyUser(job.ReceiverID, wsModels.EventMessageUpdated, event)
+	}
+}
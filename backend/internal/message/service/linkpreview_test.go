@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Mousa96/chatting-service/internal/message/linkpreview"
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier records the events pushed to each user
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events map[int][]wsModels.MessageUpdatedEvent
+}
+
+func (n *recordingNotifier) NotifyUser(userID int, eventType string, payload interface{}) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.events == nil {
+		n.events = make(map[int][]wsModels.MessageUpdatedEvent)
+	}
+	if eventType == wsModels.EventMessageUpdated {
+		n.events[userID] = append(n.events[userID], payload.(wsModels.MessageUpdatedEvent))
+	}
+	return true
+}
+
+func TestFirstLink(t *testing.T) {
+	tests := map[string]string{
+		"no links here":                           "",
+		"see https://example.com/a?b=c.":          "https://example.com/a?b=c",
+		"(http://example.com) and https://x.org":  "http://example.com",
+		"HTTPS://Example.com/Path, then more":     "HTTPS://Example.com/Path",
+		"example.com without a scheme":            "",
+		"ftp://example.com is not fetched either": "",
+		"`https://example.com` is code":           "",
+		"**https://example.com/bold**":            "https://example.com/bold",
+	}
+	messageService := &MessageService{}
+	for content, want := range tests {
+		formatted := messageService.formatContent(content)
+		msg := &models.Message{Content: formatted.text, Entities: formatted.entities}
+		assert.Equal(t, want, firstLink(msg), content)
+	}
+}
+
+func TestLinkPreviews(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<meta property="og:title" content="Page %s">`, r.URL.Path)
+	}))
+	defer server.Close()
+
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage), WithLinkPreviews())
+	notifier := &recordingNotifier{}
+	worker := NewLinkPreviewWorker(repo, linkpreview.NewFetcher(linkpreview.WithPrivateNetworks()), notifier)
+
+	direct, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "look " + server.URL + "/post!"})
+	require.NoError(t, err)
+	broadcast, err := messageService.BroadcastMessage(1, &models.BroadcastMessageRequest{
+		ReceiverIDs: []int{2, 3}, Content: server.URL + "/post",
+	})
+	require.NoError(t, err)
+	_, err = messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "no link"})
+	require.NoError(t, err)
+	require.Equal(t, 3, repo.PendingLinkPreviews())
+
+	processed, err := worker.Process(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, processed)
+	assert.Equal(t, 0, repo.PendingLinkPreviews())
+	// The page is fetched once for all three messages
+	assert.Equal(t, int32(1), hits.Load())
+
+	for _, msg := range append([]*models.Message{direct}, broadcast...) {
+		stored, err := repo.GetMessageByID(msg.ID)
+		require.NoError(t, err)
+		require.NotNil(t, stored.LinkPreview)
+		assert.Equal(t, server.URL+"/post", stored.LinkPreview.URL)
+		assert.Equal(t, "Page /post", stored.LinkPreview.Title)
+	}
+	assert.Len(t, notifier.events[1], 3)
+	assert.Len(t, notifier.events[2], 2)
+	require.Len(t, notifier.events[3], 1)
+	assert.Equal(t, broadcast[1].ID, notifier.events[3][0].MessageID)
+	assert.Equal(t, "Page /post", notifier.events[3][0].LinkPreview.Title)
+
+	t.Run("cached", func(t *testing.T) {
+		msg, err := messageService.SendMessage(2, &models.CreateMessageRequest{ReceiverID: 1, Content: server.URL + "/post"})
+		require.NoError(t, err)
+		_, err = worker.Process(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), hits.Load())
+		stored, err := repo.GetMessageByID(msg.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, stored.LinkPreview)
+	})
+
+	t.Run("failed fetches complete without a preview", func(t *testing.T) {
+		before := hits.Load()
+		msg, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 3, Content: server.URL + "/missing"})
+		require.NoError(t, err)
+		_, err = worker.Process(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, repo.PendingLinkPreviews())
+		stored, err := repo.GetMessageByID(msg.ID)
+		require.NoError(t, err)
+		assert.Nil(t, stored.LinkPreview)
+		assert.Len(t, notifier.events[3], 1)
+
+		// The failure is cached too
+		_, err = messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 3, Content: server.URL + "/missing"})
+		require.NoError(t, err)
+		_, err = worker.Process(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, before+1, hits.Load())
+	})
+
+	t.Run("claimed previews are left to their worker", func(t *testing.T) {
+		_, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: server.URL + "/other"})
+		require.NoError(t, err)
+		jobs, err := repo.ClaimLinkPreviewJobs(linkPreviewBatch, linkPreviewLease)
+		require.NoError(t, err)
+		require.Len(t, jobs, 1)
+
+		processed, err := worker.Process(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, processed)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		plainRepo := repository.NewTestMessageRepository()
+		plain := NewMessageService(plainRepo, new(mockStorage))
+		_, err := plain.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: server.URL})
+		require.NoError(t, err)
+		assert.Zero(t, plainRepo.PendingLinkPreviews())
+	})
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+)
+
+// MaxPinnedMessages is how many messages a conversation may have pinned at once
+const MaxPinnedMessages = 5
+
+var (
+	// ErrMessageNotFound is returned for messages that do not exist, have expired or are
+	// in a conversation the user is not part of
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrPinLimit is returned when pinning a message in a conversation that already has
+	// MaxPinnedMessages pinned
+	ErrPinLimit = errors.New("pinned message limit reached")
+)
+
+// SetNotifier sets the notifier used to push pin changes to connected clients. The
+// WebSocket service needs the message service, so it is set once both exist.
+func (s *MessageService) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
+// participantMessage returns a message userID sent or received, or ErrMessageNotFound
+func (s *MessageService) participantMessage(userID, messageID int) (*models.Message, error) {
+	msg, err := s.messageRepo.GetMessageByID(messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+	if msg.SenderID != userID && msg.ReceiverID != userID {
+		return nil, ErrMessageNotFound
+	}
+	if msg.ExpiresAt != nil && !msg.ExpiresAt.After(time.Now()) {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
+// notifyPin tells both participants of msg that userID pinned or unpinned it
+func (s *MessageService) notifyPin(msg *models.Message, eventType string, event wsModels.MessagePinEvent) {
+	if s.notifier == nil {
+		return
+	}
+	s.notifier.NotifyUser(msg.SenderID, eventType, event)
+	if msg.ReceiverID != msg.SenderID {
+		s.notifier.NotifyUser(msg.ReceiverID, eventType, event)
+	}
+}
+
+// PinMessage pins a message userID sent or received in its conversation, for both
+// participants to see. Pinning a pinned message returns the existing pin.
+func (s *MessageService) PinMessage(userID, messageID int) (*models.Pin, error) {
+	msg, err := s.participantMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	pin := &models.Pin{MessageID: messageID, PinnedBy: userID}
+	pinned, err := s.messageRepo.PinMessage(pin, MaxPinnedMessages)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, ErrMessageNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return nil, fmt.Errorf("%w: at most %d messages can be pinned in a conversation", ErrPinLimit, MaxPinnedMessages)
+	case err != nil:
+		return nil, fmt.Errorf("failed to pin message: %w", err)
+	}
+
+	if pinned {
+		s.notifyPin(msg, wsModels.EventMessagePinned, wsModels.MessagePinEvent{
+			MessageID:  msg.ID,
+			SenderID:   msg.SenderID,
+			ReceiverID: msg.ReceiverID,
+			UserID:     userID,
+			PinnedAt:   pin.PinnedAt.Format(time.RFC3339),
+		})
+	}
+	return pin, nil
+}
+
+// UnpinMessage unpins a message in a conversation userID is part of; either participant
+// may unpin any pinned message
+func (s *MessageService) UnpinMessage(userID, messageID int) error {
+	msg, err := s.participantMessage(userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	unpinned, err := s.messageRepo.UnpinMessage(messageID)
+	if err != nil {
+		return fmt.Errorf("failed to unpin message: %w", err)
+	}
+	if unpinned {
+		s.notifyPin(msg, wsModels.EventMessageUnpinned, wsModels.MessagePinEvent{
+			MessageID:  msg.ID,
+			SenderID:   msg.SenderID,
+			ReceiverID: msg.ReceiverID,
+			UserID:     userID,
+		})
+	}
+	return nil
+}
+
+// ListPinnedMessages returns the messages pinned in userID's conversation with
+// otherUserID, most recently pinned first
+func (s *MessageService) ListPinnedMessages(userID, otherUserID, page, pageSize int) ([]models.PinnedMessage, *models.Pagination, error) {
+	return s.messageRepo.GetPinnedMessages(userID, otherUserID, page, pageSize)
+}
+
+// StarMessage bookmarks a message userID sent or received; stars are private
+func (s *MessageService) StarMessage(userID, messageID int) error {
+	if _, err := s.participantMessage(userID, messageID); err != nil {
+		return err
+	}
+	if err := s.messageRepo.StarMessage(userID, messageID); err != nil {
+		return fmt.Errorf("failed to star message: %w", err)
+	}
+	return nil
+}
+
+// UnstarMessage removes userID's bookmark of a message
+func (s *MessageService) UnstarMessage(userID, messageID int) error {
+	if err := s.messageRepo.UnstarMessage(userID, messageID); err != nil {
+		return fmt.Errorf("failed to unstar message: %w", err)
+	}
+	return nil
+}
+
+// ListStarredMessages returns the messages userID starred across all conversations,
+// most recently starred first
+func (s *MessageService) ListStarredMessages(userID, page, pageSize int) ([]models.StarredMessage, *models.Pagination, error) {
+	return s.messageRepo.GetStarredMessages(userID, page, pageSize)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pinNotifier records the pin events pushed to users
+type pinNotifier struct {
+	events map[int][]string
+}
+
+func (n *pinNotifier) NotifyUser(userID int, eventType string, payload interface{}) bool {
+	if n.events == nil {
+		n.events = make(map[int][]string)
+	}
+	if _, ok := payload.(wsModels.MessagePinEvent); ok {
+		n.events[userID] = append(n.events[userID], eventType)
+	}
+	return true
+}
+
+func TestPinMessages(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	now := time.Now()
+	repo.SetClock(func() time.Time { return now })
+	messageService := NewMessageService(repo, new(mockStorage))
+	notifier := &pinNotifier{}
+	messageService.SetNotifier(notifier)
+
+	var ids []int
+	for i := 0; i <= MaxPinnedMessages; i++ {
+		msg, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "hello"})
+		require.NoError(t, err)
+		ids = append(ids, msg.ID)
+	}
+	other, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 3, Content: "elsewhere"})
+	require.NoError(t, err)
+
+	_, err = messageService.PinMessage(3, ids[0])
+	assert.ErrorIs(t, err, ErrMessageNotFound, "only participants can pin")
+	_, err = messageService.PinMessage(2, 999)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+
+	for i, id := range ids[:MaxPinnedMessages] {
+		now = now.Add(time.Second)
+		pin, err := messageService.PinMessage(1+i%2, id)
+		require.NoError(t, err)
+		assert.Equal(t, now, pin.PinnedAt)
+	}
+	_, err = messageService.PinMessage(2, ids[MaxPinnedMessages])
+	assert.ErrorIs(t, err, ErrPinLimit)
+
+	// The limit is per conversation, and pinning twice keeps the first pin
+	_, err = messageService.PinMessage(3, other.ID)
+	require.NoError(t, err)
+	pin, err := messageService.PinMessage(2, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, 1, pin.PinnedBy)
+
+	assert.Len(t, notifier.events[1], MaxPinnedMessages+1)
+	assert.Len(t, notifier.events[2], MaxPinnedMessages)
+	assert.Equal(t, []string{wsModels.EventMessagePinned}, notifier.events[3])
+
+	pinned, pagination, err := messageService.ListPinnedMessages(2, 1, 1, 2)
+	require.NoError(t, err)
+	require.Len(t, pinned, 2)
+	assert.Equal(t, ids[MaxPinnedMessages-1], pinned[0].ID, "most recently pinned first")
+	assert.Equal(t, MaxPinnedMessages, pagination.TotalItems)
+	assert.Equal(t, "hello", pinned[0].Content)
+
+	// Either participant can unpin, making room for another pin
+	require.NoError(t, messageService.UnpinMessage(2, ids[0]))
+	assert.ErrorIs(t, messageService.UnpinMessage(3, ids[1]), ErrMessageNotFound)
+	assert.Equal(t, wsModels.EventMessageUnpinned, notifier.events[1][len(notifier.events[1])-1])
+	_, err = messageService.PinMessage(2, ids[MaxPinnedMessages])
+	require.NoError(t, err)
+}
+
+func TestStarMessages(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	now := time.Now()
+	repo.SetClock(func() time.Time { return now })
+	messageService := NewMessageService(repo, new(mockStorage))
+	notifier := &pinNotifier{}
+	messageService.SetNotifier(notifier)
+
+	first, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "first"})
+	require.NoError(t, err)
+	second, err := messageService.SendMessage(3, &models.CreateMessageRequest{ReceiverID: 1, Content: "second"})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, messageService.StarMessage(3, first.ID), ErrMessageNotFound)
+	require.NoError(t, messageService.StarMessage(1, first.ID))
+	now = now.Add(time.Second)
+	require.NoError(t, messageService.StarMessage(1, second.ID))
+	require.NoError(t, messageService.StarMessage(1, second.ID))
+
+	// Stars are private and span conversations
+	starred, pagination, err := messageService.ListStarredMessages(1, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, starred, 2)
+	assert.Equal(t, second.ID, starred[0].ID)
+	assert.Equal(t, now, starred[0].StarredAt)
+	assert.Equal(t, 2, pagination.TotalItems)
+	starred, _, err = messageService.ListStarredMessages(2, 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, starred)
+	assert.Empty(t, notifier.events)
+
+	require.NoError(t, messageService.UnstarMessage(1, first.ID))
+	starred, _, err = messageService.ListStarredMessages(1, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, starred, 1)
+	assert.Equal(t, "second", starred[0].Content)
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrMediaTooLarge is returned when a file is bigger than the media policy allows for its type
+var ErrMediaTooLarge = fmt.Errorf("%w: file is too large for its type", ErrInvalidMedia)
+
+// defaultMediaTypes are the types uploads accept when no policy is configured
+var defaultMediaTypes = []string{"image/jpeg", "image/png", "image/gif", "video/mp4"}
+
+// MediaPolicy decides which sniffed content types may be uploaded and how large files
+// of each type may be
+type MediaPolicy struct {
+	limits map[string]int64
+}
+
+// NewMediaPolicy creates a policy allowing the types in limits, mapped to the largest
+// size in bytes files of that type may have, or 0 to leave them to the upload limit.
+// Keys are exact types such as "application/pdf" or wildcards such as "audio/*", which
+// cover every subtype an exact key does not.
+func NewMediaPolicy(limits map[string]int64) *MediaPolicy {
+	policy := &MediaPolicy{limits: make(map[string]int64, len(limits))}
+	for contentType, limit := range limits {
+		policy.limits[strings.ToLower(contentType)] = limit
+	}
+	return policy
+}
+
+// DefaultMediaPolicy allows the image and video types chats have always accepted
+func DefaultMediaPolicy() *MediaPolicy {
+	limits := make(map[string]int64, len(defaultMediaTypes))
+	for _, contentType := range defaultMediaTypes {
+		limits[contentType] = 0
+	}
+	return NewMediaPolicy(limits)
+}
+
+// WithMediaPolicy replaces the default set of uploadable types
+func WithMediaPolicy(policy *MediaPolicy) Option {
+	return func(s *MessageService) {
+		s.mediaPolicy = policy
+	}
+}
+
+// limit returns the size limit for contentType and whether the type is allowed at all
+func (p *MediaPolicy) limit(contentType string) (int64, bool) {
+	contentType = strings.ToLower(contentType)
+	if limit, ok := p.limits[contentType]; ok {
+		return limit, true
+	}
+	if slash := strings.IndexByte(contentType, '/'); slash > 0 {
+		if limit, ok := p.limits[contentType[:slash]+"/*"]; ok {
+			return limit, true
+		}
+	}
+	return 0, false
+}
+
+// Allows reports whether files of contentType may be uploaded
+func (p *MediaPolicy) Allows(contentType string) bool {
+	_, ok := p.limit(contentType)
+	return ok
+}
+
+// Check returns an error wrapping ErrInvalidMedia when a file of contentType and size
+// bytes may not be uploaded, or ErrMediaTooLarge when only its size is the problem
+func (p *MediaPolicy) Check(contentType string, size int64) error {
+	limit, ok := p.limit(contentType)
+	if !ok {
+		return fmt.Errorf("%w: file type %s is not allowed", ErrInvalidMedia, contentType)
+	}
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: %s files may be at most %d bytes", ErrMediaTooLarge, contentType, limit)
+	}
+	return nil
+}
+
+func (s *MessageService) CheckMedia(contentType string, size int64) error {
+	return s.mediaPolicy.Check(contentType, size)
+}
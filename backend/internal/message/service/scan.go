@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/scan"
+)
+
+var (
+	// ErrMalwareDetected is returned when an uploaded file matches a malware signature
+	ErrMalwareDetected = fmt.Errorf("%w: file contains malware", ErrInvalidMedia)
+	// ErrQuarantined is returned when an uploaded file looks suspicious and was set aside
+	// for an administrator to review instead of being attached
+	ErrQuarantined = fmt.Errorf("%w: file was quarantined for review", ErrInvalidMedia)
+	// ErrScanFailed is returned when an upload could not be scanned. Files are refused
+	// rather than stored unscanned.
+	ErrScanFailed = errors.New("malware scan failed")
+)
+
+// Scanner checks files for malware
+type Scanner interface {
+	Scan(content io.Reader) (*scan.Result, error)
+}
+
+// QuarantineStore records suspicious files held for review
+type QuarantineStore interface {
+	CreateQuarantinedFile(file *mediaModels.QuarantinedFile) error
+}
+
+// fileOpener is implemented by storage backends that can read back stored files
+type fileOpener interface {
+	Open(filename string) (io.ReadCloser, error)
+}
+
+// WithScanner scans every upload before it is stored. Infected files are refused and
+// suspicious ones are copied under the quarantine prefix and recorded for review.
+func WithScanner(scanner Scanner, quarantine QuarantineStore) Option {
+	return func(s *MessageService) {
+		s.scanner = scanner
+		s.quarantine = quarantine
+	}
+}
+
+// scanUpload checks an upload of userID's before it is stored. open is called once to
+// scan the file and again to quarantine it, so it must return the content from the start.
+func (s *MessageService) scanUpload(userID int, filename, contentType string, size int64, open func() (io.ReadCloser, error)) error {
+	if s.scanner == nil {
+		return nil
+	}
+
+	content, err := open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	result, err := s.scanner.Scan(content)
+	content.Close()
+	if err != nil {
+		log.Printf("Failed to scan upload from user %d: %v", userID, err)
+		return fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	switch result.Verdict {
+	case scan.Clean:
+		return nil
+	case scan.Suspicious:
+		if err := s.quarantineUpload(userID, filename, contentType, size, result.Signature, open); err != nil {
+			return err
+		}
+		log.Printf("Quarantined upload from user %d matching %s", userID, result.Signature)
+		return ErrQuarantined
+	default:
+		log.Printf("Refused upload from user %d matching %s", userID, result.Signature)
+		return ErrMalwareDetected
+	}
+}
+
+// quarantineUpload stores a copy of a suspicious file where media requests cannot reach it
+func (s *MessageService) quarantineUpload(userID int, filename, contentType string, size int64, signature string, open func() (io.ReadCloser, error)) error {
+	key, err := mediaModels.NewKey(userID, filepath.Ext(filename))
+	if err != nil {
+		return err
+	}
+	key = mediaModels.QuarantinePrefix + key
+
+	content, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to quarantine file: %w", err)
+	}
+	defer content.Close()
+	if _, err := s.storage.Upload(key, content, contentType); err != nil {
+		return fmt.Errorf("failed to quarantine file: %w", err)
+	}
+
+	file := &mediaModels.QuarantinedFile{
+		OwnerID:     userID,
+		Key:         key,
+		Filename:    originalFilename(filename),
+		ContentType: contentType,
+		Size:        size,
+		Signature:   signature,
+	}
+	if err := s.quarantine.CreateQuarantinedFile(file); err != nil {
+		if deleteErr := s.storage.Delete(key); deleteErr != nil {
+			log.Printf("Failed to remove quarantined file %s after error: %v", key, deleteErr)
+		}
+		return fmt.Errorf("failed to quarantine file: %w", err)
+	}
+	return nil
+}
+
+// scanStored scans a file that is already in storage under key
+func (s *MessageService) scanStored(userID int, key, filename, contentType string, size int64) error {
+	if s.scanner == nil {
+		return nil
+	}
+	opener, ok := s.storage.(fileOpener)
+	if !ok {
+		return fmt.Errorf("%w: storage backend cannot read files back", ErrScanFailed)
+	}
+	return s.scanUpload(userID, filename, contentType, size, func() (io.ReadCloser, error) {
+		return opener.Open(key)
+	})
+}
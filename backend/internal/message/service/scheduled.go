@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+)
+
+const (
+	// MaxScheduleAhead is how far in the future a message can be scheduled
+	MaxScheduleAhead = 365 * 24 * time.Hour
+	// scheduledBatch is how many due messages a scheduler claims at once
+	scheduledBatch = 20
+	// scheduledLease is how long a claimed message is left to its scheduler before another
+	// may take it over; it outlasts any send
+	scheduledLease = time.Minute
+)
+
+var (
+	// ErrInvalidSchedule is returned when a message cannot be scheduled as requested, such
+	// as for a time that has passed
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	// ErrScheduledNotFound is returned for scheduled messages that do not exist, have been
+	// sent, or were scheduled by someone else
+	ErrScheduledNotFound = errors.New("scheduled message not found")
+	// ErrScheduledSending is returned when changing a scheduled message that is being sent
+	ErrScheduledSending = errors.New("scheduled message is being sent")
+)
+
+// ScheduleMessage stores a message to be sent at req.SendAt. The message is checked as it
+// would be if sent now, except for content filters, which run when it is sent.
+func (s *MessageService) ScheduleMessage(senderID int, req *models.CreateMessageRequest) (*models.ScheduledMessage, error) {
+	if req.SendAt == nil {
+		return nil, fmt.Errorf("%w: send_at is required", ErrInvalidSchedule)
+	}
+	msg := &models.ScheduledMessage{
+		SenderID:      senderID,
+		ReceiverID:    req.ReceiverID,
+		Kind:          req.Kind,
+		Content:       req.Content,
+		MediaURL:      req.MediaURL,
+		AttachmentIDs: req.AttachmentIDs,
+		SendAt:        req.SendAt.UTC(),
+	}
+	if err := s.checkScheduled(msg); err != nil {
+		return nil, err
+	}
+	if err := s.checkDelivery(senderID, req.ReceiverID); err != nil {
+		return nil, err
+	}
+	if err := s.messageRepo.CreateScheduledMessage(msg); err != nil {
+		return nil, fmt.Errorf("failed to schedule message: %w", err)
+	}
+	return msg, nil
+}
+
+// checkScheduled validates the content and send time of a scheduled message
+func (s *MessageService) checkScheduled(msg *models.ScheduledMessage) error {
+	if msg.Content == "" && msg.MediaURL == "" && len(msg.AttachmentIDs) == 0 {
+		return fmt.Errorf("%w: message must have either content or media", ErrInvalidSchedule)
+	}
+	now := time.Now()
+	if !msg.SendAt.After(now) {
+		return fmt.Errorf("%w: send_at must be in the future", ErrInvalidSchedule)
+	}
+	if msg.SendAt.After(now.Add(MaxScheduleAhead)) {
+		return fmt.Errorf("%w: messages can be scheduled at most %d days ahead", ErrInvalidSchedule, MaxScheduleAhead/(24*time.Hour))
+	}
+	if err := checkMediaURL(msg.MediaURL); err != nil {
+		return err
+	}
+	attachments, err := s.resolveAttachments(msg.SenderID, msg.AttachmentIDs)
+	if err != nil {
+		return err
+	}
+	kind, err := checkKind(msg.Kind, msg.Content, msg.MediaURL, attachments)
+	if err != nil {
+		return err
+	}
+	msg.Kind = kind
+	return nil
+}
+
+// scheduledError translates repository errors about a scheduled message
+func scheduledError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrScheduledNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return ErrScheduledSending
+	}
+	return err
+}
+
+// ListScheduledMessages returns the messages senderID has scheduled, soonest first
+func (s *MessageService) ListScheduledMessages(senderID, page, pageSize int) ([]models.ScheduledMessage, *models.Pagination, error) {
+	return s.messageRepo.GetScheduledMessages(senderID, page, pageSize)
+}
+
+// UpdateScheduledMessage replaces the content and send time of one of senderID's
+// scheduled messages, scheduling it again if it failed
+func (s *MessageService) UpdateScheduledMessage(senderID int, req *models.UpdateScheduledMessageRequest) (*models.ScheduledMessage, error) {
+	msg := &models.ScheduledMessage{
+		ID:            req.ID,
+		SenderID:      senderID,
+		Kind:          req.Kind,
+		Content:       req.Content,
+		MediaURL:      req.MediaURL,
+		AttachmentIDs: req.AttachmentIDs,
+		SendAt:        req.SendAt.UTC(),
+	}
+	if err := s.checkScheduled(msg); err != nil {
+		return nil, err
+	}
+	if err := s.messageRepo.UpdateScheduledMessage(msg); err != nil {
+		return nil, scheduledError(err)
+	}
+	return msg, nil
+}
+
+// CancelScheduledMessage removes one of senderID's scheduled messages before it is sent
+func (s *MessageService) CancelScheduledMessage(senderID, scheduledID int) error {
+	return scheduledError(s.messageRepo.DeleteScheduledMessage(scheduledID, senderID))
+}
+
+// Deliverer pushes messages and events to users' open connections
+type Deliverer interface {
+	Notifier
+	// DeliverMessage pushes a stored message to its sender and receiver
+	DeliverMessage(message *models.Message)
+}
+
+// Scheduler sends scheduled messages once they are due, through SendMessage so they are
+// filtered and stored like any other, and delivers them to connected users. Several
+// schedulers, on one server or many, may run against the same database; each due message
+// is claimed by one of them, and a message is never stored twice even when a claim runs
+// out while it is being sent.
+type Scheduler struct {
+	repo      repository.Repository
+	messages  Service
+	deliverer Deliverer
+	accounts  Accounts
+}
+
+// SchedulerOption configures a Scheduler
+type SchedulerOption func(*Scheduler)
+
+// WithSenderAccounts fails the messages of senders who have been suspended or deleted
+// since scheduling them
+func WithSenderAccounts(accounts Accounts) SchedulerOption {
+	return func(s *Scheduler) {
+		s.accounts = accounts
+	}
+}
+
+// NewScheduler creates a Scheduler sending through messages
+func NewScheduler(repo repository.Repository, messages Service, deliverer Deliverer, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{repo: repo, messages: messages, deliverer: deliverer}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run sends due messages every interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				processed, err := s.Process()
+				if err != nil {
+					log.Printf("Failed to send scheduled messages: %v", err)
+				}
+				if err != nil || processed < scheduledBatch || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Process claims a batch of due messages and sends them, returning how many it claimed
+func (s *Scheduler) Process() (int, error) {
+	due, err := s.repo.ClaimScheduledMessages(scheduledBatch, scheduledLease)
+	if err != nil {
+		return 0, err
+	}
+	for i := range due {
+		s.send(&due[i])
+	}
+	return len(due), nil
+}
+
+// send sends a claimed message. Messages the sender is no longer allowed to send are
+// marked failed and the sender is told; other errors leave the message claimed, to be
+// tried again once its lease runs out.
+func (s *Scheduler) send(scheduled *models.ScheduledMessage) {
+	var msg *models.Message
+	err := s.checkSender(scheduled.SenderID)
+	if err == nil {
+		msg, err = s.messages.SendMessage(scheduled.SenderID, scheduled.Request())
+	}
+	switch {
+	case err == nil:
+		if s.deliverer != nil {
+			s.deliverer.DeliverMessage(msg)
+		}
+	case errors.Is(err, repository.ErrConflict):
+		log.Printf("Skipping scheduled message %d: %v", scheduled.ID, err)
+	case errors.Is(err, ErrNotPermitted), errors.Is(err, ErrContentRejected), errors.Is(err, ErrInvalidMedia):
+		if err := s.repo.FailScheduledMessage(scheduled.ID, err.Error()); err != nil {
+			log.Printf("Failed to record failure of scheduled message %d: %v", scheduled.ID, err)
+			return
+		}
+		if s.deliverer != nil {
+			s.deliverer.NotifyUser(scheduled.SenderID, wsModels.EventScheduledMessageFailed,
+				wsModels.ScheduledMessageFailedEvent{ID: scheduled.ID, Error: err.Error()})
+		}
+	default:
+		log.Printf("Failed to send scheduled message %d, will retry: %v", scheduled.ID, err)
+	}
+}
+
+// checkSender returns an error wrapping ErrNotPermitted when senderID has been suspended
+// or deleted
+func (s *Scheduler) checkSender(senderID int) error {
+	if s.accounts == nil {
+		return nil
+	}
+	active, err := s.accounts.IsActive(senderID)
+	if err != nil {
+		return fmt.Errorf("failed to check sender: %w", err)
+	}
+	if !active {
+		return fmt.Errorf("%w: the sender's account is suspended or deleted", ErrNotPermitted)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/message/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDeliverer records the messages and scheduling failures pushed to users
+type recordingDeliverer struct {
+	delivered []*models.Message
+	failed    map[int][]wsModels.ScheduledMessageFailedEvent
+}
+
+func (d *recordingDeliverer) DeliverMessage(message *models.Message) {
+	d.delivered = append(d.delivered, message)
+}
+
+func (d *recordingDeliverer) NotifyUser(userID int, eventType string, payload interface{}) bool {
+	if d.failed == nil {
+		d.failed = make(map[int][]wsModels.ScheduledMessageFailedEvent)
+	}
+	if eventType == wsModels.EventScheduledMessageFailed {
+		d.failed[userID] = append(d.failed[userID], payload.(wsModels.ScheduledMessageFailedEvent))
+	}
+	return true
+}
+
+func TestScheduleMessage(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage), WithDeliveryPolicy(refuseReceivers{3}))
+	at := func(d time.Duration) *time.Time {
+		sendAt := time.Now().Add(d)
+		return &sendAt
+	}
+
+	tests := []struct {
+		name string
+		req  *models.CreateMessageRequest
+		err  error
+	}{
+		{"in the past", &models.CreateMessageRequest{ReceiverID: 2, Content: "hi", SendAt: at(-time.Minute)}, ErrInvalidSchedule},
+		{"too far ahead", &models.CreateMessageRequest{ReceiverID: 2, Content: "hi", SendAt: at(MaxScheduleAhead + time.Hour)}, ErrInvalidSchedule},
+		{"empty", &models.CreateMessageRequest{ReceiverID: 2, SendAt: at(time.Hour)}, ErrInvalidSchedule},
+		{"refused receiver", &models.CreateMessageRequest{ReceiverID: 3, Content: "hi", SendAt: at(time.Hour)}, ErrNotPermitted},
+		{"uploaded file by URL", &models.CreateMessageRequest{ReceiverID: 2, MediaURL: "/api/media/abc", SendAt: at(time.Hour)}, ErrInvalidMedia},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := messageService.ScheduleMessage(1, tt.req)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	later, err := messageService.ScheduleMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "later", SendAt: at(2 * time.Hour)})
+	require.NoError(t, err)
+	sooner, err := messageService.ScheduleMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "sooner", SendAt: at(time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, models.ScheduledPending, sooner.Status)
+	assert.Equal(t, models.KindText, sooner.Kind)
+
+	scheduled, pagination, err := messageService.ListScheduledMessages(1, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, scheduled, 2)
+	assert.Equal(t, "sooner", scheduled[0].Content)
+	assert.Equal(t, 2, pagination.TotalItems)
+
+	// Nothing is sent before it is due
+	conversation, err := messageService.GetConversation(1, 2)
+	require.NoError(t, err)
+	assert.Empty(t, conversation)
+
+	edited, err := messageService.UpdateScheduledMessage(1, &models.UpdateScheduledMessageRequest{
+		ID: later.ID, Content: "edited", SendAt: *at(3 * time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, edited.ReceiverID)
+
+	_, err = messageService.UpdateScheduledMessage(2, &models.UpdateScheduledMessageRequest{
+		ID: later.ID, Content: "not mine", SendAt: *at(time.Hour),
+	})
+	assert.ErrorIs(t, err, ErrScheduledNotFound)
+	assert.ErrorIs(t, messageService.CancelScheduledMessage(2, sooner.ID), ErrScheduledNotFound)
+
+	require.NoError(t, messageService.CancelScheduledMessage(1, sooner.ID))
+	assert.ErrorIs(t, messageService.CancelScheduledMessage(1, sooner.ID), ErrScheduledNotFound)
+
+	scheduled, _, err = messageService.ListScheduledMessages(1, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, scheduled, 1)
+	assert.Equal(t, "edited", scheduled[0].Content)
+}
+
+func TestScheduler(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage))
+	deliverer := &recordingDeliverer{}
+	scheduler := NewScheduler(repo, messageService, deliverer)
+
+	sendAt := time.Now().Add(time.Hour)
+	scheduled, err := messageService.ScheduleMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "**hello**", SendAt: &sendAt})
+	require.NoError(t, err)
+
+	processed, err := scheduler.Process()
+	require.NoError(t, err)
+	assert.Zero(t, processed)
+
+	now := sendAt.Add(time.Second)
+	repo.SetClock(func() time.Time { return now })
+
+	// A scheduler that stops after claiming the message leaves it to another once its
+	// lease runs out; if it comes back the message is not sent twice
+	stale, err := repo.ClaimScheduledMessages(scheduledBatch, scheduledLease)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+
+	processed, err = scheduler.Process()
+	require.NoError(t, err)
+	assert.Zero(t, processed, "claimed messages are left to their scheduler")
+
+	now = now.Add(scheduledLease + time.Second)
+	processed, err = scheduler.Process()
+	require.NoError(t, err)
+	assert.Equal(t, 1, processed)
+
+	scheduler.send(&stale[0])
+
+	require.Len(t, deliverer.delivered, 1)
+	sent := deliverer.delivered[0]
+	assert.Equal(t, scheduled.ID, sent.ScheduledID)
+	assert.Equal(t, "hello", sent.Content, "scheduled messages are formatted when sent")
+	assert.Equal(t, []models.Entity{{Type: models.EntityBold, Offset: 0, Length: 5}}, sent.Entities)
+	assert.Empty(t, deliverer.failed)
+
+	conversation, err := messageService.GetConversation(1, 2)
+	require.NoError(t, err)
+	assert.Len(t, conversation, 1)
+
+	remaining, _, err := messageService.ListScheduledMessages(1, 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+	assert.ErrorIs(t, messageService.CancelScheduledMessage(1, scheduled.ID), ErrScheduledNotFound)
+}
+
+func TestSchedulerFailure(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage))
+
+	sendAt := time.Now().Add(time.Hour)
+	scheduled, err := messageService.ScheduleMessage(1, &models.CreateMessageRequest{ReceiverID: 3, Content: "hello", SendAt: &sendAt})
+	require.NoError(t, err)
+	repo.SetClock(func() time.Time { return sendAt.Add(time.Second) })
+
+	// The receiver stops accepting messages from the sender before it is due
+	deliverer := &recordingDeliverer{}
+	refusing := NewMessageService(repo, new(mockStorage), WithDeliveryPolicy(refuseReceivers{3}))
+	scheduler := NewScheduler(repo, refusing, deliverer)
+
+	processed, err := scheduler.Process()
+	require.NoError(t, err)
+	assert.Equal(t, 1, processed)
+	assert.Empty(t, deliverer.delivered)
+	require.Len(t, deliverer.failed[1], 1)
+	assert.Equal(t, scheduled.ID, deliverer.failed[1][0].ID)
+	assert.Contains(t, deliverer.failed[1][0].Error, "refused by test policy")
+
+	// Failed messages are kept for the sender to see, and not tried again
+	processed, err = scheduler.Process()
+	require.NoError(t, err)
+	assert.Zero(t, processed)
+
+	list, _, err := messageService.ListScheduledMessages(1, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, models.ScheduledFailed, list[0].Status)
+	assert.NotEmpty(t, list[0].Error)
+
+	// Editing a failed message schedules it again
+	newSendAt := time.Now().Add(2 * time.Hour)
+	_, err = messageService.UpdateScheduledMessage(1, &models.UpdateScheduledMessageRequest{
+		ID: scheduled.ID, Content: "hello again", SendAt: newSendAt,
+	})
+	require.NoError(t, err)
+	list, _, err = messageService.ListScheduledMessages(1, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, models.ScheduledPending, list[0].Status)
+	assert.Empty(t, list[0].Error)
+}
+
+func TestSchedulerSuspendedSender(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage))
+
+	sendAt := time.Now().Add(time.Hour)
+	scheduled, err := messageService.ScheduleMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "hello", SendAt: &sendAt})
+	require.NoError(t, err)
+	repo.SetClock(func() time.Time { return sendAt.Add(time.Second) })
+
+	// The sender is suspended before it is due
+	deliverer := &recordingDeliverer{}
+	scheduler := NewScheduler(repo, messageService, deliverer, WithSenderAccounts(knownUsers{1: false, 2: true}))
+
+	processed, err := scheduler.Process()
+	require.NoError(t, err)
+	assert.Equal(t, 1, processed)
+	assert.Empty(t, deliverer.delivered)
+	require.Len(t, deliverer.failed[1], 1)
+	assert.Equal(t, scheduled.ID, deliverer.failed[1][0].ID)
+
+	history, err := repo.GetMessageHistory(2)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	list, _, err := messageService.ListScheduledMessages(1, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, models.ScheduledFailed, list[0].Status)
+	assert.Contains(t, list[0].Error, "suspended or deleted")
+}
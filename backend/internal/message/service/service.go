@@ -3,8 +3,6 @@ package service
 
 import (
 	"fmt"
-	"mime/multipart"
-	"path/filepath"
 	"time"
 
 	"github.com/Mousa96/chatting-service/internal/message/models"
@@ -14,37 +12,124 @@ import (
 
 // MessageService provides the implementation of the Service interface
 type MessageService struct {
-	messageRepo repository.Repository
-	storage     storage.Storage
+	messageRepo  repository.Repository
+	storage      storage.Storage
+	policies     []DeliveryPolicy
+	accounts     Accounts
+	filters      []MessageFilter
+	flagRecorder FlagRecorder
+	attachments  AttachmentStore
+	previews     PreviewGenerator
+	sanitizer    ImageSanitizer
+	quota        StorageQuota
+	blobs        BlobStore
+	scanner      Scanner
+	quarantine   QuarantineStore
+	mediaPolicy  *MediaPolicy
+	linkPreviews bool
+	mentions     MentionResolver
+	notifier     Notifier
+}
+
+// Option configures optional MessageService dependencies
+type Option func(*MessageService)
+
+// WithDeliveryPolicy adds a policy consulted before every direct and broadcast message
+func WithDeliveryPolicy(policy DeliveryPolicy) Option {
+	return func(s *MessageService) {
+		s.policies = append(s.policies, policy)
+	}
+}
+
+// WithAccounts checks that the users named in conversation settings exist
+func WithAccounts(accounts Accounts) Option {
+	return func(s *MessageService) {
+		s.accounts = accounts
+	}
 }
 
 // NewMessageService creates a new MessageService instance
-func NewMessageService(messageRepo repository.Repository, storage storage.Storage) Service {
-	return &MessageService{
+func NewMessageService(messageRepo repository.Repository, storage storage.Storage, opts ...Option) Service {
+	s := &MessageService{
 		messageRepo: messageRepo,
 		storage:     storage,
+		mediaPolicy: DefaultMediaPolicy(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// checkDelivery runs the delivery policies for a single recipient
+func (s *MessageService) checkDelivery(senderID, receiverID int) error {
+	for _, policy := range s.policies {
+		if err := policy.CanMessage(senderID, receiverID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *MessageService) SendMessage(senderID int, req *models.CreateMessageRequest) (*models.Message, error) {
 	// Modified validation to properly handle media-only messages
-	if req.Content == "" && req.MediaURL == "" {
+	if req.Content == "" && req.MediaURL == "" && len(req.AttachmentIDs) == 0 {
 		return nil, fmt.Errorf("message must have either content or media")
 	}
 
+	if err := checkMediaURL(req.MediaURL); err != nil {
+		return nil, err
+	}
+	attachments, err := s.resolveAttachments(senderID, req.AttachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+	kind, err := checkKind(req.Kind, req.Content, req.MediaURL, attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkDelivery(senderID, req.ReceiverID); err != nil {
+		return nil, err
+	}
+
+	outgoing := &OutgoingMessage{
+		SenderID:    senderID,
+		ReceiverIDs: []int{req.ReceiverID},
+		Content:     req.Content,
+		MediaURL:    req.MediaURL,
+	}
+	flags, err := s.runFilters(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	content := s.formatContent(outgoing.Content)
+
 	msg := &models.Message{
 		SenderID:   senderID,
 		ReceiverID: req.ReceiverID,
-		Content:    req.Content,
+		Kind:       kind,
+		Content:    content.text,
 		MediaURL:   req.MediaURL,
+		Attachments: attachments,
+		Entities:   content.entities,
+		Mentioned:  content.mentioned[req.ReceiverID],
+		ScheduledID: req.ScheduledID,
 		CreatedAt:  time.Now(),
 		Status:     models.StatusSent,
 	}
+	timer, err := s.messageRepo.GetConversationTimer(senderID, req.ReceiverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation timer: %w", err)
+	}
+	applyTimer(msg, timer)
 
 	if err := s.messageRepo.Create(msg); err != nil {
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
 
+	s.recordFlags(msg, flags)
+	s.queueLinkPreview(msg)
 	return msg, nil
 }
 
@@ -52,36 +137,52 @@ func (s *MessageService) GetConversation(userID1, userID2 int) ([]models.Message
 	return s.messageRepo.GetConversation(userID1, userID2)
 }
 
-func (s *MessageService) UploadMedia(userID int, file *multipart.FileHeader) (string, error) {
-	src, err := file.Open()
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
-	}
-	defer src.Close()
-
-	// Generate unique filename - remove the leading /uploads/
-	ext := filepath.Ext(file.Filename)
-	filename := fmt.Sprintf("%d_%d%s", userID, time.Now().UnixNano(), ext)
-
-	// Upload using storage interface
-	url, err := s.storage.Upload(filename, src, file.Header.Get("Content-Type"))
-	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
-	}
-
-	return url, nil
-}
-
 func (s *MessageService) BroadcastMessage(senderID int, req *models.BroadcastMessageRequest) ([]*models.Message, error) {
 	if len(req.ReceiverIDs) == 0 {
 		return nil, fmt.Errorf("receiver IDs cannot be empty")
 	}
 	
 	// Modified validation to properly handle media-only messages
-	if req.Content == "" && req.MediaURL == "" {
+	if req.Content == "" && req.MediaURL == "" && len(req.AttachmentIDs) == 0 {
 		return nil, fmt.Errorf("message must have either content or media")
 	}
 
+	if err := checkMediaURL(req.MediaURL); err != nil {
+		return nil, err
+	}
+	attachments, err := s.resolveAttachments(senderID, req.AttachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+	kind, err := checkKind(req.Kind, req.Content, req.MediaURL, attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check every recipient before storing anything so a refused broadcast sends nothing
+	timers := make(map[int]*models.ConversationTimer, len(req.ReceiverIDs))
+	for _, receiverID := range req.ReceiverIDs {
+		if err := s.checkDelivery(senderID, receiverID); err != nil {
+			return nil, fmt.Errorf("cannot send to user %d: %w", receiverID, err)
+		}
+		if timers[receiverID], err = s.messageRepo.GetConversationTimer(senderID, receiverID); err != nil {
+			return nil, fmt.Errorf("failed to get conversation timer: %w", err)
+		}
+	}
+
+	// The filters see the broadcast once, so a rejection refuses every copy
+	outgoing := &OutgoingMessage{
+		SenderID:    senderID,
+		ReceiverIDs: req.ReceiverIDs,
+		Content:     req.Content,
+		MediaURL:    req.MediaURL,
+	}
+	flags, err := s.runFilters(outgoing)
+	if err != nil {
+		return nil, err
+	}
+	content := s.formatContent(outgoing.Content)
+
 	var messages []*models.Message
 
 	// Create a message for each receiver
@@ -89,15 +190,22 @@ func (s *MessageService) BroadcastMessage(senderID int, req *models.BroadcastMes
 		msg := &models.Message{
 			SenderID:   senderID,
 			ReceiverID: receiverID,
-			Content:    req.Content,
+			Kind:       kind,
+			Content:    content.text,
 			MediaURL:   req.MediaURL,
+			Attachments: attachments,
+			Entities:   content.entities,
+			Mentioned:  content.mentioned[receiverID],
 			CreatedAt:  time.Now(),
 		}
+		applyTimer(msg, timers[receiverID])
 
 		if err := s.messageRepo.Create(msg); err != nil {
 			return nil, fmt.Errorf("failed to send message to user %d: %w", receiverID, err)
 		}
 
+		s.recordFlags(msg, flags)
+		s.queueLinkPreview(msg)
 		messages = append(messages, msg)
 	}
 
@@ -125,6 +233,14 @@ func (s *MessageService) UpdateMessageStatus(messageID int, status models.Messag
 		return fmt.Errorf("not authorized to update this message status")
 	}
 
+	changed, err := checkStatus(message, status)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
 	// Update the status
 	if err := s.messageRepo.UpdateMessageStatus(messageID, status); err != nil {
 		return fmt.Errorf("failed to update status: %w", err)
@@ -1,12 +1,26 @@
 package service
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"image"
+	"image/color"
+	imageGIF "image/gif"
+	imagePNG "image/png"
 	"io"
+	"mime/multipart"
+	"strings"
 	"testing"
+	"time"
 
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	mediaRepository "github.com/Mousa96/chatting-service/internal/media/repository"
+	"github.com/Mousa96/chatting-service/internal/media/scan"
 	"github.com/Mousa96/chatting-service/internal/message/models"
 	"github.com/Mousa96/chatting-service/internal/message/repository"
+	fileStorage "github.com/Mousa96/chatting-service/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -145,6 +159,66 @@ func (m *mockRepo) GetMessagesByUser(userID int) ([]models.Message, error) {
 	return result, nil
 }
 
+// Link previews are covered with the test repository in TestLinkPreviews
+func (m *mockRepo) QueueLinkPreview(messageID int, url string) error { return nil }
+
+func (m *mockRepo) ClaimLinkPreviewJobs(limit int, lease time.Duration) ([]models.LinkPreviewJob, error) {
+	return nil, nil
+}
+
+func (m *mockRepo) CompleteLinkPreview(messageID int, preview *models.LinkPreview) error { return nil }
+
+func (m *mockRepo) GetCachedLinkPreview(url string, since time.Time) (*models.LinkPreview, bool, error) {
+	return nil, false, nil
+}
+
+func (m *mockRepo) CacheLinkPreview(url string, preview *models.LinkPreview) error { return nil }
+
+// Scheduled messages are covered with the test repository in TestScheduledMessages
+func (m *mockRepo) CreateScheduledMessage(msg *models.ScheduledMessage) error { return nil }
+
+func (m *mockRepo) GetScheduledMessages(senderID, page, pageSize int) ([]models.ScheduledMessage, *models.Pagination, error) {
+	return nil, &models.Pagination{}, nil
+}
+
+func (m *mockRepo) UpdateScheduledMessage(msg *models.ScheduledMessage) error { return nil }
+
+func (m *mockRepo) DeleteScheduledMessage(id, senderID int) error { return nil }
+
+func (m *mockRepo) ClaimScheduledMessages(limit int, lease time.Duration) ([]models.ScheduledMessage, error) {
+	return nil, nil
+}
+
+func (m *mockRepo) FailScheduledMessage(id int, reason string) error { return nil }
+
+func (m *mockRepo) GetConversationTimer(user1ID, user2ID int) (*models.ConversationTimer, error) {
+	return nil, nil
+}
+
+func (m *mockRepo) SetConversationTimer(userID int, timer *models.ConversationTimer) error {
+	return nil
+}
+
+func (m *mockRepo) DeleteExpiredMessages(policy models.RetentionPolicy, limit int) ([]models.ExpiredMessage, error) {
+	return nil, nil
+}
+
+func (m *mockRepo) PinMessage(pin *models.Pin, limit int) (bool, error) { return false, nil }
+
+func (m *mockRepo) UnpinMessage(messageID int) (bool, error) { return false, nil }
+
+func (m *mockRepo) GetPinnedMessages(userID1, userID2, page, pageSize int) ([]models.PinnedMessage, *models.Pagination, error) {
+	return nil, nil, nil
+}
+
+func (m *mockRepo) StarMessage(userID, messageID int) error { return nil }
+
+func (m *mockRepo) UnstarMessage(userID, messageID int) error { return nil }
+
+func (m *mockRepo) GetStarredMessages(userID, page, pageSize int) ([]models.StarredMessage, *models.Pagination, error) {
+	return nil, nil, nil
+}
+
 func TestGetConversation(t *testing.T) {
 	repo := &mockRepo{}
 	mockStorage := new(mockStorage)
@@ -269,6 +343,747 @@ func TestBroadcastMessage(t *testing.T) {
 	}
 }
 
+// refuseReceivers is a DeliveryPolicy that refuses messages to the listed receivers
+type refuseReceivers []int
+
+func (p refuseReceivers) CanMessage(senderID, receiverID int) error {
+	for _, id := range p {
+		if id == receiverID {
+			return fmt.Errorf("%w: refused by test policy", ErrNotPermitted)
+		}
+	}
+	return nil
+}
+
+func TestDeliveryPolicy(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage), WithDeliveryPolicy(refuseReceivers{3}))
+
+	msg, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "Hello"})
+	require.NoError(t, err)
+	assert.NotNil(t, msg)
+
+	msg, err = messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 3, Content: "Hello"})
+	assert.ErrorIs(t, err, ErrNotPermitted)
+	assert.Nil(t, msg)
+
+	// A broadcast is refused as a whole if any recipient refuses it
+	messages, err := messageService.BroadcastMessage(1, &models.BroadcastMessageRequest{
+		ReceiverIDs: []int{2, 3},
+		Content:     "Hello everyone",
+	})
+	assert.ErrorIs(t, err, ErrNotPermitted)
+	assert.Nil(t, messages)
+
+	history, err := repo.GetMessageHistory(2)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+}
+
+func TestAttachments(t *testing.T) {
+	store := mediaRepository.NewTestMediaRepository()
+	own := &mediaModels.Attachment{OwnerID: 1, Key: "1_a.jpg", ContentType: "image/jpeg"}
+	second := &mediaModels.Attachment{OwnerID: 1, Key: "1_b.mp4", ContentType: "video/mp4"}
+	foreign := &mediaModels.Attachment{OwnerID: 2, Key: "2_c.jpg", ContentType: "image/jpeg"}
+	for _, attachment := range []*mediaModels.Attachment{own, second, foreign} {
+		require.NoError(t, store.CreateAttachment(attachment))
+	}
+	messageService := NewMessageService(repository.NewTestMessageRepository(), new(mockStorage), WithAttachmentStore(store))
+
+	tests := []struct {
+		name          string
+		attachmentIDs []int
+		mediaURL      string
+		wantErr       bool
+	}{
+		{name: "own uploads keep their order", attachmentIDs: []int{second.ID, own.ID}},
+		{name: "external media URL", mediaURL: "http://example.com/image.jpg"},
+		{name: "someone else's upload", attachmentIDs: []int{own.ID, foreign.ID}, wantErr: true},
+		{name: "unknown attachment", attachmentIDs: []int{99}, wantErr: true},
+		{name: "duplicate attachment", attachmentIDs: []int{own.ID, own.ID}, wantErr: true},
+		{name: "too many attachments", attachmentIDs: make([]int, MaxAttachments+1), wantErr: true},
+		{name: "uploaded file by URL", mediaURL: "/api/media/1_a.jpg", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := messageService.SendMessage(1, &models.CreateMessageRequest{
+				ReceiverID: 2, MediaURL: tt.mediaURL, AttachmentIDs: tt.attachmentIDs,
+			})
+			messages, broadcastErr := messageService.BroadcastMessage(1, &models.BroadcastMessageRequest{
+				ReceiverIDs: []int{2, 3}, MediaURL: tt.mediaURL, AttachmentIDs: tt.attachmentIDs,
+			})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidMedia)
+				assert.ErrorIs(t, broadcastErr, ErrInvalidMedia)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, broadcastErr)
+
+			require.Len(t, msg.Attachments, len(tt.attachmentIDs))
+			for i, id := range tt.attachmentIDs {
+				assert.Equal(t, id, msg.Attachments[i].ID)
+			}
+			for _, sent := range messages {
+				assert.Len(t, sent.Attachments, len(tt.attachmentIDs))
+			}
+		})
+	}
+
+	t.Run("without an attachment store", func(t *testing.T) {
+		plain := NewMessageService(repository.NewTestMessageRepository(), new(mockStorage))
+		_, err := plain.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, AttachmentIDs: []int{own.ID}})
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+	})
+}
+
+func TestVoiceMessages(t *testing.T) {
+	store := mediaRepository.NewTestMediaRepository()
+	ogg := &mediaModels.Attachment{OwnerID: 1, Key: "1_a.ogg", ContentType: "audio/ogg"}
+	webm := &mediaModels.Attachment{OwnerID: 1, Key: "1_b.webm", ContentType: "audio/webm"}
+	mp3 := &mediaModels.Attachment{OwnerID: 1, Key: "1_c.mp3", ContentType: "audio/mpeg"}
+	video := &mediaModels.Attachment{OwnerID: 1, Key: "1_d.webm", ContentType: "video/webm"}
+	for _, attachment := range []*mediaModels.Attachment{ogg, webm, mp3, video} {
+		require.NoError(t, store.CreateAttachment(attachment))
+	}
+	messageService := NewMessageService(repository.NewTestMessageRepository(), new(mockStorage), WithAttachmentStore(store))
+
+	tests := []struct {
+		name          string
+		kind          models.MessageKind
+		content       string
+		attachmentIDs []int
+		wantKind      models.MessageKind
+	}{
+		{name: "text by default", content: "hi", wantKind: models.KindText},
+		{name: "ogg recording", kind: models.KindVoice, attachmentIDs: []int{ogg.ID}, wantKind: models.KindVoice},
+		{name: "webm recording", kind: models.KindVoice, attachmentIDs: []int{webm.ID}, wantKind: models.KindVoice},
+		{name: "with text", kind: models.KindVoice, content: "listen", attachmentIDs: []int{ogg.ID}},
+		{name: "two recordings", kind: models.KindVoice, attachmentIDs: []int{ogg.ID, webm.ID}},
+		{name: "other audio", kind: models.KindVoice, attachmentIDs: []int{mp3.ID}},
+		{name: "video", kind: models.KindVoice, attachmentIDs: []int{video.ID}},
+		{name: "unknown kind", kind: "sticker", content: "hi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := messageService.SendMessage(1, &models.CreateMessageRequest{
+				ReceiverID: 2, Content: tt.content, AttachmentIDs: tt.attachmentIDs, Kind: tt.kind,
+			})
+			messages, broadcastErr := messageService.BroadcastMessage(1, &models.BroadcastMessageRequest{
+				ReceiverIDs: []int{2, 3}, Content: tt.content, AttachmentIDs: tt.attachmentIDs, Kind: tt.kind,
+			})
+			if tt.wantKind == "" {
+				assert.ErrorIs(t, err, ErrInvalidMedia)
+				assert.ErrorIs(t, broadcastErr, ErrInvalidMedia)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, broadcastErr)
+			assert.Equal(t, tt.wantKind, msg.Kind)
+			for _, sent := range messages {
+				assert.Equal(t, tt.wantKind, sent.Kind)
+			}
+		})
+	}
+}
+
+// stubPreviews returns fixed previews and records the content it was given
+type stubPreviews struct {
+	previews *mediaModels.Previews
+	err      error
+	content  []byte
+}
+
+func (p *stubPreviews) Generate(key, contentType string, content io.Reader) (*mediaModels.Previews, error) {
+	p.content, _ = io.ReadAll(content)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.previews, nil
+}
+
+func (p *stubPreviews) Remove(variants []mediaModels.Variant) {}
+
+// stubSanitizer replaces every PNG with fixed content
+type stubSanitizer struct {
+	clean []byte
+	err   error
+}
+
+func (s stubSanitizer) Sanitize(content io.Reader, contentType string) ([]byte, bool, error) {
+	if contentType != "image/png" {
+		return nil, false, nil
+	}
+	return s.clean, s.err == nil, s.err
+}
+
+// stubQuota lets each user store up to limit bytes
+type stubQuota struct {
+	limit int64
+	used  map[int]int64
+}
+
+func (q *stubQuota) Check(userID int, size int64) error {
+	if q.used[userID]+size > q.limit {
+		return fmt.Errorf("%w: %d bytes left", ErrQuotaExceeded, q.limit-q.used[userID])
+	}
+	return nil
+}
+
+func (q *stubQuota) Reserve(userID int, size int64) error {
+	if err := q.Check(userID, size); err != nil {
+		return err
+	}
+	q.used[userID] += size
+	return nil
+}
+
+func (q *stubQuota) Release(userID int, size int64) error {
+	q.used[userID] -= size
+	return nil
+}
+
+// newFileHeader builds the multipart file header a handler would pass to UploadMedia
+func newFileHeader(t *testing.T, filename string, content []byte) *multipart.FileHeader {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	form, err := multipart.NewReader(body, writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	return form.File["file"][0]
+}
+
+func TestUploadMedia(t *testing.T) {
+	var png bytes.Buffer
+	require.NoError(t, imagePNG.Encode(&png, image.NewRGBA(image.Rect(0, 0, 4, 3))))
+	sum := sha256.Sum256(png.Bytes())
+
+	t.Run("stores metadata", func(t *testing.T) {
+		store := mediaRepository.NewTestMediaRepository()
+		storage := new(mockStorage)
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage, WithAttachmentStore(store))
+
+		var uploaded []byte
+		storage.On("Upload", mock.MatchedBy(func(key string) bool {
+			return strings.HasPrefix(key, "1_") && strings.HasSuffix(key, ".png")
+		}), mock.Anything, "image/png").Run(func(args mock.Arguments) {
+			uploaded, _ = io.ReadAll(args.Get(1).(io.Reader))
+		}).Return("/api/media/key", nil)
+
+		attachment, err := messageService.UploadMedia(1, newFileHeader(t, "../photos/pic.PNG", png.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, png.Bytes(), uploaded)
+
+		assert.NotZero(t, attachment.ID)
+		assert.Equal(t, 1, attachment.OwnerID)
+		assert.Equal(t, "image/png", attachment.ContentType)
+		assert.Equal(t, int64(png.Len()), attachment.Size)
+		assert.Equal(t, hex.EncodeToString(sum[:]), attachment.SHA256)
+		assert.Equal(t, "pic.PNG", attachment.Filename)
+		assert.Equal(t, mediaModels.URLForKey(attachment.Key), attachment.URL)
+		require.NotNil(t, attachment.Width)
+		require.NotNil(t, attachment.Height)
+		assert.Equal(t, 4, *attachment.Width)
+		assert.Equal(t, 3, *attachment.Height)
+		assert.Nil(t, attachment.DurationMs)
+
+		stored, err := store.GetAttachment(attachment.ID)
+		require.NoError(t, err)
+		assert.Equal(t, attachment.Key, stored.Key)
+	})
+
+	t.Run("previews", func(t *testing.T) {
+		storage := new(mockStorage)
+		generator := &stubPreviews{previews: &mediaModels.Previews{
+			Blurhash: "LKO2?U%2Tw=w]~RBVZRi};RPxuwH",
+			Variants: []mediaModels.Variant{{Name: "thumb_160", URL: "/api/media/x~thumb_160.jpg", Width: 4, Height: 3}},
+		}}
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(mediaRepository.NewTestMediaRepository()), WithPreviews(generator))
+		storage.On("Upload", mock.Anything, mock.Anything, "image/png").Return("/api/media/key", nil)
+
+		attachment, err := messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, png.Bytes(), generator.content)
+		assert.Equal(t, generator.previews.Blurhash, attachment.Blurhash)
+		assert.Equal(t, generator.previews.Variants, attachment.Variants)
+
+		// A failed preview keeps the upload
+		generator.err = fmt.Errorf("decode failed")
+		attachment, err = messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		require.NoError(t, err)
+		assert.Empty(t, attachment.Variants)
+	})
+
+	t.Run("sanitized images", func(t *testing.T) {
+		var clean bytes.Buffer
+		require.NoError(t, imagePNG.Encode(&clean, image.NewRGBA(image.Rect(0, 0, 2, 1))))
+		cleanSum := sha256.Sum256(clean.Bytes())
+
+		storage := new(mockStorage)
+		sanitizer := stubSanitizer{clean: clean.Bytes()}
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(mediaRepository.NewTestMediaRepository()), WithImageSanitizer(sanitizer))
+
+		var uploaded []byte
+		storage.On("Upload", mock.Anything, mock.Anything, "image/png").Run(func(args mock.Arguments) {
+			uploaded, _ = io.ReadAll(args.Get(1).(io.Reader))
+		}).Return("/api/media/key", nil)
+
+		attachment, err := messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, clean.Bytes(), uploaded)
+		assert.Equal(t, int64(clean.Len()), attachment.Size)
+		assert.Equal(t, hex.EncodeToString(cleanSum[:]), attachment.SHA256)
+		require.NotNil(t, attachment.Width)
+		assert.Equal(t, 2, *attachment.Width)
+
+		// Types the sanitizer does not handle pass through untouched
+		var gif bytes.Buffer
+		require.NoError(t, imageGIF.Encode(&gif, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}), nil))
+		storage.On("Upload", mock.Anything, mock.Anything, "image/gif").Run(func(args mock.Arguments) {
+			uploaded, _ = io.ReadAll(args.Get(1).(io.Reader))
+		}).Return("/api/media/key", nil)
+		_, err = messageService.UploadMedia(1, newFileHeader(t, "dot.gif", gif.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, gif.Bytes(), uploaded)
+	})
+
+	t.Run("disallowed type", func(t *testing.T) {
+		storage := new(mockStorage)
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(mediaRepository.NewTestMediaRepository()))
+
+		_, err := messageService.UploadMedia(1, newFileHeader(t, "notes.txt", []byte("hello")))
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		storage.AssertNotCalled(t, "Upload", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("media policy", func(t *testing.T) {
+		storage := new(mockStorage)
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(mediaRepository.NewTestMediaRepository()),
+			WithMediaPolicy(NewMediaPolicy(map[string]int64{"application/pdf": 64, "audio/*": 0})))
+		storage.On("Upload", mock.Anything, mock.Anything, "application/pdf").Run(func(args mock.Arguments) {
+			io.Copy(io.Discard, args.Get(1).(io.Reader))
+		}).Return("/api/media/key", nil)
+
+		// Types are sniffed from the content, whatever the file is called
+		attachment, err := messageService.UploadMedia(1, newFileHeader(t, "report", []byte("%PDF-1.7\n")))
+		require.NoError(t, err)
+		assert.Equal(t, "application/pdf", attachment.ContentType)
+		assert.Equal(t, mediaModels.KindFile, attachment.Kind)
+
+		_, err = messageService.UploadMedia(1, newFileHeader(t, "big.pdf", append([]byte("%PDF-1.7\n"), make([]byte, 64)...)))
+		assert.ErrorIs(t, err, ErrMediaTooLarge)
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		// Types left out of the policy are refused
+		_, err = messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		_, err = messageService.UploadMedia(1, newFileHeader(t, "empty.pdf", nil))
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		storage.AssertNumberOfCalls(t, "Upload", 1)
+
+		assert.NoError(t, messageService.CheckMedia("audio/ogg", 1<<30))
+		assert.ErrorIs(t, messageService.CheckMedia("application/pdf", 65), ErrMediaTooLarge)
+		_, err = messageService.AdoptMedia(1, "1_abc.mp4", "clip.mp4", "video/mp4", 2048)
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+	})
+
+	t.Run("import", func(t *testing.T) {
+		storage := new(mockStorage)
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(mediaRepository.NewTestMediaRepository()))
+		storage.On("Upload", mock.Anything, mock.Anything, "image/png").Run(func(args mock.Arguments) {
+			io.Copy(io.Discard, args.Get(1).(io.Reader))
+		}).Return("/api/media/key", nil)
+
+		attachment, err := messageService.ImportMedia(1, "pic.png", bytes.NewReader(png.Bytes()), int64(png.Len()))
+		require.NoError(t, err)
+		assert.Equal(t, "pic.png", attachment.Filename)
+		assert.Equal(t, hex.EncodeToString(sum[:]), attachment.SHA256)
+	})
+
+	t.Run("unreadable image", func(t *testing.T) {
+		storage := new(mockStorage)
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(mediaRepository.NewTestMediaRepository()),
+			WithImageSanitizer(stubSanitizer{err: fmt.Errorf("image could not be decoded")}))
+
+		_, err := messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		storage.AssertNotCalled(t, "Upload", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("adopt", func(t *testing.T) {
+		storage := new(mockStorage)
+		store := mediaRepository.NewTestMediaRepository()
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage, WithAttachmentStore(store))
+
+		attachment, err := messageService.AdoptMedia(1, "1_abc.mp4", "../clip.mp4", "video/mp4", 2048)
+		require.NoError(t, err)
+		assert.Equal(t, "1_abc.mp4", attachment.Key)
+		assert.Equal(t, "clip.mp4", attachment.Filename)
+		assert.Equal(t, int64(2048), attachment.Size)
+		assert.Empty(t, attachment.SHA256)
+		_, err = store.GetAttachment(attachment.ID)
+		require.NoError(t, err)
+
+		_, err = messageService.AdoptMedia(2, "1_def.mp4", "clip.mp4", "video/mp4", 2048)
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		_, err = messageService.AdoptMedia(1, "1_def.html", "page.html", "text/html", 20)
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		storage.AssertNotCalled(t, "Upload", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		storage := new(mockStorage)
+		quota := &stubQuota{limit: int64(png.Len()) + 100, used: map[int]int64{}}
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(mediaRepository.NewTestMediaRepository()), WithStorageQuota(quota))
+		storage.On("Upload", mock.Anything, mock.Anything, "image/png").Return("/api/media/key", nil).Once()
+
+		_, err := messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, int64(png.Len()), quota.used[1])
+
+		_, err = messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		assert.ErrorIs(t, err, ErrQuotaExceeded)
+		_, err = messageService.AdoptMedia(1, "1_abc.mp4", "clip.mp4", "video/mp4", 101)
+		assert.ErrorIs(t, err, ErrQuotaExceeded)
+		assert.ErrorIs(t, messageService.CheckQuota(1, 101), ErrQuotaExceeded)
+		assert.NoError(t, messageService.CheckQuota(2, 101))
+		storage.AssertNumberOfCalls(t, "Upload", 1)
+
+		// Storage is given back when a file cannot be stored
+		storage.On("Upload", mock.Anything, mock.Anything, mock.Anything).Return("", fmt.Errorf("disk full"))
+		_, err = messageService.UploadMedia(2, newFileHeader(t, "pic.png", png.Bytes()))
+		assert.Error(t, err)
+		assert.Zero(t, quota.used[2])
+	})
+
+	t.Run("deduplicates", func(t *testing.T) {
+		storage := new(mockStorage)
+		store := mediaRepository.NewTestMediaRepository()
+		quota := &stubQuota{limit: 1 << 20, used: map[int]int64{}}
+		generator := &stubPreviews{previews: &mediaModels.Previews{
+			Blurhash: "LKO2?U%2Tw=w]~RBVZRi};RPxuwH",
+			Variants: []mediaModels.Variant{{Name: "thumb_160", URL: "/api/media/x~thumb_160.jpg", Width: 4, Height: 3}},
+		}}
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(store), WithPreviews(generator), WithStorageQuota(quota),
+			WithBlobStore(fileStorage.NewBlobStore(storage, store)))
+		storage.On("Upload", mock.MatchedBy(func(key string) bool {
+			return strings.HasPrefix(key, fileStorage.BlobPrefix) && strings.HasSuffix(key, ".png")
+		}), mock.Anything, "image/png").Return("/api/media/key", nil)
+
+		first, err := messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		require.NoError(t, err)
+		generator.previews = nil
+		second, err := messageService.UploadMedia(2, newFileHeader(t, "meme.png", png.Bytes()))
+		require.NoError(t, err)
+
+		// Each upload gets its own attachment, sharing one stored file and its previews
+		assert.NotEqual(t, first.ID, second.ID)
+		assert.Equal(t, 2, second.OwnerID)
+		assert.Equal(t, "meme.png", second.Filename)
+		assert.Equal(t, first.Key, second.Key)
+		assert.Equal(t, first.SHA256, second.SHA256)
+		assert.Equal(t, first.Variants, second.Variants)
+		assert.Equal(t, first.Blurhash, second.Blurhash)
+		storage.AssertNumberOfCalls(t, "Upload", 1)
+		assert.Equal(t, 2, store.BlobRefs(first.SHA256))
+
+		// Only the upload that stored the file is charged for it
+		assert.Equal(t, int64(png.Len()), quota.used[1])
+		assert.Zero(t, quota.used[2])
+	})
+
+	t.Run("storage failure", func(t *testing.T) {
+		storage := new(mockStorage)
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage, WithAttachmentStore(mediaRepository.NewTestMediaRepository()))
+		storage.On("Upload", mock.Anything, mock.Anything, mock.Anything).Return("", fmt.Errorf("disk full"))
+
+		_, err := messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		assert.Error(t, err)
+	})
+
+	t.Run("malware scanning", func(t *testing.T) {
+		infected := append(append([]byte{}, png.Bytes()...), []byte("virus")...)
+		suspicious := append(append([]byte{}, png.Bytes()...), []byte("adware")...)
+		scanner := scan.NewFake().
+			Add("virus", scan.Infected, "Win.Test.Virus-1").
+			Add("adware", scan.Suspicious, "PUA.Win.Adware.Test")
+		store := mediaRepository.NewTestMediaRepository()
+		storage := new(mockStorage)
+		messageService := NewMessageService(repository.NewTestMessageRepository(), storage,
+			WithAttachmentStore(store), WithScanner(scanner, store))
+
+		var quarantined []byte
+		storage.On("Upload", mock.MatchedBy(func(key string) bool {
+			return strings.HasPrefix(key, mediaModels.QuarantinePrefix+"1_") && strings.HasSuffix(key, ".png")
+		}), mock.Anything, "image/png").Run(func(args mock.Arguments) {
+			quarantined, _ = io.ReadAll(args.Get(1).(io.Reader))
+		}).Return("/api/media/key", nil)
+		storage.On("Upload", mock.Anything, mock.Anything, "image/png").Return("/api/media/key", nil)
+
+		_, err := messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		require.NoError(t, err)
+		storage.AssertNumberOfCalls(t, "Upload", 1)
+
+		// Infected files are refused without being stored
+		_, err = messageService.UploadMedia(1, newFileHeader(t, "pic.png", infected))
+		assert.ErrorIs(t, err, ErrMalwareDetected)
+		assert.ErrorIs(t, err, ErrInvalidMedia)
+		storage.AssertNumberOfCalls(t, "Upload", 1)
+
+		// Suspicious files are refused and kept for review
+		_, err = messageService.ImportMedia(1, "../prize.png", bytes.NewReader(suspicious), int64(len(suspicious)))
+		assert.ErrorIs(t, err, ErrQuarantined)
+		assert.Equal(t, suspicious, quarantined)
+		files, err := store.ListQuarantinedFiles(0, 10)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, 1, files[0].OwnerID)
+		assert.Equal(t, "prize.png", files[0].Filename)
+		assert.Equal(t, "PUA.Win.Adware.Test", files[0].Signature)
+		assert.Equal(t, int64(len(suspicious)), files[0].Size)
+		assert.True(t, mediaModels.IsQuarantined(files[0].Key))
+		storage.AssertNumberOfCalls(t, "Upload", 2)
+
+		// Nothing is stored unscanned while the scanner is unavailable
+		scanner.Fail(fmt.Errorf("connection refused"))
+		_, err = messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		assert.ErrorIs(t, err, ErrScanFailed)
+		assert.NotErrorIs(t, err, ErrInvalidMedia)
+		storage.AssertNumberOfCalls(t, "Upload", 2)
+	})
+
+	t.Run("malware scanning of adopted files", func(t *testing.T) {
+		files := fileStorage.NewLocalStorage(t.TempDir(), "/api/media")
+		store := mediaRepository.NewTestMediaRepository()
+		scanner := scan.NewFake().Add("virus", scan.Infected, "Win.Test.Virus-1")
+		messageService := NewMessageService(repository.NewTestMessageRepository(), files,
+			WithAttachmentStore(store), WithScanner(scanner, store))
+
+		_, err := files.Upload("1_clean.mp4", strings.NewReader("clean video"), "video/mp4")
+		require.NoError(t, err)
+		_, err = messageService.AdoptMedia(1, "1_clean.mp4", "clip.mp4", "video/mp4", 11)
+		require.NoError(t, err)
+
+		_, err = files.Upload("1_bad.mp4", strings.NewReader("virus video"), "video/mp4")
+		require.NoError(t, err)
+		_, err = messageService.AdoptMedia(1, "1_bad.mp4", "clip.mp4", "video/mp4", 11)
+		assert.ErrorIs(t, err, ErrMalwareDetected)
+		assert.Equal(t, 2, scanner.Scanned())
+
+		// Files that cannot be read back cannot be scanned
+		messageService = NewMessageService(repository.NewTestMessageRepository(), new(mockStorage),
+			WithAttachmentStore(store), WithScanner(scanner, store))
+		_, err = messageService.AdoptMedia(1, "1_clean.mp4", "clip.mp4", "video/mp4", 11)
+		assert.ErrorIs(t, err, ErrScanFailed)
+	})
+
+	t.Run("without an attachment store", func(t *testing.T) {
+		messageService := NewMessageService(repository.NewTestMessageRepository(), new(mockStorage))
+		_, err := messageService.UploadMedia(1, newFileHeader(t, "pic.png", png.Bytes()))
+		assert.ErrorIs(t, err, ErrUploadsDisabled)
+	})
+}
+
+// stubFilter returns a fixed verdict for messages containing its trigger text
+type stubFilter struct {
+	name    string
+	trigger string
+	result  FilterResult
+}
+
+func (f stubFilter) Name() string { return f.name }
+
+func (f stubFilter) Check(msg *OutgoingMessage) (FilterResult, error) {
+	if strings.Contains(msg.Content, f.trigger) {
+		return f.result, nil
+	}
+	return FilterResult{Action: FilterAllow}, nil
+}
+
+type recordedFlag struct {
+	messageID int
+	filter    string
+	reason    string
+}
+
+type flagLog []recordedFlag
+
+func (l *flagLog) FlagMessage(msg *models.Message, filter, reason string) error {
+	*l = append(*l, recordedFlag{messageID: msg.ID, filter: filter, reason: reason})
+	return nil
+}
+
+func TestMediaPolicy(t *testing.T) {
+	policy := NewMediaPolicy(map[string]int64{
+		"image/*":    100,
+		"image/webp": 0,
+		"text/plain": 10,
+	})
+
+	assert.True(t, policy.Allows("image/png"))
+	assert.True(t, policy.Allows("IMAGE/PNG"))
+	assert.False(t, policy.Allows("video/mp4"))
+	assert.False(t, policy.Allows("text/html"))
+
+	assert.NoError(t, policy.Check("image/png", 100))
+	assert.ErrorIs(t, policy.Check("image/png", 101), ErrMediaTooLarge)
+	// An exact entry wins over the wildcard
+	assert.NoError(t, policy.Check("image/webp", 1<<20))
+	assert.ErrorIs(t, policy.Check("text/plain", 11), ErrMediaTooLarge)
+	err := policy.Check("application/zip", 1)
+	assert.ErrorIs(t, err, ErrInvalidMedia)
+	assert.NotErrorIs(t, err, ErrMediaTooLarge)
+
+	defaults := DefaultMediaPolicy()
+	for _, contentType := range []string{"image/jpeg", "image/png", "image/gif", "video/mp4"} {
+		assert.True(t, defaults.Allows(contentType), contentType)
+	}
+	assert.False(t, defaults.Allows("application/pdf"))
+}
+
+func TestMessageFilters(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	flags := &flagLog{}
+	messageService := NewMessageService(repo, new(mockStorage),
+		WithFilter(
+			stubFilter{name: "redactor", trigger: "secret", result: FilterResult{Action: FilterRedact, Content: "[redacted] stuff"}},
+			stubFilter{name: "rejector", trigger: "forbidden", result: FilterResult{Action: FilterReject, Reason: "not allowed"}},
+			stubFilter{name: "flagger", trigger: "stuff", result: FilterResult{Action: FilterFlag, Reason: "looks odd"}},
+		),
+		WithFlagRecorder(flags),
+	)
+
+	// Redactions are stored and seen by later filters, which can flag the result
+	msg, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "[redacted] stuff", msg.Content)
+	assert.Equal(t, flagLog{{messageID: msg.ID, filter: "flagger", reason: "looks odd"}}, *flags)
+
+	msg, err = messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "forbidden"})
+	assert.ErrorIs(t, err, ErrContentRejected)
+	var rejection *RejectionError
+	require.ErrorAs(t, err, &rejection)
+	assert.Equal(t, "rejector", rejection.Filter)
+	assert.Equal(t, "not allowed", rejection.Reason)
+	assert.Nil(t, msg)
+
+	// A rejected broadcast sends nothing
+	messages, err := messageService.BroadcastMessage(1, &models.BroadcastMessageRequest{
+		ReceiverIDs: []int{2, 3},
+		Content:     "forbidden",
+	})
+	assert.ErrorIs(t, err, ErrContentRejected)
+	assert.Nil(t, messages)
+
+	history, err := repo.GetMessageHistory(1)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+}
+
+// stubResolver resolves the usernames it holds
+type stubResolver map[string]int
+
+func (r stubResolver) ResolveUsernames(usernames []string) (map[string]int, error) {
+	ids := make(map[string]int)
+	for _, username := range usernames {
+		if id, ok := r[username]; ok {
+			ids[username] = id
+		}
+	}
+	return ids, nil
+}
+
+func TestMessageEntities(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage),
+		WithMentionResolver(stubResolver{"bob": 2, "carol": 3}),
+		WithFilter(stubFilter{name: "redactor", trigger: "darn", result: FilterResult{Action: FilterRedact, Content: "**what the ****!** @bob"}}),
+	)
+
+	msg, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "**hey** @bob, see `main.go` and @dave"})
+	require.NoError(t, err)
+	assert.Equal(t, "hey @bob, see main.go and @dave", msg.Content)
+	assert.Equal(t, []models.Entity{
+		{Type: models.EntityBold, Offset: 0, Length: 3},
+		{Type: models.EntityMention, Offset: 4, Length: 4, UserID: 2},
+		{Type: models.EntityCode, Offset: 14, Length: 7},
+	}, msg.Entities)
+	assert.True(t, msg.Mentioned)
+
+	stored, err := repo.GetMessageByID(msg.ID)
+	require.NoError(t, err)
+	assert.Equal(t, msg.Entities, stored.Entities)
+	assert.True(t, stored.Mentioned)
+
+	// Each recipient's copy says whether they were mentioned
+	messages, err := messageService.BroadcastMessage(1, &models.BroadcastMessageRequest{
+		ReceiverIDs: []int{2, 3, 4},
+		Content:     "_ping_ @carol",
+	})
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.False(t, messages[0].Mentioned)
+	assert.True(t, messages[1].Mentioned)
+	assert.False(t, messages[2].Mentioned)
+	assert.Equal(t, "ping @carol", messages[2].Content)
+
+	// Markup is parsed after filters, and redacted words are not taken for markers
+	msg, err = messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "**what the darn!**"})
+	require.NoError(t, err)
+	assert.Equal(t, "what the ****! @bob", msg.Content)
+	assert.Equal(t, []models.Entity{
+		{Type: models.EntityBold, Offset: 0, Length: 14},
+		{Type: models.EntityMention, Offset: 15, Length: 4, UserID: 2},
+	}, msg.Entities)
+
+	// Without a resolver mentions are text
+	plain := NewMessageService(repository.NewTestMessageRepository(), new(mockStorage))
+	msg, err = plain.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "hi @bob"})
+	require.NoError(t, err)
+	assert.Empty(t, msg.Entities)
+	assert.False(t, msg.Mentioned)
+}
+
+func TestHistoryHidesBlockedSenders(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage))
+
+	_, err := messageService.SendMessage(1, &models.CreateMessageRequest{ReceiverID: 2, Content: "Hi"})
+	require.NoError(t, err)
+	_, err = messageService.SendMessage(2, &models.CreateMessageRequest{ReceiverID: 1, Content: "Hello"})
+	require.NoError(t, err)
+
+	repo.SetBlocked(1, 2)
+
+	conversation, err := messageService.GetConversation(1, 2)
+	require.NoError(t, err)
+	require.Len(t, conversation, 1)
+	assert.Equal(t, 1, conversation[0].SenderID)
+
+	history, err := messageService.GetMessageHistory(1)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	// The blocked user still sees the whole conversation
+	conversation, err = messageService.GetConversation(2, 1)
+	require.NoError(t, err)
+	assert.Len(t, conversation, 2)
+}
+
 func TestGetMessageHistory(t *testing.T) {
 	repo := &mockRepo{}
 	mockStorage := new(mockStorage)
@@ -398,6 +1213,30 @@ func TestUpdateMessageStatus(t *testing.T) {
 	}
 }
 
+func TestPlayedStatus(t *testing.T) {
+	repo := repository.NewTestMessageRepository()
+	messageService := NewMessageService(repo, new(mockStorage))
+
+	text := &models.Message{SenderID: 1, ReceiverID: 2, Kind: models.KindText, Status: models.StatusSent}
+	voice := &models.Message{SenderID: 1, ReceiverID: 2, Kind: models.KindVoice, Status: models.StatusSent}
+	require.NoError(t, repo.Create(text))
+	require.NoError(t, repo.Create(voice))
+
+	err := messageService.UpdateMessageStatus(text.ID, models.StatusPlayed, 2)
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+
+	require.NoError(t, messageService.UpdateMessageStatus(voice.ID, models.StatusPlayed, 2))
+	// Receipts arriving after the message was played do not move it back
+	require.NoError(t, messageService.UpdateMessageStatus(voice.ID, models.StatusRead, 2))
+	stored, err := repo.GetMessageByID(voice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPlayed, stored.Status)
+
+	// Only the recipient plays a message
+	err = messageService.UpdateMessageStatus(voice.ID, models.StatusPlayed, 1)
+	assert.Error(t, err)
+}
+
 // Add mock storage
 type mockStorage struct {
 	mock.Mock
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/message/models"
+)
+
+// ErrInvalidStatus is returned when a status does not apply to a message, such as
+// played for a message that is not a voice message
+var ErrInvalidStatus = errors.New("invalid status for this message")
+
+// voiceTypes are the audio containers voice messages are recorded in
+var voiceTypes = map[string]bool{
+	"audio/ogg":  true,
+	"audio/webm": true,
+}
+
+// checkKind validates a message of kind with content and attachments, returning the kind
+// to store. Voice messages are a single recording with nothing else, so clients can show
+// them as a player rather than as a file.
+func checkKind(kind models.MessageKind, content, mediaURL string, attachments []mediaModels.Attachment) (models.MessageKind, error) {
+	switch kind {
+	case "", models.KindText:
+		return models.KindText, nil
+	case models.KindVoice:
+		if content != "" || mediaURL != "" {
+			return "", fmt.Errorf("%w: voice messages cannot have text or a media URL", ErrInvalidMedia)
+		}
+		if len(attachments) != 1 {
+			return "", fmt.Errorf("%w: voice messages need exactly one attachment", ErrInvalidMedia)
+		}
+		if attachment := attachments[0]; attachment.Kind != mediaModels.KindAudio || !voiceTypes[attachment.ContentType] {
+			return "", fmt.Errorf("%w: voice messages must be Ogg or WebM audio", ErrInvalidMedia)
+		}
+		return models.KindVoice, nil
+	default:
+		return "", fmt.Errorf("%w: unknown message kind %q", ErrInvalidMedia, kind)
+	}
+}
+
+// checkStatus reports whether giving message status would change anything. Played is
+// final, since players mark voice messages read or delivered after they have been played.
+func checkStatus(message *models.Message, status models.MessageStatus) (bool, error) {
+	if status == models.StatusPlayed && message.Kind != models.KindVoice {
+		return false, fmt.Errorf("%w: only voice messages can be played", ErrInvalidStatus)
+	}
+	if message.Status == models.StatusPlayed {
+		return false, nil
+	}
+	return true, nil
+}
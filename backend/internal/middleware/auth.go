@@ -10,19 +10,31 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/Mousa96/chatting-service/internal/auth/models"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // Define context key type and constant
 type contextKey string
 const UserIDKey = contextKey("user_id")
+const RoleKey = contextKey("role")
+const PermissionsKey = contextKey("permissions")
 
 // Claims represents the JWT token claims structure
 type Claims struct {
-	UserID int `json:"user_id"`
+	UserID      int                 `json:"user_id"`
+	Role        models.Role         `json:"role,omitempty"`
+	Permissions []models.Permission `json:"permissions,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// EffectivePermissions returns the permissions the token's role grants now. The
+// permissions claim is informational for clients: it is not trusted, so that
+// permissions withdrawn from a role are withdrawn from tokens already issued too.
+func (c *Claims) EffectivePermissions() []models.Permission {
+	return c.Role.Permissions()
+}
+
 // ErrorResponse is a standardized JSON error response
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -35,8 +47,36 @@ func sendJSONError(w http.ResponseWriter, message string, statusCode int) {
 	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
 }
 
+// AccountChecker reports whether a user may still use the tokens issued to them, and
+// with which role
+type AccountChecker interface {
+	// ActiveRole returns the role userID holds now, and false when the user has since
+	// been suspended or deleted
+	ActiveRole(userID int) (models.Role, bool, error)
+}
+
+// authConfig holds the optional dependencies of AuthMiddleware
+type authConfig struct {
+	accounts AccountChecker
+}
+
+// AuthOption configures AuthMiddleware
+type AuthOption func(*authConfig)
+
+// WithAccountChecker rejects tokens of users who have since been suspended or deleted,
+// and grants the permissions of the role users hold now rather than the one in the token
+func WithAccountChecker(accounts AccountChecker) AuthOption {
+	return func(c *authConfig) {
+		c.accounts = accounts
+	}
+}
+
 // AuthMiddleware creates a new authentication middleware
-func AuthMiddleware(jwtKey []byte) func(http.Handler) http.Handler {
+func AuthMiddleware(jwtKey []byte, opts ...AuthOption) func(http.Handler) http.Handler {
+	var config authConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -101,14 +141,84 @@ func AuthMiddleware(jwtKey []byte) func(http.Handler) http.Handler {
 			}
 
 			//log.Printf("Token validated successfully, claims: %+v", claims) // Debug
-			// Add user ID to request context
+			// Add user ID, role and permissions to request context
 			userID := int(claims["user_id"].(float64))
+			role, permissions := roleAndPermissionsFromClaims(claims)
+			if config.accounts != nil {
+				current, active, err := config.accounts.ActiveRole(userID)
+				if err != nil {
+					log.Printf("Failed to check account of user %d: %v", userID, err)
+					sendJSONError(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				if !active {
+					if isAPIRequest {
+						sendJSONError(w, "Account suspended or deleted", http.StatusUnauthorized)
+					} else {
+						http.Error(w, "unauthorized", http.StatusUnauthorized)
+					}
+					return
+				}
+				// Role changes apply to tokens already issued
+				role, permissions = current, current.Permissions()
+			}
 			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, RoleKey, role)
+			ctx = context.WithValue(ctx, PermissionsKey, permissions)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// RequirePermission creates a middleware that rejects requests whose token does not
+// grant the given permission. It must be chained after AuthMiddleware.
+func RequirePermission(permission models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasPermission(r.Context(), permission) {
+				userID, _ := GetUserIDFromContext(r.Context())
+				log.Printf("User %d denied access to %s: missing permission %s", userID, r.URL.Path, permission)
+				sendJSONError(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// roleAndPermissionsFromClaims extracts the role from parsed token claims, with the
+// permissions it grants; see Claims.EffectivePermissions
+func roleAndPermissionsFromClaims(claims jwt.MapClaims) (models.Role, []models.Permission) {
+	role := models.RoleUser
+	if r, ok := claims["role"].(string); ok && r != "" {
+		role = models.Role(r)
+	}
+	return role, role.Permissions()
+}
+
+// GetRoleFromContext extracts the user role from context
+func GetRoleFromContext(ctx context.Context) (models.Role, error) {
+	role, ok := ctx.Value(RoleKey).(models.Role)
+	if !ok {
+		return "", errors.New("role not found in context")
+	}
+	return role, nil
+}
+
+// HasPermission checks if the permissions stored in context include the given permission
+func HasPermission(ctx context.Context, permission models.Permission) bool {
+	permissions, ok := ctx.Value(PermissionsKey).([]models.Permission)
+	if !ok {
+		return false
+	}
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 // GetUserIDFromContext extracts user ID from context
 func GetUserIDFromContext(ctx context.Context) (int, error) {
 	userID, ok := ctx.Value(UserIDKey).(int)
@@ -120,6 +230,15 @@ func GetUserIDFromContext(ctx context.Context) (int, error) {
 
 // ValidateTokenAndGetUserID validates a JWT token and returns the user ID
 func ValidateTokenAndGetUserID(tokenString string, jwtKey string) (int, error) {
+	claims, err := ValidateToken(tokenString, jwtKey)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// ValidateToken validates a JWT token and returns its claims
+func ValidateToken(tokenString string, jwtKey string) (*Claims, error) {
 	// Parse the JWT token
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Validate signing method
@@ -130,13 +249,16 @@ func ValidateTokenAndGetUserID(tokenString string, jwtKey string) (int, error) {
 	})
 
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	// Extract claims
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.UserID, nil
+		if claims.Role == "" {
+			claims.Role = models.RoleUser
+		}
+		return claims, nil
 	}
 
-	return 0, fmt.Errorf("invalid token")
+	return nil, fmt.Errorf("invalid token")
 }
\ No newline at end of file
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/auth/models"
+	userModels "github.com/Mousa96/chatting-service/internal/user/models"
+	userRepository "github.com/Mousa96/chatting-service/internal/user/repository"
+	userService "github.com/Mousa96/chatting-service/internal/user/service"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signTestToken(t *testing.T, key []byte, claims jwt.MapClaims) string {
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+func TestRequirePermission(t *testing.T) {
+	jwtKey := []byte("test-key")
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	protected := AuthMiddleware(jwtKey)(RequirePermission(models.PermissionManageUsers)(okHandler))
+
+	tests := []struct {
+		name         string
+		claims       jwt.MapClaims
+		expectedCode int
+	}{
+		{
+			name: "Admin token",
+			claims: jwt.MapClaims{
+				"user_id":     1,
+				"role":        models.RoleAdmin,
+				"permissions": models.RoleAdmin.Permissions(),
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "Regular user token",
+			claims: jwt.MapClaims{
+				"user_id":     2,
+				"role":        models.RoleUser,
+				"permissions": models.RoleUser.Permissions(),
+			},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "Legacy token without role",
+			claims: jwt.MapClaims{
+				"user_id": 3,
+			},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "Role without permissions claim",
+			claims: jwt.MapClaims{
+				"user_id": 4,
+				"role":    models.RoleAdmin,
+			},
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+			req.Header.Set("Authorization", "Bearer "+signTestToken(t, jwtKey, tt.claims))
+			rr := httptest.NewRecorder()
+
+			protected.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+		})
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	jwtKey := []byte("test-key")
+
+	t.Run("Carries role and permissions", func(t *testing.T) {
+		token := signTestToken(t, jwtKey, jwt.MapClaims{
+			"user_id":     7,
+			"role":        models.RoleAdmin,
+			"permissions": models.RoleAdmin.Permissions(),
+		})
+
+		claims, err := ValidateToken(token, string(jwtKey))
+		require.NoError(t, err)
+		assert.Equal(t, 7, claims.UserID)
+		assert.Equal(t, models.RoleAdmin, claims.Role)
+		assert.Contains(t, claims.EffectivePermissions(), models.PermissionViewStats)
+	})
+
+	t.Run("Defaults to user role", func(t *testing.T) {
+		token := signTestToken(t, jwtKey, jwt.MapClaims{"user_id": 8})
+
+		claims, err := ValidateToken(token, string(jwtKey))
+		require.NoError(t, err)
+		assert.Equal(t, models.RoleUser, claims.Role)
+		assert.ElementsMatch(t, models.RoleUser.Permissions(), claims.EffectivePermissions())
+	})
+
+	t.Run("Rejects wrong key", func(t *testing.T) {
+		token := signTestToken(t, []byte("other-key"), jwt.MapClaims{"user_id": 9})
+
+		_, err := ValidateToken(token, string(jwtKey))
+		assert.Error(t, err)
+	})
+}
+
+func TestBroadcastPermission(t *testing.T) {
+	jwtKey := []byte("test-key")
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	protected := AuthMiddleware(jwtKey)(RequirePermission(models.PermissionBroadcastMessages)(okHandler))
+
+	tests := []struct {
+		name         string
+		claims       jwt.MapClaims
+		expectedCode int
+	}{
+		{"Regular user", jwt.MapClaims{"user_id": 1, "role": models.RoleUser}, http.StatusForbidden},
+		{"Legacy token without role", jwt.MapClaims{"user_id": 2}, http.StatusForbidden},
+		{
+			// Tokens issued while regular users could broadcast still list the permission
+			name: "Regular user with stale permissions claim",
+			claims: jwt.MapClaims{
+				"user_id":     3,
+				"role":        models.RoleUser,
+				"permissions": []models.Permission{models.PermissionBroadcastMessages},
+			},
+			expectedCode: http.StatusForbidden,
+		},
+		{"Moderator", jwt.MapClaims{"user_id": 4, "role": models.RoleModerator}, http.StatusOK},
+		{"Admin", jwt.MapClaims{"user_id": 5, "role": models.RoleAdmin}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/messages/broadcast", nil)
+			req.Header.Set("Authorization", "Bearer "+signTestToken(t, jwtKey, tt.claims))
+			rr := httptest.NewRecorder()
+
+			protected.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+		})
+	}
+}
+
+func TestSuspendedUserToken(t *testing.T) {
+	jwtKey := []byte("test-key")
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	repo := userRepository.NewTestUserRepository()
+	repo.AddUser(userModels.User{ID: 1, Username: "alice"})
+	repo.AddUser(userModels.User{ID: 2, Username: "bob"})
+	protected := AuthMiddleware(jwtKey, WithAccountChecker(userService.NewAccountChecker(repo)))(okHandler)
+
+	request := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	aliceToken := signTestToken(t, jwtKey, jwt.MapClaims{"user_id": 1, "role": models.RoleUser})
+	bobToken := signTestToken(t, jwtKey, jwt.MapClaims{"user_id": 2, "role": models.RoleUser})
+	require.Equal(t, http.StatusOK, request(aliceToken))
+	require.Equal(t, http.StatusOK, request(bobToken))
+
+	require.NoError(t, repo.SetUserSuspended(1, true))
+	require.NoError(t, repo.DeleteUser(2))
+	assert.Equal(t, http.StatusUnauthorized, request(aliceToken), "suspended users' tokens are refused")
+	assert.Equal(t, http.StatusUnauthorized, request(bobToken), "deleted users' tokens are refused")
+
+	require.NoError(t, repo.SetUserSuspended(1, false))
+	assert.Equal(t, http.StatusOK, request(aliceToken), "reinstated users' tokens work again")
+}
+
+func TestRoleChangeAppliesToIssuedTokens(t *testing.T) {
+	jwtKey := []byte("test-key")
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	repo := userRepository.NewTestUserRepository()
+	repo.AddUser(userModels.User{ID: 1, Username: "alice", Role: string(models.RoleAdmin)})
+	repo.AddUser(userModels.User{ID: 2, Username: "bob", Role: string(models.RoleUser)})
+	protected := AuthMiddleware(jwtKey, WithAccountChecker(userService.NewAccountChecker(repo)))(
+		RequirePermission(models.PermissionManageUsers)(okHandler))
+
+	request := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	aliceToken := signTestToken(t, jwtKey, jwt.MapClaims{"user_id": 1, "role": models.RoleAdmin})
+	bobToken := signTestToken(t, jwtKey, jwt.MapClaims{"user_id": 2, "role": models.RoleUser})
+	require.Equal(t, http.StatusOK, request(aliceToken))
+	require.Equal(t, http.StatusForbidden, request(bobToken))
+
+	require.NoError(t, repo.SetUserRole(1, string(models.RoleUser)))
+	require.NoError(t, repo.SetUserRole(2, string(models.RoleAdmin)))
+	assert.Equal(t, http.StatusForbidden, request(aliceToken), "demoted admins lose their permissions at once")
+	assert.Equal(t, http.StatusOK, request(bobToken), "promoted users gain permissions at once")
+}
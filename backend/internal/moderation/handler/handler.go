@@ -0,0 +1,417 @@
+// Package handler implements the HTTP handlers for reporting and moderation operations
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Mousa96/chatting-service/internal/middleware"
+	"github.com/Mousa96/chatting-service/internal/moderation/models"
+	"github.com/Mousa96/chatting-service/internal/moderation/service"
+)
+
+// ModerationHandler provides the implementation of the Handler interface
+type ModerationHandler struct {
+	moderationService service.Service
+}
+
+// NewModerationHandler creates a new ModerationHandler instance
+func NewModerationHandler(moderationService service.Service) Handler {
+	return &ModerationHandler{moderationService: moderationService}
+}
+
+// CreateReport godoc
+// @Summary Report a message or user
+// @Description Report a received message or another user to the moderators. Set exactly one of message_id and user_id.
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param request body models.CreateReportRequest true "Report"
+// @Success 201 {object} models.Report "Created report"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Message or user not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /reports [post]
+func (h *ModerationHandler) CreateReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.moderationService.CreateReport(userID, &req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, report)
+}
+
+// ListReports godoc
+// @Summary List reports
+// @Description Retrieve a page of reports with the given status, newest first. Pass next_before from the previous page as before to continue; an empty page marks the end.
+// @Tags moderation
+// @Produce json
+// @Param status query string false "open (default), resolved or dismissed"
+// @Param before query int false "Only return reports with a lower ID"
+// @Param limit query int false "Page size, default 50, maximum 100"
+// @Success 200 {object} map[string]interface{} "Reports and next_before"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /moderation/reports [get]
+func (h *ModerationHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	before, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	reports, err := h.moderationService.ListReports(models.ReportFilter{
+		Status:   models.ReportStatus(r.URL.Query().Get("status")),
+		BeforeID: before,
+		Limit:    limit,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{"reports": reports}
+	if len(reports) > 0 {
+		response["next_before"] = reports[len(reports)-1].ID
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetReport godoc
+// @Summary Get a report
+// @Description Retrieve a report with its content snapshot and the actions taken on it
+// @Tags moderation
+// @Produce json
+// @Param id query int true "Report ID"
+// @Success 200 {object} models.ReportDetails "Report"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Report not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /moderation/reports/view [get]
+func (h *ModerationHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reportID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || reportID <= 0 {
+		http.Error(w, "invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.moderationService.GetReport(reportID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// CloseReport godoc
+// @Summary Close a report
+// @Description Mark an open report resolved or dismissed without taking any other action
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param request body models.ResolveReportRequest true "Report and new status"
+// @Success 200 {object} models.Report "Closed report"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Report not found"
+// @Failure 409 {string} string "Report already closed"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /moderation/reports/close [post]
+func (h *ModerationHandler) CloseReport(w http.ResponseWriter, r *http.Request) {
+	moderatorID, ok := moderatorFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ResolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ReportID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.moderationService.CloseReport(moderatorID, &req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// HideMessage godoc
+// @Summary Hide a message
+// @Description Hide a message from both participants. Connected clients receive a message_hidden event. A linked report is resolved.
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param request body models.MessageActionRequest true "Message to hide"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Message or report not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /moderation/messages/hide [post]
+func (h *ModerationHandler) HideMessage(w http.ResponseWriter, r *http.Request) {
+	h.handleMessageAction(w, r, h.moderationService.HideMessage, "message hidden")
+}
+
+// DeleteMessage godoc
+// @Summary Delete a message
+// @Description Permanently delete a message. Connected clients receive a message_hidden event. A linked report is resolved.
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param request body models.MessageActionRequest true "Message to delete"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "Message or report not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /moderation/messages/delete [post]
+func (h *ModerationHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	h.handleMessageAction(w, r, h.moderationService.DeleteMessage, "message deleted")
+}
+
+// WarnUser godoc
+// @Summary Warn a user
+// @Description Send a moderation_warning event to a user with the note as its message. A linked report is resolved.
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param request body models.UserActionRequest true "User to warn"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 404 {string} string "User or report not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /moderation/users/warn [post]
+func (h *ModerationHandler) WarnUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, h.moderationService.WarnUser, "user warned")
+}
+
+// SuspendUser godoc
+// @Summary Suspend a user
+// @Description Suspend a regular user account and close its WebSocket connection. A linked report is resolved.
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param request body models.UserActionRequest true "User to suspend"
+// @Success 200 {object} map[string]string "Success response"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden, including when the target is a moderator or administrator"
+// @Failure 404 {string} string "User or report not found"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /moderation/users/suspend [post]
+func (h *ModerationHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	h.handleUserAction(w, r, h.moderationService.SuspendUser, "user suspended")
+}
+
+// ListActions godoc
+// @Summary List moderation actions
+// @Description Retrieve a page of the moderation audit trail, newest first
+// @Tags moderation
+// @Produce json
+// @Param user_id query int false "Only actions targeting this user"
+// @Param before query int false "Only return actions with a lower ID"
+// @Param limit query int false "Page size, default 50, maximum 100"
+// @Success 200 {object} map[string]interface{} "Actions and next_before"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {string} string "Forbidden"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /moderation/actions [get]
+func (h *ModerationHandler) ListActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	before, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	filter := models.ActionFilter{BeforeID: before, Limit: limit}
+	if raw := r.URL.Query().Get("user_id"); raw != "" {
+		userID, err := strconv.Atoi(raw)
+		if err != nil || userID <= 0 {
+			http.Error(w, "invalid user ID", http.StatusBadRequest)
+			return
+		}
+		filter.TargetUserID = userID
+	}
+
+	actions, err := h.moderationService.ListActions(filter)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{"actions": actions}
+	if len(actions) > 0 {
+		response["next_before"] = actions[len(actions)-1].ID
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleMessageAction decodes a message action request and applies it
+func (h *ModerationHandler) handleMessageAction(w http.ResponseWriter, r *http.Request, apply func(int, *models.MessageActionRequest) error, result string) {
+	moderatorID, ok := moderatorFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.MessageActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := apply(moderatorID, &req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": result})
+}
+
+// handleUserAction decodes a user action request and applies it
+func (h *ModerationHandler) handleUserAction(w http.ResponseWriter, r *http.Request, apply func(int, *models.UserActionRequest) error, result string) {
+	moderatorID, ok := moderatorFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UserActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := apply(moderatorID, &req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": result})
+}
+
+// moderatorFromRequest checks the method of a moderator action and returns the caller's ID
+func moderatorFromRequest(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+
+	moderatorID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+	return moderatorID, true
+}
+
+// pageParams parses the optional before and limit query parameters
+func pageParams(w http.ResponseWriter, r *http.Request) (before, limit int, ok bool) {
+	query := r.URL.Query()
+	if raw := query.Get("before"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			http.Error(w, "invalid before parameter", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		before = value
+	}
+	if raw := query.Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = value
+	}
+	return before, limit, true
+}
+
+// writeServiceError maps service errors to HTTP responses
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidReport),
+		errors.Is(err, service.ErrInvalidReason),
+		errors.Is(err, service.ErrCommentTooLong),
+		errors.Is(err, service.ErrSelfReport),
+		errors.Is(err, service.ErrInvalidStatus),
+		errors.Is(err, service.ErrSelfAction):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrProtectedUser):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrMessageNotFound),
+		errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrReportNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrReportClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Moderation operation failed: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON sends a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
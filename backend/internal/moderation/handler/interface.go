@@ -0,0 +1,26 @@
+// Package handler provides HTTP handlers for reporting and moderation operations
+package handler
+
+import "net/http"
+
+// Handler defines the reporting and moderation handling interface
+type Handler interface {
+	// CreateReport reports a message or a user
+	CreateReport(w http.ResponseWriter, r *http.Request)
+	// ListReports returns a page of the moderation queue
+	ListReports(w http.ResponseWriter, r *http.Request)
+	// GetReport returns a report with its actions
+	GetReport(w http.ResponseWriter, r *http.Request)
+	// CloseReport resolves or dismisses a report
+	CloseReport(w http.ResponseWriter, r *http.Request)
+	// HideMessage hides a reported message
+	HideMessage(w http.ResponseWriter, r *http.Request)
+	// DeleteMessage permanently deletes a reported message
+	DeleteMessage(w http.ResponseWriter, r *http.Request)
+	// WarnUser sends a warning to a user
+	WarnUser(w http.ResponseWriter, r *http.Request)
+	// SuspendUser suspends a user account
+	SuspendUser(w http.ResponseWriter, r *http.Request)
+	// ListActions returns a page of the moderation audit trail
+	ListActions(w http.ResponseWriter, r *http.Request)
+}
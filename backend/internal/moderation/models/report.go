@@ -0,0 +1,166 @@
+// Package models defines the data structures for abuse reports and moderation
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TargetType identifies what a report is about
+type TargetType string
+
+const (
+	TargetMessage TargetType = "message"
+	TargetUser    TargetType = "user"
+)
+
+// ReportStatus represents the review state of a report
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportResolved  ReportStatus = "resolved"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// IsValid checks if the status is one of the known statuses
+func (s ReportStatus) IsValid() bool {
+	return s == ReportOpen || s == ReportResolved || s == ReportDismissed
+}
+
+// Reason is the category a reporter picks for a report
+type Reason string
+
+const (
+	ReasonSpam          Reason = "spam"
+	ReasonHarassment    Reason = "harassment"
+	ReasonHateSpeech    Reason = "hate_speech"
+	ReasonSexualContent Reason = "sexual_content"
+	ReasonViolence      Reason = "violence"
+	ReasonImpersonation Reason = "impersonation"
+	ReasonOther         Reason = "other"
+
+	// ReasonContentFilter marks reports filed automatically by a message content filter.
+	// Users cannot choose it.
+	ReasonContentFilter Reason = "content_filter"
+)
+
+// IsValid checks if the reason is one users can choose
+func (r Reason) IsValid() bool {
+	switch r {
+	case ReasonSpam, ReasonHarassment, ReasonHateSpeech, ReasonSexualContent,
+		ReasonViolence, ReasonImpersonation, ReasonOther:
+		return true
+	}
+	return false
+}
+
+// ActionType identifies a moderation action recorded in the audit trail
+type ActionType string
+
+const (
+	ActionHideMessage   ActionType = "hide_message"
+	ActionDeleteMessage ActionType = "delete_message"
+	ActionWarnUser      ActionType = "warn_user"
+	ActionSuspendUser   ActionType = "suspend_user"
+	ActionResolveReport ActionType = "resolve_report"
+	ActionDismissReport ActionType = "dismiss_report"
+)
+
+// Report is a user's complaint about a message or another user
+type Report struct {
+	ID             int        `json:"id"`
+	ReporterID     *int       `json:"reporter_id,omitempty"`
+	TargetType     TargetType `json:"target_type"`
+	MessageID      *int       `json:"message_id,omitempty"`
+	ReportedUserID int        `json:"reported_user_id"`
+	Reason         Reason     `json:"reason"`
+	Comment        string     `json:"comment,omitempty"`
+	// Snapshot holds the reported message or profile as it was when reported
+	Snapshot   json.RawMessage `json:"snapshot"`
+	Status     ReportStatus    `json:"status"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty"`
+	ResolvedBy *int            `json:"resolved_by,omitempty"`
+}
+
+// MessageSnapshot is the stored copy of a reported message
+type MessageSnapshot struct {
+	ID         int       `json:"id"`
+	SenderID   int       `json:"sender_id"`
+	ReceiverID int       `json:"receiver_id"`
+	Content    string    `json:"content"`
+	MediaURL   string    `json:"media_url,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// UserSnapshot is the stored copy of a reported user's public profile
+type UserSnapshot struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+}
+
+// Action is an entry in the moderation audit trail
+type Action struct {
+	ID           int        `json:"id"`
+	ModeratorID  *int       `json:"moderator_id,omitempty"`
+	Action       ActionType `json:"action"`
+	ReportID     *int       `json:"report_id,omitempty"`
+	TargetUserID *int       `json:"target_user_id,omitempty"`
+	MessageID    *int       `json:"message_id,omitempty"`
+	Note         string     `json:"note,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ReportDetails is a report together with the actions taken on it
+type ReportDetails struct {
+	Report
+	Actions []Action `json:"actions"`
+}
+
+// CreateReportRequest represents the request body for reporting a message or user
+type CreateReportRequest struct {
+	MessageID int    `json:"message_id,omitempty"`
+	UserID    int    `json:"user_id,omitempty"`
+	Reason    Reason `json:"reason"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// ReportFilter selects a page of reports, newest first
+type ReportFilter struct {
+	Status ReportStatus
+	// BeforeID continues a previous page from the report with this ID
+	BeforeID int
+	Limit    int
+}
+
+// ActionFilter selects a page of the audit trail, newest first
+type ActionFilter struct {
+	TargetUserID int
+	BeforeID     int
+	Limit        int
+}
+
+// MessageActionRequest represents the request body for hiding or deleting a message
+type MessageActionRequest struct {
+	MessageID int    `json:"message_id"`
+	ReportID  int    `json:"report_id,omitempty"`
+	Note      string `json:"note,omitempty"`
+}
+
+// UserActionRequest represents the request body for warning or suspending a user
+type UserActionRequest struct {
+	UserID   int    `json:"user_id"`
+	ReportID int    `json:"report_id,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// ResolveReportRequest represents the request body for closing a report
+type ResolveReportRequest struct {
+	ReportID int          `json:"report_id"`
+	Status   ReportStatus `json:"status"`
+	Note     string       `json:"note,omitempty"`
+}
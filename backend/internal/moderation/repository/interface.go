@@ -0,0 +1,44 @@
+// Package repository provides data access for abuse reports and moderation actions
+package repository
+
+import (
+	"errors"
+
+	"github.com/Mousa96/chatting-service/internal/moderation/models"
+)
+
+var (
+	// ErrNotFound is returned when a report, message or user does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a report has already been closed
+	ErrConflict = errors.New("conflict")
+)
+
+// Repository defines the moderation data access interface
+type Repository interface {
+	// GetMessageSnapshot returns a copy of a message, including hidden ones
+	GetMessageSnapshot(messageID int) (*models.MessageSnapshot, error)
+	// GetUserSnapshot returns a copy of a user's public profile
+	GetUserSnapshot(userID int) (*models.UserSnapshot, error)
+
+	// CreateReport stores a new open report and fills in its ID, status and creation time
+	CreateReport(report *models.Report) error
+	// GetReport retrieves a report by its ID
+	GetReport(reportID int) (*models.Report, error)
+	// ListReports returns a page of reports, newest first
+	ListReports(filter models.ReportFilter) ([]models.Report, error)
+	// CloseReport marks an open report resolved or dismissed by moderatorID
+	CloseReport(reportID, moderatorID int, status models.ReportStatus) (*models.Report, error)
+
+	// HideMessage hides a message from conversation history
+	HideMessage(messageID int) error
+	// DeleteMessage permanently removes a message
+	DeleteMessage(messageID int) error
+
+	// RecordAction appends an action to the audit trail and fills in its ID and creation time
+	RecordAction(action *models.Action) error
+	// ListActions returns a page of the audit trail, newest first
+	ListActions(filter models.ActionFilter) ([]models.Action, error)
+	// ListReportActions returns the actions taken on a report, oldest first
+	ListReportActions(reportID int) ([]models.Action, error)
+}
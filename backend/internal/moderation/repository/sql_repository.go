@@ -0,0 +1,255 @@
+// Package repository implements the moderation repository interface
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Mousa96/chatting-service/internal/moderation/models"
+)
+
+// reportColumns lists the columns read by scanReport, in order
+const reportColumns = `id, reporter_id, target_type, message_id, reported_user_id, reason,
+        COALESCE(comment, ''), snapshot, status, created_at, resolved_at, resolved_by`
+
+// actionColumns lists the columns read by scanAction, in order
+const actionColumns = "id, moderator_id, action, report_id, target_user_id, message_id, COALESCE(note, ''), created_at"
+
+// SQLModerationRepository provides a PostgreSQL implementation of Repository
+type SQLModerationRepository struct {
+	db *sql.DB
+}
+
+// NewModerationRepository creates a new SQLModerationRepository instance
+func NewModerationRepository(db *sql.DB) Repository {
+	return &SQLModerationRepository{db: db}
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReport(row rowScanner) (*models.Report, error) {
+	var report models.Report
+	var reporterID, messageID, resolvedBy sql.NullInt64
+	var resolvedAt sql.NullTime
+	var snapshot []byte
+	err := row.Scan(
+		&report.ID, &reporterID, &report.TargetType, &messageID, &report.ReportedUserID, &report.Reason,
+		&report.Comment, &snapshot, &report.Status, &report.CreatedAt, &resolvedAt, &resolvedBy,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.ReporterID = intPtr(reporterID)
+	report.MessageID = intPtr(messageID)
+	report.ResolvedBy = intPtr(resolvedBy)
+	report.Snapshot = snapshot
+	if resolvedAt.Valid {
+		report.ResolvedAt = &resolvedAt.Time
+	}
+	return &report, nil
+}
+
+func scanAction(row rowScanner) (*models.Action, error) {
+	var action models.Action
+	var moderatorID, reportID, targetUserID, messageID sql.NullInt64
+	err := row.Scan(
+		&action.ID, &moderatorID, &action.Action, &reportID, &targetUserID, &messageID,
+		&action.Note, &action.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	action.ModeratorID = intPtr(moderatorID)
+	action.ReportID = intPtr(reportID)
+	action.TargetUserID = intPtr(targetUserID)
+	action.MessageID = intPtr(messageID)
+	return &action, nil
+}
+
+func (r *SQLModerationRepository) GetMessageSnapshot(messageID int) (*models.MessageSnapshot, error) {
+	var msg models.MessageSnapshot
+	err := r.db.QueryRow(
+		`SELECT id, sender_id, receiver_id, content, COALESCE(media_url, ''), created_at
+        FROM messages WHERE id = $1`,
+		messageID,
+	).Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content, &msg.MediaURL, &msg.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return &msg, nil
+}
+
+func (r *SQLModerationRepository) GetUserSnapshot(userID int) (*models.UserSnapshot, error) {
+	var user models.UserSnapshot
+	err := r.db.QueryRow(
+		`SELECT id, username, COALESCE(display_name, ''), COALESCE(avatar_url, ''), COALESCE(bio, '')
+        FROM users WHERE id = $1`,
+		userID,
+	).Scan(&user.ID, &user.Username, &user.DisplayName, &user.AvatarURL, &user.Bio)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+func (r *SQLModerationRepository) CreateReport(report *models.Report) error {
+	err := r.db.QueryRow(
+		`INSERT INTO reports (reporter_id, target_type, message_id, reported_user_id, reason, comment, snapshot)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+        RETURNING id, status, created_at`,
+		report.ReporterID, report.TargetType, report.MessageID, report.ReportedUserID,
+		report.Reason, report.Comment, []byte(report.Snapshot),
+	).Scan(&report.ID, &report.Status, &report.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLModerationRepository) GetReport(reportID int) (*models.Report, error) {
+	return scanReport(r.db.QueryRow("SELECT "+reportColumns+" FROM reports WHERE id = $1", reportID))
+}
+
+func (r *SQLModerationRepository) ListReports(filter models.ReportFilter) ([]models.Report, error) {
+	rows, err := r.db.Query(
+		"SELECT "+reportColumns+` FROM reports
+        WHERE status = $1 AND ($2 = 0 OR id < $2)
+        ORDER BY id DESC
+        LIMIT $3`,
+		filter.Status, filter.BeforeID, filter.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, rows.Err()
+}
+
+func (r *SQLModerationRepository) CloseReport(reportID, moderatorID int, status models.ReportStatus) (*models.Report, error) {
+	report, err := scanReport(r.db.QueryRow(
+		`UPDATE reports SET status = $2, resolved_at = CURRENT_TIMESTAMP, resolved_by = $3
+        WHERE id = $1 AND status = 'open'
+        RETURNING `+reportColumns,
+		reportID, status, moderatorID,
+	))
+	if errors.Is(err, ErrNotFound) {
+		if _, getErr := r.GetReport(reportID); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to close report: %w", err)
+	}
+	return report, nil
+}
+
+func (r *SQLModerationRepository) HideMessage(messageID int) error {
+	result, err := r.db.Exec(
+		"UPDATE messages SET hidden_at = COALESCE(hidden_at, CURRENT_TIMESTAMP) WHERE id = $1",
+		messageID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to hide message: %w", err)
+	}
+	return checkAffected(result)
+}
+
+func (r *SQLModerationRepository) DeleteMessage(messageID int) error {
+	result, err := r.db.Exec("DELETE FROM messages WHERE id = $1", messageID)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	return checkAffected(result)
+}
+
+func (r *SQLModerationRepository) RecordAction(action *models.Action) error {
+	err := r.db.QueryRow(
+		`INSERT INTO moderation_actions (moderator_id, action, report_id, target_user_id, message_id, note)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+        RETURNING id, created_at`,
+		action.ModeratorID, action.Action, action.ReportID, action.TargetUserID, action.MessageID, action.Note,
+	).Scan(&action.ID, &action.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record moderation action: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLModerationRepository) ListActions(filter models.ActionFilter) ([]models.Action, error) {
+	return r.queryActions(
+		"SELECT "+actionColumns+` FROM moderation_actions
+        WHERE ($1 = 0 OR target_user_id = $1) AND ($2 = 0 OR id < $2)
+        ORDER BY id DESC
+        LIMIT $3`,
+		filter.TargetUserID, filter.BeforeID, filter.Limit,
+	)
+}
+
+func (r *SQLModerationRepository) ListReportActions(reportID int) ([]models.Action, error) {
+	return r.queryActions(
+		"SELECT "+actionColumns+" FROM moderation_actions WHERE report_id = $1 ORDER BY id",
+		reportID,
+	)
+}
+
+func (r *SQLModerationRepository) queryActions(query string, args ...interface{}) ([]models.Action, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list moderation actions: %w", err)
+	}
+	defer rows.Close()
+
+	actions := []models.Action{}
+	for rows.Next() {
+		action, err := scanAction(rows)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, *action)
+	}
+	return actions, rows.Err()
+}
+
+// intPtr converts a nullable column to an optional int
+func intPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+// checkAffected returns ErrNotFound when a statement matched no rows
+func checkAffected(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
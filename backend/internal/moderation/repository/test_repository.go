@@ -0,0 +1,211 @@
+// Package repository provides test implementations of the Repository interface
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/moderation/models"
+)
+
+// TestModerationRepository provides an in-memory implementation of Repository for testing
+type TestModerationRepository struct {
+	users    map[int]models.UserSnapshot
+	messages map[int]models.MessageSnapshot
+	hidden   map[int]bool
+	reports  map[int]*models.Report
+	actions  []models.Action
+	mu       sync.RWMutex
+	nextID   int
+}
+
+// NewTestModerationRepository creates a new instance of TestModerationRepository
+func NewTestModerationRepository() *TestModerationRepository {
+	return &TestModerationRepository{
+		users:    make(map[int]models.UserSnapshot),
+		messages: make(map[int]models.MessageSnapshot),
+		hidden:   make(map[int]bool),
+		reports:  make(map[int]*models.Report),
+		nextID:   1,
+	}
+}
+
+// AddUser registers a user that can be reported
+func (r *TestModerationRepository) AddUser(userID int, username string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[userID] = models.UserSnapshot{ID: userID, Username: username}
+}
+
+// AddMessage registers a message that can be reported
+func (r *TestModerationRepository) AddMessage(messageID, senderID, receiverID int, content string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages[messageID] = models.MessageSnapshot{
+		ID:         messageID,
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Content:    content,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// IsHidden reports whether a message has been hidden
+func (r *TestModerationRepository) IsHidden(messageID int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hidden[messageID]
+}
+
+// HasMessage reports whether a message still exists
+func (r *TestModerationRepository) HasMessage(messageID int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.messages[messageID]
+	return ok
+}
+
+func (r *TestModerationRepository) GetMessageSnapshot(messageID int) (*models.MessageSnapshot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	msg, ok := r.messages[messageID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &msg, nil
+}
+
+func (r *TestModerationRepository) GetUserSnapshot(userID int) (*models.UserSnapshot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *TestModerationRepository) CreateReport(report *models.Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report.ID = r.nextID
+	report.Status = models.ReportOpen
+	report.CreatedAt = time.Now()
+	r.nextID++
+
+	stored := *report
+	r.reports[report.ID] = &stored
+	return nil
+}
+
+func (r *TestModerationRepository) GetReport(reportID int) (*models.Report, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	report, ok := r.reports[reportID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *report
+	return &copied, nil
+}
+
+func (r *TestModerationRepository) ListReports(filter models.ReportFilter) ([]models.Report, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reports := []models.Report{}
+	for _, report := range r.reports {
+		if report.Status != filter.Status || (filter.BeforeID > 0 && report.ID >= filter.BeforeID) {
+			continue
+		}
+		reports = append(reports, *report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ID > reports[j].ID })
+	if len(reports) > filter.Limit {
+		reports = reports[:filter.Limit]
+	}
+	return reports, nil
+}
+
+func (r *TestModerationRepository) CloseReport(reportID, moderatorID int, status models.ReportStatus) (*models.Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report, ok := r.reports[reportID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if report.Status != models.ReportOpen {
+		return nil, ErrConflict
+	}
+	now := time.Now()
+	report.Status = status
+	report.ResolvedAt = &now
+	report.ResolvedBy = &moderatorID
+	copied := *report
+	return &copied, nil
+}
+
+func (r *TestModerationRepository) HideMessage(messageID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.messages[messageID]; !ok {
+		return ErrNotFound
+	}
+	r.hidden[messageID] = true
+	return nil
+}
+
+func (r *TestModerationRepository) DeleteMessage(messageID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.messages[messageID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.messages, messageID)
+	delete(r.hidden, messageID)
+	return nil
+}
+
+func (r *TestModerationRepository) RecordAction(action *models.Action) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	action.ID = len(r.actions) + 1
+	action.CreatedAt = time.Now()
+	r.actions = append(r.actions, *action)
+	return nil
+}
+
+func (r *TestModerationRepository) ListActions(filter models.ActionFilter) ([]models.Action, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	actions := []models.Action{}
+	for i := len(r.actions) - 1; i >= 0 && len(actions) < filter.Limit; i-- {
+		action := r.actions[i]
+		if filter.TargetUserID > 0 && (action.TargetUserID == nil || *action.TargetUserID != filter.TargetUserID) {
+			continue
+		}
+		if filter.BeforeID > 0 && action.ID >= filter.BeforeID {
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+func (r *TestModerationRepository) ListReportActions(reportID int) ([]models.Action, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	actions := []models.Action{}
+	for _, action := range r.actions {
+		if action.ReportID != nil && *action.ReportID == reportID {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	msgModels "github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/moderation/models"
+	"github.com/Mousa96/chatting-service/internal/moderation/repository"
+)
+
+// FlagRecorder files a report for each message a content filter flags, so it shows up
+// in the moderation queue. It satisfies the message service's FlagRecorder interface.
+type FlagRecorder struct {
+	repo repository.Repository
+}
+
+// NewFlagRecorder creates a FlagRecorder backed by the moderation repository
+func NewFlagRecorder(repo repository.Repository) *FlagRecorder {
+	return &FlagRecorder{repo: repo}
+}
+
+// FlagMessage files a report without a reporter for a stored message
+func (r *FlagRecorder) FlagMessage(msg *msgModels.Message, filter, reason string) error {
+	snapshot, err := json.Marshal(models.MessageSnapshot{
+		ID:         msg.ID,
+		SenderID:   msg.SenderID,
+		ReceiverID: msg.ReceiverID,
+		Content:    msg.Content,
+		MediaURL:   msg.MediaURL,
+		CreatedAt:  msg.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode report snapshot: %w", err)
+	}
+
+	return r.repo.CreateReport(&models.Report{
+		TargetType:     models.TargetMessage,
+		MessageID:      &msg.ID,
+		ReportedUserID: msg.SenderID,
+		Reason:         models.ReasonContentFilter,
+		Comment:        fmt.Sprintf("%s: %s", filter, reason),
+		Snapshot:       snapshot,
+	})
+}
@@ -0,0 +1,44 @@
+// Package service provides the business logic for abuse reports and moderation
+package service
+
+import (
+	"github.com/Mousa96/chatting-service/internal/moderation/models"
+	userModels "github.com/Mousa96/chatting-service/internal/user/models"
+)
+
+// Service defines the reporting and moderation operations interface
+type Service interface {
+	// CreateReport files a report about a message the reporter took part in, or about another user.
+	// A snapshot of the reported content is stored with the report.
+	CreateReport(reporterID int, req *models.CreateReportRequest) (*models.Report, error)
+	// ListReports returns a page of reports with the given status, newest first
+	ListReports(filter models.ReportFilter) ([]models.Report, error)
+	// GetReport returns a report together with the actions taken on it
+	GetReport(reportID int) (*models.ReportDetails, error)
+	// CloseReport resolves or dismisses an open report without any other action
+	CloseReport(moderatorID int, req *models.ResolveReportRequest) (*models.Report, error)
+
+	// HideMessage hides a message from both participants and removes it from their open clients
+	HideMessage(moderatorID int, req *models.MessageActionRequest) error
+	// DeleteMessage permanently removes a message and removes it from the participants' open clients
+	DeleteMessage(moderatorID int, req *models.MessageActionRequest) error
+	// WarnUser sends a warning to a user
+	WarnUser(moderatorID int, req *models.UserActionRequest) error
+	// SuspendUser suspends a regular user account and closes its live connection
+	SuspendUser(moderatorID int, req *models.UserActionRequest) error
+
+	// ListActions returns a page of the moderation audit trail, newest first
+	ListActions(filter models.ActionFilter) ([]models.Action, error)
+}
+
+// Accounts is implemented by the user service to look up and suspend users
+type Accounts interface {
+	GetUserByID(id int) (*userModels.User, error)
+	SuspendUser(userID int, suspended bool) error
+}
+
+// Realtime is implemented by the WebSocket service to reach connected users
+type Realtime interface {
+	NotifyUser(userID int, eventType string, payload interface{}) bool
+	DisconnectUser(userID int) bool
+}
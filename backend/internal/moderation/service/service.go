@@ -0,0 +1,387 @@
+// Package service implements the moderation business logic
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
+	"github.com/Mousa96/chatting-service/internal/moderation/models"
+	"github.com/Mousa96/chatting-service/internal/moderation/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+)
+
+const (
+	// maxCommentLength limits the free text a reporter or moderator can attach
+	maxCommentLength = 1000
+	defaultPageSize  = 50
+	maxPageSize      = 100
+	// defaultWarning is sent when a moderator warns a user without a note
+	defaultWarning = "A moderator has warned you about your behaviour. Please follow the community guidelines."
+)
+
+var (
+	// ErrInvalidReport is returned when a report names neither or both of a message and a user
+	ErrInvalidReport = errors.New("a report must name either a message or a user")
+	// ErrInvalidReason is returned for an unknown report reason
+	ErrInvalidReason = errors.New("invalid report reason")
+	// ErrCommentTooLong is returned when a comment or note exceeds maxCommentLength
+	ErrCommentTooLong = fmt.Errorf("comment must be at most %d characters", maxCommentLength)
+	// ErrSelfReport is returned when a user reports themselves or their own message
+	ErrSelfReport = errors.New("cannot report yourself")
+	// ErrMessageNotFound is returned when a message does not exist or the reporter did not receive it
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrUserNotFound is returned when a user does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrReportNotFound is returned when a report does not exist
+	ErrReportNotFound = errors.New("report not found")
+	// ErrReportClosed is returned when closing a report that was already resolved or dismissed
+	ErrReportClosed = errors.New("report is already closed")
+	// ErrInvalidStatus is returned for an unknown report status or when closing a report as open
+	ErrInvalidStatus = errors.New("invalid report status")
+	// ErrSelfAction is returned when a moderator targets their own account
+	ErrSelfAction = errors.New("cannot perform this action on your own account")
+	// ErrProtectedUser is returned when a moderator suspends a moderator or administrator
+	ErrProtectedUser = errors.New("only regular users can be suspended by moderators")
+)
+
+// ModerationService provides the implementation of the Service interface
+type ModerationService struct {
+	repo     repository.Repository
+	accounts Accounts
+	realtime Realtime
+}
+
+// Option configures optional ModerationService dependencies
+type Option func(*ModerationService)
+
+// WithRealtime sets the connection manager used to remove hidden messages from
+// open clients, deliver warnings and disconnect suspended users
+func WithRealtime(realtime Realtime) Option {
+	return func(s *ModerationService) {
+		s.realtime = realtime
+	}
+}
+
+// NewModerationService creates a new ModerationService instance
+func NewModerationService(repo repository.Repository, accounts Accounts, opts ...Option) Service {
+	s := &ModerationService{repo: repo, accounts: accounts}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *ModerationService) CreateReport(reporterID int, req *models.CreateReportRequest) (*models.Report, error) {
+	if (req.MessageID > 0) == (req.UserID > 0) {
+		return nil, ErrInvalidReport
+	}
+	if !req.Reason.IsValid() {
+		return nil, ErrInvalidReason
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if len([]rune(comment)) > maxCommentLength {
+		return nil, ErrCommentTooLong
+	}
+
+	report := &models.Report{
+		ReporterID: &reporterID,
+		Reason:     req.Reason,
+		Comment:    comment,
+	}
+
+	var snapshot interface{}
+	if req.MessageID > 0 {
+		msg, err := s.repo.GetMessageSnapshot(req.MessageID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if msg.SenderID == reporterID {
+			return nil, ErrSelfReport
+		}
+		// Only the recipient may report a message; anyone else learns nothing about it
+		if msg.ReceiverID != reporterID {
+			return nil, ErrMessageNotFound
+		}
+		report.TargetType = models.TargetMessage
+		report.MessageID = &msg.ID
+		report.ReportedUserID = msg.SenderID
+		snapshot = msg
+	} else {
+		if req.UserID == reporterID {
+			return nil, ErrSelfReport
+		}
+		user, err := s.repo.GetUserSnapshot(req.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.TargetType = models.TargetUser
+		report.ReportedUserID = user.ID
+		snapshot = user
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report snapshot: %w", err)
+	}
+	report.Snapshot = data
+
+	if err := s.repo.CreateReport(report); err != nil {
+		return nil, err
+	}
+	log.Printf("User %d reported %s %d for %s", reporterID, report.TargetType, report.ReportedUserID, report.Reason)
+	return report, nil
+}
+
+func (s *ModerationService) ListReports(filter models.ReportFilter) ([]models.Report, error) {
+	if filter.Status == "" {
+		filter.Status = models.ReportOpen
+	}
+	if !filter.Status.IsValid() {
+		return nil, ErrInvalidStatus
+	}
+	filter.Limit = pageSize(filter.Limit)
+	return s.repo.ListReports(filter)
+}
+
+func (s *ModerationService) GetReport(reportID int) (*models.ReportDetails, error) {
+	report, err := s.repo.GetReport(reportID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := s.repo.ListReportActions(reportID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ReportDetails{Report: *report, Actions: actions}, nil
+}
+
+func (s *ModerationService) CloseReport(moderatorID int, req *models.ResolveReportRequest) (*models.Report, error) {
+	var action models.ActionType
+	switch req.Status {
+	case models.ReportResolved:
+		action = models.ActionResolveReport
+	case models.ReportDismissed:
+		action = models.ActionDismissReport
+	default:
+		return nil, ErrInvalidStatus
+	}
+	if err := checkNote(req.Note); err != nil {
+		return nil, err
+	}
+
+	report, err := s.repo.CloseReport(req.ReportID, moderatorID, req.Status)
+	if err != nil {
+		return nil, closeError(err)
+	}
+
+	err = s.record(&models.Action{
+		ModeratorID:  &moderatorID,
+		Action:       action,
+		ReportID:     &report.ID,
+		TargetUserID: &report.ReportedUserID,
+		MessageID:    report.MessageID,
+		Note:         strings.TrimSpace(req.Note),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s *ModerationService) HideMessage(moderatorID int, req *models.MessageActionRequest) error {
+	return s.removeMessage(moderatorID, req, models.ActionHideMessage, s.repo.HideMessage)
+}
+
+func (s *ModerationService) DeleteMessage(moderatorID int, req *models.MessageActionRequest) error {
+	return s.removeMessage(moderatorID, req, models.ActionDeleteMessage, s.repo.DeleteMessage)
+}
+
+// removeMessage applies a hide or delete, tells both participants' clients to drop the
+// message, resolves the linked report and records the action
+func (s *ModerationService) removeMessage(moderatorID int, req *models.MessageActionRequest, action models.ActionType, apply func(int) error) error {
+	if err := checkNote(req.Note); err != nil {
+		return err
+	}
+	if err := s.checkReport(req.ReportID); err != nil {
+		return err
+	}
+
+	msg, err := s.repo.GetMessageSnapshot(req.MessageID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := apply(msg.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrMessageNotFound
+		}
+		return err
+	}
+
+	event := wsModels.MessageHiddenEvent{MessageID: msg.ID}
+	s.notify(msg.SenderID, wsModels.EventMessageHidden, event)
+	s.notify(msg.ReceiverID, wsModels.EventMessageHidden, event)
+
+	return s.finish(moderatorID, req.ReportID, &models.Action{
+		Action:       action,
+		TargetUserID: &msg.SenderID,
+		MessageID:    &msg.ID,
+		Note:         strings.TrimSpace(req.Note),
+	})
+}
+
+func (s *ModerationService) WarnUser(moderatorID int, req *models.UserActionRequest) error {
+	if err := s.checkUserAction(moderatorID, req); err != nil {
+		return err
+	}
+
+	note := strings.TrimSpace(req.Note)
+	message := note
+	if message == "" {
+		message = defaultWarning
+	}
+	s.notify(req.UserID, wsModels.EventModerationWarning, wsModels.ModerationWarningEvent{Message: message})
+
+	return s.finish(moderatorID, req.ReportID, &models.Action{
+		Action:       models.ActionWarnUser,
+		TargetUserID: &req.UserID,
+		Note:         note,
+	})
+}
+
+func (s *ModerationService) SuspendUser(moderatorID int, req *models.UserActionRequest) error {
+	if err := s.checkUserAction(moderatorID, req); err != nil {
+		return err
+	}
+
+	user, err := s.accounts.GetUserByID(req.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.Role != "" && authModels.Role(user.Role) != authModels.RoleUser {
+		return ErrProtectedUser
+	}
+
+	if err := s.accounts.SuspendUser(req.UserID, true); err != nil {
+		return fmt.Errorf("failed to suspend user: %w", err)
+	}
+	if s.realtime != nil {
+		s.realtime.DisconnectUser(req.UserID)
+	}
+
+	return s.finish(moderatorID, req.ReportID, &models.Action{
+		Action:       models.ActionSuspendUser,
+		TargetUserID: &req.UserID,
+		Note:         strings.TrimSpace(req.Note),
+	})
+}
+
+func (s *ModerationService) ListActions(filter models.ActionFilter) ([]models.Action, error) {
+	filter.Limit = pageSize(filter.Limit)
+	return s.repo.ListActions(filter)
+}
+
+// checkUserAction validates a warn or suspend request before anything changes
+func (s *ModerationService) checkUserAction(moderatorID int, req *models.UserActionRequest) error {
+	if req.UserID == moderatorID {
+		return ErrSelfAction
+	}
+	if err := checkNote(req.Note); err != nil {
+		return err
+	}
+	if err := s.checkReport(req.ReportID); err != nil {
+		return err
+	}
+
+	_, err := s.repo.GetUserSnapshot(req.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// checkReport verifies that an optional linked report exists
+func (s *ModerationService) checkReport(reportID int) error {
+	if reportID == 0 {
+		return nil
+	}
+	_, err := s.repo.GetReport(reportID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrReportNotFound
+	}
+	return err
+}
+
+// finish resolves the linked report, if it is still open, and records the action
+func (s *ModerationService) finish(moderatorID, reportID int, action *models.Action) error {
+	action.ModeratorID = &moderatorID
+	if reportID > 0 {
+		action.ReportID = &reportID
+		_, err := s.repo.CloseReport(reportID, moderatorID, models.ReportResolved)
+		if err != nil && !errors.Is(err, repository.ErrConflict) {
+			return fmt.Errorf("failed to resolve report: %w", err)
+		}
+	}
+	return s.record(action)
+}
+
+func (s *ModerationService) record(action *models.Action) error {
+	if err := s.repo.RecordAction(action); err != nil {
+		return err
+	}
+	log.Printf("Moderator %d performed %s", *action.ModeratorID, action.Action)
+	return nil
+}
+
+func (s *ModerationService) notify(userID int, eventType string, payload interface{}) {
+	if s.realtime != nil {
+		s.realtime.NotifyUser(userID, eventType, payload)
+	}
+}
+
+// closeError maps repository errors from closing a report to service errors
+func closeError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrReportNotFound
+	case errors.Is(err, repository.ErrConflict):
+		return ErrReportClosed
+	default:
+		return err
+	}
+}
+
+func checkNote(note string) error {
+	if len([]rune(strings.TrimSpace(note))) > maxCommentLength {
+		return ErrCommentTooLong
+	}
+	return nil
+}
+
+// pageSize applies the default and maximum page sizes
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	msgModels "github.com/Mousa96/chatting-service/internal/message/models"
+	"github.com/Mousa96/chatting-service/internal/moderation/models"
+	"github.com/Mousa96/chatting-service/internal/moderation/repository"
+	userModels "github.com/Mousa96/chatting-service/internal/user/models"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRealtime struct {
+	mock.Mock
+}
+
+func (m *mockRealtime) NotifyUser(userID int, eventType string, payload interface{}) bool {
+	args := m.Called(userID, eventType, payload)
+	return args.Bool(0)
+}
+
+func (m *mockRealtime) DisconnectUser(userID int) bool {
+	args := m.Called(userID)
+	return args.Bool(0)
+}
+
+// fakeAccounts keeps user roles and suspensions in memory
+type fakeAccounts struct {
+	roles     map[int]string
+	suspended map[int]bool
+}
+
+func (a *fakeAccounts) GetUserByID(id int) (*userModels.User, error) {
+	role, ok := a.roles[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return &userModels.User{ID: id, Role: role}, nil
+}
+
+func (a *fakeAccounts) SuspendUser(userID int, suspended bool) error {
+	a.suspended[userID] = suspended
+	return nil
+}
+
+type fixture struct {
+	repo     *repository.TestModerationRepository
+	accounts *fakeAccounts
+	realtime *mockRealtime
+	service  Service
+}
+
+// newFixture sets up alice (1) and bob (2) as regular users, carol (3) as a moderator,
+// and message 10 sent by bob to alice
+func newFixture() *fixture {
+	repo := repository.NewTestModerationRepository()
+	repo.AddUser(1, "alice")
+	repo.AddUser(2, "bob")
+	repo.AddUser(3, "carol")
+	repo.AddMessage(10, 2, 1, "spam spam spam")
+
+	accounts := &fakeAccounts{
+		roles:     map[int]string{1: "user", 2: "user", 3: "moderator"},
+		suspended: map[int]bool{},
+	}
+	realtime := new(mockRealtime)
+	realtime.On("NotifyUser", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	realtime.On("DisconnectUser", mock.Anything).Return(true)
+
+	return &fixture{
+		repo:     repo,
+		accounts: accounts,
+		realtime: realtime,
+		service:  NewModerationService(repo, accounts, WithRealtime(realtime)),
+	}
+}
+
+func TestCreateReport(t *testing.T) {
+	tests := []struct {
+		name        string
+		reporterID  int
+		req         models.CreateReportRequest
+		expectedErr error
+	}{
+		{
+			name:       "Report a received message",
+			reporterID: 1,
+			req:        models.CreateReportRequest{MessageID: 10, Reason: models.ReasonSpam, Comment: "keeps sending this"},
+		},
+		{
+			name:       "Report a user",
+			reporterID: 1,
+			req:        models.CreateReportRequest{UserID: 2, Reason: models.ReasonHarassment},
+		},
+		{
+			name:        "Own message",
+			reporterID:  2,
+			req:         models.CreateReportRequest{MessageID: 10, Reason: models.ReasonSpam},
+			expectedErr: ErrSelfReport,
+		},
+		{
+			name:        "Message the reporter did not receive",
+			reporterID:  3,
+			req:         models.CreateReportRequest{MessageID: 10, Reason: models.ReasonSpam},
+			expectedErr: ErrMessageNotFound,
+		},
+		{
+			name:        "Self",
+			reporterID:  1,
+			req:         models.CreateReportRequest{UserID: 1, Reason: models.ReasonOther},
+			expectedErr: ErrSelfReport,
+		},
+		{
+			name:        "Unknown user",
+			reporterID:  1,
+			req:         models.CreateReportRequest{UserID: 99, Reason: models.ReasonOther},
+			expectedErr: ErrUserNotFound,
+		},
+		{
+			name:        "Both targets",
+			reporterID:  1,
+			req:         models.CreateReportRequest{MessageID: 10, UserID: 2, Reason: models.ReasonSpam},
+			expectedErr: ErrInvalidReport,
+		},
+		{
+			name:        "Unknown reason",
+			reporterID:  1,
+			req:         models.CreateReportRequest{UserID: 2, Reason: "boring"},
+			expectedErr: ErrInvalidReason,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+
+			report, err := f.service.CreateReport(tt.reporterID, &tt.req)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, models.ReportOpen, report.Status)
+			assert.Equal(t, 2, report.ReportedUserID)
+			assert.NotEmpty(t, report.Snapshot)
+		})
+	}
+}
+
+func TestReportSnapshotSurvivesDeletion(t *testing.T) {
+	f := newFixture()
+
+	report, err := f.service.CreateReport(1, &models.CreateReportRequest{MessageID: 10, Reason: models.ReasonSpam})
+	require.NoError(t, err)
+
+	require.NoError(t, f.service.DeleteMessage(3, &models.MessageActionRequest{MessageID: 10, ReportID: report.ID}))
+	assert.False(t, f.repo.HasMessage(10))
+
+	details, err := f.service.GetReport(report.ID)
+	require.NoError(t, err)
+	var snapshot models.MessageSnapshot
+	require.NoError(t, json.Unmarshal(details.Snapshot, &snapshot))
+	assert.Equal(t, "spam spam spam", snapshot.Content)
+	assert.Equal(t, models.ReportResolved, details.Status)
+	require.Len(t, details.Actions, 1)
+	assert.Equal(t, models.ActionDeleteMessage, details.Actions[0].Action)
+}
+
+func TestHideMessage(t *testing.T) {
+	f := newFixture()
+
+	report, err := f.service.CreateReport(1, &models.CreateReportRequest{MessageID: 10, Reason: models.ReasonSpam})
+	require.NoError(t, err)
+
+	err = f.service.HideMessage(3, &models.MessageActionRequest{MessageID: 10, ReportID: report.ID, Note: "spam"})
+	require.NoError(t, err)
+	assert.True(t, f.repo.IsHidden(10))
+
+	// Both participants' clients are told to drop the message
+	event := wsModels.MessageHiddenEvent{MessageID: 10}
+	f.realtime.AssertCalled(t, "NotifyUser", 1, wsModels.EventMessageHidden, event)
+	f.realtime.AssertCalled(t, "NotifyUser", 2, wsModels.EventMessageHidden, event)
+
+	open, err := f.service.ListReports(models.ReportFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, open)
+
+	actions, err := f.service.ListActions(models.ActionFilter{TargetUserID: 2})
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, models.ActionHideMessage, actions[0].Action)
+	assert.Equal(t, 3, *actions[0].ModeratorID)
+	assert.Equal(t, "spam", actions[0].Note)
+
+	err = f.service.HideMessage(3, &models.MessageActionRequest{MessageID: 99})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+}
+
+func TestSuspendUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		moderatorID int
+		userID      int
+		expectedErr error
+	}{
+		{
+			name:        "Regular user",
+			moderatorID: 3,
+			userID:      2,
+		},
+		{
+			name:        "Self",
+			moderatorID: 3,
+			userID:      3,
+			expectedErr: ErrSelfAction,
+		},
+		{
+			name:        "Moderator",
+			moderatorID: 1,
+			userID:      3,
+			expectedErr: ErrProtectedUser,
+		},
+		{
+			name:        "Unknown user",
+			moderatorID: 3,
+			userID:      99,
+			expectedErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+
+			err := f.service.SuspendUser(tt.moderatorID, &models.UserActionRequest{UserID: tt.userID})
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.False(t, f.accounts.suspended[tt.userID])
+				f.realtime.AssertNotCalled(t, "DisconnectUser", tt.userID)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, f.accounts.suspended[tt.userID])
+			f.realtime.AssertCalled(t, "DisconnectUser", tt.userID)
+		})
+	}
+}
+
+func TestWarnUser(t *testing.T) {
+	f := newFixture()
+
+	require.NoError(t, f.service.WarnUser(3, &models.UserActionRequest{UserID: 2}))
+	f.realtime.AssertCalled(t, "NotifyUser", 2, wsModels.EventModerationWarning,
+		wsModels.ModerationWarningEvent{Message: defaultWarning})
+
+	actions, err := f.service.ListActions(models.ActionFilter{})
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, models.ActionWarnUser, actions[0].Action)
+}
+
+func TestCloseReport(t *testing.T) {
+	f := newFixture()
+
+	report, err := f.service.CreateReport(1, &models.CreateReportRequest{UserID: 2, Reason: models.ReasonOther})
+	require.NoError(t, err)
+
+	_, err = f.service.CloseReport(3, &models.ResolveReportRequest{ReportID: report.ID, Status: models.ReportOpen})
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+
+	closed, err := f.service.CloseReport(3, &models.ResolveReportRequest{ReportID: report.ID, Status: models.ReportDismissed})
+	require.NoError(t, err)
+	assert.Equal(t, models.ReportDismissed, closed.Status)
+	assert.Equal(t, 3, *closed.ResolvedBy)
+
+	_, err = f.service.CloseReport(3, &models.ResolveReportRequest{ReportID: report.ID, Status: models.ReportResolved})
+	assert.ErrorIs(t, err, ErrReportClosed)
+
+	dismissed, err := f.service.ListReports(models.ReportFilter{Status: models.ReportDismissed})
+	require.NoError(t, err)
+	assert.Len(t, dismissed, 1)
+}
+
+func TestFlagRecorder(t *testing.T) {
+	f := newFixture()
+	recorder := NewFlagRecorder(f.repo)
+
+	err := recorder.FlagMessage(&msgModels.Message{ID: 10, SenderID: 2, ReceiverID: 1, Content: "heck"},
+		"banned_words", "message contains a banned word")
+	require.NoError(t, err)
+
+	reports, err := f.service.ListReports(models.ReportFilter{})
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Nil(t, reports[0].ReporterID)
+	assert.Equal(t, models.ReasonContentFilter, reports[0].Reason)
+	assert.Equal(t, 2, reports[0].ReportedUserID)
+	assert.Equal(t, "banned_words: message contains a banned word", reports[0].Comment)
+}
@@ -5,8 +5,14 @@ import (
 	"net/http"
 
 	_ "github.com/Mousa96/chatting-service/docs" // Import swagger docs
+	adminHandler "github.com/Mousa96/chatting-service/internal/admin/handler"
 	authHandler "github.com/Mousa96/chatting-service/internal/auth/handler"
+	contactHandler "github.com/Mousa96/chatting-service/internal/contact/handler"
+	mediaHandler "github.com/Mousa96/chatting-service/internal/media/handler"
 	msgHandler "github.com/Mousa96/chatting-service/internal/message/handler"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+	moderationHandler "github.com/Mousa96/chatting-service/internal/moderation/handler"
+	uploadHandler "github.com/Mousa96/chatting-service/internal/upload/handler"
 	userHandler "github.com/Mousa96/chatting-service/internal/user/handler"
 	wsHandler "github.com/Mousa96/chatting-service/internal/websocket/handler"
 )
@@ -17,20 +23,37 @@ type Config struct {
 	MessageHandler msgHandler.Handler
 	UserHandler    userHandler.Handler
 	WebSocketHandler wsHandler.Handler
+	AdminHandler   adminHandler.Handler
+	ContactHandler contactHandler.Handler
+	ModerationHandler moderationHandler.Handler
+	MediaHandler   mediaHandler.Handler
+	UploadHandler  uploadHandler.Handler
 	JWTKey         []byte
+	// Accounts, when set, rejects tokens of users suspended or deleted since they were issued
+	Accounts       middleware.AccountChecker
 }
 
 // New creates and returns a configured HTTP router with all routes registered
 func New(config Config) http.Handler {
 	mux := http.NewServeMux()
+	var authOpts []middleware.AuthOption
+	if config.Accounts != nil {
+		authOpts = append(authOpts, middleware.WithAccountChecker(config.Accounts))
+	}
+	authMiddleware := middleware.AuthMiddleware(config.JWTKey, authOpts...)
 	
 	// Register routes by category
 	registerHealthCheck(mux)
 	registerSwaggerRoutes(mux) // Add Swagger routes
 	registerAuthRoutes(mux, config.AuthHandler)
-	registerMessageRoutes(mux, config.MessageHandler, config.JWTKey)
-	registerUserRoutes(mux, config.UserHandler, config.JWTKey)
-	registerWebSocketRoutes(mux, config.WebSocketHandler, config.JWTKey)
+	registerMessageRoutes(mux, config.MessageHandler, authMiddleware)
+	registerUserRoutes(mux, config.UserHandler, authMiddleware)
+	registerWebSocketRoutes(mux, config.WebSocketHandler)
+	registerAdminRoutes(mux, config.AdminHandler, authMiddleware)
+	registerContactRoutes(mux, config.ContactHandler, authMiddleware)
+	registerModerationRoutes(mux, config.ModerationHandler, authMiddleware)
+	registerMediaRoutes(mux, config.MediaHandler, authMiddleware)
+	registerUploadRoutes(mux, config.UploadHandler, authMiddleware)
 	registerStaticRoutes(mux)
 	handler := mux
 	return handler
@@ -4,9 +4,15 @@ import (
 	"net/http"
 	"time"
 
+	adminHandler "github.com/Mousa96/chatting-service/internal/admin/handler"
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
 	authHandler "github.com/Mousa96/chatting-service/internal/auth/handler"
+	contactHandler "github.com/Mousa96/chatting-service/internal/contact/handler"
+	mediaHandler "github.com/Mousa96/chatting-service/internal/media/handler"
 	msgHandler "github.com/Mousa96/chatting-service/internal/message/handler"
 	"github.com/Mousa96/chatting-service/internal/middleware"
+	moderationHandler "github.com/Mousa96/chatting-service/internal/moderation/handler"
+	uploadHandler "github.com/Mousa96/chatting-service/internal/upload/handler"
 	userHandler "github.com/Mousa96/chatting-service/internal/user/handler"
 
 	"os"
@@ -21,8 +27,7 @@ func registerAuthRoutes(mux *http.ServeMux, handler authHandler.Handler) {
 	mux.Handle("/api/auth/login", corsMiddleware(http.HandlerFunc(handler.Login)))
 }
 // Register message routes with appropriate middleware
-func registerMessageRoutes(mux *http.ServeMux, handler msgHandler.Handler, jwtKey []byte) {
-	authMiddleware := middleware.AuthMiddleware(jwtKey)
+func registerMessageRoutes(mux *http.ServeMux, handler msgHandler.Handler, authMiddleware func(http.Handler) http.Handler) {
 	mux.Handle("/api/messages", corsMiddleware(
 		middleware.RateLimitMiddleware(
 			authMiddleware(http.HandlerFunc(handler.SendMessage)),
@@ -68,39 +73,226 @@ func registerMessageRoutes(mux *http.ServeMux, handler msgHandler.Handler, jwtKe
 		),
 	))
 	
+	// Scheduled messages are created by sending with send_at
+	mux.Handle("/api/messages/scheduled", corsMiddleware(
+		middleware.RateLimitMiddleware(
+			authMiddleware(methodHandler(map[string]http.HandlerFunc{
+				http.MethodGet: handler.ListScheduledMessages,
+				http.MethodPut: handler.UpdateScheduledMessage,
+			})),
+			10,
+			time.Minute,
+		),
+	))
+	mux.Handle("/api/messages/scheduled/cancel", corsMiddleware(
+		middleware.RateLimitMiddleware(
+			authMiddleware(http.HandlerFunc(handler.CancelScheduledMessage)),
+			10,
+			time.Minute,
+		),
+	))
+	
+	mux.Handle("/api/messages/conversation/timer", corsMiddleware(
+		middleware.RateLimitMiddleware(
+			authMiddleware(methodHandler(map[string]http.HandlerFunc{
+				http.MethodGet: handler.GetConversationTimer,
+				http.MethodPut: handler.SetConversationTimer,
+			})),
+			10,
+			time.Minute,
+		),
+	))
+	
+	// Pins are shared by both participants of a conversation, stars are private
+	mux.Handle("/api/messages/pinned", corsMiddleware(
+		middleware.RateLimitMiddleware(
+			authMiddleware(methodHandler(map[string]http.HandlerFunc{
+				http.MethodGet:  handler.ListPinnedMessages,
+				http.MethodPost: handler.PinMessage,
+			})),
+			10,
+			time.Minute,
+		),
+	))
+	mux.Handle("/api/messages/pinned/remove", corsMiddleware(
+		middleware.RateLimitMiddleware(
+			authMiddleware(http.HandlerFunc(handler.UnpinMessage)),
+			10,
+			time.Minute,
+		),
+	))
+	mux.Handle("/api/messages/starred", corsMiddleware(
+		middleware.RateLimitMiddleware(
+			authMiddleware(methodHandler(map[string]http.HandlerFunc{
+				http.MethodGet:  handler.ListStarredMessages,
+				http.MethodPost: handler.StarMessage,
+			})),
+			10,
+			time.Minute,
+		),
+	))
+	mux.Handle("/api/messages/starred/remove", corsMiddleware(
+		middleware.RateLimitMiddleware(
+			authMiddleware(http.HandlerFunc(handler.UnstarMessage)),
+			10,
+			time.Minute,
+		),
+	))
+	
 	// Broadcast messages have stricter rate limit
+	requireBroadcast := middleware.RequirePermission(authModels.PermissionBroadcastMessages)
 	mux.Handle("/api/messages/broadcast", corsMiddleware(
 		middleware.RateLimitMiddleware(
-			authMiddleware(http.HandlerFunc(handler.BroadcastMessage)),
+			authMiddleware(requireBroadcast(http.HandlerFunc(handler.BroadcastMessage))),
 			3,
 			time.Minute,
 		),
 	))
 }
 // Register user routes
-func registerUserRoutes(mux *http.ServeMux, handler userHandler.Handler, jwtKey []byte) {
-	authMiddleware := middleware.AuthMiddleware(jwtKey)
+func registerUserRoutes(mux *http.ServeMux, handler userHandler.Handler, authMiddleware func(http.Handler) http.Handler) {
 	
 	// Register user endpoints directly instead of using submux
-	// Get all users
-	mux.Handle("/api/users", corsMiddleware(authMiddleware(http.HandlerFunc(handler.GetAllUsers))))
+	// Search the user directory
+	mux.Handle("/api/users", corsMiddleware(authMiddleware(http.HandlerFunc(handler.SearchUsers))))
 	
 	// Get user by ID
 	mux.Handle("/api/users/profile", corsMiddleware(authMiddleware(http.HandlerFunc(handler.GetUserByID))))
 	
 	// Update user status
 	mux.Handle("/api/users/status", corsMiddleware(authMiddleware(http.HandlerFunc(handler.UpdateUserStatus))))
+
+	// Current user's profile
+	mux.Handle("/api/users/me", corsMiddleware(authMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodGet:   handler.GetCurrentUser,
+		http.MethodPatch: handler.UpdateProfile,
+	}))))
+	mux.Handle("/api/users/me/avatar", corsMiddleware(authMiddleware(http.HandlerFunc(handler.UploadAvatar))))
+	mux.Handle("/api/users/me/storage", corsMiddleware(authMiddleware(http.HandlerFunc(handler.GetStorageUsage))))
+}
+// Register contact, contact request, block and mute routes
+func registerContactRoutes(mux *http.ServeMux, handler contactHandler.Handler, authMiddleware func(http.Handler) http.Handler) {
+
+	mux.Handle("/api/contacts", corsMiddleware(authMiddleware(http.HandlerFunc(handler.ListContacts))))
+	mux.Handle("/api/contacts/remove", corsMiddleware(authMiddleware(http.HandlerFunc(handler.RemoveContact))))
+	mux.Handle("/api/contacts/requests", corsMiddleware(authMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodGet:  handler.ListRequests,
+		http.MethodPost: handler.SendRequest,
+	}))))
+	mux.Handle("/api/contacts/requests/accept", corsMiddleware(authMiddleware(http.HandlerFunc(handler.AcceptRequest))))
+	mux.Handle("/api/contacts/requests/decline", corsMiddleware(authMiddleware(http.HandlerFunc(handler.DeclineRequest))))
+	mux.Handle("/api/contacts/requests/cancel", corsMiddleware(authMiddleware(http.HandlerFunc(handler.CancelRequest))))
+	mux.Handle("/api/contacts/settings", corsMiddleware(authMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodGet: handler.GetPrivacySettings,
+		http.MethodPut: handler.UpdatePrivacySettings,
+	}))))
+
+	// Blocked and muted users
+	mux.Handle("/api/blocks", corsMiddleware(authMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodGet:  handler.ListBlocked,
+		http.MethodPost: handler.BlockUser,
+	}))))
+	mux.Handle("/api/blocks/remove", corsMiddleware(authMiddleware(http.HandlerFunc(handler.UnblockUser))))
+	mux.Handle("/api/mutes", corsMiddleware(authMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodGet:  handler.ListMuted,
+		http.MethodPost: handler.MuteUser,
+	}))))
+	mux.Handle("/api/mutes/remove", corsMiddleware(authMiddleware(http.HandlerFunc(handler.UnmuteUser))))
+}
+// Register admin routes, restricted by permission
+func registerAdminRoutes(mux *http.ServeMux, handler adminHandler.Handler, authMiddleware func(http.Handler) http.Handler) {
+	requireManageUsers := middleware.RequirePermission(authModels.PermissionManageUsers)
+	requireViewStats := middleware.RequirePermission(authModels.PermissionViewStats)
+
+	mux.Handle("/api/admin/users", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.ListUsers)))))
+	mux.Handle("/api/admin/users/suspend", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.SuspendUser)))))
+	mux.Handle("/api/admin/users/delete", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.DeleteUser)))))
+	mux.Handle("/api/admin/users/role", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.SetUserRole)))))
+	mux.Handle("/api/admin/users/external", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.SetUserExternal)))))
+	mux.Handle("/api/admin/users/storage-quota", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.SetStorageQuota)))))
+	mux.Handle("/api/admin/media/gc", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.CollectMedia)))))
+	mux.Handle("/api/admin/quarantine", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.ListQuarantinedFiles)))))
+	mux.Handle("/api/admin/quarantine/file", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.DownloadQuarantinedFile)))))
+	mux.Handle("/api/admin/quarantine/delete", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.DeleteQuarantinedFile)))))
+	mux.Handle("/api/admin/users/disconnect", corsMiddleware(authMiddleware(requireManageUsers(http.HandlerFunc(handler.DisconnectUser)))))
+	mux.Handle("/api/admin/stats", corsMiddleware(authMiddleware(requireViewStats(http.HandlerFunc(handler.GetStats)))))
+}
+// Register report and moderation routes. Anyone signed in can file a report;
+// the moderation queue and actions need the moderate permission.
+func registerModerationRoutes(mux *http.ServeMux, handler moderationHandler.Handler, authMiddleware func(http.Handler) http.Handler) {
+	requireModerate := middleware.RequirePermission(authModels.PermissionModerate)
+
+	mux.Handle("/api/reports", corsMiddleware(
+		middleware.RateLimitMiddleware(
+			authMiddleware(http.HandlerFunc(handler.CreateReport)),
+			10,
+			time.Minute,
+		),
+	))
+
+	mux.Handle("/api/moderation/reports", corsMiddleware(authMiddleware(requireModerate(http.HandlerFunc(handler.ListReports)))))
+	mux.Handle("/api/moderation/reports/view", corsMiddleware(authMiddleware(requireModerate(http.HandlerFunc(handler.GetReport)))))
+	mux.Handle("/api/moderation/reports/close", corsMiddleware(authMiddleware(requireModerate(http.HandlerFunc(handler.CloseReport)))))
+	mux.Handle("/api/moderation/messages/hide", corsMiddleware(authMiddleware(requireModerate(http.HandlerFunc(handler.HideMessage)))))
+	mux.Handle("/api/moderation/messages/delete", corsMiddleware(authMiddleware(requireModerate(http.HandlerFunc(handler.DeleteMessage)))))
+	mux.Handle("/api/moderation/users/warn", corsMiddleware(authMiddleware(requireModerate(http.HandlerFunc(handler.WarnUser)))))
+	mux.Handle("/api/moderation/users/suspend", corsMiddleware(authMiddleware(requireModerate(http.HandlerFunc(handler.SuspendUser)))))
+	mux.Handle("/api/moderation/actions", corsMiddleware(authMiddleware(requireModerate(http.HandlerFunc(handler.ListActions)))))
+}
+// Register media routes. Requests with a token are checked against the user's
+// conversations; requests without one need a signed URL unless the file is public,
+// so signed URLs work in img and video tags.
+func registerMediaRoutes(mux *http.ServeMux, handler mediaHandler.Handler, authMiddleware func(http.Handler) http.Handler) {
+	authenticated := authMiddleware(http.HandlerFunc(handler.ServeMedia))
+
+	mux.Handle("/api/media/sign", corsMiddleware(authMiddleware(http.HandlerFunc(handler.SignURL))))
+	mux.Handle("/api/media/", mediaCORSMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			handler.ServeAnonymousMedia(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})))
+}
+// Register tus resumable upload and direct upload routes. OPTIONS requests are protocol
+// discovery and need no token.
+func registerUploadRoutes(mux *http.ServeMux, handler uploadHandler.Handler, authMiddleware func(http.Handler) http.Handler) {
+	authenticated := func(next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware(next).ServeHTTP
+	}
+
+	mux.Handle(uploadHandler.URLPrefix, tusCORSMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodOptions: handler.Options,
+		http.MethodPost: middleware.RateLimitMiddleware(
+			authenticated(handler.CreateUpload),
+			10,
+			time.Minute,
+		).ServeHTTP,
+	})))
+	mux.Handle(uploadHandler.URLPrefix+"/", tusCORSMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodOptions: handler.Options,
+		http.MethodHead:    authenticated(handler.GetUpload),
+		http.MethodPatch:   authenticated(handler.PatchUpload),
+		http.MethodDelete:  authenticated(handler.DeleteUpload),
+	})))
+	mux.Handle(uploadHandler.DirectURLPrefix, corsMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodPost: middleware.RateLimitMiddleware(
+			authenticated(handler.CreateDirectUpload),
+			10,
+			time.Minute,
+		).ServeHTTP,
+	})))
+	mux.Handle(uploadHandler.DirectURLPrefix+"/", corsMiddleware(methodHandler(map[string]http.HandlerFunc{
+		http.MethodPost: authenticated(handler.CompleteDirectUpload),
+	})))
 }
 // Register WebSocket routes
-func registerWebSocketRoutes(mux *http.ServeMux, handler wsHandler.Handler, jwtKey []byte) {
+func registerWebSocketRoutes(mux *http.ServeMux, handler wsHandler.Handler) {
 	mux.Handle("/ws", http.HandlerFunc(handler.ServeWS))
 }
 // Register static routes
 func registerStaticRoutes(mux *http.ServeMux) {
-    // Serve uploaded files from /uploads/ directory
-    fileServer := http.FileServer(http.Dir("/app/uploads"))
-    mux.Handle("/uploads/", http.StripPrefix("/uploads/", fileServer))
-    
+    // Uploaded files are not served statically; see registerMediaRoutes
     // Serve frontend static assets (CSS, JS, images)
     mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("/app/frontend/assets/"))))
     
@@ -139,12 +331,53 @@ func registerSwaggerRoutes(mux *http.ServeMux) {
 		httpSwagger.DomID("swagger-ui"),
 	))
 }
+// methodHandler dispatches a single path to different handlers by HTTP method
+func methodHandler(handlers map[string]http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	})
+}
+// tusCORSMiddleware is corsMiddleware for the upload endpoints, whose requests and
+// responses carry tus protocol headers and whose OPTIONS requests reach the handler
+func tusCORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8080")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, HEAD, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset")
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, Upload-Attachment-Id")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		next.ServeHTTP(w, r)
+	})
+}
+// mediaCORSMiddleware is corsMiddleware for media downloads, which scripts may request
+// in ranges and whose responses describe the range and file they carry
+func mediaCORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8080")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Range, If-Range, If-None-Match, If-Modified-Since")
+		w.Header().Set("Access-Control-Expose-Headers", "Accept-Ranges, Content-Range, Content-Disposition, ETag")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
 // corsMiddleware implementation
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8080")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// BlobPrefix holds files stored once per distinct content
+const BlobPrefix = "blobs/"
+
+// Blob is a stored file identified by the SHA-256 of its content
+type Blob struct {
+	// Hash is the hex SHA-256 of the content
+	Hash        string
+	Key         string
+	ContentType string
+	Size        int64
+	// OwnerID is the user whose upload stored the blob
+	OwnerID int
+}
+
+// BlobIndex records which blobs are stored and how many references each one has
+type BlobIndex interface {
+	// AcquireBlob adds a reference to the blob with hash, returning false if there is none
+	AcquireBlob(hash string) (*Blob, bool, error)
+	// RegisterBlob records a newly stored blob with one reference. If a blob with the same
+	// hash was registered first, that blob gains the reference and is returned instead.
+	RegisterBlob(blob *Blob) (*Blob, error)
+	// ReleaseBlob drops a reference to the blob with hash. Once the last reference is
+	// dropped the blob is forgotten and returned with last set, so its file can be deleted.
+	ReleaseBlob(hash string) (blob *Blob, last bool, err error)
+}
+
+// BlobStore stores each distinct file once under a random key, counting references to
+// it in a BlobIndex so repeat uploads reuse the stored file
+type BlobStore struct {
+	storage Storage
+	index   BlobIndex
+}
+
+// NewBlobStore creates a BlobStore keeping files in storage and references in index
+func NewBlobStore(storage Storage, index BlobIndex) *BlobStore {
+	return &BlobStore{storage: storage, index: index}
+}
+
+// Acquire adds a reference to the stored blob with hash, returning false if the content
+// has not been stored
+func (b *BlobStore) Acquire(hash string) (*Blob, bool, error) {
+	blob, ok, err := b.index.AcquireBlob(hash)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to look up blob: %w", err)
+	}
+	return blob, ok, nil
+}
+
+// Store writes content, whose SHA-256 is hash, as a new blob with one reference. When the
+// same content was stored concurrently, the copy just written is deleted and the other
+// blob is returned with stored set to false.
+func (b *BlobStore) Store(hash string, content io.Reader, size int64, contentType, ext string, ownerID int) (blob *Blob, stored bool, err error) {
+	key, err := newBlobKey(ext)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := b.storage.Upload(key, content, contentType); err != nil {
+		return nil, false, fmt.Errorf("failed to upload blob: %w", err)
+	}
+
+	blob, err = b.index.RegisterBlob(&Blob{Hash: hash, Key: key, ContentType: contentType, Size: size, OwnerID: ownerID})
+	if err != nil {
+		b.remove(key)
+		return nil, false, fmt.Errorf("failed to register blob: %w", err)
+	}
+	if blob.Key != key {
+		b.remove(key)
+		return blob, false, nil
+	}
+	return blob, true, nil
+}
+
+// Release drops a reference to the blob with hash and deletes its file with the last
+// reference. The blob is returned when it was deleted, and nil otherwise.
+func (b *BlobStore) Release(hash string) (*Blob, error) {
+	blob, last, err := b.index.ReleaseBlob(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release blob: %w", err)
+	}
+	if !last {
+		return nil, nil
+	}
+	// The blob is already out of the index, so a failed delete only leaves an orphaned file
+	if err := b.storage.Delete(blob.Key); err != nil {
+		return blob, fmt.Errorf("failed to delete blob %s: %w", blob.Key, err)
+	}
+	return blob, nil
+}
+
+func (b *BlobStore) remove(key string) {
+	if err := b.storage.Delete(key); err != nil {
+		log.Printf("Failed to remove blob %s: %v", key, err)
+	}
+}
+
+// newBlobKey returns a random key for a new blob. Keys are not derived from the hash, so
+// a blob being deleted never shares its key with one being stored.
+func newBlobKey(ext string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate blob key: %w", err)
+	}
+	return BlobPrefix + hex.EncodeToString(buf) + strings.ToLower(ext), nil
+}
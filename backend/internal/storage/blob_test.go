@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapIndex is an in-memory BlobIndex
+type mapIndex struct {
+	blobs map[string]*Blob
+	refs  map[string]int
+}
+
+func newMapIndex() *mapIndex {
+	return &mapIndex{blobs: make(map[string]*Blob), refs: make(map[string]int)}
+}
+
+func (i *mapIndex) AcquireBlob(hash string) (*Blob, bool, error) {
+	blob, ok := i.blobs[hash]
+	if ok {
+		i.refs[hash]++
+	}
+	return blob, ok, nil
+}
+
+func (i *mapIndex) RegisterBlob(blob *Blob) (*Blob, error) {
+	if _, ok := i.blobs[blob.Hash]; !ok {
+		i.blobs[blob.Hash] = blob
+	}
+	i.refs[blob.Hash]++
+	return i.blobs[blob.Hash], nil
+}
+
+func (i *mapIndex) ReleaseBlob(hash string) (*Blob, bool, error) {
+	blob, ok := i.blobs[hash]
+	if !ok {
+		return nil, false, nil
+	}
+	i.refs[hash]--
+	if i.refs[hash] > 0 {
+		return nil, false, nil
+	}
+	delete(i.blobs, hash)
+	return blob, true, nil
+}
+
+func TestBlobStore(t *testing.T) {
+	dir := t.TempDir()
+	index := newMapIndex()
+	blobs := NewBlobStore(NewLocalStorage(dir, "/api/media"), index)
+	exists := func(key string) bool {
+		_, err := os.Stat(filepath.Join(dir, key))
+		return err == nil
+	}
+
+	_, ok, err := blobs.Acquire("abc")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	blob, stored, err := blobs.Store("abc", strings.NewReader("hello"), 5, "text/plain", ".TXT", 1)
+	require.NoError(t, err)
+	assert.True(t, stored)
+	assert.True(t, strings.HasPrefix(blob.Key, BlobPrefix))
+	assert.True(t, strings.HasSuffix(blob.Key, ".txt"))
+	assert.Equal(t, 1, blob.OwnerID)
+	assert.True(t, exists(blob.Key))
+
+	acquired, ok, err := blobs.Acquire("abc")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, blob.Key, acquired.Key)
+
+	// Content stored concurrently by someone else is referenced instead of kept twice
+	again, stored, err := blobs.Store("abc", strings.NewReader("hello"), 5, "text/plain", ".txt", 2)
+	require.NoError(t, err)
+	assert.False(t, stored)
+	assert.Equal(t, blob.Key, again.Key)
+	entries, err := os.ReadDir(filepath.Join(dir, BlobPrefix))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// The file stays until the last of its three references is released
+	for i := 0; i < 2; i++ {
+		removed, err := blobs.Release("abc")
+		require.NoError(t, err)
+		assert.Nil(t, removed)
+		assert.True(t, exists(blob.Key))
+	}
+	removed, err := blobs.Release("abc")
+	require.NoError(t, err)
+	require.NotNil(t, removed)
+	assert.Equal(t, blob.Key, removed.Key)
+	assert.False(t, exists(blob.Key))
+}
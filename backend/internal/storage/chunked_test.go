@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 keeps objects and multipart uploads in memory
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int32][]byte
+	nextID   int
+	failPart bool
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int32][]byte)}
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[*params.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[*params.Key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[*params.Key]
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{ContentLength: int64(len(data))}, nil
+}
+
+func (f *fakeS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, key, _ := strings.Cut(*params.CopySource, "/")
+	data, ok := f.objects[key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	f.objects[*params.Key] = append([]byte(nil), data...)
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := fmt.Sprintf("upload-%d", f.nextID)
+	f.uploads[id] = make(map[int32][]byte)
+	return &s3.CreateMultipartUploadOutput{UploadId: &id}, nil
+}
+
+func (f *fakeS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failPart {
+		return nil, errors.New("connection reset")
+	}
+	parts, ok := f.uploads[*params.UploadId]
+	if !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	parts[params.PartNumber] = data
+	etag := fmt.Sprintf("etag-%d-%d", params.PartNumber, len(data))
+	return &s3.UploadPartOutput{ETag: &etag}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts, ok := f.uploads[*params.UploadId]
+	if !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	var object []byte
+	for _, completed := range params.MultipartUpload.Parts {
+		data := parts[completed.PartNumber]
+		if *completed.ETag != fmt.Sprintf("etag-%d-%d", completed.PartNumber, len(data)) {
+			return nil, fmt.Errorf("invalid part %d", completed.PartNumber)
+		}
+		object = append(object, data...)
+	}
+	f.objects[*params.Key] = object
+	delete(f.uploads, *params.UploadId)
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.uploads[*params.UploadId]; !ok {
+		return nil, &types.NoSuchUpload{}
+	}
+	delete(f.uploads, *params.UploadId)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &s3.ListObjectsV2Output{}
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			out.Contents = append(out.Contents, types.Object{Key: aws.String(key), Size: int64(len(data))})
+		}
+	}
+	return out, nil
+}
+
+// failingReader returns its data and then an error, like a dropped connection
+type failingReader struct {
+	data io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func readAll(t *testing.T, uploader ChunkedUploader, filename string) string {
+	body, err := uploader.Open(filename)
+	require.NoError(t, err)
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLocalStorageChunked(t *testing.T) {
+	tmpDir := t.TempDir()
+	storage := NewLocalStorage(tmpDir, "/api/media").(*LocalStorage)
+
+	state, err := storage.StartChunked("uploads/abc", "video/mp4")
+	require.NoError(t, err)
+
+	written, state, err := storage.WriteChunk("uploads/abc", state, 0, strings.NewReader("hello "))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), written)
+
+	_, _, err = storage.WriteChunk("uploads/abc", state, 10, strings.NewReader("gap"))
+	assert.ErrorIs(t, err, ErrChunkOffset)
+
+	// A dropped connection keeps what arrived
+	written, state, err = storage.WriteChunk("uploads/abc", state, 6, &failingReader{data: strings.NewReader("wor")})
+	assert.Error(t, err)
+	assert.Equal(t, int64(3), written)
+
+	// Bytes that were written but never recorded are replaced
+	written, state, err = storage.WriteChunk("uploads/abc", state, 6, strings.NewReader("world"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), written)
+
+	require.NoError(t, storage.FinishChunked("uploads/abc", state))
+	assert.Equal(t, "hello world", readAll(t, storage, "uploads/abc"))
+
+	require.NoError(t, storage.AbortChunked("uploads/abc", state))
+	_, err = os.Stat(tmpDir + "/uploads/abc")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestS3StorageChunked(t *testing.T) {
+	client := newFakeS3()
+	storage := NewS3Storage(client, "test-bucket", "")
+	storage.partSize = 4
+
+	t.Run("assembles parts", func(t *testing.T) {
+		state, err := storage.StartChunked("1_video.mp4", "video/mp4")
+		require.NoError(t, err)
+
+		// Less than a part waits in the pending object
+		written, state, err := storage.WriteChunk("1_video.mp4", state, 0, strings.NewReader("abc"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), written)
+		assert.Equal(t, "abc", string(client.objects["1_video.mp4.pending"]))
+
+		_, _, err = storage.WriteChunk("1_video.mp4", state, 2, strings.NewReader("x"))
+		assert.ErrorIs(t, err, ErrChunkOffset)
+
+		// The pending data is sent with the start of the next chunk
+		written, state, err = storage.WriteChunk("1_video.mp4", state, 3, strings.NewReader("defgh"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), written)
+
+		written, state, err = storage.WriteChunk("1_video.mp4", state, 8, strings.NewReader("ij"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), written)
+
+		st, err := decodeS3State(state)
+		require.NoError(t, err)
+		require.Len(t, st.Parts, 2)
+		assert.Equal(t, int64(4), st.Parts[0].Size)
+		assert.Equal(t, int64(2), st.Pending)
+
+		require.NoError(t, storage.FinishChunked("1_video.mp4", state))
+		assert.Equal(t, "abcdefghij", readAll(t, storage, "1_video.mp4"))
+		assert.NotContains(t, client.objects, "1_video.mp4.pending")
+	})
+
+	t.Run("keeps data after a dropped connection", func(t *testing.T) {
+		state, err := storage.StartChunked("1_drop.mp4", "video/mp4")
+		require.NoError(t, err)
+
+		written, state, err := storage.WriteChunk("1_drop.mp4", state, 0, &failingReader{data: strings.NewReader("abcdef")})
+		assert.Error(t, err)
+		assert.Equal(t, int64(6), written)
+
+		written, state, err = storage.WriteChunk("1_drop.mp4", state, 6, strings.NewReader("g"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), written)
+
+		require.NoError(t, storage.FinishChunked("1_drop.mp4", state))
+		assert.Equal(t, "abcdefg", readAll(t, storage, "1_drop.mp4"))
+	})
+
+	t.Run("part failure", func(t *testing.T) {
+		state, err := storage.StartChunked("1_fail.mp4", "video/mp4")
+		require.NoError(t, err)
+
+		client.failPart = true
+		written, failedState, err := storage.WriteChunk("1_fail.mp4", state, 0, strings.NewReader("abcdef"))
+		client.failPart = false
+		assert.Error(t, err)
+
+		// Whatever was kept can be continued from
+		rest := "abcdef"[written:]
+		_, state, err = storage.WriteChunk("1_fail.mp4", failedState, written, strings.NewReader(rest))
+		require.NoError(t, err)
+		require.NoError(t, storage.FinishChunked("1_fail.mp4", state))
+		assert.Equal(t, "abcdef", readAll(t, storage, "1_fail.mp4"))
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		state, err := storage.StartChunked("1_empty.txt", "text/plain")
+		require.NoError(t, err)
+		require.NoError(t, storage.FinishChunked("1_empty.txt", state))
+		assert.Equal(t, "", readAll(t, storage, "1_empty.txt"))
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		state, err := storage.StartChunked("1_abort.mp4", "video/mp4")
+		require.NoError(t, err)
+		_, state, err = storage.WriteChunk("1_abort.mp4", state, 0, strings.NewReader("abc"))
+		require.NoError(t, err)
+
+		require.NoError(t, storage.AbortChunked("1_abort.mp4", state))
+		assert.NotContains(t, client.objects, "1_abort.mp4.pending")
+		// Aborting twice is harmless
+		assert.NoError(t, storage.AbortChunked("1_abort.mp4", state))
+	})
+
+	t.Run("invalid state", func(t *testing.T) {
+		_, _, err := storage.WriteChunk("1_video.mp4", "{}", 0, strings.NewReader("abc"))
+		assert.Error(t, err)
+	})
+}
+
+func TestWithPartSize(t *testing.T) {
+	assert.Equal(t, int64(s3MinPartSize), NewS3Storage(newFakeS3(), "b", "", WithPartSize(1024)).partSize)
+	assert.Equal(t, int64(16<<20), NewS3Storage(newFakeS3(), "b", "", WithPartSize(16<<20)).partSize)
+	assert.Equal(t, int64(defaultS3PartSize), NewS3Storage(newFakeS3(), "b", "").partSize)
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/storage/s3test"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDirectStorage(t *testing.T) (*S3Storage, *s3test.Server) {
+	server := s3test.NewServer("media")
+	t.Cleanup(server.Close)
+	client := server.Client()
+	return NewS3Storage(client, "media", "/api/media", WithPresignClient(s3.NewPresignClient(client))), server
+}
+
+// send makes a presigned request, optionally changing its headers
+func send(t *testing.T, upload *PresignedUpload, body string, override map[string]string) int {
+	req, err := http.NewRequest(upload.Method, upload.URL, strings.NewReader(body))
+	require.NoError(t, err)
+	for name, value := range upload.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range override {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestS3StorageDirectUpload(t *testing.T) {
+	storage, server := newDirectStorage(t)
+
+	upload, err := storage.PresignPut("uploads/abc", "video/mp4", 11, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPut, upload.Method)
+	assert.Equal(t, "video/mp4", upload.Headers["Content-Type"])
+	assert.Equal(t, "11", upload.Headers["Content-Length"])
+	assert.NotContains(t, upload.Headers, "Host")
+
+	// The signature covers the length and type
+	assert.Equal(t, http.StatusForbidden, send(t, upload, "hello world", map[string]string{"Content-Type": "text/html"}))
+	assert.Equal(t, http.StatusForbidden, send(t, upload, "hello world!", nil))
+	_, _, ok := server.Object("uploads/abc")
+	assert.False(t, ok)
+
+	require.Equal(t, http.StatusOK, send(t, upload, "hello world", nil))
+	data, contentType, ok := server.Object("uploads/abc")
+	require.True(t, ok)
+	assert.Equal(t, "hello world", string(data))
+	assert.Equal(t, "video/mp4", contentType)
+
+	info, err := storage.Stat("uploads/abc")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), info.Size)
+	assert.Equal(t, "video/mp4", info.ContentType)
+
+	head, err := storage.ReadHead("uploads/abc", 5)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(head))
+	head, err = storage.ReadHead("uploads/abc", 512)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(head))
+
+	require.NoError(t, storage.Copy("uploads/abc", "1_abc.mp4"))
+	copied, _, ok := server.Object("1_abc.mp4")
+	require.True(t, ok)
+	assert.Equal(t, "hello world", string(copied))
+
+	require.NoError(t, storage.Delete("uploads/abc"))
+	_, err = storage.Stat("uploads/abc")
+	assert.ErrorIs(t, err, ErrNotExist)
+	_, err = storage.ReadHead("uploads/abc", 5)
+	assert.ErrorIs(t, err, ErrNotExist)
+	assert.ErrorIs(t, storage.Copy("uploads/abc", "1_def.mp4"), ErrNotExist)
+}
+
+func TestS3StorageDirectUploadExpiry(t *testing.T) {
+	storage, _ := newDirectStorage(t)
+
+	upload, err := storage.PresignPut("uploads/abc", "video/mp4", 3, time.Second)
+	require.NoError(t, err)
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, http.StatusForbidden, send(t, upload, "abc", nil))
+}
+
+func TestPresignPutNeedsPresigner(t *testing.T) {
+	_, err := NewS3Storage(newFakeS3(), "media", "").PresignPut("uploads/abc", "video/mp4", 3, time.Minute)
+	assert.Error(t, err)
+}
@@ -1,8 +1,101 @@
 package storage
 
-import "io"
+import (
+    "errors"
+    "io"
+    "time"
+)
 
 type Storage interface {
     Upload(filename string, content io.Reader, contentType string) (string, error)
     Delete(filename string) error
-} 
\ No newline at end of file
+}
+
+// Presigner is implemented by storage backends that can issue their own expiring
+// download URLs, such as S3 presigned GETs
+type Presigner interface {
+    PresignGet(filename string, ttl time.Duration) (string, error)
+}
+
+// ErrChunkOffset is returned when a chunk does not continue where the upload left off
+var ErrChunkOffset = errors.New("chunk does not start at the end of the upload")
+
+// ChunkedUploader is implemented by storage backends that can assemble a file from
+// chunks sent in separate requests, as used by resumable uploads. The state string is
+// opaque to callers, who store it with the upload and pass it back on the next call.
+type ChunkedUploader interface {
+    // StartChunked begins an upload that will be stored under filename
+    StartChunked(filename, contentType string) (state string, err error)
+    // WriteChunk appends content at offset and returns how many bytes were kept and the new
+    // state. Data read before content fails is kept, so the caller should record both even
+    // when an error is returned.
+    WriteChunk(filename, state string, offset int64, content io.Reader) (written int64, newState string, err error)
+    // FinishChunked assembles the chunks into the file stored under filename
+    FinishChunked(filename, state string) error
+    // AbortChunked discards an unfinished upload
+    AbortChunked(filename, state string) error
+    // Open reads a stored file
+    Open(filename string) (io.ReadCloser, error)
+}
+
+// ErrNotExist is returned when a stored file is missing
+var ErrNotExist = errors.New("file does not exist")
+
+// ObjectInfo describes a stored file
+type ObjectInfo struct {
+    Size        int64
+    ContentType string
+    ModTime     time.Time
+    // ETag is a quoted entity tag that changes whenever the file does
+    ETag string
+}
+
+// Reader is implemented by storage backends that can stream stored files, so media can
+// be served through this server, including the parts asked for by Range requests
+type Reader interface {
+    // Stat returns the size, type, modification time and ETag of a stored file, or ErrNotExist
+    Stat(filename string) (*ObjectInfo, error)
+    // Open reads a stored file, or returns ErrNotExist
+    Open(filename string) (io.ReadCloser, error)
+    // OpenAt reads a stored file from offset to its end, or returns ErrNotExist
+    OpenAt(filename string, offset int64) (io.ReadCloser, error)
+}
+
+// PresignedUpload is a request a client can make to store a file without sending it
+// through this server
+type PresignedUpload struct {
+    Method string
+    URL    string
+    // Headers must be sent exactly as given, since they are covered by the signature
+    Headers   map[string]string
+    ExpiresAt time.Time
+}
+
+// DirectUploader is implemented by storage backends clients can upload to directly,
+// such as S3 with presigned PUT URLs
+type DirectUploader interface {
+    // PresignPut returns a request that stores size bytes of contentType under filename,
+    // valid for ttl. Requests with a different length or type are refused by the backend.
+    PresignPut(filename, contentType string, size int64, ttl time.Duration) (*PresignedUpload, error)
+    // Stat returns the size and type of a stored file, or ErrNotExist
+    Stat(filename string) (*ObjectInfo, error)
+    // ReadHead returns up to n bytes from the start of a stored file
+    ReadHead(filename string, n int64) ([]byte, error)
+    // Copy stores a copy of src under dst without reading it through this server
+    Copy(src, dst string) error
+}
+
+// StoredObject describes a file found by listing a storage backend
+type StoredObject struct {
+    Key     string
+    Size    int64
+    ModTime time.Time
+}
+
+// Lister is implemented by storage backends that can enumerate the files they hold, as
+// garbage collection needs to find files nothing refers to
+type Lister interface {
+    // List calls fn for every stored file whose key starts with prefix, stopping at the
+    // first error fn returns
+    List(prefix string, fn func(StoredObject) error) error
+}
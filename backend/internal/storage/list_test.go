@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listKeys(t *testing.T, lister Lister, prefix string) []string {
+	var keys []string
+	require.NoError(t, lister.List(prefix, func(obj StoredObject) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}))
+	sort.Strings(keys)
+	return keys
+}
+
+func TestLocalStorageList(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewLocalStorage(dir, "/api/media")
+	for _, key := range []string{"1_a.jpg", "1_a.jpg~thumb_160.jpg", "avatars/1_1.png", "blobs/ab.txt"} {
+		_, err := storage.Upload(key, strings.NewReader("data"), "text/plain")
+		require.NoError(t, err)
+	}
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "blobs/ab.txt"), modified, modified))
+
+	lister := storage.(Lister)
+	assert.Equal(t, []string{"1_a.jpg", "1_a.jpg~thumb_160.jpg", "avatars/1_1.png", "blobs/ab.txt"}, listKeys(t, lister, ""))
+	assert.Equal(t, []string{"blobs/ab.txt"}, listKeys(t, lister, "blobs/"))
+	assert.Equal(t, []string{"avatars/1_1.png"}, listKeys(t, lister, "av"))
+
+	require.NoError(t, lister.List("blobs/", func(obj StoredObject) error {
+		assert.Equal(t, int64(4), obj.Size)
+		assert.True(t, obj.ModTime.Equal(modified))
+		return nil
+	}))
+
+	stop := fmt.Errorf("stop")
+	calls := 0
+	err := lister.List("", func(StoredObject) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func TestS3StorageList(t *testing.T) {
+	storage, server := newDirectStorage(t)
+	// More objects than fit in one page
+	for i := 0; i < 1005; i++ {
+		server.PutObject(fmt.Sprintf("1_%04d.jpg", i), []byte("data"), "image/jpeg")
+	}
+	server.PutObject("avatars/1_1.png", []byte("avatar"), "image/png")
+
+	keys := listKeys(t, storage, "1_")
+	require.Len(t, keys, 1005)
+	assert.Equal(t, "1_0000.jpg", keys[0])
+	assert.Equal(t, "1_1004.jpg", keys[1004])
+
+	require.NoError(t, storage.List("avatars/", func(obj StoredObject) error {
+		assert.Equal(t, "avatars/1_1.png", obj.Key)
+		assert.Equal(t, int64(6), obj.Size)
+		assert.WithinDuration(t, time.Now(), obj.ModTime, time.Minute)
+		return nil
+	}))
+}
@@ -3,8 +3,11 @@ package storage
 import (
 	"fmt"
 	"io"
+	"io/fs"
+	"mime"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type LocalStorage struct {
@@ -61,4 +64,166 @@ func (s *LocalStorage) Delete(filename string) error {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 	return nil
-} 
\ No newline at end of file
+} 
+
+// Path returns the location on disk of a stored file, refusing names that would
+// resolve outside the upload directory
+func (s *LocalStorage) Path(filename string) (string, error) {
+	fullPath := filepath.Join(s.uploadDir, filepath.Clean("/"+filename))
+	if !strings.HasPrefix(fullPath, filepath.Clean(s.uploadDir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file name: %s", filename)
+	}
+	return fullPath, nil
+}
+
+// StartChunked creates the empty file that chunks are appended to
+func (s *LocalStorage) StartChunked(filename, contentType string) (string, error) {
+	path, err := s.Path(filename)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	return "", file.Close()
+}
+
+// WriteChunk appends content to the file. Bytes past offset, left by a request whose
+// progress was never recorded, are discarded first.
+func (s *LocalStorage) WriteChunk(filename, state string, offset int64, content io.Reader) (int64, string, error) {
+	path, err := s.Path(filename)
+	if err != nil {
+		return 0, state, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, state, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, state, fmt.Errorf("failed to read file size: %w", err)
+	}
+	if info.Size() < offset {
+		return 0, state, ErrChunkOffset
+	}
+	if info.Size() > offset {
+		if err := file.Truncate(offset); err != nil {
+			return 0, state, fmt.Errorf("failed to truncate file: %w", err)
+		}
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, state, fmt.Errorf("failed to seek file: %w", err)
+	}
+
+	written, err := io.Copy(file, content)
+	if err != nil {
+		return written, state, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	return written, state, nil
+}
+
+// FinishChunked has nothing to do, since chunks are written to the file in place
+func (s *LocalStorage) FinishChunked(filename, state string) error {
+	return nil
+}
+
+// AbortChunked removes the partial file
+func (s *LocalStorage) AbortChunked(filename, state string) error {
+	path, err := s.Path(filename)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// Open reads a stored file
+func (s *LocalStorage) Open(filename string) (io.ReadCloser, error) {
+	return s.OpenAt(filename, 0)
+}
+
+// OpenAt reads a stored file from offset
+func (s *LocalStorage) OpenAt(filename string, offset int64) (io.ReadCloser, error) {
+	path, err := s.Path(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+	return file, nil
+}
+
+// Stat describes a stored file. The content type is not stored, so it is guessed from
+// the extension, and the ETag is derived from the modification time and size.
+func (s *LocalStorage) Stat(filename string) (*ObjectInfo, error) {
+	path, err := s.Path(filename)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && fi.IsDir()) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return &ObjectInfo{
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(filename)),
+		ModTime:     fi.ModTime(),
+		ETag:        fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()),
+	}, nil
+}
+
+// List walks the upload directory. Files are reported with their modification time.
+func (s *LocalStorage) List(prefix string, fn func(StoredObject) error) error {
+	root := filepath.Clean(s.uploadDir)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if entry.IsDir() {
+			// Skip directories that cannot hold keys starting with prefix
+			if path != root && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(StoredObject{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+	return nil
+}
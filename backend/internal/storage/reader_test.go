@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReader checks a Reader holding "0123456789" under "1_digits.txt"
+func testReader(t *testing.T, reader Reader) {
+	info, err := reader.Stat("1_digits.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), info.Size)
+	assert.WithinDuration(t, time.Now(), info.ModTime, time.Minute)
+	assert.True(t, strings.HasPrefix(info.ETag, `"`) && strings.HasSuffix(info.ETag, `"`), info.ETag)
+
+	body, err := reader.OpenAt("1_digits.txt", 4)
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	body.Close()
+	assert.Equal(t, "456789", string(data))
+
+	_, err = reader.Stat("1_missing.txt")
+	assert.ErrorIs(t, err, ErrNotExist)
+	_, err = reader.Open("1_missing.txt")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	t.Run("seeker", func(t *testing.T) {
+		content := NewSeeker(reader, "1_digits.txt", info.Size)
+		defer content.Close()
+
+		size, err := content.Seek(0, io.SeekEnd)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), size)
+
+		_, err = content.Seek(2, io.SeekStart)
+		require.NoError(t, err)
+		part := make([]byte, 3)
+		_, err = io.ReadFull(content, part)
+		require.NoError(t, err)
+		assert.Equal(t, "234", string(part))
+
+		// Reading continues from where the last read stopped
+		_, err = io.ReadFull(content, part)
+		require.NoError(t, err)
+		assert.Equal(t, "567", string(part))
+
+		_, err = content.Seek(-2, io.SeekEnd)
+		require.NoError(t, err)
+		rest, err := io.ReadAll(content)
+		require.NoError(t, err)
+		assert.Equal(t, "89", string(rest))
+
+		_, err = content.Seek(-1, io.SeekStart)
+		assert.Error(t, err)
+	})
+}
+
+func TestLocalStorageReader(t *testing.T) {
+	storage := NewLocalStorage(t.TempDir(), "/api/media")
+	_, err := storage.Upload("1_digits.txt", strings.NewReader("0123456789"), "text/plain")
+	require.NoError(t, err)
+
+	reader := storage.(Reader)
+	testReader(t, reader)
+
+	info, err := reader.Stat("1_digits.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", info.ContentType)
+}
+
+func TestS3StorageReader(t *testing.T) {
+	storage, server := newDirectStorage(t)
+	server.PutObject("1_digits.txt", []byte("0123456789"), "text/plain")
+
+	testReader(t, storage)
+
+	info, err := storage.Stat("1_digits.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", info.ContentType)
+}
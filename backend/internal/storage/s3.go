@@ -4,27 +4,72 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 type S3Client interface {
 	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
 	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// S3Presigner is implemented by *s3.PresignClient
+type S3Presigner interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
 }
 
 type S3Storage struct {
-	client  S3Client
-	bucket  string
-	baseURL string
+	client    S3Client
+	bucket    string
+	baseURL   string
+	presigner S3Presigner
+	partSize  int64
+}
+
+// S3Option configures optional S3Storage dependencies
+type S3Option func(*S3Storage)
+
+// WithPartSize sets the size of the parts chunked uploads are sent to S3 in. S3 needs
+// every part but the last to be at least 5 MiB, so smaller sizes are raised to that.
+func WithPartSize(size int64) S3Option {
+	return func(s *S3Storage) {
+		if size < s3MinPartSize {
+			size = s3MinPartSize
+		}
+		s.partSize = size
+	}
 }
 
-func NewS3Storage(client S3Client, bucket, baseURL string) *S3Storage {
-	return &S3Storage{
-		client:  client,
-		bucket:  bucket,
-		baseURL: baseURL,
+// WithPresignClient enables presigned download URLs and direct uploads, e.g. with s3.NewPresignClient(client)
+func WithPresignClient(presigner S3Presigner) S3Option {
+	return func(s *S3Storage) {
+		s.presigner = presigner
+	}
+}
+
+func NewS3Storage(client S3Client, bucket, baseURL string, opts ...S3Option) *S3Storage {
+	s := &S3Storage{
+		client:   client,
+		bucket:   bucket,
+		baseURL:  baseURL,
+		partSize: defaultS3PartSize,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *S3Storage) Upload(filename string, content io.Reader, contentType string) (string, error) {
@@ -55,4 +100,43 @@ func (s *S3Storage) Delete(filename string) error {
 	}
 
 	return nil
-} 
\ No newline at end of file
+} 
+
+// PresignGet returns a presigned GET URL for a stored object valid for ttl
+func (s *S3Storage) PresignGet(filename string, ttl time.Duration) (string, error) {
+	if s.presigner == nil {
+		return "", fmt.Errorf("presigned URLs are not configured")
+	}
+	req, err := s.presigner.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &filename,
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 download: %w", err)
+	}
+	return req.URL, nil
+}
+
+// List pages through the bucket's objects under prefix
+func (s *S3Storage) List(prefix string, fn func(StoredObject) error) error {
+	input := &s3.ListObjectsV2Input{Bucket: &s.bucket, Prefix: &prefix}
+	for {
+		out, err := s.client.ListObjectsV2(context.Background(), input)
+		if err != nil {
+			return fmt.Errorf("failed to list S3 objects: %w", err)
+		}
+		for _, obj := range out.Contents {
+			object := StoredObject{Key: aws.ToString(obj.Key), Size: obj.Size}
+			if obj.LastModified != nil {
+				object.ModTime = *obj.LastModified
+			}
+			if err := fn(object); err != nil {
+				return err
+			}
+		}
+		if !out.IsTruncated || out.NextContinuationToken == nil {
+			return nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Config locates a bucket on S3 or an S3-compatible service such as MinIO
+type S3Config struct {
+	Region string
+	// Endpoint overrides the AWS endpoint, e.g. "http://minio:9000"
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// PathStyle addresses buckets as endpoint/bucket rather than bucket.endpoint, which
+	// most S3-compatible services need
+	PathStyle bool
+}
+
+// NewS3Client creates an S3 client with static credentials
+func NewS3Client(cfg S3Config) *s3.Client {
+	creds := aws.Credentials{
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+		SessionToken:    cfg.SessionToken,
+		Source:          "StaticCredentials",
+	}
+	options := s3.Options{
+		Region:       cfg.Region,
+		UsePathStyle: cfg.PathStyle,
+		Credentials: aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return creds, nil
+		})),
+	}
+	if cfg.Endpoint != "" {
+		options.BaseEndpoint = aws.String(cfg.Endpoint)
+	}
+	return s3.New(options)
+}
+
+// PresignPut returns a presigned PUT request. The length and content type are part of
+// the signature, so S3 refuses any other body.
+func (s *S3Storage) PresignPut(filename, contentType string, size int64, ttl time.Duration) (*PresignedUpload, error) {
+	if s.presigner == nil {
+		return nil, fmt.Errorf("presigned URLs are not configured")
+	}
+	expiresAt := time.Now().Add(ttl)
+	req, err := s.presigner.PresignPutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:        &s.bucket,
+		Key:           &filename,
+		ContentType:   &contentType,
+		ContentLength: size,
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign S3 upload: %w", err)
+	}
+
+	headers := make(map[string]string, len(req.SignedHeader))
+	for name, values := range req.SignedHeader {
+		// Clients set the host themselves
+		if strings.EqualFold(name, "Host") || len(values) == 0 {
+			continue
+		}
+		headers[http.CanonicalHeaderKey(name)] = values[0]
+	}
+	return &PresignedUpload{Method: req.Method, URL: req.URL, Headers: headers, ExpiresAt: expiresAt}, nil
+}
+
+func (s *S3Storage) Stat(filename string) (*ObjectInfo, error) {
+	out, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: &s.bucket,
+		Key:    &filename,
+	})
+	if isNotFound(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat S3 object: %w", err)
+	}
+	info := &ObjectInfo{
+		Size:        out.ContentLength,
+		ContentType: aws.ToString(out.ContentType),
+		ETag:        aws.ToString(out.ETag),
+	}
+	if out.LastModified != nil {
+		info.ModTime = *out.LastModified
+	}
+	return info, nil
+}
+
+// OpenAt reads an object from offset with a ranged GET
+func (s *S3Storage) OpenAt(filename string, offset int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &filename,
+	}
+	if offset > 0 {
+		input.Range = stringPtr(fmt.Sprintf("bytes=%d-", offset))
+	}
+	out, err := s.client.GetObject(context.Background(), input)
+	if isNotFound(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from S3: %w", err)
+	}
+	// Not every S3-compatible service honours ranges
+	if offset > 0 && out.ContentRange == nil {
+		if _, err := io.CopyN(io.Discard, out.Body, offset); err != nil {
+			out.Body.Close()
+			return nil, fmt.Errorf("failed to read from S3: %w", err)
+		}
+	}
+	return out.Body, nil
+}
+
+func (s *S3Storage) ReadHead(filename string, n int64) ([]byte, error) {
+	rangeHeader := fmt.Sprintf("bytes=0-%d", n-1)
+	out, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &filename,
+		Range:  &rangeHeader,
+	})
+	if isNotFound(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from S3: %w", err)
+	}
+	defer out.Body.Close()
+	// Not every S3-compatible service honours ranges
+	data, err := io.ReadAll(io.LimitReader(out.Body, n))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from S3: %w", err)
+	}
+	return data, nil
+}
+
+func (s *S3Storage) Copy(src, dst string) error {
+	source := copySource(s.bucket, src)
+	_, err := s.client.CopyObject(context.Background(), &s3.CopyObjectInput{
+		Bucket:     &s.bucket,
+		Key:        &dst,
+		CopySource: &source,
+	})
+	if isNotFound(err) {
+		return ErrNotExist
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy S3 object: %w", err)
+	}
+	return nil
+}
+
+// copySource builds the URL encoded bucket/key value CopyObject expects
+func copySource(bucket, key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return bucket + "/" + strings.Join(parts, "/")
+}
+
+// isNotFound reports whether an S3 call failed because the object does not exist.
+// HEAD responses have no body, so they only carry the status code.
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return true
+	}
+	var responseErr *awshttp.ResponseError
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound
+}
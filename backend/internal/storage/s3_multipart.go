@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// s3MinPartSize is the smallest part S3 accepts other than the last one
+	s3MinPartSize = 5 << 20
+	// defaultS3PartSize is the part size used unless WithPartSize is given
+	defaultS3PartSize = 8 << 20
+	// pendingSuffix names the object holding data received since the last part
+	pendingSuffix = ".pending"
+)
+
+// s3ChunkState tracks a chunked upload to S3. Chunks rarely line up with parts, so data
+// is sent in parts of a fixed size and the remainder waits in a separate object until
+// the next chunk fills a part or the upload finishes.
+type s3ChunkState struct {
+	UploadID string   `json:"upload_id"`
+	Parts    []s3Part `json:"parts,omitempty"`
+	// Pending is the number of bytes waiting in the pending object
+	Pending int64 `json:"pending,omitempty"`
+}
+
+type s3Part struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// size returns the number of bytes received so far
+func (st *s3ChunkState) size() int64 {
+	size := st.Pending
+	for _, part := range st.Parts {
+		size += part.Size
+	}
+	return size
+}
+
+func decodeS3State(state string) (*s3ChunkState, error) {
+	var st s3ChunkState
+	if err := json.Unmarshal([]byte(state), &st); err != nil || st.UploadID == "" {
+		return nil, fmt.Errorf("invalid chunked upload state")
+	}
+	return &st, nil
+}
+
+func (st *s3ChunkState) encode() string {
+	data, _ := json.Marshal(st)
+	return string(data)
+}
+
+// StartChunked creates an S3 multipart upload
+func (s *S3Storage) StartChunked(filename, contentType string) (string, error) {
+	output, err := s.client.CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+		Bucket:      &s.bucket,
+		Key:         &filename,
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start S3 multipart upload: %w", err)
+	}
+	if output.UploadId == nil {
+		return "", fmt.Errorf("S3 returned no upload ID")
+	}
+	return (&s3ChunkState{UploadID: *output.UploadId}).encode(), nil
+}
+
+// WriteChunk sends every full part of the pending data and content to S3 and keeps the
+// remainder in the pending object
+func (s *S3Storage) WriteChunk(filename, state string, offset int64, content io.Reader) (int64, string, error) {
+	st, err := decodeS3State(state)
+	if err != nil {
+		return 0, state, err
+	}
+	if offset != st.size() {
+		return 0, state, ErrChunkOffset
+	}
+
+	buf := make([]byte, 0, s.partSize)
+	if st.Pending > 0 {
+		pending, err := s.readObject(filename + pendingSuffix)
+		if err != nil {
+			return 0, state, err
+		}
+		if int64(len(pending)) != st.Pending {
+			return 0, state, fmt.Errorf("pending data of %s has %d bytes, expected %d", filename, len(pending), st.Pending)
+		}
+		buf = append(buf, pending...)
+	}
+
+	var writeErr error
+	for {
+		n, err := io.ReadFull(content, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if len(buf) == cap(buf) {
+			part, uploadErr := s.uploadPart(filename, st.UploadID, int32(len(st.Parts)+1), buf)
+			if uploadErr != nil {
+				writeErr = uploadErr
+				break
+			}
+			// The part includes any previously pending data
+			st.Parts = append(st.Parts, *part)
+			st.Pending = 0
+			buf = buf[:0]
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			writeErr = fmt.Errorf("failed to read chunk: %w", err)
+			break
+		}
+	}
+
+	// Keep whatever was received but not sent as a part, even if reading failed
+	if len(buf) > 0 {
+		if _, err := s.client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket: &s.bucket,
+			Key:    stringPtr(filename + pendingSuffix),
+			Body:   bytes.NewReader(buf),
+		}); err != nil {
+			return st.size() - offset, st.encode(), fmt.Errorf("failed to store pending upload data: %w", err)
+		}
+		st.Pending = int64(len(buf))
+	}
+	return st.size() - offset, st.encode(), writeErr
+}
+
+// FinishChunked sends the pending data as the last part and completes the multipart upload
+func (s *S3Storage) FinishChunked(filename, state string) error {
+	st, err := decodeS3State(state)
+	if err != nil {
+		return err
+	}
+	// An empty file still needs one part
+	if st.Pending > 0 || len(st.Parts) == 0 {
+		var pending []byte
+		if st.Pending > 0 {
+			if pending, err = s.readObject(filename + pendingSuffix); err != nil {
+				return err
+			}
+		}
+		part, err := s.uploadPart(filename, st.UploadID, int32(len(st.Parts)+1), pending)
+		if err != nil {
+			return err
+		}
+		st.Parts = append(st.Parts, *part)
+	}
+
+	completed := make([]types.CompletedPart, len(st.Parts))
+	for i, part := range st.Parts {
+		completed[i] = types.CompletedPart{PartNumber: part.Number, ETag: stringPtr(part.ETag)}
+	}
+	if _, err := s.client.CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:          &s.bucket,
+		Key:             &filename,
+		UploadId:        &st.UploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	}); err != nil {
+		return fmt.Errorf("failed to complete S3 multipart upload: %w", err)
+	}
+	s.deletePending(filename)
+	return nil
+}
+
+// AbortChunked aborts the multipart upload, letting S3 discard its parts
+func (s *S3Storage) AbortChunked(filename, state string) error {
+	st, err := decodeS3State(state)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   &s.bucket,
+		Key:      &filename,
+		UploadId: &st.UploadID,
+	}); err != nil {
+		var noUpload *types.NoSuchUpload
+		if !errors.As(err, &noUpload) {
+			return fmt.Errorf("failed to abort S3 multipart upload: %w", err)
+		}
+	}
+	s.deletePending(filename)
+	return nil
+}
+
+// Open reads a stored object
+func (s *S3Storage) Open(filename string) (io.ReadCloser, error) {
+	return s.OpenAt(filename, 0)
+}
+
+func (s *S3Storage) uploadPart(filename, uploadID string, number int32, data []byte) (*s3Part, error) {
+	output, err := s.client.UploadPart(context.Background(), &s3.UploadPartInput{
+		Bucket:        &s.bucket,
+		Key:           &filename,
+		UploadId:      &uploadID,
+		PartNumber:    number,
+		Body:          bytes.NewReader(data),
+		ContentLength: int64(len(data)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload part %d to S3: %w", number, err)
+	}
+	if output.ETag == nil {
+		return nil, fmt.Errorf("S3 returned no ETag for part %d", number)
+	}
+	return &s3Part{Number: number, ETag: *output.ETag, Size: int64(len(data))}, nil
+}
+
+func (s *S3Storage) readObject(key string) ([]byte, error) {
+	body, err := s.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from S3: %w", err)
+	}
+	return data, nil
+}
+
+// deletePending removes the pending object. Failures are ignored since the object is
+// ignored once its size is no longer recorded in the state.
+func (s *S3Storage) deletePending(filename string) {
+	_, _ = s.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: &s.bucket,
+		Key:    stringPtr(filename + pendingSuffix),
+	})
+}
+
+// stringPtr returns a pointer to s for the SDK's optional string fields
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,414 @@
+// Package s3test provides a local S3-compatible server for tests. It keeps one bucket in
+// memory, supports the object and listing operations the storage package uses, and
+// checks the signature of every request, including presigned URLs, as S3 would.
+package s3test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// Region, AccessKeyID and SecretAccessKey are the only credentials the server accepts
+	Region          = "us-east-1"
+	AccessKeyID     = "TESTACCESSKEY"
+	SecretAccessKey = "test-secret-key"
+
+	amzDateFormat = "20060102T150405Z"
+)
+
+var credentialPattern = regexp.MustCompile(`Credential=([^/]+)/\d{8}/([^/]+)/s3/aws4_request, SignedHeaders=([^,]+), Signature=([0-9a-f]+)`)
+
+type object struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+// Server is an in-memory S3 bucket served over HTTP
+type Server struct {
+	// URL is the endpoint to configure clients with; buckets are addressed by path
+	URL    string
+	Bucket string
+
+	server  *httptest.Server
+	signer  *v4.Signer
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+// NewServer starts a server holding an empty bucket. Call Close when done.
+func NewServer(bucket string) *Server {
+	s := &Server{
+		Bucket:  bucket,
+		objects: make(map[string]object),
+		signer: v4.NewSigner(func(o *v4.SignerOptions) {
+			o.DisableURIPathEscaping = true
+		}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns an SDK client for the server
+func (s *Server) Client() *s3.Client {
+	return s3.New(s3.Options{
+		Region:       Region,
+		BaseEndpoint: aws.String(s.URL),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return credentials(), nil
+		}),
+	})
+}
+
+// Object returns a stored object's content and type
+func (s *Server) Object(key string) ([]byte, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	return obj.data, obj.contentType, ok
+}
+
+// PutObject stores an object as if a client had uploaded it
+func (s *Server) PutObject(key string, data []byte, contentType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = object{data: data, contentType: contentType, modified: time.Now()}
+}
+
+func credentials() aws.Credentials {
+	return aws.Credentials{AccessKeyID: AccessKeyID, SecretAccessKey: SecretAccessKey}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	if code, message := s.authenticate(r); code != "" {
+		writeError(w, http.StatusForbidden, code, message)
+		return
+	}
+	if key == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			s.listObjects(w, r.URL.Query())
+			return
+		}
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "Only listing objects is supported on the bucket")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			s.copyObject(w, key, source)
+			return
+		}
+		s.putObject(w, r, key)
+	case http.MethodGet, http.MethodHead:
+		s.getObject(w, r, key)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not allowed")
+	}
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	if r.ContentLength < 0 {
+		writeError(w, http.StatusLengthRequired, "MissingContentLength", "You must provide the Content-Length HTTP header")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil || int64(len(data)) != r.ContentLength {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", "The request body is shorter than Content-Length")
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	obj := object{data: data, contentType: contentType, modified: time.Now()}
+	s.mu.Lock()
+	s.objects[key] = obj
+	s.mu.Unlock()
+	w.Header().Set("ETag", etag(data))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, key, source string) {
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid copy source")
+		return
+	}
+	bucket, sourceKey, _ := strings.Cut(source, "/")
+
+	s.mu.Lock()
+	obj, ok := s.objects[sourceKey]
+	if ok && bucket == s.Bucket {
+		obj.modified = time.Now()
+		s.objects[key] = obj
+	}
+	s.mu.Unlock()
+	if !ok || bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><CopyObjectResult><ETag>%s</ETag><LastModified>%s</LastModified></CopyObjectResult>`,
+		etag(obj.data), obj.modified.UTC().Format(time.RFC3339))
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	obj, ok := s.objects[key]
+	s.mu.Unlock()
+	if !ok {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+
+	data := obj.data
+	status := http.StatusOK
+	if header := r.Header.Get("Range"); header != "" && r.Method == http.MethodGet {
+		start, end, ok := parseRange(header, int64(len(data)))
+		if !ok {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Type", obj.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("ETag", etag(obj.data))
+	w.Header().Set("Last-Modified", obj.modified.UTC().Format(http.TimeFormat))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+type listedObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+// listObjects answers ListObjectsV2 in pages of max-keys objects. The continuation token
+// is the last key of the previous page.
+func (s *Server) listObjects(w http.ResponseWriter, query url.Values) {
+	maxKeys := 1000
+	if raw := query.Get("max-keys"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+	prefix := query.Get("prefix")
+	after := query.Get("continuation-token")
+
+	s.mu.Lock()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	truncated := len(keys) > maxKeys
+	if truncated {
+		keys = keys[:maxKeys]
+	}
+	contents := make([]listedObject, len(keys))
+	for i, key := range keys {
+		obj := s.objects[key]
+		contents[i] = listedObject{
+			Key:          key,
+			LastModified: obj.modified.UTC().Format(time.RFC3339),
+			ETag:         etag(obj.data),
+			Size:         len(obj.data),
+		}
+	}
+	s.mu.Unlock()
+
+	result := struct {
+		XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name                  string
+		Prefix                string
+		KeyCount              int
+		MaxKeys               int
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []listedObject
+	}{Name: s.Bucket, Prefix: prefix, KeyCount: len(contents), MaxKeys: maxKeys, IsTruncated: truncated, Contents: contents}
+	if truncated {
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// parseRange handles the single "bytes=start-end" ranges the storage package sends
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+// authenticate checks a request's signature, returning an S3 error code when it is
+// missing, expired or wrong
+func (s *Server) authenticate(r *http.Request) (string, string) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Signature") != "" {
+		return s.checkPresigned(r, query)
+	}
+	return s.checkAuthorization(r)
+}
+
+func (s *Server) checkPresigned(r *http.Request, query url.Values) (string, string) {
+	signingTime, err := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return "AuthorizationQueryParametersError", "Invalid X-Amz-Date"
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return "AuthorizationQueryParametersError", "Invalid X-Amz-Expires"
+	}
+	if time.Now().After(signingTime.Add(time.Duration(expires) * time.Second)) {
+		return "AccessDenied", "Request has expired"
+	}
+	credential := strings.Split(query.Get("X-Amz-Credential"), "/")
+	if len(credential) != 5 || credential[0] != AccessKeyID {
+		return "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."
+	}
+
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+	req := s.unsignedCopy(r, query, strings.Split(query.Get("X-Amz-SignedHeaders"), ";"))
+	signed, _, err := s.signer.PresignHTTP(r.Context(), credentials(), req, "UNSIGNED-PAYLOAD", "s3", credential[2], signingTime)
+	if err != nil {
+		return "InternalError", err.Error()
+	}
+	signedURL, err := url.Parse(signed)
+	if err != nil || signedURL.Query().Get("X-Amz-Signature") != signature {
+		return "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	}
+	return "", ""
+}
+
+func (s *Server) checkAuthorization(r *http.Request) (string, string) {
+	match := credentialPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if match == nil {
+		return "AccessDenied", "Access Denied"
+	}
+	if match[1] != AccessKeyID {
+		return "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."
+	}
+	signingTime, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return "AccessDenied", "Invalid X-Amz-Date"
+	}
+
+	req := s.unsignedCopy(r, r.URL.Query(), strings.Split(match[3], ";"))
+	err = s.signer.SignHTTP(r.Context(), credentials(), req, r.Header.Get("X-Amz-Content-Sha256"), "s3", match[2], signingTime)
+	if err != nil {
+		return "InternalError", err.Error()
+	}
+	if req.Header.Get("Authorization") != r.Header.Get("Authorization") {
+		return "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."
+	}
+	return "", ""
+}
+
+// unsignedCopy rebuilds a request with only the headers the client signed, so the
+// signature can be computed again
+func (s *Server) unsignedCopy(r *http.Request, query url.Values, signedHeaders []string) *http.Request {
+	u := *r.URL
+	u.Scheme = "http"
+	u.Host = r.Host
+	u.RawQuery = query.Encode()
+	req := &http.Request{Method: r.Method, URL: &u, Host: r.Host, Header: make(http.Header)}
+	for _, name := range signedHeaders {
+		switch strings.ToLower(name) {
+		case "host":
+		case "content-length":
+			req.ContentLength = r.ContentLength
+		default:
+			if values, ok := r.Header[http.CanonicalHeaderKey(name)]; ok {
+				req.Header[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+	}
+	return req
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
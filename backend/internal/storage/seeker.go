@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// seeker reads a stored file of known size from any offset. Nothing is read until Read
+// is called, and seeking only drops the open stream, so a request for the end of a
+// large file does not fetch the rest of it.
+type seeker struct {
+	reader   Reader
+	filename string
+	size     int64
+	offset   int64
+	body     io.ReadCloser
+}
+
+// NewSeeker returns a ReadSeekCloser over a stored file of size bytes, as http.ServeContent
+// needs to answer Range requests
+func NewSeeker(reader Reader, filename string, size int64) io.ReadSeekCloser {
+	return &seeker{reader: reader, filename: filename, size: size}
+}
+
+func (s *seeker) Read(p []byte) (int, error) {
+	if s.offset >= s.size {
+		return 0, io.EOF
+	}
+	if s.body == nil {
+		body, err := s.reader.OpenAt(s.filename, s.offset)
+		if err != nil {
+			return 0, err
+		}
+		s.body = body
+	}
+	if remaining := s.size - s.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := s.body.Read(p)
+	s.offset += int64(n)
+	if err == io.EOF && s.offset < s.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (s *seeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	if offset != s.offset {
+		s.closeBody()
+		s.offset = offset
+	}
+	return offset, nil
+}
+
+func (s *seeker) Close() error {
+	return s.closeBody()
+}
+
+func (s *seeker) closeBody() error {
+	if s.body == nil {
+		return nil
+	}
+	err := s.body.Close()
+	s.body = nil
+	return err
+}
@@ -3,9 +3,13 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -26,6 +30,46 @@ func (m *mockS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObject
     return args.Get(0).(*s3.DeleteObjectOutput), args.Error(1)
 }
 
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+    args := m.Called(ctx, params, optFns)
+    return args.Get(0).(*s3.GetObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+    args := m.Called(ctx, params, optFns)
+    return args.Get(0).(*s3.HeadObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+    args := m.Called(ctx, params, optFns)
+    return args.Get(0).(*s3.CopyObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+    args := m.Called(ctx, params, optFns)
+    return args.Get(0).(*s3.CreateMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+    args := m.Called(ctx, params, optFns)
+    return args.Get(0).(*s3.UploadPartOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+    args := m.Called(ctx, params, optFns)
+    return args.Get(0).(*s3.CompleteMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+    args := m.Called(ctx, params, optFns)
+    return args.Get(0).(*s3.AbortMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+    args := m.Called(ctx, params, optFns)
+    return args.Get(0).(*s3.ListObjectsV2Output), args.Error(1)
+}
+
 func TestLocalStorage(t *testing.T) {
     // Setup
     tmpDir := t.TempDir()
@@ -141,4 +185,63 @@ func TestS3Storage(t *testing.T) {
             mockClient.AssertExpectations(t)
         })
     }
-} 
\ No newline at end of file
+}
+
+// Mock S3 presign client
+type mockS3Presigner struct {
+    mock.Mock
+}
+
+func (m *mockS3Presigner) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+    args := m.Called(ctx, params, optFns)
+    if args.Get(0) == nil {
+        return nil, args.Error(1)
+    }
+    return args.Get(0).(*v4.PresignedHTTPRequest), args.Error(1)
+}
+
+func (m *mockS3Presigner) PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+    args := m.Called(ctx, params, optFns)
+    if args.Get(0) == nil {
+        return nil, args.Error(1)
+    }
+    return args.Get(0).(*v4.PresignedHTTPRequest), args.Error(1)
+}
+
+func TestLocalStoragePath(t *testing.T) {
+    tmpDir := t.TempDir()
+    storage := NewLocalStorage(tmpDir, "/api/media").(*LocalStorage)
+
+    path, err := storage.Path("1_abc.jpg")
+    assert.NoError(t, err)
+    assert.Equal(t, filepath.Join(tmpDir, "1_abc.jpg"), path)
+
+    path, err = storage.Path("../../etc/passwd")
+    assert.NoError(t, err)
+    assert.Equal(t, filepath.Join(tmpDir, "etc/passwd"), path)
+
+    _, err = storage.Path("")
+    assert.Error(t, err)
+}
+
+func TestS3StoragePresignGet(t *testing.T) {
+    mockPresigner := new(mockS3Presigner)
+    storage := NewS3Storage(new(mockS3Client), "test-bucket", "https://test-bucket.s3.amazonaws.com", WithPresignClient(mockPresigner))
+
+    mockPresigner.On("PresignGetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+        return *input.Bucket == "test-bucket" && *input.Key == "test.jpg"
+    }), mock.Anything).Return(&v4.PresignedHTTPRequest{URL: "https://signed.example/test.jpg"}, nil).Once()
+
+    url, err := storage.PresignGet("test.jpg", time.Minute)
+    assert.NoError(t, err)
+    assert.Equal(t, "https://signed.example/test.jpg", url)
+
+    mockPresigner.On("PresignGetObject", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("boom")).Once()
+    _, err = storage.PresignGet("test.jpg", time.Minute)
+    assert.Error(t, err)
+
+    _, err = NewS3Storage(new(mockS3Client), "test-bucket", "").PresignGet("test.jpg", time.Minute)
+    assert.Error(t, err)
+
+    mockPresigner.AssertExpectations(t)
+}
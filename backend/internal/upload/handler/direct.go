@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Mousa96/chatting-service/internal/middleware"
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+)
+
+// DirectURLPrefix is the path direct uploads are created under. Each slot is completed
+// with a POST to DirectURLPrefix/<id>/complete.
+const DirectURLPrefix = URLPrefix + "/direct"
+
+// maxDirectRequestSize bounds the JSON body of a request for a direct upload slot
+const maxDirectRequestSize = 4 << 10
+
+// CreateDirectUpload godoc
+// @Summary Request a direct upload slot
+// @Description Get a presigned request to send a file straight to storage. Send the file with exactly the returned method, URL and headers, then POST to complete_url to turn it into an attachment.
+// @Tags uploads
+// @Accept json
+// @Produce json
+// @Param request body models.CreateDirectUploadRequest true "File name, content type and size in bytes"
+// @Success 201 {object} models.DirectUploadResponse
+// @Failure 400 {string} string "Invalid size, or a content type that cannot be uploaded directly"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 413 {string} string "File exceeds the maximum upload size"
+// @Failure 501 {string} string "The storage backend does not support direct uploads"
+// @Security Bearer
+// @Router /uploads/direct [post]
+func (h *UploadHandler) CreateDirectUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateDirectUploadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDirectRequestSize)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	upload, presigned, err := h.uploadService.CreateDirect(userID, req.Filename, req.ContentType, req.Size)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	resp := directResponse(upload)
+	resp.Upload = &models.PresignedRequest{
+		Method:    presigned.Method,
+		URL:       presigned.URL,
+		Headers:   presigned.Headers,
+		ExpiresAt: presigned.ExpiresAt,
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// CompleteDirectUpload godoc
+// @Summary Complete a direct upload
+// @Description Check the file sent to a direct upload slot and store it as an attachment. The file must have the declared size and content type, otherwise it is deleted along with the slot.
+// @Tags uploads
+// @Produce json
+// @Param id path string true "Direct upload ID"
+// @Success 200 {object} models.DirectUploadResponse
+// @Failure 400 {string} string "The file does not match the declared size or content type"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Upload not found"
+// @Failure 409 {string} string "The file has not been uploaded yet"
+// @Failure 410 {string} string "Upload expired"
+// @Failure 423 {string} string "The upload is already being completed"
+// @Failure 501 {string} string "The storage backend does not support direct uploads"
+// @Security Bearer
+// @Router /uploads/direct/{id}/complete [post]
+func (h *UploadHandler) CompleteDirectUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, DirectURLPrefix+"/"), "/complete")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	upload, err := h.uploadService.CompleteDirect(userID, id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, directResponse(upload))
+}
+
+func directResponse(upload *models.DirectUpload) *models.DirectUploadResponse {
+	return &models.DirectUploadResponse{
+		ID:           upload.ID,
+		CompleteURL:  DirectURLPrefix + "/" + upload.ID + "/complete",
+		AttachmentID: upload.AttachmentID,
+		ExpiresAt:    upload.ExpiresAt,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode upload response: %v", err)
+	}
+}
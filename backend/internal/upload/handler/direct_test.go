@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/middleware"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/Mousa96/chatting-service/internal/storage/s3test"
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+	"github.com/Mousa96/chatting-service/internal/upload/repository"
+	"github.com/Mousa96/chatting-service/internal/upload/service"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func authenticated(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+}
+
+func TestDirectUploadFlow(t *testing.T) {
+	server := s3test.NewServer("media")
+	defer server.Close()
+	client := server.Client()
+	store := storage.NewS3Storage(client, "media", "/api/media", storage.WithPresignClient(s3.NewPresignClient(client)))
+	svc := service.NewUploadService(repository.NewTestUploadRepository(), store, &importer{}, 1024, time.Hour,
+		service.WithDirectUploads(store, time.Minute, []string{"video/mp4"}))
+	h := NewUploadHandler(svc)
+
+	video := "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"
+	rr := httptest.NewRecorder()
+	h.CreateDirectUpload(rr, authenticated(httptest.NewRequest(http.MethodPost, DirectURLPrefix,
+		strings.NewReader(`{"filename":"clip.mp4","content_type":"video/mp4","size":24}`))))
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var slot models.DirectUploadResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&slot))
+	require.NotNil(t, slot.Upload)
+	assert.Equal(t, DirectURLPrefix+"/"+slot.ID+"/complete", slot.CompleteURL)
+	assert.Nil(t, slot.AttachmentID)
+
+	req, err := http.NewRequest(slot.Upload.Method, slot.Upload.URL, strings.NewReader(video))
+	require.NoError(t, err)
+	for name, value := range slot.Upload.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	rr = httptest.NewRecorder()
+	h.CompleteDirectUpload(rr, authenticated(httptest.NewRequest(http.MethodPost, slot.CompleteURL, nil)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var done models.DirectUploadResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&done))
+	require.NotNil(t, done.AttachmentID)
+	assert.Equal(t, 8, *done.AttachmentID)
+}
+
+func TestDirectUploadErrors(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	rr := httptest.NewRecorder()
+	h.CreateDirectUpload(rr, authenticated(httptest.NewRequest(http.MethodPost, DirectURLPrefix, strings.NewReader("{"))))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Local storage cannot take direct uploads
+	rr = httptest.NewRecorder()
+	h.CreateDirectUpload(rr, authenticated(httptest.NewRequest(http.MethodPost, DirectURLPrefix,
+		strings.NewReader(`{"filename":"clip.mp4","content_type":"video/mp4","size":24}`))))
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+
+	rr = httptest.NewRecorder()
+	h.CompleteDirectUpload(rr, authenticated(httptest.NewRequest(http.MethodPost, DirectURLPrefix+"/abc/other", nil)))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	h.CompleteDirectUpload(rr, httptest.NewRequest(http.MethodPost, DirectURLPrefix+"/abc/complete", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,295 @@
+// Package handler implements the tus resumable upload protocol (https://tus.io/protocols/resumable-upload)
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+	"github.com/Mousa96/chatting-service/internal/upload/service"
+)
+
+const (
+	// URLPrefix is the path uploads are created under; each upload lives at URLPrefix/<id>
+	URLPrefix = "/api/uploads"
+
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	// offsetContentType is the only body type tus allows for PATCH requests
+	offsetContentType = "application/offset+octet-stream"
+	// chunkTimeout replaces the server's read and write timeouts for PATCH requests,
+	// which stream a whole chunk in the request body
+	chunkTimeout = 10 * time.Minute
+)
+
+// UploadHandler provides the implementation of the Handler interface
+type UploadHandler struct {
+	uploadService service.Service
+}
+
+// NewUploadHandler creates a new UploadHandler instance
+func NewUploadHandler(uploadService service.Service) Handler {
+	return &UploadHandler{uploadService: uploadService}
+}
+
+// Options godoc
+// @Summary Discover tus support
+// @Description Report the tus protocol version, extensions and maximum upload size
+// @Tags uploads
+// @Success 204 {string} string "Tus-Version, Tus-Extension and Tus-Max-Size headers"
+// @Router /uploads [options]
+func (h *UploadHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.uploadService.MaxSize(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUpload godoc
+// @Summary Start a resumable upload
+// @Description Create a tus upload. Send the file with PATCH requests to the returned Location; once complete the Upload-Attachment-Id header holds the attachment to reference in attachment_ids.
+// @Tags uploads
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Param Upload-Length header int true "File size in bytes"
+// @Param Upload-Metadata header string false "Comma separated key and base64 value pairs; filename is used"
+// @Success 201 {string} string "Location and Upload-Expires headers"
+// @Failure 400 {string} string "Missing or invalid Upload-Length or Upload-Metadata"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 412 {string} string "Unsupported tus version"
+// @Failure 413 {string} string "Upload exceeds Tus-Max-Size"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /uploads [post]
+func (h *UploadHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Upload-Defer-Length is not supported", http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.uploadService.Create(userID, length, metadata["filename"])
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", URLPrefix+"/"+upload.ID)
+	setProgressHeaders(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// GetUpload godoc
+// @Summary Get upload progress
+// @Description Report how many bytes of a tus upload have been received
+// @Tags uploads
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Success 200 {string} string "Upload-Offset, Upload-Length and Upload-Expires headers, and Upload-Attachment-Id once complete"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Upload not found"
+// @Failure 410 {string} string "Upload expired"
+// @Failure 412 {string} string "Unsupported tus version"
+// @Security Bearer
+// @Router /uploads/{id} [head]
+func (h *UploadHandler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+
+	upload, err := h.uploadService.Get(userID, uploadID(r))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	setProgressHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// PatchUpload godoc
+// @Summary Send a chunk
+// @Description Append the request body to a tus upload at Upload-Offset. The response to the chunk that completes the file carries Upload-Attachment-Id.
+// @Tags uploads
+// @Accept application/offset+octet-stream
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Param Upload-Offset header int true "Offset the chunk starts at"
+// @Success 204 {string} string "New Upload-Offset"
+// @Failure 400 {string} string "Invalid Upload-Offset, or the completed file was rejected"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Upload not found"
+// @Failure 409 {string} string "Upload-Offset does not match the upload"
+// @Failure 410 {string} string "Upload expired"
+// @Failure 412 {string} string "Unsupported tus version"
+// @Failure 413 {string} string "Chunk goes past Upload-Length"
+// @Failure 415 {string} string "Content-Type is not application/offset+octet-stream"
+// @Failure 423 {string} string "Another request is writing to the upload"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /uploads/{id} [patch]
+func (h *UploadHandler) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != offsetContentType {
+		http.Error(w, "Content-Type must be "+offsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	// Chunks may take longer to arrive than the server's timeouts allow
+	controller := http.NewResponseController(w)
+	deadline := time.Now().Add(chunkTimeout)
+	if err := controller.SetReadDeadline(deadline); err == nil {
+		controller.SetWriteDeadline(deadline)
+	}
+
+	upload, err := h.uploadService.WriteChunk(userID, uploadID(r), offset, r.ContentLength, r.Body)
+	if upload != nil {
+		setProgressHeaders(w, upload)
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUpload godoc
+// @Summary Discard an upload
+// @Description Terminate a tus upload and delete what was received
+// @Tags uploads
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Success 204 {string} string "Upload discarded"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Upload not found"
+// @Failure 412 {string} string "Unsupported tus version"
+// @Security Bearer
+// @Router /uploads/{id} [delete]
+func (h *UploadHandler) DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.begin(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.uploadService.Terminate(userID, uploadID(r)); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// begin sets the Tus-Resumable header, checks the client speaks the same protocol
+// version and returns the current user
+func (h *UploadHandler) begin(w http.ResponseWriter, r *http.Request) (int, bool) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return 0, false
+	}
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+	return userID, true
+}
+
+// uploadID extracts the upload ID from a request path
+func uploadID(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, URLPrefix+"/")
+}
+
+// setProgressHeaders reports an upload's offset, length, expiry and attachment
+func setProgressHeaders(w http.ResponseWriter, upload *models.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.AttachmentID != nil {
+		w.Header().Set("Upload-Attachment-Id", strconv.Itoa(*upload.AttachmentID))
+	}
+}
+
+// parseMetadata decodes an Upload-Metadata header: comma separated pairs of a key and a
+// base64 encoded value, where the value may be left out
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid Upload-Metadata")
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata value for %s", fields[0])
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata, nil
+}
+
+// writeServiceError maps service errors to HTTP responses
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, service.ErrTooLarge), errors.Is(err, service.ErrChunkTooLarge),
+		errors.Is(err, msgService.ErrQuotaExceeded), errors.Is(err, msgService.ErrMediaTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, service.ErrInvalidLength), errors.Is(err, msgService.ErrInvalidMedia):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrOffsetMismatch), errors.Is(err, service.ErrNotUploaded):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrLocked):
+		http.Error(w, err.Error(), http.StatusLocked)
+	case errors.Is(err, service.ErrDirectUnavailable):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, msgService.ErrScanFailed):
+		http.Error(w, "file could not be scanned, try again later", http.StatusServiceUnavailable)
+	default:
+		log.Printf("Upload operation failed: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/middleware"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/Mousa96/chatting-service/internal/upload/repository"
+	"github.com/Mousa96/chatting-service/internal/upload/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importer accepts every file except ones starting with "MZ"
+type importer struct {
+	filename string
+	quotaErr error
+}
+
+func (i *importer) ImportMedia(userID int, filename string, content io.ReadSeeker, size int64) (*mediaModels.Attachment, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(string(data), "MZ") {
+		return nil, fmt.Errorf("%w: file type not allowed", msgService.ErrInvalidMedia)
+	}
+	i.filename = filename
+	return &mediaModels.Attachment{ID: 7}, nil
+}
+
+func (i *importer) AdoptMedia(userID int, key, filename, contentType string, size int64) (*mediaModels.Attachment, error) {
+	i.filename = filename
+	return &mediaModels.Attachment{ID: 8}, nil
+}
+
+func (i *importer) CheckQuota(userID int, size int64) error {
+	return i.quotaErr
+}
+
+func (i *importer) CheckMedia(contentType string, size int64) error {
+	return msgService.DefaultMediaPolicy().Check(contentType, size)
+}
+
+func newTestHandler(t *testing.T) (Handler, *importer) {
+	imp := &importer{}
+	store := storage.NewLocalStorage(t.TempDir(), "/api/media").(service.ChunkStorage)
+	svc := service.NewUploadService(repository.NewTestUploadRepository(), store, imp, 1024, time.Hour)
+	return NewUploadHandler(svc), imp
+}
+
+// tusRequest builds an authenticated tus request from user 1
+func tusRequest(method, path, body string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+}
+
+func create(t *testing.T, h Handler, length int, filename string) string {
+	rr := httptest.NewRecorder()
+	h.CreateUpload(rr, tusRequest(http.MethodPost, "/api/uploads", "", map[string]string{
+		"Upload-Length":   fmt.Sprint(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(filename)) + ",is_private",
+	}))
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	location := rr.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, "/api/uploads/"))
+	assert.Equal(t, "0", rr.Header().Get("Upload-Offset"))
+	assert.NotEmpty(t, rr.Header().Get("Upload-Expires"))
+	return location
+}
+
+func patch(h Handler, location string, offset int, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h.PatchUpload(rr, tusRequest(http.MethodPatch, location, body, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": fmt.Sprint(offset),
+	}))
+	return rr
+}
+
+func TestOptions(t *testing.T) {
+	h, _ := newTestHandler(t)
+	rr := httptest.NewRecorder()
+	h.Options(rr, httptest.NewRequest(http.MethodOptions, "/api/uploads", nil))
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "1.0.0", rr.Header().Get("Tus-Version"))
+	assert.Equal(t, "creation,expiration,termination", rr.Header().Get("Tus-Extension"))
+	assert.Equal(t, "1024", rr.Header().Get("Tus-Max-Size"))
+}
+
+func TestUploadFlow(t *testing.T) {
+	h, imp := newTestHandler(t)
+	location := create(t, h, 11, "holiday.mp4")
+
+	rr := patch(h, location, 0, "hello ")
+	require.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "6", rr.Header().Get("Upload-Offset"))
+	assert.Empty(t, rr.Header().Get("Upload-Attachment-Id"))
+
+	// Resuming starts with a HEAD request for the offset
+	rr = httptest.NewRecorder()
+	h.GetUpload(rr, tusRequest(http.MethodHead, location, "", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "6", rr.Header().Get("Upload-Offset"))
+	assert.Equal(t, "11", rr.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+
+	rr = patch(h, location, 3, "lo world")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = patch(h, location, 6, "world")
+	require.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "11", rr.Header().Get("Upload-Offset"))
+	assert.Equal(t, "7", rr.Header().Get("Upload-Attachment-Id"))
+	assert.Equal(t, "holiday.mp4", imp.filename)
+}
+
+func TestUploadErrors(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	t.Run("missing protocol version", func(t *testing.T) {
+		req := tusRequest(http.MethodPost, "/api/uploads", "", map[string]string{"Upload-Length": "5"})
+		req.Header.Del("Tus-Resumable")
+		rr := httptest.NewRecorder()
+		h.CreateUpload(rr, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		assert.Equal(t, "1.0.0", rr.Header().Get("Tus-Version"))
+	})
+
+	t.Run("invalid creation headers", func(t *testing.T) {
+		for name, headers := range map[string]map[string]string{
+			"no length":      {},
+			"deferred":       {"Upload-Defer-Length": "1"},
+			"bad metadata":   {"Upload-Length": "5", "Upload-Metadata": "filename !!!"},
+			"zero length":    {"Upload-Length": "0"},
+			"negative value": {"Upload-Length": "-5"},
+		} {
+			rr := httptest.NewRecorder()
+			h.CreateUpload(rr, tusRequest(http.MethodPost, "/api/uploads", "", headers))
+			assert.Equal(t, http.StatusBadRequest, rr.Code, name)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.CreateUpload(rr, tusRequest(http.MethodPost, "/api/uploads", "", map[string]string{"Upload-Length": "2048"}))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+
+	t.Run("over quota", func(t *testing.T) {
+		h, imp := newTestHandler(t)
+		imp.quotaErr = fmt.Errorf("%w: out of space", msgService.ErrQuotaExceeded)
+		rr := httptest.NewRecorder()
+		h.CreateUpload(rr, tusRequest(http.MethodPost, "/api/uploads", "", map[string]string{"Upload-Length": "5"}))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+
+	t.Run("wrong content type", func(t *testing.T) {
+		location := create(t, h, 3, "a.bin")
+		rr := httptest.NewRecorder()
+		h.PatchUpload(rr, tusRequest(http.MethodPatch, location, "abc", map[string]string{
+			"Content-Type":  "application/octet-stream",
+			"Upload-Offset": "0",
+		}))
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	})
+
+	t.Run("chunk past the end", func(t *testing.T) {
+		location := create(t, h, 3, "a.bin")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, patch(h, location, 0, "abcd").Code)
+	})
+
+	t.Run("rejected file", func(t *testing.T) {
+		location := create(t, h, 3, "a.exe")
+		assert.Equal(t, http.StatusBadRequest, patch(h, location, 0, "MZ!").Code)
+		assert.Equal(t, http.StatusNotFound, patch(h, location, 0, "MZ!").Code)
+	})
+
+	t.Run("unknown upload", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.GetUpload(rr, tusRequest(http.MethodHead, "/api/uploads/missing", "", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("terminate", func(t *testing.T) {
+		location := create(t, h, 3, "a.bin")
+		rr := httptest.NewRecorder()
+		h.DeleteUpload(rr, tusRequest(http.MethodDelete, location, "", nil))
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, http.StatusNotFound, patch(h, location, 0, "abc").Code)
+	})
+}
+
+func TestParseMetadata(t *testing.T) {
+	metadata, err := parseMetadata("filename d29ybGQucGRm, is_confidential")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"filename": "world.pdf", "is_confidential": ""}, metadata)
+
+	metadata, err = parseMetadata("")
+	require.NoError(t, err)
+	assert.Empty(t, metadata)
+
+	_, err = parseMetadata("filename a b")
+	assert.Error(t, err)
+}
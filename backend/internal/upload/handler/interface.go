@@ -0,0 +1,22 @@
+// Package handler provides HTTP handlers for resumable uploads
+package handler
+
+import "net/http"
+
+// Handler defines the tus resumable upload and direct upload interface
+type Handler interface {
+	// Options describes the supported tus version, extensions and maximum size
+	Options(w http.ResponseWriter, r *http.Request)
+	// CreateUpload starts an upload
+	CreateUpload(w http.ResponseWriter, r *http.Request)
+	// GetUpload reports how much of an upload has been received
+	GetUpload(w http.ResponseWriter, r *http.Request)
+	// PatchUpload appends a chunk to an upload
+	PatchUpload(w http.ResponseWriter, r *http.Request)
+	// DeleteUpload discards an upload
+	DeleteUpload(w http.ResponseWriter, r *http.Request)
+	// CreateDirectUpload returns a presigned request for sending a file straight to storage
+	CreateDirectUpload(w http.ResponseWriter, r *http.Request)
+	// CompleteDirectUpload checks a directly uploaded file and stores it as an attachment
+	CompleteDirectUpload(w http.ResponseWriter, r *http.Request)
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// DirectUpload is a slot for a file the client sends straight to storage with a
+// presigned request. The client uploads to Key and then asks for the upload to be
+// completed, after which the file is checked and moved to its media key.
+type DirectUpload struct {
+	ID          string
+	OwnerID     int
+	Key         string
+	Filename    string
+	ContentType string
+	Size        int64
+	// AttachmentID is set once the file has been checked and stored as an attachment
+	AttachmentID *int
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// CreateDirectUploadRequest asks for a slot to upload a file straight to storage
+type CreateDirectUploadRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// PresignedRequest is the request a client makes to send its file to storage. Every
+// header must be sent as given.
+type PresignedRequest struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// DirectUploadResponse describes a direct upload slot and, once it has been completed,
+// the attachment to reference in attachment_ids
+type DirectUploadResponse struct {
+	ID           string            `json:"id"`
+	Upload       *PresignedRequest `json:"upload,omitempty"`
+	CompleteURL  string            `json:"complete_url"`
+	AttachmentID *int              `json:"attachment_id,omitempty"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+}
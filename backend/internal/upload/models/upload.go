@@ -0,0 +1,47 @@
+// Package models defines the data structures for resumable uploads
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// KeyPrefix is the storage prefix under which uploads are assembled before they are
+// turned into attachments
+const KeyPrefix = "uploads/"
+
+// Upload is a file being sent in chunks over several requests
+type Upload struct {
+	ID      string
+	OwnerID int
+	// Key is where the chunks are assembled in storage
+	Key      string
+	Filename string
+	// Length is the declared size of the file and Offset the number of bytes received
+	Length int64
+	Offset int64
+	// StorageState is the storage backend's opaque progress record
+	StorageState string
+	// Assembled is set once the storage backend has put the chunks together
+	Assembled bool
+	// AttachmentID is set once the finished file has been stored as an attachment
+	AttachmentID *int
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// Received reports whether every byte of the file has arrived
+func (u *Upload) Received() bool {
+	return u.Offset >= u.Length
+}
+
+// NewID returns a random upload ID. IDs appear in upload URLs, so they must not be guessable.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
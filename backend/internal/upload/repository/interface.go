@@ -0,0 +1,56 @@
+// Package repository provides data access for resumable uploads
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+)
+
+var (
+	// ErrNotFound is returned when an upload does not exist
+	ErrNotFound = errors.New("upload not found")
+	// ErrConflict is returned when an upload's offset changed since it was read
+	ErrConflict = errors.New("upload was modified concurrently")
+)
+
+// Repository defines the upload data access interface
+type Repository interface {
+	// Create stores a new upload and sets its creation time
+	Create(upload *models.Upload) error
+
+	// Get retrieves an upload by ID
+	Get(id string) (*models.Upload, error)
+
+	// UpdateProgress records a new offset, storage state and expiry, provided the upload
+	// is still at fromOffset. It returns ErrConflict otherwise.
+	UpdateProgress(id string, fromOffset, offset int64, state string, expiresAt time.Time) error
+
+	// MarkAssembled records that the storage backend has put the chunks together
+	MarkAssembled(id string) error
+
+	// SetAttachment records the attachment created from a finished upload
+	SetAttachment(id string, attachmentID int) error
+
+	// Delete removes an upload
+	Delete(id string) error
+
+	// ListExpired returns up to limit uploads that expired before the given time
+	ListExpired(before time.Time, limit int) ([]models.Upload, error)
+
+	// CreateDirect stores a new direct upload slot and sets its creation time
+	CreateDirect(upload *models.DirectUpload) error
+
+	// GetDirect retrieves a direct upload by ID
+	GetDirect(id string) (*models.DirectUpload, error)
+
+	// SetDirectAttachment records the attachment created from a direct upload
+	SetDirectAttachment(id string, attachmentID int) error
+
+	// DeleteDirect removes a direct upload
+	DeleteDirect(id string) error
+
+	// ListExpiredDirect returns up to limit direct uploads that expired before the given time
+	ListExpiredDirect(before time.Time, limit int) ([]models.DirectUpload, error)
+}
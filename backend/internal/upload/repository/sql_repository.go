@@ -0,0 +1,210 @@
+// Package repository implements the upload repository interface
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+)
+
+const uploadColumns = `id, owner_id, storage_key, filename, length, upload_offset, storage_state,
+        assembled, attachment_id, expires_at, created_at`
+
+// SQLUploadRepository provides a PostgreSQL implementation of Repository
+type SQLUploadRepository struct {
+	db *sql.DB
+}
+
+// NewUploadRepository creates a new SQLUploadRepository instance
+func NewUploadRepository(db *sql.DB) Repository {
+	return &SQLUploadRepository{db: db}
+}
+
+func scanUpload(row interface{ Scan(...interface{}) error }) (*models.Upload, error) {
+	var upload models.Upload
+	var attachmentID sql.NullInt64
+	if err := row.Scan(&upload.ID, &upload.OwnerID, &upload.Key, &upload.Filename, &upload.Length,
+		&upload.Offset, &upload.StorageState, &upload.Assembled, &attachmentID, &upload.ExpiresAt,
+		&upload.CreatedAt); err != nil {
+		return nil, err
+	}
+	if attachmentID.Valid {
+		id := int(attachmentID.Int64)
+		upload.AttachmentID = &id
+	}
+	return &upload, nil
+}
+
+func (r *SQLUploadRepository) Create(upload *models.Upload) error {
+	err := r.db.QueryRow(
+		`INSERT INTO uploads (id, owner_id, storage_key, filename, length, upload_offset, storage_state, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING created_at`,
+		upload.ID, upload.OwnerID, upload.Key, upload.Filename, upload.Length, upload.Offset,
+		upload.StorageState, upload.ExpiresAt,
+	).Scan(&upload.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLUploadRepository) Get(id string) (*models.Upload, error) {
+	upload, err := scanUpload(r.db.QueryRow(`SELECT `+uploadColumns+` FROM uploads WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	return upload, nil
+}
+
+func (r *SQLUploadRepository) UpdateProgress(id string, fromOffset, offset int64, state string, expiresAt time.Time) error {
+	result, err := r.db.Exec(
+		`UPDATE uploads SET upload_offset = $3, storage_state = $4, expires_at = $5
+        WHERE id = $1 AND upload_offset = $2`,
+		id, fromOffset, offset, state, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update upload: %w", err)
+	}
+	return expectRow(result, ErrConflict)
+}
+
+func (r *SQLUploadRepository) MarkAssembled(id string) error {
+	result, err := r.db.Exec(`UPDATE uploads SET assembled = TRUE WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to update upload: %w", err)
+	}
+	return expectRow(result, ErrNotFound)
+}
+
+func (r *SQLUploadRepository) SetAttachment(id string, attachmentID int) error {
+	result, err := r.db.Exec(`UPDATE uploads SET attachment_id = $2 WHERE id = $1`, id, attachmentID)
+	if err != nil {
+		return fmt.Errorf("failed to update upload: %w", err)
+	}
+	return expectRow(result, ErrNotFound)
+}
+
+func (r *SQLUploadRepository) Delete(id string) error {
+	if _, err := r.db.Exec(`DELETE FROM uploads WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLUploadRepository) ListExpired(before time.Time, limit int) ([]models.Upload, error) {
+	rows, err := r.db.Query(
+		`SELECT `+uploadColumns+` FROM uploads WHERE expires_at < $1 ORDER BY expires_at LIMIT $2`,
+		before, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var uploads []models.Upload
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+		uploads = append(uploads, *upload)
+	}
+	return uploads, rows.Err()
+}
+
+const directUploadColumns = `id, owner_id, storage_key, filename, content_type, size, attachment_id,
+        expires_at, created_at`
+
+func scanDirectUpload(row interface{ Scan(...interface{}) error }) (*models.DirectUpload, error) {
+	var upload models.DirectUpload
+	var attachmentID sql.NullInt64
+	if err := row.Scan(&upload.ID, &upload.OwnerID, &upload.Key, &upload.Filename, &upload.ContentType,
+		&upload.Size, &attachmentID, &upload.ExpiresAt, &upload.CreatedAt); err != nil {
+		return nil, err
+	}
+	if attachmentID.Valid {
+		id := int(attachmentID.Int64)
+		upload.AttachmentID = &id
+	}
+	return &upload, nil
+}
+
+func (r *SQLUploadRepository) CreateDirect(upload *models.DirectUpload) error {
+	err := r.db.QueryRow(
+		`INSERT INTO direct_uploads (id, owner_id, storage_key, filename, content_type, size, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING created_at`,
+		upload.ID, upload.OwnerID, upload.Key, upload.Filename, upload.ContentType, upload.Size,
+		upload.ExpiresAt,
+	).Scan(&upload.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create direct upload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLUploadRepository) GetDirect(id string) (*models.DirectUpload, error) {
+	upload, err := scanDirectUpload(r.db.QueryRow(`SELECT `+directUploadColumns+` FROM direct_uploads WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get direct upload: %w", err)
+	}
+	return upload, nil
+}
+
+func (r *SQLUploadRepository) SetDirectAttachment(id string, attachmentID int) error {
+	result, err := r.db.Exec(`UPDATE direct_uploads SET attachment_id = $2 WHERE id = $1`, id, attachmentID)
+	if err != nil {
+		return fmt.Errorf("failed to update direct upload: %w", err)
+	}
+	return expectRow(result, ErrNotFound)
+}
+
+func (r *SQLUploadRepository) DeleteDirect(id string) error {
+	if _, err := r.db.Exec(`DELETE FROM direct_uploads WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete direct upload: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLUploadRepository) ListExpiredDirect(before time.Time, limit int) ([]models.DirectUpload, error) {
+	rows, err := r.db.Query(
+		`SELECT `+directUploadColumns+` FROM direct_uploads WHERE expires_at < $1 ORDER BY expires_at LIMIT $2`,
+		before, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired direct uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var uploads []models.DirectUpload
+	for rows.Next() {
+		upload, err := scanDirectUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan direct upload: %w", err)
+		}
+		uploads = append(uploads, *upload)
+	}
+	return uploads, rows.Err()
+}
+
+// expectRow returns notFound when an update matched no rows
+func expectRow(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read update result: %w", err)
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package repository provides test implementations of the Repository interface
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+)
+
+// TestUploadRepository provides an in-memory implementation of Repository for testing
+type TestUploadRepository struct {
+	uploads map[string]models.Upload
+	direct  map[string]models.DirectUpload
+	mu      sync.RWMutex
+}
+
+// NewTestUploadRepository creates a new instance of TestUploadRepository
+func NewTestUploadRepository() *TestUploadRepository {
+	return &TestUploadRepository{
+		uploads: make(map[string]models.Upload),
+		direct:  make(map[string]models.DirectUpload),
+	}
+}
+
+func (r *TestUploadRepository) Create(upload *models.Upload) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	upload.CreatedAt = time.Now()
+	r.uploads[upload.ID] = *upload
+	return nil
+}
+
+func (r *TestUploadRepository) Get(id string) (*models.Upload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	upload, ok := r.uploads[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &upload, nil
+}
+
+func (r *TestUploadRepository) UpdateProgress(id string, fromOffset, offset int64, state string, expiresAt time.Time) error {
+	return r.update(id, func(upload *models.Upload) error {
+		if upload.Offset != fromOffset {
+			return ErrConflict
+		}
+		upload.Offset = offset
+		upload.StorageState = state
+		upload.ExpiresAt = expiresAt
+		return nil
+	})
+}
+
+func (r *TestUploadRepository) MarkAssembled(id string) error {
+	return r.update(id, func(upload *models.Upload) error {
+		upload.Assembled = true
+		return nil
+	})
+}
+
+func (r *TestUploadRepository) SetAttachment(id string, attachmentID int) error {
+	return r.update(id, func(upload *models.Upload) error {
+		upload.AttachmentID = &attachmentID
+		return nil
+	})
+}
+
+func (r *TestUploadRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.uploads, id)
+	return nil
+}
+
+func (r *TestUploadRepository) ListExpired(before time.Time, limit int) ([]models.Upload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var uploads []models.Upload
+	for _, upload := range r.uploads {
+		if upload.ExpiresAt.Before(before) {
+			uploads = append(uploads, upload)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].ExpiresAt.Before(uploads[j].ExpiresAt) })
+	if len(uploads) > limit {
+		uploads = uploads[:limit]
+	}
+	return uploads, nil
+}
+
+func (r *TestUploadRepository) CreateDirect(upload *models.DirectUpload) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	upload.CreatedAt = time.Now()
+	r.direct[upload.ID] = *upload
+	return nil
+}
+
+func (r *TestUploadRepository) GetDirect(id string) (*models.DirectUpload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	upload, ok := r.direct[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &upload, nil
+}
+
+func (r *TestUploadRepository) SetDirectAttachment(id string, attachmentID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	upload, ok := r.direct[id]
+	if !ok {
+		return ErrNotFound
+	}
+	upload.AttachmentID = &attachmentID
+	r.direct[id] = upload
+	return nil
+}
+
+func (r *TestUploadRepository) DeleteDirect(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.direct, id)
+	return nil
+}
+
+func (r *TestUploadRepository) ListExpiredDirect(before time.Time, limit int) ([]models.DirectUpload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var uploads []models.DirectUpload
+	for _, upload := range r.direct {
+		if upload.ExpiresAt.Before(before) {
+			uploads = append(uploads, upload)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].ExpiresAt.Before(uploads[j].ExpiresAt) })
+	if len(uploads) > limit {
+		uploads = uploads[:limit]
+	}
+	return uploads, nil
+}
+
+func (r *TestUploadRepository) update(id string, apply func(upload *models.Upload) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	upload, ok := r.uploads[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := apply(&upload); err != nil {
+		return err
+	}
+	r.uploads[id] = upload
+	return nil
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/media/sniff"
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+	"github.com/Mousa96/chatting-service/internal/upload/repository"
+)
+
+const (
+	// directCompleteGrace keeps a slot after its URL expires, so a transfer that started
+	// just before can still finish and be completed
+	directCompleteGrace = time.Hour
+)
+
+// WithDirectUploads lets clients send files straight to store with presigned requests
+// that stay valid for ttl. Only the listed content types may be sent this way, and only
+// while the media policy allows them; since direct uploads are stored as sent, types the
+// server rewrites or generates previews for, such as images, are better left to the
+// other upload paths.
+func WithDirectUploads(store storage.DirectUploader, ttl time.Duration, contentTypes []string) Option {
+	return func(s *UploadService) {
+		s.direct = store
+		s.directTTL = ttl
+		s.directTypes = make(map[string]bool, len(contentTypes))
+		for _, contentType := range contentTypes {
+			s.directTypes[contentType] = true
+		}
+	}
+}
+
+func (s *UploadService) CreateDirect(userID int, filename, contentType string, size int64) (*models.DirectUpload, *storage.PresignedUpload, error) {
+	if s.direct == nil {
+		return nil, nil, ErrDirectUnavailable
+	}
+	if size <= 0 {
+		return nil, nil, ErrInvalidLength
+	}
+	if size > s.maxSize {
+		return nil, nil, ErrTooLarge
+	}
+	if !s.directTypes[contentType] {
+		return nil, nil, fmt.Errorf("%w: file type %s cannot be uploaded directly", msgService.ErrInvalidMedia, contentType)
+	}
+	if err := s.importer.CheckMedia(contentType, size); err != nil {
+		return nil, nil, err
+	}
+	if err := s.importer.CheckQuota(userID, size); err != nil {
+		return nil, nil, err
+	}
+
+	id, err := models.NewID()
+	if err != nil {
+		return nil, nil, err
+	}
+	upload := &models.DirectUpload{
+		ID:          id,
+		OwnerID:     userID,
+		Key:         models.KeyPrefix + id,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		ExpiresAt:   s.now().Add(s.directTTL + directCompleteGrace),
+	}
+	presigned, err := s.direct.PresignPut(upload.Key, contentType, size, s.directTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.repo.CreateDirect(upload); err != nil {
+		return nil, nil, err
+	}
+	return upload, presigned, nil
+}
+
+func (s *UploadService) CompleteDirect(userID int, id string) (*models.DirectUpload, error) {
+	if s.direct == nil {
+		return nil, ErrDirectUnavailable
+	}
+	if !s.lock(id) {
+		return nil, ErrLocked
+	}
+	defer s.unlock(id)
+
+	upload, err := s.repo.GetDirect(id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && upload.OwnerID != userID) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if upload.AttachmentID != nil {
+		return upload, nil
+	}
+	if !s.now().Before(upload.ExpiresAt) {
+		return nil, ErrExpired
+	}
+
+	// The presigned URL stays valid after this, so the file is checked in its final place
+	// where the client cannot replace it
+	key, err := mediaModels.NewKey(userID, filepath.Ext(upload.Filename))
+	if err != nil {
+		return upload, err
+	}
+	err = s.direct.Copy(upload.Key, key)
+	if errors.Is(err, storage.ErrNotExist) {
+		return upload, ErrNotUploaded
+	}
+	if err != nil {
+		return upload, fmt.Errorf("failed to move upload: %w", err)
+	}
+
+	attachment, err := s.adopt(upload, key)
+	if err != nil {
+		if deleteErr := s.storage.Delete(key); deleteErr != nil {
+			log.Printf("Failed to remove %s after error: %v", key, deleteErr)
+		}
+		if errors.Is(err, msgService.ErrInvalidMedia) || errors.Is(err, msgService.ErrQuotaExceeded) {
+			s.discardDirect(upload)
+		}
+		return upload, err
+	}
+	if err := s.repo.SetDirectAttachment(upload.ID, attachment.ID); err != nil {
+		return upload, err
+	}
+	upload.AttachmentID = &attachment.ID
+
+	if err := s.storage.Delete(upload.Key); err != nil {
+		log.Printf("Failed to remove direct upload %s: %v", upload.Key, err)
+	}
+	return upload, nil
+}
+
+// adopt checks the file stored under key is what the client declared and stores it as
+// an attachment
+func (s *UploadService) adopt(upload *models.DirectUpload, key string) (*mediaModels.Attachment, error) {
+	info, err := s.direct.Stat(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check upload: %w", err)
+	}
+	if info.Size != upload.Size {
+		return nil, fmt.Errorf("%w: received %d bytes, expected %d", msgService.ErrInvalidMedia, info.Size, upload.Size)
+	}
+
+	head, err := s.direct.ReadHead(key, sniff.Length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check upload: %w", err)
+	}
+	if sniffed := sniff.Detect(head); sniffed != upload.ContentType {
+		return nil, fmt.Errorf("%w: file is %s, not %s", msgService.ErrInvalidMedia, sniffed, upload.ContentType)
+	}
+
+	attachment, err := s.importer.AdoptMedia(upload.OwnerID, key, upload.Filename, upload.ContentType, info.Size)
+	if err != nil && !errors.Is(err, msgService.ErrInvalidMedia) && !errors.Is(err, msgService.ErrQuotaExceeded) {
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+	return attachment, err
+}
+
+// discardDirect removes a direct upload slot and any file sent to it
+func (s *UploadService) discardDirect(upload *models.DirectUpload) {
+	// A completed upload's file belongs to its attachment, but the staging key is still
+	// removed in case the client sent the file again
+	if err := s.storage.Delete(upload.Key); err != nil {
+		log.Printf("Failed to remove direct upload %s from storage: %v", upload.ID, err)
+	}
+	if err := s.repo.DeleteDirect(upload.ID); err != nil {
+		log.Printf("Failed to delete direct upload %s: %v", upload.ID, err)
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/Mousa96/chatting-service/internal/storage/s3test"
+	"github.com/Mousa96/chatting-service/internal/upload/repository"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mp4 starts with an ftyp box, which is enough for content type detection
+const mp4 = "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom" + "rest of the video"
+
+func newDirectService(t *testing.T) (*UploadService, *repository.TestUploadRepository, *stubImporter, *s3test.Server) {
+	server := s3test.NewServer("media")
+	t.Cleanup(server.Close)
+	client := server.Client()
+	store := storage.NewS3Storage(client, "media", "/api/media", storage.WithPresignClient(s3.NewPresignClient(client)))
+
+	repo := repository.NewTestUploadRepository()
+	importer := &stubImporter{}
+	svc := NewUploadService(repo, store, importer, 1024, time.Hour,
+		WithDirectUploads(store, time.Minute, []string{"video/mp4", "application/x-msdownload"})).(*UploadService)
+	return svc, repo, importer, server
+}
+
+// put sends body with a presigned request the way a client would
+func put(t *testing.T, req *storage.PresignedUpload, body string) {
+	httpReq, err := http.NewRequest(req.Method, req.URL, strings.NewReader(body))
+	require.NoError(t, err)
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDirectUpload(t *testing.T) {
+	t.Run("completes after the file is checked", func(t *testing.T) {
+		svc, repo, importer, server := newDirectService(t)
+		upload, req, err := svc.CreateDirect(1, "clip.mp4", "video/mp4", int64(len(mp4)))
+		require.NoError(t, err)
+		assert.Equal(t, "uploads/"+upload.ID, upload.Key)
+		assert.Equal(t, "video/mp4", req.Headers["Content-Type"])
+
+		_, err = svc.CompleteDirect(1, upload.ID)
+		assert.ErrorIs(t, err, ErrNotUploaded)
+
+		put(t, req, mp4)
+		_, err = svc.CompleteDirect(2, upload.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		upload, err = svc.CompleteDirect(1, upload.ID)
+		require.NoError(t, err)
+		require.NotNil(t, upload.AttachmentID)
+		assert.Equal(t, 43, *upload.AttachmentID)
+		assert.Equal(t, "clip.mp4", importer.filename)
+		assert.True(t, strings.HasPrefix(importer.adopted, "1_"))
+		assert.True(t, strings.HasSuffix(importer.adopted, ".mp4"))
+
+		// The file moved to its media key without passing through the service
+		data, _, ok := server.Object(importer.adopted)
+		require.True(t, ok)
+		assert.Equal(t, mp4, string(data))
+		_, _, ok = server.Object(upload.Key)
+		assert.False(t, ok)
+
+		stored, err := repo.GetDirect(upload.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 43, *stored.AttachmentID)
+
+		// Completing again returns the same attachment
+		upload, err = svc.CompleteDirect(1, upload.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 43, *upload.AttachmentID)
+		assert.Equal(t, 1, importer.calls)
+	})
+
+	t.Run("content that does not match is discarded", func(t *testing.T) {
+		svc, repo, importer, server := newDirectService(t)
+		exe := "MZ\x90\x00" + strings.Repeat("\x00", 60)
+		upload, req, err := svc.CreateDirect(1, "clip.mp4", "video/mp4", int64(len(exe)))
+		require.NoError(t, err)
+		put(t, req, exe)
+
+		_, err = svc.CompleteDirect(1, upload.ID)
+		assert.ErrorIs(t, err, msgService.ErrInvalidMedia)
+		assert.Zero(t, importer.calls)
+		_, err = repo.GetDirect(upload.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, _, ok := server.Object(upload.Key)
+		assert.False(t, ok)
+	})
+
+	t.Run("size that does not match is discarded", func(t *testing.T) {
+		svc, repo, _, server := newDirectService(t)
+		upload, _, err := svc.CreateDirect(1, "clip.mp4", "video/mp4", 100)
+		require.NoError(t, err)
+		// S3 enforces the signed length, but not every compatible service does
+		server.PutObject(upload.Key, []byte(mp4), "video/mp4")
+
+		_, err = svc.CompleteDirect(1, upload.ID)
+		assert.ErrorIs(t, err, msgService.ErrInvalidMedia)
+		_, err = repo.GetDirect(upload.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("failed import is retried", func(t *testing.T) {
+		svc, _, importer, server := newDirectService(t)
+		upload, req, err := svc.CreateDirect(1, "clip.mp4", "video/mp4", int64(len(mp4)))
+		require.NoError(t, err)
+		put(t, req, mp4)
+
+		importer.err = fmt.Errorf("database unavailable")
+		_, err = svc.CompleteDirect(1, upload.ID)
+		assert.Error(t, err)
+		_, _, ok := server.Object(upload.Key)
+		assert.True(t, ok)
+
+		importer.err = nil
+		upload, err = svc.CompleteDirect(1, upload.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, upload.AttachmentID)
+	})
+
+	t.Run("slot checks", func(t *testing.T) {
+		svc, _, importer, _ := newDirectService(t)
+		_, _, err := svc.CreateDirect(1, "pic.png", "image/png", 10)
+		assert.ErrorIs(t, err, msgService.ErrInvalidMedia)
+		// Direct types are still subject to the media policy
+		_, _, err = svc.CreateDirect(1, "setup.exe", "application/x-msdownload", 10)
+		assert.ErrorIs(t, err, msgService.ErrInvalidMedia)
+		_, _, err = svc.CreateDirect(1, "clip.mp4", "video/mp4", 0)
+		assert.ErrorIs(t, err, ErrInvalidLength)
+		_, _, err = svc.CreateDirect(1, "clip.mp4", "video/mp4", 2048)
+		assert.ErrorIs(t, err, ErrTooLarge)
+		importer.quotaErr = fmt.Errorf("%w: out of space", msgService.ErrQuotaExceeded)
+		_, _, err = svc.CreateDirect(1, "clip.mp4", "video/mp4", 10)
+		assert.ErrorIs(t, err, msgService.ErrQuotaExceeded)
+	})
+
+	t.Run("unavailable without a direct store", func(t *testing.T) {
+		svc, _, _ := newTestService(t)
+		_, _, err := svc.CreateDirect(1, "clip.mp4", "video/mp4", 10)
+		assert.ErrorIs(t, err, ErrDirectUnavailable)
+		_, err = svc.CompleteDirect(1, "abc")
+		assert.ErrorIs(t, err, ErrDirectUnavailable)
+	})
+}
+
+func TestDirectUploadExpiry(t *testing.T) {
+	svc, repo, _, server := newDirectService(t)
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	upload, req, err := svc.CreateDirect(1, "clip.mp4", "video/mp4", int64(len(mp4)))
+	require.NoError(t, err)
+	put(t, req, mp4)
+
+	now = now.Add(2 * time.Hour)
+	_, err = svc.CompleteDirect(1, upload.ID)
+	assert.ErrorIs(t, err, ErrExpired)
+
+	purged, err := svc.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = repo.GetDirect(upload.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, _, ok := server.Object(upload.Key)
+	assert.False(t, ok)
+}
@@ -0,0 +1,75 @@
+// Package service provides the business logic for resumable uploads
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+)
+
+var (
+	// ErrNotFound is returned for uploads that do not exist or belong to someone else
+	ErrNotFound = errors.New("upload not found")
+	// ErrExpired is returned for uploads that were not finished in time
+	ErrExpired = errors.New("upload has expired")
+	// ErrInvalidLength is returned when an upload is created without a usable length
+	ErrInvalidLength = errors.New("invalid upload length")
+	// ErrTooLarge is returned when an upload is longer than the configured maximum
+	ErrTooLarge = errors.New("upload exceeds the maximum size")
+	// ErrOffsetMismatch is returned when a chunk does not start where the upload left off
+	ErrOffsetMismatch = errors.New("chunk offset does not match the upload offset")
+	// ErrChunkTooLarge is returned when a chunk would go past the declared length
+	ErrChunkTooLarge = errors.New("chunk exceeds the upload length")
+	// ErrLocked is returned while another request is writing to the same upload
+	ErrLocked = errors.New("upload is being written by another request")
+	// ErrDirectUnavailable is returned when the storage backend cannot take direct uploads
+	ErrDirectUnavailable = errors.New("direct uploads are not available")
+	// ErrNotUploaded is returned when a direct upload is completed before the file was sent
+	ErrNotUploaded = errors.New("file has not been uploaded")
+)
+
+// Service defines the resumable upload operations interface
+type Service interface {
+	// Create starts an upload of length bytes for userID
+	Create(userID int, length int64, filename string) (*models.Upload, error)
+	// Get returns the progress of one of userID's uploads
+	Get(userID int, id string) (*models.Upload, error)
+	// WriteChunk appends content at offset. size is the chunk length, or -1 when unknown.
+	// Once the last byte arrives the file is stored as an attachment and its ID recorded
+	// on the returned upload.
+	WriteChunk(userID int, id string, offset, size int64, content io.Reader) (*models.Upload, error)
+	// Terminate discards one of userID's uploads
+	Terminate(userID int, id string) error
+	// PurgeExpired discards uploads that expired, returning how many were removed
+	PurgeExpired() (int, error)
+	// Run purges expired uploads every interval until ctx is cancelled
+	Run(ctx context.Context, interval time.Duration)
+	// MaxSize returns the largest upload accepted, in bytes
+	MaxSize() int64
+	// CreateDirect reserves a slot for a file of size bytes and returns the presigned
+	// request the client sends it to storage with
+	CreateDirect(userID int, filename, contentType string, size int64) (*models.DirectUpload, *storage.PresignedUpload, error)
+	// CompleteDirect checks a file sent to a direct upload slot and stores it as an
+	// attachment, whose ID is recorded on the returned upload. Completing an upload
+	// again returns the same attachment.
+	CompleteDirect(userID int, id string) (*models.DirectUpload, error)
+}
+
+// ChunkStorage is a storage backend that can assemble files from chunks
+type ChunkStorage interface {
+	storage.Storage
+	storage.ChunkedUploader
+}
+
+// MediaImporter turns a finished upload into an attachment
+type MediaImporter interface {
+	ImportMedia(userID int, filename string, content io.ReadSeeker, size int64) (*mediaModels.Attachment, error)
+	AdoptMedia(userID int, key, filename, contentType string, size int64) (*mediaModels.Attachment, error)
+	CheckQuota(userID int, size int64) error
+	CheckMedia(contentType string, size int64) error
+}
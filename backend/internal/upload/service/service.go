@@ -0,0 +1,343 @@
+// Package service implements the resumable upload business logic
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/Mousa96/chatting-service/internal/upload/models"
+	"github.com/Mousa96/chatting-service/internal/upload/repository"
+)
+
+// purgeBatchSize bounds how many expired uploads are loaded at once
+const purgeBatchSize = 100
+
+// UploadService provides the implementation of the Service interface
+type UploadService struct {
+	repo     repository.Repository
+	storage  ChunkStorage
+	importer MediaImporter
+	maxSize  int64
+	ttl      time.Duration
+	now      func() time.Time
+
+	// direct is set when clients may upload straight to storage
+	direct      storage.DirectUploader
+	directTTL   time.Duration
+	directTypes map[string]bool
+
+	// writing holds the IDs of uploads a request is currently writing to
+	mu      sync.Mutex
+	writing map[string]bool
+}
+
+// Option configures optional UploadService features
+type Option func(*UploadService)
+
+// NewUploadService creates a new UploadService instance. Uploads may be up to maxSize
+// bytes and expire when no chunk arrives for ttl.
+func NewUploadService(repo repository.Repository, storage ChunkStorage, importer MediaImporter, maxSize int64, ttl time.Duration, opts ...Option) Service {
+	s := &UploadService{
+		repo:     repo,
+		storage:  storage,
+		importer: importer,
+		maxSize:  maxSize,
+		ttl:      ttl,
+		now:      time.Now,
+		writing:  make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *UploadService) MaxSize() int64 {
+	return s.maxSize
+}
+
+func (s *UploadService) Create(userID int, length int64, filename string) (*models.Upload, error) {
+	if length <= 0 {
+		return nil, ErrInvalidLength
+	}
+	if length > s.maxSize {
+		return nil, ErrTooLarge
+	}
+	// The quota is enforced when the file is stored, but checking now saves sending a
+	// file that could not be kept
+	if err := s.importer.CheckQuota(userID, length); err != nil {
+		return nil, err
+	}
+
+	id, err := models.NewID()
+	if err != nil {
+		return nil, err
+	}
+	upload := &models.Upload{
+		ID:        id,
+		OwnerID:   userID,
+		Key:       models.KeyPrefix + id,
+		Filename:  filename,
+		Length:    length,
+		ExpiresAt: s.now().Add(s.ttl),
+	}
+	if upload.StorageState, err = s.storage.StartChunked(upload.Key, "application/octet-stream"); err != nil {
+		return nil, fmt.Errorf("failed to start upload: %w", err)
+	}
+	if err := s.repo.Create(upload); err != nil {
+		if abortErr := s.storage.AbortChunked(upload.Key, upload.StorageState); abortErr != nil {
+			log.Printf("Failed to abort upload %s after error: %v", upload.ID, abortErr)
+		}
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (s *UploadService) Get(userID int, id string) (*models.Upload, error) {
+	upload, err := s.repo.Get(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if upload.OwnerID != userID {
+		return nil, ErrNotFound
+	}
+	if !s.now().Before(upload.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return upload, nil
+}
+
+func (s *UploadService) WriteChunk(userID int, id string, offset, size int64, content io.Reader) (*models.Upload, error) {
+	if !s.lock(id) {
+		return nil, ErrLocked
+	}
+	defer s.unlock(id)
+
+	upload, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+	if size > upload.Length-offset {
+		return upload, ErrChunkTooLarge
+	}
+
+	if !upload.Received() {
+		remaining := io.LimitReader(content, upload.Length-offset)
+		written, state, writeErr := s.storage.WriteChunk(upload.Key, upload.StorageState, offset, remaining)
+		if written > 0 || state != upload.StorageState {
+			expiresAt := s.now().Add(s.ttl)
+			err := s.repo.UpdateProgress(id, offset, offset+written, state, expiresAt)
+			if errors.Is(err, repository.ErrConflict) {
+				// Another replica wrote to the upload at the same time
+				return upload, ErrOffsetMismatch
+			}
+			if err != nil {
+				return upload, err
+			}
+			upload.Offset += written
+			upload.StorageState = state
+			upload.ExpiresAt = expiresAt
+		}
+		if errors.Is(writeErr, storage.ErrChunkOffset) {
+			return upload, ErrOffsetMismatch
+		}
+		if writeErr != nil {
+			return upload, writeErr
+		}
+	}
+
+	// Finishing is retried by a later request if it fails, so a transient error does not
+	// lose the whole upload
+	if upload.Received() && upload.AttachmentID == nil {
+		if err := s.finish(upload); err != nil {
+			return upload, err
+		}
+	}
+	return upload, nil
+}
+
+// finish assembles a fully received upload and stores it as an attachment
+func (s *UploadService) finish(upload *models.Upload) error {
+	if !upload.Assembled {
+		if err := s.storage.FinishChunked(upload.Key, upload.StorageState); err != nil {
+			return fmt.Errorf("failed to assemble upload: %w", err)
+		}
+		if err := s.repo.MarkAssembled(upload.ID); err != nil {
+			return err
+		}
+		upload.Assembled = true
+	}
+
+	content, cleanup, err := s.openAssembled(upload.Key)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	attachment, err := s.importer.ImportMedia(upload.OwnerID, upload.Filename, content, upload.Length)
+	if errors.Is(err, msgService.ErrInvalidMedia) || errors.Is(err, msgService.ErrQuotaExceeded) {
+		// The file cannot be accepted, so it is not kept around for a retry
+		s.discard(upload)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	if err := s.repo.SetAttachment(upload.ID, attachment.ID); err != nil {
+		return err
+	}
+	upload.AttachmentID = &attachment.ID
+
+	// The attachment has its own copy of the file
+	if err := s.storage.Delete(upload.Key); err != nil {
+		log.Printf("Failed to remove assembled upload %s: %v", upload.Key, err)
+	}
+	return nil
+}
+
+// openAssembled reads an assembled upload, copying it to a temporary file when the
+// storage backend cannot seek, since attachments are probed and hashed in several passes
+func (s *UploadService) openAssembled(key string) (io.ReadSeeker, func(), error) {
+	body, err := s.storage.Open(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		return seeker, func() { body.Close() }, nil
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	if _, err := io.Copy(tmp, body); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	return tmp, cleanup, nil
+}
+
+func (s *UploadService) Terminate(userID int, id string) error {
+	if !s.lock(id) {
+		return ErrLocked
+	}
+	defer s.unlock(id)
+
+	upload, err := s.repo.Get(id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && upload.OwnerID != userID) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.discard(upload)
+	return nil
+}
+
+func (s *UploadService) PurgeExpired() (int, error) {
+	expired, err := s.repo.ListExpired(s.now(), purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for i := range expired {
+		upload := &expired[i]
+		if !s.lock(upload.ID) {
+			continue
+		}
+		s.discard(upload)
+		s.unlock(upload.ID)
+		purged++
+	}
+
+	expiredDirect, err := s.repo.ListExpiredDirect(s.now(), purgeBatchSize)
+	if err != nil {
+		return purged, err
+	}
+	for i := range expiredDirect {
+		upload := &expiredDirect[i]
+		if !s.lock(upload.ID) {
+			continue
+		}
+		s.discardDirect(upload)
+		s.unlock(upload.ID)
+		purged++
+	}
+	return purged, nil
+}
+
+// Run purges expired uploads every interval until ctx is cancelled
+func (s *UploadService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if purged, err := s.PurgeExpired(); err != nil {
+				log.Printf("Failed to purge expired uploads: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired uploads", purged)
+			}
+		}
+	}
+}
+
+// discard removes an upload and whatever it left in storage
+func (s *UploadService) discard(upload *models.Upload) {
+	var err error
+	switch {
+	case upload.AttachmentID != nil:
+		// The file now belongs to the attachment
+	case upload.Assembled:
+		err = s.storage.Delete(upload.Key)
+	default:
+		err = s.storage.AbortChunked(upload.Key, upload.StorageState)
+	}
+	if err != nil {
+		log.Printf("Failed to remove upload %s from storage: %v", upload.ID, err)
+	}
+	if err := s.repo.Delete(upload.ID); err != nil {
+		log.Printf("Failed to delete upload %s: %v", upload.ID, err)
+	}
+}
+
+func (s *UploadService) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writing[id] {
+		return false
+	}
+	s.writing[id] = true
+	return true
+}
+
+func (s *UploadService) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.writing, id)
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/storage"
+	"github.com/Mousa96/chatting-service/internal/upload/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubImporter records the files it is given
+type stubImporter struct {
+	content  string
+	filename string
+	err      error
+	calls    int
+	// adopted is the key of the last file passed to AdoptMedia
+	adopted string
+	// quotaErr is returned by CheckQuota
+	quotaErr error
+}
+
+func (i *stubImporter) ImportMedia(userID int, filename string, content io.ReadSeeker, size int64) (*mediaModels.Attachment, error) {
+	i.calls++
+	if i.err != nil {
+		return nil, i.err
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, fmt.Errorf("read %d bytes, expected %d", len(data), size)
+	}
+	i.content = string(data)
+	i.filename = filename
+	return &mediaModels.Attachment{ID: 42, OwnerID: userID}, nil
+}
+
+func (i *stubImporter) AdoptMedia(userID int, key, filename, contentType string, size int64) (*mediaModels.Attachment, error) {
+	i.calls++
+	if i.err != nil {
+		return nil, i.err
+	}
+	i.adopted = key
+	i.filename = filename
+	return &mediaModels.Attachment{ID: 43, OwnerID: userID, Key: key}, nil
+}
+
+func (i *stubImporter) CheckQuota(userID int, size int64) error {
+	return i.quotaErr
+}
+
+func (i *stubImporter) CheckMedia(contentType string, size int64) error {
+	return msgService.DefaultMediaPolicy().Check(contentType, size)
+}
+
+func newTestService(t *testing.T) (*UploadService, *repository.TestUploadRepository, *stubImporter) {
+	repo := repository.NewTestUploadRepository()
+	importer := &stubImporter{}
+	store := storage.NewLocalStorage(t.TempDir(), "/api/media").(ChunkStorage)
+	svc := NewUploadService(repo, store, importer, 100, time.Hour).(*UploadService)
+	return svc, repo, importer
+}
+
+func TestCreate(t *testing.T) {
+	svc, repo, importer := newTestService(t)
+
+	upload, err := svc.Create(1, 10, "clip.mp4")
+	require.NoError(t, err)
+	assert.Len(t, upload.ID, 32)
+	assert.Equal(t, "uploads/"+upload.ID, upload.Key)
+	assert.Equal(t, int64(0), upload.Offset)
+
+	stored, err := repo.Get(upload.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "clip.mp4", stored.Filename)
+
+	_, err = svc.Create(1, 0, "empty")
+	assert.ErrorIs(t, err, ErrInvalidLength)
+	_, err = svc.Create(1, 101, "huge")
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	// Uploads that would not fit in the user's quota are refused before they start
+	importer.quotaErr = fmt.Errorf("%w: out of space", msgService.ErrQuotaExceeded)
+	_, err = svc.Create(1, 10, "clip.mp4")
+	assert.ErrorIs(t, err, msgService.ErrQuotaExceeded)
+}
+
+func TestWriteChunk(t *testing.T) {
+	t.Run("completes in several chunks", func(t *testing.T) {
+		svc, repo, importer := newTestService(t)
+		upload, err := svc.Create(1, 11, "notes.txt")
+		require.NoError(t, err)
+
+		upload, err = svc.WriteChunk(1, upload.ID, 0, 6, strings.NewReader("hello "))
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), upload.Offset)
+		assert.Nil(t, upload.AttachmentID)
+		assert.Zero(t, importer.calls)
+
+		upload, err = svc.WriteChunk(1, upload.ID, 6, -1, strings.NewReader("world"))
+		require.NoError(t, err)
+		require.NotNil(t, upload.AttachmentID)
+		assert.Equal(t, 42, *upload.AttachmentID)
+		assert.Equal(t, "hello world", importer.content)
+		assert.Equal(t, "notes.txt", importer.filename)
+
+		// The row stays so clients can look up the attachment, but the file moved
+		stored, err := repo.Get(upload.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 42, *stored.AttachmentID)
+		_, err = svc.storage.Open(upload.Key)
+		assert.Error(t, err)
+	})
+
+	t.Run("offset and length checks", func(t *testing.T) {
+		svc, _, _ := newTestService(t)
+		upload, err := svc.Create(1, 5, "a.bin")
+		require.NoError(t, err)
+
+		_, err = svc.WriteChunk(1, upload.ID, 2, 1, strings.NewReader("x"))
+		assert.ErrorIs(t, err, ErrOffsetMismatch)
+		_, err = svc.WriteChunk(1, upload.ID, 0, 6, strings.NewReader("123456"))
+		assert.ErrorIs(t, err, ErrChunkTooLarge)
+
+		// Bodies of unknown length are cut at the declared length
+		upload, err = svc.WriteChunk(1, upload.ID, 0, -1, strings.NewReader("1234567"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), upload.Offset)
+	})
+
+	t.Run("dropped connection keeps progress", func(t *testing.T) {
+		svc, _, importer := newTestService(t)
+		upload, err := svc.Create(1, 6, "a.bin")
+		require.NoError(t, err)
+
+		reader := io.MultiReader(strings.NewReader("abc"), &errReader{err: errors.New("connection reset")})
+		upload, err = svc.WriteChunk(1, upload.ID, 0, 6, reader)
+		assert.Error(t, err)
+		require.NotNil(t, upload)
+		assert.Equal(t, int64(3), upload.Offset)
+
+		upload, err = svc.Get(1, upload.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), upload.Offset)
+
+		_, err = svc.WriteChunk(1, upload.ID, 3, 3, strings.NewReader("def"))
+		require.NoError(t, err)
+		assert.Equal(t, "abcdef", importer.content)
+	})
+
+	t.Run("failed import is retried", func(t *testing.T) {
+		svc, _, importer := newTestService(t)
+		upload, err := svc.Create(1, 3, "a.bin")
+		require.NoError(t, err)
+
+		importer.err = errors.New("database unavailable")
+		upload, err = svc.WriteChunk(1, upload.ID, 0, 3, strings.NewReader("abc"))
+		assert.Error(t, err)
+		assert.Equal(t, int64(3), upload.Offset)
+
+		// An empty chunk at the end finishes the upload
+		importer.err = nil
+		upload, err = svc.WriteChunk(1, upload.ID, 3, 0, strings.NewReader(""))
+		require.NoError(t, err)
+		require.NotNil(t, upload.AttachmentID)
+		assert.Equal(t, "abc", importer.content)
+	})
+
+	t.Run("rejected file is discarded", func(t *testing.T) {
+		svc, repo, importer := newTestService(t)
+		upload, err := svc.Create(1, 3, "a.exe")
+		require.NoError(t, err)
+
+		importer.err = fmt.Errorf("%w: file type not allowed", msgService.ErrInvalidMedia)
+		_, err = svc.WriteChunk(1, upload.ID, 0, 3, strings.NewReader("MZ\x90"))
+		assert.ErrorIs(t, err, msgService.ErrInvalidMedia)
+
+		_, err = repo.Get(upload.ID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = svc.storage.Open(upload.Key)
+		assert.Error(t, err)
+	})
+
+	t.Run("other users and locks", func(t *testing.T) {
+		svc, _, _ := newTestService(t)
+		upload, err := svc.Create(1, 3, "a.bin")
+		require.NoError(t, err)
+
+		_, err = svc.WriteChunk(2, upload.ID, 0, 3, strings.NewReader("abc"))
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.True(t, svc.lock(upload.ID))
+		_, err = svc.WriteChunk(1, upload.ID, 0, 3, strings.NewReader("abc"))
+		assert.ErrorIs(t, err, ErrLocked)
+		svc.unlock(upload.ID)
+	})
+}
+
+// errReader always fails
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestExpiry(t *testing.T) {
+	svc, repo, _ := newTestService(t)
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	stale, err := svc.Create(1, 10, "stale.bin")
+	require.NoError(t, err)
+	_, err = svc.WriteChunk(1, stale.ID, 0, 3, strings.NewReader("abc"))
+	require.NoError(t, err)
+
+	// An upload created later is still within its expiry
+	now = now.Add(30 * time.Minute)
+	active, err := svc.Create(1, 10, "active.bin")
+	require.NoError(t, err)
+
+	now = now.Add(45 * time.Minute)
+	_, err = svc.Get(1, stale.ID)
+	assert.ErrorIs(t, err, ErrExpired)
+	_, err = svc.WriteChunk(1, stale.ID, 3, 1, strings.NewReader("d"))
+	assert.ErrorIs(t, err, ErrExpired)
+	_, err = svc.Get(1, active.ID)
+	assert.NoError(t, err)
+
+	purged, err := svc.PurgeExpired()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = repo.Get(stale.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = svc.storage.Open(stale.Key)
+	assert.Error(t, err)
+	_, err = repo.Get(active.ID)
+	assert.NoError(t, err)
+}
+
+func TestTerminate(t *testing.T) {
+	svc, repo, _ := newTestService(t)
+	upload, err := svc.Create(1, 10, "a.bin")
+	require.NoError(t, err)
+	_, err = svc.WriteChunk(1, upload.ID, 0, 3, strings.NewReader("abc"))
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.Terminate(2, upload.ID), ErrNotFound)
+	require.NoError(t, svc.Terminate(1, upload.ID))
+
+	_, err = repo.Get(upload.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = svc.storage.Open(upload.Key)
+	assert.Error(t, err)
+	assert.ErrorIs(t, svc.Terminate(1, upload.ID), ErrNotFound)
+}
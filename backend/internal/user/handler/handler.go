@@ -2,10 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/Mousa96/chatting-service/internal/middleware"
+	"github.com/Mousa96/chatting-service/internal/user/models"
 	"github.com/Mousa96/chatting-service/internal/user/service"
 )
 
@@ -19,38 +22,65 @@ func NewUserHandler(userService service.Service) Handler {
     return &UserHandler{userService: userService}
 }
 
-// GetAllUsers godoc
-// @Summary Get all users
-// @Description Retrieve all users except the current user
+// SearchUsers godoc
+// @Summary Search the user directory
+// @Description List users other than the current user, a page at a time. Matches usernames and display names by prefix or similarity. Suspended users are never listed.
 // @Tags users
 // @Accept json
 // @Produce json
-// @Success 200 {array} object "List of users"
+// @Param q query string false "Search term"
+// @Param online query bool false "Only online (true) or offline (false) users"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Success 200 {object} models.DirectoryPage "Page of users"
+// @Failure 400 {string} string "Bad request"
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 500 {string} string "Internal server error"
 // @Security Bearer
 // @Router /users [get]
-func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
-    // Get current user ID from context
-    currentUserID, _ := middleware.GetUserIDFromContext(r.Context())
-    
-    // Get all users
-    users, err := h.userService.GetAllUsers()
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+    currentUserID, err := middleware.GetUserIDFromContext(r.Context())
     if err != nil {
-        http.Error(w, "Failed to get users", http.StatusInternalServerError)
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
         return
     }
-    
-    // Filter out current user
-    filteredUsers := make([]interface{}, 0)
-    for _, user := range users {
-        if user.ID != currentUserID {
-            filteredUsers = append(filteredUsers, user)
+
+    params := r.URL.Query()
+    req := models.DirectoryRequest{
+        Query:  params.Get("q"),
+        Cursor: params.Get("cursor"),
+    }
+
+    if limit := params.Get("limit"); limit != "" {
+        req.Limit, err = strconv.Atoi(limit)
+        if err != nil {
+            http.Error(w, "Invalid limit", http.StatusBadRequest)
+            return
         }
     }
-    
+
+    if online := params.Get("online"); online != "" {
+        value, err := strconv.ParseBool(online)
+        if err != nil {
+            http.Error(w, "Invalid online filter", http.StatusBadRequest)
+            return
+        }
+        req.Online = &value
+    }
+
+    page, err := h.userService.SearchUsers(currentUserID, req)
+    if err != nil {
+        if errors.Is(err, service.ErrInvalidSearch) || errors.Is(err, models.ErrInvalidCursor) {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        log.Printf("Failed to search users: %v", err)
+        http.Error(w, "Failed to get users", http.StatusInternalServerError)
+        return
+    }
+
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(filteredUsers)
+    json.NewEncoder(w).Encode(page)
 }
 
 // GetUserByID godoc
@@ -132,4 +162,147 @@ func (h *UserHandler) UpdateUserStatus(w http.ResponseWriter, r *http.Request) {
     
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-}
\ No newline at end of file
+}
+
+// GetCurrentUser godoc
+// @Summary Get current user
+// @Description Retrieve the profile of the authenticated user
+// @Tags users
+// @Produce json
+// @Success 200 {object} models.User "Current user profile"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "User not found"
+// @Security Bearer
+// @Router /users/me [get]
+func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+    userID, err := middleware.GetUserIDFromContext(r.Context())
+    if err != nil {
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    user, err := h.userService.GetUserByID(userID)
+    if err != nil {
+        http.Error(w, "User not found", http.StatusNotFound)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(user)
+}
+
+// UpdateProfile godoc
+// @Summary Update current user's profile
+// @Description Partially update display name, bio and time zone. Omitted fields are left unchanged
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param profile body models.UpdateProfileRequest true "Profile fields to change"
+// @Success 200 {object} models.User "Updated profile"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /users/me [patch]
+func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+    userID, err := middleware.GetUserIDFromContext(r.Context())
+    if err != nil {
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    var req models.UpdateProfileRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        return
+    }
+
+    user, err := h.userService.UpdateProfile(userID, &req)
+    if err != nil {
+        writeProfileError(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(user)
+}
+
+// UploadAvatar godoc
+// @Summary Upload avatar
+// @Description Upload a JPEG, PNG or GIF image (max 5MB) as the current user's avatar
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Avatar image"
+// @Success 200 {object} models.User "Updated profile"
+// @Failure 400 {string} string "Bad request"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /users/me/avatar [post]
+func (h *UserHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+    userID, err := middleware.GetUserIDFromContext(r.Context())
+    if err != nil {
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    if err := r.ParseMultipartForm(10 << 20); err != nil {
+        http.Error(w, "file too large", http.StatusBadRequest)
+        return
+    }
+
+    file, header, err := r.FormFile("file")
+    if err != nil {
+        http.Error(w, "invalid file", http.StatusBadRequest)
+        return
+    }
+    file.Close()
+
+    user, err := h.userService.UploadAvatar(userID, header)
+    if err != nil {
+        writeProfileError(w, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(user)
+}
+
+// writeProfileError maps profile update errors to HTTP status codes
+// GetStorageUsage godoc
+// @Summary Get storage usage
+// @Description Report how much media storage the current user has used, their quota and what remains. Quota and remaining bytes are null when there is no limit
+// @Tags users
+// @Produce json
+// @Success 200 {object} models.StorageUsage "Storage usage"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Security Bearer
+// @Router /users/me/storage [get]
+func (h *UserHandler) GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+    userID, err := middleware.GetUserIDFromContext(r.Context())
+    if err != nil {
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        return
+    }
+
+    usage, err := h.userService.GetStorageUsage(userID)
+    if err != nil {
+        log.Printf("Failed to get storage usage for user %d: %v", userID, err)
+        http.Error(w, "Failed to get storage usage", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(usage)
+}
+
+func writeProfileError(w http.ResponseWriter, err error) {
+    if errors.Is(err, service.ErrInvalidProfile) || errors.Is(err, service.ErrInvalidAvatar) {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    log.Printf("Failed to update profile: %v", err)
+    http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+}
@@ -4,7 +4,11 @@ import "net/http"
 
 // Handler defines HTTP handlers for user operations
 type Handler interface {
-    GetAllUsers(w http.ResponseWriter, r *http.Request)
+    SearchUsers(w http.ResponseWriter, r *http.Request)
     GetUserByID(w http.ResponseWriter, r *http.Request)
     UpdateUserStatus(w http.ResponseWriter, r *http.Request)
+    GetCurrentUser(w http.ResponseWriter, r *http.Request)
+    UpdateProfile(w http.ResponseWriter, r *http.Request)
+    UploadAvatar(w http.ResponseWriter, r *http.Request)
+    GetStorageUsage(w http.ResponseWriter, r *http.Request)
 }
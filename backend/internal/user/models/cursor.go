@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// DirectoryCursor is the position of the last user on a directory page.
+// Results are ordered by rank (descending), then lower-cased username and ID.
+type DirectoryCursor struct {
+	Rank     int    `json:"r"`
+	Username string `json:"u"`
+	ID       int    `json:"i"`
+}
+
+// Encode returns the opaque string form of the cursor handed to clients
+func (c DirectoryCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeDirectoryCursor parses a cursor produced by Encode
+func DecodeDirectoryCursor(s string) (*DirectoryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c DirectoryCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
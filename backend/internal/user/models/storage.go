@@ -0,0 +1,68 @@
+package models
+
+import "fmt"
+
+// StorageUsage reports how much media storage a user has used and may use
+type StorageUsage struct {
+	UsedBytes int64 `json:"used_bytes"`
+	// QuotaBytes is the most the user may store, or null when there is no limit
+	QuotaBytes *int64 `json:"quota_bytes"`
+	// RemainingBytes is how much more the user may store, or null when there is no limit
+	RemainingBytes *int64 `json:"remaining_bytes"`
+	// CustomQuota is set when an administrator gave the user a quota of their own
+	CustomQuota bool `json:"custom_quota"`
+}
+
+// StorageAccount is the storage a user has used and their quota override, if any
+type StorageAccount struct {
+	Used  int64
+	Quota *int64
+}
+
+// StorageLimits are the quotas that apply when storing files. Zero means no limit.
+type StorageLimits struct {
+	// DefaultQuota applies to users without a quota of their own
+	DefaultQuota int64
+	// GlobalQuota bounds the storage used by everyone together
+	GlobalQuota int64
+}
+
+// QuotaFor returns the quota that applies to account, and false when it has none
+func (l StorageLimits) QuotaFor(account StorageAccount) (int64, bool) {
+	if account.Quota != nil {
+		return *account.Quota, true
+	}
+	return l.DefaultQuota, l.DefaultQuota > 0
+}
+
+// Check returns a *QuotaError if storing size more bytes for account would exceed its
+// quota, or take totalUsed past the global quota
+func (l StorageLimits) Check(account StorageAccount, totalUsed, size int64) error {
+	if quota, ok := l.QuotaFor(account); ok && account.Used+size > quota {
+		return &QuotaError{Limit: quota, Used: account.Used, Requested: size}
+	}
+	if l.GlobalQuota > 0 && totalUsed+size > l.GlobalQuota {
+		return &QuotaError{Global: true, Limit: l.GlobalQuota, Used: totalUsed, Requested: size}
+	}
+	return nil
+}
+
+// QuotaError describes the quota a file did not fit in
+type QuotaError struct {
+	// Global is set when the service as a whole is out of space rather than the user
+	Global    bool
+	Limit     int64
+	Used      int64
+	Requested int64
+}
+
+func (e *QuotaError) Error() string {
+	if e.Global {
+		return "the service has run out of storage space"
+	}
+	available := e.Limit - e.Used
+	if available < 0 {
+		available = 0
+	}
+	return fmt.Sprintf("file is %d bytes but only %d of your %d byte quota is available", e.Requested, available, e.Limit)
+}
@@ -4,6 +4,52 @@ package models
 type User struct {
     ID       int    `json:"id"`
     Username string `json:"username"`
+    DisplayName string `json:"display_name,omitempty"`
+    AvatarURL   string `json:"avatar_url,omitempty"`
+    Bio         string `json:"bio,omitempty"`
+    TimeZone    string `json:"time_zone,omitempty"`
     Status   string `json:"status"`
+    Role     string `json:"role,omitempty"`
+    Suspended bool  `json:"suspended,omitempty"`
+    // External users, such as contractors, have their conversations kept for a shorter time
+    External  bool  `json:"external,omitempty"`
     CreatedAt string `json:"created_at,omitempty"`
 }
+
+// UpdateProfileRequest represents a partial profile update.
+// Fields left out of the request body are not changed.
+type UpdateProfileRequest struct {
+    DisplayName *string `json:"display_name,omitempty"`
+    Bio         *string `json:"bio,omitempty"`
+    TimeZone    *string `json:"time_zone,omitempty"`
+}
+
+// DirectoryRequest is a user directory search as received from a client
+type DirectoryRequest struct {
+    Query  string
+    Online *bool
+    Cursor string
+    Limit  int
+}
+
+// DirectoryQuery is a user directory search as executed by the repository
+type DirectoryQuery struct {
+    // Query matches usernames and display names by prefix or similarity; empty lists everyone
+    Query string
+    // Online restricts results to online (true) or offline (false) users when set
+    Online *bool
+    // OnlineUserIDs is the set of currently connected users, used by the Online filter
+    OnlineUserIDs []int
+    // ViewerID is the user searching. They are left out of the results, as is
+    // anyone they have blocked or who has blocked them.
+    ViewerID int
+    // After continues a previous search from the given position
+    After *DirectoryCursor
+    Limit int
+}
+
+// DirectoryPage is one page of user directory results
+type DirectoryPage struct {
+    Users      []User `json:"users"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
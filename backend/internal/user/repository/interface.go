@@ -1,12 +1,41 @@
 package repository
 
-import "github.com/Mousa96/chatting-service/internal/user/models"
+import (
+    "errors"
+
+    "github.com/Mousa96/chatting-service/internal/user/models"
+)
+
+// ErrUserNotFound is returned when a user does not exist
+var ErrUserNotFound = errors.New("user not found")
 
 // Repository defines data access operations for users
 type Repository interface {
     GetAllUsers() ([]models.User, error)
+    SearchUsers(q models.DirectoryQuery) (*models.DirectoryPage, error)
     GetUserByID(id int) (*models.User, error)
     GetUserByUsername(username string) (*models.User, error)
+    // GetUserIDsByUsernames maps each of usernames that belongs to a user to that user's ID
+    GetUserIDsByUsernames(usernames []string) (map[string]int, error)
     UpdateUser(user *models.User) error
     UpdateUserStatus(userID int, status string) error
+    SetUserSuspended(userID int, suspended bool) error
+    // GetActiveRole returns the role of a user, and false when the user does not exist
+    // or is suspended
+    GetActiveRole(userID int) (string, bool, error)
+    SetUserRole(userID int, role string) error
+    // SetUserExternal marks a user as external, such as a contractor, or internal
+    SetUserExternal(userID int, external bool) error
+    DeleteUser(userID int) error
+    // GetStorage returns the storage a user has used and their quota override
+    GetStorage(userID int) (*models.StorageAccount, error)
+    // TotalStorageUsed returns the storage used by all users together
+    TotalStorageUsed() (int64, error)
+    // ReserveStorage adds size bytes to a user's usage, or returns a *models.QuotaError
+    // without changing it when that would exceed limits
+    ReserveStorage(userID int, size int64, limits models.StorageLimits) error
+    // ReleaseStorage takes size bytes off a user's usage
+    ReleaseStorage(userID int, size int64) error
+    // SetStorageQuota overrides a user's quota, or returns them to the default when quota is nil
+    SetStorageQuota(userID int, quota *int64) error
 }
@@ -2,8 +2,11 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 
 	"github.com/Mousa96/chatting-service/internal/user/models"
+	"github.com/lib/pq"
 )
 
 // PostgresRepository implements Repository interface with PostgreSQL
@@ -16,9 +19,43 @@ func NewPostgresRepository(db *sql.DB) Repository {
     return &PostgresRepository{db: db}
 }
 
+// userColumns lists the columns read by scanUser, in order
+const userColumns = `id, username, COALESCE(display_name, ''), COALESCE(avatar_url, ''), COALESCE(bio, ''),
+    COALESCE(time_zone, ''), role, suspended_at IS NOT NULL, external, created_at`
+
+// globalStorageLockKey is the advisory lock held while reserving storage against the
+// global quota
+const globalStorageLockKey int64 = 0x73746f72616765 // "storage"
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanUser reads a user selected with userColumns, followed by any extra columns
+func scanUser(row rowScanner, extra ...interface{}) (*models.User, error) {
+    var user models.User
+    dest := []interface{}{
+        &user.ID,
+        &user.Username,
+        &user.DisplayName,
+        &user.AvatarURL,
+        &user.Bio,
+        &user.TimeZone,
+        &user.Role,
+        &user.Suspended,
+        &user.External,
+        &user.CreatedAt,
+    }
+    if err := row.Scan(append(dest, extra...)...); err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
 // GetAllUsers retrieves all users from the database
 func (r *PostgresRepository) GetAllUsers() ([]models.User, error) {
-    rows, err := r.db.Query("SELECT id, username, created_at FROM users")
+    rows, err := r.db.Query("SELECT " + userColumns + " FROM users ORDER BY id")
     if err != nil {
         return nil, err
     }
@@ -26,47 +63,165 @@ func (r *PostgresRepository) GetAllUsers() ([]models.User, error) {
 
     var users []models.User
     for rows.Next() {
-        var user models.User
-        if err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt); err != nil {
+        user, err := scanUser(rows)
+        if err != nil {
             return nil, err
         }
         // Default status, will be updated from WebSocket if needed
         user.Status = "offline"
-        users = append(users, user)
+        users = append(users, *user)
     }
 
-    return users, nil
+    return users, rows.Err()
+}
+
+// SearchUsers returns one page of the user directory. Suspended users and users on
+// either side of a block with the searcher are never listed.
+// With a search term, users are ranked by prefix match first and trigram similarity second.
+func (r *PostgresRepository) SearchUsers(q models.DirectoryQuery) (*models.DirectoryPage, error) {
+    var args []interface{}
+    arg := func(v interface{}) string {
+        args = append(args, v)
+        return fmt.Sprintf("$%d", len(args))
+    }
+
+    rank := "0"
+    viewer := arg(q.ViewerID)
+    where := []string{
+        "suspended_at IS NULL",
+        "id <> " + viewer,
+        // Hide users on either side of a block with the viewer
+        fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM user_blocks b
+            WHERE (b.blocker_id = %[1]s AND b.blocked_id = users.id) OR (b.blocker_id = users.id AND b.blocked_id = %[1]s))`, viewer),
+    }
+
+    if q.Query != "" {
+        term, prefix := arg(q.Query), arg(escapeLike(q.Query)+"%")
+        rank = fmt.Sprintf(
+            `(CASE WHEN username ILIKE %[2]s OR display_name ILIKE %[2]s THEN 1000 ELSE 0 END
+            + round(1000 * GREATEST(similarity(username, %[1]s), similarity(COALESCE(display_name, ''), %[1]s)))::int)`,
+            term, prefix,
+        )
+        where = append(where, fmt.Sprintf(
+            "(username ILIKE %[2]s OR display_name ILIKE %[2]s OR username %% %[1]s OR display_name %% %[1]s)",
+            term, prefix,
+        ))
+    }
+
+    if q.Online != nil {
+        // A non-nil empty array keeps "NOT id = ANY('{}')" true when nobody is online
+        ids := make(pq.Int64Array, 0, len(q.OnlineUserIDs))
+        for _, id := range q.OnlineUserIDs {
+            ids = append(ids, int64(id))
+        }
+        cond := "id = ANY(" + arg(ids) + ")"
+        if !*q.Online {
+            cond = "NOT " + cond
+        }
+        where = append(where, cond)
+    }
+
+    if q.After != nil {
+        afterRank := arg(q.After.Rank)
+        where = append(where, fmt.Sprintf(
+            "(r.rank < %[1]s OR (r.rank = %[1]s AND (lower(username), id) > (%[2]s, %[3]s)))",
+            afterRank, arg(q.After.Username), arg(q.After.ID),
+        ))
+    }
+
+    query := fmt.Sprintf(
+        `SELECT %s, r.rank, lower(username)
+        FROM users, LATERAL (SELECT %s AS rank) r
+        WHERE %s
+        ORDER BY r.rank DESC, lower(username), id
+        LIMIT %s`,
+        userColumns, rank, strings.Join(where, " AND "), arg(q.Limit+1),
+    )
+
+    rows, err := r.db.Query(query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search users: %w", err)
+    }
+    defer rows.Close()
+
+    page := &models.DirectoryPage{Users: []models.User{}}
+    var last models.DirectoryCursor
+    for rows.Next() {
+        var cursor models.DirectoryCursor
+        user, err := scanUser(rows, &cursor.Rank, &cursor.Username)
+        if err != nil {
+            return nil, err
+        }
+
+        if len(page.Users) == q.Limit {
+            // An extra row exists, so there is another page after the last one kept
+            page.NextCursor = last.Encode()
+            break
+        }
+
+        cursor.ID = user.ID
+        last = cursor
+        user.Status = "offline"
+        page.Users = append(page.Users, *user)
+    }
+
+    return page, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 // GetUserByID retrieves a user by ID
 func (r *PostgresRepository) GetUserByID(id int) (*models.User, error) {
-    var user models.User
-    err := r.db.QueryRow("SELECT id, username, created_at FROM users WHERE id = $1", id).
-        Scan(&user.ID, &user.Username, &user.CreatedAt)
-    if err != nil {
-        return nil, err
+    user, err := scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", id))
+    if err == sql.ErrNoRows {
+        return nil, ErrUserNotFound
     }
-    return &user, nil
+    return user, err
 }
 
 // GetUserByUsername retrieves a user by username
 func (r *PostgresRepository) GetUserByUsername(username string) (*models.User, error) {
-    var user models.User
-    err := r.db.QueryRow("SELECT id, username, created_at FROM users WHERE username = $1", username).
-        Scan(&user.ID, &user.Username, &user.CreatedAt)
+    return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = $1", username))
+}
+
+// GetUserIDsByUsernames maps each of usernames that belongs to a user to that user's ID
+func (r *PostgresRepository) GetUserIDsByUsernames(usernames []string) (map[string]int, error) {
+    ids := make(map[string]int)
+    if len(usernames) == 0 {
+        return ids, nil
+    }
+    rows, err := r.db.Query("SELECT id, username FROM users WHERE username = ANY($1)", pq.Array(usernames))
     if err != nil {
-        return nil, err
+        return nil, fmt.Errorf("failed to look up usernames: %w", err)
     }
-    return &user, nil
+    defer rows.Close()
+    for rows.Next() {
+        var id int
+        var username string
+        if err := rows.Scan(&id, &username); err != nil {
+            return nil, err
+        }
+        ids[username] = id
+    }
+    return ids, rows.Err()
 }
 
-// UpdateUser updates an existing user
+// UpdateUser updates the username and profile fields of an existing user
 func (r *PostgresRepository) UpdateUser(user *models.User) error {
-    _, err := r.db.Exec(
-        "UPDATE users SET username = $1 WHERE id = $2",
-        user.Username, user.ID,
+    result, err := r.db.Exec(
+        `UPDATE users
+        SET username = $1, display_name = NULLIF($2, ''), avatar_url = NULLIF($3, ''),
+            bio = NULLIF($4, ''), time_zone = NULLIF($5, ''), updated_at = CURRENT_TIMESTAMP
+        WHERE id = $6`,
+        user.Username, user.DisplayName, user.AvatarURL, user.Bio, user.TimeZone, user.ID,
     )
-    return err
+    if err != nil {
+        return fmt.Errorf("failed to update user: %w", err)
+    }
+    return checkUserAffected(result)
 }
 
 // UpdateUserStatus updates a user's status
@@ -74,4 +229,191 @@ func (r *PostgresRepository) UpdateUser(user *models.User) error {
 func (r *PostgresRepository) UpdateUserStatus(userID int, status string) error {
     // This is a placeholder since status is handled by WebSocket module
     return nil
-} 
\ No newline at end of file
+}
+
+// SetUserSuspended suspends or reinstates a user account
+func (r *PostgresRepository) SetUserSuspended(userID int, suspended bool) error {
+    query := "UPDATE users SET suspended_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1"
+    if suspended {
+        query = "UPDATE users SET suspended_at = COALESCE(suspended_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP WHERE id = $1"
+    }
+
+    result, err := r.db.Exec(query, userID)
+    if err != nil {
+        return fmt.Errorf("failed to update suspension: %w", err)
+    }
+    return checkUserAffected(result)
+}
+
+// GetActiveRole returns the role of a user, and false when the user does not exist or
+// is suspended
+func (r *PostgresRepository) GetActiveRole(userID int) (string, bool, error) {
+    var role string
+    var active bool
+    err := r.db.QueryRow("SELECT role, suspended_at IS NULL FROM users WHERE id = $1", userID).Scan(&role, &active)
+    if err == sql.ErrNoRows {
+        return "", false, nil
+    }
+    if err != nil {
+        return "", false, fmt.Errorf("failed to check user: %w", err)
+    }
+    return role, active, nil
+}
+
+// SetUserRole changes the role of a user
+func (r *PostgresRepository) SetUserRole(userID int, role string) error {
+    result, err := r.db.Exec(
+        "UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2",
+        role, userID,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to update role: %w", err)
+    }
+    return checkUserAffected(result)
+}
+
+// SetUserExternal marks a user as external or internal
+func (r *PostgresRepository) SetUserExternal(userID int, external bool) error {
+    result, err := r.db.Exec(
+        "UPDATE users SET external = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2",
+        external, userID,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to update external flag: %w", err)
+    }
+    return checkUserAffected(result)
+}
+
+// DeleteUser removes a user together with the messages they sent or received
+func (r *PostgresRepository) DeleteUser(userID int) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.Exec("DELETE FROM messages WHERE sender_id = $1 OR receiver_id = $1", userID); err != nil {
+        return fmt.Errorf("failed to delete user messages: %w", err)
+    }
+
+    result, err := tx.Exec("DELETE FROM users WHERE id = $1", userID)
+    if err != nil {
+        return fmt.Errorf("failed to delete user: %w", err)
+    }
+    if err := checkUserAffected(result); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// GetStorage returns the storage a user has used and their quota override
+func (r *PostgresRepository) GetStorage(userID int) (*models.StorageAccount, error) {
+    var account models.StorageAccount
+    var quota sql.NullInt64
+    err := r.db.QueryRow("SELECT storage_used, storage_quota FROM users WHERE id = $1", userID).Scan(&account.Used, &quota)
+    if err == sql.ErrNoRows {
+        return nil, ErrUserNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get storage usage: %w", err)
+    }
+    if quota.Valid {
+        account.Quota = &quota.Int64
+    }
+    return &account, nil
+}
+
+// TotalStorageUsed returns the storage used by all users together
+func (r *PostgresRepository) TotalStorageUsed() (int64, error) {
+    var total int64
+    if err := r.db.QueryRow("SELECT COALESCE(SUM(storage_used), 0) FROM users").Scan(&total); err != nil {
+        return 0, fmt.Errorf("failed to get total storage usage: %w", err)
+    }
+    return total, nil
+}
+
+// ReserveStorage adds size bytes to a user's usage if it fits within limits. The user's
+// row stays locked until the usage is updated, so concurrent uploads by the same user
+// cannot both fit into the last of their quota. With a global quota, reservations are
+// also made one at a time under an advisory lock, so uploads by different users cannot
+// together go over it either.
+func (r *PostgresRepository) ReserveStorage(userID int, size int64, limits models.StorageLimits) error {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+
+    // Taken before the row lock so that reservations always lock in the same order
+    if limits.GlobalQuota > 0 {
+        if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", globalStorageLockKey); err != nil {
+            return fmt.Errorf("failed to lock storage usage: %w", err)
+        }
+    }
+
+    var account models.StorageAccount
+    var quota sql.NullInt64
+    err = tx.QueryRow("SELECT storage_used, storage_quota FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&account.Used, &quota)
+    if err == sql.ErrNoRows {
+        return ErrUserNotFound
+    }
+    if err != nil {
+        return fmt.Errorf("failed to get storage usage: %w", err)
+    }
+    if quota.Valid {
+        account.Quota = &quota.Int64
+    }
+
+    var total int64
+    if limits.GlobalQuota > 0 {
+        if err := tx.QueryRow("SELECT COALESCE(SUM(storage_used), 0) FROM users").Scan(&total); err != nil {
+            return fmt.Errorf("failed to get total storage usage: %w", err)
+        }
+    }
+    if err := limits.Check(account, total, size); err != nil {
+        return err
+    }
+
+    if _, err := tx.Exec("UPDATE users SET storage_used = storage_used + $1 WHERE id = $2", size, userID); err != nil {
+        return fmt.Errorf("failed to reserve storage: %w", err)
+    }
+    return tx.Commit()
+}
+
+// ReleaseStorage takes size bytes off a user's usage
+func (r *PostgresRepository) ReleaseStorage(userID int, size int64) error {
+    _, err := r.db.Exec(
+        "UPDATE users SET storage_used = GREATEST(storage_used - $1, 0) WHERE id = $2",
+        size, userID,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to release storage: %w", err)
+    }
+    // The user may have been deleted along with their files, which is not an error
+    return nil
+}
+
+// SetStorageQuota overrides a user's storage quota, or clears the override when quota is nil
+func (r *PostgresRepository) SetStorageQuota(userID int, quota *int64) error {
+    result, err := r.db.Exec(
+        "UPDATE users SET storage_quota = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2",
+        quota, userID,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to update storage quota: %w", err)
+    }
+    return checkUserAffected(result)
+}
+
+// checkUserAffected returns a not found error when a statement matched no user
+func checkUserAffected(result sql.Result) error {
+    rows, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("error checking rows affected: %w", err)
+    }
+    if rows == 0 {
+        return ErrUserNotFound
+    }
+    return nil
+}
@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Mousa96/chatting-service/internal/user/models"
+)
+
+// TestUserRepository provides an in-memory implementation of Repository for testing
+type TestUserRepository struct {
+	users   map[int]*models.User
+	storage map[int]*models.StorageAccount
+	mu      sync.RWMutex
+}
+
+// NewTestUserRepository creates a new instance of TestUserRepository
+func NewTestUserRepository() *TestUserRepository {
+	return &TestUserRepository{
+		users:   make(map[int]*models.User),
+		storage: make(map[int]*models.StorageAccount),
+	}
+}
+
+// AddUser stores a user as-is, for seeding tests
+func (r *TestUserRepository) AddUser(user models.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	r.users[user.ID] = &user
+}
+
+func (r *TestUserRepository) GetAllUsers() ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []models.User
+	for _, user := range r.users {
+		u := *user
+		u.Status = "offline"
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// SearchUsers approximates the PostgreSQL directory search: prefix matches rank
+// above substring matches, which stand in for trigram similarity
+func (r *TestUserRepository) SearchUsers(q models.DirectoryQuery) (*models.DirectoryPage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	online := make(map[int]bool)
+	for _, id := range q.OnlineUserIDs {
+		online[id] = true
+	}
+
+	type ranked struct {
+		user   models.User
+		cursor models.DirectoryCursor
+	}
+	term := strings.ToLower(q.Query)
+	var matches []ranked
+	for _, user := range r.users {
+		if user.Suspended || user.ID == q.ViewerID {
+			continue
+		}
+		if q.Online != nil && online[user.ID] != *q.Online {
+			continue
+		}
+
+		rank := 0
+		if term != "" {
+			username, displayName := strings.ToLower(user.Username), strings.ToLower(user.DisplayName)
+			switch {
+			case strings.HasPrefix(username, term) || strings.HasPrefix(displayName, term):
+				rank = 1000
+			case strings.Contains(username, term) || strings.Contains(displayName, term):
+				rank = 500
+			default:
+				continue
+			}
+		}
+
+		u := *user
+		u.Status = "offline"
+		matches = append(matches, ranked{
+			user:   u,
+			cursor: models.DirectoryCursor{Rank: rank, Username: strings.ToLower(u.Username), ID: u.ID},
+		})
+	}
+
+	less := func(a, b models.DirectoryCursor) bool {
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(matches, func(i, j int) bool { return less(matches[i].cursor, matches[j].cursor) })
+
+	page := &models.DirectoryPage{Users: []models.User{}}
+	for i, m := range matches {
+		if q.After != nil && !less(*q.After, m.cursor) {
+			continue
+		}
+		if len(page.Users) == q.Limit {
+			page.NextCursor = matches[i-1].cursor.Encode()
+			break
+		}
+		page.Users = append(page.Users, m.user)
+	}
+	return page, nil
+}
+
+func (r *TestUserRepository) GetUserByID(id int) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (r *TestUserRepository) GetUserByUsername(username string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			u := *user
+			return &u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r *TestUserRepository) GetUserIDsByUsernames(usernames []string) (map[string]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		wanted[username] = true
+	}
+	ids := make(map[string]int)
+	for _, user := range r.users {
+		if wanted[user.Username] {
+			ids[user.Username] = user.ID
+		}
+	}
+	return ids, nil
+}
+
+func (r *TestUserRepository) UpdateUser(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.ID]; !ok {
+		return ErrUserNotFound
+	}
+	u := *user
+	r.users[user.ID] = &u
+	return nil
+}
+
+func (r *TestUserRepository) UpdateUserStatus(userID int, status string) error {
+	return nil
+}
+
+func (r *TestUserRepository) SetUserSuspended(userID int, suspended bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Suspended = suspended
+	return nil
+}
+
+func (r *TestUserRepository) GetActiveRole(userID int) (string, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.Suspended {
+		return "", false, nil
+	}
+	return user.Role, true, nil
+}
+
+func (r *TestUserRepository) SetUserRole(userID int, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	return nil
+}
+
+func (r *TestUserRepository) SetUserExternal(userID int, external bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.External = external
+	return nil
+}
+
+func (r *TestUserRepository) DeleteUser(userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userID]; !ok {
+		return ErrUserNotFound
+	}
+	delete(r.users, userID)
+	delete(r.storage, userID)
+	return nil
+}
+
+// account returns a user's storage account, creating an empty one on first use.
+// The caller must hold the write lock.
+func (r *TestUserRepository) account(userID int) (*models.StorageAccount, error) {
+	if _, ok := r.users[userID]; !ok {
+		return nil, ErrUserNotFound
+	}
+	account, ok := r.storage[userID]
+	if !ok {
+		account = &models.StorageAccount{}
+		r.storage[userID] = account
+	}
+	return account, nil
+}
+
+func (r *TestUserRepository) GetStorage(userID int) (*models.StorageAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account, err := r.account(userID)
+	if err != nil {
+		return nil, err
+	}
+	a := *account
+	return &a, nil
+}
+
+func (r *TestUserRepository) TotalStorageUsed() (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.totalStorageUsed(), nil
+}
+
+func (r *TestUserRepository) totalStorageUsed() int64 {
+	var total int64
+	for _, account := range r.storage {
+		total += account.Used
+	}
+	return total
+}
+
+func (r *TestUserRepository) ReserveStorage(userID int, size int64, limits models.StorageLimits) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account, err := r.account(userID)
+	if err != nil {
+		return err
+	}
+	if err := limits.Check(*account, r.totalStorageUsed(), size); err != nil {
+		return err
+	}
+	account.Used += size
+	return nil
+}
+
+func (r *TestUserRepository) ReleaseStorage(userID int, size int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if account, ok := r.storage[userID]; ok {
+		account.Used -= size
+		if account.Used < 0 {
+			account.Used = 0
+		}
+	}
+	return nil
+}
+
+func (r *TestUserRepository) SetStorageQuota(userID int, quota *int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account, err := r.account(userID)
+	if err != nil {
+		return err
+	}
+	account.Quota = quota
+	return nil
+}
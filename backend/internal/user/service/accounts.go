@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
+	"github.com/Mousa96/chatting-service/internal/user/repository"
+)
+
+// AccountChecker tells the auth middleware, WebSocket service and message service whether
+// a user exists and may still act, and with which role
+type AccountChecker struct {
+	repo repository.Repository
+}
+
+// NewAccountChecker creates an AccountChecker backed by the user repository
+func NewAccountChecker(repo repository.Repository) *AccountChecker {
+	return &AccountChecker{repo: repo}
+}
+
+// ActiveRole returns the role userID holds now, and false when the user has been
+// suspended or deleted
+func (c *AccountChecker) ActiveRole(userID int) (authModels.Role, bool, error) {
+	role, active, err := c.repo.GetActiveRole(userID)
+	if err != nil || !active {
+		return "", false, err
+	}
+	if role == "" {
+		return authModels.RoleUser, true, nil
+	}
+	return authModels.Role(role), true, nil
+}
+
+// IsActive reports whether userID names a user that is neither suspended nor deleted
+func (c *AccountChecker) IsActive(userID int) (bool, error) {
+	_, active, err := c.repo.GetActiveRole(userID)
+	return active, err
+}
+
+// UserExists reports whether userID names a user, suspended or not
+func (c *AccountChecker) UserExists(userID int) (bool, error) {
+	if _, err := c.repo.GetUserByID(userID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
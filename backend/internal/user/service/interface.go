@@ -1,12 +1,38 @@
 package service
 
-import "github.com/Mousa96/chatting-service/internal/user/models"
+import (
+    "mime/multipart"
+
+    "github.com/Mousa96/chatting-service/internal/user/models"
+)
 
 // Service defines business logic for user operations
 type Service interface {
     GetAllUsers() ([]models.User, error)
+    SearchUsers(currentUserID int, req models.DirectoryRequest) (*models.DirectoryPage, error)
     GetUserByID(id int) (*models.User, error)
     GetUserByUsername(username string) (*models.User, error)
     UpdateUser(user *models.User) error
     UpdateUserStatus(userID int, status string) error
+    SuspendUser(userID int, suspended bool) error
+    SetUserRole(userID int, role string) error
+    // SetUserExternal marks a user as external, such as a contractor, or internal
+    SetUserExternal(userID int, external bool) error
+    DeleteUser(userID int) error
+    UpdateProfile(userID int, req *models.UpdateProfileRequest) (*models.User, error)
+    UploadAvatar(userID int, file *multipart.FileHeader) (*models.User, error)
+    // GetStorageUsage reports the media storage a user has used against their quota
+    GetStorageUsage(userID int) (*models.StorageUsage, error)
+    // SetStorageQuota overrides a user's storage quota, or restores the default when quota is nil
+    SetStorageQuota(userID int, quota *int64) (*models.StorageUsage, error)
+}
+
+// Notifier pushes real-time events to connected WebSocket clients
+type Notifier interface {
+    NotifyAll(eventType string, payload interface{})
+}
+
+// Presence reports which users currently have an open WebSocket connection
+type Presence interface {
+    OnlineUserIDs() []int
 }
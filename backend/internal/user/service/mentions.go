@@ -0,0 +1,18 @@
+package service
+
+import "github.com/Mousa96/chatting-service/internal/user/repository"
+
+// MentionResolver looks up the users mentioned in messages for the message service
+type MentionResolver struct {
+	repo repository.Repository
+}
+
+// NewMentionResolver creates a MentionResolver backed by the user repository
+func NewMentionResolver(repo repository.Repository) *MentionResolver {
+	return &MentionResolver{repo: repo}
+}
+
+// ResolveUsernames maps each of usernames that belongs to a user to that user's ID
+func (r *MentionResolver) ResolveUsernames(usernames []string) (map[string]int, error) {
+	return r.repo.GetUserIDsByUsernames(usernames)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/user/models"
+	"github.com/Mousa96/chatting-service/internal/user/repository"
+)
+
+// ErrInvalidQuota is returned when an administrator sets a negative storage quota
+var ErrInvalidQuota = errors.New("invalid storage quota")
+
+// StorageQuota enforces storage limits on media uploads, tracking each user's usage in
+// the user repository
+type StorageQuota struct {
+	repo   repository.Repository
+	limits models.StorageLimits
+}
+
+// NewStorageQuota creates a StorageQuota applying limits to the users in repo
+func NewStorageQuota(repo repository.Repository, limits models.StorageLimits) *StorageQuota {
+	return &StorageQuota{repo: repo, limits: limits}
+}
+
+func (q *StorageQuota) Check(userID int, size int64) error {
+	account, err := q.repo.GetStorage(userID)
+	if err != nil {
+		return err
+	}
+	var total int64
+	if q.limits.GlobalQuota > 0 {
+		if total, err = q.repo.TotalStorageUsed(); err != nil {
+			return err
+		}
+	}
+	return quotaError(q.limits.Check(*account, total, size))
+}
+
+func (q *StorageQuota) Reserve(userID int, size int64) error {
+	return quotaError(q.repo.ReserveStorage(userID, size, q.limits))
+}
+
+func (q *StorageQuota) Release(userID int, size int64) error {
+	return q.repo.ReleaseStorage(userID, size)
+}
+
+// quotaError wraps quota errors from the repository in the message service's sentinel
+func quotaError(err error) error {
+	var quotaErr *models.QuotaError
+	if errors.As(err, &quotaErr) {
+		return fmt.Errorf("%w: %v", msgService.ErrQuotaExceeded, quotaErr)
+	}
+	return err
+}
+
+// GetStorageUsage reports the storage a user has used against their quota
+func (s *UserService) GetStorageUsage(userID int) (*models.StorageUsage, error) {
+	account, err := s.repo.GetStorage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &models.StorageUsage{UsedBytes: account.Used, CustomQuota: account.Quota != nil}
+	if quota, ok := s.storageLimits.QuotaFor(*account); ok {
+		remaining := quota - account.Used
+		if remaining < 0 {
+			remaining = 0
+		}
+		usage.QuotaBytes = &quota
+		usage.RemainingBytes = &remaining
+	}
+	return usage, nil
+}
+
+// SetStorageQuota gives a user a storage quota of their own, or returns them to the
+// default when quota is nil. Lowering a quota below what the user already stores keeps
+// their files but refuses new uploads.
+func (s *UserService) SetStorageQuota(userID int, quota *int64) (*models.StorageUsage, error) {
+	if quota != nil && *quota < 0 {
+		return nil, fmt.Errorf("%w: quota cannot be negative", ErrInvalidQuota)
+	}
+	if err := s.repo.SetStorageQuota(userID, quota); err != nil {
+		return nil, err
+	}
+	return s.GetStorageUsage(userID)
+}
@@ -1,18 +1,97 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Mousa96/chatting-service/internal/storage"
 	"github.com/Mousa96/chatting-service/internal/user/models"
 	"github.com/Mousa96/chatting-service/internal/user/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+)
+
+const (
+	maxDisplayNameLength = 100
+	maxBioLength         = 500
+	maxAvatarSize        = 5 << 20 // 5MB
+
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 100
+	maxDirectoryQuery     = 100
 )
 
+var (
+	// ErrInvalidProfile is returned when a profile update fails validation
+	ErrInvalidProfile = errors.New("invalid profile")
+	// ErrInvalidAvatar is returned when an uploaded avatar is too large or not an image
+	ErrInvalidAvatar = errors.New("invalid avatar")
+	// ErrInvalidSearch is returned when a directory search has invalid parameters
+	ErrInvalidSearch = errors.New("invalid search")
+)
+
+// avatarExtensions maps the accepted avatar content types to file extensions
+var avatarExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
 // UserService implements Service interface
 type UserService struct {
-	repo       repository.Repository
+	repo     repository.Repository
+	storage  storage.Storage
+	notifier Notifier
+	presence Presence
+	// storageLimits are reported with each user's storage usage
+	storageLimits models.StorageLimits
+}
+
+// Option configures optional UserService dependencies
+type Option func(*UserService)
+
+// WithStorage sets the storage used for avatar uploads
+func WithStorage(storage storage.Storage) Option {
+	return func(s *UserService) {
+		s.storage = storage
+	}
+}
+
+// WithNotifier sets the notifier used to push profile changes to connected clients
+func WithNotifier(notifier Notifier) Option {
+	return func(s *UserService) {
+		s.notifier = notifier
+	}
+}
+
+// WithStorageLimits sets the quotas reported with storage usage. Uploads are held to
+// them by a StorageQuota.
+func WithStorageLimits(limits models.StorageLimits) Option {
+	return func(s *UserService) {
+		s.storageLimits = limits
+	}
+}
+
+// WithPresence sets the source of online status used by the user directory
+func WithPresence(presence Presence) Option {
+	return func(s *UserService) {
+		s.presence = presence
+	}
 }
 
 // NewUserService creates a new UserService
-func NewUserService(repo repository.Repository) Service {
-	return &UserService{repo: repo}
+func NewUserService(repo repository.Repository, opts ...Option) Service {
+	s := &UserService{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // GetAllUsers retrieves all users
@@ -22,28 +101,71 @@ func (s *UserService) GetAllUsers() ([]models.User, error) {
 		return nil, err
 	}
 	
-	// Enhance with online status from WebSocket service if available
-	// if s.wsService != nil {
-	// 	connectedUsers, err := s.wsService.GetConnectedUsers()
-	// 	if err == nil {
-	// 		// Create a map for faster lookup
-	// 		onlineMap := make(map[int]bool)
-	// 		for _, id := range connectedUsers {
-	// 			onlineMap[id] = true
-	// 		}
-			
-	// 		// Update user status
-	// 		for i := range users {
-	// 			if onlineMap[users[i].ID] {
-	// 				users[i].Status = "online"
-	// 			}
-	// 		}
-	// 	}
-	// }
-	
+	online := s.onlineUsers()
+	for i := range users {
+		if online[users[i].ID] {
+			users[i].Status = "online"
+		}
+	}
+
 	return users, nil
 }
 
+// SearchUsers returns a page of the user directory as seen by currentUserID
+func (s *UserService) SearchUsers(currentUserID int, req models.DirectoryRequest) (*models.DirectoryPage, error) {
+	query := models.DirectoryQuery{
+		Query:    strings.TrimSpace(req.Query),
+		Online:   req.Online,
+		ViewerID: currentUserID,
+		Limit:    req.Limit,
+	}
+	if utf8.RuneCountInString(query.Query) > maxDirectoryQuery {
+		return nil, fmt.Errorf("%w: search term must be at most %d characters", ErrInvalidSearch, maxDirectoryQuery)
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultDirectoryLimit
+	}
+	if query.Limit > maxDirectoryLimit {
+		query.Limit = maxDirectoryLimit
+	}
+	if req.Cursor != "" {
+		after, err := models.DecodeDirectoryCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.After = after
+	}
+
+	online := s.onlineUsers()
+	if query.Online != nil {
+		for id := range online {
+			query.OnlineUserIDs = append(query.OnlineUserIDs, id)
+		}
+	}
+
+	page, err := s.repo.SearchUsers(query)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Users {
+		if online[page.Users[i].ID] {
+			page.Users[i].Status = "online"
+		}
+	}
+	return page, nil
+}
+
+// onlineUsers returns the set of connected users, or an empty set without a presence source
+func (s *UserService) onlineUsers() map[int]bool {
+	online := make(map[int]bool)
+	if s.presence != nil {
+		for _, id := range s.presence.OnlineUserIDs() {
+			online[id] = true
+		}
+	}
+	return online
+}
+
 // GetUserByID retrieves a user by ID
 func (s *UserService) GetUserByID(id int) (*models.User, error) {
 	user, err := s.repo.GetUserByID(id)
@@ -54,15 +176,10 @@ func (s *UserService) GetUserByID(id int) (*models.User, error) {
 	// Default status to offline
 	user.Status = "offline"
 	
-	// Check if user is online
-	// if s.wsService != nil {
-	// 	status, err := s.wsService.GetUserStatus(id)
-	// 	// Only update if we get a valid online status
-	// 	if err == nil && status == wsModels.StatusOnline {
-	// 		user.Status = "online"
-	// 	}
-	// }
-	
+	if s.onlineUsers()[id] {
+		user.Status = "online"
+	}
+
 	return user, nil
 }
 
@@ -102,4 +219,144 @@ func (s *UserService) UpdateUserStatus(userID int, status string) error {
 	// }
 	
 	return nil
-} 
\ No newline at end of file
+}
+
+// SuspendUser suspends or reinstates a user account
+func (s *UserService) SuspendUser(userID int, suspended bool) error {
+	return s.repo.SetUserSuspended(userID, suspended)
+}
+
+// SetUserRole changes the role of a user
+func (s *UserService) SetUserRole(userID int, role string) error {
+	return s.repo.SetUserRole(userID, role)
+}
+
+// SetUserExternal marks a user as external or internal
+func (s *UserService) SetUserExternal(userID int, external bool) error {
+	return s.repo.SetUserExternal(userID, external)
+}
+
+// DeleteUser permanently removes a user account
+func (s *UserService) DeleteUser(userID int) error {
+	return s.repo.DeleteUser(userID)
+}
+
+// UpdateProfile applies a partial profile update and notifies connected clients
+func (s *UserService) UpdateProfile(userID int, req *models.UpdateProfileRequest) (*models.User, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if err := validateText("display name", displayName, maxDisplayNameLength, false); err != nil {
+			return nil, err
+		}
+		user.DisplayName = displayName
+	}
+
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if err := validateText("bio", bio, maxBioLength, true); err != nil {
+			return nil, err
+		}
+		user.Bio = bio
+	}
+
+	if req.TimeZone != nil {
+		timeZone := strings.TrimSpace(*req.TimeZone)
+		if timeZone != "" {
+			if _, err := time.LoadLocation(timeZone); err != nil {
+				return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidProfile, timeZone)
+			}
+		}
+		user.TimeZone = timeZone
+	}
+
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	s.notifyProfileUpdated(user)
+	return user, nil
+}
+
+// UploadAvatar stores a new avatar image and sets it on the user's profile
+func (s *UserService) UploadAvatar(userID int, file *multipart.FileHeader) (*models.User, error) {
+	if s.storage == nil {
+		return nil, errors.New("avatar storage is not configured")
+	}
+	if file.Size > maxAvatarSize {
+		return nil, fmt.Errorf("%w: file exceeds %d bytes", ErrInvalidAvatar, maxAvatarSize)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	// Detect content type from the file content rather than trusting the client
+	buffer := make([]byte, 512)
+	n, err := src.Read(buffer)
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidAvatar)
+	}
+	contentType := http.DetectContentType(buffer[:n])
+	ext, ok := avatarExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidAvatar, contentType)
+	}
+	if _, err := src.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("failed to process file: %w", err)
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	filename := fmt.Sprintf("avatars/%d_%d%s", userID, time.Now().UnixNano(), ext)
+	url, err := s.storage.Upload(filename, src, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload avatar: %w", err)
+	}
+
+	user.AvatarURL = url
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	s.notifyProfileUpdated(user)
+	return user, nil
+}
+
+// notifyProfileUpdated pushes the user's public profile to every connected client
+func (s *UserService) notifyProfileUpdated(user *models.User) {
+	if s.notifier == nil {
+		return
+	}
+	s.notifier.NotifyAll(wsModels.EventUserProfileUpdated, wsModels.UserProfileEvent{
+		UserID:      user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		Bio:         user.Bio,
+		TimeZone:    user.TimeZone,
+	})
+	log.Printf("Profile updated for user %d", user.ID)
+}
+
+// validateText checks a free-text profile field for length and control characters
+func validateText(field, value string, maxLength int, allowNewlines bool) error {
+	if utf8.RuneCountInString(value) > maxLength {
+		return fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidProfile, field, maxLength)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) && !(allowNewlines && r == '\n') {
+			return fmt.Errorf("%w: %s contains invalid characters", ErrInvalidProfile, field)
+		}
+	}
+	return nil
+}
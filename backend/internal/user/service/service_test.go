@@ -0,0 +1,322 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	"github.com/Mousa96/chatting-service/internal/user/models"
+	"github.com/Mousa96/chatting-service/internal/user/repository"
+	wsModels "github.com/Mousa96/chatting-service/internal/websocket/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockNotifier struct {
+	mock.Mock
+}
+
+func (m *mockNotifier) NotifyAll(eventType string, payload interface{}) {
+	m.Called(eventType, payload)
+}
+
+type mockStorage struct {
+	mock.Mock
+}
+
+func (m *mockStorage) Upload(filename string, content io.Reader, contentType string) (string, error) {
+	args := m.Called(filename, content, contentType)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockStorage) Delete(filename string) error {
+	args := m.Called(filename)
+	return args.Error(0)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// newFileHeader builds a multipart file header the same way an HTTP upload would
+func newFileHeader(t *testing.T, filename string, content []byte) *multipart.FileHeader {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	require.NoError(t, req.ParseMultipartForm(1<<20))
+	return req.MultipartForm.File["file"][0]
+}
+
+func TestUpdateProfile(t *testing.T) {
+	tests := []struct {
+		name        string
+		request     *models.UpdateProfileRequest
+		expectedErr bool
+		check       func(t *testing.T, user *models.User)
+	}{
+		{
+			name: "Set all fields",
+			request: &models.UpdateProfileRequest{
+				DisplayName: strPtr("  Alice Liddell "),
+				Bio:         strPtr("Curiouser and curiouser\nWonderland"),
+				TimeZone:    strPtr("Europe/London"),
+			},
+			check: func(t *testing.T, user *models.User) {
+				assert.Equal(t, "Alice Liddell", user.DisplayName)
+				assert.Equal(t, "Curiouser and curiouser\nWonderland", user.Bio)
+				assert.Equal(t, "Europe/London", user.TimeZone)
+			},
+		},
+		{
+			name:    "Omitted fields are unchanged",
+			request: &models.UpdateProfileRequest{Bio: strPtr("")},
+			check: func(t *testing.T, user *models.User) {
+				assert.Equal(t, "Old Name", user.DisplayName)
+				assert.Empty(t, user.Bio)
+			},
+		},
+		{
+			name:        "Display name too long",
+			request:     &models.UpdateProfileRequest{DisplayName: strPtr(strings.Repeat("a", 101))},
+			expectedErr: true,
+		},
+		{
+			name:        "Display name with newline",
+			request:     &models.UpdateProfileRequest{DisplayName: strPtr("Alice\nBob")},
+			expectedErr: true,
+		},
+		{
+			name:        "Unknown time zone",
+			request:     &models.UpdateProfileRequest{TimeZone: strPtr("Mars/Olympus_Mons")},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewTestUserRepository()
+			repo.AddUser(models.User{ID: 1, Username: "alice", DisplayName: "Old Name", Bio: "Old bio"})
+			notifier := new(mockNotifier)
+			userService := NewUserService(repo, WithNotifier(notifier))
+
+			if !tt.expectedErr {
+				notifier.On("NotifyAll", wsModels.EventUserProfileUpdated, mock.AnythingOfType("models.UserProfileEvent")).Once()
+			}
+
+			user, err := userService.UpdateProfile(1, tt.request)
+			if tt.expectedErr {
+				assert.ErrorIs(t, err, ErrInvalidProfile)
+				assert.Nil(t, user)
+				notifier.AssertNotCalled(t, "NotifyAll", mock.Anything, mock.Anything)
+				return
+			}
+
+			require.NoError(t, err)
+			tt.check(t, user)
+
+			stored, err := repo.GetUserByID(1)
+			require.NoError(t, err)
+			tt.check(t, stored)
+			notifier.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUploadAvatar(t *testing.T) {
+	pngHeader := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0}
+
+	t.Run("Valid image", func(t *testing.T) {
+		repo := repository.NewTestUserRepository()
+		repo.AddUser(models.User{ID: 1, Username: "alice"})
+		storage := new(mockStorage)
+		storage.On("Upload", mock.MatchedBy(func(name string) bool {
+			return strings.HasPrefix(name, "avatars/1_") && strings.HasSuffix(name, ".png")
+		}), mock.Anything, "image/png").Return("/uploads/avatars/1_1.png", nil)
+		userService := NewUserService(repo, WithStorage(storage))
+
+		user, err := userService.UploadAvatar(1, newFileHeader(t, "me.png", pngHeader))
+		require.NoError(t, err)
+		assert.Equal(t, "/uploads/avatars/1_1.png", user.AvatarURL)
+		storage.AssertExpectations(t)
+	})
+
+	t.Run("Not an image", func(t *testing.T) {
+		repo := repository.NewTestUserRepository()
+		repo.AddUser(models.User{ID: 1, Username: "alice"})
+		storage := new(mockStorage)
+		userService := NewUserService(repo, WithStorage(storage))
+
+		_, err := userService.UploadAvatar(1, newFileHeader(t, "me.png", []byte("plain text")))
+		assert.ErrorIs(t, err, ErrInvalidAvatar)
+		storage.AssertNotCalled(t, "Upload", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+type fakePresence []int
+
+func (p fakePresence) OnlineUserIDs() []int {
+	return p
+}
+
+func newDirectoryService() Service {
+	repo := repository.NewTestUserRepository()
+	repo.AddUser(models.User{ID: 1, Username: "me"})
+	repo.AddUser(models.User{ID: 2, Username: "alice"})
+	repo.AddUser(models.User{ID: 3, Username: "Alfred", DisplayName: "Al"})
+	repo.AddUser(models.User{ID: 4, Username: "bob", DisplayName: "Bob Alison"})
+	repo.AddUser(models.User{ID: 5, Username: "carol"})
+	repo.AddUser(models.User{ID: 6, Username: "alex", Suspended: true})
+	repo.AddUser(models.User{ID: 7, Username: "malice"})
+	return NewUserService(repo, WithPresence(fakePresence{2, 5}))
+}
+
+func usernames(users []models.User) []string {
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Username)
+	}
+	return names
+}
+
+func TestSearchUsers(t *testing.T) {
+	boolPtr := func(b bool) *bool { return &b }
+
+	tests := []struct {
+		name     string
+		request  models.DirectoryRequest
+		expected []string
+	}{
+		{
+			name:     "Lists everyone except self and suspended users",
+			request:  models.DirectoryRequest{},
+			expected: []string{"Alfred", "alice", "bob", "carol", "malice"},
+		},
+		{
+			name:     "Prefix matches rank above other matches",
+			request:  models.DirectoryRequest{Query: " AL "},
+			expected: []string{"Alfred", "alice", "bob", "malice"},
+		},
+		{
+			name:     "Online only",
+			request:  models.DirectoryRequest{Online: boolPtr(true)},
+			expected: []string{"alice", "carol"},
+		},
+		{
+			name:     "Offline only",
+			request:  models.DirectoryRequest{Query: "al", Online: boolPtr(false)},
+			expected: []string{"Alfred", "bob", "malice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := newDirectoryService().SearchUsers(1, tt.request)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, usernames(page.Users))
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+}
+
+func TestSearchUsersPagination(t *testing.T) {
+	userService := newDirectoryService()
+
+	var names []string
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		page, err := userService.SearchUsers(1, models.DirectoryRequest{Cursor: cursor, Limit: 2})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Users), 2)
+		names = append(names, usernames(page.Users)...)
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	assert.Equal(t, []string{"Alfred", "alice", "bob", "carol", "malice"}, names)
+}
+
+func TestSearchUsersStatus(t *testing.T) {
+	page, err := newDirectoryService().SearchUsers(1, models.DirectoryRequest{Query: "ca"})
+	require.NoError(t, err)
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, "online", page.Users[0].Status)
+}
+
+func TestSearchUsersInvalidRequest(t *testing.T) {
+	userService := newDirectoryService()
+
+	_, err := userService.SearchUsers(1, models.DirectoryRequest{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, models.ErrInvalidCursor)
+
+	_, err = userService.SearchUsers(1, models.DirectoryRequest{Query: strings.Repeat("a", 101)})
+	assert.ErrorIs(t, err, ErrInvalidSearch)
+}
+
+func TestStorageQuota(t *testing.T) {
+	repo := repository.NewTestUserRepository()
+	repo.AddUser(models.User{ID: 1, Username: "alice"})
+	repo.AddUser(models.User{ID: 2, Username: "bob"})
+	limits := models.StorageLimits{DefaultQuota: 100, GlobalQuota: 150}
+	quota := NewStorageQuota(repo, limits)
+	svc := NewUserService(repo, WithStorageLimits(limits))
+
+	require.NoError(t, quota.Reserve(1, 60))
+	err := quota.Reserve(1, 50)
+	assert.ErrorIs(t, err, msgService.ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "only 40 of your 100 byte quota is available")
+	assert.ErrorIs(t, quota.Check(1, 41), msgService.ErrQuotaExceeded)
+	assert.NoError(t, quota.Check(1, 40))
+
+	usage, err := svc.GetStorageUsage(1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), usage.UsedBytes)
+	assert.Equal(t, int64(100), *usage.QuotaBytes)
+	assert.Equal(t, int64(40), *usage.RemainingBytes)
+	assert.False(t, usage.CustomQuota)
+
+	// The global quota is shared by everyone
+	require.NoError(t, quota.Reserve(2, 80))
+	err = quota.Reserve(1, 20)
+	assert.ErrorIs(t, err, msgService.ErrQuotaExceeded)
+	assert.ErrorContains(t, err, "run out of storage space")
+	require.NoError(t, quota.Release(2, 80))
+	require.NoError(t, quota.Reserve(1, 20))
+
+	// An override replaces the default, and zero refuses all uploads
+	zero := int64(0)
+	usage, err = svc.SetStorageQuota(2, &zero)
+	require.NoError(t, err)
+	assert.True(t, usage.CustomQuota)
+	assert.Equal(t, int64(0), *usage.RemainingBytes)
+	assert.ErrorIs(t, quota.Reserve(2, 1), msgService.ErrQuotaExceeded)
+
+	usage, err = svc.SetStorageQuota(2, nil)
+	require.NoError(t, err)
+	assert.False(t, usage.CustomQuota)
+	assert.NoError(t, quota.Reserve(2, 1))
+
+	negative := int64(-1)
+	_, err = svc.SetStorageQuota(2, &negative)
+	assert.ErrorIs(t, err, ErrInvalidQuota)
+
+	// Without a default quota only the global one applies
+	usage, err = NewUserService(repo).GetStorageUsage(1)
+	require.NoError(t, err)
+	assert.Nil(t, usage.QuotaBytes)
+	assert.Nil(t, usage.RemainingBytes)
+}
@@ -2,6 +2,9 @@ package models
 
 import (
 	"encoding/json"
+
+	mediaModels "github.com/Mousa96/chatting-service/internal/media/models"
+	messageModels "github.com/Mousa96/chatting-service/internal/message/models"
 )
 
 type Event struct {
@@ -18,10 +21,34 @@ const (
 	EventBroadcastMessage = "broadcast_message"
 	EventStatusChange     = "status_change"
 	EventMessageRead      = "message_read"
+	// EventMessagePlayed is sent by the recipient of a voice message on first playing it
+	EventMessagePlayed = "message_played"
 	EventGetOnlineUsers   = "get_online_users"
 	EventUserOnline   = "user_online"
     EventUserOffline  = "user_offline" 
     EventUserStatus   = "user_status"
+	EventUserProfileUpdated = "user_profile_updated"
+	EventError              = "error"
+
+	EventContactRequestReceived  = "contact_request_received"
+	EventContactRequestAccepted  = "contact_request_accepted"
+	EventContactRequestDeclined  = "contact_request_declined"
+	EventContactRequestCancelled = "contact_request_cancelled"
+	EventContactRemoved          = "contact_removed"
+
+	EventMessageHidden     = "message_hidden"
+	// EventMessageUpdated carries details of a message that became available after it was sent
+	EventMessageUpdated = "message_updated"
+	EventModerationWarning = "moderation_warning"
+	// EventScheduledMessageFailed tells a sender that a scheduled message could not be sent
+	EventScheduledMessageFailed = "scheduled_message_failed"
+	// EventMessageExpired tells conversation participants that a message was deleted by
+	// its timer or the retention policy
+	EventMessageExpired = "message_expired"
+	// EventMessagePinned and EventMessageUnpinned tell conversation participants that a
+	// message was pinned or unpinned
+	EventMessagePinned   = "message_pinned"
+	EventMessageUnpinned = "message_unpinned"
 )
 
 
@@ -32,19 +59,26 @@ const (
 	StatusSent      MessageStatus = "sent"
 	StatusDelivered MessageStatus = "delivered"
 	StatusRead      MessageStatus = "read"
+	StatusPlayed    MessageStatus = "played"
 )
 
 // Event payloads
 type SendMessageEvent struct {
-	Message  string `json:"message"`
-	To       int    `json:"to"`
-	MediaURL string `json:"media_url,omitempty"`
+	Message       string `json:"message"`
+	To            int    `json:"to"`
+	MediaURL      string `json:"media_url,omitempty"`
+	AttachmentIDs []int  `json:"attachment_ids,omitempty"`
+	// Kind is "voice" for voice messages and defaults to text
+	Kind string `json:"kind,omitempty"`
 }
 
 type BroadcastMessageEvent struct {
-	Message     string `json:"message"`
-	ReceiverIDs []int  `json:"receiver_ids"`
-	MediaURL    string `json:"media_url,omitempty"`
+	Message       string `json:"message"`
+	ReceiverIDs   []int  `json:"receiver_ids"`
+	MediaURL      string `json:"media_url,omitempty"`
+	AttachmentIDs []int  `json:"attachment_ids,omitempty"`
+	// Kind is "voice" for voice messages and defaults to text
+	Kind string `json:"kind,omitempty"`
 }
 
 type StatusChangeEvent struct {
@@ -58,12 +92,88 @@ type UserStatusEvent struct {
 	Status string `json:"status"`
 }
 
+// UserProfileEvent carries the public profile of a user whose profile changed
+type UserProfileEvent struct {
+	UserID      int    `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	TimeZone    string `json:"time_zone,omitempty"`
+}
+
+// ContactRemovedEvent tells a user that another user removed them from their contacts
+type ContactRemovedEvent struct {
+	UserID int `json:"user_id"`
+}
+
+// MessageHiddenEvent tells conversation participants that a moderator removed a message
+type MessageHiddenEvent struct {
+	MessageID int `json:"message_id"`
+}
+
+// MessageExpiredEvent tells conversation participants that a message no longer exists
+type MessageExpiredEvent struct {
+	MessageID int `json:"message_id"`
+}
+
+// MessagePinEvent tells conversation participants who pinned or unpinned a message.
+// SenderID and ReceiverID identify the conversation.
+type MessagePinEvent struct {
+	MessageID  int    `json:"message_id"`
+	SenderID   int    `json:"sender_id"`
+	ReceiverID int    `json:"receiver_id"`
+	UserID     int    `json:"user_id"`
+	PinnedAt   string `json:"pinned_at,omitempty"`
+}
+
+// MessageUpdatedEvent tells conversation participants that a message gained a link preview
+type MessageUpdatedEvent struct {
+	MessageID   int                        `json:"message_id"`
+	LinkPreview *messageModels.LinkPreview `json:"link_preview,omitempty"`
+}
+
+// ModerationWarningEvent delivers a moderator's warning to a user
+type ModerationWarningEvent struct {
+	Message string `json:"message"`
+}
+
+// ScheduledMessageFailedEvent tells a sender why a scheduled message was not sent. The
+// message stays scheduled, marked failed, until it is edited or cancelled.
+type ScheduledMessageFailedEvent struct {
+	ID    int    `json:"id"`
+	Error string `json:"error"`
+}
+
+// ErrorEvent reports a failed client request, such as a refused message
+type ErrorEvent struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Filter names the content filter that rejected a message
+	Filter string `json:"filter,omitempty"`
+}
+
 type MessagePayload struct {
-	ID         int           `json:"id"`
-	SenderID   int           `json:"sender_id"`
-	ReceiverID int           `json:"receiver_id"`
-	Content    string        `json:"content"`
-	MediaURL   string        `json:"media_url,omitempty"`
-	Status     MessageStatus `json:"status"`
-	CreatedAt  string        `json:"created_at"`
+	ID          int                      `json:"id"`
+	SenderID    int                      `json:"sender_id"`
+	ReceiverID  int                      `json:"receiver_id"`
+	Kind        string                   `json:"kind"`
+	Content     string                   `json:"content"`
+	MediaURL    string                   `json:"media_url,omitempty"`
+	Attachments []mediaModels.Attachment `json:"attachments,omitempty"`
+	LinkPreview *messageModels.LinkPreview `json:"link_preview,omitempty"`
+	Entities    []messageModels.Entity     `json:"entities,omitempty"`
+	Status      MessageStatus            `json:"status"`
+	CreatedAt   string                   `json:"created_at"`
+	// Muted is set on the recipient's copy when they have muted the sender
+	Muted bool `json:"muted,omitempty"`
+	// Mentioned is set when the message mentions its receiver, who should be notified
+	// even when Muted
+	Mentioned bool `json:"mentioned,omitempty"`
+	// ScheduledID is set on messages that were scheduled, to the scheduled message they were
+	ScheduledID int `json:"scheduled_id,omitempty"`
+	// ExpiresAt is when the message will be deleted under its conversation's timer, and
+	// ExpireAfter how many seconds after being read it will be for timers counted from reading
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	ExpireAfter int    `json:"expire_after,omitempty"`
 }
\ No newline at end of file
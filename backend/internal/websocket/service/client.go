@@ -5,6 +5,7 @@ import (
 	"log"
 	"time"
 
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
 	"github.com/Mousa96/chatting-service/internal/websocket/models"
 	"github.com/gorilla/websocket"
 )
@@ -24,21 +25,51 @@ type Client struct {
 	wsService    *WebSocketService
 	egress     chan models.Event
 	userID     int
+	permissions []authModels.Permission
 	currentConversationWith int
 	isActive                bool
 }
 
-func NewClient(conn *websocket.Conn, wsService *WebSocketService, userID int) *Client {
+func NewClient(conn *websocket.Conn, wsService *WebSocketService, userID int, permissions []authModels.Permission) *Client {
 	return &Client{
 		connection: conn,
 		wsService:    wsService,
 		egress:     make(chan models.Event, 256),
 		userID:     userID,
+		permissions: permissions,
 		currentConversationWith: 0,
 		isActive: true,
 	}
 }
 
+// hasPermission checks if the client's token granted the given permission
+func (c *Client) hasPermission(permission authModels.Permission) bool {
+	for _, p := range c.permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// sendError reports a failed request back to this client as an error event
+func (c *Client) sendError(code, message string) {
+	c.sendErrorEvent(models.ErrorEvent{Code: code, Message: message})
+}
+
+// sendErrorEvent sends a fully populated error event to this client
+func (c *Client) sendErrorEvent(errorEvent models.ErrorEvent) {
+	event := models.Event{
+		Type:    models.EventError,
+		Payload: mustMarshal(errorEvent),
+	}
+	select {
+	case c.egress <- event:
+	default:
+		log.Printf("Message buffer full for user %d, dropping error event", c.userID)
+	}
+}
+
 func (c *Client) readMessages() {
 	defer func() {
 		c.wsService.removeClient(c)
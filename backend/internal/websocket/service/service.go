@@ -2,12 +2,14 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"sync"
 	"time"
 
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
 	"github.com/Mousa96/chatting-service/internal/message/models"
 	"github.com/Mousa96/chatting-service/internal/message/service"
 	"github.com/Mousa96/chatting-service/internal/middleware"
@@ -20,6 +22,12 @@ const (
 	EventUserStatus = "user_status"
 )
 
+// errorCodeNotPermitted is sent in error events when a message is refused
+const errorCodeNotPermitted = "not_permitted"
+
+// errorCodeInvalidMedia is sent when a message references media the sender did not upload
+const errorCodeInvalidMedia = "invalid_media"
+
 type WebSocketService struct {
 	upgrader  websocket.Upgrader
 	clients ClientList
@@ -30,6 +38,36 @@ type WebSocketService struct {
 	jwtKey         []byte
 	pendingMessages map[int][]*models.Message // userID -> pending messages
     pendingMutex    sync.RWMutex
+	relationships  Relationships
+	accounts       middleware.AccountChecker
+}
+
+// Relationships reports block and mute state between users
+type Relationships interface {
+	// BlockedUserIDs returns the IDs of the users blocked by userID
+	BlockedUserIDs(userID int) ([]int, error)
+	// BlockerIDs returns the IDs of the users who have blocked userID
+	BlockerIDs(userID int) ([]int, error)
+	// IsMuted reports whether userID has muted mutedID
+	IsMuted(userID, mutedID int) (bool, error)
+}
+
+// Option configures optional WebSocketService dependencies
+type Option func(*WebSocketService)
+
+// WithRelationships sets the block and mute lookups used to hide presence and flag muted conversations
+func WithRelationships(relationships Relationships) Option {
+	return func(s *WebSocketService) {
+		s.relationships = relationships
+	}
+}
+
+// WithAccountChecker refuses connections from users who have been suspended or deleted
+// since their token was issued, and grants the permissions of the role users hold now
+func WithAccountChecker(accounts middleware.AccountChecker) Option {
+	return func(s *WebSocketService) {
+		s.accounts = accounts
+	}
 }
 
 type SendResult struct {
@@ -38,7 +76,7 @@ type SendResult struct {
 	Error      error
 }
 
-func NewWebSocketService(messageService service.Service, jwtKey []byte) *WebSocketService {
+func NewWebSocketService(messageService service.Service, jwtKey []byte, opts ...Option) *WebSocketService {
 	m :=&WebSocketService{
 		clients: make(ClientList),
 		handlers: make(map[string]EventHandler),
@@ -53,6 +91,9 @@ func NewWebSocketService(messageService service.Service, jwtKey []byte) *WebSock
 		pendingMessages: make(map[int][]*models.Message),
 
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
 	m.setupEventHandlers()
 	return m
 }
@@ -61,9 +102,53 @@ func (s *WebSocketService) setupEventHandlers() {
 	s.handlers[websocketModels.EventSendMessage] = sendMessage
 	s.handlers[websocketModels.EventBroadcastMessage] = broadcastMessage
 	s.handlers[websocketModels.EventMessageRead] = HandleMessageRead
+	s.handlers[websocketModels.EventMessagePlayed] = handleMessagePlayed
 	s.handlers[websocketModels.EventGetOnlineUsers] = handleGetOnlineUsers
 }
 
+// reportRefusal tells the client why the message service refused its message, when
+// the refusal is one the sender can act on
+func (c *Client) reportRefusal(err error) {
+	var rejection *service.RejectionError
+	switch {
+	case errors.As(err, &rejection):
+		c.sendErrorEvent(websocketModels.ErrorEvent{
+			Code:    models.RejectionCode,
+			Message: rejection.Reason,
+			Filter:  rejection.Filter,
+		})
+	case errors.Is(err, service.ErrNotPermitted):
+		c.sendError(errorCodeNotPermitted, err.Error())
+	case errors.Is(err, service.ErrInvalidMedia):
+		c.sendError(errorCodeInvalidMedia, err.Error())
+	}
+}
+
+// newMessagePayload converts a stored message into the payload sent to clients
+func newMessagePayload(message *models.Message, status websocketModels.MessageStatus) websocketModels.MessagePayload {
+	var expiresAt string
+	if message.ExpiresAt != nil {
+		expiresAt = message.ExpiresAt.Format(time.RFC3339)
+	}
+	return websocketModels.MessagePayload{
+		ID:          message.ID,
+		SenderID:    message.SenderID,
+		ReceiverID:  message.ReceiverID,
+		Kind:        string(message.Kind),
+		Content:     message.Content,
+		MediaURL:    message.MediaURL,
+		Attachments: message.Attachments,
+		LinkPreview: message.LinkPreview,
+		Entities:    message.Entities,
+		Status:      status,
+		CreatedAt:   message.CreatedAt.Format(time.RFC3339),
+		Mentioned:   message.Mentioned,
+		ScheduledID: message.ScheduledID,
+		ExpiresAt:   expiresAt,
+		ExpireAfter: message.ExpireAfter,
+	}
+}
+
 func sendMessage(event *websocketModels.Event, c *Client) error {
 	fmt.Println("Sending message:", event)
 	var sendMessageEvent websocketModels.SendMessageEvent
@@ -76,53 +161,58 @@ func sendMessage(event *websocketModels.Event, c *Client) error {
 		ReceiverID: sendMessageEvent.To,
 		Content: sendMessageEvent.Message,
 		MediaURL: sendMessageEvent.MediaURL,
+		AttachmentIDs: sendMessageEvent.AttachmentIDs,
+		Kind: models.MessageKind(sendMessageEvent.Kind),
 	})
 	if err != nil {
+		c.reportRefusal(err)
 		return fmt.Errorf("error sending message: %v", err)
 	}
 
-	messagePayload := websocketModels.MessagePayload{
-		ID:         savedMessage.ID,
-		SenderID:   savedMessage.SenderID,
-		ReceiverID: savedMessage.ReceiverID,
-		Content:    savedMessage.Content,
-		MediaURL:   savedMessage.MediaURL,
-		Status:     websocketModels.StatusSent,
-		CreatedAt:  savedMessage.CreatedAt.Format(time.RFC3339),
-	}
+	c.wsService.DeliverMessage(savedMessage)
+	return nil
+}
+
+// DeliverMessage pushes a stored message to its sender and its receiver, queueing it
+// for the receiver if they are offline
+func (s *WebSocketService) DeliverMessage(message *models.Message) {
+	messagePayload := newMessagePayload(message, websocketModels.StatusSent)
 	
 	messageEvent := websocketModels.Event{
 		Type: websocketModels.EventReceiveMessage,
 		Payload: mustMarshal(messagePayload),
 	}
 
-	// Send confirmation to sender (this should always succeed since sender is connected)
-	senderResult := c.wsService.sendMessageToClient(c.userID, messageEvent)
+	// Send confirmation to sender
+	senderResult := s.sendMessageToClient(message.SenderID, messageEvent)
 	if senderResult.Error != nil {
-		log.Printf("Failed to send confirmation to sender %d: %v", c.userID, senderResult.Error)
+		log.Printf("Failed to send confirmation to sender %d: %v", message.SenderID, senderResult.Error)
 		// Don't return error here - message was saved, just confirmation failed
 	}
 
 	// Send to recipient
-	recipientResult := c.wsService.sendMessageToClient(sendMessageEvent.To, messageEvent)
+	recipientResult := s.sendMessageToClient(message.ReceiverID, s.recipientEvent(messagePayload))
 	if recipientResult.Error != nil {
-		log.Printf("Failed to send message to recipient %d: %v", sendMessageEvent.To, recipientResult.Error)
+		log.Printf("Failed to send message to recipient %d: %v", message.ReceiverID, recipientResult.Error)
 		// Don't return error - message was saved, recipient just has connection issues
 	} else if !recipientResult.UserOnline {
-		log.Printf("Recipient %d is offline, adding to pending queue", sendMessageEvent.To)
+		log.Printf("Recipient %d is offline, adding to pending queue", message.ReceiverID)
         // ADD THIS: Add to pending queue when user is offline
-        c.wsService.addToPendingQueue(savedMessage)
+        s.addToPendingQueue(message)
 	}
 
 	// Mark as delivered if message was successfully sent
 	if recipientResult.Success {
-		c.wsService.markAsDelivered(savedMessage.ID, sendMessageEvent.To)
+		s.markAsDelivered(message.ID, message.ReceiverID)
 	}
-
-	return nil
 }
 
 func broadcastMessage(event *websocketModels.Event, c *Client) error {
+	if !c.hasPermission(authModels.PermissionBroadcastMessages) {
+		c.sendError(errorCodeNotPermitted, "not allowed to broadcast messages")
+		return fmt.Errorf("user %d is not allowed to broadcast messages", c.userID)
+	}
+
 	var broadcastMessageEvent websocketModels.BroadcastMessageEvent
 	if err := json.Unmarshal(event.Payload, &broadcastMessageEvent); err != nil {
 		return fmt.Errorf("error unmarshalling event: %v", err)
@@ -133,8 +223,11 @@ func broadcastMessage(event *websocketModels.Event, c *Client) error {
 		ReceiverIDs: broadcastMessageEvent.ReceiverIDs,
 		Content:     broadcastMessageEvent.Message,
 		MediaURL:    broadcastMessageEvent.MediaURL,
+		AttachmentIDs: broadcastMessageEvent.AttachmentIDs,
+		Kind:        models.MessageKind(broadcastMessageEvent.Kind),
 	})
 	if err != nil {
+		c.reportRefusal(err)
 		return fmt.Errorf("error broadcasting message: %v", err)
 	}
 
@@ -144,15 +237,7 @@ func broadcastMessage(event *websocketModels.Event, c *Client) error {
 
 	// Send individual messages to each recipient
 	for _, message := range savedMessages {
-		messagePayload := websocketModels.MessagePayload{
-			ID:         message.ID,
-			SenderID:   message.SenderID,
-			ReceiverID: message.ReceiverID,
-			Content:    message.Content,
-			MediaURL:   message.MediaURL,
-			Status:     websocketModels.StatusSent,
-			CreatedAt:  message.CreatedAt.Format(time.RFC3339),
-		}
+		messagePayload := newMessagePayload(message, websocketModels.StatusSent)
 
 		messageEvent := websocketModels.Event{
 			Type: websocketModels.EventReceiveMessage,
@@ -166,7 +251,7 @@ func broadcastMessage(event *websocketModels.Event, c *Client) error {
 		}
 
 		// Send to recipient
-		recipientResult := c.wsService.sendMessageToClient(message.ReceiverID, messageEvent)
+		recipientResult := c.wsService.sendMessageToClient(message.ReceiverID, c.wsService.recipientEvent(messagePayload))
 		if recipientResult.Error != nil {
 			log.Printf("Failed to send broadcast to user %d: %v", message.ReceiverID, recipientResult.Error)
 			errorCount++
@@ -201,6 +286,9 @@ func (s *WebSocketService) markAsDelivered(messageID int, recipientID int) {
 		log.Printf("Error getting message: %v", err)
 		return
 	}
+	if message.Status == models.StatusPlayed {
+		return
+	}
 
 	// Send status change notification
 	statusChangeEvent := websocketModels.Event{
@@ -243,23 +331,13 @@ func (s *WebSocketService) processPendingMessages(userID int) {
     log.Printf("Processing %d pending messages for user %d", len(pending), userID)
     
     for _, message := range pending {
-        messagePayload := websocketModels.MessagePayload{
-            ID:         message.ID,
-            SenderID:   message.SenderID,
-            ReceiverID: message.ReceiverID,
-            Content:    message.Content,
-            MediaURL:   message.MediaURL,
-            Status:     websocketModels.StatusDelivered,
-            CreatedAt:  message.CreatedAt.Format(time.RFC3339),
-        }
-        
-        messageEvent := websocketModels.Event{
-            Type: websocketModels.EventReceiveMessage,
-            Payload: mustMarshal(messagePayload),
+        if message.ExpiresAt != nil && !message.ExpiresAt.After(time.Now()) {
+            continue
         }
+        messagePayload := newMessagePayload(message, websocketModels.StatusDelivered)
         
         // Send to user
-        result := s.sendMessageToClient(userID, messageEvent)
+        result := s.sendMessageToClient(userID, s.recipientEvent(messagePayload))
         if result.Success {
             // Mark as delivered
             s.markAsDelivered(message.ID, userID)
@@ -268,10 +346,20 @@ func (s *WebSocketService) processPendingMessages(userID int) {
 }
 // FIXED: Remove duplicate status notifications
 func (s *WebSocketService) MarkMessageAsRead(messageID, userID int) {
+	s.markAs(messageID, userID, websocketModels.StatusRead)
+}
+
+// MarkMessageAsPlayed records that the recipient of a voice message played it
+func (s *WebSocketService) MarkMessageAsPlayed(messageID, userID int) {
+	s.markAs(messageID, userID, websocketModels.StatusPlayed)
+}
+
+// markAs updates a status set by the recipient and tells the sender
+func (s *WebSocketService) markAs(messageID, userID int, status websocketModels.MessageStatus) {
 	// Update status in database
-	err := s.messageService.UpdateMessageStatus(messageID, models.StatusRead, userID)
+	err := s.messageService.UpdateMessageStatus(messageID, models.MessageStatus(status), userID)
 	if err != nil {
-		log.Printf("Error updating message %d to read: %v", messageID, err)
+		log.Printf("Error updating message %d to %s: %v", messageID, status, err)
 		return
 	}
 
@@ -281,13 +369,17 @@ func (s *WebSocketService) MarkMessageAsRead(messageID, userID int) {
 		log.Printf("Error getting message: %v", err)
 		return
 	}
+	// Played is final, so a later read receipt would only confuse the sender
+	if message.Status == models.StatusPlayed && status != websocketModels.StatusPlayed {
+		return
+	}
 
 	// Send unified status change event
 	statusChangeEvent := websocketModels.Event{
 		Type: websocketModels.EventStatusChange,
 		Payload: mustMarshal(websocketModels.StatusChangeEvent{
 			MessageID: messageID,
-			Status:    websocketModels.StatusRead,
+			Status:    status,
 			UserID:    userID,
 		}),
 	}
@@ -295,9 +387,9 @@ func (s *WebSocketService) MarkMessageAsRead(messageID, userID int) {
 	// FIXED: Only notify sender ONCE, not both sender and reader
 	senderResult := s.sendMessageToClient(message.SenderID, statusChangeEvent)
 	if senderResult.Error != nil {
-		log.Printf("Failed to notify sender of read receipt: %v", senderResult.Error)
+		log.Printf("Failed to notify sender of %s receipt: %v", status, senderResult.Error)
 	} else if !senderResult.UserOnline {
-		log.Printf("Sender %d is offline, read receipt not delivered", message.SenderID)
+		log.Printf("Sender %d is offline, %s receipt not delivered", message.SenderID, status)
 	}
 }
 
@@ -314,8 +406,21 @@ func HandleMessageRead(event *websocketModels.Event, c *Client) error {
 	return nil
 }
 
+// handleMessagePlayed marks a voice message played for its recipient
+func handleMessagePlayed(event *websocketModels.Event, c *Client) error {
+	var playedPayload struct {
+		MessageID int `json:"message_id"`
+	}
+	if err := json.Unmarshal(event.Payload, &playedPayload); err != nil {
+		return err
+	}
+
+	c.wsService.MarkMessageAsPlayed(playedPayload.MessageID, c.userID)
+	return nil
+}
+
 func handleGetOnlineUsers(event *websocketModels.Event, c *Client) error {
-    onlineUsers := c.wsService.getOnlineUserIDs()
+    onlineUsers := c.wsService.visibleOnlineUserIDs(c.userID)
     
     // Send current online users to the requesting client
     for _, userID := range onlineUsers {
@@ -339,7 +444,58 @@ func handleGetOnlineUsers(event *websocketModels.Event, c *Client) error {
     return nil
 }
 
-func (s *WebSocketService) getOnlineUserIDs() []int {
+// visibleOnlineUserIDs returns the online users whose presence viewerID may see,
+// leaving out users who have blocked the viewer
+func (s *WebSocketService) visibleOnlineUserIDs(viewerID int) []int {
+    online := s.OnlineUserIDs()
+    if s.relationships == nil {
+        return online
+    }
+
+    blockers, err := s.relationships.BlockerIDs(viewerID)
+    if err != nil {
+        log.Printf("Failed to load users who blocked %d: %v", viewerID, err)
+    }
+    hidden := make(map[int]bool, len(blockers))
+    for _, id := range blockers {
+        hidden[id] = true
+    }
+
+    visible := make([]int, 0, len(online))
+    for _, id := range online {
+        if !hidden[id] {
+            visible = append(visible, id)
+        }
+    }
+    return visible
+}
+
+// IsOnline reports whether a user has an open connection
+func (s *WebSocketService) IsOnline(userID int) bool {
+    s.RLock()
+    defer s.RUnlock()
+    _, ok := s.userClients[userID]
+    return ok
+}
+
+// recipientEvent builds the receive_message event for a message's recipient,
+// flagging it when the recipient has muted the sender so their client stays quiet
+func (s *WebSocketService) recipientEvent(payload websocketModels.MessagePayload) websocketModels.Event {
+    if s.relationships != nil {
+        muted, err := s.relationships.IsMuted(payload.ReceiverID, payload.SenderID)
+        if err != nil {
+            log.Printf("Failed to check mute for user %d: %v", payload.ReceiverID, err)
+        }
+        payload.Muted = muted
+    }
+    return websocketModels.Event{
+        Type:    websocketModels.EventReceiveMessage,
+        Payload: mustMarshal(payload),
+    }
+}
+
+// OnlineUserIDs returns the IDs of users with an open connection
+func (s *WebSocketService) OnlineUserIDs() []int {
     s.RLock()
     defer s.RUnlock()
     
@@ -371,11 +527,25 @@ func (s *WebSocketService) ServeWs(w http.ResponseWriter, r *http.Request) {
         return
     }
 	// validate the token
-	userID, err := middleware.ValidateTokenAndGetUserID(token, string(s.jwtKey))
+	claims, err := middleware.ValidateToken(token, string(s.jwtKey))
 	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
+	if s.accounts != nil {
+		role, active, err := s.accounts.ActiveRole(claims.UserID)
+		if err != nil {
+			log.Printf("Failed to check account of user %d: %v", claims.UserID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			http.Error(w, "Account suspended or deleted", http.StatusUnauthorized)
+			return
+		}
+		// Role changes apply to tokens already issued
+		claims.Role = role
+	}
 	// upgrade the connection to a websocket
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -383,7 +553,7 @@ func (s *WebSocketService) ServeWs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := NewClient(conn, s, userID)
+	client := NewClient(conn, s, claims.UserID, claims.EffectivePermissions())
 	s.addClient(client)
 
 	// start the client read and write processes
@@ -409,7 +579,7 @@ func (s *WebSocketService) addClient(client *Client) {
     
     // Send current online users to the new client
     go func() {
-        onlineUsers := s.getOnlineUserIDs()
+        onlineUsers := s.visibleOnlineUserIDs(client.userID)
         for _, userID := range onlineUsers {
             if userID != client.userID {
                 statusEvent := websocketModels.Event{
@@ -442,6 +612,27 @@ func (s *WebSocketService) removeClient(client *Client) {
     }
 }
 
+// DisconnectUser closes the user's active connection, if any, and reports whether one existed
+func (s *WebSocketService) DisconnectUser(userID int) bool {
+    s.RLock()
+    client, ok := s.userClients[userID]
+    s.RUnlock()
+    if !ok {
+        return false
+    }
+
+    log.Printf("Disconnecting user %d", userID)
+    s.removeClient(client)
+    return true
+}
+
+// ConnectedUserCount returns the number of users with an active connection
+func (s *WebSocketService) ConnectedUserCount() int {
+    s.RLock()
+    defer s.RUnlock()
+    return len(s.userClients)
+}
+
 func checkOrigin(r *http.Request) bool {
 	origin := r.Header.Get("Origin")
 	log.Println("origin:", origin)
@@ -495,6 +686,36 @@ func (s *WebSocketService) sendMessageToClient(userID int, event websocketModels
 	}
 }
 
+// NotifyUser sends an event to a single user and reports whether they were online to receive it
+func (s *WebSocketService) NotifyUser(userID int, eventType string, payload interface{}) bool {
+    result := s.sendMessageToClient(userID, websocketModels.Event{
+        Type:    eventType,
+        Payload: mustMarshal(payload),
+    })
+    if result.Error != nil {
+        log.Printf("Failed to send %s event to user %d: %v", eventType, userID, result.Error)
+    }
+    return result.Success
+}
+
+// NotifyAll sends an event to every connected client
+func (s *WebSocketService) NotifyAll(eventType string, payload interface{}) {
+    event := websocketModels.Event{
+        Type:    eventType,
+        Payload: mustMarshal(payload),
+    }
+
+    s.RLock()
+    defer s.RUnlock()
+    for client := range s.clients {
+        select {
+        case client.egress <- event:
+        default:
+            log.Printf("Failed to send %s event to user %d", eventType, client.userID)
+        }
+    }
+}
+
 func (s *WebSocketService) broadcastUserStatus(userID int, status string) {
     statusEvent := websocketModels.Event{
         Type: websocketModels.EventUserStatus,
@@ -504,9 +725,21 @@ func (s *WebSocketService) broadcastUserStatus(userID int, status string) {
         }),
     }
     
+    // Users blocked by userID must not learn whether they are online
+    hidden := make(map[int]bool)
+    if s.relationships != nil {
+        blocked, err := s.relationships.BlockedUserIDs(userID)
+        if err != nil {
+            log.Printf("Failed to load blocked users of %d: %v", userID, err)
+        }
+        for _, id := range blocked {
+            hidden[id] = true
+        }
+    }
+
     s.RLock()
     for client := range s.clients {
-        if client.userID != userID {
+        if client.userID != userID && !hidden[client.userID] {
             select {
             case client.egress <- statusEvent:
             default:
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	authModels "github.com/Mousa96/chatting-service/internal/auth/models"
+	msgRepository "github.com/Mousa96/chatting-service/internal/message/repository"
+	msgService "github.com/Mousa96/chatting-service/internal/message/service"
+	userModels "github.com/Mousa96/chatting-service/internal/user/models"
+	userRepository "github.com/Mousa96/chatting-service/internal/user/repository"
+	userService "github.com/Mousa96/chatting-service/internal/user/service"
+	"github.com/Mousa96/chatting-service/internal/websocket/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testJWTKey = []byte("test-key")
+
+func signToken(t *testing.T, userID int, role authModels.Role) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":     userID,
+		"role":        role,
+		"permissions": role.Permissions(),
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}).SignedString(testJWTKey)
+	require.NoError(t, err)
+	return token
+}
+
+// dial connects to server as the holder of token
+func dial(t *testing.T, server *httptest.Server, token string) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + token
+	header := http.Header{"Origin": []string{"http://localhost:8080"}}
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+// readUntil reads events from conn until one of eventType arrives
+func readUntil(t *testing.T, conn *websocket.Conn, eventType string) models.Event {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	for {
+		var event models.Event
+		require.NoError(t, conn.ReadJSON(&event))
+		if event.Type == eventType {
+			return event
+		}
+	}
+}
+
+func TestBroadcastRequiresPermission(t *testing.T) {
+	repo := msgRepository.NewTestMessageRepository()
+	wsService := NewWebSocketService(msgService.NewMessageService(repo, nil), testJWTKey)
+	server := httptest.NewServer(http.HandlerFunc(wsService.ServeWs))
+	defer server.Close()
+
+	broadcast := models.Event{
+		Type:    models.EventBroadcastMessage,
+		Payload: mustMarshal(models.BroadcastMessageEvent{Message: "hello all", ReceiverIDs: []int{2, 3}}),
+	}
+
+	conn, _, err := dial(t, server, signToken(t, 1, authModels.RoleUser))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(broadcast))
+
+	event := readUntil(t, conn, models.EventError)
+	var errorEvent models.ErrorEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &errorEvent))
+	assert.Equal(t, errorCodeNotPermitted, errorEvent.Code)
+	history, err := repo.GetMessageHistory(1)
+	require.NoError(t, err)
+	assert.Empty(t, history, "nothing is stored for refused broadcasts")
+
+	moderator, _, err := dial(t, server, signToken(t, 4, authModels.RoleModerator))
+	require.NoError(t, err)
+	defer moderator.Close()
+	require.NoError(t, moderator.WriteJSON(broadcast))
+
+	readUntil(t, moderator, models.EventReceiveMessage)
+	history, err = repo.GetMessageHistory(4)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestSuspendedUserCannotConnect(t *testing.T) {
+	users := userRepository.NewTestUserRepository()
+	users.AddUser(userModels.User{ID: 1, Username: "alice"})
+	wsService := NewWebSocketService(msgService.NewMessageService(msgRepository.NewTestMessageRepository(), nil), testJWTKey,
+		WithAccountChecker(userService.NewAccountChecker(users)),
+	)
+	server := httptest.NewServer(http.HandlerFunc(wsService.ServeWs))
+	defer server.Close()
+
+	token := signToken(t, 1, authModels.RoleUser)
+	conn, _, err := dial(t, server, token)
+	require.NoError(t, err)
+	conn.Close()
+
+	require.NoError(t, users.SetUserSuspended(1, true))
+	_, resp, err := dial(t, server, token)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = dial(t, server, signToken(t, 2, authModels.RoleUser))
+	require.Error(t, err, "users who no longer exist cannot connect")
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestDemotedModeratorCannotBroadcast(t *testing.T) {
+	users := userRepository.NewTestUserRepository()
+	users.AddUser(userModels.User{ID: 4, Username: "mod", Role: string(authModels.RoleModerator)})
+	repo := msgRepository.NewTestMessageRepository()
+	wsService := NewWebSocketService(msgService.NewMessageService(repo, nil), testJWTKey,
+		WithAccountChecker(userService.NewAccountChecker(users)),
+	)
+	server := httptest.NewServer(http.HandlerFunc(wsService.ServeWs))
+	defer server.Close()
+
+	token := signToken(t, 4, authModels.RoleModerator)
+	require.NoError(t, users.SetUserRole(4, string(authModels.RoleUser)))
+	conn, _, err := dial(t, server, token)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(models.Event{
+		Type:    models.EventBroadcastMessage,
+		Payload: mustMarshal(models.BroadcastMessageEvent{Message: "hello all", ReceiverIDs: []int{2, 3}}),
+	}))
+
+	event := readUntil(t, conn, models.EventError)
+	var errorEvent models.ErrorEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &errorEvent))
+	assert.Equal(t, errorCodeNotPermitted, errorEvent.Code)
+	history, err := repo.GetMessageHistory(4)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
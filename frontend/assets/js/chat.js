@@ -32,6 +32,7 @@ document.addEventListener("DOMContentLoaded", function () {
   const messageForm = document.getElementById("message-form");
   const messageInput = document.getElementById("message-text");
   const sendButton = document.getElementById("send-button");
+  const recordButton = document.getElementById("record-button");
   const chatTitle = document.getElementById("chat-title");
   const userStatus = document.getElementById("selected-user-status");
   const mediaUpload = document.getElementById("media-upload");
@@ -124,7 +125,7 @@ document.addEventListener("DOMContentLoaded", function () {
   // Fetch users
   async function fetchUsers() {
     try {
-      const response = await fetch("/api/users", {
+      const response = await fetch("/api/users?limit=100", {
         headers: {
           Authorization: `Bearer ${token}`,
         },
@@ -133,8 +134,10 @@ document.addEventListener("DOMContentLoaded", function () {
       if (response.ok) {
         const data = await response.json();
 
-        if (data && Array.isArray(data)) {
-          allUsers = data.filter((user) => user.id !== parseInt(currentUserId));
+        if (data && Array.isArray(data.users)) {
+          allUsers = data.users.filter(
+            (user) => user.id !== parseInt(currentUserId)
+          );
           allUsers.forEach((user) => {
             user.status = "offline"; // Default to offline until WebSocket updates
           });
@@ -178,7 +181,7 @@ document.addEventListener("DOMContentLoaded", function () {
 
     li.innerHTML = `
       <span class="status-dot ${statusClass}"></span>
-      <span class="user-name">${user.username}</span>
+      <span class="user-name">${user.display_name || user.username}</span>
     `;
 
     li.addEventListener("click", () => selectUser(user.id));
@@ -209,7 +212,7 @@ document.addEventListener("DOMContentLoaded", function () {
       userItem.innerHTML = `
         <input type="checkbox" id="broadcast-user-${user.id}" value="${user.id}">
         <label for="broadcast-user-${user.id}">
-          ${user.username}
+          ${user.display_name || user.username}
         </label>
         <span class="status-dot ${statusClass}"></span>
       `;
@@ -277,7 +280,7 @@ document.addEventListener("DOMContentLoaded", function () {
       }
     });
 
-    chatTitle.textContent = user.username;
+    chatTitle.textContent = user.display_name || user.username;
 
     // Update status indicator
     const statusDot = userStatus.querySelector(".status-dot");
@@ -291,6 +294,7 @@ document.addEventListener("DOMContentLoaded", function () {
     // Enable message input
     messageInput.disabled = false;
     sendButton.disabled = false;
+    recordButton.disabled = !window.MediaRecorder;
 
     // Load conversation
     loadConversation(user.id);
@@ -363,6 +367,283 @@ document.addEventListener("DOMContentLoaded", function () {
   }
 
   // Create message element
+  // Media served by the API needs a signed URL to load in img/video tags
+  async function setMediaSource(element, attribute, mediaUrl) {
+    if (!mediaUrl.startsWith("/api/media/") || mediaUrl.startsWith("/api/media/avatars/")) {
+      element[attribute] = mediaUrl;
+      return;
+    }
+    try {
+      const response = await fetch(
+        `/api/media/sign?url=${encodeURIComponent(mediaUrl)}`,
+        {
+          headers: {
+            Authorization: `Bearer ${token}`,
+          },
+        }
+      );
+      if (response.ok) {
+        const data = await response.json();
+        element[attribute] = data.url;
+      } else {
+        console.error("Failed to sign media URL:", response.status);
+      }
+    } catch (error) {
+      console.error("Error signing media URL:", error);
+    }
+  }
+
+  // Pick the largest thumbnail that fits the chat bubble, falling back to the poster frame
+  function previewUrl(variants) {
+    const thumbnails = (variants || []).filter(
+      (variant) => variant.name.startsWith("thumb_") && variant.width <= 640
+    );
+    if (thumbnails.length > 0) {
+      return thumbnails[thumbnails.length - 1].url;
+    }
+    const poster = (variants || []).find((variant) => variant.name === "poster");
+    return poster ? poster.url : null;
+  }
+
+  // Render an image, video or download link for a media URL
+  // Formats a byte count for file attachments, e.g. "1.4 MB"
+  function formatFileSize(bytes) {
+    if (!bytes) return "";
+    const units = ["B", "KB", "MB", "GB"];
+    let size = bytes;
+    let unit = 0;
+    while (size >= 1024 && unit < units.length - 1) {
+      size /= 1024;
+      unit++;
+    }
+    return `${unit === 0 ? size : size.toFixed(1)} ${units[unit]}`;
+  }
+
+  function createMediaElement(url, contentType, filename, variants, kind, size) {
+    const mediaEl = document.createElement("div");
+    const type = contentType || "";
+    const preview = previewUrl(variants);
+    // Older attachments have no kind, and external media only a URL
+    const mediaKind =
+      kind ||
+      (type.startsWith("image/") || (!type && url.match(/\.(jpeg|jpg|gif|png|webp)$/i))
+        ? "image"
+        : type.startsWith("video/") || (!type && url.match(/\.(mp4|webm)$/i))
+        ? "video"
+        : type.startsWith("audio/") || (!type && url.match(/\.(ogg|mp3)$/i))
+        ? "audio"
+        : "file");
+
+    if (mediaKind === "image") {
+      const img = document.createElement("img");
+      setMediaSource(img, "src", preview || url);
+      img.className = "message-media";
+      if (preview) {
+        // The thumbnail links to the full-size image
+        const link = document.createElement("a");
+        setMediaSource(link, "href", url);
+        link.target = "_blank";
+        link.appendChild(img);
+        mediaEl.appendChild(link);
+      } else {
+        mediaEl.appendChild(img);
+      }
+    } else if (mediaKind === "video") {
+      const video = document.createElement("video");
+      if (preview) {
+        setMediaSource(video, "poster", preview);
+      }
+      video.preload = "none";
+      setMediaSource(video, "src", url);
+      video.className = "message-media";
+      video.controls = true;
+      mediaEl.appendChild(video);
+    } else if (mediaKind === "audio") {
+      const audio = document.createElement("audio");
+      audio.preload = "none";
+      setMediaSource(audio, "src", url);
+      audio.className = "message-audio";
+      audio.controls = true;
+      mediaEl.appendChild(audio);
+    } else {
+      // Files browsers cannot show are offered for download with their name and size
+      const link = document.createElement("a");
+      setMediaSource(link, "href", url);
+      link.className = "file-attachment";
+      link.target = "_blank";
+
+      const icon = document.createElement("span");
+      icon.className = "file-attachment-icon";
+      icon.textContent = "📄";
+      link.appendChild(icon);
+
+      const name = document.createElement("span");
+      name.className = "file-attachment-name";
+      name.textContent = filename || "Download attachment";
+      link.appendChild(name);
+
+      const sizeEl = document.createElement("span");
+      sizeEl.className = "file-attachment-size";
+      sizeEl.textContent = formatFileSize(size);
+      link.appendChild(sizeEl);
+
+      mediaEl.appendChild(link);
+    }
+    return mediaEl;
+  }
+
+  function formatDuration(ms) {
+    const seconds = Math.round((ms || 0) / 1000);
+    return `${Math.floor(seconds / 60)}:${String(seconds % 60).padStart(2, "0")}`;
+  }
+
+  // Voice messages show the server's waveform over a player. The recipient's first play
+  // is reported so the sender sees the message was listened to.
+  function createVoiceElement(message, attachment, isSentByMe) {
+    const voiceEl = document.createElement("div");
+    voiceEl.className = "voice-message";
+
+    const waveformEl = document.createElement("div");
+    waveformEl.className = "voice-waveform";
+    (attachment.waveform || []).forEach((peak) => {
+      const bar = document.createElement("span");
+      bar.className = "voice-waveform-bar";
+      bar.style.height = `${Math.max(peak, 4)}%`;
+      waveformEl.appendChild(bar);
+    });
+    voiceEl.appendChild(waveformEl);
+
+    const audio = document.createElement("audio");
+    audio.preload = "none";
+    setMediaSource(audio, "src", attachment.url);
+    audio.className = "message-audio";
+    audio.controls = true;
+    voiceEl.appendChild(audio);
+
+    const durationEl = document.createElement("span");
+    durationEl.className = "voice-duration";
+    durationEl.textContent = formatDuration(attachment.duration_ms);
+    voiceEl.appendChild(durationEl);
+
+    // Bars fill in as the recording plays
+    const bars = waveformEl.children;
+    audio.addEventListener("timeupdate", () => {
+      if (!audio.duration) return;
+      const played = Math.floor((audio.currentTime / audio.duration) * bars.length);
+      Array.from(bars).forEach((bar, i) => bar.classList.toggle("played", i < played));
+    });
+
+    if (!isSentByMe && message.status !== "played") {
+      audio.addEventListener(
+        "play",
+        () => sendEvent("message_played", { message_id: message.id }),
+        { once: true }
+      );
+    }
+    return voiceEl;
+  }
+
+  // Link previews are cards linking to the page; all text is set as text, never as HTML
+  function createLinkPreviewElement(preview) {
+    const card = document.createElement("a");
+    card.className = "link-preview";
+    card.href = preview.url;
+    card.target = "_blank";
+    card.rel = "noopener noreferrer";
+
+    if (preview.image_url) {
+      const img = document.createElement("img");
+      img.className = "link-preview-image";
+      img.src = preview.image_url;
+      img.referrerPolicy = "no-referrer";
+      img.loading = "lazy";
+      img.alt = "";
+      card.appendChild(img);
+    }
+
+    const text = document.createElement("div");
+    text.className = "link-preview-text";
+    [
+      ["link-preview-site", preview.site_name],
+      ["link-preview-title", preview.title],
+      ["link-preview-description", preview.description],
+    ].forEach(([className, value]) => {
+      if (!value) return;
+      const el = document.createElement("div");
+      el.className = className;
+      el.textContent = value;
+      text.appendChild(el);
+    });
+    card.appendChild(text);
+    return card;
+  }
+
+  // Formatting is applied from the message's entities; text is only ever set as text.
+  // Offsets count UTF-16 code units, which is how JavaScript strings index.
+  function createEntityElement(entity, text) {
+    switch (entity.type) {
+      case "bold":
+        return document.createElement("strong");
+      case "italic":
+        return document.createElement("em");
+      case "code":
+        return document.createElement("code");
+      case "pre": {
+        const pre = document.createElement("pre");
+        if (entity.language) {
+          pre.dataset.language = entity.language;
+        }
+        return pre;
+      }
+      case "url": {
+        if (!/^https?:\/\//i.test(text)) break;
+        const link = document.createElement("a");
+        link.href = text;
+        link.target = "_blank";
+        link.rel = "noopener noreferrer";
+        return link;
+      }
+      case "mention": {
+        const mention = document.createElement("span");
+        mention.className = "mention";
+        mention.dataset.userId = entity.user_id;
+        if (entity.user_id == window.currentUserId) {
+          mention.classList.add("mention-me");
+        }
+        return mention;
+      }
+    }
+    return document.createElement("span");
+  }
+
+  // Entities come ordered by offset with enclosing ones first, so each one either
+  // follows the one before it or is nested inside it
+  function appendFormatted(parent, text, entities, start, end) {
+    let pos = start;
+    let i = 0;
+    while (i < entities.length) {
+      const entity = entities[i];
+      const entityEnd = entity.offset + entity.length;
+      let next = i + 1;
+      while (next < entities.length && entities[next].offset < entityEnd) {
+        next++;
+      }
+      if (entity.offset >= pos && entityEnd <= end) {
+        if (entity.offset > pos) {
+          parent.appendChild(document.createTextNode(text.slice(pos, entity.offset)));
+        }
+        const el = createEntityElement(entity, text.slice(entity.offset, entityEnd));
+        appendFormatted(el, text, entities.slice(i + 1, next), entity.offset, entityEnd);
+        parent.appendChild(el);
+        pos = entityEnd;
+      }
+      i = next;
+    }
+    if (pos < end) {
+      parent.appendChild(document.createTextNode(text.slice(pos, end)));
+    }
+  }
+
   function createMessageElement(message) {
     const messageEl = document.createElement("div");
     const isSentByMe = message.sender_id == window.currentUserId;
@@ -371,36 +652,43 @@ document.addEventListener("DOMContentLoaded", function () {
     console.log("currentUserId:", window.currentUserId);
     messageEl.className = `message ${isSentByMe ? "sent" : "received"}`;
     messageEl.setAttribute("data-message-id", message.id);
+    if (!isSentByMe && message.mentioned) {
+      messageEl.classList.add("mentioned");
+    }
 
     // Message content
     const contentEl = document.createElement("div");
     contentEl.className = "message-content";
-    contentEl.textContent = message.content || "";
+    const content = message.content || "";
+    appendFormatted(contentEl, content, message.entities || [], 0, content.length);
     messageEl.appendChild(contentEl);
 
-    // Media if present
+    // Uploaded attachments, then any external media link
+    const attachments = message.attachments || [];
+    if (message.kind === "voice" && attachments.length) {
+      messageEl.classList.add("voice");
+      messageEl.appendChild(
+        createVoiceElement(message, attachments[0], isSentByMe)
+      );
+    } else {
+      attachments.forEach((attachment) => {
+        messageEl.appendChild(
+          createMediaElement(
+            attachment.url,
+            attachment.content_type,
+            attachment.filename,
+            attachment.variants,
+            attachment.kind,
+            attachment.size
+          )
+        );
+      });
+    }
     if (message.media_url) {
-      const mediaEl = document.createElement("div");
-
-      if (message.media_url.match(/\.(jpeg|jpg|gif|png)$/i)) {
-        const img = document.createElement("img");
-        img.src = message.media_url;
-        img.className = "message-media";
-        mediaEl.appendChild(img);
-      } else if (message.media_url.match(/\.(mp4|webm|ogg)$/i)) {
-        const video = document.createElement("video");
-        video.src = message.media_url;
-        video.className = "message-media";
-        video.controls = true;
-        mediaEl.appendChild(video);
-      } else {
-        const link = document.createElement("a");
-        link.href = message.media_url;
-        link.textContent = "Download attachment";
-        link.target = "_blank";
-        mediaEl.appendChild(link);
-      }
-      messageEl.appendChild(mediaEl);
+      messageEl.appendChild(createMediaElement(message.media_url));
+    }
+    if (message.link_preview) {
+      messageEl.appendChild(createLinkPreviewElement(message.link_preview));
     }
 
     // Message meta section (timestamp + status)
@@ -466,13 +754,7 @@ document.addEventListener("DOMContentLoaded", function () {
   async function handleMediaUpload(file, isForBroadcast = false) {
     if (!file) return;
 
-    // Validate file type and size
-    const validTypes = ["image/jpeg", "image/png", "image/gif", "video/mp4"];
-    if (!validTypes.includes(file.type)) {
-      alert("Unsupported file type. Please upload an image or MP4 video.");
-      return;
-    }
-
+    // The server decides which types are allowed, from the file's content
     if (file.size > 10 * 1024 * 1024) {
       alert("File too large. Maximum size is 10MB.");
       return;
@@ -494,8 +776,9 @@ document.addEventListener("DOMContentLoaded", function () {
     const fileSize = (file.size / 1024 / 1024).toFixed(2);
     const isImage = file.type.startsWith("image/");
     const isVideo = file.type.startsWith("video/");
+    const isAudio = file.type.startsWith("audio/");
 
-    const icon = isImage ? "🖼️" : isVideo ? "🎥" : "📎";
+    const icon = isImage ? "🖼️" : isVideo ? "🎥" : isAudio ? "🎵" : "📎";
 
     const indicatorHTML = `
       <div class="media-indicator">
@@ -581,11 +864,12 @@ document.addEventListener("DOMContentLoaded", function () {
         window.location.href = "index.html";
         return null;
       }
-      throw new Error("Failed to upload file");
+      // The reason, such as a refused file type, is in the response body
+      throw new Error((await response.text()).trim() || "Failed to upload file");
     }
 
-    const data = await response.json();
-    return data.url;
+    // The attachment is referenced by ID when the message is sent
+    return response.json();
   }
 
   // Send message via WebSocket - FIXED VERSION
@@ -609,12 +893,14 @@ document.addEventListener("DOMContentLoaded", function () {
     }
 
     try {
-      let mediaUrl = null;
+      const attachmentIds = [];
 
       // Upload media file if present
       if (uploadedMediaFile) {
         try {
-          mediaUrl = await uploadMediaFile(uploadedMediaFile);
+          const attachment = await uploadMediaFile(uploadedMediaFile);
+          if (!attachment) return;
+          attachmentIds.push(attachment.id);
         } catch (error) {
           alert("Error uploading media: " + error.message);
           return;
@@ -626,7 +912,7 @@ document.addEventListener("DOMContentLoaded", function () {
         payload: {
           message: content,
           to: selectedUserId,
-          media_url: mediaUrl,
+          attachment_ids: attachmentIds,
         },
       });
 
@@ -636,7 +922,7 @@ document.addEventListener("DOMContentLoaded", function () {
         payload: {
           message: content,
           to: selectedUserId,
-          media_url: mediaUrl || "",
+          attachment_ids: attachmentIds,
         },
       };
 
@@ -662,6 +948,59 @@ document.addEventListener("DOMContentLoaded", function () {
     }
   }
 
+  // Record a voice message with the microphone; clicking again stops and sends it
+  let recorder = null;
+
+  async function toggleRecording() {
+    if (recorder) {
+      recorder.stop();
+      return;
+    }
+    if (!selectedUserId || !isConnected) {
+      return;
+    }
+
+    let stream;
+    try {
+      stream = await navigator.mediaDevices.getUserMedia({ audio: true });
+    } catch (error) {
+      alert("Cannot use the microphone: " + error.message);
+      return;
+    }
+    // Browsers record Ogg/Opus or WebM/Opus, both of which the server accepts
+    const mimeType = ["audio/ogg;codecs=opus", "audio/webm;codecs=opus"].find((type) =>
+      MediaRecorder.isTypeSupported(type)
+    );
+    const chunks = [];
+    const receiverId = selectedUserId;
+    recorder = new MediaRecorder(stream, mimeType ? { mimeType } : undefined);
+    recorder.addEventListener("dataavailable", (e) => chunks.push(e.data));
+    recorder.addEventListener("stop", async () => {
+      stream.getTracks().forEach((track) => track.stop());
+      const type = recorder.mimeType.split(";")[0];
+      recorder = null;
+      recordButton.classList.remove("recording");
+      recordButton.title = "Record a voice message";
+
+      const extension = type === "audio/ogg" ? "ogg" : "webm";
+      const file = new File(chunks, `voice.${extension}`, { type });
+      try {
+        const attachment = await uploadMediaFile(file);
+        if (!attachment) return;
+        sendEvent("send_message", {
+          to: receiverId,
+          kind: "voice",
+          attachment_ids: [attachment.id],
+        });
+      } catch (error) {
+        alert("Error sending voice message: " + error.message);
+      }
+    });
+    recorder.start();
+    recordButton.classList.add("recording");
+    recordButton.title = "Stop and send";
+  }
+
   // Send broadcast via WebSocket
   async function sendBroadcast() {
     const selectedCheckboxes = document.querySelectorAll(
@@ -689,11 +1028,13 @@ document.addEventListener("DOMContentLoaded", function () {
     }
 
     try {
-      let mediaUrl = null;
+      const attachmentIds = [];
 
       if (broadcastMediaFile) {
         try {
-          mediaUrl = await uploadMediaFile(broadcastMediaFile);
+          const attachment = await uploadMediaFile(broadcastMediaFile);
+          if (!attachment) return;
+          attachmentIds.push(attachment.id);
         } catch (error) {
           alert("Error uploading media: " + error.message);
           return;
@@ -705,7 +1046,7 @@ document.addEventListener("DOMContentLoaded", function () {
         payload: {
           message: content,
           receiver_ids: receiverIds,
-          media_url: mediaUrl,
+          attachment_ids: attachmentIds,
         },
       });
 
@@ -715,7 +1056,7 @@ document.addEventListener("DOMContentLoaded", function () {
         payload: {
           message: content,
           receiver_ids: receiverIds,
-          media_url: mediaUrl || "",
+          attachment_ids: attachmentIds,
         },
       };
 
@@ -770,6 +1111,7 @@ document.addEventListener("DOMContentLoaded", function () {
 
   // Event listeners
   messageForm.addEventListener("submit", sendMessage);
+  recordButton.addEventListener("click", toggleRecording);
   mediaUpload.addEventListener("change", (e) =>
     handleMediaUpload(e.target.files[0])
   );
@@ -816,6 +1158,7 @@ document.addEventListener("DOMContentLoaded", function () {
 
   // Make functions globally accessible
   window.addMessageToConversation = addMessageToConversation;
+  window.createLinkPreviewElement = createLinkPreviewElement;
   window.loadConversation = loadConversation;
   window.selectUser = selectUser;
   window.updateOnlineCount = updateOnlineCount;
@@ -833,6 +1176,8 @@ function getStatusText(status) {
       return "✓✓";
     case "read":
       return "✓✓";
+    case "played":
+      return "✓✓";
     default:
       return "";
   }
@@ -846,6 +1191,8 @@ function getStatusTitle(status) {
       return "Message delivered";
     case "read":
       return "Message read";
+    case "played":
+      return "Voice message played";
     default:
       return "";
   }
@@ -32,6 +32,26 @@ function routeEvent(event) {
     case "typing":
       handleTypingIndicator(event.payload);
       break;
+    case "user_profile_updated":
+      handleUserProfileUpdated(event.payload);
+      break;
+    case "message_hidden":
+    case "message_expired":
+      handleMessageHidden(event.payload);
+      break;
+    case "message_updated":
+      handleMessageUpdated(event.payload);
+      break;
+    case "message_pinned":
+    case "message_unpinned":
+      handleMessagePinChanged(event.type, event.payload);
+      break;
+    case "moderation_warning":
+      handleModerationWarning(event.payload);
+      break;
+    case "scheduled_message_failed":
+      handleScheduledMessageFailed(event.payload);
+      break;
     case "error":
       handleError(event.payload);
       break;
@@ -62,11 +82,16 @@ function handleNewMessage(messageData) {
     id: message.id,
     sender_id: message.sender_id,
     receiver_id: message.receiver_id,
+    kind: message.kind || "text",
     content: message.content,
     media_url: message.media_url,
+    attachments: message.attachments || [],
     status: message.status || "sent", // Always ensure we have a status
     created_at: message.created_at,
     updated_at: message.updated_at,
+    entities: message.entities || [],
+    muted: message.muted || false,
+    mentioned: message.mentioned || false,
   };
 
   console.log("Normalized message with status:", normalizedMessage);
@@ -91,8 +116,10 @@ function handleNewMessage(messageData) {
     }
   }
 
-  // Show notification for new messages when not viewing that conversation
+  // Show notification for new messages when not viewing that conversation,
+  // unless the conversation is muted and the message does not mention us
   if (
+    (!normalizedMessage.muted || normalizedMessage.mentioned) &&
     normalizedMessage.sender_id !== currentUserId &&
     window.selectedUserId !== normalizedMessage.sender_id
   ) {
@@ -203,6 +230,8 @@ function getStatusText(status) {
       return "✓✓";
     case "read":
       return "✓✓";
+    case "played":
+      return "✓✓";
     default:
       return "✓"; // Default to sent
   }
@@ -218,6 +247,8 @@ function getStatusTitle(status) {
       return "Message delivered";
     case "read":
       return "Message read";
+    case "played":
+      return "Voice message played";
     default:
       return "Message sent";
   }
@@ -248,6 +279,84 @@ function handleUserStatusChange(payload) {
   }
 }
 
+function handleUserProfileUpdated(payload) {
+  const profile = typeof payload === "string" ? JSON.parse(payload) : payload;
+  if (!profile || !profile.user_id) return;
+
+  const user = (window.allUsers || []).find((u) => u.id === profile.user_id);
+  if (user) {
+    user.display_name = profile.display_name;
+    user.avatar_url = profile.avatar_url;
+    user.bio = profile.bio;
+    user.time_zone = profile.time_zone;
+  }
+
+  const name = profile.display_name || profile.username;
+  const nameEl = document.querySelector(`#user-${profile.user_id} .user-name`);
+  if (nameEl && name) {
+    nameEl.textContent = name;
+  }
+}
+
+// Hidden and expired messages are taken out of the open conversation
+function handleMessageHidden(payload) {
+  const data = typeof payload === "string" ? JSON.parse(payload) : payload;
+  if (!data || !data.message_id) return;
+
+  const messageEl = document.querySelector(
+    `[data-message-id="${data.message_id}"]`
+  );
+  if (messageEl) {
+    messageEl.remove();
+  }
+}
+
+// Pins are shared by both participants, so either may have changed them
+function handleMessagePinChanged(type, payload) {
+  const data = typeof payload === "string" ? JSON.parse(payload) : payload;
+  if (!data || !data.message_id) return;
+
+  const messageEl = document.querySelector(
+    `[data-message-id="${data.message_id}"]`
+  );
+  if (messageEl) {
+    messageEl.classList.toggle("pinned", type === "message_pinned");
+  }
+}
+
+// Link previews arrive after the message; the card goes above its time and status
+function handleMessageUpdated(payload) {
+  const data = typeof payload === "string" ? JSON.parse(payload) : payload;
+  if (!data || !data.message_id || !data.link_preview) return;
+
+  const messageEl = document.querySelector(
+    `[data-message-id="${data.message_id}"]`
+  );
+  if (!messageEl || !window.createLinkPreviewElement) return;
+
+  const card = window.createLinkPreviewElement(data.link_preview);
+  const existing = messageEl.querySelector(".link-preview");
+  if (existing) {
+    existing.replaceWith(card);
+  } else {
+    messageEl.insertBefore(card, messageEl.querySelector(".message-meta"));
+  }
+}
+
+function handleModerationWarning(payload) {
+  const data = typeof payload === "string" ? JSON.parse(payload) : payload;
+  if (!data || !data.message) return;
+
+  alert("Moderator warning: " + data.message);
+}
+
+function handleScheduledMessageFailed(payload) {
+  const data = typeof payload === "string" ? JSON.parse(payload) : payload;
+  if (!data) return;
+
+  alert("A scheduled message could not be sent: " + (data.error || "unknown error"));
+}
+
 function handleTypingIndicator(payload) {
   console.log("Typing indicator:", payload);
 
@@ -298,7 +407,10 @@ function showMessageNotification(message) {
   // Optional: Show browser notification if supported
   if (Notification.permission === "granted") {
     const userName = user ? user.username : `User ${message.sender_id}`;
-    new Notification(`New message from ${userName}`, {
+    const title = message.mentioned
+      ? `${userName} mentioned you`
+      : `New message from ${userName}`;
+    new Notification(title, {
       body: message.content || "Sent a media file",
       icon: "/favicon.ico",
     });